@@ -12,9 +12,12 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 
-	"github.com/albnnaardy11/pahlawan-pangan/internal/fintech"
+	escrowRepo "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/repository"
+	escrowService "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/service"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/geo"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
 	"github.com/albnnaardy11/pahlawan-pangan/pkg/utils"
 )
 
@@ -22,6 +25,7 @@ import (
 var (
 	surplusDB = make(map[string]SurplusItem)
 	mu        sync.RWMutex
+	ledger    = escrowService.NewEscrowService(escrowRepo.NewMemoryRepository(), zap.NewNop())
 )
 
 type SurplusItem struct {
@@ -163,9 +167,8 @@ func ClaimSurplus(w http.ResponseWriter, r *http.Request) {
 	time.Sleep(time.Duration(rand.IntN(100)) * time.Millisecond) // #nosec G404
 
 	// Fintech Layer: Lock Funds
-	escrow := fintech.NewEscrowService()
-	payment, err := escrow.LockFunds(r.Context(), "NGO-User-001", 25000.0)
-	if err != nil {
+	// No payment gateway in the demo: the buyer's money is taken as collected
+	if err := ledger.SecurePayment(r.Context(), id, money.Rupiah(25000)); err != nil {
 		http.Error(w, "Failed to lock funds", http.StatusInternalServerError)
 		return
 	}
@@ -178,7 +181,7 @@ func ClaimSurplus(w http.ResponseWriter, r *http.Request) {
 			"courier": "Pahlawan-Express Driver #402",
 		},
 		"escrow": map[string]interface{}{
-			"payment_id": payment.ID,
+			"payment_id": id,
 			"status":     "FUNDS_LOCKED_IN_ESCROW",
 			"amount":     "Rp25.000",
 		},
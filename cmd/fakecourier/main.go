@@ -0,0 +1,41 @@
+// Package main runs the deterministic fake courier partner used for offline
+// end-to-end testing of external deliveries.
+//
+//	FAKE_COURIER_ADDR=:8090 FAKE_COURIER_WEBHOOK_SECRET=dev go run ./cmd/fakecourier
+//
+// Point the server at it with COURIER_PROVIDERS=fake=http://localhost:8090 and
+// the same COURIER_PROVIDER_FAKE_WEBHOOK_SECRET, then drive bookings with
+// POST /v1/bookings/{id}/advance.
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/provider"
+)
+
+func main() {
+	addr := os.Getenv("FAKE_COURIER_ADDR")
+	if addr == "" {
+		addr = ":8090"
+	}
+
+	fake := provider.NewFakeServer(provider.FakeConfig{
+		APIKey:        os.Getenv("FAKE_COURIER_API_KEY"),
+		WebhookSecret: os.Getenv("FAKE_COURIER_WEBHOOK_SECRET"),
+		ColdChain:     os.Getenv("FAKE_COURIER_COLD_CHAIN") == "true",
+	})
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           fake,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	log.Printf("Fake courier provider listening on %s", addr)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,53 @@
+// Package main runs the deterministic fake payment gateway used for offline
+// end-to-end testing of escrow payments.
+//
+//	FAKE_GATEWAY_ADDR=:8091 FAKE_GATEWAY_WEBHOOK_SECRET=dev go run ./cmd/fakegateway
+//
+// Point the server at it with PAYMENT_GATEWAY_NAME=fake,
+// PAYMENT_GATEWAY_URL=http://localhost:8091 and the same
+// PAYMENT_GATEWAY_WEBHOOK_SECRET. Script outcomes per order with
+// POST /v1/scripts {"order_id": "...", "scenario": "decline"}.
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/fintech/gateway"
+)
+
+func main() {
+	addr := os.Getenv("FAKE_GATEWAY_ADDR")
+	if addr == "" {
+		addr = ":8091"
+	}
+
+	var delay time.Duration
+	if raw := os.Getenv("FAKE_GATEWAY_CALLBACK_DELAY"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			log.Fatalf("FAKE_GATEWAY_CALLBACK_DELAY: %v", err)
+		}
+		delay = d
+	}
+
+	fake := gateway.NewFakeServer(gateway.FakeConfig{
+		APIKey:          os.Getenv("FAKE_GATEWAY_API_KEY"),
+		WebhookSecret:   os.Getenv("FAKE_GATEWAY_WEBHOOK_SECRET"),
+		Scenario:        gateway.Scenario(os.Getenv("FAKE_GATEWAY_SCENARIO")),
+		CallbackDelay:   delay,
+		ManualCallbacks: os.Getenv("FAKE_GATEWAY_MANUAL_CALLBACKS") == "true",
+	})
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           fake,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	log.Printf("Fake payment gateway listening on %s", addr)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -2,30 +2,49 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"database/sql"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	api "github.com/albnnaardy11/pahlawan-pangan/internal/api"
 	apiMiddleware "github.com/albnnaardy11/pahlawan-pangan/internal/api/middleware"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/audit"
+	auditHttp "github.com/albnnaardy11/pahlawan-pangan/internal/audit/delivery/http"
+	disputeHttp "github.com/albnnaardy11/pahlawan-pangan/internal/dispute/delivery/http"
+	disputeRepo "github.com/albnnaardy11/pahlawan-pangan/internal/dispute/repository"
+	disputeUsecase "github.com/albnnaardy11/pahlawan-pangan/internal/dispute/usecase"
+	coreDomain "github.com/albnnaardy11/pahlawan-pangan/internal/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/fintech"
+	fintechHttp "github.com/albnnaardy11/pahlawan-pangan/internal/fintech/delivery/http"
+	paymentGateway "github.com/albnnaardy11/pahlawan-pangan/internal/fintech/gateway"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/geo"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/inventory"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/ledger"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/loyalty"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/matching"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/messaging"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/notifications"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/outbox"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/pickup"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/recommendation"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/trust"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/worker"
 
 	// Logistics & Escrow Modules
+	escrowRepo "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/repository"
 	escrowService "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/service"
 	logisticsHttp "github.com/albnnaardy11/pahlawan-pangan/internal/logistics/delivery/http"
+	logisticsDomain "github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+	logisticsProvider "github.com/albnnaardy11/pahlawan-pangan/internal/logistics/provider"
+	logisticsRepo "github.com/albnnaardy11/pahlawan-pangan/internal/logistics/repository"
 	logisticsService "github.com/albnnaardy11/pahlawan-pangan/internal/logistics/service"
 
 	// Community Module
@@ -35,6 +54,7 @@ import (
 
 	// Carbon Module (ESG)
 	carbonHttp "github.com/albnnaardy11/pahlawan-pangan/internal/carbon/delivery/http"
+	carbonDomain "github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
 	carbonRepo "github.com/albnnaardy11/pahlawan-pangan/internal/carbon/repository"
 	carbonService "github.com/albnnaardy11/pahlawan-pangan/internal/carbon/service"
 
@@ -152,31 +172,96 @@ func main() {
 	// Inventory Webhook Service (Flash Ludes)
 	inventorySvc := inventory.NewInventoryService(outboxRepo, logger.Log)
 
-	// Trust & Safety (Credit Scoring)
-	trustSvc := trust.NewTrustService()
+	// Trust & Safety (Credit Scoring): pickups, account age and KYC build the score; lost disputes and no-shows weigh on it
+	disputeRepository := disputeRepo.NewPostgresRepository(db)
+	staleClaimRepository := disputeRepo.NewStaleClaimRepository(db)
+	trustSvc := trust.NewTrustService(disputeRepository, staleClaimRepository, trust.NewPostgresAccountRepository(db))
 
 	// Personalization Engine (Smart Nudges)
 	recSvc := recommendation.NewRecommendationService()
 
+	// Self-Pickup Codes (per-claim, QR-signed, rate-limited at the counter)
+	pickupSvc := pickup.NewService(pickup.NewPostgresRepository(db, outboxRepo), pickup.NewSigner(pickupSecretFromEnv()), pickup.DefaultCodeTTL, logger.Log)
+
+	// Carbon ledger: hash-chained savings priced with versioned emission factors,
+	// checkpointed under signed Merkle roots
+	factorSvc := carbonService.NewFactorService(carbonRepo.NewFactorRepository(db), logger.Log)
+	carbonSvc := carbonService.NewCarbonService(carbonRepo.NewCarbonRepository(db), factorSvc,
+		carbonSignerFromEnv("CARBON_SIGNING_KEY_FILE", "carbon checkpoints"),
+		carbonSignerFromEnv("ESG_CERTIFICATE_KEY_FILE", "ESG certificates"),
+		logger.Log)
+
 	// 9. Init New API Handler (Unicorn Features)
-	mainHandler := api.NewHandler(db, matchEngine, outboxSvc, loyaltySvc, inventorySvc, trustSvc, recSvc)
+	mainHandler := api.NewHandler(db, matchEngine, outboxSvc, loyaltySvc, inventorySvc, trustSvc, recSvc, pickupSvc, carbonSvc)
 
 	// Mount API V1 Routes
 	r.Mount("/", mainHandler.Routes())
 
+	// 15. UNICORN IAM & SECURITY
+	authenticationRepo := authRepo.NewPostgresUserRepository(db)
+	authenticationUC := authUsecase.NewAuthUsecase(authenticationRepo, redisClient, natsPublisher, time.Second*5)
+	authenticationHandler := authHttp.NewAuthHandler(authenticationUC)
+	r.Mount("/api/v1/auth", authenticationHandler.Routes())
+
+	// Money-moving and courier routes act as the signed-in user
+	authenticated := r.With(iamMiddleware.AuthMiddleware(authenticationUC))
+
 	// 11. UNICORN LOGISTICS & ESCROW
 	// Escrow (Financial Integrity)
-	_ = escrowService.NewEscrowService() // In-memory demo
+	escrowSvc := escrowService.NewEscrowService(escrowRepo.NewPostgresRepository(db), logger.Log)
+	// Double-entry journal: every rupiah moved is booked here
+	journal := ledger.NewService(ledger.NewPostgresRepository(db), logger.Log)
+	// Payments: the gateway moves the money, its signed callbacks drive the escrow
+	gateway := paymentGatewayFromEnv()
+	// Released orders are swept to providers in batches on the payout cadence
+	payoutSvc := fintech.NewPayoutService(fintech.NewPostgresPayoutRepository(db), journal, gateway, payoutScheduleFromEnv(), logger.Log)
+	// Buyer wallets: stored value in the journal, spend capped by trust level
+	walletSvc := fintech.NewWalletService(fintech.NewPostgresWalletRepository(db), journal, trustSvc, gateway, fintech.DefaultWalletLimits(), logger.Log)
+	paymentsSvc := fintech.NewEscrowService(escrowSvc, journal, fintech.NewPostgresPaymentRepository(db), payoutSvc, walletSvc, gateway, logger.Log)
+	authenticated.Mount("/api/v1/payments", fintechHttp.NewPaymentHandler(paymentsSvc).Routes())
+	authenticated.Mount("/api/v1/wallets", fintechHttp.NewWalletHandler(walletSvc).Routes())
+	r.Mount("/api/v1/payouts", fintechHttp.NewPayoutHandler(payoutSvc).Routes())
+	go payoutSvc.RunPayoutScheduler(context.Background())
+	// Triple reconciliation: main DB vs escrow event store vs gateway settlement files
+	auditRepository := audit.NewPostgresRepository(db)
+	auditEngine := audit.NewReconciliationEngine(auditRepository, audit.NewNATSAlerter(nc), logger.Log)
+	r.Mount("/api/v1/audit", auditHttp.NewReconciliationHandler(auditEngine, auditRepository).Routes())
 
 	// Batching & Dispatch (The Brain)
 	batchEngine := logisticsService.NewBatchingEngine()
-	dispatchSvc := logisticsService.NewDispatchService(batchEngine)
-
-	// Start batch processor worker
+	orderQueue := logisticsRepo.NewRedisOrderQueue(redisClient)
+	courierGeo := geo.NewGeoService(redisClient)
+	courierRepository := logisticsRepo.NewCourierRepository(db)
+	courierSvc := logisticsService.NewCourierService(courierRepository, authRepo.NewPostgresUserRepository(db), courierGeo)
+	assignmentRepository := logisticsRepo.NewAssignmentRepository(db)
+	notifSvc := &notifications.NotificationService{} // In real app, inject FCM client here
+	// Dropoff OTPs go to the recipient's device, never through the outbox
+	deliverySvc := logisticsService.NewDeliveryService(logisticsRepo.NewDeliveryRepository(db, outboxRepo), courierRepository, assignmentRepository, notifSvc, logger.Log)
+	// Disputes freeze the escrow; evidence, deadlines and the outcome decide who gets the money
+	evidenceDir := disputeEvidenceDirFromEnv()
+	disputeUC := disputeUsecase.NewDisputeUsecase(disputeRepository, staleClaimRepository, disputeRepo.NewFileEvidenceStore(evidenceDir, "/dispute-evidence"), paymentsSvc, disputePolicyFromEnv(), logger.Log)
+	authenticated.Mount("/api/v1/disputes", disputeHttp.NewDisputeHandler(disputeUC).Routes())
+	r.Handle("/dispute-evidence/*", http.StripPrefix("/dispute-evidence/", http.FileServer(http.Dir(evidenceDir))))
+	go disputeUC.RunDeadlineEnforcer(context.Background())
+	// Paid claims stuck before pickup are refunded and the surplus relisted
+	go disputeUC.RunStaleClaimRefunder(context.Background())
+	// Cold-chain monitor: excursions condemn the load and open a dispute
+	telemetrySvc := logisticsService.NewTelemetryService(logisticsRepo.NewTelemetryRepository(db), deliverySvc, notifSvc, disputeUC, logger.Log)
+	// Fees are fixed when a courier accepts; earnings are credited on completion
+	earningsSvc := logisticsService.NewEarningsService(logisticsService.NewFeeEngine(router, logisticsService.DefaultFeeSchedule()), logisticsRepo.NewEarningsRepository(db), journal, deliverySvc, courierRepository, assignmentRepository, courierGeo, logger.Log)
+	assignmentSvc := logisticsService.NewAssignmentService(courierRepository, assignmentRepository, courierGeo, logisticsService.NewRouteOptimizer(router), deliverySvc, earningsSvc, logger.Log)
+	dispatchSvc := logisticsService.NewDispatchService(batchEngine, orderQueue, assignmentSvc, logger.Log)
+	fulfillmentSvc := logisticsService.NewFulfillmentService(dispatchSvc, deliverySvc, courierRepository, courierGeo, courierProvidersFromEnv(), logger.Log)
+	slaMonitor := logisticsService.NewSLAMonitor(dispatchSvc, assignmentRepository, deliverySvc, logisticsRepo.NewSLARepository(db), logger.Log)
+
+	// Start batch processor, anti-stuck deadline, courier assignment & SLA monitor workers
 	go dispatchSvc.RunBatchProcessor(context.Background())
+	go dispatchSvc.RunDeadlineScanner(context.Background())
+	go assignmentSvc.RunAssignmentLoop(context.Background())
+	go slaMonitor.RunSLAMonitor(context.Background())
 
-	logisticsHandler := logisticsHttp.NewLogisticsHandler(dispatchSvc)
-	r.Mount("/api/v1/logistics", logisticsHandler.Routes())
+	logisticsHandler := logisticsHttp.NewLogisticsHandler(dispatchSvc, courierSvc, assignmentSvc, deliverySvc, telemetrySvc, slaMonitor, fulfillmentSvc, earningsSvc)
+	authenticated.Mount("/api/v1/logistics", logisticsHandler.Routes())
 
 	// 12. UNICORN COMMUNITY (Social Proof)
 	communityRepository := communityRepo.NewReviewRepository(db)
@@ -185,16 +270,16 @@ func main() {
 	r.Mount("/api/v1/community", communityHandler.Routes())
 
 	// 13. UNICORN ESG (Sustainability - Blockchain Ready)
-	carbonRepository := carbonRepo.NewCarbonRepository(db)
-	carbonSvc := carbonService.NewCarbonService(carbonRepository)
-	carbonHandler := carbonHttp.NewCarbonHandler(carbonSvc)
+	carbonPublicURL := os.Getenv("PUBLIC_BASE_URL")
+	if carbonPublicURL == "" {
+		carbonPublicURL = "http://localhost:8080"
+	}
+	creditSvc := carbonService.NewCreditService(carbonRepo.NewCarbonRepository(db), creditPolicyFromEnv(), logger.Log)
+	carbonHandler := carbonHttp.NewCarbonHandler(carbonSvc, factorSvc, creditSvc, authenticationUC, carbonPublicURL)
 	r.Mount("/api/v1/carbon", carbonHandler.Routes())
-
-	// 15. UNICORN IAM & SECURITY
-	authenticationRepo := authRepo.NewPostgresUserRepository(db)
-	authenticationUC := authUsecase.NewAuthUsecase(authenticationRepo, redisClient, natsPublisher, time.Second*5)
-	authenticationHandler := authHttp.NewAuthHandler(authenticationUC)
-	r.Mount("/api/v1/auth", authenticationHandler.Routes())
+	go carbonSvc.RunChainVerifier(context.Background(), 15*time.Minute)
+	go carbonSvc.RunCheckpointer(context.Background(), time.Hour)
+	go creditSvc.RunCreditIssuer(context.Background(), time.Hour)
 
 	// 16. UNICORN MFA WORKER (Async OTP)
 	_, _ = nc.Subscribe("otp.request", func(m *nats.Msg) {
@@ -225,13 +310,41 @@ func main() {
 		}
 	}()
 
-	// 8. Start Reconciliation Engine (Midnight Audit Simulation)
-	auditEngine := audit.NewReconciliationEngine()
+	// Escrow Delivery Worker (assigned -> picked up -> delivered)
+	escrowWorker := worker.NewEscrowWorker(escrowSvc, nc, logger.Log)
+	go func() {
+		if err := escrowWorker.Start(context.Background()); err != nil {
+			logger.Error("EscrowWorker failed to start", zap.Error(err))
+		}
+	}()
+
+	// Courier Earnings Worker (credits the ledger on DELIVERY.completed)
+	earningsWorker := worker.NewEarningsWorker(earningsSvc, nc, logger.Log)
+	go func() {
+		if err := earningsWorker.Start(context.Background()); err != nil {
+			logger.Error("EarningsWorker failed to start", zap.Error(err))
+		}
+	}()
+
+	// Cold-Chain Telemetry Worker (thermal-bag sensors over NATS)
+	telemetryWorker := worker.NewTelemetryWorker(telemetrySvc, nc, logger.Log)
+	go func() {
+		if err := telemetryWorker.Start(context.Background()); err != nil {
+			logger.Error("TelemetryWorker failed to start", zap.Error(err))
+		}
+	}()
+
+	// 8. Start Reconciliation Engine (Daily audit of the previous business day)
 	go func() {
 		ticker := time.NewTicker(24 * time.Hour)
 		defer ticker.Stop()
 		for range ticker.C {
-			_, _ = auditEngine.RunAudit(context.Background())
+			if _, err := auditEngine.RunAudit(context.Background(), time.Now().AddDate(0, 0, -1)); err != nil {
+				logger.Error("Reconciliation run failed", zap.Error(err))
+			}
+			if tb, err := journal.CheckInvariant(context.Background()); err != nil {
+				logger.Error("Journal invariant check failed", zap.Error(err), zap.Any("trial_balance", tb))
+			}
 		}
 	}()
 
@@ -243,8 +356,7 @@ func main() {
 	}
 
 	// 9. Unicorn Logic: Real-time Notification Engine
-	geoSvc := geo.NewGeoService(redisClient)         // Use the initialized redisClient
-	notifSvc := &notifications.NotificationService{} // In real app, inject FCM client here
+	geoSvc := geo.NewGeoService(redisClient) // Use the initialized redisClient
 
 	notifierWorker := worker.NewSurplusNotifier(geoSvc, notifSvc)
 	go notifierWorker.Run(context.Background(), nc)
@@ -269,6 +381,176 @@ func main() {
 	}
 }
 
+// courierProvidersFromEnv reads partner fleets from COURIER_PROVIDERS
+// ("gojek=https://...,fake=http://localhost:8090") with credentials in
+// COURIER_PROVIDER_<NAME>_API_KEY and COURIER_PROVIDER_<NAME>_WEBHOOK_SECRET
+func courierProvidersFromEnv() []logisticsDomain.CourierProvider {
+	publicURL := os.Getenv("PUBLIC_BASE_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:8080"
+	}
+
+	var providers []logisticsDomain.CourierProvider
+	for _, entry := range strings.Split(os.Getenv("COURIER_PROVIDERS"), ",") {
+		name, baseURL, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" || baseURL == "" {
+			continue
+		}
+		prefix := "COURIER_PROVIDER_" + strings.ToUpper(name)
+		providers = append(providers, logisticsProvider.NewHTTPProvider(logisticsProvider.Config{
+			Name:          name,
+			BaseURL:       baseURL,
+			APIKey:        os.Getenv(prefix + "_API_KEY"),
+			WebhookSecret: os.Getenv(prefix + "_WEBHOOK_SECRET"),
+			CallbackURL:   publicURL + "/api/v1/logistics/providers/" + name + "/webhook",
+		}))
+		logger.Info("Courier provider enabled", zap.String("provider", name), zap.String("base_url", baseURL))
+	}
+	return providers
+}
+
+// paymentGatewayFromEnv configures the payment gateway from
+// PAYMENT_GATEWAY_NAME and PAYMENT_GATEWAY_URL, with credentials in
+// PAYMENT_GATEWAY_API_KEY and PAYMENT_GATEWAY_WEBHOOK_SECRET. Without one,
+// escrow is ledger-only and payments cannot be started.
+func paymentGatewayFromEnv() fintech.PaymentGateway {
+	name, baseURL := os.Getenv("PAYMENT_GATEWAY_NAME"), os.Getenv("PAYMENT_GATEWAY_URL")
+	if name == "" || baseURL == "" {
+		logger.Log.Warn("PAYMENT_GATEWAY_NAME/PAYMENT_GATEWAY_URL not set, payments are disabled")
+		return nil
+	}
+	publicURL := os.Getenv("PUBLIC_BASE_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:8080"
+	}
+
+	logger.Info("Payment gateway enabled", zap.String("gateway", name), zap.String("base_url", baseURL))
+	return paymentGateway.NewHTTPGateway(paymentGateway.Config{
+		Name:          name,
+		BaseURL:       baseURL,
+		APIKey:        os.Getenv("PAYMENT_GATEWAY_API_KEY"),
+		WebhookSecret: os.Getenv("PAYMENT_GATEWAY_WEBHOOK_SECRET"),
+		CallbackURL:   publicURL + "/api/v1/payments/webhooks/" + name,
+	})
+}
+
+// payoutScheduleFromEnv overrides the default daily payout with PAYOUT_CADENCE
+// ("daily" or "weekly"), PAYOUT_WEEKDAY (0 = Sunday), PAYOUT_MINIMUM_IDR and
+// PAYOUT_TRANSFER_FEE_IDR
+func payoutScheduleFromEnv() fintech.PayoutSchedule {
+	schedule := fintech.DefaultPayoutSchedule()
+	if v := os.Getenv("PAYOUT_CADENCE"); v != "" {
+		schedule.Cadence = fintech.PayoutCadence(v)
+	}
+	if v, err := strconv.Atoi(os.Getenv("PAYOUT_WEEKDAY")); err == nil && v >= 0 && v <= 6 {
+		schedule.Weekday = time.Weekday(v)
+	}
+	if v, err := strconv.ParseInt(os.Getenv("PAYOUT_MINIMUM_IDR"), 10, 64); err == nil {
+		schedule.MinimumPayout = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("PAYOUT_TRANSFER_FEE_IDR"), 10, 64); err == nil {
+		schedule.TransferFee = v
+	}
+	if err := schedule.Validate(); err != nil {
+		logger.Error("Invalid payout schedule", zap.Error(err))
+		os.Exit(1)
+	}
+	logger.Info("Payout schedule", zap.String("cadence", string(schedule.Cadence)),
+		zap.Int64("minimum_idr", schedule.MinimumPayout), zap.Int64("transfer_fee_idr", schedule.TransferFee))
+	return schedule
+}
+
+// disputeEvidenceDirFromEnv is where uploaded dispute evidence is kept
+func disputeEvidenceDirFromEnv() string {
+	if dir := os.Getenv("DISPUTE_EVIDENCE_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "pahlawan-dispute-evidence")
+}
+
+// disputePolicyFromEnv reads the stale claim SLAs in minutes, per delivery
+// tier: STALE_CLAIM_<TIER>_AWAITING_PICKUP_MIN, STALE_CLAIM_<TIER>_PICKUP_MIN
+// (e.g. STALE_CLAIM_EXPRESS_PICKUP_MIN), and RELIST_MIN_SHELF_LIFE_MIN
+func disputePolicyFromEnv() coreDomain.DisputePolicy {
+	policy := coreDomain.DefaultDisputePolicy()
+	minutes := func(env string, target *time.Duration) {
+		if v, err := strconv.Atoi(os.Getenv(env)); err == nil && v > 0 {
+			*target = time.Duration(v) * time.Minute
+		}
+	}
+	for tier, sla := range policy.StaleClaimSLAs {
+		minutes("STALE_CLAIM_"+tier+"_AWAITING_PICKUP_MIN", &sla.AwaitingPickup)
+		minutes("STALE_CLAIM_"+tier+"_PICKUP_MIN", &sla.Pickup)
+		policy.StaleClaimSLAs[tier] = sla
+		logger.Info("Stale claim SLA", zap.String("sla_tier", tier),
+			zap.Duration("awaiting_pickup", sla.AwaitingPickup), zap.Duration("pickup", sla.Pickup))
+	}
+	minutes("RELIST_MIN_SHELF_LIFE_MIN", &policy.MinShelfLife)
+	logger.Info("Stale claim relisting", zap.Duration("min_shelf_life", policy.MinShelfLife))
+	return policy
+}
+
+// pickupSecretFromEnv returns the key signing self-pickup QR codes. Without
+// PICKUP_QR_SECRET a random key is used, so codes only verify on this instance
+// until it restarts.
+func pickupSecretFromEnv() []byte {
+	if secret := os.Getenv("PICKUP_QR_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	logger.Log.Warn("PICKUP_QR_SECRET not set, using an ephemeral key for pickup QR codes")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		logger.Error("Failed to generate pickup QR key", zap.Error(err))
+		os.Exit(1)
+	}
+	return secret
+}
+
+// creditPolicyFromEnv overrides the default carbon credit size and issuance
+// threshold with CARBON_CREDIT_KG_PER_TOKEN and CARBON_CREDIT_MIN_TOKENS
+func creditPolicyFromEnv() carbonDomain.CreditPolicy {
+	policy := carbonDomain.DefaultCreditPolicy()
+	if v, err := strconv.ParseFloat(os.Getenv("CARBON_CREDIT_KG_PER_TOKEN"), 64); err == nil {
+		policy.GramsPerToken = carbonDomain.Grams(v)
+	}
+	if v, err := strconv.ParseInt(os.Getenv("CARBON_CREDIT_MIN_TOKENS"), 10, 64); err == nil {
+		policy.MinTokens = v
+	}
+	if err := policy.Validate(); err != nil {
+		logger.Error("Invalid carbon credit policy", zap.Error(err))
+		os.Exit(1)
+	}
+	logger.Info("Carbon credit policy", zap.Int64("co2e_grams_per_token", policy.GramsPerToken), zap.Int64("min_tokens", policy.MinTokens))
+	return policy
+}
+
+// carbonSignerFromEnv loads an Ed25519 signing key from the PKCS#8 PEM file
+// named by envVar (`keygen -type ed25519` writes one). Checkpoints and
+// certificates each have their own.
+func carbonSignerFromEnv(envVar, signs string) *carbonDomain.Signer {
+	path := os.Getenv(envVar)
+	if path == "" {
+		logger.Log.Warn(envVar + " not set, using an ephemeral key for " + signs)
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			logger.Error("Failed to generate signing key for "+signs, zap.Error(err))
+			os.Exit(1)
+		}
+		return carbonDomain.NewSigner(key)
+	}
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		logger.Error("Failed to read signing key for "+signs, zap.Error(err))
+		os.Exit(1)
+	}
+	signer, err := carbonDomain.ParseSigner(pemBytes)
+	if err != nil {
+		logger.Error("Invalid signing key for "+signs, zap.Error(err))
+		os.Exit(1)
+	}
+	return signer
+}
+
 type MockRouter struct{}
 
 func (m *MockRouter) GetTravelTime(ctx context.Context, startLat, startLon, endLat, endLon float64) (time.Duration, error) {
@@ -0,0 +1,82 @@
+// Package main verifies an ESG certificate offline, the way a partner's
+// auditor would: no database and no network, only the certificate and the two
+// published public keys.
+//
+//	curl -o esg-certificate.pub.pem https://<host>/api/v1/carbon/certificate-key
+//	curl -o carbon-signing.pub.pem  https://<host>/api/v1/carbon/signing-key
+//	go run ./cmd/tools/esgverify -cert certificate.json \
+//		-key esg-certificate.pub.pem -checkpoint-key carbon-signing.pub.pem
+//
+// It checks the certificate signature, re-adds the totals from the embedded
+// ledger entries, re-hashes every entry and folds its inclusion proof up to a
+// signed checkpoint root. Exit status is 0 only when all of it holds.
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+)
+
+func main() {
+	certPath := flag.String("cert", "", "certificate JSON file")
+	keyPath := flag.String("key", "", "certificate public key (PEM)")
+	checkpointKeyPath := flag.String("checkpoint-key", "", "checkpoint public key (PEM)")
+	flag.Parse()
+	if *certPath == "" || *keyPath == "" || *checkpointKeyPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	raw, err := os.ReadFile(*certPath)
+	if err != nil {
+		fail("read certificate: %v", err)
+	}
+	var certificate domain.Certificate
+	if err := json.Unmarshal(raw, &certificate); err != nil {
+		fail("parse certificate: %v", err)
+	}
+	certificateKey := readKey(*keyPath)
+	checkpointKey := readKey(*checkpointKeyPath)
+
+	if err := certificate.Verify(certificateKey, checkpointKey); err != nil {
+		fail("❌ %v", err)
+	}
+
+	fmt.Printf("✅ Certificate %s verified\n", certificate.ID)
+	if certificate.ChainID != "" {
+		fmt.Printf("   Chain:         %s (%d outlets)\n", certificate.Subject(), len(certificate.Outlets))
+	} else {
+		fmt.Printf("   Vendor:        %s\n", certificate.VendorID)
+	}
+	fmt.Printf("   Period:        %s, %s to %s\n", certificate.PeriodLabel, certificate.PeriodStart.Format(time.DateOnly), certificate.PeriodEnd.Add(-time.Nanosecond).Format(time.DateOnly))
+	fmt.Printf("   Food saved:    %.2f kg\n", certificate.TotalFoodSavedKg)
+	fmt.Printf("   CO2e avoided:  %.2f kg\n", certificate.TotalCarbonSavedKg)
+	fmt.Printf("   Transactions:  %d, in %d signed checkpoint(s)\n", certificate.TransactionCount, len(certificate.Checkpoints))
+	fmt.Printf("   Signed by key: %s\n", certificate.KeyID)
+	for _, o := range certificate.Outlets {
+		fmt.Printf("   - %-20s %6d tx  %10.2f kg food  %10.2f kg CO2e\n", o.VendorID, o.TransactionCount, o.FoodSavedKg, o.CarbonSavedKg)
+	}
+}
+
+func readKey(path string) ed25519.PublicKey {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		fail("read key: %v", err)
+	}
+	pub, err := domain.ParsePublicKey(pemBytes)
+	if err != nil {
+		fail("%s: %v", path, err)
+	}
+	return pub
+}
+
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -1,16 +1,43 @@
-// Package main provides a utility to generate RSA key pairs for JWT RS256 signing.
-// This tool generates both private and public keys with secure file permissions.
+// Package main provides a utility to generate key pairs with secure file permissions:
+// RSA keys for JWT RS256 signing (the default), or Ed25519 keys for the carbon
+// ledger's checkpoints and ESG certificates.
+//
+//	keygen                                      # private.pem & public.pem (RSA)
+//	keygen -type ed25519 -out esg-certificate   # esg-certificate.pem & esg-certificate.pub.pem
 package main
 
 import (
+	"crypto"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"flag"
+	"fmt"
 	"os"
 )
 
 func main() {
+	keyType := flag.String("type", "rsa", "key type: rsa (JWT RS256) or ed25519 (carbon checkpoints, ESG certificates)")
+	out := flag.String("out", "", "file name prefix for ed25519 keys (writes <out>.pem and <out>.pub.pem)")
+	flag.Parse()
+
+	switch *keyType {
+	case "rsa":
+		generateRSA()
+	case "ed25519":
+		if *out == "" {
+			*out = "carbon-signing"
+		}
+		generateEd25519(*out)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown key type %q\n", *keyType)
+		os.Exit(2)
+	}
+}
+
+func generateRSA() {
 	// 1. Generate Private Key (2048 bits for Bank Grade)
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
@@ -28,18 +55,50 @@ func main() {
 	}
 
 	// 3. Extract and Save Public Key
-	pubASN1, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	pubPEM := publicKeyPEM(&privateKey.PublicKey, "RSA PUBLIC KEY")
+	// Public keys can be world-readable, but we use 0600 for consistency with security best practices
+	if err := os.WriteFile("public.pem", pubPEM, 0600); err != nil {
+		panic(err)
+	}
+
+	println("✅ RSA Keys (RS256) Generated: private.pem & public.pem")
+}
+
+func generateEd25519(out string) {
+	// 1. Generate the key pair
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
 		panic(err)
 	}
-	pubPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PUBLIC KEY",
-		Bytes: pubASN1,
+
+	// 2. Save the private key as PKCS#8, which the server loads
+	privBytes, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		panic(err)
+	}
+	privPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privBytes,
 	})
-	// Public keys can be world-readable, but we use 0600 for consistency with security best practices
-	if err := os.WriteFile("public.pem", pubPEM, 0600); err != nil {
+	if err := os.WriteFile(out+".pem", privPEM, 0600); err != nil {
 		panic(err)
 	}
 
-	println("✅ RSA Keys (RS256) Generated: private.pem & public.pem")
+	// 3. Save the public key (PKIX) that auditors verify against
+	if err := os.WriteFile(out+".pub.pem", publicKeyPEM(pub, "PUBLIC KEY"), 0600); err != nil {
+		panic(err)
+	}
+
+	println("✅ Ed25519 Keys Generated: " + out + ".pem & " + out + ".pub.pem")
+}
+
+func publicKeyPEM(pub crypto.PublicKey, blockType string) []byte {
+	pubASN1, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		panic(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  blockType,
+		Bytes: pubASN1,
+	})
 }
@@ -147,6 +147,7 @@ CREATE TABLE users (
     email VARCHAR(255) UNIQUE,
     total_impact_points INT DEFAULT 0,
     food_saved_count INT DEFAULT 0,
+    kyc_verified_at TIMESTAMP, -- NULL until the identity check passes
     created_at TIMESTAMP DEFAULT NOW()
 );
 
@@ -206,14 +207,26 @@ CREATE TABLE deliveries (
     surplus_id UUID NOT NULL,
     courier_id UUID, -- NULL if self-pickup
     status VARCHAR(20), -- 'searching', 'assigned', 'picked_up', 'delivered', 'failed', 'ready_for_pickup'
-    fee DECIMAL(10, 2),
+    fee DECIMAL(10, 2), -- Priced when a courier accepts (IDR)
+    fee_subsidy DECIMAL(10, 2) DEFAULT 0, -- Part of the fee paid from the donation subsidy budget
+    fee_breakdown JSONB, -- How the fee was computed (distance, SLA, cold chain, batch, surge)
     courier_points INT,
     requires_cold_chain BOOLEAN DEFAULT FALSE,
     thermal_bag_verified BOOLEAN DEFAULT FALSE,
     fulfillment_method VARCHAR(20) DEFAULT 'courier', -- 'courier', 'self_pickup'
-    pickup_verification_code VARCHAR(10), -- For self-pickup: QR/OTP
+    sla_tier VARCHAR(20), -- Tier the order was dispatched on (NULL for self-pickup); times stale claims
+    pickup_verification_code VARCHAR(10), -- For self-pickup: random per claim, also signed into the QR
+    pickup_code_expires_at TIMESTAMP, -- Code is refused after this
     is_verified_pickup BOOLEAN DEFAULT FALSE,
+    courier_provider VARCHAR(32), -- External fleet carrying it (NULL for in-house riders)
     external_tracking_id VARCHAR(255), -- Gojek/Grab Booking ID
+    dropoff_otp VARCHAR(10), -- Issued to the NGO at pickup, checked at handover
+    proof_photo_ref TEXT, -- Handover photo (object storage key)
+    dropoff_location GEOGRAPHY(POINT, 4326), -- Courier GPS at handover
+    failure_reason TEXT,
+    food_unsafe BOOLEAN DEFAULT FALSE, -- Cold-chain excursion: never hand over or relist
+    picked_up_at TIMESTAMP,
+    delivered_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT NOW(),
     updated_at TIMESTAMP DEFAULT NOW()
 );
@@ -223,10 +236,16 @@ CREATE TABLE pickup_checkins (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     delivery_id UUID REFERENCES deliveries(id),
     provider_id UUID REFERENCES providers(id),
+    courier_id UUID, -- NULL for self-pickup
     checked_at TIMESTAMP DEFAULT NOW(),
+    method VARCHAR(10) NOT NULL DEFAULT 'courier', -- 'courier', 'qr', 'manual'
+    result VARCHAR(20) NOT NULL DEFAULT 'verified', -- 'verified', 'invalid_code', 'bad_signature', 'wrong_provider', 'expired', 'already_used', 'rate_limited'
     location GEOGRAPHY(POINT, 4326) -- Validate user is actually at the store
 );
 
+-- Failed verifications per provider drive the pickup code rate limit
+CREATE INDEX idx_pickup_checkins_failures ON pickup_checkins(provider_id, checked_at) WHERE result <> 'verified';
+
 
 -- Pahlawan-Connect: POS Integration
 CREATE TABLE pos_integrations (
@@ -268,6 +287,8 @@ CREATE TABLE group_buy_orders (
 );
 
 CREATE INDEX idx_deliveries_surplus ON deliveries(surplus_id);
+CREATE INDEX idx_deliveries_courier_status ON deliveries(courier_id, status);
+CREATE UNIQUE INDEX idx_deliveries_external ON deliveries(courier_provider, external_tracking_id) WHERE courier_provider IS NOT NULL;
 CREATE INDEX idx_carbon_provider ON carbon_credits(provider_id);
 CREATE INDEX idx_comm_region ON community_groups(region_id);
 
@@ -370,3 +391,561 @@ CREATE TRIGGER update_ngos_updated_at BEFORE UPDATE ON ngos
 
 CREATE TRIGGER update_surplus_updated_at BEFORE UPDATE ON surplus
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Pahlawan-Express: Courier Fleet (linked to auth users with role COURIER)
+CREATE TABLE couriers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL UNIQUE,
+    vehicle_type VARCHAR(20) NOT NULL, -- 'BIKE', 'CAR', 'VAN'
+    capacity_kg DECIMAL(10, 2) NOT NULL,
+    thermal_bag_certified_until TIMESTAMP, -- NULL if not cold-chain certified
+    status VARCHAR(20) DEFAULT 'OFFLINE', -- 'OFFLINE', 'ONLINE', 'BUSY'
+    shift_started_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Batch-to-courier offers (one row per dispatched batch)
+CREATE TABLE courier_assignments (
+    batch_id VARCHAR(64) PRIMARY KEY,
+    batch JSONB NOT NULL, -- Snapshot of orders in the batch
+    courier_id UUID REFERENCES couriers(id),
+    status VARCHAR(20) NOT NULL, -- 'SEARCHING', 'OFFERED', 'ACCEPTED', 'COMPLETED'
+    rejected_by UUID[] DEFAULT '{}',
+    offer_expires_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_couriers_status ON couriers(status);
+CREATE INDEX idx_assignments_status ON courier_assignments(status, offer_expires_at);
+CREATE INDEX idx_assignments_courier ON courier_assignments(courier_id, status);
+
+-- Thermal-bag sensor trace per delivery (also dispute evidence)
+CREATE TABLE cold_chain_readings (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id UUID NOT NULL REFERENCES deliveries(id),
+    sensor_id VARCHAR(64) NOT NULL,
+    temp_c DECIMAL(5, 2) NOT NULL,
+    recorded_at TIMESTAMP NOT NULL,
+    received_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (delivery_id, sensor_id, recorded_at) -- Sensors retry; keep one copy
+);
+
+CREATE INDEX idx_cold_chain_delivery ON cold_chain_readings(delivery_id, recorded_at);
+
+-- SLA monitor: one row per order and event kind (idempotent across replicas)
+CREATE TABLE sla_events (
+    order_id VARCHAR(64) NOT NULL,
+    kind VARCHAR(20) NOT NULL, -- 'ESCALATED', 'LATE_DELIVERY'
+    batch_id VARCHAR(64),
+    region VARCHAR(16) NOT NULL, -- S2 level-9 cell token of the pickup
+    sla_tier VARCHAR(20) NOT NULL,
+    deadline TIMESTAMP,
+    detected_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (order_id, kind)
+);
+
+CREATE INDEX idx_sla_events_detected ON sla_events(detected_at, region, sla_tier);
+
+-- Courier earnings: append-only ledger (payouts are negative entries)
+CREATE TABLE courier_earnings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    courier_id UUID NOT NULL REFERENCES couriers(id),
+    delivery_id UUID REFERENCES deliveries(id),
+    kind VARCHAR(20) NOT NULL, -- 'DELIVERY', 'PAYOUT', 'ADJUSTMENT'
+    amount DECIMAL(12, 2) NOT NULL, -- IDR
+    points INT NOT NULL DEFAULT 0,
+    available_at TIMESTAMP NOT NULL, -- Payout-eligible after the dispute hold
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_courier_earnings_courier ON courier_earnings(courier_id, created_at);
+CREATE UNIQUE INDEX idx_courier_earnings_delivery ON courier_earnings(delivery_id, kind) WHERE kind = 'DELIVERY';
+
+CREATE OR REPLACE FUNCTION forbid_ledger_mutation()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER courier_earnings_append_only BEFORE UPDATE OR DELETE ON courier_earnings
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_mutation();
+
+-- Escrow event store: one append-only stream per order (orders are claimed surplus IDs).
+-- The (order_id, version) key is the optimistic concurrency check.
+CREATE TABLE escrow_events (
+    id UUID PRIMARY KEY,
+    order_id VARCHAR(64) NOT NULL,
+    version INT NOT NULL CHECK (version > 0),
+    type VARCHAR(32) NOT NULL, -- 'PaymentCollected', 'CourierAssigned', 'FoodPickedUp', 'FoodDelivered', 'FundsReleased', 'OrderCancelled', 'DisputeRaised', 'PartiallyRefunded'
+    amount BIGINT NOT NULL DEFAULT 0, -- Whole rupiah
+    payload TEXT NOT NULL DEFAULT '',
+    occurred_at TIMESTAMP NOT NULL,
+    recorded_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (order_id, version)
+);
+
+CREATE INDEX idx_escrow_events_type ON escrow_events(type, occurred_at);
+
+CREATE TRIGGER escrow_events_append_only BEFORE UPDATE OR DELETE ON escrow_events
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_mutation();
+
+-- Rehydration shortcut for long streams; always rebuildable from escrow_events
+CREATE TABLE escrow_snapshots (
+    order_id VARCHAR(64) PRIMARY KEY,
+    version INT NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    collected BIGINT NOT NULL,
+    refunded BIGINT NOT NULL DEFAULT 0,
+    total_locked BIGINT NOT NULL,
+    last_event VARCHAR(32) NOT NULL DEFAULT '',
+    last_updated TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Gateway charges funding each escrow, and the callbacks already applied to them
+CREATE TABLE payments (
+    order_id VARCHAR(64) PRIMARY KEY, -- Escrow stream
+    gateway VARCHAR(32) NOT NULL,
+    charge_id VARCHAR(128) NOT NULL,
+    customer_id VARCHAR(64) NOT NULL,
+    amount BIGINT NOT NULL CHECK (amount > 0), -- Charged to the buyer, whole rupiah
+    voucher_discount BIGINT NOT NULL DEFAULT 0, -- Paid from the promo budget
+    status VARCHAR(20) NOT NULL, -- pending, authorized, captured, failed, refunded, refunded_to_wallet
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (gateway, charge_id) -- gateway 'wallet': paid from the buyer's wallet, charge_id is the order
+);
+
+CREATE TABLE payment_webhook_events (
+    gateway VARCHAR(32) NOT NULL,
+    event_id VARCHAR(128) NOT NULL,
+    order_id VARCHAR(64) NOT NULL,
+    object VARCHAR(16) NOT NULL, -- charge, refund, payout
+    status VARCHAR(20) NOT NULL,
+    gateway_status VARCHAR(32) NOT NULL,
+    amount BIGINT NOT NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    received_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (gateway, event_id)
+);
+
+CREATE INDEX idx_payment_webhook_events_order ON payment_webhook_events(order_id);
+
+-- Released orders owed to providers, swept into one payout batch per provider
+-- per period. Whole rupiah.
+CREATE TABLE payout_batches (
+    id UUID PRIMARY KEY,
+    provider_id VARCHAR(64) NOT NULL,
+    period_start TIMESTAMP NOT NULL, -- Cut-off: covers releases before it
+    orders INT NOT NULL DEFAULT 0,
+    gross BIGINT NOT NULL DEFAULT 0,
+    fees BIGINT NOT NULL DEFAULT 0, -- Platform commission
+    net BIGINT NOT NULL DEFAULT 0, -- Owed before deductions
+    transfer_fee BIGINT NOT NULL DEFAULT 0, -- Deducted disbursement fee
+    amount BIGINT NOT NULL DEFAULT 0, -- Sent to the provider
+    payout_id VARCHAR(128), -- Gateway's disbursement ID
+    status VARCHAR(20) NOT NULL, -- payout_pending, paid_out, payout_failed
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (provider_id, period_start)
+);
+
+CREATE INDEX idx_payout_batches_unsubmitted ON payout_batches(created_at) WHERE payout_id IS NULL;
+
+CREATE TABLE provider_releases (
+    order_id VARCHAR(64) PRIMARY KEY,
+    provider_id VARCHAR(64) NOT NULL,
+    gross BIGINT NOT NULL,
+    fee BIGINT NOT NULL,
+    net BIGINT NOT NULL,
+    released_at TIMESTAMP NOT NULL,
+    batch_id UUID REFERENCES payout_batches(id) -- NULL until batched; cleared again if the payout fails
+);
+
+CREATE INDEX idx_provider_releases_unbatched ON provider_releases(provider_id, released_at) WHERE batch_id IS NULL;
+CREATE INDEX idx_provider_releases_batch ON provider_releases(batch_id);
+
+-- Double-entry journal in whole rupiah. Accounts are codes such as
+-- 'escrow_holding:<order>'; balances are always summed from the lines.
+CREATE TABLE journal_entries (
+    id UUID PRIMARY KEY,
+    reference VARCHAR(160) UNIQUE NOT NULL, -- One per business event, e.g. 'escrow/<order>/released'
+    kind VARCHAR(32) NOT NULL, -- 'payment_collected', 'escrow_released', 'escrow_refunded', 'delivery_fee', 'payout', 'wallet_top_up', 'cashback'
+    order_id VARCHAR(64),
+    memo TEXT NOT NULL DEFAULT '',
+    posted_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE journal_lines (
+    id BIGSERIAL PRIMARY KEY,
+    entry_id UUID NOT NULL REFERENCES journal_entries(id),
+    account VARCHAR(160) NOT NULL,
+    account_type VARCHAR(16) NOT NULL, -- 'asset', 'liability', 'revenue', 'expense'
+    debit BIGINT NOT NULL DEFAULT 0 CHECK (debit >= 0),
+    credit BIGINT NOT NULL DEFAULT 0 CHECK (credit >= 0),
+    CHECK ((debit = 0) <> (credit = 0))
+);
+
+CREATE INDEX idx_journal_lines_account ON journal_lines(account);
+CREATE INDEX idx_journal_lines_entry ON journal_lines(entry_id);
+CREATE INDEX idx_journal_entries_order ON journal_entries(order_id);
+CREATE INDEX idx_journal_entries_posted ON journal_entries(posted_at);
+
+CREATE TRIGGER journal_entries_append_only BEFORE UPDATE OR DELETE ON journal_entries
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_mutation();
+
+CREATE TRIGGER journal_lines_append_only BEFORE UPDATE OR DELETE ON journal_lines
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_mutation();
+
+-- Checked at commit, once all of an entry's lines are in
+CREATE OR REPLACE FUNCTION check_journal_entry_balanced()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF (SELECT SUM(debit) - SUM(credit) FROM journal_lines WHERE entry_id = NEW.entry_id) <> 0 THEN
+        RAISE EXCEPTION 'journal entry % does not balance', NEW.entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER journal_lines_balanced AFTER INSERT ON journal_lines
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();
+
+-- Gateway settlement reports, imported line by line for reconciliation
+CREATE TABLE gateway_settlements (
+    gateway VARCHAR(32) NOT NULL,
+    reference VARCHAR(128) NOT NULL, -- The gateway's transaction ID
+    order_id VARCHAR(64) NOT NULL,
+    charge_id VARCHAR(128) NOT NULL DEFAULT '',
+    type VARCHAR(16) NOT NULL, -- 'sale', 'refund'
+    gross BIGINT NOT NULL, -- Whole rupiah
+    fee BIGINT NOT NULL DEFAULT 0,
+    net BIGINT NOT NULL,
+    transaction_at TIMESTAMP NOT NULL,
+    imported_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (gateway, reference)
+);
+
+CREATE INDEX idx_gateway_settlements_order ON gateway_settlements(order_id);
+CREATE INDEX idx_gateway_settlements_time ON gateway_settlements(transaction_at);
+CREATE INDEX idx_surplus_claimed_at ON surplus(claimed_at);
+
+-- One row per reconciliation run; runs are never rewritten
+CREATE TABLE reconciliation_runs (
+    id UUID PRIMARY KEY,
+    business_day DATE NOT NULL,
+    status VARCHAR(16) NOT NULL, -- 'balanced', 'mismatch'
+    orders_checked INT NOT NULL,
+    discrepancy_count INT NOT NULL,
+    main_db_total BIGINT NOT NULL,
+    escrow_total BIGINT NOT NULL,
+    settlement_total BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_reconciliation_runs_day ON reconciliation_runs(business_day, created_at DESC);
+
+CREATE TABLE reconciliation_discrepancies (
+    id BIGSERIAL PRIMARY KEY,
+    run_id UUID NOT NULL REFERENCES reconciliation_runs(id),
+    order_id VARCHAR(64) NOT NULL,
+    kind VARCHAR(32) NOT NULL, -- 'unpaid_claim', 'missing_in_escrow', 'settlement_amount_mismatch', ...
+    main_db_amount BIGINT NOT NULL,
+    escrow_amount BIGINT NOT NULL,
+    settlement_amount BIGINT NOT NULL,
+    detail TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_reconciliation_discrepancies_run ON reconciliation_discrepancies(run_id);
+CREATE INDEX idx_reconciliation_discrepancies_order ON reconciliation_discrepancies(order_id);
+
+CREATE TRIGGER reconciliation_runs_append_only BEFORE UPDATE OR DELETE ON reconciliation_runs
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_mutation();
+
+CREATE TRIGGER reconciliation_discrepancies_append_only BEFORE UPDATE OR DELETE ON reconciliation_discrepancies
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_mutation();
+
+-- Disputes over a claim: the escrow stays frozen until the outcome settles it
+CREATE TABLE disputes (
+    id UUID PRIMARY KEY,
+    claim_id VARCHAR(64) NOT NULL, -- Surplus listing the claim was made on
+    payment_id VARCHAR(64), -- Escrowed order; NULL for donations
+    user_id VARCHAR(64) NOT NULL, -- Claimant
+    provider_id VARCHAR(64) NOT NULL, -- Respondent
+    reason TEXT NOT NULL,
+    evidence_url TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL, -- 'opened', 'under_review', 'approved', 'rejected', 'partially_refunded'
+    refund_amount BIGINT NOT NULL DEFAULT 0, -- partially_refunded only, whole rupiah
+    resolution TEXT NOT NULL DEFAULT '',
+    resolved_by VARCHAR(64) NOT NULL DEFAULT '', -- Reviewer, or 'system' for a missed deadline
+    claimant_evidence_due_at TIMESTAMP NOT NULL,
+    response_due_at TIMESTAMP NOT NULL,
+    review_due_at TIMESTAMP,
+    claimant_evidence_at TIMESTAMP,
+    responded_at TIMESTAMP,
+    escalated_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_disputes_open_claim ON disputes(claim_id) WHERE status IN ('opened', 'under_review');
+CREATE INDEX idx_disputes_provider ON disputes(provider_id, status);
+CREATE INDEX idx_disputes_user ON disputes(user_id, status);
+
+CREATE TABLE dispute_evidence (
+    id UUID PRIMARY KEY,
+    dispute_id UUID NOT NULL REFERENCES disputes(id),
+    submitted_by VARCHAR(64) NOT NULL,
+    party VARCHAR(20) NOT NULL, -- 'claimant', 'respondent'
+    url TEXT NOT NULL,
+    file_name TEXT NOT NULL DEFAULT '',
+    content_type VARCHAR(100) NOT NULL DEFAULT '',
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    sha256 VARCHAR(64) NOT NULL DEFAULT '', -- Uploaded files only
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_dispute_evidence_dispute ON dispute_evidence(dispute_id, created_at);
+
+CREATE TRIGGER dispute_evidence_append_only BEFORE UPDATE OR DELETE ON dispute_evidence
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_mutation();
+
+-- No-shows behind auto-refunded claims: the buyer for a self-pickup, the assigned rider otherwise
+CREATE TABLE ghosting_incidents (
+    order_id VARCHAR(64) PRIMARY KEY, -- One per stalled claim
+    user_id VARCHAR(64) NOT NULL,
+    party VARCHAR(20) NOT NULL, -- 'claimant', 'courier'
+    stage VARCHAR(20) NOT NULL, -- 'awaiting_pickup', 'pickup_in_progress'
+    detected_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_ghosting_incidents_user ON ghosting_incidents(user_id);
+
+-- Stale claim sweep: streams still LOCKED or PICKUP_IN_PROGRESS by last event time
+CREATE INDEX idx_escrow_events_stage ON escrow_events(type, occurred_at) WHERE type IN ('PaymentCollected', 'CourierAssigned');
+
+-- Buyer wallets: the balance is the 'buyer_wallet:<user>' journal account;
+-- these only track gateway top-ups and the buyer's refund preference
+CREATE TABLE wallet_topups (
+    id UUID PRIMARY KEY,
+    user_id VARCHAR(64) NOT NULL,
+    gateway VARCHAR(32) NOT NULL,
+    charge_id VARCHAR(128), -- NULL until the gateway answers
+    amount BIGINT NOT NULL CHECK (amount > 0), -- Whole rupiah
+    status VARCHAR(20) NOT NULL, -- pending, authorized, captured, failed
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_wallet_topups_user ON wallet_topups(user_id, created_at DESC);
+
+CREATE TABLE wallet_settings (
+    user_id VARCHAR(64) PRIMARY KEY,
+    instant_refunds BOOLEAN NOT NULL DEFAULT FALSE, -- Refunds credited to the wallet instead of the card
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Emission factors: versioned methodologies, each in force from effective_from
+-- until a later version takes over. Published versions are never edited.
+CREATE TABLE emission_factor_versions (
+    version VARCHAR(32) PRIMARY KEY,
+    effective_from TIMESTAMP NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    created_by VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- kgCO2e avoided per kg of rescued food; region '' is the national figure,
+-- any other region overrides it there. MIXED is the fallback category.
+CREATE TABLE emission_factors (
+    version VARCHAR(32) NOT NULL REFERENCES emission_factor_versions(version),
+    category VARCHAR(32) NOT NULL,
+    region VARCHAR(16) NOT NULL DEFAULT '',
+    kg_co2e_per_kg DOUBLE PRECISION NOT NULL CHECK (kg_co2e_per_kg > 0),
+    source TEXT NOT NULL,
+    PRIMARY KEY (version, category, region)
+);
+
+CREATE TRIGGER emission_factor_versions_append_only BEFORE UPDATE OR DELETE ON emission_factor_versions
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_mutation();
+
+CREATE TRIGGER emission_factors_append_only BEFORE UPDATE OR DELETE ON emission_factors
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_mutation();
+
+-- The factors the ledger used before they were versioned
+INSERT INTO emission_factor_versions (version, effective_from, description, created_by) VALUES
+    ('2024.1', '2024-01-01 00:00:00', 'Platform baseline carried over from the original in-code constants', 'system');
+
+INSERT INTO emission_factors (version, category, kg_co2e_per_kg, source) VALUES
+    ('2024.1', 'MEAT', 27.0, 'Platform baseline (legacy constant)'),
+    ('2024.1', 'DAIRY', 12.0, 'Platform baseline (legacy constant)'),
+    ('2024.1', 'PRODUCE', 2.5, 'Platform baseline (legacy constant)'),
+    ('2024.1', 'BREAD', 1.2, 'Platform baseline (legacy constant)'),
+    ('2024.1', 'MIXED', 3.5, 'Platform baseline (legacy constant)');
+
+-- Carbon ledger: a hash chain of rescued food and the CO2e it saved. seq is
+-- assigned under an advisory lock so the chain never forks; weights are
+-- DOUBLE PRECISION so the hashed values round-trip exactly.
+CREATE TABLE carbon_ledger (
+    id UUID PRIMARY KEY,
+    seq BIGINT NOT NULL UNIQUE CHECK (seq > 0),
+    vendor_id VARCHAR(64) NOT NULL,
+    order_id VARCHAR(64) NOT NULL UNIQUE, -- One entry per delivered order; redelivered events are skipped
+    category VARCHAR(32) NOT NULL,
+    region VARCHAR(16) NOT NULL DEFAULT '',
+    weight_kg DOUBLE PRECISION NOT NULL,
+    factor_version VARCHAR(32) NOT NULL REFERENCES emission_factor_versions(version),
+    emission_factor DOUBLE PRECISION NOT NULL, -- kgCO2e per kg applied
+    carbon_saved_kg DOUBLE PRECISION NOT NULL,
+    timestamp TIMESTAMP NOT NULL, -- UTC
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL UNIQUE,
+    recorded_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_carbon_ledger_vendor ON carbon_ledger(vendor_id, timestamp);
+
+CREATE TRIGGER carbon_ledger_append_only BEFORE UPDATE OR DELETE ON carbon_ledger
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_mutation();
+
+-- Scheduled chain verifications; each run continues from the previous one's through_seq
+CREATE TABLE carbon_chain_verifications (
+    id UUID PRIMARY KEY,
+    from_seq BIGINT NOT NULL,
+    from_hash VARCHAR(64) NOT NULL,
+    through_seq BIGINT NOT NULL, -- Last entry that verified
+    through_hash VARCHAR(64) NOT NULL,
+    checked INT NOT NULL,
+    intact BOOLEAN NOT NULL,
+    broken JSONB, -- First broken link: seq, entry_id, reason
+    run_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_carbon_chain_verifications_run ON carbon_chain_verifications(run_at DESC);
+
+-- Signed Merkle roots over consecutive runs of ledger entries (RFC 6962 trees)
+CREATE TABLE carbon_checkpoints (
+    id UUID PRIMARY KEY,
+    from_seq BIGINT NOT NULL UNIQUE,
+    through_seq BIGINT NOT NULL UNIQUE CHECK (through_seq >= from_seq),
+    root VARCHAR(64) NOT NULL,
+    chain_hash VARCHAR(64) NOT NULL, -- Hash of the entry at through_seq
+    key_id VARCHAR(16) NOT NULL,
+    signature TEXT NOT NULL, -- Base64 Ed25519
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Restaurant chains whose outlets report together in one ESG rollup
+CREATE TABLE carbon_chains (
+    id UUID PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_by VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE carbon_chain_outlets (
+    chain_id UUID NOT NULL REFERENCES carbon_chains(id),
+    vendor_id VARCHAR(64) NOT NULL,
+    added_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (chain_id, vendor_id)
+);
+
+-- Signed ESG certificates, kept as issued; body is the certificate JSON.
+-- Exactly one of vendor_id and chain_id names the subject.
+CREATE TABLE carbon_certificates (
+    id UUID PRIMARY KEY,
+    vendor_id VARCHAR(64),
+    chain_id UUID REFERENCES carbon_chains(id),
+    period_start TIMESTAMP NOT NULL,
+    period_end TIMESTAMP NOT NULL,
+    body JSONB NOT NULL,
+    issued_at TIMESTAMP NOT NULL,
+    CHECK ((vendor_id IS NULL) <> (chain_id IS NULL))
+);
+
+CREATE INDEX idx_carbon_certificates_vendor ON carbon_certificates(vendor_id, issued_at DESC);
+CREATE INDEX idx_carbon_certificates_chain ON carbon_certificates(chain_id, issued_at DESC);
+
+-- How far each provider's checkpointed ledger savings have been issued as
+-- credit tokens. Savings short of a whole token carry forward from next_seq,
+-- less next_offset_g already spent. Issuance also keeps the provider's
+-- carbon_credits summary row up to date.
+CREATE TABLE carbon_credit_cursors (
+    provider_id VARCHAR(64) PRIMARY KEY, -- carbon_ledger.vendor_id
+    issued_through_seq BIGINT NOT NULL, -- Ledger entries counted so far
+    next_seq BIGINT NOT NULL,
+    next_offset_g BIGINT NOT NULL DEFAULT 0,
+    carry_g BIGINT NOT NULL DEFAULT 0 CHECK (carry_g >= 0),
+    tokens_issued BIGINT NOT NULL DEFAULT 0,
+    credited_g BIGINT NOT NULL DEFAULT 0, -- Behind the tokens issued
+    last_issued_at TIMESTAMP
+);
+
+-- Carbon credit tokens; owner and status only change with a carbon_credit_events row
+CREATE TABLE carbon_credit_tokens (
+    id UUID PRIMARY KEY,
+    provider_id VARCHAR(64) NOT NULL REFERENCES carbon_credit_cursors(provider_id), -- Issued to
+    owner_id VARCHAR(64) NOT NULL,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('ACTIVE', 'RETIRED')),
+    co2e_g BIGINT NOT NULL CHECK (co2e_g > 0),
+    issued_at TIMESTAMP NOT NULL,
+    retired_at TIMESTAMP
+);
+
+CREATE INDEX idx_carbon_credit_tokens_owner ON carbon_credit_tokens(owner_id, status);
+
+-- The ledger savings behind each token; an entry's grams are spent once
+CREATE TABLE carbon_credit_backings (
+    token_id UUID NOT NULL REFERENCES carbon_credit_tokens(id),
+    entry_id UUID NOT NULL REFERENCES carbon_ledger(id),
+    seq BIGINT NOT NULL,
+    co2e_g BIGINT NOT NULL CHECK (co2e_g > 0),
+    PRIMARY KEY (token_id, entry_id)
+);
+
+CREATE INDEX idx_carbon_credit_backings_entry ON carbon_credit_backings(entry_id);
+
+CREATE TRIGGER carbon_credit_backings_append_only BEFORE UPDATE OR DELETE ON carbon_credit_backings
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_mutation();
+
+-- Every issuance, transfer and retirement of a token
+CREATE TABLE carbon_credit_events (
+    id UUID PRIMARY KEY,
+    token_id UUID NOT NULL REFERENCES carbon_credit_tokens(id),
+    type VARCHAR(16) NOT NULL CHECK (type IN ('ISSUED', 'TRANSFERRED', 'RETIRED')),
+    from_owner VARCHAR(64) NOT NULL DEFAULT '',
+    to_owner VARCHAR(64) NOT NULL DEFAULT '',
+    beneficiary VARCHAR(255) NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    actor VARCHAR(64) NOT NULL,
+    at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_carbon_credit_events_token ON carbon_credit_events(token_id, at);
+
+CREATE TRIGGER carbon_credit_events_append_only BEFORE UPDATE OR DELETE ON carbon_credit_events
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_mutation();
+
+-- Donation delivery subsidies: monthly platform budget and what each delivery drew
+CREATE TABLE subsidy_budgets (
+    month DATE PRIMARY KEY, -- First day of the month
+    budget DECIMAL(14, 2) NOT NULL,
+    spent DECIMAL(14, 2) NOT NULL DEFAULT 0 CHECK (spent <= budget),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE delivery_subsidies (
+    delivery_id UUID PRIMARY KEY REFERENCES deliveries(id),
+    month DATE NOT NULL REFERENCES subsidy_budgets(month),
+    amount DECIMAL(10, 2) NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TRIGGER update_couriers_updated_at BEFORE UPDATE ON couriers
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -18,10 +19,13 @@ import (
 	"golang.org/x/time/rate"
 
 	"github.com/albnnaardy11/pahlawan-pangan/internal/api/middleware"
+	carbonDomain "github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+	carbonService "github.com/albnnaardy11/pahlawan-pangan/internal/carbon/service"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/inventory"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/loyalty"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/matching"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/outbox"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/pickup"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/recommendation"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/trust"
 )
@@ -40,6 +44,8 @@ type Handler struct {
 	inventorySvc *inventory.InventoryService
 	trustSvc     *trust.TrustService
 	recSvc       *recommendation.RecommendationService
+	pickupSvc    *pickup.Service
+	carbonSvc    *carbonService.CarbonService
 
 	limiter     *middleware.IPLimiter           // SRE-Guard
 	loadshedder *middleware.AdaptiveLoadShedder // Damage Control
@@ -54,6 +60,8 @@ func NewHandler(
 	inventorySvc *inventory.InventoryService,
 	trustSvc *trust.TrustService,
 	recSvc *recommendation.RecommendationService,
+	pickupSvc *pickup.Service,
+	carbonSvc *carbonService.CarbonService,
 ) *Handler {
 	return &Handler{
 		db:            db,
@@ -63,6 +71,8 @@ func NewHandler(
 		inventorySvc:  inventorySvc,
 		trustSvc:      trustSvc,
 		recSvc:        recSvc,
+		pickupSvc:     pickupSvc,
+		carbonSvc:     carbonSvc,
 		limiter:       middleware.NewIPLimiter(rate.Limit(50), 100),
 		loadshedder:   middleware.NewAdaptiveLoadShedder(500 * time.Millisecond),
 	}
@@ -288,44 +298,90 @@ func (h *Handler) ClaimSurplus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The claim and its delivery commit together: a claimed surplus without a
+	// delivery could never be picked up, dispatched or refunded
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
 	// Update DB (Optimistic Locking - Unicorn Grade)
 	// We only update if the version matches what we last saw (or if it's available)
-	result, err := h.db.ExecContext(ctx, `
+	var providerID string
+	err = tx.QueryRowContext(ctx, `
 		UPDATE surplus
 		SET status = 'claimed',
 		    claimed_by_ngo_id = $1,
 		    claimed_at = NOW(),
 		    version = version + 1
 		WHERE id = $2 AND status = 'available'
-	`, req.NGOID, surplusID)
+		RETURNING provider_id
+	`, req.NGOID, surplusID).Scan(&providerID)
 
-	if err != nil {
-		http.Error(w, "database error", http.StatusInternalServerError)
+	if err == sql.ErrNoRows {
+		http.Error(w, "surplus already claimed or expired", http.StatusConflict)
 		return
 	}
-	rows, err := result.RowsAffected()
 	if err != nil {
-		http.Error(w, "error checking affected rows", http.StatusInternalServerError)
+		http.Error(w, "database error", http.StatusInternalServerError)
 		return
 	}
-	if rows == 0 {
-		http.Error(w, "surplus already claimed or expired", http.StatusConflict)
-		return
+
+	// Self-pickup: a fresh code bound to this claim and provider, valid for a few hours
+	var claim pickup.Claim
+	if fStatus.Method == matching.FulfillmentSelfPickup {
+		claim, err = h.pickupSvc.NewClaim(surplusID, providerID, req.NGOID, time.Now())
+		if err != nil {
+			http.Error(w, "failed to issue pickup code", http.StatusInternalServerError)
+			return
+		}
 	}
 
 	// Create Delivery/Pickup Record
-	_, err = h.db.ExecContext(ctx, `
-		INSERT INTO deliveries (surplus_id, fulfillment_method, pickup_verification_code, external_tracking_id, status)
-		VALUES ($1, $2, $3, $4, 'assigned')
-	`, surplusID, fStatus.Method, fStatus.VerificationCode, fStatus.TrackingID)
+	// Courier deliveries wait for a rider; self-pickups wait at the store
+	deliveryStatus := "searching"
+	if fStatus.Method == matching.FulfillmentSelfPickup {
+		deliveryStatus = "ready_for_pickup"
+	}
+	var codeExpiresAt *time.Time
+	if claim.Code != "" {
+		codeExpiresAt = &claim.ExpiresAt
+	}
+	var deliveryID string
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO deliveries (surplus_id, fulfillment_method, pickup_verification_code, pickup_code_expires_at, external_tracking_id, status)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), $6)
+		RETURNING id
+	`, surplusID, fStatus.Method, claim.Code, codeExpiresAt, fStatus.TrackingID, deliveryStatus).Scan(&deliveryID)
 	if err != nil {
 		span.RecordError(err)
-		// Log error but continue with response
+		http.Error(w, "failed to create delivery", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	if claim.Code != "" {
+		claim.DeliveryID = deliveryID
+		qr, err := h.pickupSvc.QRPayload(claim)
+		if err != nil {
+			http.Error(w, "failed to sign pickup code", http.StatusInternalServerError)
+			return
+		}
+		fStatus.VerificationCode = claim.Code
+		fStatus.QRPayload = qr
+		fStatus.CodeExpiresAt = codeExpiresAt
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":      "claimed",
+		"delivery_id": deliveryID,
 		"fulfillment": fStatus,
 	})
 }
@@ -611,48 +667,61 @@ func (h *Handler) GetProviderClaims(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// VerifyPickupCode is called by the merchant app when a claimant shows up: it
+// scans the claimant's QR (qr_payload) or types the short code as a fallback
 func (h *Handler) VerifyPickupCode(w http.ResponseWriter, r *http.Request) {
 	ctx, span := tracer.Start(r.Context(), "VerifyPickupCode")
 	defer span.End()
 
 	var req struct {
-		VerificationCode string `json:"verification_code"`
-		ProviderID       string `json:"provider_id"`
+		VerificationCode string  `json:"verification_code"`
+		QRPayload        string  `json:"qr_payload"`
+		ProviderID       string  `json:"provider_id"`
+		Lat              float64 `json:"lat"`
+		Lon              float64 `json:"lon"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Complex Logic: Verify code in DB for specific provider
-	result, err := h.db.ExecContext(ctx, `
-		UPDATE deliveries 
-		SET is_verified_pickup = true, status = 'delivered', updated_at = NOW()
-		FROM surplus
-		WHERE deliveries.surplus_id = surplus.id
-		  AND surplus.provider_id = $1
-		  AND deliveries.pickup_verification_code = $2
-		  AND deliveries.is_verified_pickup = false
-	`, req.ProviderID, req.VerificationCode)
-
-	if err != nil {
-		http.Error(w, "Verification failed", http.StatusInternalServerError)
+	if req.ProviderID == "" || (req.VerificationCode == "" && req.QRPayload == "") {
+		http.Error(w, "provider_id and a qr_payload or verification_code are required", http.StatusBadRequest)
 		return
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		http.Error(w, "error checking affected rows", http.StatusInternalServerError)
+
+	redemption, err := h.pickupSvc.Verify(ctx, pickup.Attempt{
+		ProviderID: req.ProviderID,
+		QRPayload:  req.QRPayload,
+		Code:       req.VerificationCode,
+		Lat:        req.Lat,
+		Lon:        req.Lon,
+	}, time.Now())
+	switch {
+	case errors.Is(err, pickup.ErrTooManyAttempts):
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(pickup.FailureWindow.Seconds())))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
 		return
-	}
-	if rows == 0 {
-		http.Error(w, "Invalid or already used verification code", http.StatusNotFound)
+	case errors.Is(err, pickup.ErrInvalidPickupCode):
+		http.Error(w, "Invalid verification code", http.StatusNotFound)
+		return
+	case errors.Is(err, pickup.ErrPickupCodeExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	case errors.Is(err, pickup.ErrPickupCodeUsed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		span.RecordError(err)
+		http.Error(w, "Verification failed", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{
-		"status":  "verified",
-		"message": "Pickup successful. Inventory updated.",
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "verified",
+		"message":     "Pickup successful. Inventory updated.",
+		"delivery_id": redemption.DeliveryID,
+		"surplus_id":  redemption.SurplusID,
 	})
 }
 
@@ -693,25 +762,34 @@ func (h *Handler) AnalyzeFoodImage(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(res)
 }
 
-// VerifyBlockchainImpact (Pahlawan-Trust) - Immutable Transparency Ledger
+// VerifyBlockchainImpact (Pahlawan-Trust) - Immutable Transparency Ledger.
+// Serves the inclusion proof of a carbon ledger entry in its signed
+// checkpoint; auditors check it against /api/v1/carbon/signing-key.
 func (h *Handler) VerifyBlockchainImpact(w http.ResponseWriter, r *http.Request) {
-	_, span := tracer.Start(r.Context(), "VerifyBlockchainImpact")
+	ctx, span := tracer.Start(r.Context(), "VerifyBlockchainImpact")
 	defer span.End()
 
 	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.String("carbon.entry_id", id))
+
+	proof, err := h.carbonSvc.InclusionProof(ctx, id)
+	switch {
+	case errors.Is(err, carbonDomain.ErrEntryNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, carbonDomain.ErrNotCheckpointed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		span.RecordError(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	// Simulating Blockchain Ledger Verification (Hyperledger/Ethereum)
 	res := map[string]interface{}{
 		"transaction_id": id,
 		"status":         "verified_on_ledger",
-		"chain":          "Pahlawan-Trust-Private-Network",
-		"block_height":   402921,
-		"proof_hash":     uuid.New().String() + uuid.New().String(),
-		"data": map[string]interface{}{
-			"saved_kg": 15.5,
-			"provider": "Resto Bintang Lima",
-			"ngo":      "Panti Asuhan Mulia",
-		},
+		"proof":          proof,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -793,13 +871,10 @@ func (h *Handler) GetUserScore(w http.ResponseWriter, r *http.Request) {
 
 	userID := chi.URLParam(r, "id")
 
-	// Calculate Score (Mock Data for Demo)
-	factors := trust.ScoreFactors{
-		TotalPickups:      12,
-		GhostingIncidents: 0,
-		DisputeCount:      0,
-		AccountAgeDays:    120,
-		VerifiedIdentity:  true,
+	factors, err := h.trustSvc.Factors(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to load trust history", http.StatusInternalServerError)
+		return
 	}
 
 	score := h.trustSvc.CalculateScore(r.Context(), factors)
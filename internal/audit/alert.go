@@ -0,0 +1,28 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nats-io/nats.go"
+)
+
+// MismatchSubject is where finance on-call tooling listens for broken books
+const MismatchSubject = "ALERTS.reconciliation_mismatch"
+
+type natsAlerter struct {
+	nc *nats.Conn
+}
+
+// NewNATSAlerter publishes each mismatching run, with its offending orders
+func NewNATSAlerter(nc *nats.Conn) Alerter {
+	return &natsAlerter{nc: nc}
+}
+
+func (a *natsAlerter) ReconciliationMismatch(ctx context.Context, r *ReconciliationResult) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return a.nc.Publish(MismatchSubject, body)
+}
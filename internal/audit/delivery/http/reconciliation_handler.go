@@ -0,0 +1,116 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/audit"
+)
+
+type ReconciliationHandler struct {
+	engine *audit.ReconciliationEngine
+	repo   audit.Repository
+}
+
+func NewReconciliationHandler(engine *audit.ReconciliationEngine, repo audit.Repository) *ReconciliationHandler {
+	return &ReconciliationHandler{engine: engine, repo: repo}
+}
+
+// POST /api/v1/audit/settlements/{gateway}
+// Body: the gateway's settlement report as CSV
+func (h *ReconciliationHandler) ImportSettlements(w http.ResponseWriter, r *http.Request) {
+	lines, err := audit.ParseSettlementFile(chi.URLParam(r, "gateway"), io.LimitReader(r.Body, 32<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	imported, err := h.repo.ImportSettlements(r.Context(), lines)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"lines": len(lines), "imported": imported})
+}
+
+// POST /api/v1/audit/reconciliations
+// Payload: {"business_day": "2026-03-01"}
+func (h *ReconciliationHandler) RunReconciliation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		BusinessDay string `json:"business_day"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+	day, err := time.ParseInLocation("2006-01-02", req.BusinessDay, audit.BusinessLocation)
+	if err != nil {
+		http.Error(w, "business_day must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.engine.RunAudit(r.Context(), day)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// GET /api/v1/audit/reconciliations?limit=30
+func (h *ReconciliationHandler) ListRuns(w http.ResponseWriter, r *http.Request) {
+	limit := 30
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 365 {
+			http.Error(w, "limit must be between 1 and 365", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	runs, err := h.repo.ListRuns(r.Context(), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(runs)
+}
+
+// GET /api/v1/audit/reconciliations/{id}
+// The discrepancy report: one line per offending order
+func (h *ReconciliationHandler) GetRun(w http.ResponseWriter, r *http.Request) {
+	run, err := h.repo.GetRun(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, audit.ErrRunNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(run)
+}
+
+func (h *ReconciliationHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Post("/settlements/{gateway}", h.ImportSettlements)
+	r.Post("/reconciliations", h.RunReconciliation)
+	r.Get("/reconciliations", h.ListRuns)
+	r.Get("/reconciliations/{id}", h.GetRun)
+	return r
+}
@@ -3,49 +3,345 @@ package audit
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+const (
+	StatusBalanced = "balanced"
+	StatusMismatch = "mismatch"
 )
 
+// DiscrepancyKind says which of the three books disagree about an order
+type DiscrepancyKind string
+
+const (
+	UnpaidClaim              DiscrepancyKind = "unpaid_claim"               // Sold order claimed without a payment
+	MissingInEscrow          DiscrepancyKind = "missing_in_escrow"          // Buyer charged, nothing locked
+	UnexpectedEscrow         DiscrepancyKind = "unexpected_escrow"          // Escrow locked without a captured charge
+	EscrowAmountMismatch     DiscrepancyKind = "escrow_amount_mismatch"     // Escrow holds a different order value
+	MissingSettlement        DiscrepancyKind = "missing_settlement"         // Gateway never reported the money
+	UnknownSettlement        DiscrepancyKind = "unknown_settlement"         // Gateway settled an order we have no payment for
+	SettlementAmountMismatch DiscrepancyKind = "settlement_amount_mismatch" // Gateway settled a different net amount
+	RefundMismatch           DiscrepancyKind = "refund_mismatch"            // Escrow and payment disagree on a refund
+)
+
+// BusinessLocation is the timezone business days are cut in (WIB)
+var BusinessLocation = loadBusinessLocation()
+
+func loadBusinessLocation() *time.Location {
+	if loc, err := time.LoadLocation("Asia/Jakarta"); err == nil {
+		return loc
+	}
+	return time.FixedZone("WIB", 7*60*60)
+}
+
+// BusinessDay returns [start, end) of the WIB calendar day containing t
+func BusinessDay(t time.Time) (time.Time, time.Time) {
+	local := t.In(BusinessLocation)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, BusinessLocation)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// OrderLine is an order as the main database sees it. Amounts are whole rupiah.
+type OrderLine struct {
+	OrderID       string
+	ProviderID    string
+	Donation      bool
+	HasPayment    bool
+	PaymentStatus string      // pending, authorized, captured, failed, refunded, refunded_to_wallet
+	Value         money.Money // Order value: charged plus voucher
+	Charged       money.Money // Taken from the buyer through the gateway or their wallet
+	Wallet        bool        // Paid from the buyer's wallet: the gateway never sees it
+}
+
+// moneyTaken reports whether the buyer's money was actually taken
+func (o OrderLine) moneyTaken() bool {
+	return o.PaymentStatus == "captured" || o.refunded()
+}
+
+func (o OrderLine) refunded() bool {
+	return o.PaymentStatus == "refunded" || o.PaymentStatus == "refunded_to_wallet"
+}
+
+// EscrowLine is an order's escrow stream folded down
+type EscrowLine struct {
+	OrderID   string
+	Collected money.Money
+	Refunded  money.Money // Partial refunds from dispute outcomes
+	Cancelled bool        // Last event refunded the buyer
+}
+
+// SettlementLine is one row of a gateway settlement file
+type SettlementLine struct {
+	Gateway       string      `json:"gateway"`
+	Reference     string      `json:"reference"` // The gateway's transaction ID, unique per gateway
+	OrderID       string      `json:"order_id"`
+	ChargeID      string      `json:"charge_id"`
+	Type          string      `json:"type"` // sale or refund
+	Gross         money.Money `json:"gross"`
+	Fee           money.Money `json:"fee"`
+	Net           money.Money `json:"net"`
+	TransactionAt time.Time   `json:"transaction_at"`
+}
+
+// Discrepancy is one order the books disagree about
+type Discrepancy struct {
+	OrderID          string          `json:"order_id"`
+	Kind             DiscrepancyKind `json:"kind"`
+	MainDBAmount     money.Money     `json:"main_db_amount"`
+	EscrowAmount     money.Money     `json:"escrow_amount"`
+	SettlementAmount money.Money     `json:"settlement_amount"`
+	Detail           string          `json:"detail"`
+}
+
 // ReconciliationResult stores the outcome of a financial audit.
 type ReconciliationResult struct {
-	Timestamp   time.Time `json:"timestamp"`
-	MainDBTotal float64   `json:"main_db_total"`
-	EscrowTotal float64   `json:"escrow_total"`
-	LedgerTotal float64   `json:"ledger_total"`
-	Discrepancy float64   `json:"discrepancy"`
-	Status      string    `json:"status"` // balanced, mismatch
+	ID               string        `json:"id"`
+	BusinessDay      time.Time     `json:"business_day"`
+	Timestamp        time.Time     `json:"timestamp"`
+	OrdersChecked    int           `json:"orders_checked"`
+	MainDBTotal      money.Money   `json:"main_db_total"`    // Order value of paid orders
+	EscrowTotal      money.Money   `json:"escrow_total"`     // Collected into escrow
+	SettlementTotal  money.Money   `json:"settlement_total"` // Gross sales the gateway settled
+	DiscrepancyCount int           `json:"discrepancy_count"`
+	Discrepancies    []Discrepancy `json:"discrepancies,omitempty"`
+	Status           string        `json:"status"` // balanced, mismatch
+}
+
+type Repository interface {
+	// MainDBOrders returns orders claimed in [from, to) plus the given orders
+	MainDBOrders(ctx context.Context, from, to time.Time, orderIDs []string) ([]OrderLine, error)
+	// EscrowOrders returns escrows collected in [from, to) plus the given orders
+	EscrowOrders(ctx context.Context, from, to time.Time, orderIDs []string) ([]EscrowLine, error)
+	// Settlements returns imported rows for transactions in [from, to) plus the given orders
+	Settlements(ctx context.Context, from, to time.Time, orderIDs []string) ([]SettlementLine, error)
+	// ImportSettlements stores settlement rows; rows already imported are skipped
+	ImportSettlements(ctx context.Context, lines []SettlementLine) (int, error)
+
+	SaveRun(ctx context.Context, r *ReconciliationResult) error
+	GetRun(ctx context.Context, id string) (*ReconciliationResult, error)
+	ListRuns(ctx context.Context, limit int) ([]ReconciliationResult, error)
+}
+
+// Alerter tells a human that the books disagree
+type Alerter interface {
+	ReconciliationMismatch(ctx context.Context, r *ReconciliationResult) error
 }
 
 type ReconciliationEngine struct {
-	// Pointers to DB, Escrow Service, and Blockchain Client
+	repo    Repository
+	alerter Alerter // Optional; mismatches are always logged
+	logger  *zap.Logger
+}
+
+func NewReconciliationEngine(repo Repository, alerter Alerter, logger *zap.Logger) *ReconciliationEngine {
+	return &ReconciliationEngine{repo: repo, alerter: alerter, logger: logger}
 }
 
-func NewReconciliationEngine() *ReconciliationEngine {
-	return &ReconciliationEngine{}
+// RunAudit performs a triple-check between the main DB, the escrow event store
+// and the gateway's settlements for one business day, order by order. Every
+// run is stored, balanced or not.
+func (e *ReconciliationEngine) RunAudit(ctx context.Context, day time.Time) (*ReconciliationResult, error) {
+	from, to := BusinessDay(day)
+
+	escrows, err := e.repo.EscrowOrders(ctx, from, to, nil)
+	if err != nil {
+		return nil, fmt.Errorf("escrow orders: %w", err)
+	}
+	settlements, err := e.repo.Settlements(ctx, from, to, nil)
+	if err != nil {
+		return nil, fmt.Errorf("settlements: %w", err)
+	}
+
+	// Bring in orders claimed on another day that moved money today, then the
+	// escrow and settlement side of every order the main DB knows about
+	inEscrow := make(map[string]bool)
+	for _, l := range escrows {
+		inEscrow[l.OrderID] = true
+	}
+	inSettlement := make(map[string]bool)
+	for _, l := range settlements {
+		inSettlement[l.OrderID] = true
+	}
+	seen := make(map[string]bool)
+	for id := range inEscrow {
+		seen[id] = true
+	}
+	for id := range inSettlement {
+		seen[id] = true
+	}
+	orders, err := e.repo.MainDBOrders(ctx, from, to, keys(seen))
+	if err != nil {
+		return nil, fmt.Errorf("main db orders: %w", err)
+	}
+	var escrowMissing, settlementMissing []string
+	for _, o := range orders {
+		if !inEscrow[o.OrderID] {
+			escrowMissing = append(escrowMissing, o.OrderID)
+		}
+		if !inSettlement[o.OrderID] {
+			settlementMissing = append(settlementMissing, o.OrderID)
+		}
+	}
+	if len(escrowMissing) > 0 {
+		more, err := e.repo.EscrowOrders(ctx, to, to, escrowMissing)
+		if err != nil {
+			return nil, fmt.Errorf("escrow orders: %w", err)
+		}
+		escrows = append(escrows, more...)
+	}
+	if len(settlementMissing) > 0 {
+		more, err := e.repo.Settlements(ctx, to, to, settlementMissing)
+		if err != nil {
+			return nil, fmt.Errorf("settlements: %w", err)
+		}
+		settlements = append(settlements, more...)
+	}
+
+	result := Reconcile(orders, escrows, settlements)
+	result.ID = uuid.New().String()
+	result.BusinessDay = from
+	result.Timestamp = time.Now()
+
+	if err := e.repo.SaveRun(ctx, result); err != nil {
+		return nil, fmt.Errorf("save run: %w", err)
+	}
+	if result.Status == StatusMismatch {
+		e.logger.Error("🚨 [SRE-CRITICAL] Financial reconciliation mismatch",
+			zap.String("run_id", result.ID),
+			zap.String("business_day", from.Format("2006-01-02")),
+			zap.Int("discrepancies", len(result.Discrepancies)),
+			zap.Int64("main_db_total", result.MainDBTotal.Units()),
+			zap.Int64("escrow_total", result.EscrowTotal.Units()),
+			zap.Int64("settlement_total", result.SettlementTotal.Units()))
+		if e.alerter != nil {
+			if err := e.alerter.ReconciliationMismatch(ctx, result); err != nil {
+				e.logger.Error("Failed to send reconciliation alert", zap.String("run_id", result.ID), zap.Error(err))
+			}
+		}
+	}
+	return result, nil
 }
 
-// RunAudit performs a triple-check between DB, Escrow, and Blockchain.
-func (e *ReconciliationEngine) RunAudit(ctx context.Context) (*ReconciliationResult, error) {
-	fmt.Println("🕵️  [AUDIT] Starting Midnight Reconciliation Engine (Triple-Check)...")
+// Reconcile matches the three books line by line
+func Reconcile(orders []OrderLine, escrows []EscrowLine, settlements []SettlementLine) *ReconciliationResult {
+	byOrder := make(map[string]OrderLine, len(orders))
+	for _, o := range orders {
+		byOrder[o.OrderID] = o
+	}
+	escrowByOrder := make(map[string]EscrowLine, len(escrows))
+	for _, l := range escrows {
+		escrowByOrder[l.OrderID] = l
+	}
+	type settled struct {
+		sales, refunds money.Money
+	}
+	settledByOrder := make(map[string]*settled)
+	for _, l := range settlements {
+		s := settledByOrder[l.OrderID]
+		if s == nil {
+			s = &settled{}
+			settledByOrder[l.OrderID] = s
+		}
+		if l.Type == "refund" {
+			s.refunds = s.refunds.Add(l.Gross)
+		} else {
+			s.sales = s.sales.Add(l.Gross)
+		}
+	}
 
-	// Mock: Aggregate values across 287M record scale
-	mainDBTotal := 15400250.00
-	escrowTotal := 15400249.50 // Difference of 0.50!
-	ledgerTotal := 15400250.00
+	ids := make(map[string]bool)
+	for id := range byOrder {
+		ids[id] = true
+	}
+	for id := range escrowByOrder {
+		ids[id] = true
+	}
+	for id := range settledByOrder {
+		ids[id] = true
+	}
 
-	discrepancy := mainDBTotal - escrowTotal
-	status := "balanced"
-	if discrepancy != 0 {
-		status = "mismatch"
-		fmt.Printf("🚨 [SRE-CRITICAL] Financial Discrepancy detected: IDR %.2f mismatch at 287M scale!\n", discrepancy)
+	result := &ReconciliationResult{OrdersChecked: len(ids), Status: StatusBalanced}
+	for _, id := range keys(ids) {
+		o, inDB := byOrder[id]
+		esc, inEscrow := escrowByOrder[id]
+		st, inSettlement := settledByOrder[id]
+
+		var settledNet money.Money
+		if inSettlement {
+			settledNet = st.sales.Sub(st.refunds)
+			result.SettlementTotal = result.SettlementTotal.Add(st.sales)
+		}
+		if inEscrow {
+			result.EscrowTotal = result.EscrowTotal.Add(esc.Collected)
+		}
+		if inDB && o.moneyTaken() {
+			result.MainDBTotal = result.MainDBTotal.Add(o.Value)
+		}
+
+		flag := func(kind DiscrepancyKind, detail string) {
+			result.Discrepancies = append(result.Discrepancies, Discrepancy{
+				OrderID:          id,
+				Kind:             kind,
+				MainDBAmount:     o.Value,
+				EscrowAmount:     esc.Collected,
+				SettlementAmount: settledNet,
+				Detail:           detail,
+			})
+		}
+
+		paid := inDB && o.HasPayment && o.moneyTaken()
+		switch {
+		case inDB && !o.Donation && !o.HasPayment:
+			flag(UnpaidClaim, "claimed sold order has no payment")
+		case paid && !inEscrow:
+			flag(MissingInEscrow, "buyer charged but nothing locked in escrow")
+		case inEscrow && !paid:
+			flag(UnexpectedEscrow, "escrow collected without a captured charge")
+		case paid && !o.Value.Equal(esc.Collected):
+			flag(EscrowAmountMismatch, fmt.Sprintf("order value %d, escrow collected %d", o.Value.Units(), esc.Collected.Units()))
+		case paid && esc.Cancelled != o.refunded():
+			flag(RefundMismatch, fmt.Sprintf("escrow cancelled %t, payment %s", esc.Cancelled, o.PaymentStatus))
+		}
+
+		switch {
+		case paid && o.Wallet && inSettlement:
+			flag(UnknownSettlement, "gateway settled an order paid from the wallet")
+		case paid && o.Wallet:
+			// Nothing for the gateway to settle
+		case paid && !inSettlement:
+			flag(MissingSettlement, "gateway has not settled the charge")
+		case inSettlement && !paid:
+			flag(UnknownSettlement, "gateway settled an order with no captured charge")
+		case paid:
+			// A refund to the wallet leaves the gateway's sale standing
+			expected := o.Charged.Sub(esc.Refunded)
+			if o.PaymentStatus == "refunded" {
+				expected = money.Rupiah(0)
+			}
+			if !settledNet.Equal(expected) {
+				flag(SettlementAmountMismatch, fmt.Sprintf("expected net %d, gateway settled %d", expected.Units(), settledNet.Units()))
+			}
+		}
 	}
+	result.DiscrepancyCount = len(result.Discrepancies)
+	if result.DiscrepancyCount > 0 {
+		result.Status = StatusMismatch
+	}
+	return result
+}
 
-	return &ReconciliationResult{
-		Timestamp:   time.Now(),
-		MainDBTotal: mainDBTotal,
-		EscrowTotal: escrowTotal,
-		LedgerTotal: ledgerTotal,
-		Discrepancy: discrepancy,
-		Status:      status,
-	}, nil
+func keys(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
 }
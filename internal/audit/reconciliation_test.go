@@ -0,0 +1,287 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+// memoryRepository keeps the three books as the Postgres repository returns them
+type memoryRepository struct {
+	orders      map[string]OrderLine
+	claimedAt   map[string]time.Time
+	escrows     map[string]EscrowLine
+	collectedAt map[string]time.Time
+	settlements map[string]SettlementLine // By reference
+	runs        []ReconciliationResult
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		orders:      make(map[string]OrderLine),
+		claimedAt:   make(map[string]time.Time),
+		escrows:     make(map[string]EscrowLine),
+		collectedAt: make(map[string]time.Time),
+		settlements: make(map[string]SettlementLine),
+	}
+}
+
+func inWindow(t, from, to time.Time) bool { return !t.Before(from) && t.Before(to) }
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memoryRepository) MainDBOrders(_ context.Context, from, to time.Time, ids []string) ([]OrderLine, error) {
+	var out []OrderLine
+	for id, o := range m.orders {
+		if inWindow(m.claimedAt[id], from, to) || contains(ids, id) {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryRepository) EscrowOrders(_ context.Context, from, to time.Time, ids []string) ([]EscrowLine, error) {
+	var out []EscrowLine
+	for id, l := range m.escrows {
+		if inWindow(m.collectedAt[id], from, to) || contains(ids, id) {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryRepository) Settlements(_ context.Context, from, to time.Time, ids []string) ([]SettlementLine, error) {
+	var out []SettlementLine
+	for _, l := range m.settlements {
+		if inWindow(l.TransactionAt, from, to) || contains(ids, l.OrderID) {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryRepository) ImportSettlements(_ context.Context, lines []SettlementLine) (int, error) {
+	n := 0
+	for _, l := range lines {
+		if _, ok := m.settlements[l.Reference]; !ok {
+			m.settlements[l.Reference] = l
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memoryRepository) SaveRun(_ context.Context, r *ReconciliationResult) error {
+	m.runs = append(m.runs, *r)
+	return nil
+}
+
+func (m *memoryRepository) GetRun(_ context.Context, id string) (*ReconciliationResult, error) {
+	for i := range m.runs {
+		if m.runs[i].ID == id {
+			return &m.runs[i], nil
+		}
+	}
+	return nil, ErrRunNotFound
+}
+
+func (m *memoryRepository) ListRuns(_ context.Context, limit int) ([]ReconciliationResult, error) {
+	if len(m.runs) < limit {
+		limit = len(m.runs)
+	}
+	return m.runs[:limit], nil
+}
+
+type recordingAlerter struct {
+	alerts []*ReconciliationResult
+}
+
+func (a *recordingAlerter) ReconciliationMismatch(_ context.Context, r *ReconciliationResult) error {
+	a.alerts = append(a.alerts, r)
+	return nil
+}
+
+// paidOrder books a captured order consistently in all three books
+func (m *memoryRepository) paidOrder(id string, at time.Time, value, voucher int64) {
+	m.orders[id] = OrderLine{OrderID: id, HasPayment: true, PaymentStatus: "captured", Value: money.Rupiah(value), Charged: money.Rupiah(value - voucher)}
+	m.claimedAt[id] = at
+	m.escrows[id] = EscrowLine{OrderID: id, Collected: money.Rupiah(value)}
+	m.collectedAt[id] = at
+	m.settlements["TX-"+id] = SettlementLine{Reference: "TX-" + id, OrderID: id, Type: "sale", Gross: money.Rupiah(value - voucher), TransactionAt: at}
+}
+
+func TestReconciliation_BalancedDayIsStoredWithoutAlert(t *testing.T) {
+	repo := newMemoryRepository()
+	alerter := &recordingAlerter{}
+	engine := NewReconciliationEngine(repo, alerter, zap.NewNop())
+
+	day := time.Date(2026, 3, 1, 10, 0, 0, 0, BusinessLocation)
+	repo.paidOrder("o1", day, 50000, 15000)
+	repo.paidOrder("o2", day.Add(time.Hour), 20000, 0)
+	repo.orders["donation"] = OrderLine{OrderID: "donation", Donation: true}
+	repo.claimedAt["donation"] = day
+	// Refunded the same day: the gateway settles the sale and the refund
+	repo.paidOrder("o3", day, 10000, 0)
+	repo.orders["o3"] = OrderLine{OrderID: "o3", HasPayment: true, PaymentStatus: "refunded", Value: money.Rupiah(10000), Charged: money.Rupiah(10000)}
+	repo.escrows["o3"] = EscrowLine{OrderID: "o3", Collected: money.Rupiah(10000), Cancelled: true}
+	repo.settlements["RF-o3"] = SettlementLine{Reference: "RF-o3", OrderID: "o3", Type: "refund", Gross: money.Rupiah(10000), TransactionAt: day}
+	// Another business day is not part of this run
+	repo.paidOrder("tomorrow", day.Add(24*time.Hour), 99000, 0)
+
+	result, err := engine.RunAudit(context.Background(), day)
+	if err != nil {
+		t.Fatalf("audit: %v", err)
+	}
+	if result.Status != StatusBalanced || len(result.Discrepancies) != 0 {
+		t.Fatalf("expected a balanced day, got %+v", result)
+	}
+	if result.OrdersChecked != 4 || result.MainDBTotal.Units() != 80000 || result.EscrowTotal.Units() != 80000 || result.SettlementTotal.Units() != 65000 {
+		t.Fatalf("unexpected totals %+v", result)
+	}
+	if len(repo.runs) != 1 || len(alerter.alerts) != 0 {
+		t.Fatalf("expected one stored run and no alert, got %d runs, %d alerts", len(repo.runs), len(alerter.alerts))
+	}
+}
+
+func TestReconciliation_ReportsOffendingOrders(t *testing.T) {
+	repo := newMemoryRepository()
+	alerter := &recordingAlerter{}
+	engine := NewReconciliationEngine(repo, alerter, zap.NewNop())
+
+	day := time.Date(2026, 3, 1, 10, 0, 0, 0, BusinessLocation)
+	repo.paidOrder("ok", day, 30000, 0)
+
+	repo.paidOrder("no-escrow", day, 20000, 0)
+	delete(repo.escrows, "no-escrow")
+
+	repo.paidOrder("short-escrow", day, 20000, 0)
+	repo.escrows["short-escrow"] = EscrowLine{OrderID: "short-escrow", Collected: money.Rupiah(19999)}
+
+	repo.paidOrder("short-settled", day, 20000, 0)
+	repo.settlements["TX-short-settled"] = SettlementLine{Reference: "TX-short-settled", OrderID: "short-settled", Type: "sale", Gross: money.Rupiah(19500), TransactionAt: day}
+
+	repo.paidOrder("unsettled", day, 20000, 0)
+	delete(repo.settlements, "TX-unsettled")
+
+	repo.orders["unpaid"] = OrderLine{OrderID: "unpaid"}
+	repo.claimedAt["unpaid"] = day
+
+	repo.settlements["TX-stranger"] = SettlementLine{Reference: "TX-stranger", OrderID: "stranger", Type: "sale", Gross: money.Rupiah(5000), TransactionAt: day}
+
+	repo.paidOrder("refund-lost", day, 20000, 0)
+	repo.escrows["refund-lost"] = EscrowLine{OrderID: "refund-lost", Collected: money.Rupiah(20000), Cancelled: true}
+
+	// Claimed yesterday, but escrow collected today: still checked against the main DB
+	repo.paidOrder("late", day.Add(-24*time.Hour), 15000, 0)
+	repo.collectedAt["late"] = day
+
+	result, err := engine.RunAudit(context.Background(), day)
+	if err != nil {
+		t.Fatalf("audit: %v", err)
+	}
+
+	want := map[string]DiscrepancyKind{
+		"no-escrow":     MissingInEscrow,
+		"short-escrow":  EscrowAmountMismatch,
+		"short-settled": SettlementAmountMismatch,
+		"unsettled":     MissingSettlement,
+		"unpaid":        UnpaidClaim,
+		"stranger":      UnknownSettlement,
+		"refund-lost":   RefundMismatch,
+	}
+	got := make(map[string]DiscrepancyKind)
+	for _, d := range result.Discrepancies {
+		got[d.OrderID] = d.Kind
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d offending orders, got %+v", len(want), result.Discrepancies)
+	}
+	for id, kind := range want {
+		if got[id] != kind {
+			t.Errorf("%s: expected %s, got %q", id, kind, got[id])
+		}
+	}
+	if result.Status != StatusMismatch || result.DiscrepancyCount != len(result.Discrepancies) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if len(alerter.alerts) != 1 || alerter.alerts[0].ID != result.ID {
+		t.Fatalf("expected one alert for the run, got %d", len(alerter.alerts))
+	}
+	if stored, err := repo.GetRun(context.Background(), result.ID); err != nil || len(stored.Discrepancies) != len(want) {
+		t.Fatalf("expected the run to be stored with its discrepancies, got %+v, %v", stored, err)
+	}
+}
+
+func TestReconciliation_WalletOrdersNeedNoSettlement(t *testing.T) {
+	repo := newMemoryRepository()
+	engine := NewReconciliationEngine(repo, &recordingAlerter{}, zap.NewNop())
+	day := time.Date(2026, 3, 1, 10, 0, 0, 0, BusinessLocation)
+
+	// Paid from the wallet: the gateway never sees it
+	repo.paidOrder("wallet", day, 25000, 0)
+	repo.orders["wallet"] = OrderLine{OrderID: "wallet", HasPayment: true, PaymentStatus: "captured", Value: money.Rupiah(25000), Charged: money.Rupiah(25000), Wallet: true}
+	delete(repo.settlements, "TX-wallet")
+	// Card payment refunded to the wallet: the gateway's sale stands
+	repo.paidOrder("instant", day, 20000, 0)
+	repo.orders["instant"] = OrderLine{OrderID: "instant", HasPayment: true, PaymentStatus: "refunded_to_wallet", Value: money.Rupiah(20000), Charged: money.Rupiah(20000)}
+	repo.escrows["instant"] = EscrowLine{OrderID: "instant", Collected: money.Rupiah(20000), Cancelled: true}
+	// Wallet order the gateway claims to have settled
+	repo.paidOrder("odd", day, 10000, 0)
+	repo.orders["odd"] = OrderLine{OrderID: "odd", HasPayment: true, PaymentStatus: "captured", Value: money.Rupiah(10000), Charged: money.Rupiah(10000), Wallet: true}
+
+	result, err := engine.RunAudit(context.Background(), day)
+	if err != nil {
+		t.Fatalf("audit: %v", err)
+	}
+	if len(result.Discrepancies) != 1 || result.Discrepancies[0].OrderID != "odd" || result.Discrepancies[0].Kind != UnknownSettlement {
+		t.Fatalf("expected only the settled wallet order flagged, got %+v", result.Discrepancies)
+	}
+}
+
+func TestParseSettlementFile(t *testing.T) {
+	file := `reference,order_id,charge_id,type,gross,fee,net,transaction_time
+CH-1,o1,CH-1,sale,35000.00,700,34300,2026-03-01 23:30:00
+RF-1, o2 ,CH-2,REFUND,20000,0,20000,2026-03-01T17:00:00Z
+`
+	lines, err := ParseSettlementFile("fake", strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	first := lines[0]
+	if first.Gateway != "fake" || first.Gross.Units() != 35000 || first.Fee.Units() != 700 || first.Net.Units() != 34300 {
+		t.Fatalf("unexpected line %+v", first)
+	}
+	// 23:30 WIB is still the 1st of March however the server clock is set
+	if from, _ := BusinessDay(first.TransactionAt); from.Day() != 1 {
+		t.Fatalf("expected a WIB time, got %s", first.TransactionAt)
+	}
+	if lines[1].OrderID != "o2" || lines[1].Type != "refund" {
+		t.Fatalf("unexpected line %+v", lines[1])
+	}
+
+	for _, bad := range []string{
+		"reference,order_id,type,gross,fee,net,transaction_time\n",                                               // No charge_id column
+		"reference,order_id,charge_id,type,gross,fee,net,transaction_time\nX,o1,c,chargeback,1,0,1,2026-03-01\n", // Unknown type
+		"reference,order_id,charge_id,type,gross,fee,net,transaction_time\nX,o1,c,sale,abc,0,1,2026-03-01\n",     // Bad amount
+	} {
+		if _, err := ParseSettlementFile("fake", strings.NewReader(bad)); !errors.Is(err, ErrInvalidSettlementFile) {
+			t.Errorf("expected ErrInvalidSettlementFile for %q, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrRunNotFound = errors.New("reconciliation run not found")
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository reads the three books straight from their tables:
+// surplus/payments, the escrow event store and imported gateway settlements.
+// Amounts are stored and scanned as whole rupiah, so matching is exact.
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) MainDBOrders(ctx context.Context, from, to time.Time, orderIDs []string) ([]OrderLine, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT o.order_id, o.provider_id, o.is_donation, p.order_id IS NOT NULL, COALESCE(p.status, ''),
+		       COALESCE(p.amount + p.voucher_discount, 0), COALESCE(p.amount, 0),
+		       COALESCE(p.gateway = 'wallet', FALSE)
+		FROM (
+			SELECT s.id::TEXT AS order_id, s.provider_id::TEXT AS provider_id, COALESCE(s.is_donation, TRUE) AS is_donation
+			FROM surplus s
+			WHERE s.status IN ('claimed', 'completed')
+			  AND ((s.claimed_at >= $1 AND s.claimed_at < $2) OR s.id::TEXT = ANY($3))
+			UNION
+			-- Charges whose order is not a surplus listing still belong to the main books
+			SELECT p.order_id, '', FALSE
+			FROM payments p
+			WHERE p.order_id = ANY($3) AND NOT EXISTS (SELECT 1 FROM surplus s WHERE s.id::TEXT = p.order_id)
+		) o
+		LEFT JOIN payments p ON p.order_id = o.order_id
+	`, from.UTC(), to.UTC(), pq.Array(orderIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []OrderLine
+	for rows.Next() {
+		var o OrderLine
+		if err := rows.Scan(&o.OrderID, &o.ProviderID, &o.Donation, &o.HasPayment, &o.PaymentStatus, &o.Value, &o.Charged, &o.Wallet); err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+func (r *postgresRepository) EscrowOrders(ctx context.Context, from, to time.Time, orderIDs []string) ([]EscrowLine, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT c.order_id, c.amount, partial.amount, last.type = 'OrderCancelled'
+		FROM escrow_events c
+		JOIN LATERAL (
+			SELECT e.type FROM escrow_events e WHERE e.order_id = c.order_id ORDER BY e.version DESC LIMIT 1
+		) last ON TRUE
+		JOIN LATERAL (
+			SELECT COALESCE(SUM(e.amount), 0) AS amount FROM escrow_events e
+			WHERE e.order_id = c.order_id AND e.type = 'PartiallyRefunded'
+		) partial ON TRUE
+		WHERE c.type = 'PaymentCollected'
+		  AND ((c.occurred_at >= $1 AND c.occurred_at < $2) OR c.order_id = ANY($3))
+	`, from.UTC(), to.UTC(), pq.Array(orderIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []EscrowLine
+	for rows.Next() {
+		var l EscrowLine
+		if err := rows.Scan(&l.OrderID, &l.Collected, &l.Refunded, &l.Cancelled); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+func (r *postgresRepository) Settlements(ctx context.Context, from, to time.Time, orderIDs []string) ([]SettlementLine, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT gateway, reference, order_id, charge_id, type, gross, fee, net, transaction_at
+		FROM gateway_settlements
+		WHERE (transaction_at >= $1 AND transaction_at < $2) OR order_id = ANY($3)
+	`, from.UTC(), to.UTC(), pq.Array(orderIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []SettlementLine
+	for rows.Next() {
+		var l SettlementLine
+		if err := rows.Scan(&l.Gateway, &l.Reference, &l.OrderID, &l.ChargeID, &l.Type, &l.Gross, &l.Fee, &l.Net, &l.TransactionAt); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// ImportSettlements keys rows on the gateway's own reference, so re-importing
+// an overlapping file only adds what is new
+func (r *postgresRepository) ImportSettlements(ctx context.Context, lines []SettlementLine) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	imported := 0
+	for _, l := range lines {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO gateway_settlements (gateway, reference, order_id, charge_id, type, gross, fee, net, transaction_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (gateway, reference) DO NOTHING
+		`, l.Gateway, l.Reference, l.OrderID, l.ChargeID, l.Type, l.Gross, l.Fee, l.Net, l.TransactionAt.UTC())
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		imported += int(n)
+	}
+	return imported, tx.Commit()
+}
+
+func (r *postgresRepository) SaveRun(ctx context.Context, run *ReconciliationResult) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	run.DiscrepancyCount = len(run.Discrepancies)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO reconciliation_runs (id, business_day, status, orders_checked, discrepancy_count,
+		                                 main_db_total, escrow_total, settlement_total, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, run.ID, run.BusinessDay.Format("2006-01-02"), run.Status, run.OrdersChecked, run.DiscrepancyCount,
+		run.MainDBTotal, run.EscrowTotal, run.SettlementTotal, run.Timestamp.UTC())
+	if err != nil {
+		return err
+	}
+	for _, d := range run.Discrepancies {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO reconciliation_discrepancies (run_id, order_id, kind, main_db_amount, escrow_amount, settlement_amount, detail)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, run.ID, d.OrderID, d.Kind, d.MainDBAmount, d.EscrowAmount, d.SettlementAmount, d.Detail)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const runColumns = `id, business_day, status, orders_checked, discrepancy_count, main_db_total, escrow_total, settlement_total, created_at`
+
+func scanRun(row interface{ Scan(...any) error }) (*ReconciliationResult, error) {
+	var run ReconciliationResult
+	err := row.Scan(&run.ID, &run.BusinessDay, &run.Status, &run.OrdersChecked, &run.DiscrepancyCount,
+		&run.MainDBTotal, &run.EscrowTotal, &run.SettlementTotal, &run.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (r *postgresRepository) GetRun(ctx context.Context, id string) (*ReconciliationResult, error) {
+	run, err := scanRun(r.db.QueryRowContext(ctx, `SELECT `+runColumns+` FROM reconciliation_runs WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRunNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT order_id, kind, main_db_amount, escrow_amount, settlement_amount, detail
+		FROM reconciliation_discrepancies
+		WHERE run_id = $1
+		ORDER BY order_id, id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var d Discrepancy
+		if err := rows.Scan(&d.OrderID, &d.Kind, &d.MainDBAmount, &d.EscrowAmount, &d.SettlementAmount, &d.Detail); err != nil {
+			return nil, err
+		}
+		run.Discrepancies = append(run.Discrepancies, d)
+	}
+	return run, rows.Err()
+}
+
+// ListRuns returns the latest runs without their discrepancy lines
+func (r *postgresRepository) ListRuns(ctx context.Context, limit int) ([]ReconciliationResult, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+runColumns+` FROM reconciliation_runs ORDER BY created_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []ReconciliationResult
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *run)
+	}
+	return out, rows.Err()
+}
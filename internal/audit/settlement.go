@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+var ErrInvalidSettlementFile = errors.New("invalid settlement file")
+
+// settlementColumns are required in the header row, in any order
+var settlementColumns = []string{"reference", "order_id", "charge_id", "type", "gross", "fee", "net", "transaction_time"}
+
+// ParseSettlementFile reads a gateway settlement report exported as CSV.
+// Amounts are rupiah; times without a zone are WIB, as the gateways print them.
+func ParseSettlementFile(gateway string, r io.Reader) ([]SettlementLine, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidSettlementFile, err)
+	}
+	col := make(map[string]int, len(header))
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, c := range settlementColumns {
+		if _, ok := col[c]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrInvalidSettlementFile, c)
+		}
+	}
+
+	var lines []SettlementLine
+	for n := 2; ; n++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidSettlementFile, n, err)
+		}
+		l, err := parseSettlementRecord(gateway, rec, col)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidSettlementFile, n, err)
+		}
+		lines = append(lines, l)
+	}
+	return lines, nil
+}
+
+func parseSettlementRecord(gateway string, rec []string, col map[string]int) (SettlementLine, error) {
+	field := func(name string) string { return strings.TrimSpace(rec[col[name]]) }
+
+	l := SettlementLine{
+		Gateway:   gateway,
+		Reference: field("reference"),
+		OrderID:   field("order_id"),
+		ChargeID:  field("charge_id"),
+		Type:      strings.ToLower(field("type")),
+	}
+	if l.Reference == "" || l.OrderID == "" {
+		return l, errors.New("reference and order_id are required")
+	}
+	if l.Type != "sale" && l.Type != "refund" {
+		return l, fmt.Errorf("unknown type %q", l.Type)
+	}
+
+	var err error
+	if l.Gross, err = parseRupiah(field("gross")); err != nil {
+		return l, fmt.Errorf("gross: %v", err)
+	}
+	if l.Fee, err = parseRupiah(field("fee")); err != nil {
+		return l, fmt.Errorf("fee: %v", err)
+	}
+	if l.Net, err = parseRupiah(field("net")); err != nil {
+		return l, fmt.Errorf("net: %v", err)
+	}
+	if l.TransactionAt, err = parseSettlementTime(field("transaction_time")); err != nil {
+		return l, fmt.Errorf("transaction_time: %v", err)
+	}
+	return l, nil
+}
+
+// parseRupiah reads a report amount exactly; a stray fraction rounds half up
+func parseRupiah(s string) (money.Money, error) {
+	if s == "" {
+		return money.Rupiah(0), nil
+	}
+	return money.Parse(s, money.HalfUp)
+}
+
+func parseSettlementTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, BusinessLocation); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q", s)
+}
@@ -40,6 +40,12 @@ func AuthMiddleware(uc domain.AuthUsecase) func(http.Handler) http.Handler {
 	}
 }
 
+// CurrentUser is the user AuthMiddleware signed the request in as
+func CurrentUser(r *http.Request) (*domain.User, bool) {
+	user, ok := r.Context().Value(UserContextKey).(*domain.User)
+	return user, ok
+}
+
 // RoleGuard ensures only specific roles can access a route
 func RoleGuard(roles ...domain.UserRole) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
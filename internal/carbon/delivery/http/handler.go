@@ -1,25 +1,42 @@
 package http
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	authDomain "github.com/albnnaardy11/pahlawan-pangan/internal/auth/domain"
+	iamMiddleware "github.com/albnnaardy11/pahlawan-pangan/internal/auth/middleware"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/export"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/service"
 )
 
 type CarbonHandler struct {
 	Service *service.CarbonService
+	Factors *service.FactorService
+	Credits *service.CreditService
+	// Auth signs in callers of the routes that act as a user; verification
+	// stays public
+	Auth authDomain.AuthUsecase
+	// PublicURL is where partners reach this API; exports link back to it
+	PublicURL string
 }
 
-func NewCarbonHandler(svc *service.CarbonService) *CarbonHandler {
-	return &CarbonHandler{Service: svc}
+func NewCarbonHandler(svc *service.CarbonService, factors *service.FactorService, credits *service.CreditService, auth authDomain.AuthUsecase, publicURL string) *CarbonHandler {
+	return &CarbonHandler{Service: svc, Factors: factors, Credits: credits, Auth: auth, PublicURL: strings.TrimRight(publicURL, "/")}
 }
 
 // GET /api/v1/carbon/certificate/{vendor_id}?year=2024
+// Issues a signed ESG certificate over the vendor's savings in the year
 func (h *CarbonHandler) GetESGCertificate(w http.ResponseWriter, r *http.Request) {
 	vendorID := chi.URLParam(r, "vendor_id")
 	yearStr := r.URL.Query().Get("year")
@@ -31,18 +48,711 @@ func (h *CarbonHandler) GetESGCertificate(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	report, err := h.Service.GenerateESGReport(r.Context(), vendorID, year)
+	certificate, err := h.Service.IssueCertificate(r.Context(), vendorID, domain.YearlyPeriod(year))
+	if errors.Is(err, domain.ErrNoSavingsInPeriod) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(certificate)
+}
+
+// GET /api/v1/carbon/reports/{vendor_id}?period=quarterly&year=2025&quarter=2&format=pdf
+// Issues a certificate over the period and renders it as csv, jsonld, pdf or
+// json (the default, the certificate itself)
+func (h *CarbonHandler) GetVendorReport(w http.ResponseWriter, r *http.Request) {
+	period, format, ok := reportQuery(w, r)
+	if !ok {
+		return
+	}
+
+	certificate, err := h.Service.IssueCertificate(r.Context(), chi.URLParam(r, "vendor_id"), period)
+	h.writeReport(w, certificate, format, err)
+}
+
+// GET /api/v1/carbon/chains/{chain_id}/reports?period=monthly&year=2025&month=3&format=csv
+// The same report rolled up over every outlet in the chain
+func (h *CarbonHandler) GetChainReport(w http.ResponseWriter, r *http.Request) {
+	period, format, ok := reportQuery(w, r)
+	if !ok {
+		return
+	}
+
+	certificate, err := h.Service.IssueChainCertificate(r.Context(), chi.URLParam(r, "chain_id"), period)
+	h.writeReport(w, certificate, format, err)
+}
+
+// GET /api/v1/carbon/certificates/{certificate_id}/export?format=pdf
+// Renders an already issued certificate again
+func (h *CarbonHandler) ExportCertificate(w http.ResponseWriter, r *http.Request) {
+	format, err := export.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, "format must be csv, jsonld or pdf", http.StatusBadRequest)
+		return
+	}
+	certificate, ok := h.certificate(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeExport(w, certificate, format)
+}
+
+// reportQuery reads the period and output format of a report request; an
+// empty format means the certificate JSON
+func reportQuery(w http.ResponseWriter, r *http.Request) (domain.Period, export.Format, bool) {
+	q := r.URL.Query()
+	var format export.Format
+	if f := q.Get("format"); f != "" && f != "json" {
+		parsed, err := export.ParseFormat(f)
+		if err != nil {
+			http.Error(w, "format must be json, csv, jsonld or pdf", http.StatusBadRequest)
+			return domain.Period{}, "", false
+		}
+		format = parsed
+	}
+
+	period, err := periodFromQuery(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return domain.Period{}, "", false
+	}
+	return period, format, true
+}
+
+// periodFromQuery understands period=yearly (the default, with year),
+// quarterly (year, quarter), monthly (year, month) and custom (from, to as
+// YYYY-MM-DD, both days included)
+func periodFromQuery(q url.Values) (domain.Period, error) {
+	year := time.Now().Year()
+	if raw := q.Get("year"); raw != "" {
+		y, err := strconv.Atoi(raw)
+		if err != nil {
+			return domain.Period{}, fmt.Errorf("%w: year must be a number", domain.ErrInvalidPeriod)
+		}
+		year = y
+	}
+
+	switch q.Get("period") {
+	case "", "yearly":
+		return domain.YearlyPeriod(year), nil
+	case "quarterly":
+		quarter, err := strconv.Atoi(q.Get("quarter"))
+		if err != nil {
+			return domain.Period{}, fmt.Errorf("%w: quarter must be 1 to 4", domain.ErrInvalidPeriod)
+		}
+		return domain.QuarterlyPeriod(year, quarter)
+	case "monthly":
+		month, err := strconv.Atoi(q.Get("month"))
+		if err != nil {
+			return domain.Period{}, fmt.Errorf("%w: month must be 1 to 12", domain.ErrInvalidPeriod)
+		}
+		return domain.MonthlyPeriod(year, time.Month(month))
+	case "custom":
+		from, err := time.Parse(time.DateOnly, q.Get("from"))
+		if err != nil {
+			return domain.Period{}, fmt.Errorf("%w: from must be YYYY-MM-DD", domain.ErrInvalidPeriod)
+		}
+		to, err := time.Parse(time.DateOnly, q.Get("to"))
+		if err != nil {
+			return domain.Period{}, fmt.Errorf("%w: to must be YYYY-MM-DD", domain.ErrInvalidPeriod)
+		}
+		return domain.CustomPeriod(from, to)
+	}
+	return domain.Period{}, fmt.Errorf("%w: period must be yearly, quarterly, monthly or custom", domain.ErrInvalidPeriod)
+}
+
+func (h *CarbonHandler) writeReport(w http.ResponseWriter, certificate *domain.Certificate, format export.Format, err error) {
+	switch {
+	case errors.Is(err, domain.ErrNoSavingsInPeriod), errors.Is(err, domain.ErrChainNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if format == "" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(certificate)
+		return
+	}
+	h.writeExport(w, certificate, format)
+}
+
+func (h *CarbonHandler) writeExport(w http.ResponseWriter, certificate *domain.Certificate, format export.Format) {
+	// rendered in full first so a failure is still a clean 500
+	var buf bytes.Buffer
+	verifyURL := h.PublicURL + "/api/v1/carbon/certificates/" + certificate.ID + "/verify"
+	if err := export.Write(&buf, format, certificate, verifyURL); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="`+format.Filename(certificate)+`"`)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// POST /api/v1/carbon/chains
+// Groups outlets that report together (admin), created by the signed-in admin
+func (h *CarbonHandler) CreateChain(w http.ResponseWriter, r *http.Request) {
+	user, ok := iamMiddleware.CurrentUser(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var c domain.Chain
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.CreatedBy = user.ID
+
+	created, err := h.Service.CreateChain(r.Context(), c)
+	if errors.Is(err, domain.ErrInvalidChain) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(created)
+}
+
+// GET /api/v1/carbon/chains/{chain_id}
+func (h *CarbonHandler) GetChain(w http.ResponseWriter, r *http.Request) {
+	c, err := h.Service.GetChain(r.Context(), chi.URLParam(r, "chain_id"))
+	if errors.Is(err, domain.ErrChainNotFound) {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(report)
+	_ = json.NewEncoder(w).Encode(c)
+}
+
+// PUT /api/v1/carbon/chains/{chain_id}/outlets/{vendor_id} (admin)
+// Adds an outlet to the chain; its past savings count in new reports
+func (h *CarbonHandler) AddChainOutlet(w http.ResponseWriter, r *http.Request) {
+	c, err := h.Service.AddOutlet(r.Context(), chi.URLParam(r, "chain_id"), chi.URLParam(r, "vendor_id"))
+	switch {
+	case errors.Is(err, domain.ErrChainNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, domain.ErrInvalidChain):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(c)
+}
+
+// GET /api/v1/carbon/certificates/{certificate_id}
+func (h *CarbonHandler) GetCertificate(w http.ResponseWriter, r *http.Request) {
+	certificate, ok := h.certificate(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(certificate)
+}
+
+// GET /api/v1/carbon/certificates/{certificate_id}/verify
+// Re-checks an issued certificate against the published keys
+func (h *CarbonHandler) VerifyIssuedCertificate(w http.ResponseWriter, r *http.Request) {
+	certificate, ok := h.certificate(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.Service.VerifyCertificate(certificate))
+}
+
+// POST /api/v1/carbon/certificates/verify
+// Checks a certificate as handed over by a partner, without looking it up
+func (h *CarbonHandler) VerifyCertificate(w http.ResponseWriter, r *http.Request) {
+	var certificate domain.Certificate
+	if err := json.NewDecoder(r.Body).Decode(&certificate); err != nil {
+		http.Error(w, "invalid certificate", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.Service.VerifyCertificate(&certificate))
+}
+
+// GET /api/v1/carbon/certificate-key
+// The Ed25519 public key certificates are signed with, as PEM
+func (h *CarbonHandler) GetCertificateKey(w http.ResponseWriter, r *http.Request) {
+	pem, err := h.Service.CertificateKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	_, _ = w.Write(pem)
+}
+
+func (h *CarbonHandler) certificate(w http.ResponseWriter, r *http.Request) (*domain.Certificate, bool) {
+	certificate, err := h.Service.GetCertificate(r.Context(), chi.URLParam(r, "certificate_id"))
+	if errors.Is(err, domain.ErrCertificateNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return certificate, true
+}
+
+// GET /api/v1/carbon/ledger/verify
+// Walks the whole chain now and reports the first broken link, if any
+func (h *CarbonHandler) VerifyLedger(w http.ResponseWriter, r *http.Request) {
+	v, err := h.Service.VerifyChain(r.Context(), domain.Genesis)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// GET /api/v1/carbon/ledger/verifications/latest
+// The last scheduled run over the entries appended since the one before it
+func (h *CarbonHandler) GetLatestVerification(w http.ResponseWriter, r *http.Request) {
+	v, err := h.Service.LatestVerification(r.Context())
+	if errors.Is(err, domain.ErrVerificationNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// GET /api/v1/carbon/checkpoints?limit=20
+// Signed Merkle roots over the ledger, newest first
+func (h *CarbonHandler) ListCheckpoints(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	checkpoints, err := h.Service.Checkpoints(r.Context(), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(checkpoints)
+}
+
+// GET /api/v1/carbon/checkpoints/{checkpoint_id}
+func (h *CarbonHandler) GetCheckpoint(w http.ResponseWriter, r *http.Request) {
+	c, err := h.Service.GetCheckpoint(r.Context(), chi.URLParam(r, "checkpoint_id"))
+	if errors.Is(err, domain.ErrCheckpointNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(c)
+}
+
+// GET /api/v1/carbon/signing-key
+// The Ed25519 public key checkpoints are signed with, as PEM
+func (h *CarbonHandler) GetSigningKey(w http.ResponseWriter, r *http.Request) {
+	pem, err := h.Service.SigningKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	_, _ = w.Write(pem)
+}
+
+// GET /api/v1/carbon/ledger/entries/{entry_id}/proof
+// An inclusion proof that can be checked offline against the signing key
+func (h *CarbonHandler) GetInclusionProof(w http.ResponseWriter, r *http.Request) {
+	proof, err := h.Service.InclusionProof(r.Context(), chi.URLParam(r, "entry_id"))
+	switch {
+	case errors.Is(err, domain.ErrEntryNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, domain.ErrNotCheckpointed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(proof)
+}
+
+// GET /api/v1/carbon/factors
+// Every emission factor version, newest first
+func (h *CarbonHandler) ListFactorVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := h.Factors.Versions(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(versions)
+}
+
+// GET /api/v1/carbon/factors/effective?at=2025-03-01T00:00:00Z
+// The version in force at a time, now by default
+func (h *CarbonHandler) GetEffectiveFactors(w http.ResponseWriter, r *http.Request) {
+	at := time.Now()
+	if raw := r.URL.Query().Get("at"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "at must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		at = t
+	}
+
+	v, err := h.Factors.Effective(r.Context(), at)
+	h.writeFactorVersion(w, v, err)
+}
+
+// GET /api/v1/carbon/factors/{version}
+func (h *CarbonHandler) GetFactorVersion(w http.ResponseWriter, r *http.Request) {
+	v, err := h.Factors.Version(r.Context(), chi.URLParam(r, "version"))
+	h.writeFactorVersion(w, v, err)
+}
+
+// POST /api/v1/carbon/factors
+// Publishes a new methodology (admin); versions are never edited afterwards.
+// Recorded as published by the signed-in admin.
+func (h *CarbonHandler) PublishFactorVersion(w http.ResponseWriter, r *http.Request) {
+	user, ok := iamMiddleware.CurrentUser(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var v domain.FactorVersion
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	v.CreatedBy = user.ID
+
+	published, err := h.Factors.Publish(r.Context(), v)
+	switch {
+	case errors.Is(err, domain.ErrInvalidFactorVersion):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, domain.ErrFactorVersionExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(published)
+}
+
+func (h *CarbonHandler) writeFactorVersion(w http.ResponseWriter, v *domain.FactorVersion, err error) {
+	if errors.Is(err, domain.ErrFactorVersionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// GET /api/v1/carbon/restatements/{vendor_id}?version=2025.1&year=2024
+// The vendor's savings in the year restated under another factor version
+func (h *CarbonHandler) GetRestatement(w http.ResponseWriter, r *http.Request) {
+	version := r.URL.Query().Get("version")
+	if version == "" {
+		http.Error(w, "version is required", http.StatusBadRequest)
+		return
+	}
+	year := time.Now().Year()
+	if y, err := strconv.Atoi(r.URL.Query().Get("year")); err == nil {
+		year = y
+	}
+
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	restatement, err := h.Service.Restate(r.Context(), chi.URLParam(r, "vendor_id"), start, start.AddDate(1, 0, 0), version)
+	switch {
+	case errors.Is(err, domain.ErrFactorVersionNotFound), errors.Is(err, domain.ErrNoSavingsInPeriod):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(restatement)
+}
+
+// GET /api/v1/carbon/credits/policy
+// How much CO2e a token stands for and the minimum issued at once
+func (h *CarbonHandler) GetCreditPolicy(w http.ResponseWriter, r *http.Request) {
+	p := h.Credits.Policy()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int64{"co2e_grams_per_token": p.GramsPerToken, "min_tokens": p.MinTokens})
+}
+
+// POST /api/v1/carbon/credits/issuances
+// Issues credits for checkpointed savings now instead of waiting for the job (admin)
+func (h *CarbonHandler) IssueCredits(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.Credits.Issue(r.Context())
+	if errors.Is(err, domain.ErrLedgerUnverified) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tokens == nil {
+		tokens = []domain.CreditToken{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(tokens)
+}
+
+// GET /api/v1/carbon/credits/accounts/{provider_id}
+// What the provider has been issued and what carries forward
+func (h *CarbonHandler) GetCreditAccount(w http.ResponseWriter, r *http.Request) {
+	a, err := h.Credits.Account(r.Context(), chi.URLParam(r, "provider_id"))
+	if errors.Is(err, domain.ErrCreditAccountNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(a)
+}
+
+// GET /api/v1/carbon/credits/tokens?owner=...&status=ACTIVE
+func (h *CarbonHandler) ListCreditTokens(w http.ResponseWriter, r *http.Request) {
+	owner := r.URL.Query().Get("owner")
+	if owner == "" {
+		http.Error(w, "owner is required", http.StatusBadRequest)
+		return
+	}
+	status := domain.CreditTokenStatus(r.URL.Query().Get("status"))
+	if status != "" && status != domain.CreditActive && status != domain.CreditRetired {
+		http.Error(w, "status must be ACTIVE or RETIRED", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.Credits.Tokens(r.Context(), owner, status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tokens == nil {
+		tokens = []domain.CreditToken{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tokens)
+}
+
+// GET /api/v1/carbon/credits/tokens/{token_id}
+// The token with the ledger entries behind it
+func (h *CarbonHandler) GetCreditToken(w http.ResponseWriter, r *http.Request) {
+	t, err := h.Credits.Token(r.Context(), chi.URLParam(r, "token_id"))
+	if errors.Is(err, domain.ErrCreditTokenNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(t)
+}
+
+// GET /api/v1/carbon/credits/tokens/{token_id}/history
+func (h *CarbonHandler) GetCreditHistory(w http.ResponseWriter, r *http.Request) {
+	events, err := h.Credits.History(r.Context(), chi.URLParam(r, "token_id"))
+	if errors.Is(err, domain.ErrCreditTokenNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(events)
+}
+
+// POST /api/v1/carbon/credits/transfers
+// Hands the caller's active tokens to another holder, all or none. Only an
+// admin may name a different sender in "from".
+func (h *CarbonHandler) TransferCredits(w http.ResponseWriter, r *http.Request) {
+	user, ok := iamMiddleware.CurrentUser(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var t domain.CreditTransfer
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if t.From == "" {
+		t.From = user.ID
+	}
+	if t.From != user.ID && user.Role != authDomain.RoleAdmin {
+		http.Error(w, "forbidden: tokens can only be moved by their holder", http.StatusForbidden)
+		return
+	}
+	t.TransferredBy = user.ID
+
+	events, err := h.Credits.Transfer(r.Context(), t)
+	h.writeCreditEvents(w, events, err)
+}
+
+// POST /api/v1/carbon/credits/retirements
+// Claims the caller's active tokens against a beneficiary's emissions, for
+// good. Only an admin may name a different holder in "owner".
+func (h *CarbonHandler) RetireCredits(w http.ResponseWriter, r *http.Request) {
+	user, ok := iamMiddleware.CurrentUser(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var rt domain.CreditRetirement
+	if err := json.NewDecoder(r.Body).Decode(&rt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rt.Owner == "" {
+		rt.Owner = user.ID
+	}
+	if rt.Owner != user.ID && user.Role != authDomain.RoleAdmin {
+		http.Error(w, "forbidden: tokens can only be retired by their holder", http.StatusForbidden)
+		return
+	}
+	rt.RetiredBy = user.ID
+
+	events, err := h.Credits.Retire(r.Context(), rt)
+	h.writeCreditEvents(w, events, err)
+}
+
+func (h *CarbonHandler) writeCreditEvents(w http.ResponseWriter, events []domain.CreditEvent, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidCreditMove):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, domain.ErrCreditTokenNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, domain.ErrCreditTokenUnavailable):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(events)
 }
 
 func (h *CarbonHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 	r.Get("/certificate/{vendor_id}", h.GetESGCertificate)
+	r.Get("/certificate-key", h.GetCertificateKey)
+	r.Post("/certificates/verify", h.VerifyCertificate)
+	r.Get("/certificates/{certificate_id}", h.GetCertificate)
+	r.Get("/certificates/{certificate_id}/verify", h.VerifyIssuedCertificate)
+	r.Get("/certificates/{certificate_id}/export", h.ExportCertificate)
+	r.Get("/reports/{vendor_id}", h.GetVendorReport)
+	r.Get("/chains/{chain_id}", h.GetChain)
+	r.Get("/chains/{chain_id}/reports", h.GetChainReport)
+	r.Get("/ledger/verify", h.VerifyLedger)
+	r.Get("/ledger/verifications/latest", h.GetLatestVerification)
+	r.Get("/ledger/entries/{entry_id}/proof", h.GetInclusionProof)
+	r.Get("/checkpoints", h.ListCheckpoints)
+	r.Get("/checkpoints/{checkpoint_id}", h.GetCheckpoint)
+	r.Get("/signing-key", h.GetSigningKey)
+	r.Get("/factors", h.ListFactorVersions)
+	r.Get("/factors/effective", h.GetEffectiveFactors)
+	r.Get("/factors/{version}", h.GetFactorVersion)
+	r.Get("/restatements/{vendor_id}", h.GetRestatement)
+	r.Get("/credits/policy", h.GetCreditPolicy)
+	r.Get("/credits/accounts/{provider_id}", h.GetCreditAccount)
+	r.Get("/credits/tokens", h.ListCreditTokens)
+	r.Get("/credits/tokens/{token_id}", h.GetCreditToken)
+	r.Get("/credits/tokens/{token_id}/history", h.GetCreditHistory)
+
+	// Credit moves, chain membership and methodology changes act as the
+	// signed-in user
+	r.Group(func(r chi.Router) {
+		r.Use(iamMiddleware.AuthMiddleware(h.Auth))
+		r.With(iamMiddleware.RoleGuard(authDomain.RoleAdmin)).Post("/chains", h.CreateChain)
+		r.With(iamMiddleware.RoleGuard(authDomain.RoleAdmin)).Put("/chains/{chain_id}/outlets/{vendor_id}", h.AddChainOutlet)
+		r.With(iamMiddleware.RoleGuard(authDomain.RoleAdmin)).Post("/factors", h.PublishFactorVersion)
+		r.With(iamMiddleware.RoleGuard(authDomain.RoleAdmin)).Post("/credits/issuances", h.IssueCredits)
+		r.Post("/credits/transfers", h.TransferCredits)
+		r.Post("/credits/retirements", h.RetireCredits)
+	})
 	return r
 }
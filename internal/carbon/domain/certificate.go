@@ -0,0 +1,188 @@
+package domain
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrCertificateNotFound = errors.New("ESG certificate not found")
+	ErrNoSavingsInPeriod   = errors.New("no carbon savings recorded in the period")
+	ErrInvalidCertificate  = errors.New("ESG certificate does not verify")
+)
+
+// certificateVersion prefixes what a certificate signature covers
+const certificateVersion = "pahlawan-esg-certificate/v1"
+
+// Certificate is a signed ESG statement of the carbon savings of a vendor, or
+// of a chain's outlets together, over a period. It carries every ledger entry
+// behind its totals, each with an inclusion proof into one of the embedded
+// checkpoints, so an auditor can check it with the two public keys alone: the
+// certificate key and the checkpoint key.
+type Certificate struct {
+	ID                 string           `json:"id"`
+	VendorID           string           `json:"vendor_id,omitempty"` // Single-vendor certificates
+	ChainID            string           `json:"chain_id,omitempty"`  // Rollups over a chain's outlets
+	ChainName          string           `json:"chain_name,omitempty"`
+	Outlets            []OutletTotals   `json:"outlets,omitempty"` // A rollup's subtotals, one per outlet
+	PeriodLabel        string           `json:"period_label"`
+	PeriodStart        time.Time        `json:"period_start"` // Inclusive
+	PeriodEnd          time.Time        `json:"period_end"`   // Exclusive
+	TotalFoodSavedKg   float64          `json:"total_food_saved_kg"`
+	TotalCarbonSavedKg float64          `json:"total_carbon_saved_kg"`
+	TransactionCount   int              `json:"transaction_count"`
+	Entries            []CertifiedEntry `json:"entries"`
+	Checkpoints        []Checkpoint     `json:"checkpoints"`
+	IssuedAt           time.Time        `json:"issued_at"`
+	KeyID              string           `json:"key_id"`
+	Signature          string           `json:"signature"` // Base64 Ed25519 over SignedPayload
+}
+
+// OutletTotals is one outlet's share of a chain rollup
+type OutletTotals struct {
+	VendorID         string  `json:"vendor_id"`
+	TransactionCount int     `json:"transaction_count"`
+	FoodSavedKg      float64 `json:"food_saved_kg"`
+	CarbonSavedKg    float64 `json:"carbon_saved_kg"`
+}
+
+// Subject names who the certificate is for: the vendor, or the chain
+func (c *Certificate) Subject() string {
+	if c.ChainID != "" {
+		return c.ChainName
+	}
+	return c.VendorID
+}
+
+// CertifiedEntry is a ledger entry with its place in a checkpoint's tree
+type CertifiedEntry struct {
+	Entry        CarbonEntry `json:"entry"`
+	CheckpointID string      `json:"checkpoint_id"`
+	LeafIndex    int         `json:"leaf_index"`
+	AuditPath    []string    `json:"audit_path"` // Hex sibling hashes, leaf to root
+}
+
+// SignedPayload is the exact text the signature covers, one field per line.
+// Entries are covered through their hashes, which bind their content.
+func (c *Certificate) SignedPayload() []byte {
+	lines := []string{
+		certificateVersion,
+		c.ID,
+		c.VendorID,
+		c.ChainID,
+		c.ChainName,
+		c.PeriodLabel,
+		c.PeriodStart.UTC().Format(time.RFC3339Nano),
+		c.PeriodEnd.UTC().Format(time.RFC3339Nano),
+		strconv.FormatFloat(c.TotalFoodSavedKg, 'g', -1, 64),
+		strconv.FormatFloat(c.TotalCarbonSavedKg, 'g', -1, 64),
+		strconv.Itoa(c.TransactionCount),
+		c.IssuedAt.UTC().Format(time.RFC3339Nano),
+		c.KeyID,
+	}
+	for _, o := range c.Outlets {
+		lines = append(lines, "outlet "+o.VendorID+" "+strconv.Itoa(o.TransactionCount)+" "+
+			strconv.FormatFloat(o.FoodSavedKg, 'g', -1, 64)+" "+strconv.FormatFloat(o.CarbonSavedKg, 'g', -1, 64))
+	}
+	for _, cp := range c.Checkpoints {
+		lines = append(lines, "checkpoint "+cp.ID+" "+cp.Root)
+	}
+	for _, e := range c.Entries {
+		lines = append(lines, "entry "+e.Entry.Hash+" "+e.CheckpointID+" "+strconv.Itoa(e.LeafIndex))
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// Verify checks the certificate signature, that the totals (and a rollup's
+// outlet subtotals) add up from the embedded entries, that every entry
+// belongs to the vendor or one of the outlets and to the period, and that
+// every entry is part of a checkpoint signed with checkpointKey
+func (c *Certificate) Verify(certificateKey, checkpointKey ed25519.PublicKey) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidCertificate, fmt.Sprintf(format, args...))
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(c.Signature)
+	if err != nil || c.KeyID != KeyID(certificateKey) || !ed25519.Verify(certificateKey, c.SignedPayload(), sig) {
+		return invalid("signature does not match the certificate key")
+	}
+
+	if (c.VendorID == "") == (c.ChainID == "") || (c.ChainID == "" && len(c.Outlets) > 0) {
+		return invalid("a certificate is either for one vendor or for a chain's outlets")
+	}
+	outlets := make(map[string]*OutletTotals, len(c.Outlets))
+	for _, o := range c.Outlets {
+		if outlets[o.VendorID] != nil {
+			return invalid("outlet %s is listed twice", o.VendorID)
+		}
+		outlets[o.VendorID] = &OutletTotals{VendorID: o.VendorID}
+	}
+
+	checkpoints := make(map[string]Checkpoint, len(c.Checkpoints))
+	for _, cp := range c.Checkpoints {
+		if err := cp.VerifySignature(checkpointKey); err != nil {
+			return invalid("checkpoint %s is not signed by the checkpoint key", cp.ID)
+		}
+		checkpoints[cp.ID] = cp
+	}
+
+	var food, carbon float64
+	var lastSeq int64
+	for _, ce := range c.Entries {
+		e := ce.Entry
+		switch {
+		case e.Sequence <= lastSeq:
+			return invalid("entries are not in ledger order at seq %d", e.Sequence)
+		case c.ChainID == "" && e.VendorID != c.VendorID, c.ChainID != "" && outlets[e.VendorID] == nil:
+			return invalid("entry %s belongs to another vendor", e.ID)
+		case e.Timestamp.Before(c.PeriodStart) || !e.Timestamp.Before(c.PeriodEnd):
+			return invalid("entry %s is outside the period", e.ID)
+		}
+		cp, ok := checkpoints[ce.CheckpointID]
+		if !ok {
+			return invalid("entry %s refers to a checkpoint the certificate does not carry", e.ID)
+		}
+		proof := InclusionProof{Entry: e, LeafIndex: ce.LeafIndex, TreeSize: cp.Size(), AuditPath: ce.AuditPath, Checkpoint: cp}
+		if err := proof.Verify(checkpointKey); err != nil {
+			return invalid("entry %s: %v", e.ID, err)
+		}
+		food += e.WeightKg
+		carbon += e.CarbonSavedKg
+		lastSeq = e.Sequence
+		if o := outlets[e.VendorID]; o != nil {
+			o.TransactionCount++
+			o.FoodSavedKg += e.WeightKg
+			o.CarbonSavedKg += e.CarbonSavedKg
+		}
+	}
+
+	for _, o := range c.Outlets {
+		if *outlets[o.VendorID] != o {
+			return invalid("outlet %s subtotals do not add up from its entries", o.VendorID)
+		}
+	}
+
+	if c.TransactionCount != len(c.Entries) || food != c.TotalFoodSavedKg || carbon != c.TotalCarbonSavedKg {
+		return invalid("totals do not add up from the entries")
+	}
+	return nil
+}
+
+// CertificateVerification is the outcome of checking a certificate
+type CertificateVerification struct {
+	CertificateID string    `json:"certificate_id"`
+	Valid         bool      `json:"valid"`
+	Reason        string    `json:"reason,omitempty"`
+	CheckedAt     time.Time `json:"checked_at"`
+}
+
+// SignCertificate stamps the certificate with this key
+func (s *Signer) SignCertificate(c *Certificate) {
+	c.KeyID = s.id
+	c.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, c.SignedPayload()))
+}
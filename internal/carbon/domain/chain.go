@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrChainNotFound = errors.New("vendor chain not found")
+	ErrInvalidChain  = errors.New("invalid vendor chain")
+)
+
+// Chain groups the outlets (vendors) of one corporate partner so their
+// savings can be reported together
+type Chain struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Outlets   []string  `json:"outlets"` // Vendor IDs
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (c *Chain) Validate() error {
+	switch {
+	case c.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidChain)
+	case c.CreatedBy == "":
+		return fmt.Errorf("%w: created_by is required", ErrInvalidChain)
+	}
+	seen := make(map[string]bool, len(c.Outlets))
+	for _, o := range c.Outlets {
+		if o == "" || seen[o] {
+			return fmt.Errorf("%w: outlets must be distinct vendor IDs", ErrInvalidChain)
+		}
+		seen[o] = true
+	}
+	return nil
+}
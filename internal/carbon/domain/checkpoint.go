@@ -0,0 +1,191 @@
+package domain
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/merkle"
+)
+
+var (
+	ErrCheckpointNotFound = errors.New("carbon checkpoint not found")
+	ErrNotCheckpointed    = errors.New("carbon ledger entry is not in a published checkpoint yet")
+	ErrInvalidSigningKey  = errors.New("invalid carbon signing key")
+	ErrInvalidSignature   = errors.New("carbon signature does not verify")
+	ErrInvalidProof       = errors.New("carbon inclusion proof does not verify")
+)
+
+// checkpointVersion prefixes what a checkpoint signature covers
+const checkpointVersion = "pahlawan-carbon-checkpoint/v1"
+
+// Checkpoint is a signed Merkle root over a run of consecutive ledger
+// entries. Its leaves are the entries' hashes, in sequence order.
+type Checkpoint struct {
+	ID         string    `json:"id"`
+	FromSeq    int64     `json:"from_seq"`    // First entry covered
+	ThroughSeq int64     `json:"through_seq"` // Last entry covered
+	Root       string    `json:"root"`        // Hex Merkle root (RFC 6962)
+	ChainHash  string    `json:"chain_hash"`  // Hash of the last entry, tying the tree to the chain
+	CreatedAt  time.Time `json:"created_at"`
+	KeyID      string    `json:"key_id"`
+	Signature  string    `json:"signature"` // Base64 Ed25519 over SignedPayload
+}
+
+// Size is the number of entries the checkpoint covers
+func (c *Checkpoint) Size() int {
+	return int(c.ThroughSeq - c.FromSeq + 1)
+}
+
+// Covers reports whether the entry at seq is one of the checkpoint's leaves
+func (c *Checkpoint) Covers(seq int64) bool {
+	return seq >= c.FromSeq && seq <= c.ThroughSeq
+}
+
+// SignedPayload is the exact text the signature covers, one field per line
+func (c *Checkpoint) SignedPayload() []byte {
+	return []byte(strings.Join([]string{
+		checkpointVersion,
+		c.ID,
+		strconv.FormatInt(c.FromSeq, 10),
+		strconv.FormatInt(c.ThroughSeq, 10),
+		c.Root,
+		c.ChainHash,
+		c.CreatedAt.UTC().Format(time.RFC3339Nano),
+		c.KeyID,
+	}, "\n"))
+}
+
+// VerifySignature checks the checkpoint against the published key
+func (c *Checkpoint) VerifySignature(pub ed25519.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(c.Signature)
+	if err != nil || c.KeyID != KeyID(pub) || !ed25519.Verify(pub, c.SignedPayload(), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// LeafData is what an entry contributes to a checkpoint's tree
+func LeafData(e *CarbonEntry) ([]byte, error) {
+	leaf, err := hex.DecodeString(e.Hash)
+	if err != nil || len(leaf) != sha256.Size {
+		return nil, fmt.Errorf("entry %s has a malformed hash", e.ID)
+	}
+	return leaf, nil
+}
+
+// InclusionProof shows that an entry is a leaf of a signed checkpoint. It
+// carries everything needed to check it without our database.
+type InclusionProof struct {
+	Entry      CarbonEntry `json:"entry"`
+	LeafIndex  int         `json:"leaf_index"` // Entry.Sequence - Checkpoint.FromSeq
+	TreeSize   int         `json:"tree_size"`
+	AuditPath  []string    `json:"audit_path"` // Hex sibling hashes, leaf to root
+	Checkpoint Checkpoint  `json:"checkpoint"`
+}
+
+// Verify recomputes the entry's hash from its fields, folds the audit path up
+// to the checkpoint root and checks the checkpoint signature
+func (p *InclusionProof) Verify(pub ed25519.PublicKey) error {
+	if p.Entry.Hash != p.Entry.ComputeHash() {
+		return fmt.Errorf("%w: entry content does not match its hash", ErrInvalidProof)
+	}
+	if !p.Checkpoint.Covers(p.Entry.Sequence) || p.LeafIndex != int(p.Entry.Sequence-p.Checkpoint.FromSeq) || p.TreeSize != p.Checkpoint.Size() {
+		return fmt.Errorf("%w: entry is not at the claimed position", ErrInvalidProof)
+	}
+	leaf, err := LeafData(&p.Entry)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	path := make([][]byte, len(p.AuditPath))
+	for i, h := range p.AuditPath {
+		if path[i], err = hex.DecodeString(h); err != nil {
+			return fmt.Errorf("%w: malformed audit path", ErrInvalidProof)
+		}
+	}
+	root, err := hex.DecodeString(p.Checkpoint.Root)
+	if err != nil || !merkle.Verify(leaf, p.LeafIndex, p.TreeSize, path, root) {
+		return fmt.Errorf("%w: audit path does not lead to the checkpoint root", ErrInvalidProof)
+	}
+	return p.Checkpoint.VerifySignature(pub)
+}
+
+// Signer holds the Ed25519 key that signs what the carbon ledger publishes
+type Signer struct {
+	key ed25519.PrivateKey
+	id  string
+}
+
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key, id: KeyID(key.Public().(ed25519.PublicKey))}
+}
+
+// ParseSigner reads a PKCS#8 PEM private key ("PRIVATE KEY"), as written by
+// `openssl genpkey -algorithm ed25519`
+func ParseSigner(pemBytes []byte) (*Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, ErrInvalidSigningKey
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSigningKey, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an Ed25519 key", ErrInvalidSigningKey)
+	}
+	return NewSigner(key), nil
+}
+
+func (s *Signer) KeyID() string { return s.id }
+
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// PublicKeyPEM is the key auditors verify against ("PUBLIC KEY", PKIX)
+func (s *Signer) PublicKeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(s.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// SignCheckpoint stamps the checkpoint with this key
+func (s *Signer) SignCheckpoint(c *Checkpoint) {
+	c.KeyID = s.id
+	c.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, c.SignedPayload()))
+}
+
+// ParsePublicKey reads a PKIX PEM public key as served by the API
+func ParsePublicKey(pemBytes []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, ErrInvalidSigningKey
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSigningKey, err)
+	}
+	pub, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an Ed25519 key", ErrInvalidSigningKey)
+	}
+	return pub, nil
+}
+
+// KeyID names a public key: the first 16 hex digits of its SHA-256
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
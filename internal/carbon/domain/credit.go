@@ -0,0 +1,228 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var (
+	ErrCreditAccountNotFound  = errors.New("no carbon credits issued to the provider yet")
+	ErrCreditTokenNotFound    = errors.New("carbon credit token not found")
+	ErrCreditTokenUnavailable = errors.New("carbon credit token is retired or held by someone else")
+	ErrInvalidCreditMove      = errors.New("invalid carbon credit transfer or retirement")
+	ErrCreditsConflict        = errors.New("carbon credits were issued to the provider concurrently")
+	ErrLedgerUnverified       = errors.New("carbon ledger failed verification, credit issuance is halted")
+)
+
+// CreditPolicy sets how checkpointed ledger savings become credit tokens.
+// Savings are counted in whole grams of CO2e so remainders carry forward
+// exactly from one issuance run to the next.
+type CreditPolicy struct {
+	GramsPerToken int64 // CO2e behind one token
+	MinTokens     int64 // Nothing is issued to a provider until it has earned this many
+}
+
+// DefaultCreditPolicy issues one token per 100 kg CO2e, as soon as it is earned
+func DefaultCreditPolicy() CreditPolicy {
+	return CreditPolicy{GramsPerToken: 100_000, MinTokens: 1}
+}
+
+func (p CreditPolicy) Validate() error {
+	if p.GramsPerToken <= 0 || p.MinTokens <= 0 {
+		return fmt.Errorf("credit policy needs a positive token size and minimum, got %d g and %d", p.GramsPerToken, p.MinTokens)
+	}
+	return nil
+}
+
+// Tokens is how many whole tokens kg of CO2e is worth
+func (p CreditPolicy) Tokens(kgCO2e float64) int64 {
+	return Grams(kgCO2e) / p.GramsPerToken
+}
+
+// Grams rounds kg to whole grams, the unit credits are accounted in
+func Grams(kg float64) int64 {
+	return int64(math.Round(kg * 1000))
+}
+
+type CreditTokenStatus string
+
+const (
+	CreditActive  CreditTokenStatus = "ACTIVE"
+	CreditRetired CreditTokenStatus = "RETIRED"
+)
+
+// CreditBacking is the part of one ledger entry's savings inside a token
+type CreditBacking struct {
+	EntryID  string `json:"entry_id"`
+	Sequence int64  `json:"seq"`
+	Grams    int64  `json:"co2e_grams"`
+}
+
+// CreditToken is one carbon credit. Its backing adds up to its size, and no
+// gram of a ledger entry backs more than one token.
+type CreditToken struct {
+	ID         string            `json:"id"`
+	ProviderID string            `json:"provider_id"` // Issued to
+	OwnerID    string            `json:"owner_id"`    // Holds it now
+	Status     CreditTokenStatus `json:"status"`
+	Grams      int64             `json:"co2e_grams"`
+	Backing    []CreditBacking   `json:"backing,omitempty"`
+	IssuedAt   time.Time         `json:"issued_at"`
+	RetiredAt  *time.Time        `json:"retired_at,omitempty"`
+}
+
+// CreditAccount is how far a provider's ledger savings have been converted
+// into tokens. Entries before NextSeq are spent; NextOffset grams of the
+// entry at NextSeq are too. The rest, up to IssuedThroughSeq, is CarryGrams.
+type CreditAccount struct {
+	ProviderID       string     `json:"provider_id"`
+	IssuedThroughSeq int64      `json:"issued_through_seq"` // Ledger entries counted so far
+	NextSeq          int64      `json:"next_seq"`
+	NextOffset       int64      `json:"next_offset_grams"`
+	CarryGrams       int64      `json:"carry_co2e_grams"` // Counted, short of a whole token
+	TokensIssued     int64      `json:"tokens_issued"`
+	CreditedGrams    int64      `json:"credited_co2e_grams"` // Behind the tokens issued
+	LastIssuedAt     *time.Time `json:"last_issued_at,omitempty"`
+}
+
+// Mint turns the carry plus the provider's entries through throughSeq into
+// whole tokens. entries are the provider's from NextSeq on, in ledger order.
+// The remainder carries forward; below MinTokens everything does.
+func (a CreditAccount) Mint(entries []CarbonEntry, throughSeq int64, p CreditPolicy, now time.Time, newID func() string) (CreditAccount, []CreditToken) {
+	type pending struct {
+		entry     *CarbonEntry
+		remaining int64
+	}
+	var pool []pending
+	var total int64
+	for i := range entries {
+		e := &entries[i]
+		grams := Grams(e.CarbonSavedKg)
+		if e.Sequence == a.NextSeq {
+			grams -= a.NextOffset
+		}
+		if e.Sequence < a.NextSeq || e.Sequence > throughSeq || grams <= 0 {
+			continue
+		}
+		pool = append(pool, pending{entry: e, remaining: grams})
+		total += grams
+	}
+
+	a.IssuedThroughSeq = throughSeq
+	a.CarryGrams = total
+	if len(pool) > 0 && a.NextSeq < pool[0].entry.Sequence {
+		a.NextSeq, a.NextOffset = pool[0].entry.Sequence, 0
+	}
+	count := total / p.GramsPerToken
+	if count < p.MinTokens {
+		return a, nil
+	}
+
+	tokens := make([]CreditToken, 0, count)
+	next := 0
+	for range count {
+		t := CreditToken{ID: newID(), ProviderID: a.ProviderID, OwnerID: a.ProviderID, Status: CreditActive, Grams: p.GramsPerToken, IssuedAt: now}
+		for need := p.GramsPerToken; need > 0; {
+			take := min(need, pool[next].remaining)
+			t.Backing = append(t.Backing, CreditBacking{EntryID: pool[next].entry.ID, Sequence: pool[next].entry.Sequence, Grams: take})
+			pool[next].remaining -= take
+			need -= take
+			if pool[next].remaining == 0 {
+				next++
+			}
+		}
+		tokens = append(tokens, t)
+	}
+
+	if next < len(pool) {
+		e := pool[next].entry
+		a.NextSeq, a.NextOffset = e.Sequence, Grams(e.CarbonSavedKg)-pool[next].remaining
+	} else {
+		a.NextSeq, a.NextOffset = throughSeq+1, 0
+	}
+	a.CarryGrams = total - count*p.GramsPerToken
+	a.TokensIssued += count
+	a.CreditedGrams += count * p.GramsPerToken
+	a.LastIssuedAt = &now
+	return a, tokens
+}
+
+type CreditEventType string
+
+const (
+	CreditEventIssued      CreditEventType = "ISSUED"
+	CreditEventTransferred CreditEventType = "TRANSFERRED"
+	CreditEventRetired     CreditEventType = "RETIRED"
+)
+
+// CreditEvent is one step in a token's history, which is never rewritten
+type CreditEvent struct {
+	ID          string          `json:"id"`
+	TokenID     string          `json:"token_id"`
+	Type        CreditEventType `json:"type"`
+	FromOwner   string          `json:"from_owner,omitempty"`
+	ToOwner     string          `json:"to_owner,omitempty"`
+	Beneficiary string          `json:"beneficiary,omitempty"` // Whose emissions a retirement offsets
+	Note        string          `json:"note,omitempty"`
+	Actor       string          `json:"actor"`
+	At          time.Time       `json:"at"`
+}
+
+// CreditTransfer hands active tokens from one holder to another
+type CreditTransfer struct {
+	From          string   `json:"from"`
+	To            string   `json:"to"`
+	TokenIDs      []string `json:"token_ids"`
+	Note          string   `json:"note"`
+	TransferredBy string   `json:"-"` // The authenticated caller, never the request body
+}
+
+func (t *CreditTransfer) Validate() error {
+	switch {
+	case t.From == "" || t.To == "":
+		return fmt.Errorf("%w: from and to are required", ErrInvalidCreditMove)
+	case t.From == t.To:
+		return fmt.Errorf("%w: from and to are the same holder", ErrInvalidCreditMove)
+	case t.TransferredBy == "":
+		return fmt.Errorf("%w: the transfer needs an acting user", ErrInvalidCreditMove)
+	}
+	return validTokenIDs(t.TokenIDs)
+}
+
+// CreditRetirement claims active tokens against a beneficiary's emissions;
+// a retired token can never be transferred or retired again
+type CreditRetirement struct {
+	Owner       string   `json:"owner"`
+	TokenIDs    []string `json:"token_ids"`
+	Beneficiary string   `json:"beneficiary"`
+	Reason      string   `json:"reason"`
+	RetiredBy   string   `json:"-"` // The authenticated caller, never the request body
+}
+
+func (r *CreditRetirement) Validate() error {
+	switch {
+	case r.Owner == "":
+		return fmt.Errorf("%w: owner is required", ErrInvalidCreditMove)
+	case r.Beneficiary == "":
+		return fmt.Errorf("%w: beneficiary is required", ErrInvalidCreditMove)
+	case r.RetiredBy == "":
+		return fmt.Errorf("%w: the retirement needs an acting user", ErrInvalidCreditMove)
+	}
+	return validTokenIDs(r.TokenIDs)
+}
+
+func validTokenIDs(ids []string) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("%w: token_ids is empty", ErrInvalidCreditMove)
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			return fmt.Errorf("%w: token_ids must be distinct", ErrInvalidCreditMove)
+		}
+		seen[id] = true
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	ErrFactorVersionNotFound = errors.New("emission factor version not found")
+	ErrFactorVersionExists   = errors.New("emission factor version already exists")
+	ErrInvalidFactorVersion  = errors.New("invalid emission factor version")
+	ErrNoEmissionFactor      = errors.New("no emission factor applies")
+)
+
+// FallbackCategory is the factor used for categories a version does not list
+const FallbackCategory = "MIXED"
+
+// EmissionFactor is the kgCO2e avoided per kg of rescued food in a category.
+// A factor with a region overrides the national one there.
+type EmissionFactor struct {
+	Category    string  `json:"category"`
+	Region      string  `json:"region,omitempty"` // e.g. "ID-JK"; empty for the national figure
+	KgCO2ePerKg float64 `json:"kg_co2e_per_kg"`
+	Source      string  `json:"source"` // Study or dataset the figure comes from
+}
+
+// FactorVersion is one methodology: a complete set of factors that applies to
+// savings recorded from EffectiveFrom until a later version takes over.
+// Published versions are never edited; a correction is a new version.
+type FactorVersion struct {
+	Version       string           `json:"version"` // e.g. "2025.1"
+	EffectiveFrom time.Time        `json:"effective_from"`
+	Description   string           `json:"description,omitempty"`
+	Factors       []EmissionFactor `json:"factors"`
+	CreatedBy     string           `json:"created_by"`
+	CreatedAt     time.Time        `json:"created_at"`
+}
+
+// Validate checks that the version can price every category: factors are
+// positive and sourced, unique per category and region, and there is a
+// national fallback
+func (v *FactorVersion) Validate() error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidFactorVersion, fmt.Sprintf(format, args...))
+	}
+	if v.Version == "" || len(v.Version) > 32 {
+		return invalid("version is required, up to 32 characters")
+	}
+	if v.CreatedBy == "" {
+		return invalid("created_by is required")
+	}
+
+	seen := make(map[[2]string]bool, len(v.Factors))
+	for _, f := range v.Factors {
+		key := [2]string{f.Category, f.Region}
+		switch {
+		case f.Category == "":
+			return invalid("every factor needs a category")
+		case f.KgCO2ePerKg <= 0:
+			return invalid("%s factor must be positive", f.Category)
+		case f.Source == "":
+			return invalid("%s factor needs a source", f.Category)
+		case seen[key]:
+			return invalid("%s is listed twice for region %q", f.Category, f.Region)
+		}
+		seen[key] = true
+	}
+	if !seen[[2]string{FallbackCategory, ""}] {
+		return invalid("a national %s factor is required as the fallback", FallbackCategory)
+	}
+	return nil
+}
+
+// Factor picks the factor for a category in a region: the regional override,
+// then the national figure, then the version's fallback
+func (v *FactorVersion) Factor(category, region string) (EmissionFactor, error) {
+	var national, fallback *EmissionFactor
+	for i, f := range v.Factors {
+		switch {
+		case f.Category == category && f.Region == region:
+			return f, nil
+		case f.Category == category && f.Region == "":
+			national = &v.Factors[i]
+		case f.Category == FallbackCategory && f.Region == "":
+			fallback = &v.Factors[i]
+		}
+	}
+	switch {
+	case national != nil:
+		return *national, nil
+	case fallback != nil:
+		return *fallback, nil
+	}
+	return EmissionFactor{}, fmt.Errorf("%w: %s in version %s", ErrNoEmissionFactor, category, v.Version)
+}
+
+// Restatement recomputes a vendor's savings over a period under another
+// factor version. The ledger keeps what was recorded; this only reports it
+// next to what the other methodology gives.
+type Restatement struct {
+	VendorID              string             `json:"vendor_id"`
+	PeriodStart           time.Time          `json:"period_start"` // Inclusive
+	PeriodEnd             time.Time          `json:"period_end"`   // Exclusive
+	Version               string             `json:"version"`
+	RecordedVersions      []string           `json:"recorded_versions"` // Versions the entries were recorded under
+	TransactionCount      int                `json:"transaction_count"`
+	TotalFoodSavedKg      float64            `json:"total_food_saved_kg"`
+	RecordedCarbonSavedKg float64            `json:"recorded_carbon_saved_kg"`
+	RestatedCarbonSavedKg float64            `json:"restated_carbon_saved_kg"`
+	Categories            []RestatedCategory `json:"categories"`
+	GeneratedAt           time.Time          `json:"generated_at"`
+}
+
+// RestatedCategory is one category's share of a restatement
+type RestatedCategory struct {
+	Category              string  `json:"category"`
+	FoodSavedKg           float64 `json:"food_saved_kg"`
+	RecordedCarbonSavedKg float64 `json:"recorded_carbon_saved_kg"`
+	RestatedCarbonSavedKg float64 `json:"restated_carbon_saved_kg"`
+}
+
+// Restate prices the entries under version v
+func Restate(vendorID string, start, end time.Time, v *FactorVersion, entries []CarbonEntry) (*Restatement, error) {
+	r := &Restatement{VendorID: vendorID, PeriodStart: start.UTC(), PeriodEnd: end.UTC(), Version: v.Version, GeneratedAt: time.Now()}
+	categories := make(map[string]*RestatedCategory)
+	recorded := make(map[string]bool)
+	for _, e := range entries {
+		f, err := v.Factor(e.FoodCategory, e.Region)
+		if err != nil {
+			return nil, err
+		}
+		restated := e.WeightKg * f.KgCO2ePerKg
+
+		c, ok := categories[e.FoodCategory]
+		if !ok {
+			c = &RestatedCategory{Category: e.FoodCategory}
+			categories[e.FoodCategory] = c
+		}
+		c.FoodSavedKg += e.WeightKg
+		c.RecordedCarbonSavedKg += e.CarbonSavedKg
+		c.RestatedCarbonSavedKg += restated
+
+		r.TotalFoodSavedKg += e.WeightKg
+		r.RecordedCarbonSavedKg += e.CarbonSavedKg
+		r.RestatedCarbonSavedKg += restated
+		r.TransactionCount++
+		if !recorded[e.FactorVersion] {
+			recorded[e.FactorVersion] = true
+			r.RecordedVersions = append(r.RecordedVersions, e.FactorVersion)
+		}
+	}
+	for _, c := range categories {
+		r.Categories = append(r.Categories, *c)
+	}
+	sort.Slice(r.Categories, func(i, j int) bool { return r.Categories[i].Category < r.Categories[j].Category })
+	sort.Strings(r.RecordedVersions)
+	return r, nil
+}
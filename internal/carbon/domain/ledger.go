@@ -3,65 +3,106 @@ package domain
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 )
 
-// ImpactFactor defines emission savings per kg by category (kgCO2e/kgFood)
-type ImpactFactor float64
-
-const (
-	FactorMeat    ImpactFactor = 27.0 // High impact
-	FactorDairy   ImpactFactor = 12.0
-	FactorProduce ImpactFactor = 2.5
-	FactorBread   ImpactFactor = 1.2
-	FactorMixed   ImpactFactor = 3.5 // Default average
+var (
+	ErrEntryNotFound        = errors.New("carbon ledger entry not found")
+	ErrVerificationNotFound = errors.New("carbon ledger has not been verified yet")
 )
 
+// GenesisHash is the PreviousHash of the first entry in the ledger
+const GenesisHash = "0000000000000000"
+
 // CarbonEntry represents an immutable record of emission savings
 type CarbonEntry struct {
 	ID            string    `json:"id"`
+	Sequence      int64     `json:"seq"` // Position in the chain, from 1 with no gaps
 	VendorID      string    `json:"vendor_id"`
 	OrderID       string    `json:"order_id"`
 	FoodCategory  string    `json:"category"`
+	Region        string    `json:"region,omitempty"`
 	WeightKg      float64   `json:"weight_kg"`
+	FactorVersion string    `json:"factor_version"`  // Methodology the savings were computed under
+	FactorKgCO2e  float64   `json:"emission_factor"` // kgCO2e per kg applied
 	CarbonSavedKg float64   `json:"carbon_saved_kg"`
 	Timestamp     time.Time `json:"timestamp"`
 	PreviousHash  string    `json:"prev_hash"` // Blockchain Link
 	Hash          string    `json:"hash"`      // Current Hash
 }
 
-// ESGReport represents a formal certificate for corporate partners
-type ESGReport struct {
-	VendorID         string    `json:"vendor_id"`
-	PeriodStart      time.Time `json:"period_start"`
-	PeriodEnd        time.Time `json:"period_end"`
-	TotalFoodSaved   float64   `json:"total_food_saved_kg"`
-	TotalCarbonSaved float64   `json:"total_carbon_saved_kg"`
-	TransactionCount int       `json:"transaction_count"`
-	VerificationHash string    `json:"verification_hash"` // Digital Signature
+// ChainTip is the last link of the chain: where the next entry attaches
+type ChainTip struct {
+	Sequence int64  `json:"seq"`
+	Hash     string `json:"hash"`
 }
 
-// ComputeHash generates a SHA-256 hash for the entry to ensure integrity
+// Genesis is the tip of an empty ledger
+var Genesis = ChainTip{Sequence: 0, Hash: GenesisHash}
+
+// ComputeHash generates a SHA-256 hash for the entry to ensure integrity.
+// Every field is written in a form that survives a database round trip:
+// floats in full, the timestamp in UTC at microsecond precision.
 func (e *CarbonEntry) ComputeHash() string {
-	data := fmt.Sprintf("%s|%s|%s|%.2f|%.2f|%s|%s",
-		e.ID, e.VendorID, e.OrderID, e.WeightKg, e.CarbonSavedKg, e.Timestamp, e.PreviousHash)
+	data := fmt.Sprintf("%d|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s",
+		e.Sequence, e.ID, e.VendorID, e.OrderID, e.FoodCategory, e.Region,
+		strconv.FormatFloat(e.WeightKg, 'g', -1, 64),
+		e.FactorVersion,
+		strconv.FormatFloat(e.FactorKgCO2e, 'g', -1, 64),
+		strconv.FormatFloat(e.CarbonSavedKg, 'g', -1, 64),
+		e.Timestamp.UTC().Format(time.RFC3339Nano), e.PreviousHash)
 	hash := sha256.Sum256([]byte(data))
 	return hex.EncodeToString(hash[:])
 }
 
-// CalculateSavings computes CO2e based on category
-func CalculateSavings(weight float64, category string) float64 {
-	factor := FactorMixed
-	switch category {
-	case "MEAT":
-		factor = FactorMeat
-	case "DAIRY":
-		factor = FactorDairy
-	case "PRODUCE":
-		factor = FactorProduce
-	case "BREAD":
-		factor = FactorBread
+// Link attaches the entry after the tip and seals it with its hash
+func (e *CarbonEntry) Link(tip ChainTip) {
+	e.Sequence = tip.Sequence + 1
+	e.PreviousHash = tip.Hash
+	e.Timestamp = e.Timestamp.UTC().Truncate(time.Microsecond) // What Postgres keeps
+	e.Hash = e.ComputeHash()
+}
+
+// Tip is the chain as it stands after this entry
+func (e *CarbonEntry) Tip() ChainTip {
+	return ChainTip{Sequence: e.Sequence, Hash: e.Hash}
+}
+
+// ChainBreak is the first link that does not hold
+type ChainBreak struct {
+	Sequence int64  `json:"seq"`
+	EntryID  string `json:"entry_id,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// ChainVerification is one walk over the ledger. A clean walk ends at the
+// current tip; a broken one ends at the last link that held.
+type ChainVerification struct {
+	ID      string      `json:"id"`
+	From    ChainTip    `json:"from"`    // Trusted starting point
+	Through ChainTip    `json:"through"` // Last entry that verified
+	Checked int         `json:"checked"` // Entries walked
+	Broken  *ChainBreak `json:"broken,omitempty"`
+	Intact  bool        `json:"intact"`
+	RunAt   time.Time   `json:"run_at"`
+}
+
+// Check verifies that the entry follows prev and still hashes to its stored
+// hash; nil when the link holds
+func (e *CarbonEntry) Check(prev ChainTip) *ChainBreak {
+	broken := func(reason string) *ChainBreak {
+		return &ChainBreak{Sequence: e.Sequence, EntryID: e.ID, Reason: reason}
+	}
+	switch {
+	case e.Sequence != prev.Sequence+1:
+		return &ChainBreak{Sequence: prev.Sequence + 1, Reason: fmt.Sprintf("entry missing: next entry is seq %d", e.Sequence)}
+	case e.PreviousHash != prev.Hash:
+		return broken("prev_hash does not match the hash of the entry before it")
+	case e.Hash != e.ComputeHash():
+		return broken("entry content does not match its hash")
 	}
-	return weight * float64(factor)
+	return nil
 }
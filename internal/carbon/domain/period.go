@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidPeriod = errors.New("invalid reporting period")
+
+// Period is a reporting window in UTC: [Start, End)
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Label string    `json:"label"` // "2025", "2025-Q1", "2025-03" or "2025-01-01/2025-02-14"
+}
+
+func YearlyPeriod(year int) Period {
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	return Period{Start: start, End: start.AddDate(1, 0, 0), Label: fmt.Sprintf("%04d", year)}
+}
+
+func QuarterlyPeriod(year, quarter int) (Period, error) {
+	if quarter < 1 || quarter > 4 {
+		return Period{}, fmt.Errorf("%w: quarter must be 1 to 4", ErrInvalidPeriod)
+	}
+	start := time.Date(year, time.Month(3*quarter-2), 1, 0, 0, 0, 0, time.UTC)
+	return Period{Start: start, End: start.AddDate(0, 3, 0), Label: fmt.Sprintf("%04d-Q%d", year, quarter)}, nil
+}
+
+func MonthlyPeriod(year int, month time.Month) (Period, error) {
+	if month < time.January || month > time.December {
+		return Period{}, fmt.Errorf("%w: month must be 1 to 12", ErrInvalidPeriod)
+	}
+	start := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	return Period{Start: start, End: start.AddDate(0, 1, 0), Label: start.Format("2006-01")}, nil
+}
+
+// CustomPeriod covers whole days from first through last, both included
+func CustomPeriod(first, last time.Time) (Period, error) {
+	start := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.UTC)
+	lastDay := time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, time.UTC)
+	if lastDay.Before(start) {
+		return Period{}, fmt.Errorf("%w: the period ends before it starts", ErrInvalidPeriod)
+	}
+	return Period{
+		Start: start,
+		End:   lastDay.AddDate(0, 0, 1),
+		Label: start.Format(time.DateOnly) + "/" + lastDay.Format(time.DateOnly),
+	}, nil
+}
+
+// LastDay is the final day the period covers
+func (p Period) LastDay() time.Time {
+	return p.End.Add(-time.Nanosecond)
+}
@@ -0,0 +1,40 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+)
+
+var csvHeader = []string{
+	"certificate_id", "subject", "period", "seq", "entry_id", "vendor_id", "order_id", "timestamp",
+	"category", "region", "weight_kg", "factor_version", "emission_factor", "carbon_saved_kg",
+	"entry_hash", "checkpoint_id", "key_id", "signature", "verification_url",
+}
+
+// CSV writes one line per ledger entry. The certificate, its signature and
+// verification URL repeat on every line so each row stands on its own once
+// loaded into a spreadsheet or warehouse.
+func CSV(w io.Writer, c *domain.Certificate, verifyURL string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, ce := range c.Entries {
+		e := ce.Entry
+		if err := cw.Write([]string{
+			c.ID, c.Subject(), c.PeriodLabel,
+			strconv.FormatInt(e.Sequence, 10), e.ID, e.VendorID, e.OrderID,
+			e.Timestamp.UTC().Format(time.RFC3339Nano),
+			e.FoodCategory, e.Region, kg(e.WeightKg), e.FactorVersion, kg(e.FactorKgCO2e), kg(e.CarbonSavedKg),
+			e.Hash, ce.CheckpointID, c.KeyID, c.Signature, verifyURL,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
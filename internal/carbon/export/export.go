@@ -0,0 +1,110 @@
+// Package export renders signed ESG certificates in the formats corporate
+// sustainability teams ingest: CSV line items, a schema.org JSON-LD summary
+// and a printable PDF. Every format carries the certificate signature and the
+// URL it can be verified at; the certificate JSON stays the authoritative,
+// offline-verifiable artefact.
+package export
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatJSONLD Format = "jsonld"
+	FormatPDF    Format = "pdf"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatCSV, FormatJSONLD, FormatPDF:
+		return f, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSONLD:
+		return "application/ld+json"
+	default:
+		return "application/pdf"
+	}
+}
+
+// Filename is what a download of the certificate in this format is called
+func (f Format) Filename(c *domain.Certificate) string {
+	return "esg-certificate-" + c.ID + "." + string(f)
+}
+
+// Write renders the certificate in the format
+func Write(w io.Writer, f Format, c *domain.Certificate, verifyURL string) error {
+	switch f {
+	case FormatCSV:
+		return CSV(w, c, verifyURL)
+	case FormatJSONLD:
+		return JSONLD(w, c, verifyURL)
+	case FormatPDF:
+		return PDF(w, c, verifyURL)
+	}
+	return ErrUnknownFormat
+}
+
+// CategoryTotals is one food category's share of a certificate
+type CategoryTotals struct {
+	Category         string
+	TransactionCount int
+	FoodSavedKg      float64
+	CarbonSavedKg    float64
+}
+
+// Categories breaks the certificate's totals down by food category
+func Categories(c *domain.Certificate) []CategoryTotals {
+	byCategory := make(map[string]*CategoryTotals)
+	for _, ce := range c.Entries {
+		t, ok := byCategory[ce.Entry.FoodCategory]
+		if !ok {
+			t = &CategoryTotals{Category: ce.Entry.FoodCategory}
+			byCategory[ce.Entry.FoodCategory] = t
+		}
+		t.TransactionCount++
+		t.FoodSavedKg += ce.Entry.WeightKg
+		t.CarbonSavedKg += ce.Entry.CarbonSavedKg
+	}
+	out := make([]CategoryTotals, 0, len(byCategory))
+	for _, t := range byCategory {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Category < out[j].Category })
+	return out
+}
+
+// factorVersions lists the emission factor versions behind the certificate
+func factorVersions(c *domain.Certificate) []string {
+	seen := make(map[string]bool)
+	var versions []string
+	for _, ce := range c.Entries {
+		if v := ce.Entry.FactorVersion; !seen[v] {
+			seen[v] = true
+			versions = append(versions, v)
+		}
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// kg writes a quantity exactly, as the certificate holds it
+func kg(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,117 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+)
+
+const testVerifyURL = "https://pangan.example/api/v1/carbon/certificates/c-1/verify"
+
+func testCertificate() *domain.Certificate {
+	issued := time.Date(2025, 4, 2, 9, 0, 0, 0, time.UTC)
+	period, _ := domain.QuarterlyPeriod(2025, 1)
+	c := &domain.Certificate{
+		ID:          "c-1",
+		ChainID:     "chain-1",
+		ChainName:   "Warung Nusantara",
+		PeriodStart: period.Start,
+		PeriodEnd:   period.End,
+		PeriodLabel: period.Label,
+		Checkpoints: []domain.Checkpoint{{ID: "cp-1", FromSeq: 1, ThroughSeq: 3, Root: strings.Repeat("ab", 32)}},
+		IssuedAt:    issued,
+		KeyID:       "k-1",
+		Signature:   "c2lnbmF0dXJl",
+	}
+	for i, e := range []struct {
+		vendor, category string
+		kg, factor       float64
+	}{{"warung-menteng", "MEAT", 2, 5}, {"warung-kemang", "VEGETABLES", 4, 0.5}, {"warung-menteng", "VEGETABLES", 1.5, 0.5}} {
+		c.Entries = append(c.Entries, domain.CertifiedEntry{
+			Entry: domain.CarbonEntry{
+				ID: "e", Sequence: int64(i + 1), VendorID: e.vendor, OrderID: "o", FoodCategory: e.category,
+				WeightKg: e.kg, FactorVersion: "2024.1", FactorKgCO2e: e.factor, CarbonSavedKg: e.kg * e.factor,
+				Timestamp: period.Start.AddDate(0, 1, i), Hash: "h",
+			},
+			CheckpointID: "cp-1",
+		})
+		c.TransactionCount++
+		c.TotalFoodSavedKg += e.kg
+		c.TotalCarbonSavedKg += e.kg * e.factor
+	}
+	c.Outlets = []domain.OutletTotals{
+		{VendorID: "warung-kemang", TransactionCount: 1, FoodSavedKg: 4, CarbonSavedKg: 2},
+		{VendorID: "warung-menteng", TransactionCount: 2, FoodSavedKg: 3.5, CarbonSavedKg: 10.75},
+	}
+	return c
+}
+
+func TestExports_CarrySignatureAndVerificationURL(t *testing.T) {
+	c := testCertificate()
+
+	if _, err := ParseFormat("xlsx"); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("expected xlsx rejected, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatCSV, c, testVerifyURL); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	if len(rows) != 1+len(c.Entries) {
+		t.Fatalf("expected a header and %d line items, got %d rows", len(c.Entries), len(rows))
+	}
+	for _, row := range rows[1:] {
+		if row[2] != "2025-Q1" || row[len(row)-2] != c.Signature || row[len(row)-1] != testVerifyURL {
+			t.Fatalf("expected every line to carry the period, signature and URL, got %v", row)
+		}
+	}
+
+	buf.Reset()
+	if err := Write(&buf, FormatJSONLD, c, testVerifyURL); err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("json-ld: %v", err)
+	}
+	if doc["@context"] != "https://schema.org" || doc["url"] != testVerifyURL {
+		t.Fatalf("unexpected json-ld document: %v", doc)
+	}
+	if outlets := doc["about"].(map[string]any)["subOrganization"].([]any); len(outlets) != 2 {
+		t.Fatalf("expected both outlets in the rollup, got %v", outlets)
+	}
+	if !strings.Contains(buf.String(), c.Signature) {
+		t.Fatal("expected the signature in the json-ld summary")
+	}
+
+	buf.Reset()
+	if err := Write(&buf, FormatPDF, c, testVerifyURL); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) || !bytes.Contains(buf.Bytes(), []byte(testVerifyURL)) {
+		t.Fatal("expected a PDF linking to the verification URL")
+	}
+	first := buf.String()
+	buf.Reset()
+	_ = Write(&buf, FormatPDF, c, testVerifyURL)
+	if buf.String() != first {
+		t.Fatal("expected the same certificate to render the same PDF")
+	}
+}
+
+func TestCategories_SplitTotalsByFoodCategory(t *testing.T) {
+	got := Categories(testCertificate())
+	if len(got) != 2 || got[0].Category != "MEAT" || got[1].TransactionCount != 2 || got[1].FoodSavedKg != 5.5 {
+		t.Fatalf("unexpected breakdown: %+v", got)
+	}
+}
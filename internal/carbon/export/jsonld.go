@@ -0,0 +1,95 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+)
+
+// schema.org vocabulary only, so generic JSON-LD tooling understands it;
+// figures the vocabulary has no term for are PropertyValues
+type jsonLD map[string]any
+
+func quantity(id string, value float64, unit string) jsonLD {
+	return jsonLD{"@type": "PropertyValue", "propertyID": id, "value": value, "unitText": unit}
+}
+
+func property(id string, value any) jsonLD {
+	return jsonLD{"@type": "PropertyValue", "propertyID": id, "value": value}
+}
+
+// JSONLD writes a machine-readable summary of the certificate: subject,
+// period, totals, breakdowns, the checkpoints it rests on and its signature
+func JSONLD(w io.Writer, c *domain.Certificate, verifyURL string) error {
+	about := jsonLD{"@type": "Organization", "identifier": c.VendorID}
+	if c.ChainID != "" {
+		var outlets []jsonLD
+		for _, o := range c.Outlets {
+			outlets = append(outlets, jsonLD{
+				"@type":      "Organization",
+				"identifier": o.VendorID,
+				"additionalProperty": []jsonLD{
+					property("transactionCount", o.TransactionCount),
+					quantity("foodSaved", o.FoodSavedKg, "kg"),
+					quantity("carbonSaved", o.CarbonSavedKg, "kg CO2e"),
+				},
+			})
+		}
+		about = jsonLD{"@type": "Organization", "identifier": c.ChainID, "name": c.ChainName, "subOrganization": outlets}
+	}
+
+	var categories []jsonLD
+	for _, t := range Categories(c) {
+		categories = append(categories, jsonLD{
+			"@type":      "PropertyValue",
+			"propertyID": "category",
+			"value":      t.Category,
+			"valueReference": []jsonLD{
+				property("transactionCount", t.TransactionCount),
+				quantity("foodSaved", t.FoodSavedKg, "kg"),
+				quantity("carbonSaved", t.CarbonSavedKg, "kg CO2e"),
+			},
+		})
+	}
+	var checkpoints []jsonLD
+	for _, cp := range c.Checkpoints {
+		checkpoints = append(checkpoints, jsonLD{
+			"@type":      "PropertyValue",
+			"propertyID": "merkleCheckpoint",
+			"identifier": cp.ID,
+			"value":      cp.Root,
+			"minValue":   cp.FromSeq,
+			"maxValue":   cp.ThroughSeq,
+		})
+	}
+
+	doc := jsonLD{
+		"@context":         "https://schema.org",
+		"@type":            "Report",
+		"@id":              "urn:uuid:" + c.ID,
+		"identifier":       c.ID,
+		"name":             "ESG carbon savings certificate " + c.PeriodLabel,
+		"about":            about,
+		"temporalCoverage": c.PeriodStart.UTC().Format(time.RFC3339) + "/" + c.PeriodEnd.UTC().Format(time.RFC3339),
+		"dateCreated":      c.IssuedAt.UTC().Format(time.RFC3339Nano),
+		"url":              verifyURL,
+		"additionalProperty": []jsonLD{
+			property("transactionCount", c.TransactionCount),
+			quantity("totalFoodSaved", c.TotalFoodSavedKg, "kg"),
+			quantity("totalCarbonSaved", c.TotalCarbonSavedKg, "kg CO2e"),
+			property("emissionFactorVersions", factorVersions(c)),
+			property("categoryBreakdown", categories),
+			property("checkpoints", checkpoints),
+			property("signatureAlgorithm", "Ed25519"),
+			property("signingKeyId", c.KeyID),
+			property("signature", c.Signature),
+			property("verificationUrl", verifyURL),
+		},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
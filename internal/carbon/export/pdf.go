@@ -0,0 +1,152 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+)
+
+// maxPDFLineItems keeps the printable version printable; the CSV export and
+// the certificate JSON always carry every entry
+const maxPDFLineItems = 500
+
+// PDF renders a printable certificate: totals, breakdowns by outlet and
+// category, the checkpoints it rests on, its signature and where to verify it
+func PDF(w io.Writer, c *domain.Certificate, verifyURL string) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetCatalogSort(true) // Same certificate, same bytes
+	pdf.SetTitle("ESG carbon savings certificate "+c.ID, true)
+	pdf.SetAuthor("Pahlawan Pangan", true)
+	pdf.SetCreationDate(c.IssuedAt)
+	pdf.SetModificationDate(c.IssuedAt)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "", 7)
+		pdf.SetTextColor(120, 120, 120)
+		pdf.CellFormat(0, 4, fmt.Sprintf("Certificate %s - page %d of {nb}", c.ID, pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.AddPage()
+
+	heading := func(text string) {
+		pdf.Ln(4)
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.SetTextColor(20, 90, 50)
+		pdf.CellFormat(0, 7, text, "B", 1, "L", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+		pdf.Ln(1)
+	}
+	field := func(label, value string) {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(45, 5.5, label, "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.MultiCell(0, 5.5, tr(value), "", "L", false)
+	}
+	table := func(widths []float64, header []string, rows [][]string) {
+		pdf.SetFont("Helvetica", "B", 8)
+		pdf.SetFillColor(230, 240, 233)
+		for i, h := range header {
+			pdf.CellFormat(widths[i], 6, h, "1", 0, "C", true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 8)
+		for _, row := range rows {
+			for i, cell := range row {
+				align := "R"
+				if i == 0 {
+					align = "L"
+				}
+				pdf.CellFormat(widths[i], 5.5, tr(cell), "1", 0, align, false, 0, "")
+			}
+			pdf.Ln(-1)
+		}
+	}
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.SetTextColor(20, 90, 50)
+	pdf.CellFormat(0, 10, "ESG Carbon Savings Certificate", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.SetTextColor(80, 80, 80)
+	pdf.CellFormat(0, 6, tr(c.Subject()+" - "+c.PeriodLabel), "", 1, "L", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+
+	heading("Summary")
+	if c.ChainID != "" {
+		field("Chain", c.ChainName+" ("+c.ChainID+")")
+		field("Outlets", fmt.Sprintf("%d", len(c.Outlets)))
+	} else {
+		field("Vendor", c.VendorID)
+	}
+	field("Period", c.PeriodStart.Format(time.DateOnly)+" to "+c.PeriodEnd.Add(-time.Nanosecond).Format(time.DateOnly))
+	field("Food rescued", fmt.Sprintf("%.2f kg", c.TotalFoodSavedKg))
+	field("CO2e avoided", fmt.Sprintf("%.2f kg", c.TotalCarbonSavedKg))
+	field("Transactions", fmt.Sprintf("%d", c.TransactionCount))
+	field("Emission factors", strings.Join(factorVersions(c), ", "))
+	field("Issued", c.IssuedAt.UTC().Format("2006-01-02 15:04:05 MST"))
+
+	if len(c.Outlets) > 0 {
+		heading("By outlet")
+		var rows [][]string
+		for _, o := range c.Outlets {
+			rows = append(rows, []string{o.VendorID, fmt.Sprintf("%d", o.TransactionCount), fmt.Sprintf("%.2f", o.FoodSavedKg), fmt.Sprintf("%.2f", o.CarbonSavedKg)})
+		}
+		table([]float64{85, 30, 35, 40}, []string{"Outlet", "Transactions", "Food kg", "CO2e kg"}, rows)
+	}
+
+	heading("By category")
+	var rows [][]string
+	for _, t := range Categories(c) {
+		rows = append(rows, []string{t.Category, fmt.Sprintf("%d", t.TransactionCount), fmt.Sprintf("%.2f", t.FoodSavedKg), fmt.Sprintf("%.2f", t.CarbonSavedKg)})
+	}
+	table([]float64{85, 30, 35, 40}, []string{"Category", "Transactions", "Food kg", "CO2e kg"}, rows)
+
+	heading("Ledger anchoring")
+	rows = nil
+	for _, cp := range c.Checkpoints {
+		rows = append(rows, []string{cp.ID, fmt.Sprintf("%d-%d", cp.FromSeq, cp.ThroughSeq), cp.Root[:16] + "..."})
+	}
+	table([]float64{75, 35, 80}, []string{"Checkpoint", "Entries", "Merkle root"}, rows)
+
+	heading("Signature")
+	field("Algorithm", "Ed25519")
+	field("Key ID", c.KeyID)
+	field("Signature", c.Signature)
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.CellFormat(45, 5.5, "Verify at", "", 0, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "U", 9)
+	pdf.SetTextColor(20, 60, 160)
+	pdf.WriteLinkString(5.5, verifyURL, verifyURL)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.Ln(7)
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.MultiCell(0, 4.5, "Auditors can check this certificate offline: download the certificate JSON, "+
+		"the certificate key (/api/v1/carbon/certificate-key) and the checkpoint key (/api/v1/carbon/signing-key), "+
+		"then run esgverify. It re-adds the totals from every ledger entry and checks each entry against a signed Merkle checkpoint.", "", "L", false)
+
+	heading("Line items")
+	rows = nil
+	for i, ce := range c.Entries {
+		if i == maxPDFLineItems {
+			break
+		}
+		e := ce.Entry
+		rows = append(rows, []string{
+			fmt.Sprintf("%d", e.Sequence), e.Timestamp.UTC().Format(time.DateOnly), e.VendorID, e.FoodCategory,
+			fmt.Sprintf("%.2f", e.WeightKg), fmt.Sprintf("%.2f", e.CarbonSavedKg),
+		})
+	}
+	table([]float64{18, 25, 65, 28, 24, 30}, []string{"Seq", "Date", "Vendor", "Category", "Food kg", "CO2e kg"}, rows)
+	if len(c.Entries) > maxPDFLineItems {
+		pdf.Ln(2)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.MultiCell(0, 4.5, fmt.Sprintf("First %d of %d line items shown; the CSV export lists them all.", maxPDFLineItems, len(c.Entries)), "", "L", false)
+	}
+
+	return pdf.Output(w)
+}
@@ -3,6 +3,11 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
 
 	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
 )
@@ -15,44 +20,120 @@ func NewCarbonRepository(db *sql.DB) *carbonRepository {
 	return &carbonRepository{db: db}
 }
 
-func (r *carbonRepository) Save(ctx context.Context, entry domain.CarbonEntry) error {
+// Append links the entry to the current tip and stores it. The chain is
+// extended under a transaction-scoped advisory lock, so concurrent writers
+// queue up behind each other instead of forking it.
+func (r *carbonRepository) Append(ctx context.Context, entry *domain.CarbonEntry) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('carbon_ledger'))`); err != nil {
+		return false, err
+	}
+	// Checked under the lock and before linking, so a redelivered event
+	// neither adds savings nor moves the tip
+	rows, err := tx.QueryContext(ctx, `SELECT `+entryColumns+` FROM carbon_ledger WHERE order_id = $1`, entry.OrderID)
+	if err != nil {
+		return false, err
+	}
+	recorded, err := scanEntries(rows)
+	if err != nil {
+		return false, err
+	}
+	if len(recorded) > 0 {
+		*entry = recorded[0]
+		return false, nil
+	}
+
+	tip, err := tip(ctx, tx)
+	if err != nil {
+		return false, err
+	}
+	entry.Link(tip)
+
 	query := `
-		INSERT INTO carbon_ledger (id, vendor_id, order_id, category, weight_kg, carbon_saved_kg, timestamp, prev_hash, hash)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO carbon_ledger (id, seq, vendor_id, order_id, category, region, weight_kg, factor_version, emission_factor, carbon_saved_kg, timestamp, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`
-	_, err := r.db.ExecContext(ctx, query,
+	if _, err := tx.ExecContext(ctx, query,
 		entry.ID,
+		entry.Sequence,
 		entry.VendorID,
 		entry.OrderID,
 		entry.FoodCategory,
+		entry.Region,
 		entry.WeightKg,
+		entry.FactorVersion,
+		entry.FactorKgCO2e,
 		entry.CarbonSavedKg,
 		entry.Timestamp,
 		entry.PreviousHash,
 		entry.Hash,
-	)
-	return err
+	); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
 }
 
-func (r *carbonRepository) GetByVendorPeriod(ctx context.Context, vendorID string, start, end string) ([]domain.CarbonEntry, error) {
+const entryColumns = `id, seq, vendor_id, order_id, category, region, weight_kg, factor_version, emission_factor, carbon_saved_kg, timestamp, prev_hash, hash`
+
+// GetByVendorsPeriod reads the vendors' entries in [start, end), in ledger order
+func (r *carbonRepository) GetByVendorsPeriod(ctx context.Context, vendorIDs []string, start, end time.Time) ([]domain.CarbonEntry, error) {
 	query := `
-		SELECT id, vendor_id, order_id, category, weight_kg, carbon_saved_kg, timestamp, prev_hash, hash
+		SELECT ` + entryColumns + `
 		FROM carbon_ledger
-		WHERE vendor_id = $1 AND timestamp BETWEEN $2 AND $3
-		ORDER BY timestamp ASC
+		WHERE vendor_id = ANY($1) AND timestamp >= $2 AND timestamp < $3
+		ORDER BY seq ASC
 	`
-	rows, err := r.db.QueryContext(ctx, query, vendorID, start, end)
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(vendorIDs), start.UTC(), end.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+// Entries reads the chain in order, starting after the given sequence
+func (r *carbonRepository) Entries(ctx context.Context, afterSeq int64, limit int) ([]domain.CarbonEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+entryColumns+`
+		FROM carbon_ledger
+		WHERE seq > $1
+		ORDER BY seq ASC
+		LIMIT $2
+	`, afterSeq, limit)
 	if err != nil {
 		return nil, err
 	}
+	return scanEntries(rows)
+}
+
+func (r *carbonRepository) Tip(ctx context.Context) (domain.ChainTip, error) {
+	return tip(ctx, r.db)
+}
+
+func tip(ctx context.Context, q interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}) (domain.ChainTip, error) {
+	var t domain.ChainTip
+	err := q.QueryRowContext(ctx, "SELECT seq, hash FROM carbon_ledger ORDER BY seq DESC LIMIT 1").Scan(&t.Sequence, &t.Hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Genesis, nil
+	}
+	return t, err
+}
+
+func scanEntries(rows *sql.Rows) ([]domain.CarbonEntry, error) {
 	defer func() { _ = rows.Close() }()
 
 	var entries []domain.CarbonEntry
 	for rows.Next() {
 		var e domain.CarbonEntry
 		err := rows.Scan(
-			&e.ID, &e.VendorID, &e.OrderID, &e.FoodCategory,
-			&e.WeightKg, &e.CarbonSavedKg, &e.Timestamp,
+			&e.ID, &e.Sequence, &e.VendorID, &e.OrderID, &e.FoodCategory, &e.Region,
+			&e.WeightKg, &e.FactorVersion, &e.FactorKgCO2e, &e.CarbonSavedKg, &e.Timestamp,
 			&e.PreviousHash, &e.Hash,
 		)
 		if err != nil {
@@ -60,14 +141,158 @@ func (r *carbonRepository) GetByVendorPeriod(ctx context.Context, vendorID strin
 		}
 		entries = append(entries, e)
 	}
-	return entries, nil
+	return entries, rows.Err()
+}
+
+func (r *carbonRepository) SaveVerification(ctx context.Context, v domain.ChainVerification) error {
+	var broken []byte
+	if v.Broken != nil {
+		var err error
+		if broken, err = json.Marshal(v.Broken); err != nil {
+			return err
+		}
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO carbon_chain_verifications (id, from_seq, from_hash, through_seq, through_hash, checked, intact, broken, run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, v.ID, v.From.Sequence, v.From.Hash, v.Through.Sequence, v.Through.Hash, v.Checked, v.Intact, broken, v.RunAt.UTC())
+	return err
+}
+
+// LatestVerification is the most recent run; ErrVerificationNotFound before the first
+func (r *carbonRepository) LatestVerification(ctx context.Context) (*domain.ChainVerification, error) {
+	var (
+		v      domain.ChainVerification
+		broken []byte
+	)
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, from_seq, from_hash, through_seq, through_hash, checked, intact, broken, run_at
+		FROM carbon_chain_verifications
+		ORDER BY run_at DESC
+		LIMIT 1
+	`).Scan(&v.ID, &v.From.Sequence, &v.From.Hash, &v.Through.Sequence, &v.Through.Hash, &v.Checked, &v.Intact, &broken, &v.RunAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrVerificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(broken) > 0 {
+		v.Broken = &domain.ChainBreak{}
+		if err := json.Unmarshal(broken, v.Broken); err != nil {
+			return nil, err
+		}
+	}
+	return &v, nil
 }
 
-func (r *carbonRepository) GetLastHash(ctx context.Context) (string, error) {
-	var hash string
-	err := r.db.QueryRowContext(ctx, "SELECT hash FROM carbon_ledger ORDER BY timestamp DESC LIMIT 1").Scan(&hash)
-	if err == sql.ErrNoRows {
-		return "0000000000000000", nil
+func (r *carbonRepository) GetEntry(ctx context.Context, id string) (*domain.CarbonEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+entryColumns+`
+		FROM carbon_ledger
+		WHERE id::TEXT = $1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := scanEntries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, domain.ErrEntryNotFound
+	}
+	return &entries[0], nil
+}
+
+// SaveCheckpoint stores a checkpoint unless another writer already covered
+// the same entries; false in that case
+func (r *carbonRepository) SaveCheckpoint(ctx context.Context, c domain.Checkpoint) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO carbon_checkpoints (id, from_seq, through_seq, root, chain_hash, key_id, signature, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (from_seq) DO NOTHING
+	`, c.ID, c.FromSeq, c.ThroughSeq, c.Root, c.ChainHash, c.KeyID, c.Signature, c.CreatedAt.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+const checkpointColumns = `id, from_seq, through_seq, root, chain_hash, key_id, signature, created_at`
+
+func (r *carbonRepository) GetCheckpoint(ctx context.Context, id string) (*domain.Checkpoint, error) {
+	return scanCheckpoint(r.db.QueryRowContext(ctx, `SELECT `+checkpointColumns+` FROM carbon_checkpoints WHERE id::TEXT = $1`, id))
+}
+
+func (r *carbonRepository) LatestCheckpoint(ctx context.Context) (*domain.Checkpoint, error) {
+	return scanCheckpoint(r.db.QueryRowContext(ctx, `SELECT `+checkpointColumns+` FROM carbon_checkpoints ORDER BY through_seq DESC LIMIT 1`))
+}
+
+// CheckpointCovering finds the checkpoint whose leaves include the entry at seq
+func (r *carbonRepository) CheckpointCovering(ctx context.Context, seq int64) (*domain.Checkpoint, error) {
+	return scanCheckpoint(r.db.QueryRowContext(ctx, `
+		SELECT `+checkpointColumns+` FROM carbon_checkpoints
+		WHERE from_seq <= $1 AND through_seq >= $1
+	`, seq))
+}
+
+func (r *carbonRepository) ListCheckpoints(ctx context.Context, limit int) ([]domain.Checkpoint, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+checkpointColumns+` FROM carbon_checkpoints ORDER BY through_seq DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []domain.Checkpoint
+	for rows.Next() {
+		c, err := scanCheckpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *c)
+	}
+	return out, rows.Err()
+}
+
+func scanCheckpoint(row interface{ Scan(...any) error }) (*domain.Checkpoint, error) {
+	var c domain.Checkpoint
+	err := row.Scan(&c.ID, &c.FromSeq, &c.ThroughSeq, &c.Root, &c.ChainHash, &c.KeyID, &c.Signature, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrCheckpointNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveCertificate keeps an issued certificate, as signed, for later lookup
+func (r *carbonRepository) SaveCertificate(ctx context.Context, c *domain.Certificate) error {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO carbon_certificates (id, vendor_id, chain_id, period_start, period_end, body, issued_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, '')::UUID, $4, $5, $6, $7)
+	`, c.ID, c.VendorID, c.ChainID, c.PeriodStart.UTC(), c.PeriodEnd.UTC(), body, c.IssuedAt.UTC())
+	return err
+}
+
+func (r *carbonRepository) GetCertificate(ctx context.Context, id string) (*domain.Certificate, error) {
+	var body []byte
+	err := r.db.QueryRowContext(ctx, `SELECT body FROM carbon_certificates WHERE id::TEXT = $1`, id).Scan(&body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrCertificateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c domain.Certificate
+	if err := json.Unmarshal(body, &c); err != nil {
+		return nil, err
 	}
-	return hash, err
+	return &c, nil
 }
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+)
+
+func (r *carbonRepository) CreateChain(ctx context.Context, c domain.Chain) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO carbon_chains (id, name, created_by, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, c.ID, c.Name, c.CreatedBy, c.CreatedAt.UTC()); err != nil {
+		return err
+	}
+	for _, vendorID := range c.Outlets {
+		if err := addOutlet(ctx, tx, c.ID, vendorID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AddOutlet puts a vendor in the chain; adding it twice is a no-op
+func (r *carbonRepository) AddOutlet(ctx context.Context, chainID, vendorID string) error {
+	if _, err := r.GetChain(ctx, chainID); err != nil {
+		return err
+	}
+	return addOutlet(ctx, r.db, chainID, vendorID)
+}
+
+func addOutlet(ctx context.Context, q interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, chainID, vendorID string) error {
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO carbon_chain_outlets (chain_id, vendor_id)
+		VALUES ($1, $2)
+		ON CONFLICT (chain_id, vendor_id) DO NOTHING
+	`, chainID, vendorID)
+	return err
+}
+
+func (r *carbonRepository) GetChain(ctx context.Context, id string) (*domain.Chain, error) {
+	var c domain.Chain
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, name, created_by, created_at FROM carbon_chains WHERE id::TEXT = $1
+	`, id).Scan(&c.ID, &c.Name, &c.CreatedBy, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrChainNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT vendor_id FROM carbon_chain_outlets WHERE chain_id = $1 ORDER BY vendor_id
+	`, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var vendorID string
+		if err := rows.Scan(&vendorID); err != nil {
+			return nil, err
+		}
+		c.Outlets = append(c.Outlets, vendorID)
+	}
+	return &c, rows.Err()
+}
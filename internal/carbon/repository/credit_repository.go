@@ -0,0 +1,308 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+)
+
+// CreditProviders lists the providers with ledger entries through throughSeq
+// that their credit account has not counted yet
+func (r *carbonRepository) CreditProviders(ctx context.Context, throughSeq int64) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT l.vendor_id
+		FROM carbon_ledger l
+		LEFT JOIN carbon_credit_cursors c ON c.provider_id = l.vendor_id
+		WHERE l.seq <= $1 AND l.seq > COALESCE(c.issued_through_seq, 0)
+		ORDER BY l.vendor_id
+	`, throughSeq)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var providers []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		providers = append(providers, id)
+	}
+	return providers, rows.Err()
+}
+
+// ProviderEntries reads the provider's entries from fromSeq through throughSeq, in ledger order
+func (r *carbonRepository) ProviderEntries(ctx context.Context, providerID string, fromSeq, throughSeq int64) ([]domain.CarbonEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+entryColumns+`
+		FROM carbon_ledger
+		WHERE vendor_id = $1 AND seq >= $2 AND seq <= $3
+		ORDER BY seq ASC
+	`, providerID, fromSeq, throughSeq)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+func (r *carbonRepository) GetCreditAccount(ctx context.Context, providerID string) (*domain.CreditAccount, error) {
+	var (
+		a            domain.CreditAccount
+		lastIssuedAt sql.NullTime
+	)
+	err := r.db.QueryRowContext(ctx, `
+		SELECT provider_id, issued_through_seq, next_seq, next_offset_g, carry_g,
+			tokens_issued, credited_g, last_issued_at
+		FROM carbon_credit_cursors WHERE provider_id = $1
+	`, providerID).Scan(&a.ProviderID, &a.IssuedThroughSeq, &a.NextSeq, &a.NextOffset, &a.CarryGrams,
+		&a.TokensIssued, &a.CreditedGrams, &lastIssuedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrCreditAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lastIssuedAt.Valid {
+		a.LastIssuedAt = &lastIssuedAt.Time
+	}
+	return &a, nil
+}
+
+// IssueCredits moves the provider's cursor on and stores the tokens it
+// minted, with their backing and an ISSUED event each, all or nothing. It is
+// ErrCreditsConflict when the cursor is no longer at prevThroughSeq. A
+// provider on the platform also gets its carbon_credits summary refreshed.
+func (r *carbonRepository) IssueCredits(ctx context.Context, prevThroughSeq int64, a domain.CreditAccount, tokens []domain.CreditToken, events []domain.CreditEvent) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var lastIssuedAt any
+	if a.LastIssuedAt != nil {
+		lastIssuedAt = a.LastIssuedAt.UTC()
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO carbon_credit_cursors (provider_id, issued_through_seq, next_seq, next_offset_g, carry_g, tokens_issued, credited_g, last_issued_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (provider_id) DO UPDATE SET
+			issued_through_seq = EXCLUDED.issued_through_seq,
+			next_seq = EXCLUDED.next_seq,
+			next_offset_g = EXCLUDED.next_offset_g,
+			carry_g = EXCLUDED.carry_g,
+			tokens_issued = EXCLUDED.tokens_issued,
+			credited_g = EXCLUDED.credited_g,
+			last_issued_at = EXCLUDED.last_issued_at
+		WHERE carbon_credit_cursors.issued_through_seq = $9
+	`, a.ProviderID, a.IssuedThroughSeq, a.NextSeq, a.NextOffset, a.CarryGrams, a.TokensIssued, a.CreditedGrams, lastIssuedAt, prevThroughSeq)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return domain.ErrCreditsConflict
+	}
+	// The cursor row is locked until commit, so the summary has one writer
+	if err := upsertCreditSummary(ctx, tx, a, lastIssuedAt); err != nil {
+		return err
+	}
+
+	for _, t := range tokens {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO carbon_credit_tokens (id, provider_id, owner_id, status, co2e_g, issued_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, t.ID, t.ProviderID, t.OwnerID, t.Status, t.Grams, t.IssuedAt.UTC()); err != nil {
+			return err
+		}
+		for _, b := range t.Backing {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO carbon_credit_backings (token_id, entry_id, seq, co2e_g)
+				VALUES ($1, $2, $3, $4)
+			`, t.ID, b.EntryID, b.Sequence, b.Grams); err != nil {
+				return err
+			}
+		}
+	}
+	for _, e := range events {
+		if err := insertCreditEvent(ctx, tx, e); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ApplyCreditEvents transfers or retires tokens, all or nothing. Each token
+// must still be active and held by the event's FromOwner.
+func (r *carbonRepository) ApplyCreditEvents(ctx context.Context, events []domain.CreditEvent) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, e := range events {
+		var res sql.Result
+		switch e.Type {
+		case domain.CreditEventTransferred:
+			res, err = tx.ExecContext(ctx, `
+				UPDATE carbon_credit_tokens SET owner_id = $3
+				WHERE id::TEXT = $1 AND owner_id = $2 AND status = 'ACTIVE'
+			`, e.TokenID, e.FromOwner, e.ToOwner)
+		case domain.CreditEventRetired:
+			res, err = tx.ExecContext(ctx, `
+				UPDATE carbon_credit_tokens SET status = 'RETIRED', retired_at = $3
+				WHERE id::TEXT = $1 AND owner_id = $2 AND status = 'ACTIVE'
+			`, e.TokenID, e.FromOwner, e.At.UTC())
+		default:
+			return fmt.Errorf("cannot apply a %s credit event", e.Type)
+		}
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			var exists bool
+			if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM carbon_credit_tokens WHERE id::TEXT = $1)`, e.TokenID).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("%w: %s", domain.ErrCreditTokenNotFound, e.TokenID)
+			}
+			return fmt.Errorf("%w: %s", domain.ErrCreditTokenUnavailable, e.TokenID)
+		}
+		if err := insertCreditEvent(ctx, tx, e); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// upsertCreditSummary writes the certified savings counted for the provider
+// and the tokens issued to it. Ledger vendors without a providers row have
+// no summary to keep.
+func upsertCreditSummary(ctx context.Context, tx *sql.Tx, a domain.CreditAccount, lastIssuedAt any) error {
+	savedGrams := a.CreditedGrams + a.CarryGrams
+	res, err := tx.ExecContext(ctx, `
+		UPDATE carbon_credits
+		SET total_co2_saved_kg = $2::BIGINT / 1000.0, credit_tokens = $3, last_issued_at = $4, is_certified = TRUE
+		WHERE provider_id::TEXT = $1
+	`, a.ProviderID, savedGrams, a.TokensIssued, lastIssuedAt)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO carbon_credits (provider_id, total_co2_saved_kg, credit_tokens, last_issued_at, is_certified)
+		SELECT id, $2::BIGINT / 1000.0, $3, $4, TRUE FROM providers WHERE id::TEXT = $1
+	`, a.ProviderID, savedGrams, a.TokensIssued, lastIssuedAt)
+	return err
+}
+
+func insertCreditEvent(ctx context.Context, tx *sql.Tx, e domain.CreditEvent) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO carbon_credit_events (id, token_id, type, from_owner, to_owner, beneficiary, note, actor, at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, e.ID, e.TokenID, e.Type, e.FromOwner, e.ToOwner, e.Beneficiary, e.Note, e.Actor, e.At.UTC())
+	return err
+}
+
+const tokenColumns = `id, provider_id, owner_id, status, co2e_g, issued_at, retired_at`
+
+func scanToken(row interface{ Scan(...any) error }) (*domain.CreditToken, error) {
+	var (
+		t         domain.CreditToken
+		retiredAt sql.NullTime
+	)
+	if err := row.Scan(&t.ID, &t.ProviderID, &t.OwnerID, &t.Status, &t.Grams, &t.IssuedAt, &retiredAt); err != nil {
+		return nil, err
+	}
+	if retiredAt.Valid {
+		t.RetiredAt = &retiredAt.Time
+	}
+	return &t, nil
+}
+
+// GetCreditToken reads the token with its backing
+func (r *carbonRepository) GetCreditToken(ctx context.Context, id string) (*domain.CreditToken, error) {
+	t, err := scanToken(r.db.QueryRowContext(ctx, `
+		SELECT `+tokenColumns+` FROM carbon_credit_tokens WHERE id::TEXT = $1
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrCreditTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT entry_id, seq, co2e_g FROM carbon_credit_backings WHERE token_id = $1 ORDER BY seq
+	`, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var b domain.CreditBacking
+		if err := rows.Scan(&b.EntryID, &b.Sequence, &b.Grams); err != nil {
+			return nil, err
+		}
+		t.Backing = append(t.Backing, b)
+	}
+	return t, rows.Err()
+}
+
+// ListCreditTokens lists what the owner holds, oldest first; any status when status is empty
+func (r *carbonRepository) ListCreditTokens(ctx context.Context, ownerID string, status domain.CreditTokenStatus) ([]domain.CreditToken, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+tokenColumns+` FROM carbon_credit_tokens
+		WHERE owner_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY issued_at, id
+	`, ownerID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var tokens []domain.CreditToken
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+// CreditHistory is every event of the token, oldest first
+func (r *carbonRepository) CreditHistory(ctx context.Context, tokenID string) ([]domain.CreditEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, token_id, type, from_owner, to_owner, beneficiary, note, actor, at
+		FROM carbon_credit_events
+		WHERE token_id::TEXT = $1
+		ORDER BY at, id
+	`, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var events []domain.CreditEvent
+	for rows.Next() {
+		var e domain.CreditEvent
+		if err := rows.Scan(&e.ID, &e.TokenID, &e.Type, &e.FromOwner, &e.ToOwner, &e.Beneficiary, &e.Note, &e.Actor, &e.At); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
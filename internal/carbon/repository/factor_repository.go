@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+)
+
+type factorRepository struct {
+	db *sql.DB
+}
+
+func NewFactorRepository(db *sql.DB) *factorRepository {
+	return &factorRepository{db: db}
+}
+
+// CreateVersion stores a version with its factors; ErrFactorVersionExists if
+// the version name is taken
+func (r *factorRepository) CreateVersion(ctx context.Context, v domain.FactorVersion) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO emission_factor_versions (version, effective_from, description, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (version) DO NOTHING
+	`, v.Version, v.EffectiveFrom.UTC(), v.Description, v.CreatedBy, v.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return domain.ErrFactorVersionExists
+	}
+
+	for _, f := range v.Factors {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO emission_factors (version, category, region, kg_co2e_per_kg, source)
+			VALUES ($1, $2, $3, $4, $5)
+		`, v.Version, f.Category, f.Region, f.KgCO2ePerKg, f.Source); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *factorRepository) GetVersion(ctx context.Context, version string) (*domain.FactorVersion, error) {
+	return r.version(ctx, `WHERE version = $1`, version)
+}
+
+// EffectiveVersion is the version in force at the given time: the latest one
+// that had taken effect by then
+func (r *factorRepository) EffectiveVersion(ctx context.Context, at time.Time) (*domain.FactorVersion, error) {
+	return r.version(ctx, `WHERE effective_from <= $1 ORDER BY effective_from DESC LIMIT 1`, at.UTC())
+}
+
+func (r *factorRepository) version(ctx context.Context, where string, arg any) (*domain.FactorVersion, error) {
+	var v domain.FactorVersion
+	err := r.db.QueryRowContext(ctx, `
+		SELECT version, effective_from, description, created_by, created_at
+		FROM emission_factor_versions
+		`+where, arg).Scan(&v.Version, &v.EffectiveFrom, &v.Description, &v.CreatedBy, &v.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrFactorVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v.Factors, err = r.factors(ctx, v.Version); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ListVersions returns every version with its factors, newest first
+func (r *factorRepository) ListVersions(ctx context.Context) ([]domain.FactorVersion, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT version, effective_from, description, created_by, created_at
+		FROM emission_factor_versions
+		ORDER BY effective_from DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var versions []domain.FactorVersion
+	for rows.Next() {
+		var v domain.FactorVersion
+		if err := rows.Scan(&v.Version, &v.EffectiveFrom, &v.Description, &v.CreatedBy, &v.CreatedAt); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range versions {
+		if versions[i].Factors, err = r.factors(ctx, versions[i].Version); err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+func (r *factorRepository) factors(ctx context.Context, version string) ([]domain.EmissionFactor, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT category, region, kg_co2e_per_kg, source
+		FROM emission_factors
+		WHERE version = $1
+		ORDER BY category, region
+	`, version)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var factors []domain.EmissionFactor
+	for rows.Next() {
+		var f domain.EmissionFactor
+		if err := rows.Scan(&f.Category, &f.Region, &f.KgCO2ePerKg, &f.Source); err != nil {
+			return nil, err
+		}
+		factors = append(factors, f)
+	}
+	return factors, rows.Err()
+}
@@ -2,38 +2,89 @@ package service
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 
 	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/merkle"
+)
+
+const (
+	// verifyPageSize is how many entries a verification reads at a time
+	verifyPageSize = 500
+	// maxCheckpointSize bounds a checkpoint's tree, and so what a proof loads
+	maxCheckpointSize = 10000
 )
 
 type CarbonService struct {
-	repo CarbonRepo
+	repo              CarbonRepo
+	factors           *FactorService
+	signer            *domain.Signer // Checkpoints
+	certificateSigner *domain.Signer // ESG certificates
+	logger            *zap.Logger
 }
 
-// In production, I should use an interface for the Repository. Let's fix that.
 type CarbonRepo interface {
-	Save(ctx context.Context, entry domain.CarbonEntry) error
-	GetByVendorPeriod(ctx context.Context, vendorID string, start, end string) ([]domain.CarbonEntry, error)
-	GetLastHash(ctx context.Context) (string, error)
+	// Append links the entry to the current tip, one writer at a time. An
+	// order is recorded once: false, with entry set to the stored one, when
+	// it already was.
+	Append(ctx context.Context, entry *domain.CarbonEntry) (bool, error)
+	GetByVendorsPeriod(ctx context.Context, vendorIDs []string, start, end time.Time) ([]domain.CarbonEntry, error)
+	// Entries reads the chain in sequence order after afterSeq
+	Entries(ctx context.Context, afterSeq int64, limit int) ([]domain.CarbonEntry, error)
+	Tip(ctx context.Context) (domain.ChainTip, error)
+
+	GetEntry(ctx context.Context, id string) (*domain.CarbonEntry, error)
+
+	SaveVerification(ctx context.Context, v domain.ChainVerification) error
+	LatestVerification(ctx context.Context) (*domain.ChainVerification, error)
+
+	// SaveCheckpoint is false when another writer already checkpointed the same entries
+	SaveCheckpoint(ctx context.Context, c domain.Checkpoint) (bool, error)
+	GetCheckpoint(ctx context.Context, id string) (*domain.Checkpoint, error)
+	LatestCheckpoint(ctx context.Context) (*domain.Checkpoint, error)
+	CheckpointCovering(ctx context.Context, seq int64) (*domain.Checkpoint, error)
+	ListCheckpoints(ctx context.Context, limit int) ([]domain.Checkpoint, error)
+
+	SaveCertificate(ctx context.Context, c *domain.Certificate) error
+	GetCertificate(ctx context.Context, id string) (*domain.Certificate, error)
+
+	CreateChain(ctx context.Context, c domain.Chain) error
+	GetChain(ctx context.Context, id string) (*domain.Chain, error)
+	AddOutlet(ctx context.Context, chainID, vendorID string) error
 }
 
-func NewCarbonService(repo CarbonRepo) *CarbonService {
+// NewCarbonService records savings into the chain, priced with the factors
+// in force; signer signs the checkpoints published over it and
+// certificateSigner the ESG certificates issued from it, each with its own key
+func NewCarbonService(repo CarbonRepo, factors *FactorService, signer, certificateSigner *domain.Signer, logger *zap.Logger) *CarbonService {
 	return &CarbonService{
-		repo: repo,
+		repo:              repo,
+		factors:           factors,
+		signer:            signer,
+		certificateSigner: certificateSigner,
+		logger:            logger,
 	}
 }
 
-// RecordSavings adds a new block to the carbon ledger
-func (s *CarbonService) RecordSavings(ctx context.Context, vendorID, orderID, category string, weightKg float64) (string, error) {
-	savings := domain.CalculateSavings(weightKg, category)
-
-	prevHash, err := s.repo.GetLastHash(ctx)
+// RecordSavings adds a new block to the carbon ledger. Savings are priced
+// with the factor version in force now, for the category in the region; the
+// entry records which version and factor it used. An order already in the
+// ledger is not recorded again; its stored entry is returned.
+func (s *CarbonService) RecordSavings(ctx context.Context, vendorID, orderID, category, region string, weightKg float64) (*domain.CarbonEntry, error) {
+	now := time.Now()
+	version, err := s.factors.Effective(ctx, now)
+	if err != nil {
+		return nil, fmt.Errorf("emission factors at %s: %w", now.Format(time.RFC3339), err)
+	}
+	factor, err := version.Factor(category, region)
 	if err != nil {
-		prevHash = "0000000000000000"
+		return nil, err
 	}
 
 	entry := domain.CarbonEntry{
@@ -41,50 +92,419 @@ func (s *CarbonService) RecordSavings(ctx context.Context, vendorID, orderID, ca
 		VendorID:      vendorID,
 		OrderID:       orderID,
 		FoodCategory:  category,
+		Region:        region,
 		WeightKg:      weightKg,
-		CarbonSavedKg: savings,
-		Timestamp:     time.Now(),
-		PreviousHash:  prevHash,
+		FactorVersion: version.Version,
+		FactorKgCO2e:  factor.KgCO2ePerKg,
+		CarbonSavedKg: weightKg * factor.KgCO2ePerKg,
+		Timestamp:     now,
 	}
 
-	entry.Hash = entry.ComputeHash()
+	// The repository links and hashes the entry once it holds the chain
+	appended, err := s.repo.Append(ctx, &entry)
+	if err != nil {
+		return nil, err
+	}
+	if !appended {
+		// Delivery events arrive at least once; the savings count once
+		s.logger.Info("Carbon savings already recorded for order, skipped",
+			zap.String("order_id", orderID), zap.String("hash", entry.Hash))
+	}
+	return &entry, nil
+}
 
-	if err := s.repo.Save(ctx, entry); err != nil {
-		return "", err
+// Restate recomputes the vendor's savings in [start, end) under another
+// factor version, next to what the ledger recorded. Nothing is rewritten.
+func (s *CarbonService) Restate(ctx context.Context, vendorID string, start, end time.Time, version string) (*domain.Restatement, error) {
+	v, err := s.factors.Version(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.repo.GetByVendorsPeriod(ctx, []string{vendorID}, start, end)
+	if err != nil {
+		return nil, err
 	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: vendor %s, %s to %s", domain.ErrNoSavingsInPeriod, vendorID, start.Format(time.DateOnly), end.Format(time.DateOnly))
+	}
+	return domain.Restate(vendorID, start, end, v, entries)
+}
 
-	return entry.Hash, nil
+// IssueCertificate signs an ESG certificate over the vendor's savings in the
+// period. New entries are checkpointed first; the certificate covers what is
+// anchored at the time it is issued.
+func (s *CarbonService) IssueCertificate(ctx context.Context, vendorID string, period domain.Period) (*domain.Certificate, error) {
+	return s.issue(ctx, &domain.Certificate{VendorID: vendorID}, []string{vendorID}, period)
+}
+
+// IssueChainCertificate signs one certificate over the savings of all of a
+// chain's outlets in the period, with a subtotal per outlet
+func (s *CarbonService) IssueChainCertificate(ctx context.Context, chainID string, period domain.Period) (*domain.Certificate, error) {
+	chain, err := s.repo.GetChain(ctx, chainID)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain.Outlets) == 0 {
+		return nil, fmt.Errorf("%w: chain %s has no outlets", domain.ErrNoSavingsInPeriod, chain.Name)
+	}
+	c := &domain.Certificate{ChainID: chain.ID, ChainName: chain.Name}
+	for _, vendorID := range chain.Outlets {
+		c.Outlets = append(c.Outlets, domain.OutletTotals{VendorID: vendorID})
+	}
+	return s.issue(ctx, c, chain.Outlets, period)
 }
 
-// GenerateESGReport creates a formal certificate for corporate partners
-func (s *CarbonService) GenerateESGReport(ctx context.Context, vendorID string, year int) (domain.ESGReport, error) {
-	start := fmt.Sprintf("%d-01-01 00:00:00", year)
-	end := fmt.Sprintf("%d-12-31 23:59:59", year)
+func (s *CarbonService) issue(ctx context.Context, c *domain.Certificate, vendorIDs []string, period domain.Period) (*domain.Certificate, error) {
+	if _, err := s.Checkpoint(ctx); err != nil {
+		return nil, err
+	}
+	latest, err := s.repo.LatestCheckpoint(ctx)
+	if errors.Is(err, domain.ErrCheckpointNotFound) {
+		return nil, domain.ErrNoSavingsInPeriod
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	entries, err := s.repo.GetByVendorPeriod(ctx, vendorID, start, end)
+	entries, err := s.repo.GetByVendorsPeriod(ctx, vendorIDs, period.Start, period.End)
 	if err != nil {
-		return domain.ESGReport{}, err
+		return nil, err
+	}
+	c.ID = uuid.New().String()
+	c.PeriodLabel = period.Label
+	c.PeriodStart = period.Start.UTC()
+	c.PeriodEnd = period.End.UTC()
+	c.IssuedAt = time.Now().UTC().Truncate(time.Microsecond)
+	outlets := make(map[string]*domain.OutletTotals, len(c.Outlets))
+	for i := range c.Outlets {
+		outlets[c.Outlets[i].VendorID] = &c.Outlets[i]
 	}
 
-	var totalFood, totalCarbon float64
-	for _, entry := range entries {
-		totalFood += entry.WeightKg
-		totalCarbon += entry.CarbonSavedKg
+	// Entries come in ledger order, so each checkpoint's tree is loaded once
+	var (
+		cp     *domain.Checkpoint
+		leaves [][]byte
+	)
+	for _, e := range entries {
+		if e.Sequence > latest.ThroughSeq {
+			break
+		}
+		if cp == nil || !cp.Covers(e.Sequence) {
+			if cp, err = s.repo.CheckpointCovering(ctx, e.Sequence); err != nil {
+				return nil, err
+			}
+			if leaves, err = s.checkpointLeaves(ctx, cp); err != nil {
+				return nil, err
+			}
+			c.Checkpoints = append(c.Checkpoints, *cp)
+		}
+		index := int(e.Sequence - cp.FromSeq)
+		path, err := merkle.Proof(leaves, index)
+		if err != nil {
+			return nil, err
+		}
+		c.Entries = append(c.Entries, domain.CertifiedEntry{Entry: e, CheckpointID: cp.ID, LeafIndex: index, AuditPath: hexPath(path)})
+		c.TotalFoodSavedKg += e.WeightKg
+		c.TotalCarbonSavedKg += e.CarbonSavedKg
+		if o := outlets[e.VendorID]; o != nil {
+			o.TransactionCount++
+			o.FoodSavedKg += e.WeightKg
+			o.CarbonSavedKg += e.CarbonSavedKg
+		}
+	}
+	if len(c.Entries) == 0 {
+		return nil, fmt.Errorf("%w: %s, %s", domain.ErrNoSavingsInPeriod, c.Subject(), period.Label)
 	}
+	c.TransactionCount = len(c.Entries)
 
-	if len(entries) == 0 {
-		return domain.ESGReport{}, fmt.Errorf("no transactions found for vendor %s in %d", vendorID, year)
+	s.certificateSigner.SignCertificate(c)
+	if err := s.repo.SaveCertificate(ctx, c); err != nil {
+		return nil, err
 	}
+	s.logger.Info("ESG certificate issued",
+		zap.String("certificate_id", c.ID),
+		zap.String("subject", c.Subject()),
+		zap.String("period", c.PeriodLabel),
+		zap.Int("entries", c.TransactionCount),
+		zap.Float64("carbon_saved_kg", c.TotalCarbonSavedKg))
+	return c, nil
+}
 
-	report := domain.ESGReport{
-		VendorID:         vendorID,
-		PeriodStart:      time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC),
-		PeriodEnd:        time.Date(year, 12, 31, 23, 59, 59, 0, time.UTC),
-		TotalFoodSaved:   totalFood,
-		TotalCarbonSaved: totalCarbon,
-		TransactionCount: len(entries),
-		VerificationHash: fmt.Sprintf("VERIFIED-%s-%d-%f", vendorID, year, totalCarbon),
+// CreateChain registers a corporate partner's outlets for rollup reports
+func (s *CarbonService) CreateChain(ctx context.Context, c domain.Chain) (*domain.Chain, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	c.ID = uuid.New().String()
+	c.CreatedAt = time.Now().UTC()
+	if err := s.repo.CreateChain(ctx, c); err != nil {
+		return nil, err
 	}
+	return &c, nil
+}
 
-	return report, nil
+func (s *CarbonService) GetChain(ctx context.Context, id string) (*domain.Chain, error) {
+	return s.repo.GetChain(ctx, id)
+}
+
+// AddOutlet puts a vendor in the chain; later rollups include it
+func (s *CarbonService) AddOutlet(ctx context.Context, chainID, vendorID string) (*domain.Chain, error) {
+	if vendorID == "" {
+		return nil, fmt.Errorf("%w: vendor_id is required", domain.ErrInvalidChain)
+	}
+	if err := s.repo.AddOutlet(ctx, chainID, vendorID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetChain(ctx, chainID)
+}
+
+func (s *CarbonService) GetCertificate(ctx context.Context, id string) (*domain.Certificate, error) {
+	return s.repo.GetCertificate(ctx, id)
+}
+
+// VerifyCertificate checks a certificate against our published keys, exactly
+// as an auditor would offline
+func (s *CarbonService) VerifyCertificate(c *domain.Certificate) domain.CertificateVerification {
+	v := domain.CertificateVerification{CertificateID: c.ID, Valid: true, CheckedAt: time.Now()}
+	if err := c.Verify(s.certificateSigner.PublicKey(), s.signer.PublicKey()); err != nil {
+		v.Valid, v.Reason = false, err.Error()
+	}
+	return v
+}
+
+// CertificateKey is the public key certificates verify against, as PEM
+func (s *CarbonService) CertificateKey() ([]byte, error) {
+	return s.certificateSigner.PublicKeyPEM()
+}
+
+// VerifyChain walks the ledger from a trusted point, recomputing every hash
+// and link, and reports the first one that does not hold. From Genesis it
+// checks the whole chain.
+func (s *CarbonService) VerifyChain(ctx context.Context, from domain.ChainTip) (*domain.ChainVerification, error) {
+	v := &domain.ChainVerification{ID: uuid.New().String(), From: from, Through: from, Intact: true, RunAt: time.Now()}
+	for {
+		entries, err := s.repo.Entries(ctx, v.Through.Sequence, verifyPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for i := range entries {
+			if broken := entries[i].Check(v.Through); broken != nil {
+				v.Broken, v.Intact = broken, false
+				return v, nil
+			}
+			v.Through = entries[i].Tip()
+			v.Checked++
+		}
+		if len(entries) < verifyPageSize {
+			return v, nil
+		}
+	}
+}
+
+// VerifySinceLastRun continues from where the previous scheduled run left
+// off: the tip it verified, or its last good link if it found a break, so a
+// break keeps being reported until it is repaired. The run is stored.
+func (s *CarbonService) VerifySinceLastRun(ctx context.Context) (*domain.ChainVerification, error) {
+	from := domain.Genesis
+	last, err := s.repo.LatestVerification(ctx)
+	switch {
+	case err == nil:
+		from = last.Through
+	case !errors.Is(err, domain.ErrVerificationNotFound):
+		return nil, err
+	}
+
+	v, err := s.VerifyChain(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveVerification(ctx, *v); err != nil {
+		return nil, err
+	}
+	if !v.Intact {
+		s.logger.Error("🚨 Carbon ledger chain is broken",
+			zap.Int64("seq", v.Broken.Sequence),
+			zap.String("entry_id", v.Broken.EntryID),
+			zap.String("reason", v.Broken.Reason))
+	}
+	return v, nil
+}
+
+// LatestVerification is the last stored run
+func (s *CarbonService) LatestVerification(ctx context.Context) (*domain.ChainVerification, error) {
+	return s.repo.LatestVerification(ctx)
+}
+
+// RunChainVerifier checks new ledger entries every interval
+func (s *CarbonService) RunChainVerifier(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.VerifySinceLastRun(ctx); err != nil {
+				s.logger.Error("Carbon ledger verification failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Checkpoint publishes signed Merkle roots over the entries appended since
+// the last checkpoint, at most maxCheckpointSize entries per checkpoint. It
+// re-checks every link first and refuses to sign over a broken chain.
+func (s *CarbonService) Checkpoint(ctx context.Context) ([]domain.Checkpoint, error) {
+	var created []domain.Checkpoint
+	for {
+		from := domain.Genesis
+		last, err := s.repo.LatestCheckpoint(ctx)
+		switch {
+		case err == nil:
+			from = domain.ChainTip{Sequence: last.ThroughSeq, Hash: last.ChainHash}
+		case !errors.Is(err, domain.ErrCheckpointNotFound):
+			return created, err
+		}
+
+		entries, err := s.repo.Entries(ctx, from.Sequence, maxCheckpointSize)
+		if err != nil || len(entries) == 0 {
+			return created, err
+		}
+		prev := from
+		for i := range entries {
+			if broken := entries[i].Check(prev); broken != nil {
+				return created, fmt.Errorf("carbon ledger broken at seq %d (%s), not checkpointing", broken.Sequence, broken.Reason)
+			}
+			prev = entries[i].Tip()
+		}
+		root, err := merkleRoot(entries)
+		if err != nil {
+			return created, err
+		}
+
+		c := domain.Checkpoint{
+			ID:         uuid.New().String(),
+			FromSeq:    entries[0].Sequence,
+			ThroughSeq: prev.Sequence,
+			Root:       root,
+			ChainHash:  prev.Hash,
+			CreatedAt:  time.Now().UTC().Truncate(time.Microsecond),
+		}
+		s.signer.SignCheckpoint(&c)
+		saved, err := s.repo.SaveCheckpoint(ctx, c)
+		if err != nil {
+			return created, err
+		}
+		if saved {
+			created = append(created, c)
+			s.logger.Info("Carbon checkpoint published",
+				zap.String("checkpoint_id", c.ID),
+				zap.Int64("from_seq", c.FromSeq),
+				zap.Int64("through_seq", c.ThroughSeq),
+				zap.String("root", c.Root))
+		}
+		if len(entries) < maxCheckpointSize {
+			return created, nil
+		}
+	}
+}
+
+// InclusionProof proves that the entry is part of a published checkpoint.
+// The tree is rebuilt from the ledger and must still match the signed root.
+func (s *CarbonService) InclusionProof(ctx context.Context, entryID string) (*domain.InclusionProof, error) {
+	entry, err := s.repo.GetEntry(ctx, entryID)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.repo.CheckpointCovering(ctx, entry.Sequence)
+	if errors.Is(err, domain.ErrCheckpointNotFound) {
+		return nil, domain.ErrNotCheckpointed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	leaves, err := s.checkpointLeaves(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	index := int(entry.Sequence - c.FromSeq)
+	path, err := merkle.Proof(leaves, index)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.InclusionProof{Entry: *entry, LeafIndex: index, TreeSize: c.Size(), AuditPath: hexPath(path), Checkpoint: *c}, nil
+}
+
+// checkpointLeaves rebuilds a checkpoint's tree from the ledger; it must
+// still match the signed root
+func (s *CarbonService) checkpointLeaves(ctx context.Context, c *domain.Checkpoint) ([][]byte, error) {
+	entries, err := s.repo.Entries(ctx, c.FromSeq-1, c.Size())
+	if err != nil {
+		return nil, err
+	}
+	leaves, err := leafData(entries)
+	if err != nil || len(leaves) != c.Size() || hex.EncodeToString(merkle.Root(leaves)) != c.Root {
+		return nil, fmt.Errorf("ledger no longer matches checkpoint %s", c.ID)
+	}
+	return leaves, nil
+}
+
+func (s *CarbonService) GetCheckpoint(ctx context.Context, id string) (*domain.Checkpoint, error) {
+	return s.repo.GetCheckpoint(ctx, id)
+}
+
+// Checkpoints lists the most recent checkpoints first
+func (s *CarbonService) Checkpoints(ctx context.Context, limit int) ([]domain.Checkpoint, error) {
+	return s.repo.ListCheckpoints(ctx, limit)
+}
+
+// SigningKey is the public key checkpoints verify against, as PEM
+func (s *CarbonService) SigningKey() ([]byte, error) {
+	return s.signer.PublicKeyPEM()
+}
+
+// RunCheckpointer publishes a checkpoint over new entries every interval
+func (s *CarbonService) RunCheckpointer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Checkpoint(ctx); err != nil {
+				s.logger.Error("Carbon checkpoint failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+func leafData(entries []domain.CarbonEntry) ([][]byte, error) {
+	leaves := make([][]byte, len(entries))
+	for i := range entries {
+		leaf, err := domain.LeafData(&entries[i])
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = leaf
+	}
+	return leaves, nil
+}
+
+func hexPath(path [][]byte) []string {
+	out := make([]string, len(path))
+	for i, h := range path {
+		out[i] = hex.EncodeToString(h)
+	}
+	return out
+}
+
+func merkleRoot(entries []domain.CarbonEntry) (string, error) {
+	leaves, err := leafData(entries)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(merkle.Root(leaves)), nil
 }
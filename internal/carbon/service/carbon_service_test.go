@@ -0,0 +1,952 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+)
+
+// memoryLedger serialises appends with a mutex, as Postgres does with its advisory lock
+type memoryLedger struct {
+	mu            sync.Mutex
+	entries       []domain.CarbonEntry
+	verifications []domain.ChainVerification
+	checkpoints   []domain.Checkpoint
+	certificates  []domain.Certificate
+	chains        map[string]*domain.Chain
+}
+
+func (m *memoryLedger) Append(_ context.Context, e *domain.CarbonEntry) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, recorded := range m.entries {
+		if recorded.OrderID == e.OrderID {
+			*e = recorded
+			return false, nil
+		}
+	}
+	tip := domain.Genesis
+	if n := len(m.entries); n > 0 {
+		tip = m.entries[n-1].Tip()
+	}
+	e.Link(tip)
+	m.entries = append(m.entries, *e)
+	return true, nil
+}
+
+func (m *memoryLedger) GetByVendorsPeriod(_ context.Context, vendorIDs []string, start, end time.Time) ([]domain.CarbonEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []domain.CarbonEntry
+	for _, e := range m.entries {
+		if slices.Contains(vendorIDs, e.VendorID) && !e.Timestamp.Before(start) && e.Timestamp.Before(end) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryLedger) Entries(_ context.Context, afterSeq int64, limit int) ([]domain.CarbonEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []domain.CarbonEntry
+	for _, e := range m.entries {
+		if e.Sequence > afterSeq && len(out) < limit {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryLedger) Tip(_ context.Context) (domain.ChainTip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n := len(m.entries); n > 0 {
+		return m.entries[n-1].Tip(), nil
+	}
+	return domain.Genesis, nil
+}
+
+func (m *memoryLedger) SaveVerification(_ context.Context, v domain.ChainVerification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.verifications = append(m.verifications, v)
+	return nil
+}
+
+func (m *memoryLedger) LatestVerification(_ context.Context) (*domain.ChainVerification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.verifications) == 0 {
+		return nil, domain.ErrVerificationNotFound
+	}
+	v := m.verifications[len(m.verifications)-1]
+	return &v, nil
+}
+
+func (m *memoryLedger) GetEntry(_ context.Context, id string) (*domain.CarbonEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.entries {
+		if e.ID == id {
+			return &e, nil
+		}
+	}
+	return nil, domain.ErrEntryNotFound
+}
+
+func (m *memoryLedger) SaveCheckpoint(_ context.Context, c domain.Checkpoint) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.checkpoints {
+		if existing.FromSeq == c.FromSeq {
+			return false, nil
+		}
+	}
+	m.checkpoints = append(m.checkpoints, c)
+	sort.Slice(m.checkpoints, func(i, j int) bool { return m.checkpoints[i].ThroughSeq > m.checkpoints[j].ThroughSeq })
+	return true, nil
+}
+
+func (m *memoryLedger) findCheckpoint(match func(domain.Checkpoint) bool) (*domain.Checkpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.checkpoints {
+		if match(c) {
+			return &c, nil
+		}
+	}
+	return nil, domain.ErrCheckpointNotFound
+}
+
+func (m *memoryLedger) GetCheckpoint(_ context.Context, id string) (*domain.Checkpoint, error) {
+	return m.findCheckpoint(func(c domain.Checkpoint) bool { return c.ID == id })
+}
+
+func (m *memoryLedger) LatestCheckpoint(_ context.Context) (*domain.Checkpoint, error) {
+	return m.findCheckpoint(func(domain.Checkpoint) bool { return true })
+}
+
+func (m *memoryLedger) CheckpointCovering(_ context.Context, seq int64) (*domain.Checkpoint, error) {
+	return m.findCheckpoint(func(c domain.Checkpoint) bool { return c.Covers(seq) })
+}
+
+func (m *memoryLedger) ListCheckpoints(_ context.Context, limit int) ([]domain.Checkpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.checkpoints[:min(limit, len(m.checkpoints))], nil
+}
+
+func (m *memoryLedger) SaveCertificate(_ context.Context, c *domain.Certificate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.certificates = append(m.certificates, *c)
+	return nil
+}
+
+func (m *memoryLedger) GetCertificate(_ context.Context, id string) (*domain.Certificate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.certificates {
+		if c.ID == id {
+			return &c, nil
+		}
+	}
+	return nil, domain.ErrCertificateNotFound
+}
+
+func (m *memoryLedger) CreateChain(_ context.Context, c domain.Chain) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.chains == nil {
+		m.chains = make(map[string]*domain.Chain)
+	}
+	c.Outlets = slices.Clone(c.Outlets)
+	m.chains[c.ID] = &c
+	return nil
+}
+
+func (m *memoryLedger) GetChain(_ context.Context, id string) (*domain.Chain, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.chains[id]
+	if !ok {
+		return nil, domain.ErrChainNotFound
+	}
+	out := *c
+	out.Outlets = slices.Clone(c.Outlets)
+	sort.Strings(out.Outlets)
+	return &out, nil
+}
+
+func (m *memoryLedger) AddOutlet(_ context.Context, chainID, vendorID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.chains[chainID]
+	if !ok {
+		return domain.ErrChainNotFound
+	}
+	if !slices.Contains(c.Outlets, vendorID) {
+		c.Outlets = append(c.Outlets, vendorID)
+	}
+	return nil
+}
+
+// memoryFactors is the emission factor table
+type memoryFactors struct {
+	mu       sync.Mutex
+	versions []domain.FactorVersion
+}
+
+func (m *memoryFactors) CreateVersion(_ context.Context, v domain.FactorVersion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.versions {
+		if existing.Version == v.Version {
+			return domain.ErrFactorVersionExists
+		}
+	}
+	m.versions = append(m.versions, v)
+	sort.Slice(m.versions, func(i, j int) bool { return m.versions[i].EffectiveFrom.After(m.versions[j].EffectiveFrom) })
+	return nil
+}
+
+func (m *memoryFactors) find(match func(domain.FactorVersion) bool) (*domain.FactorVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range m.versions {
+		if match(v) {
+			return &v, nil
+		}
+	}
+	return nil, domain.ErrFactorVersionNotFound
+}
+
+func (m *memoryFactors) GetVersion(_ context.Context, version string) (*domain.FactorVersion, error) {
+	return m.find(func(v domain.FactorVersion) bool { return v.Version == version })
+}
+
+func (m *memoryFactors) EffectiveVersion(_ context.Context, at time.Time) (*domain.FactorVersion, error) {
+	return m.find(func(v domain.FactorVersion) bool { return !v.EffectiveFrom.After(at) })
+}
+
+func (m *memoryFactors) ListVersions(_ context.Context) ([]domain.FactorVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]domain.FactorVersion(nil), m.versions...), nil
+}
+
+// baselineFactors is the version the schema seeds
+var baselineFactors = domain.FactorVersion{
+	Version:       "2024.1",
+	EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	CreatedBy:     "system",
+	Factors: []domain.EmissionFactor{
+		{Category: "MEAT", KgCO2ePerKg: 27, Source: "baseline"},
+		{Category: "DAIRY", KgCO2ePerKg: 12, Source: "baseline"},
+		{Category: "PRODUCE", KgCO2ePerKg: 2.5, Source: "baseline"},
+		{Category: "BREAD", KgCO2ePerKg: 1.2, Source: "baseline"},
+		{Category: "MIXED", KgCO2ePerKg: 3.5, Source: "baseline"},
+	},
+}
+
+func newTestFactors(t *testing.T) *FactorService {
+	t.Helper()
+	repo := &memoryFactors{}
+	if err := repo.CreateVersion(context.Background(), baselineFactors); err != nil {
+		t.Fatal(err)
+	}
+	return NewFactorService(repo, zap.NewNop())
+}
+
+func newTestSigner(t *testing.T) *domain.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return domain.NewSigner(key)
+}
+
+func TestCarbonChain_ConcurrentAppendsVerifyAndTamperingIsFound(t *testing.T) {
+	ctx := context.Background()
+	ledger := &memoryLedger{}
+	svc := NewCarbonService(ledger, newTestFactors(t), newTestSigner(t), newTestSigner(t), zap.NewNop())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := svc.RecordSavings(ctx, "warung", uuid.NewString(), "PRODUCE", "", 5); err != nil {
+				t.Errorf("record: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, err := svc.VerifySinceLastRun(ctx)
+	if err != nil || !v.Intact || v.Checked != 20 || v.Through.Sequence != 20 {
+		t.Fatalf("expected 20 linked entries, got %+v, %v", v, err)
+	}
+
+	// The next scheduled run only walks what was appended since
+	for i := 0; i < 3; i++ {
+		if _, err := svc.RecordSavings(ctx, "bakery", uuid.NewString(), "BREAD", "", 2.345); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	// A redelivered DELIVERY.completed returns the stored entry, unchanged
+	recorded := ledger.entries[len(ledger.entries)-1]
+	again, err := svc.RecordSavings(ctx, "bakery", recorded.OrderID, "BREAD", "", 2.345)
+	if err != nil || again.Sequence != recorded.Sequence || again.Hash != recorded.Hash || len(ledger.entries) != 23 {
+		t.Fatalf("expected the order recorded once, got %+v with %d entries, %v", again, len(ledger.entries), err)
+	}
+	if v, err := svc.VerifySinceLastRun(ctx); err != nil || !v.Intact || v.Checked != 3 || v.From.Sequence != 20 {
+		t.Fatalf("expected an incremental run over 3 entries, got %+v, %v", v, err)
+	}
+
+	// Someone inflates a vendor's rescue in the database
+	ledger.entries[6].WeightKg = 50
+	full, err := svc.VerifyChain(ctx, domain.Genesis)
+	if err != nil || full.Intact || full.Broken.Sequence != 7 || full.Through.Sequence != 6 {
+		t.Fatalf("expected the break found at seq 7, got %+v, %v", full, err)
+	}
+
+	// Rehashing the edited entry just moves the break to the next link
+	ledger.entries[6].Hash = ledger.entries[6].ComputeHash()
+	if full, _ := svc.VerifyChain(ctx, domain.Genesis); full.Intact || full.Broken.Sequence != 8 {
+		t.Fatalf("expected the break found at seq 8, got %+v", full)
+	}
+
+	// Removing an entry leaves a gap
+	ledger.entries = append(ledger.entries[:21], ledger.entries[22:]...)
+	if full, _ := svc.VerifyChain(ctx, domain.Genesis); full.Intact || full.Broken.Sequence != 8 {
+		t.Fatalf("expected the first break still reported, got %+v", full)
+	}
+	if v, _ := svc.VerifyChain(ctx, domain.ChainTip{Sequence: 21, Hash: ledger.entries[20].Hash}); v.Intact || v.Broken.Sequence != 22 {
+		t.Fatalf("expected the missing seq 22 reported, got %+v", v)
+	}
+
+	// A break in new entries keeps being reported until it is repaired
+	if _, err := svc.RecordSavings(ctx, "bakery", uuid.NewString(), "BREAD", "", 1); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	ledger.entries[len(ledger.entries)-1].VendorID = "someone-else"
+	for i := 0; i < 2; i++ {
+		if v, _ := svc.VerifySinceLastRun(ctx); v.Intact || v.Broken.Sequence != 24 || v.From.Sequence != 23 {
+			t.Fatalf("run %d: expected seq 24 reported from the last good link, got %+v", i, v)
+		}
+	}
+}
+
+func TestCarbonCheckpoint_ProofsVerifyOfflineAndTamperingIsRejected(t *testing.T) {
+	ctx := context.Background()
+	ledger := &memoryLedger{}
+	svc := NewCarbonService(ledger, newTestFactors(t), newTestSigner(t), newTestSigner(t), zap.NewNop())
+
+	record := func(n int) {
+		for i := 0; i < n; i++ {
+			if _, err := svc.RecordSavings(ctx, "warung", uuid.NewString(), "PRODUCE", "", float64(i+1)); err != nil {
+				t.Fatalf("record: %v", err)
+			}
+		}
+	}
+	record(7)
+	if _, err := svc.InclusionProof(ctx, ledger.entries[0].ID); !errors.Is(err, domain.ErrNotCheckpointed) {
+		t.Fatalf("expected not checkpointed yet, got %v", err)
+	}
+
+	first, err := svc.Checkpoint(ctx)
+	if err != nil || len(first) != 1 || first[0].FromSeq != 1 || first[0].ThroughSeq != 7 {
+		t.Fatalf("expected one checkpoint over 1..7, got %+v, %v", first, err)
+	}
+	// Nothing new, nothing to sign
+	if again, err := svc.Checkpoint(ctx); err != nil || len(again) != 0 {
+		t.Fatalf("expected no new checkpoint, got %+v, %v", again, err)
+	}
+	record(5)
+	second, err := svc.Checkpoint(ctx)
+	if err != nil || len(second) != 1 || second[0].FromSeq != 8 || second[0].ThroughSeq != 12 {
+		t.Fatalf("expected the next checkpoint to continue at 8, got %+v, %v", second, err)
+	}
+
+	// An auditor only needs the published key and the proof
+	keyPEM, err := svc.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := domain.ParsePublicKey(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, e := range ledger.entries {
+		ids = append(ids, e.ID)
+	}
+	for _, id := range ids {
+		proof, err := svc.InclusionProof(ctx, id)
+		if err != nil {
+			t.Fatalf("proof for %s: %v", id, err)
+		}
+		if err := proof.Verify(pub); err != nil {
+			t.Fatalf("proof for seq %d does not verify: %v", proof.Entry.Sequence, err)
+		}
+	}
+
+	proof, _ := svc.InclusionProof(ctx, ids[3])
+	inflated := *proof
+	inflated.Entry.CarbonSavedKg *= 10
+	if err := inflated.Verify(pub); !errors.Is(err, domain.ErrInvalidProof) {
+		t.Fatalf("expected an inflated entry rejected, got %v", err)
+	}
+	forged := *proof
+	forged.Checkpoint.ThroughSeq++
+	forged.TreeSize++
+	if err := forged.Verify(pub); err == nil {
+		t.Fatal("expected a checkpoint altered after signing rejected")
+	}
+	if err := proof.Verify(newTestSigner(t).PublicKey()); !errors.Is(err, domain.ErrInvalidSignature) {
+		t.Fatalf("expected another key rejected, got %v", err)
+	}
+
+	// Once the database drifts from a signed root, no proof is served for it
+	ledger.entries[2].WeightKg = 99
+	ledger.entries[2].Hash = ledger.entries[2].ComputeHash()
+	if _, err := svc.InclusionProof(ctx, ids[0]); err == nil {
+		t.Fatal("expected a proof over a rewritten checkpoint refused")
+	}
+	if _, err := svc.InclusionProof(ctx, ids[9]); err != nil {
+		t.Fatalf("expected the untouched checkpoint still served, got %v", err)
+	}
+}
+
+func TestESGCertificate_VerifiesOfflineAndRejectsForgeries(t *testing.T) {
+	ctx := context.Background()
+	ledger := &memoryLedger{}
+	checkpointSigner, certificateSigner := newTestSigner(t), newTestSigner(t)
+	svc := NewCarbonService(ledger, newTestFactors(t), checkpointSigner, certificateSigner, zap.NewNop())
+
+	record := func(vendor string, kg float64) {
+		if _, err := svc.RecordSavings(ctx, vendor, uuid.NewString(), "MEAT", "", kg); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	// Two checkpoints' worth of the vendor's rescues, interleaved with another vendor's
+	for i := 0; i < 4; i++ {
+		record("warung", 1.1)
+		record("bakery", 3)
+	}
+	if _, err := svc.Checkpoint(ctx); err != nil {
+		t.Fatal(err)
+	}
+	record("warung", 0.7)
+
+	today := time.Now().UTC()
+	period, err := domain.CustomPeriod(today.AddDate(0, 0, -1), today.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.IssueCertificate(ctx, "nobody", period); !errors.Is(err, domain.ErrNoSavingsInPeriod) {
+		t.Fatalf("expected no savings for an unknown vendor, got %v", err)
+	}
+	issued, err := svc.IssueCertificate(ctx, "warung", period)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if issued.TransactionCount != 5 || len(issued.Checkpoints) != 2 || issued.KeyID != certificateSigner.KeyID() {
+		t.Fatalf("expected 5 entries over 2 checkpoints, got %d over %d", issued.TransactionCount, len(issued.Checkpoints))
+	}
+
+	// The auditor gets the JSON and the two public keys, nothing else
+	raw, _ := json.Marshal(issued)
+	load := func() *domain.Certificate {
+		var c domain.Certificate
+		if err := json.Unmarshal(raw, &c); err != nil {
+			t.Fatal(err)
+		}
+		return &c
+	}
+	if err := load().Verify(certificateSigner.PublicKey(), checkpointSigner.PublicKey()); err != nil {
+		t.Fatalf("expected the certificate to verify offline, got %v", err)
+	}
+	if v := svc.VerifyCertificate(load()); !v.Valid {
+		t.Fatalf("expected the verification endpoint to agree, got %+v", v)
+	}
+
+	forgeries := map[string]func(c *domain.Certificate){
+		"inflated total": func(c *domain.Certificate) { c.TotalCarbonSavedKg *= 2 },
+		"inflated entry and total": func(c *domain.Certificate) {
+			c.Entries[0].Entry.CarbonSavedKg += 100
+			c.TotalCarbonSavedKg += 100
+		},
+		"entry dropped": func(c *domain.Certificate) { c.Entries = c.Entries[1:] },
+		"another vendor's rescue": func(c *domain.Certificate) {
+			c.Entries[0].Entry.VendorID = "bakery"
+		},
+		"signed by the checkpoint key": func(c *domain.Certificate) { checkpointSigner.SignCertificate(c) },
+	}
+	for name, forge := range forgeries {
+		c := load()
+		forge(c)
+		if err := c.Verify(certificateSigner.PublicKey(), checkpointSigner.PublicKey()); !errors.Is(err, domain.ErrInvalidCertificate) {
+			t.Errorf("%s: expected the certificate rejected, got %v", name, err)
+		}
+	}
+
+	// Re-signing a doctored certificate needs our key, and the proofs still catch made-up entries
+	c := load()
+	c.Entries[1].Entry.WeightKg = 50
+	c.Entries[1].Entry.Hash = c.Entries[1].Entry.ComputeHash()
+	c.TotalFoodSavedKg = 0
+	for _, e := range c.Entries {
+		c.TotalFoodSavedKg += e.Entry.WeightKg
+	}
+	certificateSigner.SignCertificate(c)
+	if err := c.Verify(certificateSigner.PublicKey(), checkpointSigner.PublicKey()); !errors.Is(err, domain.ErrInvalidCertificate) {
+		t.Fatalf("expected an entry outside the checkpoint rejected, got %v", err)
+	}
+}
+
+func TestESGCertificate_ChainRollupCarriesVerifiedOutletSubtotals(t *testing.T) {
+	ctx := context.Background()
+	ledger := &memoryLedger{}
+	checkpointSigner, certificateSigner := newTestSigner(t), newTestSigner(t)
+	svc := NewCarbonService(ledger, newTestFactors(t), checkpointSigner, certificateSigner, zap.NewNop())
+
+	if _, err := svc.CreateChain(ctx, domain.Chain{Outlets: []string{"warung-menteng"}, CreatedBy: "admin"}); !errors.Is(err, domain.ErrInvalidChain) {
+		t.Fatalf("expected a chain without a name rejected, got %v", err)
+	}
+	chain, err := svc.CreateChain(ctx, domain.Chain{Name: "Warung Nusantara", Outlets: []string{"warung-menteng"}, CreatedBy: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.AddOutlet(ctx, chain.ID, "warung-kemang"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.AddOutlet(ctx, "no-such-chain", "warung-kemang"); !errors.Is(err, domain.ErrChainNotFound) {
+		t.Fatalf("expected an unknown chain, got %v", err)
+	}
+
+	for _, r := range []struct {
+		vendor, category string
+		kg               float64
+	}{{"warung-menteng", "MEAT", 2}, {"warung-kemang", "VEGETABLES", 5}, {"bakery", "BAKERY", 9}, {"warung-menteng", "VEGETABLES", 1}} {
+		if _, err := svc.RecordSavings(ctx, r.vendor, uuid.NewString(), r.category, "", r.kg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.Checkpoint(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	period, err := domain.MonthlyPeriod(time.Now().UTC().Year(), time.Now().UTC().Month())
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued, err := svc.IssueChainCertificate(ctx, chain.ID, period)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if issued.TransactionCount != 3 || issued.TotalFoodSavedKg != 8 || issued.PeriodLabel != period.Label {
+		t.Fatalf("expected the two outlets' 3 rescues of 8 kg, got %d of %v kg", issued.TransactionCount, issued.TotalFoodSavedKg)
+	}
+	subtotals := make(map[string]domain.OutletTotals)
+	for _, o := range issued.Outlets {
+		subtotals[o.VendorID] = o
+	}
+	if subtotals["warung-menteng"].TransactionCount != 2 || subtotals["warung-kemang"].FoodSavedKg != 5 {
+		t.Fatalf("unexpected outlet subtotals: %+v", issued.Outlets)
+	}
+	if err := issued.Verify(certificateSigner.PublicKey(), checkpointSigner.PublicKey()); err != nil {
+		t.Fatalf("expected the rollup to verify, got %v", err)
+	}
+
+	// Moving savings between outlets keeps the total but not the signature or the subtotals
+	moved := *issued
+	moved.Outlets = slices.Clone(issued.Outlets)
+	moved.Outlets[0].CarbonSavedKg += 1
+	moved.Outlets[1].CarbonSavedKg -= 1
+	if err := moved.Verify(certificateSigner.PublicKey(), checkpointSigner.PublicKey()); !errors.Is(err, domain.ErrInvalidCertificate) {
+		t.Fatalf("expected shifted subtotals rejected, got %v", err)
+	}
+	certificateSigner.SignCertificate(&moved)
+	if err := moved.Verify(certificateSigner.PublicKey(), checkpointSigner.PublicKey()); !errors.Is(err, domain.ErrInvalidCertificate) {
+		t.Fatalf("expected re-signed subtotals that disagree with the entries rejected, got %v", err)
+	}
+}
+
+func TestEmissionFactors_VersionsRegionsAndRestatement(t *testing.T) {
+	ctx := context.Background()
+	ledger := &memoryLedger{}
+	factors := newTestFactors(t)
+	svc := NewCarbonService(ledger, factors, newTestSigner(t), newTestSigner(t), zap.NewNop())
+
+	record := func(category, region string, kg float64) *domain.CarbonEntry {
+		t.Helper()
+		e, err := svc.RecordSavings(ctx, "warung", uuid.NewString(), category, region, kg)
+		if err != nil {
+			t.Fatalf("record: %v", err)
+		}
+		return e
+	}
+	if e := record("PRODUCE", "ID-JK", 4); e.FactorVersion != "2024.1" || e.FactorKgCO2e != 2.5 || e.CarbonSavedKg != 10 {
+		t.Fatalf("expected the baseline produce factor, got %+v", e)
+	}
+	if e := record("SEAFOOD", "", 2); e.FactorKgCO2e != 3.5 {
+		t.Fatalf("expected an unlisted category priced with MIXED, got %+v", e)
+	}
+
+	revised := domain.FactorVersion{
+		Version:   "2025.1",
+		CreatedBy: "esg-team",
+		Factors: []domain.EmissionFactor{
+			{Category: "PRODUCE", KgCO2ePerKg: 2, Source: "national study"},
+			{Category: "PRODUCE", Region: "ID-JK", KgCO2ePerKg: 3, Source: "Jakarta landfill methane data"},
+			{Category: "MIXED", KgCO2ePerKg: 4, Source: "national study"},
+		},
+	}
+	invalid := map[string]func(v *domain.FactorVersion){
+		"no fallback": func(v *domain.FactorVersion) { v.Factors = v.Factors[:2] },
+		"unsourced factor": func(v *domain.FactorVersion) {
+			v.Factors = []domain.EmissionFactor{{Category: "MIXED", KgCO2ePerKg: 4}}
+		},
+		"negative factor": func(v *domain.FactorVersion) {
+			v.Factors = []domain.EmissionFactor{{Category: "MIXED", KgCO2ePerKg: -1, Source: "x"}}
+		},
+		"duplicated override": func(v *domain.FactorVersion) { v.Factors = append(v.Factors, v.Factors[1]) },
+		"backdated":           func(v *domain.FactorVersion) { v.EffectiveFrom = time.Now().AddDate(0, -1, 0) },
+	}
+	for name, spoil := range invalid {
+		v := revised
+		v.Factors = append([]domain.EmissionFactor(nil), revised.Factors...)
+		spoil(&v)
+		if _, err := factors.Publish(ctx, v); !errors.Is(err, domain.ErrInvalidFactorVersion) {
+			t.Errorf("%s: expected the version rejected, got %v", name, err)
+		}
+	}
+	if _, err := factors.Publish(ctx, revised); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if _, err := factors.Publish(ctx, revised); !errors.Is(err, domain.ErrFactorVersionExists) {
+		t.Fatalf("expected a taken version name refused, got %v", err)
+	}
+
+	// New savings use the new version, with Jakarta's override
+	if e := record("PRODUCE", "ID-JK", 4); e.FactorVersion != "2025.1" || e.CarbonSavedKg != 12 {
+		t.Fatalf("expected the Jakarta override, got %+v", e)
+	}
+	if e := record("PRODUCE", "ID-JB", 4); e.CarbonSavedKg != 8 {
+		t.Fatalf("expected the national figure outside Jakarta, got %+v", e)
+	}
+
+	// Restating under 2025.1 reprices the old entries and leaves the ledger alone
+	before := append([]domain.CarbonEntry(nil), ledger.entries...)
+	start := time.Now().UTC().AddDate(0, 0, -1)
+	r, err := svc.Restate(ctx, "warung", start, start.AddDate(0, 0, 2), "2025.1")
+	if err != nil {
+		t.Fatalf("restate: %v", err)
+	}
+	if r.TransactionCount != 4 || r.RecordedCarbonSavedKg != 10+7+12+8 || r.RestatedCarbonSavedKg != 12+8+12+8 {
+		t.Fatalf("unexpected restatement %+v", r)
+	}
+	if len(r.RecordedVersions) != 2 || len(r.Categories) != 2 || r.Categories[0].Category != "PRODUCE" || r.Categories[1].RestatedCarbonSavedKg != 8 {
+		t.Fatalf("unexpected breakdown %+v", r)
+	}
+	for i := range before {
+		if ledger.entries[i] != before[i] {
+			t.Fatalf("restating rewrote entry %d", i+1)
+		}
+	}
+	if v, err := svc.VerifyChain(ctx, domain.Genesis); err != nil || !v.Intact {
+		t.Fatalf("expected the chain intact after restating, got %+v, %v", v, err)
+	}
+	if _, err := svc.Restate(ctx, "warung", start, start.AddDate(0, 0, 2), "1999.1"); !errors.Is(err, domain.ErrFactorVersionNotFound) {
+		t.Fatalf("expected an unknown version reported, got %v", err)
+	}
+}
+
+// memoryCredits keeps credit accounts and tokens next to the ledger they are issued from
+type memoryCredits struct {
+	*memoryLedger
+	accounts map[string]domain.CreditAccount
+	tokens   map[string]*domain.CreditToken
+	issued   []string // Token IDs in issue order
+	events   []domain.CreditEvent
+}
+
+func newMemoryCredits(ledger *memoryLedger) *memoryCredits {
+	return &memoryCredits{memoryLedger: ledger, accounts: make(map[string]domain.CreditAccount), tokens: make(map[string]*domain.CreditToken)}
+}
+
+func (m *memoryCredits) CreditProviders(_ context.Context, throughSeq int64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []string
+	for _, e := range m.entries {
+		if e.Sequence <= throughSeq && e.Sequence > m.accounts[e.VendorID].IssuedThroughSeq && !slices.Contains(out, e.VendorID) {
+			out = append(out, e.VendorID)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (m *memoryCredits) ProviderEntries(_ context.Context, providerID string, fromSeq, throughSeq int64) ([]domain.CarbonEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []domain.CarbonEntry
+	for _, e := range m.entries {
+		if e.VendorID == providerID && e.Sequence >= fromSeq && e.Sequence <= throughSeq {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryCredits) GetCreditAccount(_ context.Context, providerID string) (*domain.CreditAccount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[providerID]
+	if !ok {
+		return nil, domain.ErrCreditAccountNotFound
+	}
+	return &a, nil
+}
+
+func (m *memoryCredits) IssueCredits(_ context.Context, prevThroughSeq int64, a domain.CreditAccount, tokens []domain.CreditToken, events []domain.CreditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.accounts[a.ProviderID].IssuedThroughSeq != prevThroughSeq {
+		return domain.ErrCreditsConflict
+	}
+	m.accounts[a.ProviderID] = a
+	for _, t := range tokens {
+		m.tokens[t.ID] = &t
+		m.issued = append(m.issued, t.ID)
+	}
+	m.events = append(m.events, events...)
+	return nil
+}
+
+func (m *memoryCredits) GetCreditToken(_ context.Context, id string) (*domain.CreditToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tokens[id]
+	if !ok {
+		return nil, domain.ErrCreditTokenNotFound
+	}
+	out := *t
+	return &out, nil
+}
+
+func (m *memoryCredits) ListCreditTokens(_ context.Context, ownerID string, status domain.CreditTokenStatus) ([]domain.CreditToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []domain.CreditToken
+	for _, id := range m.issued {
+		if t := m.tokens[id]; t.OwnerID == ownerID && (status == "" || t.Status == status) {
+			out = append(out, *t)
+		}
+	}
+	return out, nil
+}
+
+// ApplyCreditEvents stages the changes and keeps them only if every event applies
+func (m *memoryCredits) ApplyCreditEvents(_ context.Context, events []domain.CreditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	staged := make(map[string]domain.CreditToken)
+	for _, e := range events {
+		t, ok := staged[e.TokenID]
+		if !ok {
+			current, exists := m.tokens[e.TokenID]
+			if !exists {
+				return domain.ErrCreditTokenNotFound
+			}
+			t = *current
+		}
+		if t.Status != domain.CreditActive || t.OwnerID != e.FromOwner {
+			return domain.ErrCreditTokenUnavailable
+		}
+		if e.Type == domain.CreditEventRetired {
+			at := e.At
+			t.Status, t.RetiredAt = domain.CreditRetired, &at
+		} else {
+			t.OwnerID = e.ToOwner
+		}
+		staged[e.TokenID] = t
+	}
+	for id, t := range staged {
+		*m.tokens[id] = t
+	}
+	m.events = append(m.events, events...)
+	return nil
+}
+
+func (m *memoryCredits) CreditHistory(_ context.Context, tokenID string) ([]domain.CreditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []domain.CreditEvent
+	for _, e := range m.events {
+		if e.TokenID == tokenID {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func TestCarbonCredits_IssuedFromCheckpointsWithCarryAndMovedOnce(t *testing.T) {
+	ctx := context.Background()
+	ledger := &memoryLedger{}
+	repo := newMemoryCredits(ledger)
+	carbon := NewCarbonService(ledger, newTestFactors(t), newTestSigner(t), newTestSigner(t), zap.NewNop())
+	// 10 kg CO2e a token, and nothing issued below 2 tokens
+	credits := NewCreditService(repo, domain.CreditPolicy{GramsPerToken: 10_000, MinTokens: 2}, zap.NewNop())
+
+	record := func(vendor, category string, kg float64) {
+		if _, err := carbon.RecordSavings(ctx, vendor, uuid.NewString(), category, "", kg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	issue := func() []domain.CreditToken {
+		tokens, err := credits.Issue(ctx)
+		if err != nil {
+			t.Fatalf("issue: %v", err)
+		}
+		return tokens
+	}
+	checkpoint := func() {
+		if _, err := carbon.Checkpoint(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record("warung", "PRODUCE", 3) // 7.5 kg CO2e
+	record("bakery", "BREAD", 1)   // 1.2 kg
+	record("warung", "MEAT", 0.5)  // 13.5 kg
+	if tokens := issue(); len(tokens) != 0 {
+		t.Fatalf("expected nothing issued before a checkpoint, got %d", len(tokens))
+	}
+
+	checkpoint()
+	first := issue()
+	if len(first) != 2 {
+		t.Fatalf("expected 21 kg to be 2 tokens, got %d", len(first))
+	}
+	if b := first[0].Backing; len(b) != 2 || b[0].Grams != 7500 || b[1].Grams != 2500 {
+		t.Fatalf("expected the first token backed by the first entry and part of the third, got %+v", b)
+	}
+	account, err := credits.Account(ctx, "warung")
+	if err != nil || account.CarryGrams != 1000 || account.TokensIssued != 2 {
+		t.Fatalf("expected 1 kg carried forward, got %+v (%v)", account, err)
+	}
+	if bakery, _ := credits.Account(ctx, "bakery"); bakery == nil || bakery.CarryGrams != 1200 || bakery.TokensIssued != 0 {
+		t.Fatalf("expected the bakery's 1.2 kg carried, got %+v", bakery)
+	}
+
+	// One more token's worth is still under the minimum, so it all carries
+	record("warung", "MEAT", 0.4) // 10.8 kg
+	checkpoint()
+	if tokens := issue(); len(tokens) != 0 {
+		t.Fatalf("expected nothing below the minimum, got %d", len(tokens))
+	}
+	record("warung", "MEAT", 0.4)
+	checkpoint()
+	second := issue()
+	if len(second) != 2 {
+		t.Fatalf("expected 22.6 kg to be 2 tokens, got %d", len(second))
+	}
+	if tokens := issue(); len(tokens) != 0 {
+		t.Fatalf("expected a rerun to issue nothing, got %d", len(tokens))
+	}
+
+	// No gram of an entry backs two tokens, and issued plus carried is all of it
+	spent := make(map[string]int64)
+	var credited int64
+	for _, tok := range append(first, second...) {
+		var sum int64
+		for _, b := range tok.Backing {
+			spent[b.EntryID] += b.Grams
+			sum += b.Grams
+		}
+		if sum != tok.Grams {
+			t.Fatalf("token %s is backed by %d g, not %d", tok.ID, sum, tok.Grams)
+		}
+		credited += sum
+	}
+	var recorded int64
+	for _, e := range ledger.entries {
+		if e.VendorID == "warung" {
+			recorded += domain.Grams(e.CarbonSavedKg)
+			if spent[e.ID] > domain.Grams(e.CarbonSavedKg) {
+				t.Fatalf("entry %d is spent %d g over its savings", e.Sequence, spent[e.ID])
+			}
+		}
+	}
+	account, _ = credits.Account(ctx, "warung")
+	if credited+account.CarryGrams != recorded || account.CarryGrams != 2600 {
+		t.Fatalf("expected %d g issued or carried, got %d issued and %d carried", recorded, credited, account.CarryGrams)
+	}
+
+	// Transfers are all or nothing and only from the holder
+	move := func(tokens ...domain.CreditToken) []string {
+		var ids []string
+		for _, tok := range tokens {
+			ids = append(ids, tok.ID)
+		}
+		return ids
+	}
+	if _, err := credits.Transfer(ctx, domain.CreditTransfer{From: "warung", To: "corp", TokenIDs: move(first[0])}); !errors.Is(err, domain.ErrInvalidCreditMove) {
+		t.Fatalf("expected a transfer without an actor rejected, got %v", err)
+	}
+	if _, err := credits.Transfer(ctx, domain.CreditTransfer{From: "warung", To: "corp", TokenIDs: move(first...), TransferredBy: "admin"}); err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	_, err = credits.Transfer(ctx, domain.CreditTransfer{From: "warung", To: "corp", TokenIDs: move(second[0], first[1]), TransferredBy: "admin"})
+	if !errors.Is(err, domain.ErrCreditTokenUnavailable) {
+		t.Fatalf("expected a token the warung no longer holds refused, got %v", err)
+	}
+	if held, _ := credits.Tokens(ctx, "warung", domain.CreditActive); len(held) != 2 {
+		t.Fatalf("expected the refused transfer to move nothing, warung holds %d", len(held))
+	}
+
+	// A retired token is spent for good
+	retire := domain.CreditRetirement{Owner: "corp", TokenIDs: move(first[0]), Beneficiary: "PT Corp 2025 scope 3", RetiredBy: "corp-esg"}
+	if _, err := credits.Retire(ctx, retire); err != nil {
+		t.Fatalf("retire: %v", err)
+	}
+	if _, err := credits.Retire(ctx, retire); !errors.Is(err, domain.ErrCreditTokenUnavailable) {
+		t.Fatalf("expected a second retirement refused, got %v", err)
+	}
+	if _, err := credits.Transfer(ctx, domain.CreditTransfer{From: "corp", To: "broker", TokenIDs: move(first[0]), TransferredBy: "corp-esg"}); !errors.Is(err, domain.ErrCreditTokenUnavailable) {
+		t.Fatalf("expected a retired token not transferable, got %v", err)
+	}
+	history, err := credits.History(ctx, first[0].ID)
+	if err != nil || len(history) != 3 || history[0].Type != domain.CreditEventIssued ||
+		history[1].ToOwner != "corp" || history[2].Beneficiary != retire.Beneficiary {
+		t.Fatalf("expected issued, transferred and retired, got %+v (%v)", history, err)
+	}
+	if _, err := credits.History(ctx, "no-such-token"); !errors.Is(err, domain.ErrCreditTokenNotFound) {
+		t.Fatalf("expected an unknown token, got %v", err)
+	}
+
+	// A broken chain halts issuance
+	record("warung", "MEAT", 1)
+	checkpoint()
+	ledger.verifications = append(ledger.verifications, domain.ChainVerification{Intact: false, Broken: &domain.ChainBreak{Sequence: 2}})
+	if _, err := credits.Issue(ctx); !errors.Is(err, domain.ErrLedgerUnverified) {
+		t.Fatalf("expected issuance halted on a broken chain, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+)
+
+type CreditRepo interface {
+	LatestCheckpoint(ctx context.Context) (*domain.Checkpoint, error)
+	LatestVerification(ctx context.Context) (*domain.ChainVerification, error)
+
+	// CreditProviders lists providers with entries through throughSeq not counted yet
+	CreditProviders(ctx context.Context, throughSeq int64) ([]string, error)
+	ProviderEntries(ctx context.Context, providerID string, fromSeq, throughSeq int64) ([]domain.CarbonEntry, error)
+	GetCreditAccount(ctx context.Context, providerID string) (*domain.CreditAccount, error)
+	// IssueCredits is ErrCreditsConflict when the account moved past prevThroughSeq meanwhile
+	IssueCredits(ctx context.Context, prevThroughSeq int64, a domain.CreditAccount, tokens []domain.CreditToken, events []domain.CreditEvent) error
+
+	GetCreditToken(ctx context.Context, id string) (*domain.CreditToken, error)
+	ListCreditTokens(ctx context.Context, ownerID string, status domain.CreditTokenStatus) ([]domain.CreditToken, error)
+	// ApplyCreditEvents is ErrCreditTokenUnavailable when a token is retired or not the sender's
+	ApplyCreditEvents(ctx context.Context, events []domain.CreditEvent) error
+	CreditHistory(ctx context.Context, tokenID string) ([]domain.CreditEvent, error)
+}
+
+// CreditService issues carbon credit tokens from checkpointed ledger savings
+// and keeps track of who holds them until they are retired
+type CreditService struct {
+	repo   CreditRepo
+	policy domain.CreditPolicy
+	logger *zap.Logger
+}
+
+func NewCreditService(repo CreditRepo, policy domain.CreditPolicy, logger *zap.Logger) *CreditService {
+	return &CreditService{repo: repo, policy: policy, logger: logger}
+}
+
+func (s *CreditService) Policy() domain.CreditPolicy {
+	return s.policy
+}
+
+// Issue converts every provider's savings up to the latest signed checkpoint
+// into whole tokens, carrying remainders forward. It halts while the last
+// scheduled verification has the chain broken. A provider another run is
+// issuing to concurrently is left to the next run.
+func (s *CreditService) Issue(ctx context.Context) ([]domain.CreditToken, error) {
+	v, err := s.repo.LatestVerification(ctx)
+	switch {
+	case err == nil && !v.Intact:
+		return nil, domain.ErrLedgerUnverified
+	case err != nil && !errors.Is(err, domain.ErrVerificationNotFound):
+		return nil, err
+	}
+	checkpoint, err := s.repo.LatestCheckpoint(ctx)
+	if errors.Is(err, domain.ErrCheckpointNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	providers, err := s.repo.CreditProviders(ctx, checkpoint.ThroughSeq)
+	if err != nil {
+		return nil, err
+	}
+	var issued []domain.CreditToken
+	for _, providerID := range providers {
+		tokens, err := s.issueTo(ctx, providerID, checkpoint.ThroughSeq)
+		if errors.Is(err, domain.ErrCreditsConflict) {
+			continue
+		}
+		if err != nil {
+			return issued, err
+		}
+		issued = append(issued, tokens...)
+	}
+	return issued, nil
+}
+
+func (s *CreditService) issueTo(ctx context.Context, providerID string, throughSeq int64) ([]domain.CreditToken, error) {
+	account, err := s.repo.GetCreditAccount(ctx, providerID)
+	if errors.Is(err, domain.ErrCreditAccountNotFound) {
+		account = &domain.CreditAccount{ProviderID: providerID}
+	} else if err != nil {
+		return nil, err
+	}
+	if account.IssuedThroughSeq >= throughSeq {
+		return nil, nil
+	}
+
+	entries, err := s.repo.ProviderEntries(ctx, providerID, account.NextSeq, throughSeq)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	next, tokens := account.Mint(entries, throughSeq, s.policy, now, func() string { return uuid.New().String() })
+	events := make([]domain.CreditEvent, 0, len(tokens))
+	for _, t := range tokens {
+		events = append(events, domain.CreditEvent{
+			ID: uuid.New().String(), TokenID: t.ID, Type: domain.CreditEventIssued,
+			ToOwner: t.OwnerID, Actor: "issuer", At: now,
+		})
+	}
+	if err := s.repo.IssueCredits(ctx, account.IssuedThroughSeq, next, tokens, events); err != nil {
+		return nil, err
+	}
+
+	if len(tokens) > 0 {
+		s.logger.Info("Carbon credits issued",
+			zap.String("provider_id", providerID),
+			zap.Int("tokens", len(tokens)),
+			zap.Int64("through_seq", throughSeq),
+			zap.Int64("carry_grams", next.CarryGrams))
+	}
+	return tokens, nil
+}
+
+// RunCreditIssuer issues credits for newly checkpointed savings every interval
+func (s *CreditService) RunCreditIssuer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Issue(ctx); err != nil {
+				s.logger.Error("Carbon credit issuance failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *CreditService) Account(ctx context.Context, providerID string) (*domain.CreditAccount, error) {
+	return s.repo.GetCreditAccount(ctx, providerID)
+}
+
+func (s *CreditService) Token(ctx context.Context, id string) (*domain.CreditToken, error) {
+	return s.repo.GetCreditToken(ctx, id)
+}
+
+// Tokens lists what the owner holds; any status when status is empty
+func (s *CreditService) Tokens(ctx context.Context, ownerID string, status domain.CreditTokenStatus) ([]domain.CreditToken, error) {
+	return s.repo.ListCreditTokens(ctx, ownerID, status)
+}
+
+// History is the token's issuance, transfers and retirement, oldest first
+func (s *CreditService) History(ctx context.Context, tokenID string) ([]domain.CreditEvent, error) {
+	if _, err := s.repo.GetCreditToken(ctx, tokenID); err != nil {
+		return nil, err
+	}
+	return s.repo.CreditHistory(ctx, tokenID)
+}
+
+// Transfer hands the tokens over, all of them or none
+func (s *CreditService) Transfer(ctx context.Context, t domain.CreditTransfer) ([]domain.CreditEvent, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	events := make([]domain.CreditEvent, 0, len(t.TokenIDs))
+	for _, id := range t.TokenIDs {
+		events = append(events, domain.CreditEvent{
+			ID: uuid.New().String(), TokenID: id, Type: domain.CreditEventTransferred,
+			FromOwner: t.From, ToOwner: t.To, Note: t.Note, Actor: t.TransferredBy, At: now,
+		})
+	}
+	if err := s.repo.ApplyCreditEvents(ctx, events); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Carbon credits transferred",
+		zap.String("from", t.From), zap.String("to", t.To),
+		zap.Int("tokens", len(t.TokenIDs)), zap.String("transferred_by", t.TransferredBy))
+	return events, nil
+}
+
+// Retire claims the tokens for the beneficiary for good, all of them or none
+func (s *CreditService) Retire(ctx context.Context, r domain.CreditRetirement) ([]domain.CreditEvent, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	events := make([]domain.CreditEvent, 0, len(r.TokenIDs))
+	for _, id := range r.TokenIDs {
+		events = append(events, domain.CreditEvent{
+			ID: uuid.New().String(), TokenID: id, Type: domain.CreditEventRetired,
+			FromOwner: r.Owner, Beneficiary: r.Beneficiary, Note: r.Reason, Actor: r.RetiredBy, At: now,
+		})
+	}
+	if err := s.repo.ApplyCreditEvents(ctx, events); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Carbon credits retired",
+		zap.String("owner", r.Owner), zap.String("beneficiary", r.Beneficiary),
+		zap.Int("tokens", len(r.TokenIDs)), zap.String("retired_by", r.RetiredBy))
+	return events, nil
+}
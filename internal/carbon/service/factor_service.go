@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
+)
+
+type FactorRepo interface {
+	// CreateVersion is ErrFactorVersionExists when the version name is taken
+	CreateVersion(ctx context.Context, v domain.FactorVersion) error
+	GetVersion(ctx context.Context, version string) (*domain.FactorVersion, error)
+	EffectiveVersion(ctx context.Context, at time.Time) (*domain.FactorVersion, error)
+	ListVersions(ctx context.Context) ([]domain.FactorVersion, error)
+}
+
+// FactorService manages the emission factor table: versioned methodologies
+// that take effect on a date and are never edited once published
+type FactorService struct {
+	repo   FactorRepo
+	logger *zap.Logger
+}
+
+func NewFactorService(repo FactorRepo, logger *zap.Logger) *FactorService {
+	return &FactorService{repo: repo, logger: logger}
+}
+
+// Publish adds a new version. It takes effect from EffectiveFrom, now if
+// unset; it may not take effect in the past, so what was in force when an
+// entry was recorded never changes afterwards.
+func (s *FactorService) Publish(ctx context.Context, v domain.FactorVersion) (*domain.FactorVersion, error) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if v.EffectiveFrom.IsZero() {
+		v.EffectiveFrom = now
+	}
+	if v.EffectiveFrom.Before(now.Add(-time.Minute)) {
+		return nil, fmt.Errorf("%w: effective_from may not be in the past", domain.ErrInvalidFactorVersion)
+	}
+	if err := v.Validate(); err != nil {
+		return nil, err
+	}
+	v.EffectiveFrom = v.EffectiveFrom.UTC().Truncate(time.Microsecond)
+	v.CreatedAt = now
+
+	if err := s.repo.CreateVersion(ctx, v); err != nil {
+		return nil, err
+	}
+	s.logger.Info("Emission factor version published",
+		zap.String("version", v.Version),
+		zap.Time("effective_from", v.EffectiveFrom),
+		zap.Int("factors", len(v.Factors)),
+		zap.String("created_by", v.CreatedBy))
+	return &v, nil
+}
+
+func (s *FactorService) Version(ctx context.Context, version string) (*domain.FactorVersion, error) {
+	return s.repo.GetVersion(ctx, version)
+}
+
+// Versions lists every version, newest first
+func (s *FactorService) Versions(ctx context.Context) ([]domain.FactorVersion, error) {
+	return s.repo.ListVersions(ctx)
+}
+
+// Effective is the version in force at the given time
+func (s *FactorService) Effective(ctx context.Context, at time.Time) (*domain.FactorVersion, error) {
+	return s.repo.EffectiveVersion(ctx, at)
+}
@@ -2,42 +2,188 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
+	authDomain "github.com/albnnaardy11/pahlawan-pangan/internal/auth/domain"
+	iamMiddleware "github.com/albnnaardy11/pahlawan-pangan/internal/auth/middleware"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/domain"
+	escrowDomain "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
 )
 
+// maxEvidenceSize bounds one uploaded file (photos, sensor exports, receipts)
+const maxEvidenceSize = 10 << 20
+
 type DisputeHandler struct {
 	Usecase domain.DisputeUsecase
 }
 
-func NewDisputeHandler(r chi.Router, us domain.DisputeUsecase) {
-	handler := &DisputeHandler{
+func NewDisputeHandler(us domain.DisputeUsecase) *DisputeHandler {
+	return &DisputeHandler{
 		Usecase: us,
 	}
-
-	r.Route("/api/v1/dispute", func(r chi.Router) {
-		r.Post("/", handler.RaiseDispute)
-	})
 }
 
+// POST /api/v1/disputes
+// Raised by the signed-in user on their own claim
 func (h *DisputeHandler) RaiseDispute(w http.ResponseWriter, r *http.Request) {
+	user, ok := iamMiddleware.CurrentUser(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	var dispute domain.Dispute
 	if err := json.NewDecoder(r.Body).Decode(&dispute); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	dispute.UserID = user.ID
+	if dispute.ClaimID == "" || dispute.Reason == "" {
+		http.Error(w, "claim_id and reason are required", http.StatusBadRequest)
+		return
+	}
 
 	if err := h.Usecase.RaiseDispute(r.Context(), &dispute); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(dispute)
+}
+
+// GET /api/v1/disputes/{id}
+func (h *DisputeHandler) GetDispute(w http.ResponseWriter, r *http.Request) {
+	dispute, evidence, err := h.Usecase.GetDispute(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
-	_ = json.NewEncoder(w).Encode(map[string]string{
-		"message": "Dispute submitted. Our legal team and AI will review the freshness quality.",
-		"status":  "PENDING_REVIEW",
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"dispute":  dispute,
+		"evidence": evidence,
 	})
 }
+
+// POST /api/v1/disputes/{id}/evidence
+// multipart/form-data with a note and a file; or JSON with a url. Submitted
+// as the signed-in user.
+func (h *DisputeHandler) AddEvidence(w http.ResponseWriter, r *http.Request) {
+	user, ok := iamMiddleware.CurrentUser(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	evidence := &domain.DisputeEvidence{DisputeID: chi.URLParam(r, "id")}
+	var file io.Reader
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(evidence); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		evidence.DisputeID = chi.URLParam(r, "id")
+	} else {
+		r.Body = http.MaxBytesReader(w, r.Body, maxEvidenceSize+1<<20)
+		if err := r.ParseMultipartForm(maxEvidenceSize); err != nil {
+			http.Error(w, "evidence must be a multipart upload under 10MB", http.StatusBadRequest)
+			return
+		}
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "file is required", http.StatusBadRequest)
+			return
+		}
+		defer func() { _ = f.Close() }()
+		evidence.Note = r.FormValue("note")
+		evidence.FileName = header.Filename
+		evidence.ContentType = header.Header.Get("Content-Type")
+		file = f
+	}
+	evidence.SubmittedBy = user.ID
+
+	if err := h.Usecase.AddEvidence(r.Context(), evidence, file); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(evidence)
+}
+
+// POST /api/v1/disputes/{id}/review (admin)
+// The signed-in admin takes the dispute
+func (h *DisputeHandler) StartReview(w http.ResponseWriter, r *http.Request) {
+	user, ok := iamMiddleware.CurrentUser(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Usecase.StartReview(r.Context(), chi.URLParam(r, "id"), user.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/v1/disputes/{id}/resolve (admin)
+// Decided by the signed-in admin
+func (h *DisputeHandler) ResolveDispute(w http.ResponseWriter, r *http.Request) {
+	user, ok := iamMiddleware.CurrentUser(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var res domain.Resolution
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res.ResolvedBy = user.ID
+	if !res.Outcome.Resolved() {
+		http.Error(w, "outcome must be approved, rejected or partially_refunded", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Usecase.ResolveDispute(r.Context(), chi.URLParam(r, "id"), res); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrDisputeNotFound), errors.Is(err, domain.ErrClaimNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, domain.ErrNotDisputeParty):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, domain.ErrDisputeAlreadyOpen),
+		errors.Is(err, domain.ErrInvalidDisputeTransition),
+		errors.Is(err, escrowDomain.ErrInvalidTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, domain.ErrInvalidRefundAmount):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *DisputeHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Post("/", h.RaiseDispute)
+	r.Get("/{id}", h.GetDispute)
+	r.Post("/{id}/evidence", h.AddEvidence)
+	r.With(iamMiddleware.RoleGuard(authDomain.RoleAdmin)).Post("/{id}/review", h.StartReview)
+	r.With(iamMiddleware.RoleGuard(authDomain.RoleAdmin)).Post("/{id}/resolve", h.ResolveDispute)
+	return r
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/domain"
+)
+
+type fileEvidenceStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewFileEvidenceStore writes uploads under dir and serves them from baseURL;
+// swap for object storage once evidence outgrows a single node
+func NewFileEvidenceStore(dir, baseURL string) domain.EvidenceStore {
+	return &fileEvidenceStore{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (s *fileEvidenceStore) Save(_ context.Context, key, _ string, r io.Reader) (string, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(s.dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("evidence key %q escapes the store", key)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return "", err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return s.baseURL + "/" + key, nil
+}
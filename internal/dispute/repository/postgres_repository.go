@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/domain"
+)
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository keeps disputes in disputes and their evidence in the
+// append-only dispute_evidence table. A claim has at most one unresolved dispute.
+func NewPostgresRepository(db *sql.DB) domain.DisputeRepository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) Create(ctx context.Context, d *domain.Dispute) error {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO disputes (id, claim_id, payment_id, user_id, provider_id, reason, evidence_url, status,
+		                      claimant_evidence_due_at, response_due_at, claimant_evidence_at, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (claim_id) WHERE status IN ('opened', 'under_review') DO NOTHING
+	`, d.ID, d.ClaimID, d.PaymentID, d.UserID, d.ProviderID, d.Reason, d.Evidence, d.Status,
+		d.ClaimantEvidenceDueAt.UTC(), d.ResponseDueAt.UTC(), utc(d.ClaimantEvidenceAt), d.CreatedAt.UTC(), d.UpdatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrDisputeAlreadyOpen
+	}
+	return nil
+}
+
+const disputeColumns = `id, claim_id, COALESCE(payment_id, ''), user_id, provider_id, reason, evidence_url, status,
+	refund_amount, resolution, resolved_by, claimant_evidence_due_at, response_due_at, review_due_at,
+	claimant_evidence_at, responded_at, escalated_at, created_at, updated_at, resolved_at`
+
+func scanDispute(row interface{ Scan(...any) error }) (*domain.Dispute, error) {
+	var d domain.Dispute
+	var reviewDue, claimantEvidence, responded, escalated, resolved sql.NullTime
+	err := row.Scan(&d.ID, &d.ClaimID, &d.PaymentID, &d.UserID, &d.ProviderID, &d.Reason, &d.Evidence, &d.Status,
+		&d.RefundAmount, &d.Resolution, &d.ResolvedBy, &d.ClaimantEvidenceDueAt, &d.ResponseDueAt, &reviewDue,
+		&claimantEvidence, &responded, &escalated, &d.CreatedAt, &d.UpdatedAt, &resolved)
+	if err != nil {
+		return nil, err
+	}
+	d.ReviewDueAt = timePtr(reviewDue)
+	d.ClaimantEvidenceAt = timePtr(claimantEvidence)
+	d.RespondedAt = timePtr(responded)
+	d.EscalatedAt = timePtr(escalated)
+	d.ResolvedAt = timePtr(resolved)
+	return &d, nil
+}
+
+func (r *postgresRepository) Get(ctx context.Context, id string) (*domain.Dispute, error) {
+	d, err := scanDispute(r.db.QueryRowContext(ctx, `SELECT `+disputeColumns+` FROM disputes WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrDisputeNotFound
+	}
+	return d, err
+}
+
+// Update is a compare-and-set on the status, so a reviewer and the deadline
+// enforcer cannot both decide the same dispute
+func (r *postgresRepository) Update(ctx context.Context, d *domain.Dispute, expected domain.DisputeStatus) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE disputes
+		SET status = $3, refund_amount = $4, resolution = $5, resolved_by = $6, review_due_at = $7,
+		    claimant_evidence_at = $8, responded_at = $9, escalated_at = $10, resolved_at = $11, updated_at = $12
+		WHERE id = $1 AND status = $2
+	`, d.ID, expected, d.Status, d.RefundAmount, d.Resolution, d.ResolvedBy, utc(d.ReviewDueAt),
+		utc(d.ClaimantEvidenceAt), utc(d.RespondedAt), utc(d.EscalatedAt), utc(d.ResolvedAt), d.UpdatedAt.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresRepository) AddEvidence(ctx context.Context, e *domain.DisputeEvidence) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO dispute_evidence (id, dispute_id, submitted_by, party, url, file_name, content_type, size_bytes, sha256, note, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, e.ID, e.DisputeID, e.SubmittedBy, e.Party, e.URL, e.FileName, e.ContentType, e.Size, e.SHA256, e.Note, e.CreatedAt.UTC())
+	return err
+}
+
+func (r *postgresRepository) Evidence(ctx context.Context, disputeID string) ([]domain.DisputeEvidence, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, dispute_id, submitted_by, party, url, file_name, content_type, size_bytes, sha256, note, created_at
+		FROM dispute_evidence
+		WHERE dispute_id = $1
+		ORDER BY created_at
+	`, disputeID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []domain.DisputeEvidence
+	for rows.Next() {
+		var e domain.DisputeEvidence
+		if err := rows.Scan(&e.ID, &e.DisputeID, &e.SubmittedBy, &e.Party, &e.URL, &e.FileName, &e.ContentType,
+			&e.Size, &e.SHA256, &e.Note, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (r *postgresRepository) Overdue(ctx context.Context, now time.Time) ([]domain.Dispute, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+disputeColumns+` FROM disputes
+		WHERE (status = 'opened' AND ((claimant_evidence_at IS NULL AND claimant_evidence_due_at < $1)
+		                           OR (responded_at IS NULL AND response_due_at < $1)))
+		   OR (status = 'under_review' AND escalated_at IS NULL AND review_due_at < $1)
+		ORDER BY created_at
+	`, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []domain.Dispute
+	for rows.Next() {
+		d, err := scanDispute(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+func (r *postgresRepository) ClaimProvider(ctx context.Context, claimID string) (string, error) {
+	var providerID string
+	err := r.db.QueryRowContext(ctx, `SELECT provider_id::TEXT FROM surplus WHERE id::TEXT = $1`, claimID).Scan(&providerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", domain.ErrClaimNotFound
+	}
+	return providerID, err
+}
+
+func (r *postgresRepository) LostDisputes(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM disputes
+		WHERE (provider_id = $1 AND status IN ('approved', 'partially_refunded'))
+		   OR (user_id = $1 AND status = 'rejected')
+	`, userID).Scan(&n)
+	return n, err
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/domain"
+)
+
+// timestampLayout writes UTC times for TIMESTAMP array parameters
+const timestampLayout = "2006-01-02 15:04:05.999999"
+
+type staleClaimRepository struct {
+	db *sql.DB
+}
+
+// NewStaleClaimRepository finds stalled claims from the escrow event store and
+// closes them across deliveries, surplus and ghosting_incidents
+func NewStaleClaimRepository(db *sql.DB) domain.StaleClaimRepository {
+	return &staleClaimRepository{db: db}
+}
+
+// Stale picks streams whose last event is still PaymentCollected (LOCKED) or
+// CourierAssigned (PICKUP_IN_PROGRESS), timed on the delivery's SLA tier
+func (r *staleClaimRepository) Stale(ctx context.Context, cutoffs map[string]domain.StaleCutoff, limit int) ([]domain.StaleClaim, error) {
+	tiers := make([]string, 0, len(cutoffs))
+	awaiting := make([]string, 0, len(cutoffs))
+	pickup := make([]string, 0, len(cutoffs))
+	for tier, c := range cutoffs {
+		tiers = append(tiers, tier)
+		awaiting = append(awaiting, c.AwaitingBefore.UTC().Format(timestampLayout))
+		pickup = append(pickup, c.PickupBefore.UTC().Format(timestampLayout))
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		WITH sla AS (
+			SELECT * FROM unnest($1::TEXT[], $2::TIMESTAMP[], $3::TIMESTAMP[]) AS t(tier, awaiting_before, pickup_before)
+		)
+		SELECT e.order_id,
+		       CASE e.type WHEN 'PaymentCollected' THEN 'awaiting_pickup' ELSE 'pickup_in_progress' END,
+		       e.occurred_at, COALESCE(s.provider_id::TEXT, ''), COALESCE(p.customer_id, s.claimed_by_ngo_id::TEXT, ''),
+		       COALESCE(d.fulfillment_method, ''), COALESCE(c.user_id::TEXT, ''), COALESCE(d.food_unsafe, FALSE),
+		       sla.tier
+		FROM escrow_events e
+		LEFT JOIN surplus s ON s.id::TEXT = e.order_id
+		LEFT JOIN payments p ON p.order_id = e.order_id
+		LEFT JOIN LATERAL (
+			SELECT fulfillment_method, courier_id, food_unsafe, sla_tier FROM deliveries
+			WHERE surplus_id::TEXT = e.order_id ORDER BY created_at DESC LIMIT 1
+		) d ON TRUE
+		LEFT JOIN couriers c ON c.id = d.courier_id
+		JOIN sla ON sla.tier = COALESCE((SELECT k.tier FROM sla k WHERE k.tier = d.sla_tier), $4)
+		WHERE ((e.type = 'PaymentCollected' AND e.occurred_at < sla.awaiting_before) OR (e.type = 'CourierAssigned' AND e.occurred_at < sla.pickup_before))
+		  AND NOT EXISTS (SELECT 1 FROM escrow_events n WHERE n.order_id = e.order_id AND n.version > e.version)
+		ORDER BY e.occurred_at
+		LIMIT $5
+	`, pq.Array(tiers), pq.Array(awaiting), pq.Array(pickup), domain.DefaultSLATier, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []domain.StaleClaim
+	for rows.Next() {
+		var c domain.StaleClaim
+		if err := rows.Scan(&c.OrderID, &c.Stage, &c.Since, &c.ProviderID, &c.ClaimantID,
+			&c.Fulfillment, &c.CourierUserID, &c.FoodUnsafe, &c.SLATier); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// Close runs under the delivery's row lock, so a pickup scanned at the counter
+// either lands before (and the claim is left alone) or is refused after
+func (r *staleClaimRepository) Close(ctx context.Context, claim domain.StaleClaim, incident *domain.GhostingIncident, freshUntil time.Time) (bool, bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var deliveryID, status string
+	var unsafe bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, COALESCE(status, ''), COALESCE(food_unsafe, FALSE) FROM deliveries
+		WHERE surplus_id::TEXT = $1 ORDER BY created_at DESC LIMIT 1
+		FOR UPDATE
+	`, claim.OrderID).Scan(&deliveryID, &status, &unsafe)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// Paid but never dispatched: nothing to fail
+	case err != nil:
+		return false, false, err
+	case status == "picked_up" || status == "delivered":
+		return false, false, nil
+	case status != "failed":
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE deliveries SET status = 'failed', failure_reason = 'claim_expired', updated_at = NOW()
+			WHERE id = $1
+		`, deliveryID); err != nil {
+			return false, false, err
+		}
+	}
+
+	if incident != nil {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO ghosting_incidents (order_id, user_id, party, stage, detected_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (order_id) DO NOTHING
+		`, incident.OrderID, incident.UserID, incident.Party, incident.Stage, incident.DetectedAt.UTC()); err != nil {
+			return false, false, err
+		}
+	}
+
+	// Unsafe or about to expire: taken off the market instead
+	var relisted bool
+	err = tx.QueryRowContext(ctx, `
+		UPDATE surplus
+		SET status = CASE WHEN NOT $2 AND expiry_time > $3 THEN 'available' ELSE 'expired' END,
+		    claimed_by_ngo_id = NULL,
+		    claimed_at = NULL,
+		    version = version + 1,
+		    updated_at = NOW()
+		WHERE id::TEXT = $1 AND status = 'claimed'
+		RETURNING status = 'available'
+	`, claim.OrderID, unsafe || claim.FoodUnsafe, freshUntil.UTC()).Scan(&relisted)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, false, err
+	}
+	return true, relisted, tx.Commit()
+}
+
+func (r *staleClaimRepository) GhostingIncidents(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM ghosting_incidents WHERE user_id = $1`, userID).Scan(&n)
+	return n, err
+}
@@ -2,40 +2,353 @@ package usecase
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"path"
 	"time"
 
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
 	"github.com/albnnaardy11/pahlawan-pangan/internal/domain"
+	escrowDomain "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/fintech"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
 )
 
+// systemResolver signs outcomes forced by a missed deadline
+const systemResolver = "system"
+
 type disputeUsecase struct {
+	repo      domain.DisputeRepository
+	claims    domain.StaleClaimRepository
+	evidence  domain.EvidenceStore
 	escrowSvc *fintech.EscrowService
+	policy    domain.DisputePolicy
+	logger    *zap.Logger
 }
 
-func NewDisputeUsecase(escrow *fintech.EscrowService) domain.DisputeUsecase {
+// NewDisputeUsecase runs disputes against the order's escrow: opening one
+// freezes the funds, and the outcome refunds, partly refunds or releases them.
+// Claims that stall before pickup are refunded without a dispute.
+func NewDisputeUsecase(repo domain.DisputeRepository, claims domain.StaleClaimRepository, evidence domain.EvidenceStore, escrow *fintech.EscrowService, policy domain.DisputePolicy, logger *zap.Logger) domain.DisputeUsecase {
 	return &disputeUsecase{
+		repo:      repo,
+		claims:    claims,
+		evidence:  evidence,
 		escrowSvc: escrow,
+		policy:    policy,
+		logger:    logger,
 	}
 }
 
 func (u *disputeUsecase) RaiseDispute(ctx context.Context, dispute *domain.Dispute) error {
-	dispute.Status = "pending"
-	dispute.CreatedAt = time.Now()
-	fmt.Printf("⚖️ [LEGAL] Dispute raised for Claim %s. Status: PENDING.\n", dispute.ClaimID)
+	providerID, err := u.repo.ClaimProvider(ctx, dispute.ClaimID)
+	if err != nil {
+		return err
+	}
+	if providerID == dispute.UserID {
+		return fmt.Errorf("provider %s cannot dispute its own listing", providerID)
+	}
+
+	// Donations have no escrow: the dispute is still heard, but moves no money
+	err = u.escrowSvc.FreezeFunds(ctx, dispute.ClaimID, dispute.Reason)
+	switch {
+	case err == nil:
+		dispute.PaymentID = dispute.ClaimID
+	case errors.Is(err, escrowDomain.ErrEscrowNotFound):
+		dispute.PaymentID = ""
+	case errors.Is(err, escrowDomain.ErrInvalidTransition):
+		return fmt.Errorf("claim %s is already settled: %w", dispute.ClaimID, err)
+	default:
+		return err
+	}
+
+	now := time.Now()
+	dispute.ID = uuid.New().String()
+	dispute.ProviderID = providerID
+	dispute.Status = domain.DisputeOpened
+	dispute.ClaimantEvidenceDueAt = now.Add(u.policy.ClaimantEvidenceWindow)
+	dispute.ResponseDueAt = now.Add(u.policy.ResponseWindow)
+	dispute.CreatedAt, dispute.UpdatedAt = now, now
+	if dispute.Evidence != "" {
+		dispute.ClaimantEvidenceAt = &now
+	}
+	if err := u.repo.Create(ctx, dispute); err != nil {
+		return err
+	}
+	if dispute.Evidence != "" {
+		link := &domain.DisputeEvidence{
+			ID:          uuid.New().String(),
+			DisputeID:   dispute.ID,
+			SubmittedBy: dispute.UserID,
+			Party:       domain.PartyClaimant,
+			URL:         dispute.Evidence,
+			CreatedAt:   now,
+		}
+		if err := u.repo.AddEvidence(ctx, link); err != nil {
+			return err
+		}
+	}
+
+	u.logger.Info("Dispute opened",
+		zap.String("dispute_id", dispute.ID),
+		zap.String("claim_id", dispute.ClaimID),
+		zap.String("provider_id", providerID),
+		zap.Bool("escrowed", dispute.PaymentID != ""))
+	return nil
+}
+
+func (u *disputeUsecase) GetDispute(ctx context.Context, disputeID string) (*domain.Dispute, []domain.DisputeEvidence, error) {
+	d, err := u.repo.Get(ctx, disputeID)
+	if err != nil {
+		return nil, nil, err
+	}
+	evidence, err := u.repo.Evidence(ctx, disputeID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, evidence, nil
+}
+
+// AddEvidence stores a file (or a link when file is nil) from either party.
+// The provider's first answer puts the dispute under review.
+func (u *disputeUsecase) AddEvidence(ctx context.Context, evidence *domain.DisputeEvidence, file io.Reader) error {
+	d, err := u.repo.Get(ctx, evidence.DisputeID)
+	if err != nil {
+		return err
+	}
+	if d.Status.Resolved() {
+		return fmt.Errorf("dispute %s is %s: %w", d.ID, d.Status, domain.ErrInvalidDisputeTransition)
+	}
+	party, ok := d.Party(evidence.SubmittedBy)
+	if !ok {
+		return domain.ErrNotDisputeParty
+	}
+
+	evidence.ID = uuid.New().String()
+	evidence.Party = party
+	evidence.CreatedAt = time.Now()
+	if file != nil {
+		hash := sha256.New()
+		counted := &countingReader{r: io.TeeReader(file, hash)}
+		key := path.Join(d.ID, evidence.ID+path.Ext(evidence.FileName))
+		url, err := u.evidence.Save(ctx, key, evidence.ContentType, counted)
+		if err != nil {
+			return fmt.Errorf("store evidence: %w", err)
+		}
+		evidence.URL, evidence.Size, evidence.SHA256 = url, counted.n, hex.EncodeToString(hash.Sum(nil))
+	}
+	if evidence.URL == "" {
+		return errors.New("evidence needs a file or a URL")
+	}
+	if err := u.repo.AddEvidence(ctx, evidence); err != nil {
+		return err
+	}
+
+	now := evidence.CreatedAt
+	expected := d.Status
+	switch {
+	case party == domain.PartyClaimant && d.ClaimantEvidenceAt == nil:
+		d.ClaimantEvidenceAt = &now
+	case party == domain.PartyRespondent && d.RespondedAt == nil:
+		d.RespondedAt = &now
+		if d.Status == domain.DisputeOpened {
+			u.startReview(d, now)
+		}
+	default:
+		return nil
+	}
+	d.UpdatedAt = now
+	_, err = u.repo.Update(ctx, d, expected)
+	return err
+}
+
+// StartReview lets staff take a dispute before the provider has answered
+func (u *disputeUsecase) StartReview(ctx context.Context, disputeID, reviewerID string) error {
+	d, err := u.repo.Get(ctx, disputeID)
+	if err != nil {
+		return err
+	}
+	if d.Status == domain.DisputeUnderReview {
+		return nil
+	}
+	if !d.Status.CanMoveTo(domain.DisputeUnderReview) {
+		return fmt.Errorf("dispute %s is %s: %w", d.ID, d.Status, domain.ErrInvalidDisputeTransition)
+	}
+	now := time.Now()
+	u.startReview(d, now)
+	d.UpdatedAt = now
+	moved, err := u.repo.Update(ctx, d, domain.DisputeOpened)
+	if err != nil {
+		return err
+	}
+	if !moved {
+		return domain.ErrInvalidDisputeTransition
+	}
+	u.logger.Info("Dispute under review", zap.String("dispute_id", d.ID), zap.String("reviewer_id", reviewerID))
+	return nil
+}
+
+func (u *disputeUsecase) startReview(d *domain.Dispute, now time.Time) {
+	due := now.Add(u.policy.ReviewWindow)
+	d.Status = domain.DisputeUnderReview
+	d.ReviewDueAt = &due
+}
+
+// ResolveDispute records a reviewer's decision and settles the escrow to match
+func (u *disputeUsecase) ResolveDispute(ctx context.Context, disputeID string, resolution domain.Resolution) error {
+	d, err := u.repo.Get(ctx, disputeID)
+	if err != nil {
+		return err
+	}
+	if d.Status != domain.DisputeUnderReview {
+		return fmt.Errorf("dispute %s is %s: %w", d.ID, d.Status, domain.ErrInvalidDisputeTransition)
+	}
+	return u.resolve(ctx, d, resolution)
+}
+
+func (u *disputeUsecase) resolve(ctx context.Context, d *domain.Dispute, res domain.Resolution) error {
+	if !d.Status.CanMoveTo(res.Outcome) {
+		return fmt.Errorf("dispute %s cannot move from %s to %s: %w", d.ID, d.Status, res.Outcome, domain.ErrInvalidDisputeTransition)
+	}
+	if res.Outcome != domain.DisputePartiallyRefunded {
+		res.RefundAmount = money.Money{}
+	}
+
+	// Money first: every escrow step is idempotent, so a failed write below is
+	// retried safely, while the reverse order could close a dispute unpaid
+	if d.PaymentID != "" {
+		if err := u.settle(ctx, d, res); err != nil {
+			return err
+		}
+	} else if res.Outcome == domain.DisputePartiallyRefunded {
+		return fmt.Errorf("claim %s was not paid: %w", d.ClaimID, domain.ErrInvalidRefundAmount)
+	}
+
+	expected := d.Status
+	now := time.Now()
+	d.Status = res.Outcome
+	d.RefundAmount = res.RefundAmount
+	d.Resolution = res.Note
+	d.ResolvedBy = res.ResolvedBy
+	d.ResolvedAt = &now
+	d.UpdatedAt = now
+	moved, err := u.repo.Update(ctx, d, expected)
+	if err != nil {
+		return err
+	}
+	if !moved {
+		return fmt.Errorf("dispute %s changed while resolving: %w", d.ID, domain.ErrInvalidDisputeTransition)
+	}
+
+	u.logger.Info("Dispute resolved",
+		zap.String("dispute_id", d.ID),
+		zap.String("outcome", string(d.Status)),
+		zap.Int64("refund_amount", d.RefundAmount.Units()),
+		zap.String("resolved_by", d.ResolvedBy))
+	return nil
+}
+
+func (u *disputeUsecase) settle(ctx context.Context, d *domain.Dispute, res domain.Resolution) error {
+	switch res.Outcome {
+	case domain.DisputeApproved:
+		return u.escrowSvc.RefundFunds(ctx, d.PaymentID, d.UserID)
+	case domain.DisputeRejected:
+		return u.escrowSvc.ReleaseFunds(ctx, d.PaymentID, d.ProviderID)
+	case domain.DisputePartiallyRefunded:
+		payment, err := u.escrowSvc.Payment(ctx, d.PaymentID)
+		if err != nil {
+			return err
+		}
+		if !res.RefundAmount.IsPositive() || !res.RefundAmount.LessThan(payment.Amount) {
+			return domain.ErrInvalidRefundAmount
+		}
+		if err := u.escrowSvc.PartialRefund(ctx, d.PaymentID, d.UserID, res.RefundAmount); err != nil {
+			return err
+		}
+		return u.escrowSvc.ReleaseFunds(ctx, d.PaymentID, d.ProviderID)
+	}
 	return nil
 }
 
-func (u *disputeUsecase) ResolveDispute(ctx context.Context, disputeID string, status string) error {
-	if status == "approved" {
-		// Logic: Identify payment ID from disputeID and trigger refund
-		_ = u.escrowSvc.RefundFunds(ctx, "PAY-MOCK-123", "USER-MOCK-456")
+// RunDeadlineEnforcer applies missed deadlines every few minutes
+func (u *disputeUsecase) RunDeadlineEnforcer(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := u.EnforceDeadlines(ctx, time.Now()); err != nil {
+				u.logger.Error("Dispute deadline enforcement failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// EnforceDeadlines decides disputes a party let lapse: no evidence from the
+// claimant rejects it, no answer from the provider refunds the buyer, and a
+// review past its deadline is escalated
+func (u *disputeUsecase) EnforceDeadlines(ctx context.Context, now time.Time) error {
+	overdue, err := u.repo.Overdue(ctx, now)
+	if err != nil {
+		return err
+	}
+	for i := range overdue {
+		d := &overdue[i]
+		if err := u.enforce(ctx, d, now); err != nil {
+			u.logger.Error("Failed to enforce dispute deadline", zap.String("dispute_id", d.ID), zap.Error(err))
+		}
 	}
 	return nil
 }
 
-func (u *disputeUsecase) AutoRefundStaleClaims(ctx context.Context) error {
-	fmt.Println("⏲️ [SRE] Running Auto-Refund worker for stale claims (15m timeout)...")
-	// Logic: Find claims where status = 'locked' and timestamp > 15m
+func (u *disputeUsecase) enforce(ctx context.Context, d *domain.Dispute, now time.Time) error {
+	switch d.Status {
+	case domain.DisputeOpened:
+		if d.ClaimantEvidenceAt == nil && now.After(d.ClaimantEvidenceDueAt) {
+			return u.resolve(ctx, d, domain.Resolution{
+				Outcome:    domain.DisputeRejected,
+				Note:       "claimant submitted no evidence before the deadline",
+				ResolvedBy: systemResolver,
+			})
+		}
+		if d.RespondedAt == nil && now.After(d.ResponseDueAt) {
+			return u.resolve(ctx, d, domain.Resolution{
+				Outcome:    domain.DisputeApproved,
+				Note:       "provider did not respond before the deadline",
+				ResolvedBy: systemResolver,
+			})
+		}
+	case domain.DisputeUnderReview:
+		if d.EscalatedAt != nil || d.ReviewDueAt == nil || !now.After(*d.ReviewDueAt) {
+			return nil
+		}
+		d.EscalatedAt = &now
+		d.UpdatedAt = now
+		if _, err := u.repo.Update(ctx, d, domain.DisputeUnderReview); err != nil {
+			return err
+		}
+		u.logger.Error("Dispute review overdue, escalated",
+			zap.String("dispute_id", d.ID),
+			zap.String("claim_id", d.ClaimID),
+			zap.Time("review_due_at", *d.ReviewDueAt))
+	}
 	return nil
 }
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
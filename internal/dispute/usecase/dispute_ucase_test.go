@@ -0,0 +1,292 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/domain"
+	escrowDomain "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
+	escrowRepo "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/repository"
+	escrowService "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/service"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/fintech"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/ledger"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+type memoryDisputes struct {
+	mu        sync.Mutex
+	disputes  map[string]domain.Dispute
+	evidence  []domain.DisputeEvidence
+	providers map[string]string // claim → provider
+}
+
+func newMemoryDisputes() *memoryDisputes {
+	return &memoryDisputes{disputes: make(map[string]domain.Dispute), providers: make(map[string]string)}
+}
+
+func (m *memoryDisputes) Create(_ context.Context, d *domain.Dispute) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.disputes {
+		if existing.ClaimID == d.ClaimID && !existing.Status.Resolved() {
+			return domain.ErrDisputeAlreadyOpen
+		}
+	}
+	m.disputes[d.ID] = *d
+	return nil
+}
+
+func (m *memoryDisputes) Get(_ context.Context, id string) (*domain.Dispute, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.disputes[id]
+	if !ok {
+		return nil, domain.ErrDisputeNotFound
+	}
+	return &d, nil
+}
+
+func (m *memoryDisputes) Update(_ context.Context, d *domain.Dispute, expected domain.DisputeStatus) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.disputes[d.ID].Status != expected {
+		return false, nil
+	}
+	m.disputes[d.ID] = *d
+	return true, nil
+}
+
+func (m *memoryDisputes) AddEvidence(_ context.Context, e *domain.DisputeEvidence) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evidence = append(m.evidence, *e)
+	return nil
+}
+
+func (m *memoryDisputes) Evidence(_ context.Context, disputeID string) ([]domain.DisputeEvidence, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []domain.DisputeEvidence
+	for _, e := range m.evidence {
+		if e.DisputeID == disputeID {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryDisputes) Overdue(_ context.Context, now time.Time) ([]domain.Dispute, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []domain.Dispute
+	for _, d := range m.disputes {
+		switch d.Status {
+		case domain.DisputeOpened:
+			if (d.ClaimantEvidenceAt == nil && d.ClaimantEvidenceDueAt.Before(now)) || (d.RespondedAt == nil && d.ResponseDueAt.Before(now)) {
+				out = append(out, d)
+			}
+		case domain.DisputeUnderReview:
+			if d.EscalatedAt == nil && d.ReviewDueAt != nil && d.ReviewDueAt.Before(now) {
+				out = append(out, d)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (m *memoryDisputes) ClaimProvider(_ context.Context, claimID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.providers[claimID]
+	if !ok {
+		return "", domain.ErrClaimNotFound
+	}
+	return p, nil
+}
+
+func (m *memoryDisputes) LostDisputes(_ context.Context, userID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, d := range m.disputes {
+		lostAsProvider := d.ProviderID == userID && (d.Status == domain.DisputeApproved || d.Status == domain.DisputePartiallyRefunded)
+		lostAsClaimant := d.UserID == userID && d.Status == domain.DisputeRejected
+		if lostAsProvider || lostAsClaimant {
+			n++
+		}
+	}
+	return n, nil
+}
+
+type memoryEvidenceStore struct {
+	files map[string][]byte
+}
+
+func (s *memoryEvidenceStore) Save(_ context.Context, key, _ string, r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	s.files[key] = data
+	return "mem://" + key, nil
+}
+
+// noPayments has no gateway charges: the escrow was funded directly
+type noPayments struct {
+	fintech.PaymentRepository
+}
+
+func (noPayments) Get(context.Context, string) (*fintech.Payment, error) {
+	return nil, fintech.ErrPaymentNotFound
+}
+
+func newTestDisputes(t *testing.T) (*disputeUsecase, *memoryDisputes, *escrowService.EscrowService) {
+	t.Helper()
+	escrowLedger := escrowService.NewEscrowService(escrowRepo.NewMemoryRepository(), zap.NewNop())
+	journal := ledger.NewService(ledger.NewMemoryRepository(), zap.NewNop())
+	payments := fintech.NewEscrowService(escrowLedger, journal, noPayments{}, nil, nil, nil, zap.NewNop())
+	repo := newMemoryDisputes()
+	uc := NewDisputeUsecase(repo, newMemoryStaleClaims(), &memoryEvidenceStore{files: make(map[string][]byte)}, payments, domain.DefaultDisputePolicy(), zap.NewNop())
+	return uc.(*disputeUsecase), repo, escrowLedger
+}
+
+func openDispute(t *testing.T, uc *disputeUsecase, repo *memoryDisputes, escrowLedger *escrowService.EscrowService, claimID string, amount int64) *domain.Dispute {
+	t.Helper()
+	ctx := context.Background()
+	repo.providers[claimID] = "warung"
+	if amount > 0 {
+		if err := escrowLedger.SecurePayment(ctx, claimID, money.Rupiah(amount)); err != nil {
+			t.Fatalf("secure: %v", err)
+		}
+	}
+	d := &domain.Dispute{ClaimID: claimID, UserID: "buyer", Reason: "spoiled rice"}
+	if err := uc.RaiseDispute(ctx, d); err != nil {
+		t.Fatalf("raise: %v", err)
+	}
+	return d
+}
+
+func TestDispute_PartialRefundSplitsEscrow(t *testing.T) {
+	ctx := context.Background()
+	uc, repo, escrowLedger := newTestDisputes(t)
+	d := openDispute(t, uc, repo, escrowLedger, "o1", 40000)
+
+	if state, _ := escrowLedger.State(ctx, "o1"); state.Status != escrowDomain.StatusDisputed {
+		t.Fatalf("expected the escrow frozen, got %s", state.Status)
+	}
+	if err := uc.RaiseDispute(ctx, &domain.Dispute{ClaimID: "o1", UserID: "buyer", Reason: "again"}); !errors.Is(err, domain.ErrDisputeAlreadyOpen) {
+		t.Fatalf("expected a second dispute to be refused, got %v", err)
+	}
+
+	photo := &domain.DisputeEvidence{DisputeID: d.ID, SubmittedBy: "buyer", FileName: "rice.jpg", ContentType: "image/jpeg"}
+	if err := uc.AddEvidence(ctx, photo, strings.NewReader("jpeg bytes")); err != nil {
+		t.Fatalf("claimant evidence: %v", err)
+	}
+	if photo.Party != domain.PartyClaimant || photo.Size != 10 || len(photo.SHA256) != 64 || !strings.HasPrefix(photo.URL, "mem://"+d.ID+"/") {
+		t.Fatalf("unexpected stored evidence %+v", photo)
+	}
+	if err := uc.AddEvidence(ctx, &domain.DisputeEvidence{DisputeID: d.ID, SubmittedBy: "stranger", URL: "https://x"}, nil); !errors.Is(err, domain.ErrNotDisputeParty) {
+		t.Fatalf("expected outsiders to be refused, got %v", err)
+	}
+	// Resolving before both sides are heard is refused
+	if err := uc.ResolveDispute(ctx, d.ID, domain.Resolution{Outcome: domain.DisputeApproved, ResolvedBy: "staff"}); !errors.Is(err, domain.ErrInvalidDisputeTransition) {
+		t.Fatalf("expected opened dispute to be unresolvable, got %v", err)
+	}
+
+	reply := &domain.DisputeEvidence{DisputeID: d.ID, SubmittedBy: "warung", Note: "cooked this morning"}
+	if err := uc.AddEvidence(ctx, reply, bytes.NewReader([]byte("receipt"))); err != nil {
+		t.Fatalf("respondent evidence: %v", err)
+	}
+	if got, _ := repo.Get(ctx, d.ID); got.Status != domain.DisputeUnderReview || got.ReviewDueAt == nil {
+		t.Fatalf("expected the provider's answer to start the review, got %+v", got)
+	}
+
+	if err := uc.ResolveDispute(ctx, d.ID, domain.Resolution{Outcome: domain.DisputePartiallyRefunded, RefundAmount: money.Rupiah(40000), ResolvedBy: "staff"}); !errors.Is(err, domain.ErrInvalidRefundAmount) {
+		t.Fatalf("expected a full amount to be refused as partial, got %v", err)
+	}
+	if err := uc.ResolveDispute(ctx, d.ID, domain.Resolution{Outcome: domain.DisputePartiallyRefunded, RefundAmount: money.Rupiah(15000), ResolvedBy: "staff"}); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	state, _ := escrowLedger.State(ctx, "o1")
+	if state.Status != escrowDomain.StatusClosed || state.Refunded.Units() != 15000 || !state.TotalLocked.IsZero() {
+		t.Fatalf("expected 15000 refunded and the rest released, got %+v", state)
+	}
+	got, evidence, _ := uc.GetDispute(ctx, d.ID)
+	if got.Status != domain.DisputePartiallyRefunded || got.RefundAmount.Units() != 15000 || got.ResolvedAt == nil || len(evidence) != 2 {
+		t.Fatalf("unexpected resolved dispute %+v with %d evidence", got, len(evidence))
+	}
+	if lost, _ := repo.LostDisputes(ctx, "warung"); lost != 1 {
+		t.Fatalf("expected the provider to have lost one dispute, got %d", lost)
+	}
+}
+
+func TestDispute_DeadlinesDecideForSilentParties(t *testing.T) {
+	ctx := context.Background()
+	uc, repo, escrowLedger := newTestDisputes(t)
+	policy := domain.DefaultDisputePolicy()
+
+	// Claimant never backs the dispute: rejected, the provider is paid
+	unbacked := openDispute(t, uc, repo, escrowLedger, "o1", 20000)
+	// Claimant backs it, provider never answers: the buyer is refunded
+	ignored := openDispute(t, uc, repo, escrowLedger, "o2", 30000)
+	if err := uc.AddEvidence(ctx, &domain.DisputeEvidence{DisputeID: ignored.ID, SubmittedBy: "buyer", URL: "https://photos/1"}, nil); err != nil {
+		t.Fatalf("evidence: %v", err)
+	}
+	// Both sides heard, staff sit on it: escalated, money stays frozen
+	stalled := openDispute(t, uc, repo, escrowLedger, "o3", 25000)
+	if err := uc.StartReview(ctx, stalled.ID, "staff"); err != nil {
+		t.Fatalf("review: %v", err)
+	}
+
+	// Nothing is due yet
+	if err := uc.EnforceDeadlines(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("enforce: %v", err)
+	}
+	if got, _ := repo.Get(ctx, unbacked.ID); got.Status != domain.DisputeOpened {
+		t.Fatalf("expected no early decision, got %s", got.Status)
+	}
+
+	later := time.Now().Add(policy.ReviewWindow + time.Hour)
+	if err := uc.EnforceDeadlines(ctx, later); err != nil {
+		t.Fatalf("enforce: %v", err)
+	}
+	if err := uc.EnforceDeadlines(ctx, later); err != nil { // Next tick finds nothing left to do
+		t.Fatalf("enforce again: %v", err)
+	}
+
+	for _, tc := range []struct {
+		dispute *domain.Dispute
+		status  domain.DisputeStatus
+		escrow  escrowDomain.Status
+	}{
+		{unbacked, domain.DisputeRejected, escrowDomain.StatusClosed},
+		{ignored, domain.DisputeApproved, escrowDomain.StatusCancelled},
+		{stalled, domain.DisputeUnderReview, escrowDomain.StatusDisputed},
+	} {
+		got, _ := repo.Get(ctx, tc.dispute.ID)
+		state, _ := escrowLedger.State(ctx, tc.dispute.ClaimID)
+		if got.Status != tc.status || state.Status != tc.escrow {
+			t.Fatalf("claim %s: expected %s with escrow %s, got %s with %s", tc.dispute.ClaimID, tc.status, tc.escrow, got.Status, state.Status)
+		}
+	}
+	if got, _ := repo.Get(ctx, unbacked.ID); got.ResolvedBy != systemResolver {
+		t.Fatalf("expected a system decision, got %q", got.ResolvedBy)
+	}
+	if got, _ := repo.Get(ctx, stalled.ID); got.EscalatedAt == nil {
+		t.Fatal("expected the stalled review to be escalated")
+	}
+	if lost, _ := repo.LostDisputes(ctx, "buyer"); lost != 1 {
+		t.Fatalf("expected the buyer to have lost the unbacked dispute, got %d", lost)
+	}
+}
@@ -0,0 +1,101 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/domain"
+	escrowDomain "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
+)
+
+const (
+	StaleClaimInterval  = time.Minute
+	staleClaimScanLimit = 100
+)
+
+// RunStaleClaimRefunder sweeps stalled claims every minute
+func (u *disputeUsecase) RunStaleClaimRefunder(ctx context.Context) {
+	ticker := time.NewTicker(StaleClaimInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := u.AutoRefundStaleClaims(ctx); err != nil {
+				u.logger.Error("Stale claim sweep failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// AutoRefundStaleClaims refunds paid claims stuck before pickup past the stage
+// SLA of their delivery's tier. The claim is closed first (delivery failed,
+// no-show recorded, surplus relisted if still safe) so a late pickup cannot
+// race the refund; both steps are idempotent, so a crash in between is
+// finished next sweep.
+func (u *disputeUsecase) AutoRefundStaleClaims(ctx context.Context) error {
+	now := time.Now()
+	stale, err := u.claims.Stale(ctx, u.policy.StaleCutoffs(now), staleClaimScanLimit)
+	if err != nil {
+		return err
+	}
+	for _, c := range stale {
+		if err := u.refundStale(ctx, c, now); err != nil {
+			u.logger.Error("Failed to refund stale claim", zap.String("order_id", c.OrderID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (u *disputeUsecase) refundStale(ctx context.Context, c domain.StaleClaim, now time.Time) error {
+	incident := ghostingIncident(c, now)
+	closed, relisted, err := u.claims.Close(ctx, c, incident, now.Add(u.policy.MinShelfLife))
+	if err != nil {
+		return err
+	}
+	if !closed {
+		return nil // Picked up after all; the escrow catches up from the delivery event
+	}
+
+	err = u.escrowSvc.RefundFunds(ctx, c.OrderID, c.ClaimantID)
+	if errors.Is(err, escrowDomain.ErrInvalidTransition) {
+		u.logger.Warn("Stale claim escrow moved on, not refunded", zap.String("order_id", c.OrderID), zap.String("stage", string(c.Stage)))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fields := []zap.Field{
+		zap.String("order_id", c.OrderID),
+		zap.String("stage", string(c.Stage)),
+		zap.String("sla_tier", c.SLATier),
+		zap.Duration("stalled_for", now.Sub(c.Since)),
+		zap.Bool("relisted", relisted),
+	}
+	if incident != nil {
+		fields = append(fields, zap.String("ghosted_by", incident.UserID), zap.String("party", incident.Party))
+	}
+	u.logger.Info("Stale claim refunded", fields...)
+	return nil
+}
+
+// ghostingIncident blames whoever was expected to show up: the buyer for a
+// self-pickup, the rider once one was assigned. A courier order that never
+// found a rider is nobody's no-show.
+func ghostingIncident(c domain.StaleClaim, now time.Time) *domain.GhostingIncident {
+	incident := &domain.GhostingIncident{OrderID: c.OrderID, Stage: c.Stage, DetectedAt: now}
+	switch {
+	case c.Stage == domain.StagePickupInProgress && c.CourierUserID != "":
+		incident.UserID, incident.Party = c.CourierUserID, "courier"
+	case c.Stage == domain.StageAwaitingPickup && c.Fulfillment == "self_pickup" && c.ClaimantID != "":
+		incident.UserID, incident.Party = c.ClaimantID, string(domain.PartyClaimant)
+	default:
+		return nil
+	}
+	return incident
+}
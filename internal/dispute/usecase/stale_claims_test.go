@@ -0,0 +1,164 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/domain"
+	escrowDomain "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+// memoryStaleClaims keeps the claim side of the sweep: delivery and surplus
+// status per order, and the no-shows recorded
+type memoryStaleClaims struct {
+	mu         sync.Mutex
+	claims     []domain.StaleClaim
+	deliveries map[string]string
+	surplus    map[string]string
+	expiry     map[string]time.Time
+	incidents  map[string]domain.GhostingIncident
+}
+
+func newMemoryStaleClaims() *memoryStaleClaims {
+	return &memoryStaleClaims{
+		deliveries: make(map[string]string),
+		surplus:    make(map[string]string),
+		expiry:     make(map[string]time.Time),
+		incidents:  make(map[string]domain.GhostingIncident),
+	}
+}
+
+func (m *memoryStaleClaims) Stale(_ context.Context, cutoffs map[string]domain.StaleCutoff, _ int) ([]domain.StaleClaim, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []domain.StaleClaim
+	for _, c := range m.claims {
+		if _, ok := cutoffs[c.SLATier]; !ok {
+			c.SLATier = domain.DefaultSLATier
+		}
+		cutoff := cutoffs[c.SLATier]
+		if (c.Stage == domain.StageAwaitingPickup && c.Since.Before(cutoff.AwaitingBefore)) ||
+			(c.Stage == domain.StagePickupInProgress && c.Since.Before(cutoff.PickupBefore)) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryStaleClaims) Close(_ context.Context, c domain.StaleClaim, incident *domain.GhostingIncident, freshUntil time.Time) (bool, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.deliveries[c.OrderID]; s == "picked_up" || s == "delivered" {
+		return false, false, nil
+	}
+	m.deliveries[c.OrderID] = "failed"
+	if _, ok := m.incidents[c.OrderID]; incident != nil && !ok {
+		m.incidents[c.OrderID] = *incident
+	}
+	if m.surplus[c.OrderID] != "claimed" {
+		return true, false, nil
+	}
+	if !c.FoodUnsafe && m.expiry[c.OrderID].After(freshUntil) {
+		m.surplus[c.OrderID] = "available"
+		return true, true, nil
+	}
+	m.surplus[c.OrderID] = "expired"
+	return true, false, nil
+}
+
+func (m *memoryStaleClaims) GhostingIncidents(_ context.Context, userID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, i := range m.incidents {
+		if i.UserID == userID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestStaleClaims_RefundRelistAndBlameTheNoShow(t *testing.T) {
+	ctx := context.Background()
+	uc, _, escrowLedger := newTestDisputes(t)
+	claims := uc.claims.(*memoryStaleClaims)
+	now := time.Now()
+
+	for _, c := range []struct {
+		claim    domain.StaleClaim
+		delivery string
+		expiry   time.Time
+	}{
+		// Buyer never came for a self-pickup: refunded, relisted, buyer blamed
+		{domain.StaleClaim{OrderID: "o1", Stage: domain.StageAwaitingPickup, Since: now.Add(-20 * time.Minute), ClaimantID: "buyer", Fulfillment: "self_pickup"}, "ready_for_pickup", now.Add(3 * time.Hour)},
+		// Rider assigned but never showed, food about to expire: refunded, not relisted
+		{domain.StaleClaim{OrderID: "o2", Stage: domain.StagePickupInProgress, Since: now.Add(-time.Hour), ClaimantID: "buyer2", Fulfillment: "courier", CourierUserID: "rider"}, "assigned", now.Add(30 * time.Minute)},
+		// No rider ever accepted: refunded, nobody to blame
+		{domain.StaleClaim{OrderID: "o3", Stage: domain.StageAwaitingPickup, Since: now.Add(-20 * time.Minute), ClaimantID: "buyer3", Fulfillment: "courier"}, "searching", now.Add(3 * time.Hour)},
+		// Picked up just before the sweep closed it: left alone
+		{domain.StaleClaim{OrderID: "o4", Stage: domain.StagePickupInProgress, Since: now.Add(-time.Hour), ClaimantID: "buyer4", Fulfillment: "courier", CourierUserID: "rider"}, "picked_up", now.Add(3 * time.Hour)},
+		// Still inside its SLA
+		{domain.StaleClaim{OrderID: "o5", Stage: domain.StagePickupInProgress, Since: now.Add(-10 * time.Minute), ClaimantID: "buyer5", Fulfillment: "courier", CourierUserID: "rider"}, "assigned", now.Add(3 * time.Hour)},
+		// Same wait, but an EXPRESS rider has 30 minutes to pick up, not 45
+		{domain.StaleClaim{OrderID: "o6", Stage: domain.StagePickupInProgress, Since: now.Add(-35 * time.Minute), ClaimantID: "buyer6", Fulfillment: "courier", CourierUserID: "rider2", SLATier: "EXPRESS"}, "assigned", now.Add(3 * time.Hour)},
+		{domain.StaleClaim{OrderID: "o7", Stage: domain.StagePickupInProgress, Since: now.Add(-35 * time.Minute), ClaimantID: "buyer7", Fulfillment: "courier", CourierUserID: "rider3", SLATier: "STANDARD"}, "assigned", now.Add(3 * time.Hour)},
+		// HEMAT waits longer before the claim counts as abandoned
+		{domain.StaleClaim{OrderID: "o8", Stage: domain.StageAwaitingPickup, Since: now.Add(-20 * time.Minute), ClaimantID: "buyer8", Fulfillment: "courier", SLATier: "HEMAT"}, "searching", now.Add(3 * time.Hour)},
+	} {
+		if err := escrowLedger.SecurePayment(ctx, c.claim.OrderID, money.Rupiah(20000)); err != nil {
+			t.Fatalf("secure: %v", err)
+		}
+		if c.claim.Stage == domain.StagePickupInProgress {
+			if err := escrowLedger.CourierAssigned(ctx, c.claim.OrderID); err != nil {
+				t.Fatalf("assign: %v", err)
+			}
+		}
+		claims.claims = append(claims.claims, c.claim)
+		claims.deliveries[c.claim.OrderID] = c.delivery
+		claims.surplus[c.claim.OrderID] = "claimed"
+		claims.expiry[c.claim.OrderID] = c.expiry
+	}
+
+	if err := uc.AutoRefundStaleClaims(ctx); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if err := uc.AutoRefundStaleClaims(ctx); err != nil { // A repeat sweep changes nothing
+		t.Fatalf("repeat sweep: %v", err)
+	}
+
+	for _, tc := range []struct {
+		order   string
+		escrow  escrowDomain.Status
+		surplus string
+	}{
+		{"o1", escrowDomain.StatusCancelled, "available"},
+		{"o2", escrowDomain.StatusCancelled, "expired"},
+		{"o3", escrowDomain.StatusCancelled, "available"},
+		{"o4", escrowDomain.StatusPickupInProgress, "claimed"},
+		{"o5", escrowDomain.StatusPickupInProgress, "claimed"},
+		{"o6", escrowDomain.StatusCancelled, "available"},
+		{"o7", escrowDomain.StatusPickupInProgress, "claimed"},
+		{"o8", escrowDomain.StatusLocked, "claimed"},
+	} {
+		state, _ := escrowLedger.State(ctx, tc.order)
+		if state.Status != tc.escrow || claims.surplus[tc.order] != tc.surplus {
+			t.Errorf("%s: expected escrow %s and surplus %s, got %s and %s", tc.order, tc.escrow, tc.surplus, state.Status, claims.surplus[tc.order])
+		}
+	}
+
+	if len(claims.incidents) != 3 {
+		t.Fatalf("expected three no-shows, got %+v", claims.incidents)
+	}
+	if i := claims.incidents["o1"]; i.UserID != "buyer" || i.Party != "claimant" {
+		t.Errorf("expected the buyer blamed for o1, got %+v", i)
+	}
+	if i := claims.incidents["o2"]; i.UserID != "rider" || i.Party != "courier" {
+		t.Errorf("expected the rider blamed for o2, got %+v", i)
+	}
+	if i := claims.incidents["o6"]; i.UserID != "rider2" {
+		t.Errorf("expected the EXPRESS rider blamed for o6, got %+v", i)
+	}
+}
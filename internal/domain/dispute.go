@@ -3,23 +3,210 @@ package domain
 
 import (
 	"context"
+	"errors"
+	"io"
 	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+var (
+	ErrDisputeNotFound          = errors.New("dispute not found")
+	ErrClaimNotFound            = errors.New("claim not found")
+	ErrDisputeAlreadyOpen       = errors.New("a dispute is already open for this claim")
+	ErrInvalidDisputeTransition = errors.New("dispute cannot move to that status")
+	ErrNotDisputeParty          = errors.New("user is not a party to this dispute")
+	ErrInvalidRefundAmount      = errors.New("refund amount must be above zero and below the amount paid")
+)
+
+// DisputeStatus moves opened → under_review → approved | rejected | partially_refunded.
+// Missed deadlines may resolve an opened dispute directly.
+type DisputeStatus string
+
+const (
+	DisputeOpened            DisputeStatus = "opened"
+	DisputeUnderReview       DisputeStatus = "under_review"
+	DisputeApproved          DisputeStatus = "approved"           // Buyer refunded in full
+	DisputeRejected          DisputeStatus = "rejected"           // Funds released to the provider
+	DisputePartiallyRefunded DisputeStatus = "partially_refunded" // Buyer refunded in part, the rest released
 )
 
+var disputeTransitions = map[DisputeStatus][]DisputeStatus{
+	DisputeOpened:      {DisputeUnderReview, DisputeApproved, DisputeRejected},
+	DisputeUnderReview: {DisputeApproved, DisputeRejected, DisputePartiallyRefunded},
+}
+
+// CanMoveTo reports whether the state machine allows the transition
+func (s DisputeStatus) CanMoveTo(next DisputeStatus) bool {
+	for _, allowed := range disputeTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolved reports whether the dispute is closed with an outcome
+func (s DisputeStatus) Resolved() bool {
+	return s == DisputeApproved || s == DisputeRejected || s == DisputePartiallyRefunded
+}
+
+// DisputeParty is the side of a dispute a user is on
+type DisputeParty string
+
+const (
+	PartyClaimant   DisputeParty = "claimant"   // Raised the dispute
+	PartyRespondent DisputeParty = "respondent" // Provider of the claimed surplus
+)
+
+// PlatformActor raises disputes the platform detected itself, such as a
+// cold-chain excursion on a sensor trace; it is never the claim's provider
+const PlatformActor = "platform"
+
 // Dispute represents a user-raised dispute for a claim transaction.
 type Dispute struct {
-	ID        string    `json:"id"`
-	ClaimID   string    `json:"claim_id" validate:"required"`
-	UserID    string    `json:"user_id" validate:"required"`
-	Reason    string    `json:"reason" validate:"required"`
-	Evidence  string    `json:"evidence_url"`
-	Status    string    `json:"status"` // pending, approved, rejected
-	CreatedAt time.Time `json:"created_at"`
+	ID           string        `json:"id"`
+	ClaimID      string        `json:"claim_id" validate:"required"`
+	PaymentID    string        `json:"payment_id,omitempty"` // Escrowed order; empty for donations
+	UserID       string        `json:"user_id" validate:"required"`
+	ProviderID   string        `json:"provider_id"`
+	Reason       string        `json:"reason" validate:"required"`
+	Evidence     string        `json:"evidence_url"`
+	Status       DisputeStatus `json:"status"`
+	RefundAmount money.Money   `json:"refund_amount,omitzero"`
+	Resolution   string        `json:"resolution,omitempty"`
+	ResolvedBy   string        `json:"resolved_by,omitempty"`
+
+	// Deadlines: the claimant must back the dispute with evidence, the provider
+	// must answer it, and staff must decide once both sides are heard
+	ClaimantEvidenceDueAt time.Time  `json:"claimant_evidence_due_at"`
+	ResponseDueAt         time.Time  `json:"response_due_at"`
+	ReviewDueAt           *time.Time `json:"review_due_at,omitempty"`
+	ClaimantEvidenceAt    *time.Time `json:"claimant_evidence_at,omitempty"`
+	RespondedAt           *time.Time `json:"responded_at,omitempty"`
+	EscalatedAt           *time.Time `json:"escalated_at,omitempty"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Party reports which side of the dispute the user is on
+func (d *Dispute) Party(userID string) (DisputeParty, bool) {
+	switch userID {
+	case d.UserID:
+		return PartyClaimant, true
+	case d.ProviderID:
+		return PartyRespondent, true
+	}
+	return "", false
+}
+
+// DisputeEvidence is one piece of evidence: an uploaded file or a link
+type DisputeEvidence struct {
+	ID          string       `json:"id"`
+	DisputeID   string       `json:"dispute_id"`
+	SubmittedBy string       `json:"submitted_by"`
+	Party       DisputeParty `json:"party"`
+	URL         string       `json:"url"`
+	FileName    string       `json:"file_name,omitempty"`
+	ContentType string       `json:"content_type,omitempty"`
+	Size        int64        `json:"size,omitempty"`
+	SHA256      string       `json:"sha256,omitempty"` // Uploaded files only
+	Note        string       `json:"note,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// Resolution is a reviewer's decision on a dispute under review
+type Resolution struct {
+	Outcome      DisputeStatus `json:"outcome"`
+	RefundAmount money.Money   `json:"refund_amount"` // partially_refunded only
+	Note         string        `json:"note"`
+	ResolvedBy   string        `json:"resolved_by"`
+}
+
+// DefaultSLATier times claims whose delivery has no tier (self-pickups) or
+// one the policy does not list
+const DefaultSLATier = "STANDARD"
+
+// StaleClaimSLA is how long a paid claim may sit in each escrow stage
+type StaleClaimSLA struct {
+	AwaitingPickup time.Duration // LOCKED: courier found or buyer collected
+	Pickup         time.Duration // PICKUP_IN_PROGRESS: courier picked the food up
+}
+
+// DisputePolicy sets how long each party has to act
+type DisputePolicy struct {
+	ClaimantEvidenceWindow time.Duration // Claimant backs the dispute or it is rejected
+	ResponseWindow         time.Duration // Provider answers or the buyer is refunded
+	ReviewWindow           time.Duration // Staff decide or the dispute is escalated
+
+	// Paid claims that stall are refunded automatically, on the SLA of the
+	// delivery's tier (EXPRESS, STANDARD, ...)
+	StaleClaimSLAs map[string]StaleClaimSLA
+	MinShelfLife   time.Duration // Left before expiry for a refunded surplus to be relisted
+}
+
+func DefaultDisputePolicy() DisputePolicy {
+	return DisputePolicy{
+		ClaimantEvidenceWindow: 24 * time.Hour,
+		ResponseWindow:         48 * time.Hour,
+		ReviewWindow:           72 * time.Hour,
+		StaleClaimSLAs: map[string]StaleClaimSLA{
+			"CRITICAL": {AwaitingPickup: 10 * time.Minute, Pickup: 20 * time.Minute},
+			"EXPRESS":  {AwaitingPickup: 10 * time.Minute, Pickup: 30 * time.Minute},
+			"STANDARD": {AwaitingPickup: 15 * time.Minute, Pickup: 45 * time.Minute},
+			"HEMAT":    {AwaitingPickup: 30 * time.Minute, Pickup: 90 * time.Minute},
+		},
+		MinShelfLife: time.Hour,
+	}
+}
+
+// StaleCutoffs is, per tier, since when a claim in each stage counts as
+// stale at now. DefaultSLATier is always present.
+func (p DisputePolicy) StaleCutoffs(now time.Time) map[string]StaleCutoff {
+	cutoffs := make(map[string]StaleCutoff, len(p.StaleClaimSLAs)+1)
+	for tier, sla := range p.StaleClaimSLAs {
+		cutoffs[tier] = StaleCutoff{AwaitingBefore: now.Add(-sla.AwaitingPickup), PickupBefore: now.Add(-sla.Pickup)}
+	}
+	if _, ok := cutoffs[DefaultSLATier]; !ok {
+		sla := DefaultDisputePolicy().StaleClaimSLAs[DefaultSLATier]
+		cutoffs[DefaultSLATier] = StaleCutoff{AwaitingBefore: now.Add(-sla.AwaitingPickup), PickupBefore: now.Add(-sla.Pickup)}
+	}
+	return cutoffs
+}
+
+type DisputeRepository interface {
+	// Create fails with ErrDisputeAlreadyOpen while the claim has an unresolved dispute
+	Create(ctx context.Context, d *Dispute) error
+	Get(ctx context.Context, id string) (*Dispute, error)
+	// Update writes the dispute only if it is still in the expected status
+	Update(ctx context.Context, d *Dispute, expected DisputeStatus) (bool, error)
+	AddEvidence(ctx context.Context, e *DisputeEvidence) error
+	Evidence(ctx context.Context, disputeID string) ([]DisputeEvidence, error)
+	// Overdue lists unresolved disputes with a deadline before now
+	Overdue(ctx context.Context, now time.Time) ([]Dispute, error)
+	// ClaimProvider resolves the provider whose surplus was claimed
+	ClaimProvider(ctx context.Context, claimID string) (string, error)
+	// LostDisputes counts disputes decided against the user: upheld against them
+	// as provider, or rejected when they raised it
+	LostDisputes(ctx context.Context, userID string) (int, error)
+}
+
+// EvidenceStore keeps uploaded evidence files and returns where they can be read
+type EvidenceStore interface {
+	Save(ctx context.Context, key, contentType string, r io.Reader) (string, error)
 }
 
 // DisputeUsecase defines the business logic interface for dispute management.
 type DisputeUsecase interface {
 	RaiseDispute(ctx context.Context, dispute *Dispute) error
-	ResolveDispute(ctx context.Context, disputeID string, status string) error
+	GetDispute(ctx context.Context, disputeID string) (*Dispute, []DisputeEvidence, error)
+	AddEvidence(ctx context.Context, evidence *DisputeEvidence, file io.Reader) error
+	StartReview(ctx context.Context, disputeID, reviewerID string) error
+	ResolveDispute(ctx context.Context, disputeID string, resolution Resolution) error
+	EnforceDeadlines(ctx context.Context, now time.Time) error
+	RunDeadlineEnforcer(ctx context.Context)
 	AutoRefundStaleClaims(ctx context.Context) error
+	RunStaleClaimRefunder(ctx context.Context)
 }
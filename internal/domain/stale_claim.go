@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ClaimStage is how far a paid claim got before it stalled
+type ClaimStage string
+
+const (
+	StageAwaitingPickup   ClaimStage = "awaiting_pickup"    // Escrow LOCKED: no courier yet, or the buyer never came
+	StagePickupInProgress ClaimStage = "pickup_in_progress" // Escrow PICKUP_IN_PROGRESS: courier assigned, never picked up
+)
+
+// StaleClaim is a claim whose escrow has sat in one stage past its SLA
+type StaleClaim struct {
+	OrderID       string
+	Stage         ClaimStage
+	Since         time.Time // Last escrow event
+	ProviderID    string
+	ClaimantID    string // Buyer or NGO refunded
+	Fulfillment   string // 'courier', 'self_pickup'
+	CourierUserID string // Assigned rider, if any
+	FoodUnsafe    bool   // Condemned on a cold-chain excursion: never relisted
+	SLATier       string // Tier it was timed on; DefaultSLATier when the delivery had none
+}
+
+// StaleCutoff is, for one SLA tier, when claims in each stage went stale
+type StaleCutoff struct {
+	AwaitingBefore time.Time
+	PickupBefore   time.Time
+}
+
+// GhostingIncident is a no-show recorded against whoever let the claim lapse
+type GhostingIncident struct {
+	OrderID    string     `json:"order_id"`
+	UserID     string     `json:"user_id"`
+	Party      string     `json:"party"` // 'claimant', 'courier'
+	Stage      ClaimStage `json:"stage"`
+	DetectedAt time.Time  `json:"detected_at"`
+}
+
+type StaleClaimRepository interface {
+	// Stale lists claims whose escrow has sat in its stage since before the
+	// cutoff of the delivery's SLA tier (DefaultSLATier's if it has no listed tier)
+	Stale(ctx context.Context, cutoffs map[string]StaleCutoff, limit int) ([]StaleClaim, error)
+	// Close fails the open delivery, records the incident and puts the surplus
+	// back on the market if it stays fresh until freshUntil (otherwise expires it).
+	// closed is false when the delivery moved on in the meantime.
+	Close(ctx context.Context, claim StaleClaim, incident *GhostingIncident, freshUntil time.Time) (closed, relisted bool, err error)
+	GhostingIncidents(ctx context.Context, userID string) (int, error)
+}
@@ -2,7 +2,10 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
 )
 
 type EventType string
@@ -14,49 +17,140 @@ const (
 	FoodDelivered    EventType = "FoodDelivered"
 	FundsReleased    EventType = "FundsReleased"
 	OrderCancelled   EventType = "OrderCancelled"
-	DisputeRaised    EventType = "DisputeRaise"
+	DisputeRaised    EventType = "DisputeRaised"
+	// PartiallyRefunded returns part of a disputed order to the buyer; the rest is released
+	PartiallyRefunded EventType = "PartiallyRefunded"
+)
+
+type Status string
+
+const (
+	StatusPending                 Status = "PENDING"
+	StatusLocked                  Status = "LOCKED"
+	StatusPickupInProgress        Status = "PICKUP_IN_PROGRESS"
+	StatusDeliveryInProgress      Status = "DELIVERY_IN_PROGRESS"
+	StatusConfirmedPendingRelease Status = "CONFIRMED_PENDING_RELEASE"
+	StatusDisputed                Status = "DISPUTED"
+	StatusClosed                  Status = "CLOSED"    // Paid out to the provider
+	StatusCancelled               Status = "CANCELLED" // Refunded to the buyer
+)
+
+var (
+	ErrEscrowNotFound      = errors.New("escrow not found")
+	ErrConcurrencyConflict = errors.New("escrow stream changed concurrently")
+	ErrInvalidTransition   = errors.New("invalid escrow transition")
 )
 
 // EscrowEvent represents an immutable fact in the financial ledger
 type EscrowEvent struct {
-	ID        string    `json:"id"`
-	OrderID   string    `json:"order_id"`
-	Amount    float64   `json:"amount"`
-	Type      EventType `json:"type"`
-	Timestamp time.Time `json:"timestamp"`
-	Payload   string    `json:"payload"`
+	ID        string      `json:"id"`
+	OrderID   string      `json:"order_id"`
+	Version   int         `json:"version"` // Position in the order's stream, from 1
+	Amount    money.Money `json:"amount"`
+	Type      EventType   `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Payload   string      `json:"payload"`
 }
 
 type EscrowState struct {
-	OrderID     string
-	TotalLocked float64
-	Status      string
-	LastUpdated time.Time
+	OrderID     string      `json:"order_id"`
+	Version     int         `json:"version"`      // Last event folded in; 0 before any
+	Collected   money.Money `json:"collected"`    // Paid in by the buyer
+	Refunded    money.Money `json:"refunded"`     // Returned to the buyer by a partial refund
+	TotalLocked money.Money `json:"total_locked"` // Still held in escrow
+	Status      Status      `json:"status"`
+	LastEvent   EventType   `json:"last_event,omitempty"`
+	LastUpdated time.Time   `json:"last_updated"`
 }
 
 // Repository defines the contract for storing events (Event Store)
 type Repository interface {
+	// Save appends the event at event.Version. ErrConcurrencyConflict when that
+	// version is already taken: someone else appended after the caller's read.
 	Save(ctx context.Context, event EscrowEvent) error
 	GetEventsByOrder(ctx context.Context, orderID string) ([]EscrowEvent, error)
+	// GetEventsSince returns the events after the given version, oldest first
+	GetEventsSince(ctx context.Context, orderID string, version int) ([]EscrowEvent, error)
+
+	// Snapshots cut rehydration of long streams short; they are an optimisation
+	// only and may lag the stream
+	SaveSnapshot(ctx context.Context, state EscrowState) error
+	GetSnapshot(ctx context.Context, orderID string) (*EscrowState, error)
 }
 
-// ApplyEvents reconstructs the current state from history (Rehydration)
-func RehydrateState(events []EscrowEvent) *EscrowState {
-	state := &EscrowState{Status: "PENDING"}
+// transitions lists which facts can follow each state. Anything else is a
+// bug or a stale message and must not reach the ledger.
+var transitions = map[Status][]EventType{
+	StatusPending:                 {PaymentCollected, OrderCancelled},
+	StatusLocked:                  {CourierAssigned, FoodPickedUp, FoodDelivered, OrderCancelled, DisputeRaised},
+	StatusPickupInProgress:        {CourierAssigned, FoodPickedUp, FoodDelivered, OrderCancelled, DisputeRaised},
+	StatusDeliveryInProgress:      {FoodDelivered, DisputeRaised},
+	StatusConfirmedPendingRelease: {FundsReleased, DisputeRaised},
+	StatusDisputed:                {FundsReleased, OrderCancelled, PartiallyRefunded},
+}
+
+// NewEscrowState is the state of an order with no events yet
+func NewEscrowState(orderID string) *EscrowState {
+	return &EscrowState{OrderID: orderID, Status: StatusPending}
+}
+
+// Accepts reports whether the event type may be appended in this state
+func (s *EscrowState) Accepts(t EventType) bool {
+	if t == OrderCancelled && s.Refunded.IsPositive() {
+		return false // A partly refunded order is settled by releasing the rest
+	}
+	for _, allowed := range transitions[s.Status] {
+		if allowed == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply folds one event into the state. It is the only place that decides
+// what an event means.
+func (s *EscrowState) Apply(e EscrowEvent) {
+	switch e.Type {
+	case PaymentCollected:
+		s.Collected = e.Amount
+		s.TotalLocked = e.Amount
+		s.Status = StatusLocked
+	case CourierAssigned:
+		s.Status = StatusPickupInProgress
+	case FoodPickedUp:
+		s.Status = StatusDeliveryInProgress
+	case FoodDelivered:
+		s.Status = StatusConfirmedPendingRelease
+	case FundsReleased:
+		s.TotalLocked = money.Rupiah(0)
+		s.Status = StatusClosed
+	case OrderCancelled:
+		s.TotalLocked = money.Rupiah(0)
+		s.Status = StatusCancelled
+	case DisputeRaised:
+		s.Status = StatusDisputed
+	case PartiallyRefunded:
+		s.Refunded = s.Refunded.Add(e.Amount)
+		s.TotalLocked = s.TotalLocked.Sub(e.Amount)
+	}
+	s.Version = e.Version
+	s.LastEvent = e.Type
+	s.LastUpdated = e.Timestamp
+}
+
+// RehydrateState reconstructs the current state from history, starting from a
+// snapshot when there is one (nil otherwise)
+func RehydrateState(orderID string, snapshot *EscrowState, events []EscrowEvent) *EscrowState {
+	state := NewEscrowState(orderID)
+	if snapshot != nil {
+		copied := *snapshot
+		state = &copied
+	}
 	for _, e := range events {
-		switch e.Type {
-		case PaymentCollected:
-			state.TotalLocked = e.Amount
-			state.Status = "LOCKED"
-		case FoodDelivered:
-			state.Status = "CONFIRMED_PENDING_RELEASE"
-		case FundsReleased:
-			state.TotalLocked = 0
-			state.Status = "CLOSED"
-		case DisputeRaised:
-			state.Status = "DISPUTED"
+		if e.Version <= state.Version {
+			continue // Already in the snapshot
 		}
-		state.LastUpdated = e.Timestamp
+		state.Apply(e)
 	}
 	return state
 }
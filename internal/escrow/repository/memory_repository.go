@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
+)
+
+type memoryRepository struct {
+	mu        sync.Mutex
+	streams   map[string][]domain.EscrowEvent
+	snapshots map[string]domain.EscrowState
+}
+
+// NewMemoryRepository is an event store for the demo server, with the same
+// version check as Postgres. Nothing survives a restart.
+func NewMemoryRepository() domain.Repository {
+	return &memoryRepository{
+		streams:   make(map[string][]domain.EscrowEvent),
+		snapshots: make(map[string]domain.EscrowState),
+	}
+}
+
+func (r *memoryRepository) Save(ctx context.Context, e domain.EscrowEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e.Version != len(r.streams[e.OrderID])+1 {
+		return domain.ErrConcurrencyConflict
+	}
+	r.streams[e.OrderID] = append(r.streams[e.OrderID], e)
+	return nil
+}
+
+func (r *memoryRepository) GetEventsByOrder(ctx context.Context, orderID string) ([]domain.EscrowEvent, error) {
+	return r.GetEventsSince(ctx, orderID, 0)
+}
+
+func (r *memoryRepository) GetEventsSince(ctx context.Context, orderID string, version int) ([]domain.EscrowEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stream := r.streams[orderID]
+	if version >= len(stream) {
+		return nil, nil
+	}
+	return append([]domain.EscrowEvent(nil), stream[version:]...), nil
+}
+
+func (r *memoryRepository) SaveSnapshot(ctx context.Context, s domain.EscrowState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.snapshots[s.OrderID]; !ok || existing.Version < s.Version {
+		r.snapshots[s.OrderID] = s
+	}
+	return nil
+}
+
+func (r *memoryRepository) GetSnapshot(ctx context.Context, orderID string) (*domain.EscrowState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.snapshots[orderID]
+	if !ok {
+		return nil, nil
+	}
+	return &s, nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
+)
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository is the escrow event store: one append-only stream per order
+func NewPostgresRepository(db *sql.DB) domain.Repository {
+	return &postgresRepository{db: db}
+}
+
+// Save relies on the (order_id, version) key: of two writers that read the same
+// version, exactly one gets the row
+func (r *postgresRepository) Save(ctx context.Context, e domain.EscrowEvent) error {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO escrow_events (id, order_id, version, type, amount, payload, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (order_id, version) DO NOTHING
+	`, e.ID, e.OrderID, e.Version, e.Type, e.Amount, e.Payload, e.Timestamp)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrConcurrencyConflict
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetEventsByOrder(ctx context.Context, orderID string) ([]domain.EscrowEvent, error) {
+	return r.GetEventsSince(ctx, orderID, 0)
+}
+
+func (r *postgresRepository) GetEventsSince(ctx context.Context, orderID string, version int) ([]domain.EscrowEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, order_id, version, type, amount, payload, occurred_at
+		FROM escrow_events
+		WHERE order_id = $1 AND version > $2
+		ORDER BY version
+	`, orderID, version)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var events []domain.EscrowEvent
+	for rows.Next() {
+		var e domain.EscrowEvent
+		if err := rows.Scan(&e.ID, &e.OrderID, &e.Version, &e.Type, &e.Amount, &e.Payload, &e.Timestamp); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// SaveSnapshot never moves a snapshot backwards
+func (r *postgresRepository) SaveSnapshot(ctx context.Context, s domain.EscrowState) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO escrow_snapshots (order_id, version, status, collected, refunded, total_locked, last_event, last_updated)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (order_id) DO UPDATE
+		SET version = EXCLUDED.version, status = EXCLUDED.status,
+		    collected = EXCLUDED.collected, refunded = EXCLUDED.refunded, total_locked = EXCLUDED.total_locked,
+		    last_event = EXCLUDED.last_event, last_updated = EXCLUDED.last_updated, created_at = NOW()
+		WHERE escrow_snapshots.version < EXCLUDED.version
+	`, s.OrderID, s.Version, s.Status, s.Collected, s.Refunded, s.TotalLocked, s.LastEvent, s.LastUpdated)
+	return err
+}
+
+func (r *postgresRepository) GetSnapshot(ctx context.Context, orderID string) (*domain.EscrowState, error) {
+	s := domain.EscrowState{OrderID: orderID}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT version, status, collected, refunded, total_locked, last_event, last_updated
+		FROM escrow_snapshots
+		WHERE order_id = $1
+	`, orderID).Scan(&s.Version, &s.Status, &s.Collected, &s.Refunded, &s.TotalLocked, &s.LastEvent, &s.LastUpdated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
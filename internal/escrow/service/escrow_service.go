@@ -2,96 +2,159 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 
 	"github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
 )
 
+const (
+	// SnapshotEvery events a snapshot of the state is stored alongside the stream
+	SnapshotEvery = 20
+	// appendRetries bounds how often a command re-reads the stream after losing a race
+	appendRetries = 3
+)
+
+// EscrowService is the single escrow ledger: every change is an event appended
+// to the order's stream in the event store, and state is only ever rehydrated
 type EscrowService struct {
-	// In production: Postgres + Kafka
-	events []domain.EscrowEvent // In-memory store for demo
+	repo   domain.Repository
+	logger *zap.Logger
 }
 
-func NewEscrowService() *EscrowService {
-	return &EscrowService{
-		events: make([]domain.EscrowEvent, 0),
-	}
+func NewEscrowService(repo domain.Repository, logger *zap.Logger) *EscrowService {
+	return &EscrowService{repo: repo, logger: logger}
 }
 
 // SecurePayment locks funds using Append-Only Log
-func (s *EscrowService) SecurePayment(ctx context.Context, orderID string, amount float64) error {
-	event := domain.EscrowEvent{
-		ID:        uuid.New().String(),
-		OrderID:   orderID,
-		Type:      domain.PaymentCollected, // Money is SAFE in Escrow
-		Amount:    amount,
-		Timestamp: time.Now(),
+func (s *EscrowService) SecurePayment(ctx context.Context, orderID string, amount money.Money) error {
+	if !amount.IsPositive() {
+		return fmt.Errorf("escrow amount must be positive, got %s", amount)
 	}
-	s.events = append(s.events, event)
-	return nil
+	_, err := s.append(ctx, orderID, domain.PaymentCollected, amount, "")
+	return err
 }
 
 // ReleaseFunds transfers money to Courier/Provider after delivery confirmation
+// (or after a dispute is settled in the provider's favour)
 func (s *EscrowService) ReleaseFunds(ctx context.Context, orderID string) error {
-	// Rehydrate to check if eligible
-	state := s.getAggregatedState(orderID)
-	if state.Status != "CONFIRMED_PENDING_RELEASE" {
-		return fmt.Errorf("cannot release funds: state is %s", state.Status)
-	}
+	_, err := s.append(ctx, orderID, domain.FundsReleased, money.Money{}, "")
+	return err
+}
+
+// Cancel refunds the buyer: the order will not be (or was not) fulfilled
+func (s *EscrowService) Cancel(ctx context.Context, orderID, reason string) error {
+	_, err := s.append(ctx, orderID, domain.OrderCancelled, money.Money{}, reason)
+	return err
+}
 
-	event := domain.EscrowEvent{
-		ID:        uuid.New().String(),
-		OrderID:   orderID,
-		Type:      domain.FundsReleased,
-		Timestamp: time.Now(),
+// RaiseDispute freezes the funds until the dispute is resolved
+func (s *EscrowService) RaiseDispute(ctx context.Context, orderID, reason string) error {
+	_, err := s.append(ctx, orderID, domain.DisputeRaised, money.Money{}, reason)
+	return err
+}
+
+// PartialRefund returns part of a disputed order to the buyer; ReleaseFunds
+// then pays the provider what is left
+func (s *EscrowService) PartialRefund(ctx context.Context, orderID string, amount money.Money, reason string) error {
+	state, err := s.State(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if state.LastEvent == domain.PartiallyRefunded {
+		return nil // Already refunded
+	}
+	if !amount.IsPositive() || !amount.LessThan(state.TotalLocked) {
+		return fmt.Errorf("partial refund %s out of range for %s held", amount, state.TotalLocked)
 	}
-	s.events = append(s.events, event)
-	return nil
+	_, err = s.append(ctx, orderID, domain.PartiallyRefunded, amount, reason)
+	return err
 }
 
-func (s *EscrowService) FoodDelivered(ctx context.Context, orderID string) {
-	s.events = append(s.events, domain.EscrowEvent{
-		ID:        uuid.New().String(),
-		OrderID:   orderID,
-		Type:      domain.FoodDelivered,
-		Timestamp: time.Now(),
-	})
+// CourierAssigned moves the escrow into PICKUP_IN_PROGRESS
+func (s *EscrowService) CourierAssigned(ctx context.Context, orderID string) error {
+	_, err := s.append(ctx, orderID, domain.CourierAssigned, money.Money{}, "")
+	return err
 }
 
-// Private: Rehydrate State on the fly
-func (s *EscrowService) getAggregatedState(orderID string) *domain.EscrowState {
-	var relevantEvents []domain.EscrowEvent
-	for _, e := range s.events {
-		if e.OrderID == orderID {
-			relevantEvents = append(relevantEvents, e)
-		}
+// FoodPickedUp moves the escrow into DELIVERY_IN_PROGRESS
+func (s *EscrowService) FoodPickedUp(ctx context.Context, orderID string) error {
+	_, err := s.append(ctx, orderID, domain.FoodPickedUp, money.Money{}, "")
+	return err
+}
+
+// FoodDelivered moves the escrow into CONFIRMED_PENDING_RELEASE
+func (s *EscrowService) FoodDelivered(ctx context.Context, orderID string) error {
+	_, err := s.append(ctx, orderID, domain.FoodDelivered, money.Money{}, "")
+	return err
+}
+
+// State rehydrates the order's escrow from the latest snapshot plus the events after it
+func (s *EscrowService) State(ctx context.Context, orderID string) (*domain.EscrowState, error) {
+	snapshot, err := s.repo.GetSnapshot(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	since := 0
+	if snapshot != nil {
+		since = snapshot.Version
+	}
+	events, err := s.repo.GetEventsSince(ctx, orderID, since)
+	if err != nil {
+		return nil, err
 	}
+	return domain.RehydrateState(orderID, snapshot, events), nil
+}
+
+// append runs one command: rehydrate, check the transition, write at the next
+// version. Losing the race to another writer re-reads and re-checks, so two
+// replicas can never both release (or refund) the same money.
+func (s *EscrowService) append(ctx context.Context, orderID string, t domain.EventType, amount money.Money, payload string) (*domain.EscrowState, error) {
+	for attempt := 0; attempt < appendRetries; attempt++ {
+		state, err := s.State(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
+		// Redelivered messages and retried requests land here: nothing new to record
+		if state.LastEvent == t && t != domain.PaymentCollected {
+			return state, nil
+		}
+		if state.Version == 0 && t != domain.PaymentCollected {
+			return nil, domain.ErrEscrowNotFound
+		}
+		if !state.Accepts(t) {
+			return nil, fmt.Errorf("%w: %s in %s", domain.ErrInvalidTransition, t, state.Status)
+		}
+
+		event := domain.EscrowEvent{
+			ID:        uuid.New().String(),
+			OrderID:   orderID,
+			Version:   state.Version + 1,
+			Amount:    amount,
+			Type:      t,
+			Timestamp: time.Now(),
+			Payload:   payload,
+		}
+		err = s.repo.Save(ctx, event)
+		if errors.Is(err, domain.ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
 
-	// Default state
-	state := &domain.EscrowState{Status: "PENDING", OrderID: orderID}
-
-	// Apply events in order
-	for _, e := range relevantEvents {
-		switch e.Type {
-		case domain.PaymentCollected:
-			state.Status = "LOCKED"
-			state.TotalLocked = e.Amount
-		case domain.CourierAssigned:
-			state.Status = "PICKUP_IN_PROGRESS"
-		case domain.FoodPickedUp:
-			state.Status = "DELIVERY_IN_PROGRESS"
-		case domain.FoodDelivered:
-			state.Status = "CONFIRMED_PENDING_RELEASE"
-		case domain.FundsReleased:
-			state.Status = "CLOSED"
-			state.TotalLocked = 0
-		case domain.DisputeRaised:
-			state.Status = "DISPUTED"
+		state.Apply(event)
+		if state.Version%SnapshotEvery == 0 {
+			if err := s.repo.SaveSnapshot(ctx, *state); err != nil {
+				s.logger.Warn("Failed to snapshot escrow", zap.String("order_id", orderID), zap.Error(err))
+			}
 		}
-		state.LastUpdated = e.Timestamp
+		return state, nil
 	}
-	return state
+	return nil, domain.ErrConcurrencyConflict
 }
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/escrow/repository"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+// racingRepo lets another writer append first, once, right before our Save
+type racingRepo struct {
+	domain.Repository
+	rival *domain.EscrowEvent
+}
+
+func (r *racingRepo) Save(ctx context.Context, e domain.EscrowEvent) error {
+	if r.rival != nil {
+		rival := *r.rival
+		r.rival = nil
+		rival.Version = e.Version
+		if err := r.Repository.Save(ctx, rival); err != nil {
+			return err
+		}
+	}
+	return r.Repository.Save(ctx, e)
+}
+
+func TestEscrow_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	svc := NewEscrowService(repository.NewMemoryRepository(), zap.NewNop())
+
+	if err := svc.FoodDelivered(ctx, "o1"); !errors.Is(err, domain.ErrEscrowNotFound) {
+		t.Fatalf("Expected no escrow before payment, got %v", err)
+	}
+	if err := svc.SecurePayment(ctx, "o1", money.Rupiah(25000)); err != nil {
+		t.Fatalf("SecurePayment: %v", err)
+	}
+	if err := svc.ReleaseFunds(ctx, "o1"); !errors.Is(err, domain.ErrInvalidTransition) {
+		t.Fatalf("Funds must not be released before delivery, got %v", err)
+	}
+
+	steps := []struct {
+		do   func(context.Context, string) error
+		want domain.Status
+	}{
+		{svc.CourierAssigned, domain.StatusPickupInProgress},
+		{svc.FoodPickedUp, domain.StatusDeliveryInProgress},
+		{svc.FoodDelivered, domain.StatusConfirmedPendingRelease},
+		{svc.FoodDelivered, domain.StatusConfirmedPendingRelease}, // Redelivered message
+		{svc.ReleaseFunds, domain.StatusClosed},
+	}
+	for _, step := range steps {
+		if err := step.do(ctx, "o1"); err != nil {
+			t.Fatalf("Step to %s: %v", step.want, err)
+		}
+		state, _ := svc.State(ctx, "o1")
+		if state.Status != step.want {
+			t.Fatalf("Expected %s, got %s", step.want, state.Status)
+		}
+	}
+
+	state, _ := svc.State(ctx, "o1")
+	if state.Version != 5 || !state.TotalLocked.IsZero() || state.Collected.Units() != 25000 {
+		t.Errorf("Expected 5 events with the money paid out, got %+v", state)
+	}
+}
+
+func TestEscrow_ConcurrentWriterWins(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryRepository()
+	repo := &racingRepo{Repository: store}
+	svc := NewEscrowService(repo, zap.NewNop())
+
+	_ = svc.SecurePayment(ctx, "o1", money.Rupiah(25000))
+	_ = svc.FoodDelivered(ctx, "o1")
+
+	// A dispute lands between our read and our write: the release must re-check and fail
+	repo.rival = &domain.EscrowEvent{ID: "rival", OrderID: "o1", Type: domain.DisputeRaised, Timestamp: time.Now()}
+	if err := svc.ReleaseFunds(ctx, "o1"); err != nil {
+		t.Fatalf("Expected the release to go through on retry from DISPUTED, got %v", err)
+	}
+	events, _ := store.GetEventsByOrder(ctx, "o1")
+	if len(events) != 4 || events[2].Type != domain.DisputeRaised || events[3].Type != domain.FundsReleased {
+		t.Fatalf("Expected the release to be appended after the dispute, got %+v", events)
+	}
+
+	_ = svc.SecurePayment(ctx, "o2", money.Rupiah(10000))
+	repo.rival = &domain.EscrowEvent{ID: "rival-2", OrderID: "o2", Type: domain.OrderCancelled, Timestamp: time.Now()}
+	if err := svc.FoodDelivered(ctx, "o2"); !errors.Is(err, domain.ErrInvalidTransition) {
+		t.Errorf("Expected a cancelled order to refuse delivery, got %v", err)
+	}
+}
+
+func TestEscrow_SnapshotsLongStreams(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryRepository()
+	svc := NewEscrowService(store, zap.NewNop())
+
+	// Reassignments make long streams: payment, then courier after courier
+	now := time.Now()
+	_ = store.Save(ctx, domain.EscrowEvent{ID: "e1", OrderID: "o1", Version: 1, Type: domain.PaymentCollected, Amount: money.Rupiah(30000), Timestamp: now})
+	for v := 2; v < SnapshotEvery; v++ {
+		_ = store.Save(ctx, domain.EscrowEvent{OrderID: "o1", Version: v, Type: domain.CourierAssigned, Timestamp: now})
+	}
+	if err := svc.FoodPickedUp(ctx, "o1"); err != nil {
+		t.Fatalf("FoodPickedUp: %v", err)
+	}
+
+	snapshot, _ := store.GetSnapshot(ctx, "o1")
+	if snapshot == nil || snapshot.Version != SnapshotEvery || snapshot.Status != domain.StatusDeliveryInProgress {
+		t.Fatalf("Expected a snapshot at version %d, got %+v", SnapshotEvery, snapshot)
+	}
+
+	_ = svc.FoodDelivered(ctx, "o1")
+	events, _ := store.GetEventsByOrder(ctx, "o1")
+	full := domain.RehydrateState("o1", nil, events)
+	fromSnapshot, _ := svc.State(ctx, "o1")
+	if *full != *fromSnapshot {
+		t.Errorf("Snapshot rehydration diverged: %+v vs %+v", fromSnapshot, full)
+	}
+	if full.Status != domain.StatusConfirmedPendingRelease || full.TotalLocked.Units() != 30000 {
+		t.Errorf("Unexpected state %+v", full)
+	}
+}
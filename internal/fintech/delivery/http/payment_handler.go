@@ -0,0 +1,140 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	iamMiddleware "github.com/albnnaardy11/pahlawan-pangan/internal/auth/middleware"
+	escrowDomain "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/fintech"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/fintech/gateway"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/ledger"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/matching"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+type PaymentHandler struct {
+	escrow   *fintech.EscrowService
+	vouchers *matching.VoucherService
+}
+
+func NewPaymentHandler(escrow *fintech.EscrowService) *PaymentHandler {
+	return &PaymentHandler{escrow: escrow, vouchers: &matching.VoucherService{}}
+}
+
+// POST /api/v1/payments
+// Payload: {"order_id": "...", "voucher_code": "ZEROWASTE", "method": "wallet"}
+// The signed-in buyer pays the order's listed price. Without a method they
+// are charged through the gateway.
+func (h *PaymentHandler) CreatePayment(w http.ResponseWriter, r *http.Request) {
+	user, ok := iamMiddleware.CurrentUser(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		OrderID     string `json:"order_id"`
+		VoucherCode string `json:"voucher_code"`
+		Method      string `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OrderID == "" ||
+		(req.Method != "" && req.Method != fintech.WalletGateway) {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	amount, err := h.escrow.OrderPrice(r.Context(), req.OrderID)
+	if err != nil {
+		writePaymentError(w, err)
+		return
+	}
+	var discount money.Money
+	if req.VoucherCode != "" {
+		d, ok := h.vouchers.ValidateVoucher(req.VoucherCode, amount)
+		if !ok {
+			http.Error(w, "Invalid voucher", http.StatusBadRequest)
+			return
+		}
+		discount = d
+	}
+
+	pay := h.escrow.LockFunds
+	if req.Method == fintech.WalletGateway {
+		pay = h.escrow.PayFromWallet
+	}
+	payment, err := pay(r.Context(), req.OrderID, user.ID, amount, discount)
+	if err != nil {
+		writePaymentError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(payment)
+}
+
+// GET /api/v1/payments/{order_id}
+func (h *PaymentHandler) GetPayment(w http.ResponseWriter, r *http.Request) {
+	payment, err := h.escrow.Payment(r.Context(), chi.URLParam(r, "order_id"))
+	if err != nil {
+		writePaymentError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(payment)
+}
+
+// POST /api/v1/payments/webhooks/{gateway}
+// Signed status callbacks from the payment gateway
+func (h *PaymentHandler) GatewayWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.escrow.HandleWebhook(r.Context(), chi.URLParam(r, "gateway"), body, r.Header.Get(gateway.SignatureHeader))
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, fintech.ErrUnmappedGatewayStatus):
+		// Informational states: acknowledge so the gateway stops retrying
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writePaymentError(w, err)
+	}
+}
+
+func writePaymentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fintech.ErrPaymentNotFound), errors.Is(err, escrowDomain.ErrEscrowNotFound),
+		errors.Is(err, fintech.ErrUnknownGateway), errors.Is(err, fintech.ErrOrderNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, fintech.ErrInvalidWebhookSignature):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, fintech.ErrOrderNotForSale):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, fintech.ErrPaymentDeclined), errors.Is(err, ledger.ErrInsufficientFunds):
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+	case errors.Is(err, ledger.ErrSpendLimitExceeded):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, escrowDomain.ErrInvalidTransition), errors.Is(err, escrowDomain.ErrConcurrencyConflict),
+		errors.Is(err, fintech.ErrPaidElsewhere):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *PaymentHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Post("/", h.CreatePayment)
+	r.Get("/{order_id}", h.GetPayment)
+	r.Post("/webhooks/{gateway}", h.GatewayWebhook)
+	return r
+}
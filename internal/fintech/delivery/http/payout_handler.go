@@ -0,0 +1,134 @@
+package http
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/fintech"
+)
+
+type PayoutHandler struct {
+	payouts *fintech.PayoutService
+}
+
+func NewPayoutHandler(payouts *fintech.PayoutService) *PayoutHandler {
+	return &PayoutHandler{payouts: payouts}
+}
+
+// GET /api/v1/payouts/providers/{provider_id}/statement?from=2026-03-01&to=2026-03-31&format=csv
+// Dates are inclusive WIB days; without them the statement covers the current month
+func (h *PayoutHandler) GetStatement(w http.ResponseWriter, r *http.Request) {
+	loc := h.payouts.Schedule().Location
+	now := time.Now().In(loc)
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	to := from.AddDate(0, 1, 0)
+
+	q := r.URL.Query()
+	if v := q.Get("from"); v != "" {
+		d, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			http.Error(w, "from must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		from = d
+	}
+	if v := q.Get("to"); v != "" {
+		d, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			http.Error(w, "to must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		to = d.AddDate(0, 0, 1)
+	}
+	if !to.After(from) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+
+	providerID := chi.URLParam(r, "provider_id")
+	st, err := h.payouts.Statement(r.Context(), providerID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch q.Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(st)
+	case "csv":
+		filename := fmt.Sprintf("statement-%s-%s-%s.csv", providerID, from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"))
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		_ = writeStatementCSV(w, st, loc)
+	default:
+		http.Error(w, "format must be csv or json", http.StatusBadRequest)
+	}
+}
+
+// writeStatementCSV lays the statement out for a spreadsheet: one row per
+// order with its commission, one per payout batch with its deductions, then totals
+func writeStatementCSV(w http.ResponseWriter, st *fintech.Statement, loc *time.Location) error {
+	cw := csv.NewWriter(w)
+	n := func(v int64) string { return strconv.FormatInt(v, 10) }
+
+	rows := [][]string{{"line", "date", "order_id", "batch_id", "gross", "fee", "deduction", "net", "status"}}
+	for _, o := range st.Orders {
+		rows = append(rows, []string{"order", o.ReleasedAt.In(loc).Format("2006-01-02"), o.OrderID, o.BatchID,
+			n(o.Gross), n(o.Fee), "0", n(o.Net), ""})
+	}
+	for _, b := range st.Batches {
+		rows = append(rows, []string{"payout", b.CreatedAt.In(loc).Format("2006-01-02"), "", b.ID,
+			n(b.Net), "0", n(b.TransferFee), n(b.Amount), string(b.Status)})
+	}
+	rows = append(rows, []string{"total", "", "", "", n(st.Gross), n(st.Fees), n(st.Deductions), n(st.Net), ""})
+
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// GET /api/v1/payouts/batches/{id}
+func (h *PayoutHandler) GetBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := h.payouts.Batch(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, fintech.ErrPayoutBatchNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(batch)
+}
+
+// POST /api/v1/payouts/run
+// Cuts and submits due batches now instead of waiting for the scheduler
+func (h *PayoutHandler) RunPayouts(w http.ResponseWriter, r *http.Request) {
+	submitted, err := h.payouts.RunPayouts(r.Context(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"submitted": submitted})
+}
+
+func (h *PayoutHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/providers/{provider_id}/statement", h.GetStatement)
+	r.Get("/batches/{id}", h.GetBatch)
+	r.Post("/run", h.RunPayouts)
+	return r
+}
@@ -0,0 +1,183 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	authDomain "github.com/albnnaardy11/pahlawan-pangan/internal/auth/domain"
+	iamMiddleware "github.com/albnnaardy11/pahlawan-pangan/internal/auth/middleware"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/fintech"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/ledger"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+type WalletHandler struct {
+	wallets *fintech.WalletService
+}
+
+func NewWalletHandler(wallets *fintech.WalletService) *WalletHandler {
+	return &WalletHandler{wallets: wallets}
+}
+
+// walletOwner is the route's {user_id}, which only that user may act on
+func walletOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user, ok := iamMiddleware.CurrentUser(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	if owner := chi.URLParam(r, "user_id"); owner != user.ID {
+		http.Error(w, "forbidden: not your wallet", http.StatusForbidden)
+		return "", false
+	}
+	return user.ID, true
+}
+
+// GET /api/v1/wallets/{user_id}
+func (h *WalletHandler) GetWallet(w http.ResponseWriter, r *http.Request) {
+	owner, ok := walletOwner(w, r)
+	if !ok {
+		return
+	}
+	wallet, err := h.wallets.Wallet(r.Context(), owner)
+	if err != nil {
+		writeWalletError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(wallet)
+}
+
+// GET /api/v1/wallets/{user_id}/history?limit=50
+func (h *WalletHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	owner, ok := walletOwner(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxHistoryLimit {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	history, err := h.wallets.History(r.Context(), owner, limit)
+	if err != nil {
+		writeWalletError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"postings": history})
+}
+
+// POST /api/v1/wallets/{user_id}/topups
+// Payload: {"amount": 100000}
+func (h *WalletHandler) TopUp(w http.ResponseWriter, r *http.Request) {
+	owner, ok := walletOwner(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Amount money.Money `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	topUp, err := h.wallets.TopUp(r.Context(), owner, req.Amount)
+	if err != nil {
+		writeWalletError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(topUp)
+}
+
+// PUT /api/v1/wallets/{user_id}/settings
+// Payload: {"instant_refunds": true}
+func (h *WalletHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	owner, ok := walletOwner(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		InstantRefunds *bool `json:"instant_refunds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.InstantRefunds == nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.wallets.SetInstantRefunds(r.Context(), owner, *req.InstantRefunds); err != nil {
+		writeWalletError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/v1/wallets/cashback (admin)
+// Payload: {"campaign_id": "ramadan-2026", "user_id": "...", "order_id": "...", "amount": 5000}
+func (h *WalletHandler) CreditCashback(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CampaignID string `json:"campaign_id"`
+		UserID     string `json:"user_id"`
+		OrderID    string `json:"order_id"`
+		Amount     int64  `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CampaignID == "" || req.UserID == "" || req.Amount <= 0 {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	err := h.wallets.CreditCashback(r.Context(), ledger.Cashback{
+		CampaignID: req.CampaignID,
+		UserID:     req.UserID,
+		OrderID:    req.OrderID,
+		Amount:     req.Amount,
+	})
+	if err != nil {
+		writeWalletError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeWalletError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fintech.ErrInvalidTopUp):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, fintech.ErrTopUpNotFound), errors.Is(err, fintech.ErrUnknownGateway):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, fintech.ErrPaymentDeclined):
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *WalletHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.With(iamMiddleware.RoleGuard(authDomain.RoleAdmin)).Post("/cashback", h.CreditCashback)
+	r.Get("/{user_id}", h.GetWallet)
+	r.Get("/{user_id}/history", h.GetHistory)
+	r.Post("/{user_id}/topups", h.TopUp)
+	r.Put("/{user_id}/settings", h.UpdateSettings)
+	return r
+}
@@ -2,47 +2,456 @@ package fintech
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
-	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	escrowDomain "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
+	escrowService "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/service"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/ledger"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
 )
 
-// EscrowService manages the financial trust layer.
+// PlatformCommissionBps is the platform's take on released orders, in basis points
+const PlatformCommissionBps = 1000
+
+// EscrowService manages the financial trust layer. Order state lives in the
+// escrow event ledger, every rupiah moved is booked in the double-entry
+// journal, and the gateway (or the buyer's wallet) moves the actual money.
+// Released orders are paid to providers in batches by the PayoutService.
 type EscrowService struct {
-	// In production, this would connect to Midtrans, Xendit, or Stripe
+	ledger   *escrowService.EscrowService
+	journal  *ledger.Service
+	payments PaymentRepository
+	payouts  *PayoutService
+	wallets  *WalletService // nil: orders can only be paid through the gateway
+	gateway  PaymentGateway // nil when no processor is configured
+	logger   *zap.Logger
 }
 
 type PaymentRecord struct {
-	ID        string    `json:"id"`
-	Amount    float64   `json:"amount"`
-	Status    string    `json:"status"` // held, released, refunded
-	Timestamp time.Time `json:"timestamp"`
+	ID        string      `json:"id"` // The escrow stream: one per order
+	Amount    money.Money `json:"amount"`
+	Status    string      `json:"status"` // pending, held, released, refunded, failed
+	Gateway   string      `json:"gateway,omitempty"`
+	ChargeID  string      `json:"charge_id,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+func NewEscrowService(ledger *escrowService.EscrowService, journal *ledger.Service, payments PaymentRepository, payouts *PayoutService, wallets *WalletService, gateway PaymentGateway, logger *zap.Logger) *EscrowService {
+	return &EscrowService{ledger: ledger, journal: journal, payments: payments, payouts: payouts, wallets: wallets, gateway: gateway, logger: logger}
 }
 
-func NewEscrowService() *EscrowService {
-	return &EscrowService{}
+// LockFunds charges the buyer and holds the money in escrow until delivery is
+// verified. Methods the buyer completes later (VA, QRIS) come back pending and
+// are locked when the gateway calls back. A voucher discount is taken off the
+// charge and paid into escrow from the promo budget instead. Retrying returns
+// the same payment.
+func (s *EscrowService) LockFunds(ctx context.Context, orderID string, userID string, amount, discount money.Money) (*PaymentRecord, error) {
+	if s.gateway == nil {
+		return nil, ErrUnknownGateway
+	}
+	if err := checkDiscount(amount, discount); err != nil {
+		return nil, err
+	}
+	p, err := s.payments.Get(ctx, orderID)
+	if errors.Is(err, ErrPaymentNotFound) {
+		p, err = s.charge(ctx, orderID, userID, amount, discount)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.Gateway == WalletGateway {
+		return nil, ErrPaidElsewhere
+	}
+
+	switch p.Status {
+	case PaymentFailed:
+		return nil, ErrPaymentDeclined
+	case PaymentCaptured:
+		// Also finishes a collection a crash interrupted
+		if err := s.collect(ctx, p); err != nil {
+			return nil, err
+		}
+	}
+	return s.Payment(ctx, orderID)
 }
 
-// LockFunds holds money from the buyer until delivery is verified.
-func (s *EscrowService) LockFunds(ctx context.Context, userID string, amount float64) (*PaymentRecord, error) {
-	fmt.Printf("💳 [FINTECH] Holding Rp%.2f from User %s in Escrow...\n", amount, userID)
-	return &PaymentRecord{
-		ID:        uuid.New().String(),
-		Amount:    amount,
-		Status:    "held",
-		Timestamp: time.Now(),
-	}, nil
+func (s *EscrowService) charge(ctx context.Context, orderID, userID string, amount, discount money.Money) (*Payment, error) {
+	charged := amount.Sub(discount)
+	charge, err := s.gateway.Authorize(ctx, ChargeRequest{OrderID: orderID, CustomerID: userID, Amount: charged, Capture: true})
+	if err != nil {
+		return nil, err
+	}
+	p := &Payment{
+		OrderID:    orderID,
+		Gateway:    s.gateway.Name(),
+		ChargeID:   charge.ID,
+		CustomerID: userID,
+		Amount:     charged,
+		Discount:   discount,
+		Status:     charge.Status,
+	}
+	created, err := s.payments.Create(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return s.payments.Get(ctx, orderID) // A concurrent request got there first
+	}
+	return p, nil
 }
 
-// ReleaseFunds pays the Provider after verified delivery.
-func (s *EscrowService) ReleaseFunds(ctx context.Context, paymentID string, providerID string) error {
-	fmt.Printf("💰 [FINTECH] Delivery Verified! Releasing funds to Provider %s (Payment ID: %s)\n", providerID, paymentID)
+// checkDiscount keeps a voucher below the order value, so something is always charged
+func checkDiscount(amount, discount money.Money) error {
+	if discount.IsNegative() || !discount.LessThan(amount) {
+		return fmt.Errorf("voucher discount %s out of range for order value %s", discount, amount)
+	}
 	return nil
 }
 
+// PayFromWallet takes the order from the buyer's wallet balance instead of
+// charging them, within the daily limit of their trust level. A voucher works
+// as it does for LockFunds. Retrying returns the same payment; a refused
+// payment can be retried once the wallet is topped up.
+func (s *EscrowService) PayFromWallet(ctx context.Context, orderID string, userID string, amount, discount money.Money) (*PaymentRecord, error) {
+	if s.wallets == nil {
+		return nil, ErrUnknownGateway
+	}
+	if err := checkDiscount(amount, discount); err != nil {
+		return nil, err
+	}
+	p, err := s.payments.Get(ctx, orderID)
+	if errors.Is(err, ErrPaymentNotFound) {
+		p = &Payment{
+			OrderID:    orderID,
+			Gateway:    WalletGateway,
+			ChargeID:   orderID,
+			CustomerID: userID,
+			Amount:     amount.Sub(discount),
+			Discount:   discount,
+			Status:     PaymentPending,
+		}
+		var created bool
+		if created, err = s.payments.Create(ctx, p); err == nil && !created {
+			p, err = s.payments.Get(ctx, orderID) // A concurrent request got there first
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.Gateway != WalletGateway {
+		return nil, ErrPaidElsewhere
+	}
+
+	if p.Status == PaymentPending {
+		limit, err := s.wallets.SpendLimit(ctx, p.CustomerID)
+		if err != nil {
+			return nil, err
+		}
+		// The wallet is debited first; locking the escrow after is safe to retry
+		if err := s.journal.CollectFromWallet(ctx, ledger.Collection{
+			OrderID: p.OrderID,
+			BuyerID: p.CustomerID,
+			Paid:    p.Amount.Units(),
+			Voucher: p.Discount.Units(),
+		}, limit); err != nil {
+			return nil, err
+		}
+		err = s.ledger.SecurePayment(ctx, p.OrderID, p.Amount.Add(p.Discount))
+		if err != nil && !errors.Is(err, escrowDomain.ErrInvalidTransition) {
+			return nil, err
+		}
+		if _, err := s.payments.UpdateStatus(ctx, p.OrderID, PaymentCaptured); err != nil {
+			return nil, err
+		}
+	}
+	return s.Payment(ctx, orderID)
+}
+
+// ReleaseFunds closes the escrow after verified delivery and owes the Provider
+// its share; the money leaves in the provider's next payout batch.
+func (s *EscrowService) ReleaseFunds(ctx context.Context, paymentID string, providerID string) error {
+	if err := s.ledger.ReleaseFunds(ctx, paymentID); err != nil {
+		return err
+	}
+	state, err := s.ledger.State(ctx, paymentID)
+	if err != nil {
+		return err
+	}
+	gross := state.Collected.Sub(state.Refunded).Units()
+	split := ledger.SplitRelease(gross, providerID, PlatformCommissionBps)
+	err = s.journal.ReleaseEscrow(ctx, paymentID, split)
+	if errors.Is(err, ledger.ErrEntryNotFound) {
+		return s.book(paymentID, err) // Nothing booked, so nothing to pay out
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.payouts.Accrue(ctx, ProviderRelease{
+		OrderID:    paymentID,
+		ProviderID: providerID,
+		Gross:      gross,
+		Fee:        split.Platform,
+		Net:        split.Provider,
+		ReleasedAt: state.LastUpdated,
+	})
+}
+
 // RefundFunds returns money to the user in case of disputes or stale claims.
+// Wallet-paid orders go back to the wallet; card payments go back through the
+// gateway, or straight to the wallet when the buyer chose instant refunds.
 func (s *EscrowService) RefundFunds(ctx context.Context, paymentID string, userID string) error {
-	fmt.Printf("⏪ [FINTECH] Dispute Approved! Refunding funds to User %s (Payment ID: %s)\n", userID, paymentID)
+	reason, err := json.Marshal(map[string]string{"refund_to": userID})
+	if err != nil {
+		return err
+	}
+	if err := s.ledger.Cancel(ctx, paymentID, string(reason)); err != nil {
+		return err
+	}
+
+	p, err := s.payments.Get(ctx, paymentID)
+	if errors.Is(err, ErrPaymentNotFound) {
+		return s.book(paymentID, s.journal.RefundEscrow(ctx, paymentID, string(reason)))
+	}
+	if err != nil {
+		return err
+	}
+
+	instant, err := s.instantRefund(ctx, p)
+	if err != nil {
+		return err
+	}
+	if instant {
+		if err := s.book(paymentID, s.journal.RefundEscrowToWallet(ctx, paymentID, p.CustomerID, string(reason))); err != nil {
+			return err
+		}
+		_, err = s.payments.UpdateStatus(ctx, paymentID, PaymentRefundedToWallet)
+		return err
+	}
+
+	if err := s.book(paymentID, s.journal.RefundEscrow(ctx, paymentID, string(reason))); err != nil {
+		return err
+	}
+	if p.Gateway == WalletGateway {
+		// Reversing the collection put the money back in the wallet
+		_, err = s.payments.UpdateStatus(ctx, paymentID, PaymentRefunded)
+		return err
+	}
+	if s.gateway == nil || p.Status != PaymentCaptured {
+		return nil // Nothing taken, or already refunded
+	}
+
+	refund, err := s.gateway.Refund(ctx, p.ChargeID, p.Amount, "escrow_cancelled")
+	if err != nil {
+		return fmt.Errorf("refund %s: %w", paymentID, err)
+	}
+	_, err = s.payments.UpdateStatus(ctx, paymentID, refund.Status)
+	return err
+}
+
+// instantRefund reports whether a captured card payment is refunded to the
+// buyer's wallet rather than through the gateway
+func (s *EscrowService) instantRefund(ctx context.Context, p *Payment) (bool, error) {
+	if s.wallets == nil || p.Gateway == WalletGateway || p.Status != PaymentCaptured {
+		return false, nil
+	}
+	return s.wallets.instantRefunds(ctx, p.CustomerID)
+}
+
+// FreezeFunds holds the escrow while a dispute about the order is open
+func (s *EscrowService) FreezeFunds(ctx context.Context, paymentID, reason string) error {
+	return s.ledger.RaiseDispute(ctx, paymentID, reason)
+}
+
+// PartialRefund gives the buyer part of a disputed order back; ReleaseFunds
+// then pays the provider the rest
+func (s *EscrowService) PartialRefund(ctx context.Context, paymentID, userID string, amount money.Money) error {
+	reason, err := json.Marshal(map[string]interface{}{"refund_to": userID, "amount": amount})
+	if err != nil {
+		return err
+	}
+	if err := s.ledger.PartialRefund(ctx, paymentID, amount, string(reason)); err != nil {
+		return err
+	}
+	if err := s.book(paymentID, s.journal.PartialRefund(ctx, paymentID, amount.Units(), string(reason))); err != nil {
+		return err
+	}
+
+	p, err := s.payments.Get(ctx, paymentID)
+	if errors.Is(err, ErrPaymentNotFound) || s.gateway == nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if p.Status != PaymentCaptured || p.Gateway == WalletGateway {
+		return nil // A wallet payment got its share back when the refund was booked
+	}
+	// The charge stays captured: only the full refund moves the payment to refunded
+	if _, err := s.gateway.Refund(ctx, p.ChargeID, amount, "dispute_partial_refund"); err != nil {
+		return fmt.Errorf("partial refund %s: %w", paymentID, err)
+	}
 	return nil
 }
+
+// OrderPrice is what the buyer owes for the order before any voucher
+func (s *EscrowService) OrderPrice(ctx context.Context, orderID string) (money.Money, error) {
+	return s.payments.OrderPrice(ctx, orderID)
+}
+
+// Payment reads the escrow back as a payment
+func (s *EscrowService) Payment(ctx context.Context, paymentID string) (*PaymentRecord, error) {
+	state, err := s.ledger.State(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	record := &PaymentRecord{ID: paymentID, Amount: state.Collected, Status: "held", Timestamp: state.LastUpdated}
+
+	p, err := s.payments.Get(ctx, paymentID)
+	switch {
+	case err == nil:
+		record.Gateway, record.ChargeID = p.Gateway, p.ChargeID
+		if state.Version == 0 {
+			record.Amount, record.Timestamp = p.Amount, p.UpdatedAt
+			record.Status = string(PaymentPending)
+			if p.Status == PaymentFailed {
+				record.Status = string(PaymentFailed)
+			}
+			return record, nil
+		}
+	case !errors.Is(err, ErrPaymentNotFound):
+		return nil, err
+	case state.Version == 0:
+		return nil, escrowDomain.ErrEscrowNotFound
+	}
+
+	switch state.Status {
+	case escrowDomain.StatusClosed:
+		record.Status = "released"
+	case escrowDomain.StatusCancelled:
+		record.Status = "refunded"
+	}
+	return record, nil
+}
+
+// HandleWebhook applies a gateway callback to the payment and its escrow.
+// Replays of an event already processed are acknowledged and ignored.
+func (s *EscrowService) HandleWebhook(ctx context.Context, gateway string, body []byte, signature string) (*GatewayEvent, error) {
+	if s.gateway == nil || s.gateway.Name() != gateway {
+		return nil, ErrUnknownGateway
+	}
+	e, err := s.gateway.ParseWebhook(body, signature)
+	if err != nil {
+		return nil, err
+	}
+	seen, err := s.payments.WebhookProcessed(ctx, gateway, e.EventID)
+	if err != nil {
+		return nil, err
+	}
+	if seen {
+		return e, nil
+	}
+
+	if err := s.apply(ctx, e); err != nil {
+		return nil, err
+	}
+	return e, s.payments.RecordWebhook(ctx, *e)
+}
+
+func (s *EscrowService) apply(ctx context.Context, e *GatewayEvent) error {
+	if e.Object == ObjectPayout {
+		// Payouts are referenced by batch, not by order
+		return s.payouts.ApplyPayoutStatus(ctx, e.OrderID, e.ObjectID, e.Status)
+	}
+	if id, ok := topUpID(e.OrderID); ok && s.wallets != nil {
+		if e.Object != ObjectCharge {
+			s.logger.Warn("Ignoring a refund of a wallet top-up", zap.String("top_up_id", id), zap.String("status", string(e.Status)))
+			return nil
+		}
+		return s.wallets.ApplyTopUpStatus(ctx, id, e.ObjectID, e.Status)
+	}
+
+	p, err := s.payments.Get(ctx, e.OrderID)
+	if err != nil {
+		return err
+	}
+	if e.Object == ObjectRefund && e.Amount.IsPositive() && e.Amount.LessThan(p.Amount) {
+		// A dispute's partial refund, already booked when we asked for it
+		s.logger.Info("Gateway confirmed a partial refund",
+			zap.String("order_id", p.OrderID), zap.Int64("amount", e.Amount.Units()))
+		return nil
+	}
+
+	moved, err := s.payments.UpdateStatus(ctx, p.OrderID, e.Status)
+	if err != nil || !moved {
+		return err // Stale or repeated status
+	}
+
+	switch e.Status {
+	case PaymentAuthorized:
+		// We always ask for capture; an authorise-only callback means the gateway wants a separate capture call
+		charge, err := s.gateway.Capture(ctx, p.ChargeID, p.Amount)
+		if err != nil {
+			return err
+		}
+		if charge.Status == PaymentCaptured {
+			if _, err := s.payments.UpdateStatus(ctx, p.OrderID, PaymentCaptured); err != nil {
+				return err
+			}
+			return s.collect(ctx, p)
+		}
+	case PaymentCaptured:
+		if !e.Amount.IsZero() && !e.Amount.Equal(p.Amount) {
+			s.logger.Warn("Gateway captured a different amount than charged",
+				zap.String("order_id", p.OrderID),
+				zap.Int64("charged", p.Amount.Units()),
+				zap.Int64("captured", e.Amount.Units()))
+		}
+		return s.collect(ctx, p)
+	case PaymentRefunded:
+		const reason = `{"refunded_by":"gateway"}`
+		err := s.ledger.Cancel(ctx, p.OrderID, reason)
+		if errors.Is(err, escrowDomain.ErrInvalidTransition) {
+			// Refunded at the gateway after we paid the provider out: reconciliation has to pick it up
+			s.logger.Error("Gateway refund on an escrow that can no longer be cancelled",
+				zap.String("order_id", p.OrderID), zap.Error(err))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return s.book(p.OrderID, s.journal.RefundEscrow(ctx, p.OrderID, reason))
+	}
+	return nil
+}
+
+// collect locks captured money (plus any voucher) in escrow and books it;
+// already locked is fine
+func (s *EscrowService) collect(ctx context.Context, p *Payment) error {
+	err := s.ledger.SecurePayment(ctx, p.OrderID, p.Amount.Add(p.Discount))
+	if err != nil && !errors.Is(err, escrowDomain.ErrInvalidTransition) {
+		return err
+	}
+	return s.journal.CollectPayment(ctx, ledger.Collection{
+		OrderID: p.OrderID,
+		Gateway: p.Gateway,
+		BuyerID: p.CustomerID,
+		Paid:    p.Amount.Units(),
+		Voucher: p.Discount.Units(),
+	})
+}
+
+// book tolerates escrows whose collection never reached the journal (settled
+// outside a gateway); reconciliation reports those
+func (s *EscrowService) book(orderID string, err error) error {
+	if errors.Is(err, ledger.ErrEntryNotFound) {
+		s.logger.Warn("Escrow has no booked collection, journal entry skipped", zap.String("order_id", orderID))
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,338 @@
+package fintech
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	escrowDomain "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
+	escrowRepo "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/repository"
+	escrowService "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/service"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/ledger"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+type memoryPayments struct {
+	mu       sync.Mutex
+	payments map[string]Payment
+	webhooks map[string]GatewayEvent
+}
+
+func newMemoryPayments() *memoryPayments {
+	return &memoryPayments{payments: make(map[string]Payment), webhooks: make(map[string]GatewayEvent)}
+}
+
+func (m *memoryPayments) Create(_ context.Context, p *Payment) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.payments[p.OrderID]; ok {
+		return false, nil
+	}
+	p.CreatedAt, p.UpdatedAt = time.Now(), time.Now()
+	m.payments[p.OrderID] = *p
+	return true, nil
+}
+
+func (m *memoryPayments) Get(_ context.Context, orderID string) (*Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.payments[orderID]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	return &p, nil
+}
+
+func (m *memoryPayments) UpdateStatus(_ context.Context, orderID string, status PaymentStatus) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.payments[orderID]
+	if !ok {
+		return false, ErrPaymentNotFound
+	}
+	if !p.Status.Advances(status) {
+		return false, nil
+	}
+	p.Status = status
+	m.payments[orderID] = p
+	return true, nil
+}
+
+func (m *memoryPayments) OrderPrice(_ context.Context, orderID string) (money.Money, error) {
+	return money.Money{}, ErrOrderNotFound
+}
+
+func (m *memoryPayments) WebhookProcessed(_ context.Context, gateway, eventID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.webhooks[gateway+"/"+eventID]
+	return ok, nil
+}
+
+func (m *memoryPayments) RecordWebhook(_ context.Context, e GatewayEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.webhooks[e.Gateway+"/"+e.EventID] = e
+	return nil
+}
+
+// scriptedGateway answers charges with a fixed status and counts every call;
+// webhooks are GatewayEvent JSON signed with "ok"
+type scriptedGateway struct {
+	chargeStatus PaymentStatus
+	authorized   int
+	captured     int
+	refunded     int
+	payouts      int
+}
+
+func (g *scriptedGateway) Name() string { return "fake" }
+
+func (g *scriptedGateway) Authorize(_ context.Context, req ChargeRequest) (*Charge, error) {
+	g.authorized++
+	return &Charge{Gateway: "fake", ID: "CH-" + req.OrderID, OrderID: req.OrderID, Amount: req.Amount, Status: g.chargeStatus}, nil
+}
+
+func (g *scriptedGateway) Capture(_ context.Context, chargeID string, amount money.Money) (*Charge, error) {
+	g.captured++
+	return &Charge{Gateway: "fake", ID: chargeID, Amount: amount, Status: PaymentCaptured}, nil
+}
+
+func (g *scriptedGateway) Refund(_ context.Context, chargeID string, amount money.Money, _ string) (*Refund, error) {
+	g.refunded++
+	return &Refund{Gateway: "fake", ID: "RF-" + chargeID, ChargeID: chargeID, Amount: amount, Status: PaymentRefunded}, nil
+}
+
+func (g *scriptedGateway) Payout(_ context.Context, req PayoutRequest) (*Payout, error) {
+	g.payouts++
+	return &Payout{Gateway: "fake", ID: "PO-" + req.ReferenceID, ReferenceID: req.ReferenceID, Amount: req.Amount, Status: PayoutPending}, nil
+}
+
+func (g *scriptedGateway) ParseWebhook(body []byte, signature string) (*GatewayEvent, error) {
+	if signature != "ok" {
+		return nil, ErrInvalidWebhookSignature
+	}
+	var e GatewayEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, err
+	}
+	e.Gateway = "fake"
+	return &e, nil
+}
+
+func newTestEscrow(status PaymentStatus) (*EscrowService, *escrowService.EscrowService, *scriptedGateway, *memoryPayments) {
+	escrowLedger := escrowService.NewEscrowService(escrowRepo.NewMemoryRepository(), zap.NewNop())
+	journal := ledger.NewService(ledger.NewMemoryRepository(), zap.NewNop())
+	gw := &scriptedGateway{chargeStatus: status}
+	payments := newMemoryPayments()
+	payouts := NewPayoutService(newMemoryPayouts(), journal, gw, testSchedule(), zap.NewNop())
+	return NewEscrowService(escrowLedger, journal, payments, payouts, nil, gw, zap.NewNop()), escrowLedger, gw, payments
+}
+
+func webhook(t *testing.T, s *EscrowService, e GatewayEvent) error {
+	t.Helper()
+	body, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.HandleWebhook(context.Background(), "fake", body, "ok")
+	return err
+}
+
+func TestEscrow_SynchronousCaptureLocksOnce(t *testing.T) {
+	ctx := context.Background()
+	svc, ledger, gw, _ := newTestEscrow(PaymentCaptured)
+
+	record, err := svc.LockFunds(ctx, "o1", "u1", money.Rupiah(25000), money.Rupiah(0))
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if record.Status != "held" || record.Amount.Units() != 25000 || record.ChargeID != "CH-o1" {
+		t.Fatalf("unexpected record %+v", record)
+	}
+
+	// A retried request and the gateway's own callback must not charge or lock twice
+	if _, err := svc.LockFunds(ctx, "o1", "u1", money.Rupiah(25000), money.Rupiah(0)); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if err := webhook(t, svc, GatewayEvent{EventID: "e1", Object: ObjectCharge, OrderID: "o1", Status: PaymentCaptured, Amount: money.Rupiah(25000)}); err != nil {
+		t.Fatalf("webhook: %v", err)
+	}
+	if gw.authorized != 1 {
+		t.Fatalf("expected one charge, got %d", gw.authorized)
+	}
+	state, _ := ledger.State(ctx, "o1")
+	if state.Version != 1 || state.Status != escrowDomain.StatusLocked {
+		t.Fatalf("expected a single PaymentCollected, got %+v", state)
+	}
+}
+
+func TestEscrow_DelayedCallbackLocksFundsIdempotently(t *testing.T) {
+	ctx := context.Background()
+	svc, ledger, _, payments := newTestEscrow(PaymentPending)
+
+	record, err := svc.LockFunds(ctx, "o1", "u1", money.Rupiah(15000), money.Rupiah(0))
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if record.Status != string(PaymentPending) {
+		t.Fatalf("expected pending before the callback, got %+v", record)
+	}
+
+	captured := GatewayEvent{EventID: "e1", Object: ObjectCharge, OrderID: "o1", Status: PaymentCaptured, Amount: money.Rupiah(15000)}
+	for i := 0; i < 2; i++ { // The gateway delivers at least once
+		if err := webhook(t, svc, captured); err != nil {
+			t.Fatalf("webhook %d: %v", i, err)
+		}
+	}
+	// A late "pending" callback must not move the payment back
+	if err := webhook(t, svc, GatewayEvent{EventID: "e0", Object: ObjectCharge, OrderID: "o1", Status: PaymentPending}); err != nil {
+		t.Fatalf("stale webhook: %v", err)
+	}
+
+	state, _ := ledger.State(ctx, "o1")
+	if state.Version != 1 || state.Collected.Units() != 15000 {
+		t.Fatalf("expected funds locked once, got %+v", state)
+	}
+	if p, _ := payments.Get(ctx, "o1"); p.Status != PaymentCaptured {
+		t.Fatalf("expected captured, got %s", p.Status)
+	}
+
+	if _, err := svc.HandleWebhook(ctx, "fake", []byte(`{}`), "forged"); !errors.Is(err, ErrInvalidWebhookSignature) {
+		t.Fatalf("expected ErrInvalidWebhookSignature, got %v", err)
+	}
+	if _, err := svc.HandleWebhook(ctx, "other", []byte(`{}`), "ok"); !errors.Is(err, ErrUnknownGateway) {
+		t.Fatalf("expected ErrUnknownGateway, got %v", err)
+	}
+}
+
+func TestEscrow_DeclinedChargeNeverReachesLedger(t *testing.T) {
+	ctx := context.Background()
+	svc, ledger, _, _ := newTestEscrow(PaymentFailed)
+
+	if _, err := svc.LockFunds(ctx, "o1", "u1", money.Rupiah(10000), money.Rupiah(0)); !errors.Is(err, ErrPaymentDeclined) {
+		t.Fatalf("expected ErrPaymentDeclined, got %v", err)
+	}
+	if err := webhook(t, svc, GatewayEvent{EventID: "e1", Object: ObjectCharge, OrderID: "o1", Status: PaymentCaptured}); err != nil {
+		t.Fatalf("webhook: %v", err)
+	}
+	state, _ := ledger.State(ctx, "o1")
+	if state.Version != 0 {
+		t.Fatalf("a declined charge must not lock funds, got %+v", state)
+	}
+	record, err := svc.Payment(ctx, "o1")
+	if err != nil || record.Status != string(PaymentFailed) {
+		t.Fatalf("expected a failed payment, got %+v, %v", record, err)
+	}
+}
+
+func TestEscrow_RefundAndPayoutMoveMoneyOnce(t *testing.T) {
+	ctx := context.Background()
+	svc, escrowLedger, gw, _ := newTestEscrow(PaymentCaptured)
+
+	for _, id := range []string{"refund", "release"} {
+		if _, err := svc.LockFunds(ctx, id, "u1", money.Rupiah(20000), money.Rupiah(0)); err != nil {
+			t.Fatalf("lock %s: %v", id, err)
+		}
+	}
+
+	if err := svc.RefundFunds(ctx, "refund", "u1"); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if err := svc.RefundFunds(ctx, "refund", "u1"); err != nil {
+		t.Fatalf("repeat refund: %v", err)
+	}
+	// The gateway confirms the refund we asked for: nothing more to do
+	if err := webhook(t, svc, GatewayEvent{EventID: "e1", Object: ObjectRefund, OrderID: "refund", Status: PaymentRefunded}); err != nil {
+		t.Fatalf("refund webhook: %v", err)
+	}
+	if gw.refunded != 1 {
+		t.Fatalf("expected one gateway refund, got %d", gw.refunded)
+	}
+	if record, _ := svc.Payment(ctx, "refund"); record.Status != "refunded" {
+		t.Fatalf("expected refunded, got %+v", record)
+	}
+
+	for _, step := range []func(context.Context, string) error{escrowLedger.CourierAssigned, escrowLedger.FoodPickedUp, escrowLedger.FoodDelivered} {
+		if err := step(ctx, "release"); err != nil {
+			t.Fatalf("advance: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := svc.ReleaseFunds(ctx, "release", "prov-1"); err != nil {
+			t.Fatalf("release %d: %v", i, err)
+		}
+	}
+	if gw.payouts != 0 {
+		t.Fatalf("releases are paid in batches, got %d payouts", gw.payouts)
+	}
+	batches, err := svc.payouts.RunPayouts(ctx, time.Now().Add(48*time.Hour))
+	if err != nil || len(batches) != 1 || gw.payouts != 1 {
+		t.Fatalf("expected one batch paid out once, got %+v, %d payouts, %v", batches, gw.payouts, err)
+	}
+	batch := batches[0]
+	if batch.Orders != 1 || batch.Net != 18000 || batch.Amount != 18000-testSchedule().TransferFee {
+		t.Fatalf("unexpected batch %+v", batch)
+	}
+	for i := 0; i < 2; i++ { // Redelivered with a new event ID: booked once
+		e := GatewayEvent{EventID: fmt.Sprintf("e2-%d", i), Object: ObjectPayout, ObjectID: batch.PayoutID, OrderID: batch.ID, Status: PayoutPaid}
+		if err := webhook(t, svc, e); err != nil {
+			t.Fatalf("payout webhook: %v", err)
+		}
+	}
+	if b, _ := svc.payouts.Batch(ctx, batch.ID); b.Status != PayoutPaid {
+		t.Fatalf("expected paid out, got %+v", b)
+	}
+	if owed, _ := svc.journal.Balance(ctx, ledger.ProviderPayable("prov-1")); owed.Net != 0 {
+		t.Fatalf("expected the provider payable settled, got %d", owed.Net)
+	}
+
+	// A refund at the gateway after payout cannot be undone in the ledger; it is acknowledged for reconciliation
+	if err := webhook(t, svc, GatewayEvent{EventID: "e3", Object: ObjectRefund, OrderID: "release", Status: PaymentRefunded}); err != nil {
+		t.Fatalf("late refund webhook: %v", err)
+	}
+	if state, _ := escrowLedger.State(ctx, "release"); state.Status != escrowDomain.StatusClosed {
+		t.Fatalf("expected the escrow to stay closed, got %s", state.Status)
+	}
+}
+
+func TestEscrow_VoucherIsBookedFromPromoBudget(t *testing.T) {
+	ctx := context.Background()
+	escrowLedger := escrowService.NewEscrowService(escrowRepo.NewMemoryRepository(), zap.NewNop())
+	journal := ledger.NewService(ledger.NewMemoryRepository(), zap.NewNop())
+	gw := &scriptedGateway{chargeStatus: PaymentCaptured}
+	payouts := NewPayoutService(newMemoryPayouts(), journal, gw, testSchedule(), zap.NewNop())
+	svc := NewEscrowService(escrowLedger, journal, newMemoryPayments(), payouts, nil, gw, zap.NewNop())
+
+	record, err := svc.LockFunds(ctx, "o1", "u1", money.Rupiah(60000), money.Rupiah(15000))
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if record.Amount.Units() != 60000 {
+		t.Fatalf("escrow should hold the full order value, got %+v", record)
+	}
+	for _, step := range []func(context.Context, string) error{escrowLedger.CourierAssigned, escrowLedger.FoodPickedUp, escrowLedger.FoodDelivered} {
+		if err := step(ctx, "o1"); err != nil {
+			t.Fatalf("advance: %v", err)
+		}
+	}
+	if err := svc.ReleaseFunds(ctx, "o1", "prov-1"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	owed, _ := journal.Balance(ctx, ledger.ProviderPayable("prov-1"))
+	promo, _ := journal.Balance(ctx, ledger.PromoBudget)
+	revenue, _ := journal.Balance(ctx, ledger.PlatformRevenue)
+	if owed.Net != 54000 || promo.Net != 15000 || revenue.Net != 6000 {
+		t.Fatalf("unexpected books: provider %d, promo %d, revenue %d", owed.Net, promo.Net, revenue.Net)
+	}
+	if _, err := journal.CheckInvariant(ctx); err != nil {
+		t.Fatalf("invariant: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package fintech
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+var (
+	ErrUnknownGateway          = errors.New("unknown payment gateway")
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrUnmappedGatewayStatus   = errors.New("unmapped gateway status")
+	ErrPaymentDeclined         = errors.New("payment declined")
+	ErrPaymentNotFound         = errors.New("payment not found")
+	ErrOrderNotFound           = errors.New("order not found")
+	ErrOrderNotForSale         = errors.New("order has no price to pay")
+)
+
+// PaymentStatus is a gateway status normalised across Midtrans, Xendit, Stripe...
+type PaymentStatus string
+
+const (
+	PaymentPending          PaymentStatus = "pending"    // Buyer still has to pay (VA, QRIS, 3DS)
+	PaymentAuthorized       PaymentStatus = "authorized" // Held on the instrument, not taken yet
+	PaymentCaptured         PaymentStatus = "captured"   // Money is with us
+	PaymentFailed           PaymentStatus = "failed"     // Declined or expired
+	PaymentRefunded         PaymentStatus = "refunded"
+	PaymentRefundedToWallet PaymentStatus = "refunded_to_wallet" // Refunded as wallet credit; the gateway keeps the sale
+	PayoutPending           PaymentStatus = "payout_pending"
+	PayoutPaid              PaymentStatus = "paid_out"
+	PayoutFailed            PaymentStatus = "payout_failed"
+)
+
+// paymentProgress orders charge and payout statuses so late or repeated
+// callbacks never move a payment back
+var paymentProgress = map[PaymentStatus]int{
+	PaymentPending:          0,
+	PaymentAuthorized:       1,
+	PaymentCaptured:         2,
+	PaymentFailed:           3,
+	PaymentRefunded:         3,
+	PaymentRefundedToWallet: 3,
+	PayoutPending:           0,
+	PayoutPaid:              1,
+	PayoutFailed:            1,
+}
+
+// Advances reports whether a charge or payout may move from s to next
+func (s PaymentStatus) Advances(next PaymentStatus) bool {
+	if s == PaymentFailed || s == PaymentRefunded || s == PaymentRefundedToWallet || s == PayoutPaid || s == PayoutFailed {
+		return false
+	}
+	if next == PaymentFailed {
+		return s != PaymentCaptured // A captured charge is refunded, not failed
+	}
+	return paymentProgress[next] > paymentProgress[s]
+}
+
+// GatewayObject is what a webhook is about
+type GatewayObject string
+
+const (
+	ObjectCharge GatewayObject = "charge"
+	ObjectRefund GatewayObject = "refund"
+	ObjectPayout GatewayObject = "payout"
+)
+
+type ChargeRequest struct {
+	OrderID    string // Our reference; the escrow stream
+	CustomerID string
+	Amount     money.Money
+	Capture    bool // Take the money now rather than only authorise it
+}
+
+type Charge struct {
+	Gateway string        `json:"gateway"`
+	ID      string        `json:"id"`
+	OrderID string        `json:"order_id"`
+	Amount  money.Money   `json:"amount"`
+	Status  PaymentStatus `json:"status"`
+}
+
+type Refund struct {
+	Gateway  string        `json:"gateway"`
+	ID       string        `json:"id"`
+	ChargeID string        `json:"charge_id"`
+	Amount   money.Money   `json:"amount"`
+	Status   PaymentStatus `json:"status"`
+}
+
+type PayoutRequest struct {
+	ReferenceID   string // Payout batch; also the idempotency key
+	BeneficiaryID string // Provider receiving the money
+	Amount        money.Money
+}
+
+type Payout struct {
+	Gateway     string        `json:"gateway"`
+	ID          string        `json:"id"`
+	ReferenceID string        `json:"reference_id"`
+	Amount      money.Money   `json:"amount"`
+	Status      PaymentStatus `json:"status"`
+}
+
+// GatewayEvent is a verified, normalised webhook
+type GatewayEvent struct {
+	Gateway       string        `json:"gateway"`
+	EventID       string        `json:"event_id"` // Gateway's ID, for deduplication
+	Object        GatewayObject `json:"object"`
+	ObjectID      string        `json:"object_id"`
+	OrderID       string        `json:"order_id"`
+	Status        PaymentStatus `json:"status"`
+	GatewayStatus string        `json:"gateway_status"`
+	Amount        money.Money   `json:"amount"`
+	At            time.Time     `json:"at"`
+}
+
+// PaymentGateway is one payment processor account
+type PaymentGateway interface {
+	Name() string
+	// Authorize opens a charge; with req.Capture the money is taken straight away.
+	// Retrying with the same order ID returns the same charge.
+	Authorize(ctx context.Context, req ChargeRequest) (*Charge, error)
+	Capture(ctx context.Context, chargeID string, amount money.Money) (*Charge, error)
+	Refund(ctx context.Context, chargeID string, amount money.Money, reason string) (*Refund, error)
+	Payout(ctx context.Context, req PayoutRequest) (*Payout, error)
+	// ParseWebhook verifies the signature before anything in the body is trusted
+	ParseWebhook(body []byte, signature string) (*GatewayEvent, error)
+}
@@ -0,0 +1,399 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+// Scenario scripts how the fake gateway treats a charge or payout
+type Scenario string
+
+const (
+	// ScenarioSuccess settles at once and sends the matching callback
+	ScenarioSuccess Scenario = "success"
+	// ScenarioDecline declines the charge (or fails the payout) and says so in the callback
+	ScenarioDecline Scenario = "decline"
+	// ScenarioDelayed answers PENDING, like a VA or QRIS payment, and only the
+	// callback (after CallbackDelay, or on flush) reports the money settled
+	ScenarioDelayed Scenario = "delayed"
+)
+
+// FakeConfig tunes the fake gateway
+type FakeConfig struct {
+	APIKey        string
+	WebhookSecret string
+	Scenario      Scenario      // For orders without a script; defaults to ScenarioSuccess
+	CallbackDelay time.Duration // How long ScenarioDelayed waits before calling back
+	// ManualCallbacks queues every callback until Flush (or POST /v1/callbacks/flush),
+	// so tests decide exactly when, and how often, the webhook arrives
+	ManualCallbacks bool
+	Now             func() time.Time // Defaults to time.Now; tests pin it
+}
+
+// FakeServer is a deterministic in-memory payment gateway speaking the
+// HTTPGateway wire format. IDs are sequential, idempotency keys are honoured
+// and every outcome is scripted, so payment flows can be exercised offline
+// (go run ./cmd/fakegateway, or httptest in tests).
+type FakeServer struct {
+	cfg     FakeConfig
+	router  chi.Router
+	client  *http.Client
+	mu      sync.Mutex
+	seq     int
+	scripts map[string]Scenario
+	charges map[string]*fakeCharge
+	replies map[string]fakeReply // By idempotency key
+	queue   []fakeCallback
+}
+
+type fakeCharge struct {
+	req    chargeRequest
+	status string
+}
+
+type fakeReply struct {
+	status int
+	body   interface{}
+}
+
+type fakeCallback struct {
+	url     string
+	payload WebhookPayload
+}
+
+func NewFakeServer(cfg FakeConfig) *FakeServer {
+	if cfg.Scenario == "" {
+		cfg.Scenario = ScenarioSuccess
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	s := &FakeServer{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		scripts: make(map[string]Scenario),
+		charges: make(map[string]*fakeCharge),
+		replies: make(map[string]fakeReply),
+	}
+
+	r := chi.NewRouter()
+	r.Use(s.authenticate)
+	r.Post("/v1/charges", s.createCharge)
+	r.Get("/v1/charges/{id}", s.getCharge)
+	r.Post("/v1/charges/{id}/capture", s.capture)
+	r.Post("/v1/charges/{id}/refunds", s.refund)
+	r.Post("/v1/payouts", s.payout)
+	// Test control: script an order's outcome and deliver queued callbacks
+	r.Post("/v1/scripts", s.script)
+	r.Post("/v1/callbacks/flush", s.flush)
+	s.router = r
+	return s
+}
+
+func (s *FakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// Script fixes the outcome for one order (charge order ID or payout reference)
+func (s *FakeServer) Script(orderID string, scenario Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[orderID] = scenario
+}
+
+// Pending is the number of callbacks waiting to be delivered
+func (s *FakeServer) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// Flush delivers the queued callbacks in order. Ones the receiver rejects stay
+// queued for the next flush, as a real gateway keeps retrying.
+func (s *FakeServer) Flush() (int, error) {
+	s.mu.Lock()
+	queue := s.queue
+	s.queue = nil
+	s.mu.Unlock()
+
+	var failed []fakeCallback
+	var firstErr error
+	for _, cb := range queue {
+		if err := s.notify(cb); err != nil {
+			failed = append(failed, cb)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		s.mu.Lock()
+		s.queue = append(failed, s.queue...)
+		s.mu.Unlock()
+	}
+	return len(queue) - len(failed), firstErr
+}
+
+func (s *FakeServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.APIKey != "" && r.Header.Get("Authorization") != "Bearer "+s.cfg.APIKey {
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *FakeServer) createCharge(w http.ResponseWriter, r *http.Request) {
+	var req chargeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OrderID == "" || !req.Amount.IsPositive() {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	s.respond(w, r, func() (int, interface{}, time.Duration) {
+		scenario := s.scenarioLocked(req.OrderID)
+		status, settled := "CAPTURED", "CAPTURED"
+		if !req.Capture {
+			status, settled = "AUTHORIZED", "AUTHORIZED"
+		}
+		var delay time.Duration
+		switch scenario {
+		case ScenarioDecline:
+			status, settled = "DECLINED", "DECLINED"
+		case ScenarioDelayed:
+			status, delay = "PENDING", s.cfg.CallbackDelay
+		}
+
+		id := s.nextID("CH")
+		c := &fakeCharge{req: req, status: settled}
+		s.charges[id] = c
+		s.enqueueLocked(req.CallbackURL, "charge", id, req.OrderID, settled, req.Amount)
+		return http.StatusCreated, chargeResponse{ID: id, OrderID: req.OrderID, Amount: req.Amount, Status: status}, delay
+	})
+}
+
+func (s *FakeServer) getCharge(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	s.mu.Lock()
+	c, ok := s.charges[id]
+	var res chargeResponse
+	if ok {
+		res = chargeResponse{ID: id, OrderID: c.req.OrderID, Amount: c.req.Amount, Status: c.status}
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "charge not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *FakeServer) capture(w http.ResponseWriter, r *http.Request) {
+	var req captureRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	id := chi.URLParam(r, "id")
+
+	s.respond(w, r, func() (int, interface{}, time.Duration) {
+		c, ok := s.charges[id]
+		if !ok {
+			return http.StatusNotFound, "charge not found", 0
+		}
+		switch c.status {
+		case "CAPTURED":
+		case "AUTHORIZED":
+			c.status = "CAPTURED"
+			s.enqueueLocked(c.req.CallbackURL, "charge", id, c.req.OrderID, c.status, c.req.Amount)
+		default:
+			return http.StatusConflict, "charge is " + c.status, 0
+		}
+		return http.StatusOK, chargeResponse{ID: id, OrderID: c.req.OrderID, Amount: c.req.Amount, Status: c.status}, 0
+	})
+}
+
+func (s *FakeServer) refund(w http.ResponseWriter, r *http.Request) {
+	var req refundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	chargeID := chi.URLParam(r, "id")
+
+	s.respond(w, r, func() (int, interface{}, time.Duration) {
+		c, ok := s.charges[chargeID]
+		if !ok {
+			return http.StatusNotFound, "charge not found", 0
+		}
+		if c.status != "CAPTURED" {
+			return http.StatusConflict, "charge is " + c.status, 0
+		}
+		if !req.Amount.IsPositive() || req.Amount.GreaterThan(c.req.Amount) {
+			return http.StatusUnprocessableEntity, "refund exceeds the charge", 0
+		}
+
+		status, delay := "REFUNDED", time.Duration(0)
+		switch s.scenarioLocked(c.req.OrderID) {
+		case ScenarioDecline:
+			return http.StatusUnprocessableEntity, "refund declined", 0
+		case ScenarioDelayed:
+			status, delay = "PENDING", s.cfg.CallbackDelay
+		}
+
+		id := s.nextID("RF")
+		c.status = "REFUNDED"
+		s.enqueueLocked(c.req.CallbackURL, "refund", id, c.req.OrderID, "REFUNDED", req.Amount)
+		return http.StatusCreated, refundResponse{ID: id, ChargeID: chargeID, Amount: req.Amount, Status: status}, delay
+	})
+}
+
+func (s *FakeServer) payout(w http.ResponseWriter, r *http.Request) {
+	var req payoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ReferenceID == "" || !req.Amount.IsPositive() {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	s.respond(w, r, func() (int, interface{}, time.Duration) {
+		status, settled, delay := "COMPLETED", "COMPLETED", time.Duration(0)
+		switch s.scenarioLocked(req.ReferenceID) {
+		case ScenarioDecline:
+			status, settled = "FAILED", "FAILED"
+		case ScenarioDelayed:
+			status, delay = "PENDING", s.cfg.CallbackDelay
+		}
+
+		id := s.nextID("PO")
+		s.enqueueLocked(req.CallbackURL, "payout", id, req.ReferenceID, settled, req.Amount)
+		return http.StatusCreated, payoutResponse{ID: id, ReferenceID: req.ReferenceID, Amount: req.Amount, Status: status}, delay
+	})
+}
+
+func (s *FakeServer) script(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OrderID  string   `json:"order_id"`
+		Scenario Scenario `json:"scenario"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OrderID == "" {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	switch req.Scenario {
+	case ScenarioSuccess, ScenarioDecline, ScenarioDelayed:
+	default:
+		http.Error(w, "unknown scenario", http.StatusBadRequest)
+		return
+	}
+	s.Script(req.OrderID, req.Scenario)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *FakeServer) flush(w http.ResponseWriter, r *http.Request) {
+	delivered, err := s.Flush()
+	res := map[string]interface{}{"delivered": delivered, "pending": s.Pending()}
+	if err != nil {
+		res["error"] = err.Error()
+		writeJSON(w, http.StatusBadGateway, res)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// respond runs a mutating call once per idempotency key: a retry gets the
+// first answer back and triggers no second callback
+func (s *FakeServer) respond(w http.ResponseWriter, r *http.Request, run func() (int, interface{}, time.Duration)) {
+	key := r.Header.Get(IdempotencyHeader)
+
+	s.mu.Lock()
+	if reply, ok := s.replies[key]; ok && key != "" {
+		s.mu.Unlock()
+		writeReply(w, reply)
+		return
+	}
+	queued := len(s.queue)
+	status, body, delay := run()
+	reply := fakeReply{status: status, body: body}
+	if key != "" && status < 300 {
+		s.replies[key] = reply
+	}
+	fresh := len(s.queue) > queued
+	s.mu.Unlock()
+
+	writeReply(w, reply)
+	if fresh && !s.cfg.ManualCallbacks {
+		time.AfterFunc(delay, func() { _, _ = s.Flush() })
+	}
+}
+
+func (s *FakeServer) scenarioLocked(orderID string) Scenario {
+	if scenario, ok := s.scripts[orderID]; ok {
+		return scenario
+	}
+	return s.cfg.Scenario
+}
+
+func (s *FakeServer) enqueueLocked(callbackURL, object, id, orderID, status string, amount money.Money) {
+	if callbackURL == "" {
+		return
+	}
+	s.queue = append(s.queue, fakeCallback{url: callbackURL, payload: WebhookPayload{
+		EventID:    s.nextID("EVT"),
+		Type:       object,
+		ID:         id,
+		OrderID:    orderID,
+		Status:     status,
+		Amount:     amount,
+		OccurredAt: s.cfg.Now().UTC(),
+	}})
+}
+
+// notify posts a signed callback, as the real gateways do
+func (s *FakeServer) notify(cb fakeCallback) error {
+	body, err := json.Marshal(cb.payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, cb.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(s.cfg.WebhookSecret, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", cb.url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: status %d", cb.url, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *FakeServer) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s-%06d", prefix, s.seq)
+}
+
+func writeReply(w http.ResponseWriter, reply fakeReply) {
+	if msg, ok := reply.body.(string); ok {
+		http.Error(w, msg, reply.status)
+		return
+	}
+	writeJSON(w, reply.status, reply.body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,318 @@
+// Package gateway adapts payment processors to fintech.PaymentGateway.
+//
+// Midtrans, Xendit and Stripe all expose the same basic shape: create a
+// charge (optionally captured at once), capture, refund and disburse. Each
+// sends signed callbacks when anything changes, and each has its own status
+// vocabulary. HTTPGateway speaks that common shape, and every account is
+// configured with its base URL, credentials and status maps.
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/fintech"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the webhook body
+	SignatureHeader = "X-Signature"
+	// IdempotencyHeader makes retried charges and payouts safe at the gateway
+	IdempotencyHeader = "Idempotency-Key"
+)
+
+// DefaultStatusMap covers the charge and refund vocabulary most gateways share
+var DefaultStatusMap = map[string]fintech.PaymentStatus{
+	"PENDING":    fintech.PaymentPending,
+	"AUTHORIZED": fintech.PaymentAuthorized,
+	"CAPTURED":   fintech.PaymentCaptured,
+	"SETTLEMENT": fintech.PaymentCaptured,
+	"SUCCEEDED":  fintech.PaymentCaptured,
+	"DECLINED":   fintech.PaymentFailed,
+	"EXPIRED":    fintech.PaymentFailed,
+	"FAILED":     fintech.PaymentFailed,
+	"REFUNDED":   fintech.PaymentRefunded,
+}
+
+// DefaultPayoutStatusMap covers disbursements, which reuse words like PENDING
+// and FAILED with a different meaning
+var DefaultPayoutStatusMap = map[string]fintech.PaymentStatus{
+	"PENDING":   fintech.PayoutPending,
+	"COMPLETED": fintech.PayoutPaid,
+	"FAILED":    fintech.PayoutFailed,
+}
+
+// Config describes one gateway account
+type Config struct {
+	Name            string
+	BaseURL         string
+	APIKey          string
+	WebhookSecret   string
+	CallbackURL     string                           // Where the gateway posts status updates
+	StatusMap       map[string]fintech.PaymentStatus // Defaults to DefaultStatusMap
+	PayoutStatusMap map[string]fintech.PaymentStatus // Defaults to DefaultPayoutStatusMap
+	Timeout         time.Duration                    // Defaults to 10s
+}
+
+// HTTPGateway is a PaymentGateway backed by a processor's REST API
+type HTTPGateway struct {
+	cfg    Config
+	client *http.Client
+}
+
+func NewHTTPGateway(cfg Config) *HTTPGateway {
+	if cfg.StatusMap == nil {
+		cfg.StatusMap = DefaultStatusMap
+	}
+	if cfg.PayoutStatusMap == nil {
+		cfg.PayoutStatusMap = DefaultPayoutStatusMap
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &HTTPGateway{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// Wire format of the gateway API
+
+type chargeRequest struct {
+	OrderID     string      `json:"order_id"`
+	CustomerID  string      `json:"customer_id"`
+	Amount      money.Money `json:"amount"`
+	Capture     bool        `json:"capture"`
+	CallbackURL string      `json:"callback_url,omitempty"`
+}
+
+type chargeResponse struct {
+	ID      string      `json:"id"`
+	OrderID string      `json:"order_id"`
+	Amount  money.Money `json:"amount"`
+	Status  string      `json:"status"`
+}
+
+type captureRequest struct {
+	Amount money.Money `json:"amount"`
+}
+
+type refundRequest struct {
+	Amount money.Money `json:"amount"`
+	Reason string      `json:"reason"`
+}
+
+type refundResponse struct {
+	ID       string      `json:"id"`
+	ChargeID string      `json:"charge_id"`
+	Amount   money.Money `json:"amount"`
+	Status   string      `json:"status"`
+}
+
+type payoutRequest struct {
+	ReferenceID   string      `json:"reference_id"`
+	BeneficiaryID string      `json:"beneficiary_id"`
+	Amount        money.Money `json:"amount"`
+	CallbackURL   string      `json:"callback_url,omitempty"`
+}
+
+type payoutResponse struct {
+	ID          string      `json:"id"`
+	ReferenceID string      `json:"reference_id"`
+	Amount      money.Money `json:"amount"`
+	Status      string      `json:"status"`
+}
+
+// WebhookPayload is the body of every gateway callback
+type WebhookPayload struct {
+	EventID    string      `json:"event_id"`
+	Type       string      `json:"type"` // charge, refund or payout
+	ID         string      `json:"id"`   // The charge, refund or payout
+	OrderID    string      `json:"order_id"`
+	Status     string      `json:"status"`
+	Amount     money.Money `json:"amount"`
+	OccurredAt time.Time   `json:"occurred_at"`
+}
+
+func (g *HTTPGateway) Name() string { return g.cfg.Name }
+
+func (g *HTTPGateway) Authorize(ctx context.Context, req fintech.ChargeRequest) (*fintech.Charge, error) {
+	var res chargeResponse
+	body := chargeRequest{
+		OrderID:     req.OrderID,
+		CustomerID:  req.CustomerID,
+		Amount:      req.Amount,
+		Capture:     req.Capture,
+		CallbackURL: g.cfg.CallbackURL,
+	}
+	if err := g.do(ctx, http.MethodPost, "/v1/charges", "charge-"+req.OrderID, body, &res); err != nil {
+		return nil, err
+	}
+	return g.charge(res)
+}
+
+func (g *HTTPGateway) Capture(ctx context.Context, chargeID string, amount money.Money) (*fintech.Charge, error) {
+	var res chargeResponse
+	path := "/v1/charges/" + url.PathEscape(chargeID) + "/capture"
+	if err := g.do(ctx, http.MethodPost, path, "capture-"+chargeID, captureRequest{Amount: amount}, &res); err != nil {
+		return nil, err
+	}
+	return g.charge(res)
+}
+
+func (g *HTTPGateway) Refund(ctx context.Context, chargeID string, amount money.Money, reason string) (*fintech.Refund, error) {
+	var res refundResponse
+	path := "/v1/charges/" + url.PathEscape(chargeID) + "/refunds"
+	if err := g.do(ctx, http.MethodPost, path, "refund-"+chargeID, refundRequest{Amount: amount, Reason: reason}, &res); err != nil {
+		return nil, err
+	}
+	status, err := g.status(g.cfg.StatusMap, res.Status)
+	if err != nil {
+		return nil, err
+	}
+	return &fintech.Refund{Gateway: g.cfg.Name, ID: res.ID, ChargeID: res.ChargeID, Amount: res.Amount, Status: status}, nil
+}
+
+func (g *HTTPGateway) Payout(ctx context.Context, req fintech.PayoutRequest) (*fintech.Payout, error) {
+	var res payoutResponse
+	body := payoutRequest{
+		ReferenceID:   req.ReferenceID,
+		BeneficiaryID: req.BeneficiaryID,
+		Amount:        req.Amount,
+		CallbackURL:   g.cfg.CallbackURL,
+	}
+	if err := g.do(ctx, http.MethodPost, "/v1/payouts", "payout-"+req.ReferenceID, body, &res); err != nil {
+		return nil, err
+	}
+	status, err := g.status(g.cfg.PayoutStatusMap, res.Status)
+	if err != nil {
+		return nil, err
+	}
+	return &fintech.Payout{Gateway: g.cfg.Name, ID: res.ID, ReferenceID: res.ReferenceID, Amount: res.Amount, Status: status}, nil
+}
+
+func (g *HTTPGateway) ParseWebhook(body []byte, signature string) (*fintech.GatewayEvent, error) {
+	if !VerifySignature(g.cfg.WebhookSecret, body, signature) {
+		return nil, fintech.ErrInvalidWebhookSignature
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("decode %s webhook: %w", g.cfg.Name, err)
+	}
+	if payload.EventID == "" || payload.OrderID == "" {
+		return nil, fmt.Errorf("decode %s webhook: missing event or order id", g.cfg.Name)
+	}
+
+	object := fintech.GatewayObject(payload.Type)
+	statusMap := g.cfg.StatusMap
+	switch object {
+	case fintech.ObjectCharge, fintech.ObjectRefund:
+	case fintech.ObjectPayout:
+		statusMap = g.cfg.PayoutStatusMap
+	default:
+		return nil, fmt.Errorf("%s webhook type %q: %w", g.cfg.Name, payload.Type, fintech.ErrUnmappedGatewayStatus)
+	}
+	status, err := g.status(statusMap, payload.Status)
+	if err != nil {
+		return nil, err
+	}
+	return &fintech.GatewayEvent{
+		Gateway:       g.cfg.Name,
+		EventID:       payload.EventID,
+		Object:        object,
+		ObjectID:      payload.ID,
+		OrderID:       payload.OrderID,
+		Status:        status,
+		GatewayStatus: payload.Status,
+		Amount:        payload.Amount,
+		At:            payload.OccurredAt,
+	}, nil
+}
+
+func (g *HTTPGateway) charge(res chargeResponse) (*fintech.Charge, error) {
+	status, err := g.status(g.cfg.StatusMap, res.Status)
+	if err != nil {
+		return nil, err
+	}
+	return &fintech.Charge{Gateway: g.cfg.Name, ID: res.ID, OrderID: res.OrderID, Amount: res.Amount, Status: status}, nil
+}
+
+func (g *HTTPGateway) status(statusMap map[string]fintech.PaymentStatus, raw string) (fintech.PaymentStatus, error) {
+	status, ok := statusMap[raw]
+	if !ok {
+		return "", fmt.Errorf("%s status %q: %w", g.cfg.Name, raw, fintech.ErrUnmappedGatewayStatus)
+	}
+	return status, nil
+}
+
+func (g *HTTPGateway) do(ctx context.Context, method, path, idempotencyKey string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.cfg.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.cfg.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set(IdempotencyHeader, idempotencyKey)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", g.cfg.Name, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s %s: %w", g.cfg.Name, path, fintech.ErrPaymentNotFound)
+	case resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: status %d: %s", g.cfg.Name, path, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s %s: decode: %w", g.cfg.Name, path, err)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 a gateway puts in SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a webhook body against its signature in constant time
+func VerifySignature(secret string, body []byte, signature string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
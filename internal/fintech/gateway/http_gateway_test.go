@@ -0,0 +1,181 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/fintech"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+const testSecret = "whsec-test"
+
+var pinned = time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+type webhookSink struct {
+	mu     sync.Mutex
+	events []*fintech.GatewayEvent
+	errs   []error
+}
+
+func (s *webhookSink) received() ([]*fintech.GatewayEvent, []error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*fintech.GatewayEvent(nil), s.events...), append([]error(nil), s.errs...)
+}
+
+func newFakeGateway(t *testing.T, secret string) (*HTTPGateway, *FakeServer, *webhookSink) {
+	t.Helper()
+	sink := &webhookSink{}
+	var g *HTTPGateway
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		e, err := g.ParseWebhook(body, r.Header.Get(SignatureHeader))
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		if err != nil {
+			sink.errs = append(sink.errs, err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		sink.events = append(sink.events, e)
+	}))
+	t.Cleanup(receiver.Close)
+
+	fake := NewFakeServer(FakeConfig{
+		APIKey:          "key",
+		WebhookSecret:   secret,
+		ManualCallbacks: true,
+		Now:             func() time.Time { return pinned },
+	})
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	g = NewHTTPGateway(Config{
+		Name:          "fake",
+		BaseURL:       server.URL,
+		APIKey:        "key",
+		WebhookSecret: testSecret,
+		CallbackURL:   receiver.URL,
+	})
+	return g, fake, sink
+}
+
+func TestFakeGateway_SuccessChargesOnceAndCallsBack(t *testing.T) {
+	ctx := context.Background()
+	g, fake, sink := newFakeGateway(t, testSecret)
+
+	req := fintech.ChargeRequest{OrderID: "o1", CustomerID: "u1", Amount: money.Rupiah(25000), Capture: true}
+	charge, err := g.Authorize(ctx, req)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	if charge.Status != fintech.PaymentCaptured || charge.Amount.Units() != 25000 || charge.Gateway != "fake" {
+		t.Fatalf("unexpected charge %+v", charge)
+	}
+
+	// A retried request is answered from the idempotency key: same charge, no second callback
+	again, err := g.Authorize(ctx, req)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if again.ID != charge.ID {
+		t.Fatalf("retry opened charge %s, want %s", again.ID, charge.ID)
+	}
+	if fake.Pending() != 1 {
+		t.Fatalf("expected one queued callback, got %d", fake.Pending())
+	}
+
+	if n, err := fake.Flush(); err != nil || n != 1 {
+		t.Fatalf("flush delivered %d: %v", n, err)
+	}
+	events, errs := sink.received()
+	if len(errs) != 0 || len(events) != 1 {
+		t.Fatalf("expected one verified callback, got %v / %v", events, errs)
+	}
+	e := events[0]
+	if e.Object != fintech.ObjectCharge || e.ObjectID != charge.ID || e.OrderID != "o1" ||
+		e.Status != fintech.PaymentCaptured || e.GatewayStatus != "CAPTURED" || !e.At.Equal(pinned) {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	refund, err := g.Refund(ctx, charge.ID, money.Rupiah(25000), "escrow_cancelled")
+	if err != nil || refund.Status != fintech.PaymentRefunded {
+		t.Fatalf("refund: %+v, %v", refund, err)
+	}
+	payout, err := g.Payout(ctx, fintech.PayoutRequest{ReferenceID: "o2", BeneficiaryID: "prov-1", Amount: money.Rupiah(20000)})
+	if err != nil || payout.Status != fintech.PayoutPaid {
+		t.Fatalf("payout: %+v, %v", payout, err)
+	}
+}
+
+func TestFakeGateway_DeclineAndDelayedScenarios(t *testing.T) {
+	ctx := context.Background()
+	g, fake, sink := newFakeGateway(t, testSecret)
+	fake.Script("declined", ScenarioDecline)
+	fake.Script("va", ScenarioDelayed)
+
+	declined, err := g.Authorize(ctx, fintech.ChargeRequest{OrderID: "declined", Amount: money.Rupiah(10000), Capture: true})
+	if err != nil || declined.Status != fintech.PaymentFailed {
+		t.Fatalf("expected a failed charge, got %+v, %v", declined, err)
+	}
+
+	pending, err := g.Authorize(ctx, fintech.ChargeRequest{OrderID: "va", Amount: money.Rupiah(15000), Capture: true})
+	if err != nil || pending.Status != fintech.PaymentPending {
+		t.Fatalf("expected a pending charge, got %+v, %v", pending, err)
+	}
+	if events, _ := sink.received(); len(events) != 0 {
+		t.Fatalf("callbacks must wait for the flush, got %v", events)
+	}
+
+	if _, err := fake.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	events, _ := sink.received()
+	if len(events) != 2 {
+		t.Fatalf("expected two callbacks, got %d", len(events))
+	}
+	if events[0].OrderID != "declined" || events[0].Status != fintech.PaymentFailed {
+		t.Fatalf("unexpected decline callback %+v", events[0])
+	}
+	if events[1].OrderID != "va" || events[1].Status != fintech.PaymentCaptured {
+		t.Fatalf("delayed callback should report the capture, got %+v", events[1])
+	}
+
+	// Nothing to refund on a declined charge
+	if _, err := g.Refund(ctx, declined.ID, money.Rupiah(10000), "x"); err == nil {
+		t.Fatal("expected refund of a declined charge to fail")
+	}
+	if _, err := g.Capture(ctx, "CH-missing", money.Rupiah(1)); !errors.Is(err, fintech.ErrPaymentNotFound) {
+		t.Fatalf("expected ErrPaymentNotFound, got %v", err)
+	}
+}
+
+func TestHTTPGateway_RejectsForgedWebhooks(t *testing.T) {
+	g, fake, sink := newFakeGateway(t, "someone-else")
+	if _, err := g.Authorize(context.Background(), fintech.ChargeRequest{OrderID: "o1", Amount: money.Rupiah(5000), Capture: true}); err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	if _, err := fake.Flush(); err == nil {
+		t.Fatal("expected the receiver to refuse the callback")
+	}
+	events, errs := sink.received()
+	if len(events) != 0 || len(errs) != 1 || !errors.Is(errs[0], fintech.ErrInvalidWebhookSignature) {
+		t.Fatalf("expected one signature failure, got %v / %v", events, errs)
+	}
+	if fake.Pending() != 1 {
+		t.Fatalf("a refused callback stays queued for retry, got %d", fake.Pending())
+	}
+
+	if _, err := g.ParseWebhook([]byte(`{"event_id":"e","type":"charge","order_id":"o","status":"WEIRD"}`),
+		Sign(testSecret, []byte(`{"event_id":"e","type":"charge","order_id":"o","status":"WEIRD"}`))); !errors.Is(err, fintech.ErrUnmappedGatewayStatus) {
+		t.Fatalf("expected ErrUnmappedGatewayStatus, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package fintech
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+// Payment links an order's escrow to the gateway charge that funded it
+type Payment struct {
+	OrderID    string        `json:"order_id"`
+	Gateway    string        `json:"gateway"`
+	ChargeID   string        `json:"charge_id"`
+	CustomerID string        `json:"customer_id"`
+	Amount     money.Money   `json:"amount"`   // Charged to the buyer
+	Discount   money.Money   `json:"discount"` // Voucher part of the order value, paid by the platform
+	Status     PaymentStatus `json:"status"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+type PaymentRepository interface {
+	// Create stores a new payment; false when the order already has one
+	Create(ctx context.Context, p *Payment) (bool, error)
+	Get(ctx context.Context, orderID string) (*Payment, error)
+	// UpdateStatus moves the charge forward only, so it is safe under out-of-order callbacks
+	UpdateStatus(ctx context.Context, orderID string, status PaymentStatus) (bool, error)
+
+	// OrderPrice is what the claimed surplus sells for: its discounted price,
+	// else its list price
+	OrderPrice(ctx context.Context, orderID string) (money.Money, error)
+
+	// WebhookProcessed and RecordWebhook deduplicate gateway callbacks by event ID
+	WebhookProcessed(ctx context.Context, gateway, eventID string) (bool, error)
+	RecordWebhook(ctx context.Context, e GatewayEvent) error
+}
+
+type postgresPaymentRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresPaymentRepository(db *sql.DB) PaymentRepository {
+	return &postgresPaymentRepository{db: db}
+}
+
+func (r *postgresPaymentRepository) Create(ctx context.Context, p *Payment) (bool, error) {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO payments (order_id, gateway, charge_id, customer_id, amount, voucher_discount, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (order_id) DO NOTHING
+		RETURNING created_at, updated_at
+	`, p.OrderID, p.Gateway, p.ChargeID, p.CustomerID, p.Amount, p.Discount, p.Status).Scan(&p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *postgresPaymentRepository) Get(ctx context.Context, orderID string) (*Payment, error) {
+	var p Payment
+	err := r.db.QueryRowContext(ctx, `
+		SELECT order_id, gateway, charge_id, customer_id, amount, voucher_discount, status, created_at, updated_at
+		FROM payments
+		WHERE order_id = $1
+	`, orderID).Scan(&p.OrderID, &p.Gateway, &p.ChargeID, &p.CustomerID, &p.Amount, &p.Discount, &p.Status,
+		&p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// UpdateStatus re-checks the transition under a row lock so two callbacks racing
+// on different replicas cannot move the charge backwards
+func (r *postgresPaymentRepository) UpdateStatus(ctx context.Context, orderID string, status PaymentStatus) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var current PaymentStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM payments WHERE order_id = $1 FOR UPDATE`, orderID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrPaymentNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	if !current.Advances(status) {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE payments SET status = $2, updated_at = NOW() WHERE order_id = $1
+	`, orderID, status); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *postgresPaymentRepository) OrderPrice(ctx context.Context, orderID string) (money.Money, error) {
+	var price money.Money // NULL scans as zero: a surplus nobody priced
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(discount_price, original_price) FROM surplus WHERE id::TEXT = $1
+	`, orderID).Scan(&price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return money.Money{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return money.Money{}, err
+	}
+	if !price.IsPositive() {
+		return money.Money{}, ErrOrderNotForSale
+	}
+	return price, nil
+}
+
+func (r *postgresPaymentRepository) WebhookProcessed(ctx context.Context, gateway, eventID string) (bool, error) {
+	var seen bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM payment_webhook_events WHERE gateway = $1 AND event_id = $2)
+	`, gateway, eventID).Scan(&seen)
+	return seen, err
+}
+
+func (r *postgresPaymentRepository) RecordWebhook(ctx context.Context, e GatewayEvent) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO payment_webhook_events (gateway, event_id, order_id, object, status, gateway_status, amount, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (gateway, event_id) DO NOTHING
+	`, e.Gateway, e.EventID, e.OrderID, e.Object, e.Status, e.GatewayStatus, e.Amount, e.At)
+	return err
+}
@@ -0,0 +1,295 @@
+package fintech
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/ledger"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+var ErrPayoutBatchNotFound = errors.New("payout batch not found")
+
+// PayoutCadence is how often released funds are swept to providers
+type PayoutCadence string
+
+const (
+	CadenceDaily  PayoutCadence = "daily"
+	CadenceWeekly PayoutCadence = "weekly"
+)
+
+// PayoutSchedule decides when providers are paid and how much is worth a transfer.
+// Amounts are whole rupiah.
+type PayoutSchedule struct {
+	Cadence       PayoutCadence
+	Weekday       time.Weekday // Weekly cadence: the day batches are cut
+	MinimumPayout int64        // Smaller balances carry over to the next period
+	TransferFee   int64        // Gateway disbursement fee, deducted from each batch
+	Location      *time.Location
+}
+
+// DefaultPayoutSchedule pays daily once a provider is owed IDR 50,000
+func DefaultPayoutSchedule() PayoutSchedule {
+	loc, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		loc = time.FixedZone("WIB", 7*60*60)
+	}
+	return PayoutSchedule{Cadence: CadenceDaily, Weekday: time.Monday, MinimumPayout: 50000, TransferFee: 2500, Location: loc}
+}
+
+func (s PayoutSchedule) Validate() error {
+	if s.Cadence != CadenceDaily && s.Cadence != CadenceWeekly {
+		return fmt.Errorf("unknown payout cadence %q", s.Cadence)
+	}
+	if s.TransferFee < 0 || s.MinimumPayout <= s.TransferFee {
+		return fmt.Errorf("minimum payout %d must exceed the transfer fee %d", s.MinimumPayout, s.TransferFee)
+	}
+	return nil
+}
+
+// PeriodStart is the cut-off of the payout period containing t: releases
+// before it are paid in that period's batch
+func (s PayoutSchedule) PeriodStart(t time.Time) time.Time {
+	local := t.In(s.Location)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.Location)
+	if s.Cadence == CadenceWeekly {
+		start = start.AddDate(0, 0, -((int(start.Weekday()) - int(s.Weekday) + 7) % 7))
+	}
+	return start
+}
+
+// ProviderRelease is one released order owed to a provider
+type ProviderRelease struct {
+	OrderID    string    `json:"order_id"`
+	ProviderID string    `json:"provider_id"`
+	Gross      int64     `json:"gross"` // Order value released from escrow
+	Fee        int64     `json:"fee"`   // Platform commission
+	Net        int64     `json:"net"`
+	ReleasedAt time.Time `json:"released_at"`
+	BatchID    string    `json:"batch_id,omitempty"`
+}
+
+// PayoutBatch is one transfer to a provider covering every release before the cut-off
+type PayoutBatch struct {
+	ID          string        `json:"id"`
+	ProviderID  string        `json:"provider_id"`
+	PeriodStart time.Time     `json:"period_start"`
+	Orders      int           `json:"orders"`
+	Gross       int64         `json:"gross"`
+	Fees        int64         `json:"fees"`
+	Net         int64         `json:"net"`          // Owed before deductions
+	TransferFee int64         `json:"transfer_fee"` // Deduction
+	Amount      int64         `json:"amount"`       // Sent to the provider
+	PayoutID    string        `json:"payout_id,omitempty"`
+	Status      PaymentStatus `json:"status"` // payout_pending, paid_out, payout_failed
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// ProviderBalance is what a provider is owed and not yet batched
+type ProviderBalance struct {
+	ProviderID string
+	Orders     int
+	Net        int64
+}
+
+type PayoutRepository interface {
+	// RecordRelease stores a release once; repeats are ignored
+	RecordRelease(ctx context.Context, r ProviderRelease) error
+	// Unbatched sums releases before the cut-off per provider
+	Unbatched(ctx context.Context, cutoff time.Time) ([]ProviderBalance, error)
+	// CreateBatch claims the provider's unbatched releases before the cut-off and
+	// fills in the batch totals; false when the provider already has a batch for the period
+	CreateBatch(ctx context.Context, b *PayoutBatch, cutoff time.Time) (bool, error)
+	GetBatch(ctx context.Context, id string) (*PayoutBatch, error)
+	// UpdateBatch moves the payout status forward only
+	UpdateBatch(ctx context.Context, id, payoutID string, status PaymentStatus) (bool, error)
+	// ReleaseBatch hands a failed batch's orders back for the next period
+	ReleaseBatch(ctx context.Context, id string) error
+	// Unsubmitted lists batches the gateway has not accepted yet
+	Unsubmitted(ctx context.Context) ([]PayoutBatch, error)
+
+	Releases(ctx context.Context, providerID string, from, to time.Time) ([]ProviderRelease, error)
+	Batches(ctx context.Context, providerID string, from, to time.Time) ([]PayoutBatch, error)
+}
+
+// PayoutService sweeps released escrow to providers in batches and books each
+// transfer in the journal once the gateway confirms it.
+type PayoutService struct {
+	repo     PayoutRepository
+	journal  *ledger.Service
+	gateway  PaymentGateway // nil: batches are cut but wait for a processor
+	schedule PayoutSchedule
+	logger   *zap.Logger
+}
+
+func NewPayoutService(repo PayoutRepository, journal *ledger.Service, gateway PaymentGateway, schedule PayoutSchedule, logger *zap.Logger) *PayoutService {
+	return &PayoutService{repo: repo, journal: journal, gateway: gateway, schedule: schedule, logger: logger}
+}
+
+func (s *PayoutService) Schedule() PayoutSchedule {
+	return s.schedule
+}
+
+// Accrue records a released order as owed to its provider
+func (s *PayoutService) Accrue(ctx context.Context, r ProviderRelease) error {
+	return s.repo.RecordRelease(ctx, r)
+}
+
+// RunPayoutScheduler cuts and submits batches every hour; a period is only
+// ever batched once per provider, so running often is safe
+func (s *PayoutService) RunPayoutScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if _, err := s.RunPayouts(ctx, time.Now()); err != nil {
+			s.logger.Error("Payout run failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunPayouts batches every provider over the threshold for the period containing
+// now, then sends each unsubmitted batch through the gateway
+func (s *PayoutService) RunPayouts(ctx context.Context, now time.Time) ([]PayoutBatch, error) {
+	cutoff := s.schedule.PeriodStart(now)
+	balances, err := s.repo.Unbatched(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range balances {
+		if b.Net < s.schedule.MinimumPayout {
+			continue // Carried over
+		}
+		batch := &PayoutBatch{
+			ID:          uuid.New().String(),
+			ProviderID:  b.ProviderID,
+			PeriodStart: cutoff,
+			TransferFee: s.schedule.TransferFee,
+			Status:      PayoutPending,
+		}
+		created, err := s.repo.CreateBatch(ctx, batch, cutoff)
+		if err != nil {
+			return nil, fmt.Errorf("batch provider %s: %w", b.ProviderID, err)
+		}
+		if created {
+			s.logger.Info("Payout batch created",
+				zap.String("batch_id", batch.ID),
+				zap.String("provider_id", batch.ProviderID),
+				zap.Int("orders", batch.Orders),
+				zap.Int64("amount", batch.Amount))
+		}
+	}
+
+	if s.gateway == nil {
+		return nil, nil
+	}
+	pending, err := s.repo.Unsubmitted(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var submitted []PayoutBatch
+	for _, b := range pending {
+		if err := s.submit(ctx, &b); err != nil {
+			s.logger.Error("Payout submission failed", zap.String("batch_id", b.ID), zap.Error(err))
+			continue // Retried next run under the same idempotency key
+		}
+		submitted = append(submitted, b)
+	}
+	return submitted, nil
+}
+
+func (s *PayoutService) submit(ctx context.Context, b *PayoutBatch) error {
+	payout, err := s.gateway.Payout(ctx, PayoutRequest{ReferenceID: b.ID, BeneficiaryID: b.ProviderID, Amount: money.Rupiah(b.Amount)})
+	if err != nil {
+		return err
+	}
+	b.PayoutID, b.Status = payout.ID, payout.Status
+	return s.ApplyPayoutStatus(ctx, b.ID, payout.ID, payout.Status)
+}
+
+// ApplyPayoutStatus tracks a batch's transfer from the submit response or a
+// gateway callback. A paid batch is booked; a failed one goes back into the pool.
+func (s *PayoutService) ApplyPayoutStatus(ctx context.Context, batchID, payoutID string, status PaymentStatus) error {
+	b, err := s.repo.GetBatch(ctx, batchID)
+	if err != nil {
+		return err
+	}
+	moved, err := s.repo.UpdateBatch(ctx, batchID, payoutID, status)
+	if err != nil || !moved {
+		return err
+	}
+
+	switch status {
+	case PayoutPaid:
+		if s.gateway == nil {
+			return ErrUnknownGateway
+		}
+		// The whole net leaves the payable: the provider receives Amount, the gateway keeps the fee
+		return s.journal.Payout(ctx, "batch/"+b.ID, ledger.ProviderPayable(b.ProviderID), s.gateway.Name(), b.Net)
+	case PayoutFailed:
+		s.logger.Error("Provider payout failed, orders return to the next batch",
+			zap.String("batch_id", b.ID), zap.String("provider_id", b.ProviderID))
+		return s.repo.ReleaseBatch(ctx, b.ID)
+	}
+	return nil
+}
+
+// Batch returns a payout batch by ID
+func (s *PayoutService) Batch(ctx context.Context, id string) (*PayoutBatch, error) {
+	return s.repo.GetBatch(ctx, id)
+}
+
+// Statement is a provider's settlement statement for a period
+type Statement struct {
+	ProviderID string            `json:"provider_id"`
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	Orders     []ProviderRelease `json:"orders"`
+	Batches    []PayoutBatch     `json:"batches"`
+	Gross      int64             `json:"gross"`
+	Fees       int64             `json:"fees"`
+	Deductions int64             `json:"deductions"` // Transfer fees of the period's batches
+	Net        int64             `json:"net"`        // Earned in the period after fees and deductions
+	PaidOut    int64             `json:"paid_out"`   // Transferred in the period
+}
+
+// Statement lists every order released to the provider in [from, to) with its
+// commission, and every payout batch with its deductions
+func (s *PayoutService) Statement(ctx context.Context, providerID string, from, to time.Time) (*Statement, error) {
+	releases, err := s.repo.Releases(ctx, providerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	batches, err := s.repo.Batches(ctx, providerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &Statement{ProviderID: providerID, From: from, To: to, Orders: releases, Batches: batches}
+	for _, r := range releases {
+		st.Gross += r.Gross
+		st.Fees += r.Fee
+		st.Net += r.Net
+	}
+	for _, b := range batches {
+		if b.Status == PayoutFailed {
+			continue // Nothing was sent; its orders are batched again
+		}
+		st.Deductions += b.TransferFee
+		if b.Status == PayoutPaid {
+			st.PaidOut += b.Amount
+		}
+	}
+	st.Net -= st.Deductions
+	return st, nil
+}
@@ -0,0 +1,212 @@
+package fintech
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type postgresPayoutRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresPayoutRepository keeps released orders in provider_releases and
+// their transfers in payout_batches. A release belongs to at most one live batch.
+func NewPostgresPayoutRepository(db *sql.DB) PayoutRepository {
+	return &postgresPayoutRepository{db: db}
+}
+
+func (r *postgresPayoutRepository) RecordRelease(ctx context.Context, rel ProviderRelease) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO provider_releases (order_id, provider_id, gross, fee, net, released_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (order_id) DO NOTHING
+	`, rel.OrderID, rel.ProviderID, rel.Gross, rel.Fee, rel.Net, rel.ReleasedAt.UTC())
+	return err
+}
+
+func (r *postgresPayoutRepository) Unbatched(ctx context.Context, cutoff time.Time) ([]ProviderBalance, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT provider_id, COUNT(*), SUM(net)
+		FROM provider_releases
+		WHERE batch_id IS NULL AND released_at < $1
+		GROUP BY provider_id
+	`, cutoff.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []ProviderBalance
+	for rows.Next() {
+		var b ProviderBalance
+		if err := rows.Scan(&b.ProviderID, &b.Orders, &b.Net); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// CreateBatch inserts the batch and claims its releases in one transaction, so
+// two schedulers racing cannot pay the same order twice
+func (r *postgresPayoutRepository) CreateBatch(ctx context.Context, b *PayoutBatch, cutoff time.Time) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO payout_batches (id, provider_id, period_start, transfer_fee, status)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (provider_id, period_start) DO NOTHING
+	`, b.ID, b.ProviderID, b.PeriodStart.UTC(), b.TransferFee, b.Status)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		WITH claimed AS (
+			UPDATE provider_releases SET batch_id = $1
+			WHERE provider_id = $2 AND batch_id IS NULL AND released_at < $3
+			RETURNING gross, fee, net
+		)
+		SELECT COUNT(*), COALESCE(SUM(gross), 0), COALESCE(SUM(fee), 0), COALESCE(SUM(net), 0) FROM claimed
+	`, b.ID, b.ProviderID, cutoff.UTC()).Scan(&b.Orders, &b.Gross, &b.Fees, &b.Net)
+	if err != nil {
+		return false, err
+	}
+	if b.Net <= b.TransferFee {
+		return false, nil // Claimed by someone else in the meantime
+	}
+	b.Amount = b.Net - b.TransferFee
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE payout_batches SET orders = $2, gross = $3, fees = $4, net = $5, amount = $6
+		WHERE id = $1
+		RETURNING created_at, updated_at
+	`, b.ID, b.Orders, b.Gross, b.Fees, b.Net, b.Amount).Scan(&b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+const batchColumns = `id, provider_id, period_start, orders, gross, fees, net, transfer_fee, amount,
+	COALESCE(payout_id, ''), status, created_at, updated_at`
+
+func scanBatch(row interface{ Scan(...any) error }) (*PayoutBatch, error) {
+	var b PayoutBatch
+	err := row.Scan(&b.ID, &b.ProviderID, &b.PeriodStart, &b.Orders, &b.Gross, &b.Fees, &b.Net, &b.TransferFee, &b.Amount,
+		&b.PayoutID, &b.Status, &b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *postgresPayoutRepository) queryBatches(ctx context.Context, query string, args ...any) ([]PayoutBatch, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []PayoutBatch
+	for rows.Next() {
+		b, err := scanBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *b)
+	}
+	return out, rows.Err()
+}
+
+func (r *postgresPayoutRepository) GetBatch(ctx context.Context, id string) (*PayoutBatch, error) {
+	b, err := scanBatch(r.db.QueryRowContext(ctx, `SELECT `+batchColumns+` FROM payout_batches WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPayoutBatchNotFound
+	}
+	return b, err
+}
+
+// UpdateBatch always records the gateway's payout ID; the status only moves
+// forward, checked under a row lock like payments
+func (r *postgresPayoutRepository) UpdateBatch(ctx context.Context, id, payoutID string, status PaymentStatus) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var current PaymentStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM payout_batches WHERE id = $1 FOR UPDATE`, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrPayoutBatchNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	moved := current.Advances(status)
+	if !moved {
+		status = current
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE payout_batches
+		SET payout_id = COALESCE(NULLIF($2, ''), payout_id), status = $3, updated_at = NOW()
+		WHERE id = $1
+	`, id, payoutID, status); err != nil {
+		return false, err
+	}
+	return moved, tx.Commit()
+}
+
+func (r *postgresPayoutRepository) ReleaseBatch(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE provider_releases SET batch_id = NULL WHERE batch_id = $1`, id)
+	return err
+}
+
+func (r *postgresPayoutRepository) Unsubmitted(ctx context.Context) ([]PayoutBatch, error) {
+	return r.queryBatches(ctx, `
+		SELECT `+batchColumns+` FROM payout_batches
+		WHERE status = $1 AND payout_id IS NULL
+		ORDER BY created_at
+	`, PayoutPending)
+}
+
+func (r *postgresPayoutRepository) Releases(ctx context.Context, providerID string, from, to time.Time) ([]ProviderRelease, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT order_id, provider_id, gross, fee, net, released_at, COALESCE(batch_id::TEXT, '')
+		FROM provider_releases
+		WHERE provider_id = $1 AND released_at >= $2 AND released_at < $3
+		ORDER BY released_at, order_id
+	`, providerID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []ProviderRelease
+	for rows.Next() {
+		var rel ProviderRelease
+		if err := rows.Scan(&rel.OrderID, &rel.ProviderID, &rel.Gross, &rel.Fee, &rel.Net, &rel.ReleasedAt, &rel.BatchID); err != nil {
+			return nil, err
+		}
+		out = append(out, rel)
+	}
+	return out, rows.Err()
+}
+
+func (r *postgresPayoutRepository) Batches(ctx context.Context, providerID string, from, to time.Time) ([]PayoutBatch, error) {
+	return r.queryBatches(ctx, `
+		SELECT `+batchColumns+` FROM payout_batches
+		WHERE provider_id = $1 AND created_at >= $2 AND created_at < $3
+		ORDER BY created_at
+	`, providerID, from.UTC(), to.UTC())
+}
@@ -0,0 +1,263 @@
+package fintech
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/ledger"
+)
+
+type memoryPayouts struct {
+	mu       sync.Mutex
+	releases map[string]ProviderRelease
+	batches  map[string]PayoutBatch
+}
+
+func newMemoryPayouts() *memoryPayouts {
+	return &memoryPayouts{releases: make(map[string]ProviderRelease), batches: make(map[string]PayoutBatch)}
+}
+
+func (m *memoryPayouts) RecordRelease(_ context.Context, r ProviderRelease) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.releases[r.OrderID]; !ok {
+		m.releases[r.OrderID] = r
+	}
+	return nil
+}
+
+func (m *memoryPayouts) Unbatched(_ context.Context, cutoff time.Time) ([]ProviderBalance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	byProvider := make(map[string]*ProviderBalance)
+	for _, r := range m.releases {
+		if r.BatchID != "" || !r.ReleasedAt.Before(cutoff) {
+			continue
+		}
+		b := byProvider[r.ProviderID]
+		if b == nil {
+			b = &ProviderBalance{ProviderID: r.ProviderID}
+			byProvider[r.ProviderID] = b
+		}
+		b.Orders++
+		b.Net += r.Net
+	}
+	var out []ProviderBalance
+	for _, b := range byProvider {
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ProviderID < out[j].ProviderID })
+	return out, nil
+}
+
+func (m *memoryPayouts) CreateBatch(_ context.Context, b *PayoutBatch, cutoff time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.batches {
+		if existing.ProviderID == b.ProviderID && existing.PeriodStart.Equal(b.PeriodStart) {
+			return false, nil
+		}
+	}
+	for id, r := range m.releases {
+		if r.ProviderID == b.ProviderID && r.BatchID == "" && r.ReleasedAt.Before(cutoff) {
+			r.BatchID = b.ID
+			m.releases[id] = r
+			b.Orders++
+			b.Gross += r.Gross
+			b.Fees += r.Fee
+			b.Net += r.Net
+		}
+	}
+	b.Amount = b.Net - b.TransferFee
+	b.CreatedAt, b.UpdatedAt = cutoff, cutoff
+	m.batches[b.ID] = *b
+	return true, nil
+}
+
+func (m *memoryPayouts) GetBatch(_ context.Context, id string) (*PayoutBatch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.batches[id]
+	if !ok {
+		return nil, ErrPayoutBatchNotFound
+	}
+	return &b, nil
+}
+
+func (m *memoryPayouts) UpdateBatch(_ context.Context, id, payoutID string, status PaymentStatus) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.batches[id]
+	if !ok {
+		return false, ErrPayoutBatchNotFound
+	}
+	if payoutID != "" {
+		b.PayoutID = payoutID
+	}
+	moved := b.Status.Advances(status)
+	if moved {
+		b.Status = status
+	}
+	m.batches[id] = b
+	return moved, nil
+}
+
+func (m *memoryPayouts) ReleaseBatch(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for orderID, r := range m.releases {
+		if r.BatchID == id {
+			r.BatchID = ""
+			m.releases[orderID] = r
+		}
+	}
+	return nil
+}
+
+func (m *memoryPayouts) Unsubmitted(_ context.Context) ([]PayoutBatch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []PayoutBatch
+	for _, b := range m.batches {
+		if b.Status == PayoutPending && b.PayoutID == "" {
+			out = append(out, b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ProviderID < out[j].ProviderID })
+	return out, nil
+}
+
+func (m *memoryPayouts) Releases(_ context.Context, providerID string, from, to time.Time) ([]ProviderRelease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []ProviderRelease
+	for _, r := range m.releases {
+		if r.ProviderID == providerID && !r.ReleasedAt.Before(from) && r.ReleasedAt.Before(to) {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].OrderID < out[j].OrderID })
+	return out, nil
+}
+
+func (m *memoryPayouts) Batches(_ context.Context, providerID string, from, to time.Time) ([]PayoutBatch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []PayoutBatch
+	for _, b := range m.batches {
+		if b.ProviderID == providerID && !b.CreatedAt.Before(from) && b.CreatedAt.Before(to) {
+			out = append(out, b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func testSchedule() PayoutSchedule {
+	s := DefaultPayoutSchedule()
+	s.MinimumPayout = 10000
+	return s
+}
+
+func release(orderID, providerID string, net int64, at time.Time) ProviderRelease {
+	gross := net * 10 / 9
+	return ProviderRelease{OrderID: orderID, ProviderID: providerID, Gross: gross, Fee: gross - net, Net: net, ReleasedAt: at}
+}
+
+func TestPayouts_WeeklyBatchesRespectThreshold(t *testing.T) {
+	ctx := context.Background()
+	schedule := testSchedule()
+	schedule.Cadence, schedule.Weekday, schedule.MinimumPayout = CadenceWeekly, time.Monday, 30000
+	gw := &scriptedGateway{}
+	svc := NewPayoutService(newMemoryPayouts(), ledger.NewService(ledger.NewMemoryRepository(), zap.NewNop()), gw, schedule, zap.NewNop())
+
+	tuesday := time.Date(2026, 3, 3, 14, 0, 0, 0, schedule.Location) // Week starting Monday 2 March
+	for _, r := range []ProviderRelease{
+		release("o1", "warung", 18000, tuesday),
+		release("o2", "warung", 18000, tuesday.Add(24*time.Hour)),
+		release("o3", "bakery", 9000, tuesday),
+	} {
+		if err := svc.Accrue(ctx, r); err != nil {
+			t.Fatalf("accrue: %v", err)
+		}
+		if err := svc.Accrue(ctx, r); err != nil { // Released twice, owed once
+			t.Fatalf("repeat accrue: %v", err)
+		}
+	}
+
+	// Mid-week: this week's releases wait for Monday's cut-off
+	if batches, err := svc.RunPayouts(ctx, tuesday.Add(48*time.Hour)); err != nil || len(batches) != 0 {
+		t.Fatalf("expected nothing due mid-week, got %+v, %v", batches, err)
+	}
+
+	monday := time.Date(2026, 3, 9, 1, 0, 0, 0, schedule.Location)
+	batches, err := svc.RunPayouts(ctx, monday)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(batches) != 1 || batches[0].ProviderID != "warung" || batches[0].Orders != 2 || batches[0].Net != 36000 {
+		t.Fatalf("expected one warung batch of two orders, got %+v", batches)
+	}
+	if batches[0].Amount != 36000-schedule.TransferFee || batches[0].Status != PayoutPending || gw.payouts != 1 {
+		t.Fatalf("unexpected submission %+v, %d payouts", batches[0], gw.payouts)
+	}
+
+	// Later the same week: the period is batched, the bakery is still under the threshold
+	if batches, err := svc.RunPayouts(ctx, monday.Add(30*time.Hour)); err != nil || len(batches) != 0 || gw.payouts != 1 {
+		t.Fatalf("expected no second batch, got %+v, %d payouts, %v", batches, gw.payouts, err)
+	}
+}
+
+func TestPayouts_FailedTransferReturnsOrdersAndBooksNothing(t *testing.T) {
+	ctx := context.Background()
+	journal := ledger.NewService(ledger.NewMemoryRepository(), zap.NewNop())
+	svc := NewPayoutService(newMemoryPayouts(), journal, &scriptedGateway{}, testSchedule(), zap.NewNop())
+
+	day := time.Date(2026, 3, 3, 14, 0, 0, 0, testSchedule().Location)
+	if err := svc.Accrue(ctx, release("o1", "warung", 45000, day)); err != nil {
+		t.Fatalf("accrue: %v", err)
+	}
+	batches, err := svc.RunPayouts(ctx, day.Add(24*time.Hour))
+	if err != nil || len(batches) != 1 {
+		t.Fatalf("expected a batch, got %+v, %v", batches, err)
+	}
+	failed := batches[0]
+	if err := svc.ApplyPayoutStatus(ctx, failed.ID, failed.PayoutID, PayoutFailed); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	// A late success callback cannot resurrect a failed transfer
+	if err := svc.ApplyPayoutStatus(ctx, failed.ID, failed.PayoutID, PayoutPaid); err != nil {
+		t.Fatalf("late callback: %v", err)
+	}
+	if b, _ := svc.Batch(ctx, failed.ID); b.Status != PayoutFailed {
+		t.Fatalf("expected the batch to stay failed, got %s", b.Status)
+	}
+	if tb, _ := journal.CheckInvariant(ctx); tb.Entries != 0 {
+		t.Fatalf("a failed transfer must not be booked, got %d entries", tb.Entries)
+	}
+
+	// The next period picks the order up again
+	batches, err = svc.RunPayouts(ctx, day.Add(48*time.Hour))
+	if err != nil || len(batches) != 1 || batches[0].ID == failed.ID || batches[0].Net != 45000 {
+		t.Fatalf("expected the order in a new batch, got %+v, %v", batches, err)
+	}
+	if err := svc.ApplyPayoutStatus(ctx, batches[0].ID, "", PayoutPaid); err != nil {
+		t.Fatalf("paid: %v", err)
+	}
+
+	st, err := svc.Statement(ctx, "warung", day.AddDate(0, 0, -1), day.AddDate(0, 0, 7))
+	if err != nil {
+		t.Fatalf("statement: %v", err)
+	}
+	if len(st.Orders) != 1 || len(st.Batches) != 2 {
+		t.Fatalf("expected one order and both batches, got %+v", st)
+	}
+	if st.Gross != 50000 || st.Fees != 5000 || st.Deductions != 2500 || st.Net != 42500 || st.PaidOut != 42500 {
+		t.Fatalf("unexpected statement totals %+v", st)
+	}
+}
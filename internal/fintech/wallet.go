@@ -0,0 +1,252 @@
+package fintech
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/ledger"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+var (
+	ErrTopUpNotFound = errors.New("wallet top-up not found")
+	ErrInvalidTopUp  = errors.New("invalid wallet top-up amount")
+	ErrPaidElsewhere = errors.New("order is already paid through another method")
+)
+
+// WalletGateway is the Payment.Gateway of orders paid from the buyer's wallet
+const WalletGateway = "wallet"
+
+// topUpOrderPrefix marks a gateway charge as a wallet top-up rather than an
+// order, so its webhooks reach the wallet
+const topUpOrderPrefix = "wallet-topup:"
+
+// TrustLevels gives a user's badge (TrustService.TrustLevel)
+type TrustLevels interface {
+	TrustLevel(ctx context.Context, userID string) (string, error)
+}
+
+// WalletLimits caps wallet use by trust level
+type WalletLimits struct {
+	Daily    map[string]money.Money // Spend per WIB day for each trust level
+	MaxTopUp money.Money            // Largest single top-up
+	Location *time.Location
+}
+
+// DefaultWalletLimits lets a PELUANG_KEDUA buyer spend IDR 100,000 a day, up
+// to IDR 5,000,000 for an UNICORN_SAVIOR
+func DefaultWalletLimits() WalletLimits {
+	loc, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		loc = time.FixedZone("WIB", 7*60*60)
+	}
+	return WalletLimits{
+		Daily: map[string]money.Money{
+			"PELUANG_KEDUA":  money.Rupiah(100000),
+			"WARGA_BAIK":     money.Rupiah(500000),
+			"PAHLAWAN":       money.Rupiah(2000000),
+			"UNICORN_SAVIOR": money.Rupiah(5000000),
+		},
+		MaxTopUp: money.Rupiah(10000000),
+		Location: loc,
+	}
+}
+
+// DailyLimit for a trust level; a level we have no limit for gets the lowest
+func (l WalletLimits) DailyLimit(level string) money.Money {
+	if limit, ok := l.Daily[level]; ok {
+		return limit
+	}
+	var lowest money.Money
+	for _, limit := range l.Daily {
+		if lowest.IsZero() || limit.LessThan(lowest) {
+			lowest = limit
+		}
+	}
+	return lowest
+}
+
+// DayStart is the start of the WIB day containing t, when daily spend resets
+func (l WalletLimits) DayStart(t time.Time) time.Time {
+	local := t.In(l.Location)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, l.Location)
+}
+
+// TopUp is a buyer loading their wallet through the gateway
+type TopUp struct {
+	ID        string        `json:"id"`
+	UserID    string        `json:"user_id"`
+	Gateway   string        `json:"gateway"`
+	ChargeID  string        `json:"charge_id,omitempty"`
+	Amount    money.Money   `json:"amount"`
+	Status    PaymentStatus `json:"status"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// Wallet is a buyer's Pahlawan credits and what they may still spend today
+type Wallet struct {
+	UserID         string      `json:"user_id"`
+	Balance        money.Money `json:"balance"`
+	TrustLevel     string      `json:"trust_level"`
+	DailyLimit     money.Money `json:"daily_limit"`
+	SpentToday     money.Money `json:"spent_today"`
+	InstantRefunds bool        `json:"instant_refunds"` // Refunds land in the wallet instead of going back to the card
+}
+
+type WalletRepository interface {
+	CreateTopUp(ctx context.Context, t *TopUp) error
+	GetTopUp(ctx context.Context, id string) (*TopUp, error)
+	// UpdateTopUp moves the charge forward only, recording its gateway ID
+	UpdateTopUp(ctx context.Context, id, chargeID string, status PaymentStatus) (bool, error)
+
+	InstantRefunds(ctx context.Context, userID string) (bool, error)
+	SetInstantRefunds(ctx context.Context, userID string, on bool) error
+}
+
+// WalletService keeps each buyer's stored value. The balance is the buyer's
+// wallet account in the journal; this service only tracks the gateway side of
+// top-ups and the buyer's settings.
+type WalletService struct {
+	repo    WalletRepository
+	journal *ledger.Service
+	trust   TrustLevels
+	gateway PaymentGateway // nil: wallets can be spent and credited but not topped up
+	limits  WalletLimits
+	logger  *zap.Logger
+}
+
+func NewWalletService(repo WalletRepository, journal *ledger.Service, trust TrustLevels, gateway PaymentGateway, limits WalletLimits, logger *zap.Logger) *WalletService {
+	return &WalletService{repo: repo, journal: journal, trust: trust, gateway: gateway, limits: limits, logger: logger}
+}
+
+// Wallet reads the buyer's balance and today's spend against their limit
+func (s *WalletService) Wallet(ctx context.Context, userID string) (*Wallet, error) {
+	balance, err := s.journal.Balance(ctx, ledger.BuyerWallet(userID))
+	if err != nil {
+		return nil, err
+	}
+	level, err := s.trust.TrustLevel(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	spent, err := s.journal.Spent(ctx, ledger.BuyerWallet(userID), s.limits.DayStart(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	instant, err := s.repo.InstantRefunds(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{
+		UserID:         userID,
+		Balance:        money.Rupiah(balance.Net),
+		TrustLevel:     level,
+		DailyLimit:     s.limits.DailyLimit(level),
+		SpentToday:     money.Rupiah(spent),
+		InstantRefunds: instant,
+	}, nil
+}
+
+// History lists the buyer's wallet movements, newest first
+func (s *WalletService) History(ctx context.Context, userID string, limit int) ([]ledger.Posting, error) {
+	return s.journal.History(ctx, ledger.BuyerWallet(userID), limit)
+}
+
+// SpendLimit is what the buyer's trust level lets them spend today
+func (s *WalletService) SpendLimit(ctx context.Context, userID string) (ledger.SpendLimit, error) {
+	level, err := s.trust.TrustLevel(ctx, userID)
+	if err != nil {
+		return ledger.SpendLimit{}, err
+	}
+	return ledger.SpendLimit{Since: s.limits.DayStart(time.Now()), Max: s.limits.DailyLimit(level).Units()}, nil
+}
+
+// TopUp charges the buyer and credits their wallet once the gateway captures.
+// Methods the buyer completes later (VA, QRIS) come back pending and are
+// credited when the gateway calls back.
+func (s *WalletService) TopUp(ctx context.Context, userID string, amount money.Money) (*TopUp, error) {
+	if s.gateway == nil {
+		return nil, ErrUnknownGateway
+	}
+	if !amount.IsPositive() || amount.GreaterThan(s.limits.MaxTopUp) {
+		return nil, fmt.Errorf("%w: %s, at most %s", ErrInvalidTopUp, amount, s.limits.MaxTopUp)
+	}
+
+	// Stored before the charge so a callback racing the response finds it
+	t := &TopUp{ID: uuid.New().String(), UserID: userID, Gateway: s.gateway.Name(), Amount: amount, Status: PaymentPending}
+	if err := s.repo.CreateTopUp(ctx, t); err != nil {
+		return nil, err
+	}
+	charge, err := s.gateway.Authorize(ctx, ChargeRequest{OrderID: topUpOrderPrefix + t.ID, CustomerID: userID, Amount: amount, Capture: true})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ApplyTopUpStatus(ctx, t.ID, charge.ID, charge.Status); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTopUp(ctx, t.ID)
+}
+
+// ApplyTopUpStatus tracks a top-up's charge from the authorise response or a
+// gateway callback; captured money is credited to the wallet exactly once
+func (s *WalletService) ApplyTopUpStatus(ctx context.Context, topUpID, chargeID string, status PaymentStatus) error {
+	t, err := s.repo.GetTopUp(ctx, topUpID)
+	if err != nil {
+		return err
+	}
+	moved, err := s.repo.UpdateTopUp(ctx, topUpID, chargeID, status)
+	if err != nil {
+		return err
+	}
+	if !moved && (status != PaymentCaptured || t.Status != PaymentCaptured) {
+		return nil // Stale or repeated status; a repeated capture still re-posts the credit below
+	}
+
+	switch status {
+	case PaymentAuthorized:
+		charge, err := s.gateway.Capture(ctx, chargeID, t.Amount)
+		if err != nil {
+			return err
+		}
+		if charge.Status == PaymentCaptured {
+			return s.ApplyTopUpStatus(ctx, topUpID, chargeID, PaymentCaptured)
+		}
+	case PaymentCaptured:
+		// Same reference every time, so this finishes a credit a crash interrupted
+		return s.journal.TopUpWallet(ctx, t.ID, t.UserID, t.Gateway, t.Amount.Units())
+	case PaymentFailed:
+		s.logger.Info("Wallet top-up failed", zap.String("top_up_id", t.ID), zap.String("user_id", t.UserID))
+	}
+	return nil
+}
+
+// CreditCashback pays a campaign's cashback into the buyer's wallet; a
+// campaign pays a buyer once per order
+func (s *WalletService) CreditCashback(ctx context.Context, c ledger.Cashback) error {
+	if c.CampaignID == "" || c.UserID == "" || c.Amount <= 0 {
+		return fmt.Errorf("cashback needs a campaign, a buyer and a positive amount")
+	}
+	return s.journal.CreditCashback(ctx, c)
+}
+
+// SetInstantRefunds chooses whether the buyer's refunds go to their wallet
+// straight away or back to the card through the gateway
+func (s *WalletService) SetInstantRefunds(ctx context.Context, userID string, on bool) error {
+	return s.repo.SetInstantRefunds(ctx, userID, on)
+}
+
+func (s *WalletService) instantRefunds(ctx context.Context, userID string) (bool, error) {
+	return s.repo.InstantRefunds(ctx, userID)
+}
+
+// topUpID recognises a top-up charge by the order ID it was opened with
+func topUpID(orderID string) (string, bool) {
+	return strings.CutPrefix(orderID, topUpOrderPrefix)
+}
@@ -0,0 +1,91 @@
+package fintech
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type postgresWalletRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresWalletRepository stores top-up charges and wallet settings; the
+// balances themselves live in the journal
+func NewPostgresWalletRepository(db *sql.DB) WalletRepository {
+	return &postgresWalletRepository{db: db}
+}
+
+func (r *postgresWalletRepository) CreateTopUp(ctx context.Context, t *TopUp) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO wallet_topups (id, user_id, gateway, amount, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at, updated_at
+	`, t.ID, t.UserID, t.Gateway, t.Amount, t.Status).Scan(&t.CreatedAt, &t.UpdatedAt)
+}
+
+func (r *postgresWalletRepository) GetTopUp(ctx context.Context, id string) (*TopUp, error) {
+	var t TopUp
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, gateway, COALESCE(charge_id, ''), amount, status, created_at, updated_at
+		FROM wallet_topups
+		WHERE id = $1
+	`, id).Scan(&t.ID, &t.UserID, &t.Gateway, &t.ChargeID, &t.Amount, &t.Status, &t.CreatedAt, &t.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTopUpNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// UpdateTopUp re-checks the transition under a row lock, as payments do
+func (r *postgresWalletRepository) UpdateTopUp(ctx context.Context, id, chargeID string, status PaymentStatus) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var current PaymentStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM wallet_topups WHERE id = $1 FOR UPDATE`, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrTopUpNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	moved := current.Advances(status)
+	if !moved {
+		status = current
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE wallet_topups
+		SET charge_id = COALESCE(NULLIF($2, ''), charge_id), status = $3, updated_at = NOW()
+		WHERE id = $1
+	`, id, chargeID, status); err != nil {
+		return false, err
+	}
+	return moved, tx.Commit()
+}
+
+func (r *postgresWalletRepository) InstantRefunds(ctx context.Context, userID string) (bool, error) {
+	var on bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT instant_refunds FROM wallet_settings WHERE user_id = $1
+	`, userID).Scan(&on)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return on, err
+}
+
+func (r *postgresWalletRepository) SetInstantRefunds(ctx context.Context, userID string, on bool) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO wallet_settings (user_id, instant_refunds)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET instant_refunds = EXCLUDED.instant_refunds, updated_at = NOW()
+	`, userID, on)
+	return err
+}
@@ -0,0 +1,181 @@
+package fintech
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	escrowDomain "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
+	escrowRepo "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/repository"
+	escrowService "github.com/albnnaardy11/pahlawan-pangan/internal/escrow/service"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/ledger"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+type memoryWallets struct {
+	mu       sync.Mutex
+	topUps   map[string]TopUp
+	settings map[string]bool
+}
+
+func newMemoryWallets() *memoryWallets {
+	return &memoryWallets{topUps: make(map[string]TopUp), settings: make(map[string]bool)}
+}
+
+func (m *memoryWallets) CreateTopUp(_ context.Context, t *TopUp) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t.CreatedAt, t.UpdatedAt = time.Now(), time.Now()
+	m.topUps[t.ID] = *t
+	return nil
+}
+
+func (m *memoryWallets) GetTopUp(_ context.Context, id string) (*TopUp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.topUps[id]
+	if !ok {
+		return nil, ErrTopUpNotFound
+	}
+	return &t, nil
+}
+
+func (m *memoryWallets) UpdateTopUp(_ context.Context, id, chargeID string, status PaymentStatus) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.topUps[id]
+	if !ok {
+		return false, ErrTopUpNotFound
+	}
+	if chargeID != "" {
+		t.ChargeID = chargeID
+	}
+	moved := t.Status.Advances(status)
+	if moved {
+		t.Status = status
+	}
+	m.topUps[id] = t
+	return moved, nil
+}
+
+func (m *memoryWallets) InstantRefunds(_ context.Context, userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.settings[userID], nil
+}
+
+func (m *memoryWallets) SetInstantRefunds(_ context.Context, userID string, on bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.settings[userID] = on
+	return nil
+}
+
+type fixedTrust map[string]string
+
+func (f fixedTrust) TrustLevel(_ context.Context, userID string) (string, error) {
+	return f[userID], nil
+}
+
+func TestWallet_TopUpPayRefundWithinTrustLimit(t *testing.T) {
+	ctx := context.Background()
+	escrowLedger := escrowService.NewEscrowService(escrowRepo.NewMemoryRepository(), zap.NewNop())
+	journal := ledger.NewService(ledger.NewMemoryRepository(), zap.NewNop())
+	gw := &scriptedGateway{chargeStatus: PaymentPending}
+	trust := fixedTrust{"u1": "PELUANG_KEDUA"}
+	wallets := NewWalletService(newMemoryWallets(), journal, trust, gw, DefaultWalletLimits(), zap.NewNop())
+	payouts := NewPayoutService(newMemoryPayouts(), journal, gw, testSchedule(), zap.NewNop())
+	payments := newMemoryPayments()
+	svc := NewEscrowService(escrowLedger, journal, payments, payouts, wallets, gw, zap.NewNop())
+
+	balance := func() money.Money {
+		t.Helper()
+		w, err := wallets.Wallet(ctx, "u1")
+		if err != nil {
+			t.Fatalf("wallet: %v", err)
+		}
+		return w.Balance
+	}
+
+	// A QRIS top-up is only credited when the gateway calls back, and only once
+	topUp, err := wallets.TopUp(ctx, "u1", money.Rupiah(100000))
+	if err != nil || topUp.Status != PaymentPending {
+		t.Fatalf("top up: %+v, %v", topUp, err)
+	}
+	if got := balance(); !got.IsZero() {
+		t.Fatalf("expected nothing credited before capture, got %s", got)
+	}
+	for _, id := range []string{"evt-1", "evt-2"} {
+		if err := webhook(t, svc, GatewayEvent{EventID: id, Object: ObjectCharge, ObjectID: topUp.ChargeID,
+			OrderID: topUpOrderPrefix + topUp.ID, Status: PaymentCaptured, Amount: money.Rupiah(100000)}); err != nil {
+			t.Fatalf("webhook %s: %v", id, err)
+		}
+	}
+	if got := balance(); got.Units() != 100000 {
+		t.Fatalf("expected the top-up credited once, got %s", got)
+	}
+
+	// 70,000 order with a 10,000 voucher: 60,000 leaves the wallet
+	if _, err := svc.PayFromWallet(ctx, "o1", "u1", money.Rupiah(70000), money.Rupiah(10000)); err != nil {
+		t.Fatalf("pay from wallet: %v", err)
+	}
+	if state, _ := escrowLedger.State(ctx, "o1"); state.Status != escrowDomain.StatusLocked || state.Collected.Units() != 70000 {
+		t.Fatalf("expected 70000 locked in escrow, got %+v", state)
+	}
+	if _, err := svc.PayFromWallet(ctx, "o2", "u1", money.Rupiah(50000), money.Rupiah(0)); !errors.Is(err, ledger.ErrInsufficientFunds) {
+		t.Fatalf("expected a 40000 wallet to refuse 50000, got %v", err)
+	}
+
+	gw.chargeStatus = PaymentCaptured
+	if _, err := wallets.TopUp(ctx, "u1", money.Rupiah(100000)); err != nil {
+		t.Fatalf("second top up: %v", err)
+	}
+	if _, err := svc.PayFromWallet(ctx, "o2", "u1", money.Rupiah(50000), money.Rupiah(0)); !errors.Is(err, ledger.ErrSpendLimitExceeded) {
+		t.Fatalf("expected PELUANG_KEDUA to stop at 100000 a day, got %v", err)
+	}
+	trust["u1"] = "PAHLAWAN"
+	if _, err := svc.PayFromWallet(ctx, "o2", "u1", money.Rupiah(50000), money.Rupiah(0)); err != nil {
+		t.Fatalf("a higher tier may spend more: %v", err)
+	}
+	if _, err := svc.LockFunds(ctx, "o2", "u1", money.Rupiah(50000), money.Rupiah(0)); !errors.Is(err, ErrPaidElsewhere) {
+		t.Fatalf("expected a wallet-paid order not to be charged again, got %v", err)
+	}
+
+	// Refunding a wallet payment never touches the gateway
+	if err := svc.RefundFunds(ctx, "o1", "u1"); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if got := balance(); got.Units() != 150000 {
+		t.Fatalf("expected 60000 back in the wallet, got %s", got)
+	}
+
+	// A card payment with instant refunds on comes back as wallet credit
+	if err := wallets.SetInstantRefunds(ctx, "u1", true); err != nil {
+		t.Fatalf("settings: %v", err)
+	}
+	if _, err := svc.LockFunds(ctx, "o3", "u1", money.Rupiah(30000), money.Rupiah(0)); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if err := svc.RefundFunds(ctx, "o3", "u1"); err != nil {
+		t.Fatalf("instant refund: %v", err)
+	}
+	if err := svc.RefundFunds(ctx, "o3", "u1"); err != nil {
+		t.Fatalf("repeat refund: %v", err)
+	}
+	if got := balance(); got.Units() != 180000 {
+		t.Fatalf("expected the card payment credited to the wallet, got %s", got)
+	}
+	if gw.refunded != 0 {
+		t.Fatalf("expected no gateway refunds, got %d", gw.refunded)
+	}
+	if p, _ := payments.Get(ctx, "o3"); p.Status != PaymentRefundedToWallet {
+		t.Fatalf("expected o3 refunded to the wallet, got %s", p.Status)
+	}
+	if _, err := journal.CheckInvariant(ctx); err != nil {
+		t.Fatalf("invariant: %v", err)
+	}
+}
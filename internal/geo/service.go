@@ -14,8 +14,9 @@ type GeoService struct {
 }
 
 const (
-	UserLocationsKey = "geo:user_locations"
-	GeoExpiry        = 24 * time.Hour // User location expires after 24h
+	UserLocationsKey    = "geo:user_locations"
+	CourierLocationsKey = "geo:courier_locations"
+	GeoExpiry           = 24 * time.Hour // User location expires after 24h
 )
 
 func NewGeoService(redisClient *redis.Client) *GeoService {
@@ -62,3 +63,67 @@ func (s *GeoService) FindUsersNearby(ctx context.Context, lat, lon, radiusMeters
 
 	return userIDs, nil
 }
+
+// CourierLocation is a courier position returned by radius queries
+type CourierLocation struct {
+	CourierID      string  `json:"courier_id"`
+	Lat            float64 `json:"lat"`
+	Lon            float64 `json:"lon"`
+	DistanceMeters float64 `json:"distance_meters"`
+}
+
+// UpdateCourierLocation records a courier's live GPS ping (called by the courier app while on shift)
+func (s *GeoService) UpdateCourierLocation(ctx context.Context, courierID string, lat, lon float64) error {
+	return s.redis.GeoAdd(ctx, CourierLocationsKey, &redis.GeoLocation{
+		Name:      courierID,
+		Latitude:  lat,
+		Longitude: lon,
+	}).Err()
+}
+
+// RemoveCourierLocation drops an off-shift courier from the dispatch index
+func (s *GeoService) RemoveCourierLocation(ctx context.Context, courierID string) error {
+	return s.redis.ZRem(ctx, CourierLocationsKey, courierID).Err()
+}
+
+// GetCourierLocation returns the last known position of a courier
+func (s *GeoService) GetCourierLocation(ctx context.Context, courierID string) (*CourierLocation, error) {
+	positions, err := s.redis.GeoPos(ctx, CourierLocationsKey, courierID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis geo error: %w", err)
+	}
+	if len(positions) == 0 || positions[0] == nil {
+		return nil, fmt.Errorf("no location for courier %s", courierID)
+	}
+	return &CourierLocation{
+		CourierID: courierID,
+		Lat:       positions[0].Latitude,
+		Lon:       positions[0].Longitude,
+	}, nil
+}
+
+// FindCouriersNearby returns couriers within `radius` meters of (lat, lon), closest first
+func (s *GeoService) FindCouriersNearby(ctx context.Context, lat, lon, radiusMeters float64) ([]CourierLocation, error) {
+	locations, err := s.redis.GeoRadius(ctx, CourierLocationsKey, lon, lat, &redis.GeoRadiusQuery{
+		Radius:    radiusMeters,
+		Unit:      "m",
+		WithCoord: true,
+		WithDist:  true,
+		Count:     50, // Dispatch only ever needs the closest handful
+		Sort:      "ASC",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis geo error: %w", err)
+	}
+
+	couriers := make([]CourierLocation, len(locations))
+	for i, loc := range locations {
+		couriers[i] = CourierLocation{
+			CourierID:      loc.Name,
+			Lat:            loc.Latitude,
+			Lon:            loc.Longitude,
+			DistanceMeters: loc.Dist,
+		}
+	}
+	return couriers, nil
+}
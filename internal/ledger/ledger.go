@@ -0,0 +1,219 @@
+// Package ledger is the platform's double-entry book of record. Every rupiah
+// that moves (buyer payments into escrow, releases to providers, courier fees,
+// vouchers, refunds and payouts) is a journal entry whose debits equal its
+// credits. Amounts are integer rupiah; there are no fractional sen.
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnbalancedEntry    = errors.New("journal entry debits do not equal credits")
+	ErrEntryNotFound      = errors.New("journal entry not found")
+	ErrLedgerUnbalanced   = errors.New("ledger debits do not equal credits")
+	ErrInsufficientFunds  = errors.New("insufficient wallet balance")
+	ErrSpendLimitExceeded = errors.New("wallet spend limit exceeded")
+)
+
+// AccountType decides which side increases an account's balance
+type AccountType string
+
+const (
+	Asset     AccountType = "asset"     // Debit-normal: money we hold or are owed
+	Liability AccountType = "liability" // Credit-normal: money we owe someone
+	Revenue   AccountType = "revenue"   // Credit-normal
+	Expense   AccountType = "expense"   // Debit-normal
+)
+
+// Account is a ledger account code such as "escrow_holding:ORDER-1"
+type Account string
+
+// Account families; the part after the colon names the owner
+const (
+	familyBuyerWallet     = "buyer_wallet"
+	familyEscrowHolding   = "escrow_holding"
+	familyProviderPayable = "provider_payable"
+	familyCourierPayable  = "courier_payable"
+	familyGatewayClearing = "gateway_clearing"
+
+	PlatformRevenue Account = "platform_revenue"
+	PromoBudget     Account = "promo_budget" // Vouchers and delivery subsidies the platform pays for
+)
+
+var accountTypes = map[string]AccountType{
+	familyBuyerWallet:       Liability,
+	familyEscrowHolding:     Liability,
+	familyProviderPayable:   Liability,
+	familyCourierPayable:    Liability,
+	familyGatewayClearing:   Asset,
+	string(PlatformRevenue): Revenue,
+	string(PromoBudget):     Expense,
+}
+
+// BuyerWallet is stored value a buyer (or recipient NGO) holds with us
+func BuyerWallet(userID string) Account { return Account(familyBuyerWallet + ":" + userID) }
+
+// EscrowHolding is money locked for one order until delivery is verified
+func EscrowHolding(orderID string) Account { return Account(familyEscrowHolding + ":" + orderID) }
+
+// ProviderPayable is what we owe a provider for released orders
+func ProviderPayable(providerID string) Account {
+	return Account(familyProviderPayable + ":" + providerID)
+}
+
+// CourierPayable is what we owe a courier for completed deliveries
+func CourierPayable(courierID string) Account { return Account(familyCourierPayable + ":" + courierID) }
+
+// GatewayClearing is money sitting with a payment gateway on our behalf
+func GatewayClearing(gateway string) Account { return Account(familyGatewayClearing + ":" + gateway) }
+
+// Type is the account's type; false for codes outside the chart of accounts
+func (a Account) Type() (AccountType, bool) {
+	family, _, _ := strings.Cut(string(a), ":")
+	t, ok := accountTypes[family]
+	return t, ok
+}
+
+// Side of a journal line
+type Side string
+
+const (
+	Debit  Side = "debit"
+	Credit Side = "credit"
+)
+
+// Line moves Amount rupiah on one side of one account
+type Line struct {
+	Account Account `json:"account"`
+	Side    Side    `json:"side"`
+	Amount  int64   `json:"amount"`
+}
+
+// EntryKind says what business event an entry records
+type EntryKind string
+
+const (
+	KindPaymentCollected EntryKind = "payment_collected" // Buyer paid (plus voucher) into escrow
+	KindEscrowReleased   EntryKind = "escrow_released"   // Escrow split to provider, courier and platform
+	KindEscrowRefunded   EntryKind = "escrow_refunded"   // Escrow returned to where it came from
+	KindDeliveryFee      EntryKind = "delivery_fee"      // Recipient (and subsidy) paid the courier and platform
+	KindPayout           EntryKind = "payout"            // Money left through the gateway
+	KindWalletTopUp      EntryKind = "wallet_top_up"     // Buyer loaded their wallet through the gateway
+	KindCashback         EntryKind = "cashback"          // Campaign cashback paid into a wallet from the promo budget
+)
+
+// Entry is one balanced, immutable journal entry. Reference makes posting
+// idempotent: the same business event always produces the same reference.
+type Entry struct {
+	ID        string    `json:"id"`
+	Reference string    `json:"reference"`
+	Kind      EntryKind `json:"kind"`
+	OrderID   string    `json:"order_id,omitempty"`
+	Memo      string    `json:"memo,omitempty"`
+	Lines     []Line    `json:"lines"`
+	PostedAt  time.Time `json:"posted_at"`
+}
+
+// Validate checks the entry before it can reach the book
+func (e *Entry) Validate() error {
+	if e.Reference == "" {
+		return fmt.Errorf("journal entry has no reference")
+	}
+	if len(e.Lines) < 2 {
+		return fmt.Errorf("%w: %s has %d line(s)", ErrUnbalancedEntry, e.Reference, len(e.Lines))
+	}
+	var debits, credits int64
+	for _, l := range e.Lines {
+		if _, ok := l.Account.Type(); !ok {
+			return fmt.Errorf("journal entry %s: unknown account %q", e.Reference, l.Account)
+		}
+		if l.Amount <= 0 {
+			return fmt.Errorf("journal entry %s: %s amount must be positive, got %d", e.Reference, l.Account, l.Amount)
+		}
+		switch l.Side {
+		case Debit:
+			debits += l.Amount
+		case Credit:
+			credits += l.Amount
+		default:
+			return fmt.Errorf("journal entry %s: invalid side %q", e.Reference, l.Side)
+		}
+	}
+	if debits != credits {
+		return fmt.Errorf("%w: %s debits %d, credits %d", ErrUnbalancedEntry, e.Reference, debits, credits)
+	}
+	return nil
+}
+
+// Balance is an account's totals; Net is signed by the account's normal side
+type Balance struct {
+	Account Account `json:"account"`
+	Debits  int64   `json:"debits"`
+	Credits int64   `json:"credits"`
+	Net     int64   `json:"net"`
+}
+
+func NewBalance(account Account, debits, credits int64) Balance {
+	b := Balance{Account: account, Debits: debits, Credits: credits, Net: credits - debits}
+	if t, _ := account.Type(); t == Asset || t == Expense {
+		b.Net = debits - credits
+	}
+	return b
+}
+
+// TrialBalance is the whole book summed up. Balanced means total debits equal
+// total credits and no single entry is out of balance.
+type TrialBalance struct {
+	Debits     int64     `json:"debits"`
+	Credits    int64     `json:"credits"`
+	Entries    int       `json:"entries"`
+	Unbalanced []string  `json:"unbalanced,omitempty"` // References of entries that do not balance
+	Balanced   bool      `json:"balanced"`
+	AsOf       time.Time `json:"as_of"`
+}
+
+// SpendLimit caps what a wallet may spend from Since on; zero Max means no cap
+type SpendLimit struct {
+	Since time.Time
+	Max   int64
+}
+
+// Posting is one line of an account's history, with the entry it belongs to
+type Posting struct {
+	Reference string    `json:"reference"`
+	Kind      EntryKind `json:"kind"`
+	OrderID   string    `json:"order_id,omitempty"`
+	Memo      string    `json:"memo,omitempty"`
+	Side      Side      `json:"side"`
+	Amount    int64     `json:"amount"`
+	PostedAt  time.Time `json:"posted_at"`
+}
+
+type Repository interface {
+	// Post stores the entry and its lines atomically; false when the reference
+	// was already posted
+	Post(ctx context.Context, e *Entry) (bool, error)
+	// PostWithin posts an entry drawing down a liability account only if the
+	// account stays non-negative and its debits since limit.Since stay within
+	// limit.Max. Posts to the same account are serialised so two spends
+	// cannot both pass the check.
+	PostWithin(ctx context.Context, e *Entry, account Account, limit SpendLimit) (bool, error)
+	Entry(ctx context.Context, reference string) (*Entry, error)
+	Balance(ctx context.Context, account Account) (Balance, error)
+	// Debits sums what was taken out of the account since the given time
+	Debits(ctx context.Context, account Account, since time.Time) (int64, error)
+	// Postings lists the account's lines, newest first
+	Postings(ctx context.Context, account Account, limit int) ([]Posting, error)
+	TrialBalance(ctx context.Context) (*TrialBalance, error)
+}
+
+// Rupiah converts a legacy float IDR amount to whole rupiah
+func Rupiah(idr float64) int64 {
+	return int64(math.Round(idr))
+}
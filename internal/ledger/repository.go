@@ -0,0 +1,401 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository stores the journal in journal_entries/journal_lines.
+// A deferred constraint trigger re-checks every entry's balance at commit.
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) Post(ctx context.Context, e *Entry) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	created, err := insertEntry(ctx, tx, e)
+	if err != nil || !created {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// PostWithin takes a transaction-scoped advisory lock on the account, so the
+// balance and spend it checks cannot change before the entry lands
+func (r *postgresRepository) PostWithin(ctx context.Context, e *Entry, account Account, limit SpendLimit) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, account); err != nil {
+		return false, err
+	}
+	var posted bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM journal_entries WHERE reference = $1)
+	`, e.Reference).Scan(&posted); err != nil {
+		return false, err
+	}
+	if posted {
+		return false, nil
+	}
+
+	var debits, credits, spent int64
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(l.debit), 0), COALESCE(SUM(l.credit), 0),
+		       COALESCE(SUM(l.debit) FILTER (WHERE e.posted_at >= $2), 0)
+		FROM journal_lines l
+		JOIN journal_entries e ON e.id = l.entry_id
+		WHERE l.account = $1
+	`, account, limit.Since.UTC()).Scan(&debits, &credits, &spent); err != nil {
+		return false, err
+	}
+	if err := checkSpend(e, account, NewBalance(account, debits, credits), spent, limit); err != nil {
+		return false, err
+	}
+
+	created, err := insertEntry(ctx, tx, e)
+	if err != nil || !created {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func insertEntry(ctx context.Context, tx *sql.Tx, e *Entry) (bool, error) {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO journal_entries (id, reference, kind, order_id, memo)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		ON CONFLICT (reference) DO NOTHING
+		RETURNING posted_at
+	`, e.ID, e.Reference, e.Kind, e.OrderID, e.Memo).Scan(&e.PostedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, l := range e.Lines {
+		t, _ := l.Account.Type()
+		var debit, credit int64
+		if l.Side == Debit {
+			debit = l.Amount
+		} else {
+			credit = l.Amount
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO journal_lines (entry_id, account, account_type, debit, credit)
+			VALUES ($1, $2, $3, $4, $5)
+		`, e.ID, l.Account, t, debit, credit); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// checkSpend refuses an entry that would overdraw the account or take its
+// spending since limit.Since past limit.Max
+func checkSpend(e *Entry, account Account, current Balance, spent int64, limit SpendLimit) error {
+	var out, in int64
+	for _, l := range e.Lines {
+		if l.Account != account {
+			continue
+		}
+		if l.Side == Debit {
+			out += l.Amount
+		} else {
+			in += l.Amount
+		}
+	}
+	if current.Net+in-out < 0 {
+		return fmt.Errorf("%w: %s holds %d, %s takes %d", ErrInsufficientFunds, account, current.Net, e.Reference, out-in)
+	}
+	if limit.Max > 0 && spent+out > limit.Max {
+		return fmt.Errorf("%w: %s spent %d of %d, %s takes %d", ErrSpendLimitExceeded, account, spent, limit.Max, e.Reference, out)
+	}
+	return nil
+}
+
+func (r *postgresRepository) Entry(ctx context.Context, reference string) (*Entry, error) {
+	var e Entry
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, reference, kind, COALESCE(order_id, ''), memo, posted_at
+		FROM journal_entries
+		WHERE reference = $1
+	`, reference).Scan(&e.ID, &e.Reference, &e.Kind, &e.OrderID, &e.Memo, &e.PostedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrEntryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT account, debit, credit FROM journal_lines WHERE entry_id = $1 ORDER BY id
+	`, e.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var l Line
+		var debit, credit int64
+		if err := rows.Scan(&l.Account, &debit, &credit); err != nil {
+			return nil, err
+		}
+		l.Side, l.Amount = Credit, credit
+		if debit > 0 {
+			l.Side, l.Amount = Debit, debit
+		}
+		e.Lines = append(e.Lines, l)
+	}
+	return &e, rows.Err()
+}
+
+func (r *postgresRepository) Balance(ctx context.Context, account Account) (Balance, error) {
+	var debits, credits int64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(debit), 0), COALESCE(SUM(credit), 0)
+		FROM journal_lines
+		WHERE account = $1
+	`, account).Scan(&debits, &credits)
+	if err != nil {
+		return Balance{}, err
+	}
+	return NewBalance(account, debits, credits), nil
+}
+
+func (r *postgresRepository) Debits(ctx context.Context, account Account, since time.Time) (int64, error) {
+	var debits int64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(l.debit), 0)
+		FROM journal_lines l
+		JOIN journal_entries e ON e.id = l.entry_id
+		WHERE l.account = $1 AND e.posted_at >= $2
+	`, account, since.UTC()).Scan(&debits)
+	return debits, err
+}
+
+func (r *postgresRepository) Postings(ctx context.Context, account Account, limit int) ([]Posting, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT e.reference, e.kind, COALESCE(e.order_id, ''), e.memo, l.debit, l.credit, e.posted_at
+		FROM journal_lines l
+		JOIN journal_entries e ON e.id = l.entry_id
+		WHERE l.account = $1
+		ORDER BY e.posted_at DESC, l.id DESC
+		LIMIT $2
+	`, account, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []Posting
+	for rows.Next() {
+		var p Posting
+		var debit, credit int64
+		if err := rows.Scan(&p.Reference, &p.Kind, &p.OrderID, &p.Memo, &debit, &credit, &p.PostedAt); err != nil {
+			return nil, err
+		}
+		p.Side, p.Amount = Credit, credit
+		if debit > 0 {
+			p.Side, p.Amount = Debit, debit
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (r *postgresRepository) TrialBalance(ctx context.Context) (*TrialBalance, error) {
+	tb := &TrialBalance{AsOf: time.Now()}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(debit), 0), COALESCE(SUM(credit), 0), COUNT(DISTINCT entry_id)
+		FROM journal_lines
+	`).Scan(&tb.Debits, &tb.Credits, &tb.Entries)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT e.reference
+		FROM journal_lines l
+		JOIN journal_entries e ON e.id = l.entry_id
+		GROUP BY e.reference
+		HAVING SUM(l.debit) <> SUM(l.credit)
+		ORDER BY e.reference
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var ref string
+		if err := rows.Scan(&ref); err != nil {
+			return nil, err
+		}
+		tb.Unbalanced = append(tb.Unbalanced, ref)
+	}
+	tb.Balanced = tb.Debits == tb.Credits && len(tb.Unbalanced) == 0
+	return tb, rows.Err()
+}
+
+type memoryRepository struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	order   []string // References in posting order
+}
+
+// NewMemoryRepository is a journal for the demo server and tests. Nothing
+// survives a restart.
+func NewMemoryRepository() Repository {
+	return &memoryRepository{entries: make(map[string]Entry)}
+}
+
+func (r *memoryRepository) Post(ctx context.Context, e *Entry) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.insert(e), nil
+}
+
+func (r *memoryRepository) PostWithin(ctx context.Context, e *Entry, account Account, limit SpendLimit) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.entries[e.Reference]; ok {
+		return false, nil
+	}
+	if err := checkSpend(e, account, r.balance(account), r.debits(account, limit.Since), limit); err != nil {
+		return false, err
+	}
+	return r.insert(e), nil
+}
+
+func (r *memoryRepository) insert(e *Entry) bool {
+	if _, ok := r.entries[e.Reference]; ok {
+		return false
+	}
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	e.PostedAt = time.Now()
+	stored := *e
+	stored.Lines = append([]Line(nil), e.Lines...)
+	r.entries[e.Reference] = stored
+	r.order = append(r.order, e.Reference)
+	return true
+}
+
+func (r *memoryRepository) Entry(ctx context.Context, reference string) (*Entry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[reference]
+	if !ok {
+		return nil, ErrEntryNotFound
+	}
+	e.Lines = append([]Line(nil), e.Lines...)
+	return &e, nil
+}
+
+func (r *memoryRepository) Balance(ctx context.Context, account Account) (Balance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.balance(account), nil
+}
+
+func (r *memoryRepository) balance(account Account) Balance {
+	var debits, credits int64
+	for _, e := range r.entries {
+		for _, l := range e.Lines {
+			if l.Account != account {
+				continue
+			}
+			if l.Side == Debit {
+				debits += l.Amount
+			} else {
+				credits += l.Amount
+			}
+		}
+	}
+	return NewBalance(account, debits, credits)
+}
+
+func (r *memoryRepository) Debits(ctx context.Context, account Account, since time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.debits(account, since), nil
+}
+
+func (r *memoryRepository) debits(account Account, since time.Time) int64 {
+	var debits int64
+	for _, e := range r.entries {
+		if e.PostedAt.Before(since) {
+			continue
+		}
+		for _, l := range e.Lines {
+			if l.Account == account && l.Side == Debit {
+				debits += l.Amount
+			}
+		}
+	}
+	return debits
+}
+
+func (r *memoryRepository) Postings(ctx context.Context, account Account, limit int) ([]Posting, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Posting
+	for i := len(r.order) - 1; i >= 0 && len(out) < limit; i-- {
+		e := r.entries[r.order[i]]
+		for _, l := range e.Lines {
+			if l.Account == account && len(out) < limit {
+				out = append(out, Posting{Reference: e.Reference, Kind: e.Kind, OrderID: e.OrderID, Memo: e.Memo,
+					Side: l.Side, Amount: l.Amount, PostedAt: e.PostedAt})
+			}
+		}
+	}
+	return out, nil
+}
+
+func (r *memoryRepository) TrialBalance(ctx context.Context) (*TrialBalance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tb := &TrialBalance{AsOf: time.Now(), Entries: len(r.entries)}
+	for ref, e := range r.entries {
+		var debits, credits int64
+		for _, l := range e.Lines {
+			if l.Side == Debit {
+				debits += l.Amount
+			} else {
+				credits += l.Amount
+			}
+		}
+		tb.Debits += debits
+		tb.Credits += credits
+		if debits != credits {
+			tb.Unbalanced = append(tb.Unbalanced, ref)
+		}
+	}
+	sort.Strings(tb.Unbalanced)
+	tb.Balanced = tb.Debits == tb.Credits && len(tb.Unbalanced) == 0
+	return tb, nil
+}
@@ -0,0 +1,353 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Service turns business events into balanced journal entries. Each event has
+// a fixed reference, so retries and redelivered messages post nothing twice.
+type Service struct {
+	repo   Repository
+	logger *zap.Logger
+}
+
+func NewService(repo Repository, logger *zap.Logger) *Service {
+	return &Service{repo: repo, logger: logger}
+}
+
+// Collection is a buyer paying for an order into escrow. Voucher is the part
+// of the order value the platform pays for.
+type Collection struct {
+	OrderID string
+	Gateway string
+	BuyerID string
+	Paid    int64 // Taken from the buyer through the gateway
+	Voucher int64
+}
+
+// Split divides released escrow; the parts must add up to what the order holds
+type Split struct {
+	ProviderID string
+	Provider   int64
+	CourierID  string
+	Courier    int64
+	Platform   int64
+}
+
+// SplitRelease gives the platform its commission (in basis points, rounded
+// down) and the provider the rest
+func SplitRelease(total int64, providerID string, commissionBps int64) Split {
+	platform := total * commissionBps / 10000
+	return Split{ProviderID: providerID, Provider: total - platform, Platform: platform}
+}
+
+// DeliveryFee is a completed courier trip. The recipient's wallet and the
+// subsidy budget pay the fee; the courier and the platform share it.
+type DeliveryFee struct {
+	DeliveryID     string
+	CourierID      string
+	RecipientID    string
+	RecipientPays  int64
+	Subsidy        int64
+	CourierEarning int64
+}
+
+// Cashback is campaign money paid into a buyer's wallet. Each campaign pays
+// a buyer once per order, or once overall without an order.
+type Cashback struct {
+	CampaignID string
+	UserID     string
+	OrderID    string
+	Amount     int64
+}
+
+func (c Cashback) reference() string {
+	ref := "cashback/" + c.CampaignID + "/" + c.UserID
+	if c.OrderID != "" {
+		ref += "/" + c.OrderID
+	}
+	return ref
+}
+
+func collectedRef(orderID string) string { return "escrow/" + orderID + "/collected" }
+func releasedRef(orderID string) string  { return "escrow/" + orderID + "/released" }
+func refundedRef(orderID string) string  { return "escrow/" + orderID + "/refunded" }
+func partialRef(orderID string) string   { return "escrow/" + orderID + "/partially-refunded" }
+
+// CollectPayment locks the buyer's payment and any voucher in the order's escrow account
+func (s *Service) CollectPayment(ctx context.Context, c Collection) error {
+	return s.post(ctx, &Entry{
+		Reference: collectedRef(c.OrderID),
+		Kind:      KindPaymentCollected,
+		OrderID:   c.OrderID,
+		Memo:      "buyer " + c.BuyerID,
+		Lines: lines(
+			Line{GatewayClearing(c.Gateway), Debit, c.Paid},
+			Line{PromoBudget, Debit, c.Voucher},
+			Line{EscrowHolding(c.OrderID), Credit, c.Paid + c.Voucher},
+		),
+	})
+}
+
+// CollectFromWallet locks an order paid from the buyer's wallet (plus any
+// voucher) in escrow. ErrInsufficientFunds or ErrSpendLimitExceeded when the
+// wallet cannot cover it; retrying a booked collection posts nothing.
+func (s *Service) CollectFromWallet(ctx context.Context, c Collection, limit SpendLimit) error {
+	return s.postWithin(ctx, &Entry{
+		Reference: collectedRef(c.OrderID),
+		Kind:      KindPaymentCollected,
+		OrderID:   c.OrderID,
+		Memo:      "buyer " + c.BuyerID + " wallet",
+		Lines: lines(
+			Line{BuyerWallet(c.BuyerID), Debit, c.Paid},
+			Line{PromoBudget, Debit, c.Voucher},
+			Line{EscrowHolding(c.OrderID), Credit, c.Paid + c.Voucher},
+		),
+	}, BuyerWallet(c.BuyerID), limit)
+}
+
+// TopUpWallet books a buyer's gateway top-up as stored value we owe them
+func (s *Service) TopUpWallet(ctx context.Context, topUpID, userID, gateway string, amount int64) error {
+	return s.post(ctx, &Entry{
+		Reference: "wallet/topup/" + topUpID,
+		Kind:      KindWalletTopUp,
+		Memo:      "buyer " + userID,
+		Lines: []Line{
+			{GatewayClearing(gateway), Debit, amount},
+			{BuyerWallet(userID), Credit, amount},
+		},
+	})
+}
+
+// CreditCashback pays campaign cashback into the buyer's wallet out of the promo budget
+func (s *Service) CreditCashback(ctx context.Context, c Cashback) error {
+	return s.post(ctx, &Entry{
+		Reference: c.reference(),
+		Kind:      KindCashback,
+		OrderID:   c.OrderID,
+		Memo:      "campaign " + c.CampaignID,
+		Lines: []Line{
+			{PromoBudget, Debit, c.Amount},
+			{BuyerWallet(c.UserID), Credit, c.Amount},
+		},
+	})
+}
+
+// ReleaseEscrow empties the order's escrow into the payables and platform
+// revenue. ErrEntryNotFound when the collection was never booked.
+func (s *Service) ReleaseEscrow(ctx context.Context, orderID string, split Split) error {
+	if _, err := s.repo.Entry(ctx, releasedRef(orderID)); err == nil {
+		return nil
+	} else if !errors.Is(err, ErrEntryNotFound) {
+		return err
+	}
+	if _, err := s.repo.Entry(ctx, collectedRef(orderID)); err != nil {
+		return err
+	}
+	held, err := s.repo.Balance(ctx, EscrowHolding(orderID))
+	if err != nil {
+		return err
+	}
+	if total := split.Provider + split.Courier + split.Platform; total != held.Net {
+		return fmt.Errorf("%w: releasing %d of escrow %s holding %d", ErrUnbalancedEntry, total, orderID, held.Net)
+	}
+
+	release := []Line{
+		{EscrowHolding(orderID), Debit, held.Net},
+		{ProviderPayable(split.ProviderID), Credit, split.Provider},
+		{PlatformRevenue, Credit, split.Platform},
+	}
+	if split.CourierID != "" {
+		release = append(release, Line{CourierPayable(split.CourierID), Credit, split.Courier})
+	}
+	return s.post(ctx, &Entry{
+		Reference: releasedRef(orderID),
+		Kind:      KindEscrowReleased,
+		OrderID:   orderID,
+		Lines:     lines(release...),
+	})
+}
+
+// RefundEscrow reverses the order's collection: the buyer's money goes back
+// the way it came (gateway or wallet) and the voucher back to the promo budget.
+// ErrEntryNotFound when the collection was never booked.
+func (s *Service) RefundEscrow(ctx context.Context, orderID, memo string) error {
+	return s.refund(ctx, orderID, "", memo)
+}
+
+// RefundEscrowToWallet reverses the order's collection like RefundEscrow, but
+// what the buyer paid through the gateway lands in their wallet instead
+func (s *Service) RefundEscrowToWallet(ctx context.Context, orderID, buyerID, memo string) error {
+	return s.refund(ctx, orderID, buyerID, memo)
+}
+
+func (s *Service) refund(ctx context.Context, orderID, walletOwner, memo string) error {
+	collected, err := s.repo.Entry(ctx, collectedRef(orderID))
+	if err != nil {
+		return err
+	}
+	reversed := make([]Line, len(collected.Lines))
+	for i, l := range collected.Lines {
+		l.Side = Debit
+		if collected.Lines[i].Side == Debit {
+			l.Side = Credit
+		}
+		if walletOwner != "" && strings.HasPrefix(string(l.Account), familyGatewayClearing+":") {
+			l.Account = BuyerWallet(walletOwner)
+		}
+		reversed[i] = l
+	}
+	return s.post(ctx, &Entry{
+		Reference: refundedRef(orderID),
+		Kind:      KindEscrowRefunded,
+		OrderID:   orderID,
+		Memo:      memo,
+		Lines:     reversed,
+	})
+}
+
+// PartialRefund returns part of the order's escrow to the buyer through the
+// gateway or wallet it was paid with; the rest stays held for release. The buyer can get
+// back at most what they paid, never the voucher. ErrEntryNotFound when the
+// collection was never booked.
+func (s *Service) PartialRefund(ctx context.Context, orderID string, amount int64, memo string) error {
+	collected, err := s.repo.Entry(ctx, collectedRef(orderID))
+	if err != nil {
+		return err
+	}
+	for _, l := range collected.Lines {
+		if l.Side != Debit || l.Account == PromoBudget {
+			continue
+		}
+		if amount <= 0 || amount > l.Amount {
+			return fmt.Errorf("%w: partial refund %d of %d paid for %s", ErrUnbalancedEntry, amount, l.Amount, orderID)
+		}
+		return s.post(ctx, &Entry{
+			Reference: partialRef(orderID),
+			Kind:      KindEscrowRefunded,
+			OrderID:   orderID,
+			Memo:      memo,
+			Lines: []Line{
+				{EscrowHolding(orderID), Debit, amount},
+				{l.Account, Credit, amount},
+			},
+		})
+	}
+	return fmt.Errorf("%w: the buyer paid nothing for %s", ErrUnbalancedEntry, orderID)
+}
+
+// RecordDeliveryFee books a completed trip's fee; the platform keeps what the courier does not earn
+func (s *Service) RecordDeliveryFee(ctx context.Context, f DeliveryFee) error {
+	platform := f.RecipientPays + f.Subsidy - f.CourierEarning
+	if platform < 0 {
+		return fmt.Errorf("%w: delivery %s pays the courier %d out of %d", ErrUnbalancedEntry, f.DeliveryID, f.CourierEarning, f.RecipientPays+f.Subsidy)
+	}
+	return s.post(ctx, &Entry{
+		Reference: "delivery/" + f.DeliveryID + "/fee",
+		Kind:      KindDeliveryFee,
+		Lines: lines(
+			Line{BuyerWallet(f.RecipientID), Debit, f.RecipientPays},
+			Line{PromoBudget, Debit, f.Subsidy},
+			Line{CourierPayable(f.CourierID), Credit, f.CourierEarning},
+			Line{PlatformRevenue, Credit, platform},
+		),
+	})
+}
+
+// PayOutRelease books the provider's share of a released order leaving through the gateway
+func (s *Service) PayOutRelease(ctx context.Context, orderID, gateway string) error {
+	released, err := s.repo.Entry(ctx, releasedRef(orderID))
+	if err != nil {
+		return err
+	}
+	for _, l := range released.Lines {
+		if strings.HasPrefix(string(l.Account), familyProviderPayable+":") {
+			return s.Payout(ctx, "escrow/"+orderID, l.Account, gateway, l.Amount)
+		}
+	}
+	return nil
+}
+
+// Payout books money leaving a payable through the gateway
+func (s *Service) Payout(ctx context.Context, reference string, payable Account, gateway string, amount int64) error {
+	return s.post(ctx, &Entry{
+		Reference: "payout/" + reference,
+		Kind:      KindPayout,
+		Lines: lines(
+			Line{payable, Debit, amount},
+			Line{GatewayClearing(gateway), Credit, amount},
+		),
+	})
+}
+
+func (s *Service) Balance(ctx context.Context, account Account) (Balance, error) {
+	return s.repo.Balance(ctx, account)
+}
+
+// Spent is what left the account since the given time
+func (s *Service) Spent(ctx context.Context, account Account, since time.Time) (int64, error) {
+	return s.repo.Debits(ctx, account, since)
+}
+
+// History is the account's most recent postings, newest first
+func (s *Service) History(ctx context.Context, account Account, limit int) ([]Posting, error) {
+	return s.repo.Postings(ctx, account, limit)
+}
+
+// CheckInvariant proves the book balances: total debits equal total credits
+// and so does every entry. ErrLedgerUnbalanced otherwise.
+func (s *Service) CheckInvariant(ctx context.Context) (*TrialBalance, error) {
+	tb, err := s.repo.TrialBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !tb.Balanced {
+		return tb, fmt.Errorf("%w: debits %d, credits %d, %d unbalanced entries",
+			ErrLedgerUnbalanced, tb.Debits, tb.Credits, len(tb.Unbalanced))
+	}
+	return tb, nil
+}
+
+func (s *Service) post(ctx context.Context, e *Entry) error {
+	return s.postWithin(ctx, e, "", SpendLimit{})
+}
+
+// postWithin guards the entry's draw on a wallet account; unguarded without one
+func (s *Service) postWithin(ctx context.Context, e *Entry, wallet Account, limit SpendLimit) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	var created bool
+	var err error
+	if wallet == "" {
+		created, err = s.repo.Post(ctx, e)
+	} else {
+		created, err = s.repo.PostWithin(ctx, e, wallet, limit)
+	}
+	if err != nil {
+		return err
+	}
+	if created {
+		s.logger.Info("Journal entry posted",
+			zap.String("reference", e.Reference),
+			zap.String("kind", string(e.Kind)))
+	}
+	return nil
+}
+
+// lines drops zero legs (no voucher, no subsidy) so entries only carry real movements
+func lines(all ...Line) []Line {
+	kept := make([]Line, 0, len(all))
+	for _, l := range all {
+		if l.Amount != 0 {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
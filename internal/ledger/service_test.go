@@ -0,0 +1,193 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func balanceOf(t *testing.T, s *Service, a Account) int64 {
+	t.Helper()
+	b, err := s.Balance(context.Background(), a)
+	if err != nil {
+		t.Fatalf("balance %s: %v", a, err)
+	}
+	return b.Net
+}
+
+func TestLedger_VoucherOrderReleasedAndPaidOut(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(NewMemoryRepository(), zap.NewNop())
+
+	// 50,000 order: buyer pays 35,000, the PAHLAWANBARU voucher covers 15,000
+	c := Collection{OrderID: "o1", Gateway: "fake", BuyerID: "u1", Paid: 35000, Voucher: 15000}
+	for i := 0; i < 2; i++ { // Redelivered events post nothing twice
+		if err := s.CollectPayment(ctx, c); err != nil {
+			t.Fatalf("collect: %v", err)
+		}
+	}
+	if got := balanceOf(t, s, EscrowHolding("o1")); got != 50000 {
+		t.Fatalf("expected 50000 held, got %d", got)
+	}
+
+	if err := s.ReleaseEscrow(ctx, "o1", SplitRelease(49999, "p1", 1000)); !errors.Is(err, ErrUnbalancedEntry) {
+		t.Fatalf("a split that leaves money in escrow must be refused, got %v", err)
+	}
+	split := SplitRelease(50000, "p1", 1000)
+	if split.Platform != 5000 || split.Provider != 45000 {
+		t.Fatalf("unexpected split %+v", split)
+	}
+	if err := s.ReleaseEscrow(ctx, "o1", split); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if err := s.ReleaseEscrow(ctx, "o1", split); err != nil {
+		t.Fatalf("repeat release: %v", err)
+	}
+	if err := s.PayOutRelease(ctx, "o1", "fake"); err != nil {
+		t.Fatalf("payout: %v", err)
+	}
+
+	want := map[Account]int64{
+		EscrowHolding("o1"):     0,
+		ProviderPayable("p1"):   0,
+		PlatformRevenue:         5000,
+		PromoBudget:             15000,
+		GatewayClearing("fake"): -10000, // Took 35,000 in, paid 45,000 out: the promo budget funds the gap
+	}
+	for account, net := range want {
+		if got := balanceOf(t, s, account); got != net {
+			t.Errorf("%s: expected %d, got %d", account, net, got)
+		}
+	}
+
+	tb, err := s.CheckInvariant(ctx)
+	if err != nil {
+		t.Fatalf("invariant: %v", err)
+	}
+	if tb.Entries != 3 || tb.Debits != tb.Credits {
+		t.Fatalf("unexpected trial balance %+v", tb)
+	}
+}
+
+func TestLedger_RefundReversesCollection(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(NewMemoryRepository(), zap.NewNop())
+
+	if err := s.RefundEscrow(ctx, "never-paid", ""); !errors.Is(err, ErrEntryNotFound) {
+		t.Fatalf("expected ErrEntryNotFound, got %v", err)
+	}
+	if err := s.CollectPayment(ctx, Collection{OrderID: "o1", Gateway: "fake", BuyerID: "u1", Paid: 20000, Voucher: 4000}); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if err := s.RefundEscrow(ctx, "o1", "stale claim"); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+
+	for _, a := range []Account{EscrowHolding("o1"), GatewayClearing("fake"), PromoBudget} {
+		if got := balanceOf(t, s, a); got != 0 {
+			t.Errorf("%s: expected 0 after the refund, got %d", a, got)
+		}
+	}
+	if _, err := s.CheckInvariant(ctx); err != nil {
+		t.Fatalf("invariant: %v", err)
+	}
+}
+
+func TestLedger_RejectsUnbalancedEntries(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	s := NewService(repo, zap.NewNop())
+
+	bad := &Entry{Reference: "bad", Kind: KindPayout, Lines: []Line{
+		{ProviderPayable("p1"), Debit, 1000},
+		{GatewayClearing("fake"), Credit, 999},
+	}}
+	if err := s.post(ctx, bad); !errors.Is(err, ErrUnbalancedEntry) {
+		t.Fatalf("expected ErrUnbalancedEntry, got %v", err)
+	}
+	unknown := &Entry{Reference: "unknown", Lines: []Line{
+		{Account("petty_cash"), Debit, 1},
+		{PlatformRevenue, Credit, 1},
+	}}
+	if err := s.post(ctx, unknown); err == nil {
+		t.Fatal("expected an unknown account to be refused")
+	}
+
+	// Something bypassing the service (a bad migration, a manual insert) is caught by the check
+	if _, err := repo.Post(ctx, bad); err != nil {
+		t.Fatalf("raw post: %v", err)
+	}
+	tb, err := s.CheckInvariant(ctx)
+	if !errors.Is(err, ErrLedgerUnbalanced) || len(tb.Unbalanced) != 1 || tb.Unbalanced[0] != "bad" {
+		t.Fatalf("expected the bad entry to be reported, got %+v, %v", tb, err)
+	}
+}
+
+func TestLedger_WalletSpendsOnlyWhatItHoldsWithinItsLimit(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(NewMemoryRepository(), zap.NewNop())
+	today := SpendLimit{Max: 50000}
+
+	if err := s.TopUpWallet(ctx, "t1", "u1", "fake", 50000); err != nil {
+		t.Fatalf("top up: %v", err)
+	}
+	if err := s.CreditCashback(ctx, Cashback{CampaignID: "ramadan", UserID: "u1", OrderID: "o0", Amount: 5000}); err != nil {
+		t.Fatalf("cashback: %v", err)
+	}
+	if err := s.CreditCashback(ctx, Cashback{CampaignID: "ramadan", UserID: "u1", OrderID: "o0", Amount: 5000}); err != nil {
+		t.Fatalf("repeat cashback: %v", err)
+	}
+	if got := balanceOf(t, s, BuyerWallet("u1")); got != 55000 {
+		t.Fatalf("expected 55000 in the wallet, got %d", got)
+	}
+
+	err := s.CollectFromWallet(ctx, Collection{OrderID: "o1", BuyerID: "u1", Paid: 60000}, today)
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("expected an overdraft to be refused, got %v", err)
+	}
+	if err := s.CollectFromWallet(ctx, Collection{OrderID: "o1", BuyerID: "u1", Paid: 40000, Voucher: 10000}, today); err != nil {
+		t.Fatalf("pay from wallet: %v", err)
+	}
+	err = s.CollectFromWallet(ctx, Collection{OrderID: "o2", BuyerID: "u1", Paid: 15000}, today)
+	if !errors.Is(err, ErrSpendLimitExceeded) {
+		t.Fatalf("expected the daily limit to hold, got %v", err)
+	}
+
+	// The refund goes back where the money came from: the wallet
+	if err := s.RefundEscrow(ctx, "o1", "stale claim"); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if got := balanceOf(t, s, BuyerWallet("u1")); got != 55000 {
+		t.Fatalf("expected the refund back in the wallet, got %d", got)
+	}
+
+	// A gateway-paid order refunded to the wallet instead of the card
+	if err := s.CollectPayment(ctx, Collection{OrderID: "o3", Gateway: "fake", BuyerID: "u1", Paid: 20000}); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if err := s.RefundEscrowToWallet(ctx, "o3", "u1", "instant refund"); err != nil {
+		t.Fatalf("refund to wallet: %v", err)
+	}
+	want := map[Account]int64{
+		BuyerWallet("u1"):       75000,
+		GatewayClearing("fake"): 70000,
+		PromoBudget:             5000,
+		EscrowHolding("o1"):     0,
+		EscrowHolding("o3"):     0,
+	}
+	for account, net := range want {
+		if got := balanceOf(t, s, account); got != net {
+			t.Errorf("%s: expected %d, got %d", account, net, got)
+		}
+	}
+
+	history, err := s.History(ctx, BuyerWallet("u1"), 10)
+	if err != nil || len(history) != 5 || history[0].Kind != KindEscrowRefunded || history[4].Kind != KindWalletTopUp {
+		t.Fatalf("expected five wallet postings newest first, got %+v (%v)", history, err)
+	}
+	if _, err := s.CheckInvariant(ctx); err != nil {
+		t.Fatalf("invariant: %v", err)
+	}
+}
@@ -2,21 +2,43 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	authDomain "github.com/albnnaardy11/pahlawan-pangan/internal/auth/domain"
+	iamMiddleware "github.com/albnnaardy11/pahlawan-pangan/internal/auth/middleware"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/provider"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/service"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
 )
 
 type LogisticsHandler struct {
-	dispatchSvc *service.DispatchService
+	dispatchSvc   *service.DispatchService
+	courierSvc    *service.CourierService
+	assignmentSvc *service.AssignmentService
+	deliverySvc   *service.DeliveryService
+	telemetrySvc  *service.TelemetryService
+	slaMonitor    *service.SLAMonitor
+	fulfillment   *service.FulfillmentService
+	earnings      *service.EarningsService
 }
 
-func NewLogisticsHandler(svc *service.DispatchService) *LogisticsHandler {
-	return &LogisticsHandler{dispatchSvc: svc}
+func NewLogisticsHandler(svc *service.DispatchService, courierSvc *service.CourierService, assignmentSvc *service.AssignmentService, deliverySvc *service.DeliveryService, telemetrySvc *service.TelemetryService, slaMonitor *service.SLAMonitor, fulfillment *service.FulfillmentService, earnings *service.EarningsService) *LogisticsHandler {
+	return &LogisticsHandler{
+		dispatchSvc:   svc,
+		courierSvc:    courierSvc,
+		assignmentSvc: assignmentSvc,
+		deliverySvc:   deliverySvc,
+		telemetrySvc:  telemetrySvc,
+		slaMonitor:    slaMonitor,
+		fulfillment:   fulfillment,
+		earnings:      earnings,
+	}
 }
 
 // POST /api/v1/orders
@@ -30,6 +52,8 @@ func (h *LogisticsHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		Expiry     time.Time          `json:"expiry_timestamp"`
 		SLA        domain.DeliverySLA `json:"service_level"`
 		Quantity   float64            `json:"quantity_kg"`
+		TempCat    string             `json:"temperature_category"`
+		DeliveryID string             `json:"delivery_id"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -38,17 +62,28 @@ func (h *LogisticsHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	order := domain.Order{
-		PickupLat:   req.PickupLat,
-		PickupLon:   req.PickupLon,
-		DropoffLat:  req.DropoffLat,
-		DropoffLon:  req.DropoffLon,
-		ExpiryTime:  req.Expiry,
-		SelectedSLA: req.SLA,
-		QuantityKg:  req.Quantity,
+		DeliveryID:   req.DeliveryID,
+		PickupLat:    req.PickupLat,
+		PickupLon:    req.PickupLon,
+		DropoffLat:   req.DropoffLat,
+		DropoffLon:   req.DropoffLon,
+		ExpiryTime:   req.Expiry,
+		SelectedSLA:  req.SLA,
+		QuantityKg:   req.Quantity,
+		TempCategory: req.TempCat,
 	}
 
+	// In-house riders or a partner fleet, whichever is cheapest on time.
 	// Dispatch logic handles SLA enforcement automatically (The "15 Minute Rule")
-	createdOrder, err := h.dispatchSvc.CreateOrder(r.Context(), order)
+	decision, err := h.fulfillment.Dispatch(r.Context(), order)
+	if errors.Is(err, service.ErrOrderWithoutDelivery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, domain.ErrDeliveryNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -56,36 +91,598 @@ func (h *LogisticsHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(createdOrder)
+	_ = json.NewEncoder(w).Encode(decision)
 }
 
 // GET /api/v1/courier/itinerary
-// Returns logical route sequence
+// Returns logical route sequence of every accepted batch
 func (h *LogisticsHandler) GetCourierItinerary(w http.ResponseWriter, r *http.Request) {
-	// Mock implementation for demo
-	// In production: Query assigned Batch from Redis
 	courierID := chi.URLParam(r, "id")
 
-	itinerary := []map[string]interface{}{
-		{"seq": 1, "type": "PICKUP", "loc": "Mall A", "eta": "10:00"},
-		{"seq": 2, "type": "PICKUP", "loc": "Bakery B", "eta": "10:15"}, // Optimization: 2 Pickups
-		{"seq": 3, "type": "DROPOFF", "loc": "User B", "eta": "10:30"},  // Drop B first (Optimization)
-		{"seq": 4, "type": "DROPOFF", "loc": "User A", "eta": "10:45"},
+	batches, err := h.assignmentSvc.Itinerary(r.Context(), courierID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	itinerary := []map[string]interface{}{}
+	for _, b := range batches {
+		for _, p := range b.Route {
+			itinerary = append(itinerary, map[string]interface{}{
+				"seq":      len(itinerary) + 1,
+				"batch_id": b.ID,
+				"order_id": p.OrderID,
+				"type":     p.Type,
+				"lat":      p.Lat,
+				"lon":      p.Lon,
+				"eta":      p.ETA,
+			})
+		}
+	}
+
+	status := "OPTIMIZED"
+	if len(itinerary) == 0 {
+		status = "IDLE"
 	}
 
 	res := map[string]interface{}{
 		"courier_id": courierID,
 		"route":      itinerary,
-		"status":     "OPTIMIZED",
+		"status":     status,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(res)
 }
 
+// actingCourier is the signed-in user's courier record, which must be the
+// route's {id}: couriers only ever act for themselves
+func (h *LogisticsHandler) actingCourier(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user, ok := iamMiddleware.CurrentUser(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	courier, err := h.courierSvc.ByUser(r.Context(), user.ID)
+	if errors.Is(err, domain.ErrCourierNotFound) {
+		http.Error(w, "forbidden: not a registered courier", http.StatusForbidden)
+		return "", false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+	if chi.URLParam(r, "id") != courier.ID {
+		http.Error(w, "forbidden: not your courier account", http.StatusForbidden)
+		return "", false
+	}
+	return courier.ID, true
+}
+
+// POST /api/v1/logistics/couriers
+// Onboards an existing COURIER user into the fleet
+func (h *LogisticsHandler) RegisterCourier(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID      string             `json:"user_id"`
+		VehicleType domain.VehicleType `json:"vehicle_type"`
+		CapacityKg  float64            `json:"capacity_kg"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	courier, err := h.courierSvc.Register(r.Context(), req.UserID, req.VehicleType, req.CapacityKg)
+	if err != nil {
+		writeCourierError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(courier)
+}
+
+// POST /api/v1/logistics/couriers/{id}/shift/start
+func (h *LogisticsHandler) StartShift(w http.ResponseWriter, r *http.Request) {
+	courierID, ok := h.actingCourier(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.courierSvc.StartShift(r.Context(), courierID, req.Lat, req.Lon); err != nil {
+		writeCourierError(w, err)
+		return
+	}
+	writeStatus(w, "ONLINE")
+}
+
+// POST /api/v1/logistics/couriers/{id}/shift/end
+func (h *LogisticsHandler) EndShift(w http.ResponseWriter, r *http.Request) {
+	courierID, ok := h.actingCourier(w, r)
+	if !ok {
+		return
+	}
+	if err := h.courierSvc.EndShift(r.Context(), courierID); err != nil {
+		writeCourierError(w, err)
+		return
+	}
+	writeStatus(w, "OFFLINE")
+}
+
+// PUT /api/v1/logistics/couriers/{id}/location
+// Live GPS ping from the courier app
+func (h *LogisticsHandler) UpdateCourierLocation(w http.ResponseWriter, r *http.Request) {
+	courierID, ok := h.actingCourier(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.courierSvc.UpdateLocation(r.Context(), courierID, req.Lat, req.Lon); err != nil {
+		writeCourierError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /api/v1/logistics/couriers/{id}/thermal-certification (admin)
+// Payload: {"valid_until": "..."}; null revokes the certification
+func (h *LogisticsHandler) CertifyThermalBag(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ValidUntil *time.Time `json:"valid_until"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.courierSvc.CertifyThermalBag(r.Context(), chi.URLParam(r, "id"), req.ValidUntil); err != nil {
+		writeCourierError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/v1/logistics/couriers/{id}/offers
+func (h *LogisticsHandler) ListOffers(w http.ResponseWriter, r *http.Request) {
+	offers, err := h.assignmentSvc.Offers(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(offers)
+}
+
+// POST /api/v1/logistics/couriers/{id}/offers/{batch_id}/accept
+func (h *LogisticsHandler) AcceptOffer(w http.ResponseWriter, r *http.Request) {
+	h.respondToOffer(w, r, true)
+}
+
+// POST /api/v1/logistics/couriers/{id}/offers/{batch_id}/reject
+func (h *LogisticsHandler) RejectOffer(w http.ResponseWriter, r *http.Request) {
+	h.respondToOffer(w, r, false)
+}
+
+func (h *LogisticsHandler) respondToOffer(w http.ResponseWriter, r *http.Request, accept bool) {
+	courierID, ok := h.actingCourier(w, r)
+	if !ok {
+		return
+	}
+	err := h.assignmentSvc.Respond(r.Context(), courierID, chi.URLParam(r, "batch_id"), accept)
+	if err != nil {
+		writeCourierError(w, err)
+		return
+	}
+
+	status := "REJECTED"
+	if accept {
+		status = "ACCEPTED"
+	}
+	writeStatus(w, status)
+}
+
+// GET /api/v1/logistics/deliveries/{delivery_id}
+// Tracking view for the provider and NGO apps
+func (h *LogisticsHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	d, err := h.deliverySvc.Get(r.Context(), chi.URLParam(r, "delivery_id"))
+	if err != nil {
+		writeCourierError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(d)
+}
+
+// POST /api/v1/logistics/couriers/{id}/deliveries/{delivery_id}/accept
+// Takes a searching delivery directly, outside of batch offers
+func (h *LogisticsHandler) AcceptDelivery(w http.ResponseWriter, r *http.Request) {
+	courierID, ok := h.actingCourier(w, r)
+	if !ok {
+		return
+	}
+	if err := h.deliverySvc.Assign(r.Context(), chi.URLParam(r, "delivery_id"), courierID); err != nil {
+		writeCourierError(w, err)
+		return
+	}
+	writeStatus(w, string(domain.DeliveryAssigned))
+}
+
+// POST /api/v1/logistics/couriers/{id}/deliveries/{delivery_id}/pickup
+// Payload: courier GPS at the store, checked against the provider location
+func (h *LogisticsHandler) PickupDelivery(w http.ResponseWriter, r *http.Request) {
+	courierID, ok := h.actingCourier(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	err := h.deliverySvc.ConfirmPickup(r.Context(), chi.URLParam(r, "delivery_id"), courierID, req.Lat, req.Lon)
+	if err != nil {
+		writeCourierError(w, err)
+		return
+	}
+	writeStatus(w, string(domain.DeliveryPickedUp))
+}
+
+// POST /api/v1/logistics/couriers/{id}/deliveries/{delivery_id}/deliver
+// Payload: {"otp": "...", "photo_ref": "...", "lat": ..., "lon": ...}
+func (h *LogisticsHandler) CompleteDelivery(w http.ResponseWriter, r *http.Request) {
+	courierID, ok := h.actingCourier(w, r)
+	if !ok {
+		return
+	}
+	var proof domain.DeliveryProof
+	if err := json.NewDecoder(r.Body).Decode(&proof); err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.deliverySvc.ConfirmDelivery(r.Context(), chi.URLParam(r, "delivery_id"), courierID, proof); err != nil {
+		writeCourierError(w, err)
+		return
+	}
+	writeStatus(w, string(domain.DeliveryDelivered))
+}
+
+// POST /api/v1/logistics/couriers/{id}/deliveries/{delivery_id}/fail
+func (h *LogisticsHandler) FailDelivery(w http.ResponseWriter, r *http.Request) {
+	courierID, ok := h.actingCourier(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Reason == "" {
+		http.Error(w, "A failure reason is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.deliverySvc.Fail(r.Context(), chi.URLParam(r, "delivery_id"), courierID, req.Reason); err != nil {
+		writeCourierError(w, err)
+		return
+	}
+	writeStatus(w, string(domain.DeliveryFailed))
+}
+
+// GET /api/v1/logistics/deliveries/{delivery_id}/tracking
+// Live status from the partner fleet carrying an external delivery
+func (h *LogisticsHandler) TrackExternalDelivery(w http.ResponseWriter, r *http.Request) {
+	update, err := h.fulfillment.Track(r.Context(), chi.URLParam(r, "delivery_id"))
+	if err != nil {
+		writeCourierError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(update)
+}
+
+// POST /api/v1/logistics/deliveries/{delivery_id}/cancel
+// Withdraws the partner booking of an external delivery
+func (h *LogisticsHandler) CancelExternalDelivery(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Reason == "" {
+		http.Error(w, "A cancellation reason is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.fulfillment.Cancel(r.Context(), chi.URLParam(r, "delivery_id"), req.Reason); err != nil {
+		writeCourierError(w, err)
+		return
+	}
+	writeStatus(w, string(domain.DeliveryFailed))
+}
+
+// POST /api/v1/logistics/providers/{provider}/webhook
+// Signed status callbacks from partner fleets
+func (h *LogisticsHandler) ProviderWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	err = h.fulfillment.HandleWebhook(r.Context(), chi.URLParam(r, "provider"), body, r.Header.Get(provider.SignatureHeader))
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, domain.ErrUnmappedProviderStatus):
+		// Informational states (driver arriving, etc.): acknowledge so the partner stops retrying
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeCourierError(w, err)
+	}
+}
+
+// POST /api/v1/logistics/deliveries/{delivery_id}/telemetry
+// Payload: {"sensor_id": "...", "readings": [{"temp_c": 4.2, "recorded_at": "..."}]}
+func (h *LogisticsHandler) IngestTelemetry(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SensorID string `json:"sensor_id"`
+		Readings []struct {
+			TempC      float64   `json:"temp_c"`
+			RecordedAt time.Time `json:"recorded_at"`
+		} `json:"readings"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SensorID == "" || len(req.Readings) == 0 {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	readings := make([]domain.TemperatureReading, len(req.Readings))
+	for i, rd := range req.Readings {
+		readings[i] = domain.TemperatureReading{SensorID: req.SensorID, TempC: rd.TempC, RecordedAt: rd.RecordedAt}
+	}
+
+	excursion, err := h.telemetrySvc.Ingest(r.Context(), chi.URLParam(r, "delivery_id"), readings)
+	if err != nil {
+		writeCourierError(w, err)
+		return
+	}
+
+	status := "OK"
+	if excursion != nil {
+		status = "EXCURSION"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"accepted":  len(readings),
+		"status":    status,
+		"excursion": excursion,
+	})
+}
+
+// GET /api/v1/logistics/deliveries/{delivery_id}/telemetry
+// Full sensor trace; linked from cold-chain disputes as evidence
+func (h *LogisticsHandler) GetTelemetry(w http.ResponseWriter, r *http.Request) {
+	trace, err := h.telemetrySvc.Trace(r.Context(), chi.URLParam(r, "delivery_id"))
+	if err != nil {
+		writeCourierError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"delivery_id": chi.URLParam(r, "delivery_id"),
+		"readings":    trace,
+	})
+}
+
+// GET /api/v1/logistics/sla/report?from=&to=
+// Escalations and late deliveries per region and SLA tier (RFC3339 bounds, default last 24h)
+func (h *LogisticsHandler) GetSLAReport(w http.ResponseWriter, r *http.Request) {
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	for param, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		raw := r.URL.Query().Get(param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "Invalid "+param+" timestamp", http.StatusBadRequest)
+			return
+		}
+		*target = t
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.slaMonitor.Report(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rows == nil {
+		rows = []domain.SLAReportRow{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":    from,
+		"to":      to,
+		"regions": rows,
+	})
+}
+
+// GET /api/v1/logistics/couriers/{id}/earnings
+// Ledger summary with the most recent entries
+func (h *LogisticsHandler) GetCourierEarnings(w http.ResponseWriter, r *http.Request) {
+	summary, entries, err := h.earnings.Summary(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeCourierError(w, err)
+		return
+	}
+	if entries == nil {
+		entries = []domain.EarningEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"summary": summary,
+		"entries": entries,
+	})
+}
+
+// GET /api/v1/logistics/couriers/{id}/earnings/balance
+// What can be paid out now, and what is still inside the dispute hold
+func (h *LogisticsHandler) GetCourierBalance(w http.ResponseWriter, r *http.Request) {
+	summary, _, err := h.earnings.Summary(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeCourierError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"courier_id":      summary.CourierID,
+		"balance":         summary.Balance,
+		"payout_eligible": summary.PayoutEligible,
+		"on_hold":         summary.OnHold,
+		"as_of":           summary.AsOf,
+	})
+}
+
+// PUT /api/v1/logistics/subsidy/budget/{month} (admin)
+// Sets the platform budget (IDR) covering donation delivery fees in a month (YYYY-MM)
+func (h *LogisticsHandler) SetSubsidyBudget(w http.ResponseWriter, r *http.Request) {
+	month, err := time.Parse("2006-01", chi.URLParam(r, "month"))
+	if err != nil {
+		http.Error(w, "Invalid month, expected YYYY-MM", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Budget money.Money `json:"budget"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Budget.IsNegative() {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.earnings.SetSubsidyBudget(r.Context(), month, req.Budget); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict) // Below what is already spent
+		return
+	}
+	h.GetSubsidyBudget(w, r)
+}
+
+// GET /api/v1/logistics/subsidy/budget/{month}
+func (h *LogisticsHandler) GetSubsidyBudget(w http.ResponseWriter, r *http.Request) {
+	month, err := time.Parse("2006-01", chi.URLParam(r, "month"))
+	if err != nil {
+		http.Error(w, "Invalid month, expected YYYY-MM", http.StatusBadRequest)
+		return
+	}
+
+	budget, err := h.earnings.SubsidyBudget(r.Context(), month)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(budget)
+}
+
+func writeStatus(w http.ResponseWriter, status string) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+func writeCourierError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrCourierNotFound), errors.Is(err, domain.ErrOfferNotFound), errors.Is(err, domain.ErrDeliveryNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrNotCourierRole), errors.Is(err, service.ErrCourierOnDuty), errors.Is(err, service.ErrCourierOffline),
+		errors.Is(err, domain.ErrInvalidTransition), errors.Is(err, service.ErrDeliveryNotInTransit):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, domain.ErrUnknownProvider):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, domain.ErrInvalidWebhookSignature):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, domain.ErrProviderUnavailable):
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	case errors.Is(err, service.ErrNotDeliveryCourier):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrOutsidePickupGeofence), errors.Is(err, service.ErrOutsideDropoffGeofence),
+		errors.Is(err, service.ErrInvalidDeliveryOTP), errors.Is(err, service.ErrMissingDeliveryProof):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func (h *LogisticsHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 	r.Post("/orders", h.CreateOrder)
 	r.Get("/courier/{id}/itinerary", h.GetCourierItinerary)
+
+	// Courier fleet & assignment
+	r.Post("/couriers", h.RegisterCourier)
+	r.Route("/couriers/{id}", func(r chi.Router) {
+		r.Post("/shift/start", h.StartShift)
+		r.Post("/shift/end", h.EndShift)
+		r.Put("/location", h.UpdateCourierLocation)
+		r.With(iamMiddleware.RoleGuard(authDomain.RoleAdmin)).Put("/thermal-certification", h.CertifyThermalBag)
+		r.Get("/offers", h.ListOffers)
+		r.Post("/offers/{batch_id}/accept", h.AcceptOffer)
+		r.Post("/offers/{batch_id}/reject", h.RejectOffer)
+
+		// Delivery tracking: assigned -> picked_up -> delivered / failed
+		r.Post("/deliveries/{delivery_id}/accept", h.AcceptDelivery)
+		r.Post("/deliveries/{delivery_id}/pickup", h.PickupDelivery)
+		r.Post("/deliveries/{delivery_id}/deliver", h.CompleteDelivery)
+		r.Post("/deliveries/{delivery_id}/fail", h.FailDelivery)
+
+		// Earnings ledger
+		r.Get("/earnings", h.GetCourierEarnings)
+		r.Get("/earnings/balance", h.GetCourierBalance)
+	})
+	r.Get("/deliveries/{delivery_id}", h.GetDelivery)
+	r.Post("/deliveries/{delivery_id}/telemetry", h.IngestTelemetry)
+	r.Get("/deliveries/{delivery_id}/telemetry", h.GetTelemetry)
+
+	// External courier providers
+	r.Get("/deliveries/{delivery_id}/tracking", h.TrackExternalDelivery)
+	r.Post("/deliveries/{delivery_id}/cancel", h.CancelExternalDelivery)
+	r.Post("/providers/{provider}/webhook", h.ProviderWebhook)
+
+	r.Get("/sla/report", h.GetSLAReport)
+
+	// Donation delivery subsidy
+	r.With(iamMiddleware.RoleGuard(authDomain.RoleAdmin)).Put("/subsidy/budget/{month}", h.SetSubsidyBudget)
+	r.Get("/subsidy/budget/{month}", h.GetSubsidyBudget)
 	return r
 }
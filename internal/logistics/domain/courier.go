@@ -0,0 +1,122 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrCourierNotFound = errors.New("courier not found")
+	ErrOfferNotFound   = errors.New("no open offer for this courier and batch")
+)
+
+// CourierStatus tracks whether a courier can receive new batches
+type CourierStatus string
+
+const (
+	CourierOffline CourierStatus = "OFFLINE"
+	CourierOnline  CourierStatus = "ONLINE" // On shift, waiting for a batch
+	CourierBusy    CourierStatus = "BUSY"   // Carrying an accepted batch
+)
+
+// VehicleType determines the default carrying capacity
+type VehicleType string
+
+const (
+	VehicleBike VehicleType = "BIKE"
+	VehicleCar  VehicleType = "CAR"
+	VehicleVan  VehicleType = "VAN"
+)
+
+// DefaultCapacityKg is used when a courier registers without an explicit capacity
+func (v VehicleType) DefaultCapacityKg() float64 {
+	switch v {
+	case VehicleVan:
+		return 300
+	case VehicleCar:
+		return 80
+	default:
+		return 20 // Motor with delivery box
+	}
+}
+
+// Courier is a registered rescue rider, linked to an auth user with RoleCourier
+type Courier struct {
+	ID                       string        `json:"id"`
+	UserID                   string        `json:"user_id"`
+	VehicleType              VehicleType   `json:"vehicle_type"`
+	CapacityKg               float64       `json:"capacity_kg"`
+	ThermalBagCertifiedUntil *time.Time    `json:"thermal_bag_certified_until,omitempty"`
+	Status                   CourierStatus `json:"status"`
+	ShiftStartedAt           *time.Time    `json:"shift_started_at,omitempty"`
+	CreatedAt                time.Time     `json:"created_at"`
+	UpdatedAt                time.Time     `json:"updated_at"`
+}
+
+// CanCarryColdChain reports whether the thermal bag certification is still valid
+func (c *Courier) CanCarryColdChain(now time.Time) bool {
+	return c.ThermalBagCertifiedUntil != nil && now.Before(*c.ThermalBagCertifiedUntil)
+}
+
+// AssignmentStatus follows a batch from creation until a courier takes it
+type AssignmentStatus string
+
+const (
+	AssignmentSearching AssignmentStatus = "SEARCHING" // Waiting for an available courier
+	AssignmentOffered   AssignmentStatus = "OFFERED"   // Offered to one courier, awaiting response
+	AssignmentAccepted  AssignmentStatus = "ACCEPTED"
+	AssignmentCompleted AssignmentStatus = "COMPLETED" // Every delivery in the batch is delivered or failed
+)
+
+// Assignment binds a batch to the courier that will carry it
+type Assignment struct {
+	BatchID        string           `json:"batch_id"`
+	Batch          Batch            `json:"batch"`
+	CourierID      string           `json:"courier_id,omitempty"`
+	Status         AssignmentStatus `json:"status"`
+	RejectedBy     []string         `json:"rejected_by,omitempty"`
+	OfferExpiresAt *time.Time       `json:"offer_expires_at,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+// HasRejected reports whether the courier already turned this batch down
+func (a *Assignment) HasRejected(courierID string) bool {
+	for _, id := range a.RejectedBy {
+		if id == courierID {
+			return true
+		}
+	}
+	return false
+}
+
+// CourierRepository persists the courier fleet
+type CourierRepository interface {
+	Create(ctx context.Context, courier *Courier) error
+	GetByID(ctx context.Context, id string) (*Courier, error)
+	// GetByUserID finds the courier an auth user was onboarded as
+	GetByUserID(ctx context.Context, userID string) (*Courier, error)
+	ListByIDs(ctx context.Context, ids []string) ([]Courier, error)
+	UpdateStatus(ctx context.Context, id string, status CourierStatus) error
+	UpdateCertification(ctx context.Context, id string, validUntil *time.Time) error
+}
+
+// AssignmentRepository persists batch-to-courier offers.
+// Offer and Respond are conditional updates, so concurrent replicas cannot
+// hand the same batch to two couriers.
+type AssignmentRepository interface {
+	Create(ctx context.Context, assignment *Assignment) error
+	Get(ctx context.Context, batchID string) (*Assignment, error)
+	ListSearching(ctx context.Context, limit int) ([]Assignment, error)
+	ListActive(ctx context.Context, limit int) ([]Assignment, error)
+	ListByCourier(ctx context.Context, courierID string) ([]Assignment, error)
+	UpdateBatch(ctx context.Context, batchID string, batch Batch) error
+	// UpdateSearchingBatch only applies while nobody has been offered the batch
+	// and it is unchanged since seenAt
+	UpdateSearchingBatch(ctx context.Context, batchID string, batch Batch, seenAt time.Time) error
+	Offer(ctx context.Context, batchID, courierID string, expiresAt time.Time) error
+	Respond(ctx context.Context, batchID, courierID string, accept bool, now time.Time) error
+	ExpireOffers(ctx context.Context, now time.Time) (int64, error)
+	CompleteByCourier(ctx context.Context, courierID string) error
+}
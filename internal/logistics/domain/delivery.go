@@ -0,0 +1,124 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/outbox"
+)
+
+var (
+	ErrDeliveryNotFound  = errors.New("delivery not found")
+	ErrInvalidTransition = errors.New("delivery cannot move to the requested status")
+)
+
+// DeliveryStatus mirrors deliveries.status
+type DeliveryStatus string
+
+const (
+	DeliverySearching      DeliveryStatus = "searching"
+	DeliveryAssigned       DeliveryStatus = "assigned"
+	DeliveryPickedUp       DeliveryStatus = "picked_up"
+	DeliveryDelivered      DeliveryStatus = "delivered"
+	DeliveryFailed         DeliveryStatus = "failed"
+	DeliveryReadyForPickup DeliveryStatus = "ready_for_pickup" // Self-pickup, waiting at the store
+)
+
+var deliveryTransitions = map[DeliveryStatus][]DeliveryStatus{
+	DeliverySearching:      {DeliveryAssigned, DeliveryFailed},
+	DeliveryAssigned:       {DeliveryPickedUp, DeliveryFailed},
+	DeliveryPickedUp:       {DeliveryDelivered, DeliveryFailed},
+	DeliveryReadyForPickup: {DeliveryDelivered, DeliveryFailed},
+}
+
+// CanTransitionTo reports whether next is a legal step from s
+func (s DeliveryStatus) CanTransitionTo(next DeliveryStatus) bool {
+	for _, allowed := range deliveryTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal is true once the delivery can no longer change
+func (s DeliveryStatus) IsTerminal() bool {
+	return s == DeliveryDelivered || s == DeliveryFailed
+}
+
+// Delivery is the physical movement of one claimed surplus from provider to NGO
+type Delivery struct {
+	ID                string         `json:"id"`
+	SurplusID         string         `json:"surplus_id"`
+	ProviderID        string         `json:"provider_id"`
+	NGOID             string         `json:"ngo_id,omitempty"`
+	RecipientID       string         `json:"-"` // The NGO, or the buyer of a B2C claim; gets the dropoff OTP
+	CourierID         string         `json:"courier_id,omitempty"`
+	Provider          string         `json:"courier_provider,omitempty"`     // Set when an external fleet carries it
+	ExternalID        string         `json:"external_tracking_id,omitempty"` // Provider's booking ID
+	Status            DeliveryStatus `json:"status"`
+	SLATier           DeliverySLA    `json:"sla_tier,omitempty"` // Tier it was dispatched on
+	RequiresColdChain bool           `json:"requires_cold_chain"`
+	TempCategory      string         `json:"temperature_category"` // ambient, chilled, frozen, hot
+	FoodUnsafe        bool           `json:"food_unsafe"`          // Set on a cold-chain excursion
+	QuantityKg        float64        `json:"quantity_kg"`
+	FoodType          string         `json:"food_type"`
+	IsDonation        bool           `json:"is_donation"`
+	Fee               *FeeBreakdown  `json:"fee,omitempty"` // Priced when a courier takes it
+	ProviderLat       float64        `json:"provider_lat"`
+	ProviderLon       float64        `json:"provider_lon"`
+	NGOLat            float64        `json:"ngo_lat,omitempty"`
+	NGOLon            float64        `json:"ngo_lon,omitempty"`
+	DropoffOTP        string         `json:"-"` // Sent to the recipient at pickup, never returned by the API or put in events
+	PickedUpAt        *time.Time     `json:"picked_up_at,omitempty"`
+	DeliveredAt       *time.Time     `json:"delivered_at,omitempty"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+}
+
+// PickupCheckin is the geotagged proof that the courier was at the store
+type PickupCheckin struct {
+	DeliveryID string
+	ProviderID string
+	CourierID  string
+	Lat        float64
+	Lon        float64
+	CheckedAt  time.Time
+}
+
+// DeliveryProof is captured at the NGO door
+type DeliveryProof struct {
+	OTP      string  `json:"otp"`
+	PhotoRef string  `json:"photo_ref"` // Object storage key of the handover photo
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+}
+
+// DeliveryTransition is one status change together with the facts captured at that step
+type DeliveryTransition struct {
+	DeliveryID    string
+	CourierID     string
+	ExternalID    string         // Held by a provider booking instead of one of our couriers
+	From          DeliveryStatus // Optimistic check: the update only applies if the row is still here
+	To            DeliveryStatus
+	Booking       *Booking       // To assigned via an external provider
+	Checkin       *PickupCheckin // To picked_up
+	DropoffOTP    string         // To picked_up
+	Proof         *DeliveryProof // To delivered
+	FailureReason string         // To failed
+	FoodUnsafe    bool           // To failed: the load must not be handed over or relisted
+	At            time.Time
+}
+
+// DeliveryRepository persists deliveries. Apply writes the status change and
+// its outbox event in one transaction, so the carbon and escrow workers never
+// miss a transition or see one that was rolled back.
+type DeliveryRepository interface {
+	Get(ctx context.Context, id string) (*Delivery, error)
+	GetByExternalID(ctx context.Context, provider, externalID string) (*Delivery, error)
+	Apply(ctx context.Context, t DeliveryTransition, event outbox.Event) error
+	CountActiveByCourier(ctx context.Context, courierID string) (int, error)
+	// SetSLATier records the tier the delivery was dispatched on
+	SetSLATier(ctx context.Context, id string, tier DeliverySLA) error
+}
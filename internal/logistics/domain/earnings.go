@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+// FeeBreakdown shows how a delivery fee was built up, so couriers and NGOs can see why
+// a trip cost what it did
+type FeeBreakdown struct {
+	DistanceKm         float64     `json:"distance_km"`
+	SLA                DeliverySLA `json:"sla"`
+	BaseFee            money.Money `json:"base_fee"` // Flag fall + per-km
+	SLAMultiplier      float64     `json:"sla_multiplier"`
+	ColdChainSurcharge money.Money `json:"cold_chain_surcharge"`
+	BatchSize          int         `json:"batch_size"`
+	BatchDiscount      float64     `json:"batch_discount"` // Fraction off for sharing the ride
+	SurgeFactor        float64     `json:"surge_factor"`
+	Total              money.Money `json:"total"`
+	CourierEarning     money.Money `json:"courier_earning"` // Courier's share of Total
+	PlatformFee        money.Money `json:"platform_fee"`
+	Subsidy            money.Money `json:"subsidy"`        // Covered by the platform donation budget
+	RecipientPays      money.Money `json:"recipient_pays"` // Total - Subsidy
+	CourierPoints      int         `json:"courier_points"`
+}
+
+// EarningKind classifies courier ledger entries
+type EarningKind string
+
+const (
+	EarningDelivery   EarningKind = "DELIVERY"   // Courier share of a completed delivery
+	EarningPayout     EarningKind = "PAYOUT"     // Money sent to the courier (negative)
+	EarningAdjustment EarningKind = "ADJUSTMENT" // Manual correction by ops
+)
+
+// EarningEntry is one append-only courier ledger line. Corrections are new
+// entries, never edits.
+type EarningEntry struct {
+	ID          string      `json:"id"`
+	CourierID   string      `json:"courier_id"`
+	DeliveryID  string      `json:"delivery_id,omitempty"`
+	Kind        EarningKind `json:"kind"`
+	Amount      money.Money `json:"amount"` // Negative for payouts
+	Points      int         `json:"points"`
+	AvailableAt time.Time   `json:"available_at"` // Payout-eligible from here (after the dispute hold)
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// EarningsSummary is a courier's ledger rolled up at a point in time
+type EarningsSummary struct {
+	CourierID      string      `json:"courier_id"`
+	Deliveries     int         `json:"deliveries"`
+	Earned         money.Money `json:"earned"`
+	PaidOut        money.Money `json:"paid_out"`
+	Balance        money.Money `json:"balance"`
+	PayoutEligible money.Money `json:"payout_eligible"`
+	OnHold         money.Money `json:"on_hold"` // Earned but still inside the dispute hold
+	Points         int         `json:"points"`
+	AsOf           time.Time   `json:"as_of"`
+}
+
+// SubsidyBudget is the platform money set aside each month to cover donation deliveries
+type SubsidyBudget struct {
+	Month  time.Time   `json:"month"` // First day of the month
+	Budget money.Money `json:"budget"`
+	Spent  money.Money `json:"spent"`
+}
+
+type EarningsRepository interface {
+	// SetDeliveryFee stores the priced fee on the delivery
+	SetDeliveryFee(ctx context.Context, deliveryID string, fee FeeBreakdown) error
+	// ReserveSubsidy draws up to amount from the month's budget for a delivery,
+	// once per delivery, and returns what was granted
+	ReserveSubsidy(ctx context.Context, deliveryID string, at time.Time, amount money.Money) (money.Money, error)
+	SetSubsidyBudget(ctx context.Context, month time.Time, budget money.Money) error
+	GetSubsidyBudget(ctx context.Context, month time.Time) (*SubsidyBudget, error)
+
+	// Append adds a ledger entry; a second DELIVERY entry for the same delivery is ignored
+	Append(ctx context.Context, entry *EarningEntry) (bool, error)
+	Summary(ctx context.Context, courierID string, now time.Time) (*EarningsSummary, error)
+	ListByCourier(ctx context.Context, courierID string, limit int) ([]EarningEntry, error)
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"context"
 	"time"
 
 	"github.com/golang/geo/s2"
@@ -16,22 +17,50 @@ const (
 	SLA_CRITICAL DeliverySLA = "CRITICAL" // Forced upgrade if expiry < 15m
 )
 
+// MaxBatchSize returns how many orders a single batch may carry for this SLA
+func (s DeliverySLA) MaxBatchSize() int {
+	switch s {
+	case SLA_EXPRESS, SLA_CRITICAL:
+		return 1
+	case SLA_STANDARD:
+		return 2
+	default:
+		return 4
+	}
+}
+
+// DeliveryWindow is the promised pickup-to-dropoff time, measured from order creation
+func (s DeliverySLA) DeliveryWindow() time.Duration {
+	switch s {
+	case SLA_CRITICAL:
+		return 30 * time.Minute
+	case SLA_EXPRESS:
+		return 45 * time.Minute
+	case SLA_STANDARD:
+		return 90 * time.Minute
+	default:
+		return 3 * time.Hour
+	}
+}
+
 // Order represents a delivery request
 type Order struct {
-	ID          string
-	UserID      string
-	ProviderID  string
-	PickupLat   float64
-	PickupLon   float64
-	DropoffLat  float64
-	DropoffLon  float64
-	ExpiryTime  time.Time
-	QuantityKg  float64
-	SelectedSLA DeliverySLA
-	CurrentSLA  DeliverySLA // Can be upgraded by the system
-	Status      string
-	BatchID     *string
-	CreatedAt   time.Time
+	ID           string
+	DeliveryID   string // deliveries row this order moves, if it came from a surplus claim
+	UserID       string
+	ProviderID   string
+	PickupLat    float64
+	PickupLon    float64
+	DropoffLat   float64
+	DropoffLon   float64
+	ExpiryTime   time.Time
+	QuantityKg   float64
+	TempCategory string // ambient, chilled, frozen, hot
+	SelectedSLA  DeliverySLA
+	CurrentSLA   DeliverySLA // Can be upgraded by the system
+	Status       string
+	BatchID      *string
+	CreatedAt    time.Time
 }
 
 // Batch represents a grouped set of orders for optimal routing
@@ -43,6 +72,12 @@ type Batch struct {
 	Score     float64
 }
 
+// Route stop types
+const (
+	StopPickup  = "PICKUP"
+	StopDropoff = "DROPOFF"
+)
+
 type RoutePoint struct {
 	OrderID string
 	Type    string // PICKUP or DROPOFF
@@ -51,17 +86,96 @@ type RoutePoint struct {
 	ETA     time.Time
 }
 
+// RequiresColdChain reports whether the order needs a thermal-bag certified courier
+func (o *Order) RequiresColdChain() bool {
+	return o.TempCategory == "chilled" || o.TempCategory == "frozen" || o.TempCategory == "hot"
+}
+
+// PromisedSLA is the tier the customer chose, or the current one if they chose none
+func (o *Order) PromisedSLA() DeliverySLA {
+	if o.SelectedSLA == "" {
+		return o.CurrentSLA
+	}
+	return o.SelectedSLA
+}
+
+// Deadline is the latest acceptable dropoff: the SLA promise, capped by food expiry.
+// The promise is the tier the customer chose; a CRITICAL upgrade speeds up
+// dispatch but does not move the goalposts.
+func (o *Order) Deadline() time.Time {
+	if o.CreatedAt.IsZero() {
+		return o.ExpiryTime
+	}
+	slaDeadline := o.CreatedAt.Add(o.PromisedSLA().DeliveryWindow())
+	if !o.ExpiryTime.IsZero() && o.ExpiryTime.Before(slaDeadline) {
+		return o.ExpiryTime
+	}
+	return slaDeadline
+}
+
+// TotalKg is the combined load the courier has to carry
+func (b *Batch) TotalKg() float64 {
+	var total float64
+	for _, o := range b.Orders {
+		total += o.QuantityKg
+	}
+	return total
+}
+
+// RequiresColdChain is true if any order in the batch needs temperature control
+func (b *Batch) RequiresColdChain() bool {
+	for i := range b.Orders {
+		if b.Orders[i].RequiresColdChain() {
+			return true
+		}
+	}
+	return false
+}
+
 // S2CellID returns the Level 13 cell ID for clustering
 func (o *Order) S2CellID() s2.CellID {
 	return s2.CellIDFromLatLng(s2.LatLngFromDegrees(o.PickupLat, o.PickupLon)).Parent(13)
 }
 
+// CriticalThreshold is the time-to-expiry below which an order is forced to CRITICAL
+const CriticalThreshold = 15 * time.Minute
+
+// SLARegionLevel is the S2 level SLA metrics are grouped by (~18km cells, roughly a kota)
+const SLARegionLevel = 9
+
 // EnforceSLA upgrades priority if food is about to expire
 func (o *Order) EnforceSLA() {
 	timeLeft := time.Until(o.ExpiryTime)
-	if timeLeft < 15*time.Minute {
+	if timeLeft < CriticalThreshold {
 		o.CurrentSLA = SLA_CRITICAL
 	} else {
 		o.CurrentSLA = o.SelectedSLA
 	}
 }
+
+// NeedsEscalation reports whether an order has drifted into the critical window since it was last evaluated
+func (o *Order) NeedsEscalation(now time.Time) bool {
+	return o.CurrentSLA != SLA_CRITICAL && o.ExpiryTime.Sub(now) < CriticalThreshold
+}
+
+// Region is the pickup's SLA reporting region (S2 cell token)
+func (o *Order) Region() string {
+	return s2.CellIDFromLatLng(s2.LatLngFromDegrees(o.PickupLat, o.PickupLon)).Parent(SLARegionLevel).ToToken()
+}
+
+// OrderQueue is the durable dispatch backlog shared by every replica.
+// Take and TakeDue move orders atomically onto a lease, so each order is handed
+// to exactly one caller even when several replicas poll at the same time.
+// The caller acks them once they are handed on for assignment; orders whose
+// lease runs out first (the replica died in between) are requeued as due.
+type OrderQueue interface {
+	// Enqueue queues an order, dropping any lease it was taken on
+	Enqueue(ctx context.Context, order Order, dispatchBy time.Time) error
+	Pending(ctx context.Context) ([]Order, error)
+	Take(ctx context.Context, orderIDs ...string) ([]Order, error)
+	TakeDue(ctx context.Context, now time.Time, limit int) ([]Order, error)
+	// Ack forgets taken orders for good
+	Ack(ctx context.Context, orderIDs ...string) error
+	// RequeueExpired puts back up to limit orders whose lease ended by now
+	RequeueExpired(ctx context.Context, now time.Time, limit int) (int, error)
+}
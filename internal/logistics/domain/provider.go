@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoCourierOption         = errors.New("neither in-house couriers nor any provider can serve this order")
+	ErrUnknownProvider         = errors.New("unknown courier provider")
+	ErrProviderUnavailable     = errors.New("courier provider cannot serve this shipment")
+	ErrInvalidWebhookSignature = errors.New("courier provider webhook signature mismatch")
+	ErrUnmappedProviderStatus  = errors.New("provider status has no delivery equivalent")
+)
+
+// InHouseProvider names our own rider fleet when it competes with external quotes
+const InHouseProvider = "in_house"
+
+// ShipmentRequest is what every provider needs to price and book a delivery
+type ShipmentRequest struct {
+	DeliveryID        string  `json:"delivery_id"`
+	PickupLat         float64 `json:"pickup_lat"`
+	PickupLon         float64 `json:"pickup_lon"`
+	DropoffLat        float64 `json:"dropoff_lat"`
+	DropoffLon        float64 `json:"dropoff_lon"`
+	WeightKg          float64 `json:"weight_kg"`
+	RequiresColdChain bool    `json:"requires_cold_chain"`
+}
+
+// Quote is a priced offer to move a shipment
+type Quote struct {
+	Provider   string        `json:"provider"`
+	QuoteID    string        `json:"quote_id,omitempty"`
+	Fee        float64       `json:"fee"`         // IDR
+	PickupETA  time.Duration `json:"pickup_eta"`  // Until the rider is at the provider
+	DropoffETA time.Duration `json:"dropoff_eta"` // Until the food is at the NGO
+	ExpiresAt  time.Time     `json:"expires_at,omitempty"`
+}
+
+// Booking is a confirmed external shipment
+type Booking struct {
+	Provider    string         `json:"provider"`
+	ExternalID  string         `json:"external_id"`
+	Fee         float64        `json:"fee"`
+	TrackingURL string         `json:"tracking_url,omitempty"`
+	Status      DeliveryStatus `json:"status"`
+}
+
+// TrackingUpdate is a provider status normalised to our delivery lifecycle
+type TrackingUpdate struct {
+	Provider       string         `json:"provider"`
+	ExternalID     string         `json:"external_id"`
+	Status         DeliveryStatus `json:"status"`
+	ProviderStatus string         `json:"provider_status"` // Raw value, kept for support tickets
+	DriverName     string         `json:"driver_name,omitempty"`
+	Lat            float64        `json:"lat,omitempty"`
+	Lon            float64        `json:"lon,omitempty"`
+	PhotoURL       string         `json:"photo_url,omitempty"` // Provider's proof of delivery
+	Reason         string         `json:"reason,omitempty"`
+	At             time.Time      `json:"at"`
+}
+
+// CourierProvider is a third-party delivery fleet (Gojek, Grab, Lalamove...).
+// Every adapter maps its own status vocabulary onto DeliveryStatus, so the rest
+// of the system never sees provider-specific states.
+type CourierProvider interface {
+	Name() string
+	Quote(ctx context.Context, req ShipmentRequest) (*Quote, error)
+	Book(ctx context.Context, req ShipmentRequest, quoteID string) (*Booking, error)
+	Cancel(ctx context.Context, externalID, reason string) error
+	Track(ctx context.Context, externalID string) (*TrackingUpdate, error)
+	// ParseWebhook authenticates an inbound status callback and normalises it
+	ParseWebhook(body []byte, signature string) (*TrackingUpdate, error)
+}
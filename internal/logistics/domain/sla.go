@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// SLAEventKind classifies what the SLA monitor observed
+type SLAEventKind string
+
+const (
+	SLAEscalated    SLAEventKind = "ESCALATED"     // Upgraded to CRITICAL while waiting
+	SLALateDelivery SLAEventKind = "LATE_DELIVERY" // Still not delivered past its deadline
+)
+
+// SLAEvent is recorded at most once per order and kind, so every replica can
+// scan the same orders without double counting
+type SLAEvent struct {
+	OrderID    string       `json:"order_id"`
+	BatchID    string       `json:"batch_id,omitempty"`
+	Kind       SLAEventKind `json:"kind"`
+	Region     string       `json:"region"`
+	Tier       DeliverySLA  `json:"sla_tier"` // Tier the order held when the event happened
+	Deadline   time.Time    `json:"deadline"`
+	DetectedAt time.Time    `json:"detected_at"`
+}
+
+// SLAReportRow aggregates SLA events for one region and tier
+type SLAReportRow struct {
+	Region         string      `json:"region"`
+	Tier           DeliverySLA `json:"sla_tier"`
+	Escalations    int         `json:"escalations"`
+	LateDeliveries int         `json:"late_deliveries"`
+}
+
+type SLARepository interface {
+	// Record stores the event and reports whether it was new
+	Record(ctx context.Context, event SLAEvent) (bool, error)
+	Report(ctx context.Context, from, to time.Time) ([]SLAReportRow, error)
+}
@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// TemperatureReading is one thermal-bag sensor sample during transit
+type TemperatureReading struct {
+	DeliveryID string    `json:"delivery_id"`
+	SensorID   string    `json:"sensor_id"`
+	TempC      float64   `json:"temp_c"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// TempLimits is the safe band for a temperature category. A reading outside
+// the band only counts as an excursion once it has lasted longer than Grace,
+// so opening the bag at a stop does not condemn the food.
+type TempLimits struct {
+	MinC  float64
+	MaxC  float64
+	Grace time.Duration
+}
+
+var coldChainLimits = map[string]TempLimits{
+	"chilled": {MinC: 0, MaxC: 5, Grace: 10 * time.Minute},
+	"frozen":  {MinC: math.Inf(-1), MaxC: -15, Grace: 10 * time.Minute},
+	"hot":     {MinC: 60, MaxC: math.Inf(1), Grace: 5 * time.Minute}, // Bacteria grow fastest between 5 and 60°C
+}
+
+// TempLimitsFor returns the limits for a category; ambient food is not monitored
+func TempLimitsFor(category string) (TempLimits, bool) {
+	l, ok := coldChainLimits[category]
+	return l, ok
+}
+
+// InRange reports whether a temperature is inside the safe band
+func (l TempLimits) InRange(tempC float64) bool {
+	return tempC >= l.MinC && tempC <= l.MaxC
+}
+
+// Excursion is a sustained period outside the safe band
+type Excursion struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	PeakC    float64   `json:"peak_c"` // Furthest reading from the safe band
+	Readings int       `json:"readings"`
+}
+
+// Duration is how long the food was out of range
+func (e *Excursion) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+// DetectExcursion scans a trace in time order and returns the first
+// out-of-range run that lasted longer than the grace period
+func DetectExcursion(limits TempLimits, trace []TemperatureReading) *Excursion {
+	readings := append([]TemperatureReading(nil), trace...)
+	sort.SliceStable(readings, func(i, j int) bool {
+		return readings[i].RecordedAt.Before(readings[j].RecordedAt)
+	})
+
+	var run *Excursion
+	for _, r := range readings {
+		if limits.InRange(r.TempC) {
+			run = nil
+			continue
+		}
+
+		if run == nil {
+			run = &Excursion{Start: r.RecordedAt, PeakC: r.TempC}
+		}
+		run.End = r.RecordedAt
+		run.Readings++
+		if limits.distance(r.TempC) > limits.distance(run.PeakC) {
+			run.PeakC = r.TempC
+		}
+		if run.Duration() > limits.Grace {
+			return run
+		}
+	}
+	return nil
+}
+
+// distance is how far a temperature sits outside the band (0 when inside)
+func (l TempLimits) distance(tempC float64) float64 {
+	if tempC < l.MinC {
+		return l.MinC - tempC
+	}
+	if tempC > l.MaxC {
+		return tempC - l.MaxC
+	}
+	return 0
+}
+
+// TelemetryRepository stores the raw sensor trace, which doubles as dispute evidence
+type TelemetryRepository interface {
+	Append(ctx context.Context, readings []TemperatureReading) error
+	ListByDelivery(ctx context.Context, deliveryID string) ([]TemperatureReading, error)
+}
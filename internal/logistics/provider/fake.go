@@ -0,0 +1,310 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/geo/s2"
+)
+
+const (
+	fakeBaseFare     = 9000.0 // IDR
+	fakePerKm        = 2500.0 // IDR, charged per started km
+	fakePickupETA    = 8 * time.Minute
+	fakeSpeedKmh     = 22.0
+	fakeMaxWeightKg  = 40.0
+	fakeQuoteTTL     = 5 * time.Minute
+	earthRadiusKm    = 6371.0
+	fakeTrackingBase = "https://track.fake-courier.test/"
+)
+
+// fakeLifecycle is the order the fake fleet walks a booking through on /advance
+var fakeLifecycle = []string{"DRIVER_ASSIGNED", "PICKED_UP", "DELIVERED"}
+
+// FakeConfig tunes the fake partner
+type FakeConfig struct {
+	APIKey        string
+	WebhookSecret string
+	ColdChain     bool             // Whether the fleet has refrigerated boxes
+	Now           func() time.Time // Defaults to time.Now; tests pin it
+}
+
+// FakeServer is a deterministic in-memory partner API speaking the HTTPProvider
+// wire format. Prices and ETAs depend only on the request, IDs are sequential
+// and bookings only move when /advance is called, so whole dispatch flows can
+// be exercised offline (go run ./cmd/fakecourier, or httptest in tests).
+type FakeServer struct {
+	cfg      FakeConfig
+	router   chi.Router
+	client   *http.Client
+	mu       sync.Mutex
+	seq      int
+	quotes   map[string]quoteRequest
+	bookings map[string]*fakeBooking
+}
+
+type fakeBooking struct {
+	req    bookingRequest
+	price  float64
+	step   int
+	status string
+	reason string
+}
+
+func NewFakeServer(cfg FakeConfig) *FakeServer {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	s := &FakeServer{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		quotes:   make(map[string]quoteRequest),
+		bookings: make(map[string]*fakeBooking),
+	}
+
+	r := chi.NewRouter()
+	r.Use(s.authenticate)
+	r.Post("/v1/quotes", s.quote)
+	r.Post("/v1/bookings", s.book)
+	r.Get("/v1/bookings/{id}", s.track)
+	r.Post("/v1/bookings/{id}/cancel", s.cancel)
+	// Test control: move the booking one step along its lifecycle and fire the webhook
+	r.Post("/v1/bookings/{id}/advance", s.advance)
+	s.router = r
+	return s
+}
+
+func (s *FakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+func (s *FakeServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.APIKey != "" && r.Header.Get("Authorization") != "Bearer "+s.cfg.APIKey {
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *FakeServer) quote(w http.ResponseWriter, r *http.Request) {
+	var req quoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if msg := s.decline(req.WeightKg, req.ColdChain); msg != "" {
+		http.Error(w, msg, http.StatusUnprocessableEntity)
+		return
+	}
+
+	km := distanceKm(req.Pickup, req.Dropoff)
+	s.mu.Lock()
+	id := s.nextID("Q")
+	s.quotes[id] = req
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, quoteResponse{
+		QuoteID:            id,
+		Price:              FakePrice(km),
+		PickupETASeconds:   int(fakePickupETA.Seconds()),
+		DeliveryETASeconds: int((fakePickupETA + FakeTravelTime(km)).Seconds()),
+		ExpiresAt:          s.cfg.Now().Add(fakeQuoteTTL).UTC(),
+	})
+}
+
+func (s *FakeServer) book(w http.ResponseWriter, r *http.Request) {
+	var req bookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if msg := s.decline(req.WeightKg, req.ColdChain); msg != "" {
+		http.Error(w, msg, http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.mu.Lock()
+	if req.QuoteID != "" {
+		if _, ok := s.quotes[req.QuoteID]; !ok {
+			s.mu.Unlock()
+			http.Error(w, "unknown quote", http.StatusUnprocessableEntity)
+			return
+		}
+		delete(s.quotes, req.QuoteID)
+	}
+	id := s.nextID("FAKE")
+	b := &fakeBooking{
+		req:    req,
+		price:  FakePrice(distanceKm(req.Pickup, req.Dropoff)),
+		status: fakeLifecycle[0],
+	}
+	s.bookings[id] = b
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, bookingResponse{
+		BookingID:   id,
+		Status:      b.status,
+		Price:       b.price,
+		TrackingURL: fakeTrackingBase + id,
+	})
+}
+
+func (s *FakeServer) track(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	payload, ok := s.statusLocked(chi.URLParam(r, "id"))
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "booking not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func (s *FakeServer) cancel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	id := chi.URLParam(r, "id")
+
+	s.mu.Lock()
+	b, ok := s.bookings[id]
+	if !ok {
+		s.mu.Unlock()
+		http.Error(w, "booking not found", http.StatusNotFound)
+		return
+	}
+	if b.status == "DELIVERED" {
+		s.mu.Unlock()
+		http.Error(w, "booking already delivered", http.StatusConflict)
+		return
+	}
+	b.status, b.reason = "CANCELLED", req.Reason
+	payload, _ := s.statusLocked(id)
+	s.mu.Unlock()
+
+	s.notify(b.req.CallbackURL, payload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *FakeServer) advance(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	s.mu.Lock()
+	b, ok := s.bookings[id]
+	if !ok {
+		s.mu.Unlock()
+		http.Error(w, "booking not found", http.StatusNotFound)
+		return
+	}
+	if b.status == "CANCELLED" || b.step == len(fakeLifecycle)-1 {
+		s.mu.Unlock()
+		http.Error(w, "booking is finished", http.StatusConflict)
+		return
+	}
+	b.step++
+	b.status = fakeLifecycle[b.step]
+	payload, _ := s.statusLocked(id)
+	s.mu.Unlock()
+
+	if err := s.notify(b.req.CallbackURL, payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+// statusLocked builds the tracking view; the driver sits at the last stop reached
+func (s *FakeServer) statusLocked(id string) (StatusPayload, bool) {
+	b, ok := s.bookings[id]
+	if !ok {
+		return StatusPayload{}, false
+	}
+	payload := StatusPayload{
+		BookingID:    id,
+		Status:       b.status,
+		CancelReason: b.reason,
+		Timestamp:    s.cfg.Now().UTC(),
+	}
+	if b.status == "CANCELLED" {
+		return payload, true
+	}
+
+	at := b.req.Pickup
+	if b.status == "DELIVERED" {
+		at = b.req.Dropoff
+		payload.PODPhotoURL = fakeTrackingBase + id + "/pod.jpg"
+	}
+	payload.Driver = &Driver{Name: "Driver " + id, Lat: at.Lat, Lng: at.Lng}
+	return payload, true
+}
+
+// notify posts a signed status callback, as the real partners do
+func (s *FakeServer) notify(callbackURL string, payload StatusPayload) error {
+	if callbackURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(s.cfg.WebhookSecret, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", callbackURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: status %d", callbackURL, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *FakeServer) decline(weightKg float64, coldChain bool) string {
+	switch {
+	case weightKg > fakeMaxWeightKg:
+		return fmt.Sprintf("max %.0f kg per booking", fakeMaxWeightKg)
+	case coldChain && !s.cfg.ColdChain:
+		return "no refrigerated vehicles available"
+	}
+	return ""
+}
+
+func (s *FakeServer) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s-%06d", prefix, s.seq)
+}
+
+// FakePrice is the fake fleet's tariff for a trip of km kilometres
+func FakePrice(km float64) float64 {
+	return fakeBaseFare + fakePerKm*math.Ceil(km)
+}
+
+// FakeTravelTime is how long the fake fleet takes from pickup to dropoff
+func FakeTravelTime(km float64) time.Duration {
+	return time.Duration(km / fakeSpeedKmh * float64(time.Hour)).Round(time.Second)
+}
+
+func distanceKm(a, b point) float64 {
+	return s2.LatLngFromDegrees(a.Lat, a.Lng).Distance(s2.LatLngFromDegrees(b.Lat, b.Lng)).Radians() * earthRadiusKm
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
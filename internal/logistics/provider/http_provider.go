@@ -0,0 +1,280 @@
+// Package provider adapts third-party courier fleets to domain.CourierProvider.
+//
+// Aggregators such as Gojek, Grab and Lalamove expose near-identical partner
+// APIs (quote → book → track/cancel, plus signed status callbacks) that differ
+// mostly in status vocabulary. HTTPProvider speaks that common shape; each
+// partner is configured with its base URL, credentials and a status map.
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the webhook body
+const SignatureHeader = "X-Signature"
+
+// DefaultStatusMap covers the vocabulary shared by most Indonesian aggregators
+var DefaultStatusMap = map[string]domain.DeliveryStatus{
+	"ALLOCATING":       domain.DeliverySearching,
+	"DRIVER_ASSIGNED":  domain.DeliveryAssigned,
+	"OUT_FOR_PICKUP":   domain.DeliveryAssigned,
+	"PICKED_UP":        domain.DeliveryPickedUp,
+	"OUT_FOR_DELIVERY": domain.DeliveryPickedUp,
+	"DELIVERED":        domain.DeliveryDelivered,
+	"COMPLETED":        domain.DeliveryDelivered,
+	"CANCELLED":        domain.DeliveryFailed,
+	"NO_DRIVER":        domain.DeliveryFailed,
+	"RETURNED":         domain.DeliveryFailed,
+}
+
+// Config describes one partner account
+type Config struct {
+	Name          string
+	BaseURL       string
+	APIKey        string
+	WebhookSecret string
+	CallbackURL   string                           // Where the partner posts status updates
+	StatusMap     map[string]domain.DeliveryStatus // Defaults to DefaultStatusMap
+	Timeout       time.Duration                    // Defaults to 5s; quotes are on the claim path
+}
+
+// HTTPProvider is a CourierProvider backed by a partner REST API
+type HTTPProvider struct {
+	cfg    Config
+	client *http.Client
+}
+
+func NewHTTPProvider(cfg Config) *HTTPProvider {
+	if cfg.StatusMap == nil {
+		cfg.StatusMap = DefaultStatusMap
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	return &HTTPProvider{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// Wire format of the partner API
+
+type point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+type quoteRequest struct {
+	Pickup    point   `json:"pickup"`
+	Dropoff   point   `json:"dropoff"`
+	WeightKg  float64 `json:"weight_kg"`
+	ColdChain bool    `json:"cold_chain"`
+}
+
+type quoteResponse struct {
+	QuoteID            string    `json:"quote_id"`
+	Price              float64   `json:"price"`
+	PickupETASeconds   int       `json:"pickup_eta_seconds"`
+	DeliveryETASeconds int       `json:"delivery_eta_seconds"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+type bookingRequest struct {
+	QuoteID         string  `json:"quote_id"`
+	MerchantOrderID string  `json:"merchant_order_id"`
+	Pickup          point   `json:"pickup"`
+	Dropoff         point   `json:"dropoff"`
+	WeightKg        float64 `json:"weight_kg"`
+	ColdChain       bool    `json:"cold_chain"`
+	CallbackURL     string  `json:"callback_url,omitempty"`
+}
+
+type bookingResponse struct {
+	BookingID   string  `json:"booking_id"`
+	Status      string  `json:"status"`
+	Price       float64 `json:"price"`
+	TrackingURL string  `json:"tracking_url"`
+}
+
+// StatusPayload is both the GET /bookings/{id} response and the webhook body
+type StatusPayload struct {
+	BookingID    string    `json:"booking_id"`
+	Status       string    `json:"status"`
+	Driver       *Driver   `json:"driver,omitempty"`
+	PODPhotoURL  string    `json:"pod_photo_url,omitempty"`
+	CancelReason string    `json:"cancel_reason,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+type Driver struct {
+	Name string  `json:"name"`
+	Lat  float64 `json:"lat"`
+	Lng  float64 `json:"lng"`
+}
+
+func (p *HTTPProvider) Name() string { return p.cfg.Name }
+
+func (p *HTTPProvider) Quote(ctx context.Context, req domain.ShipmentRequest) (*domain.Quote, error) {
+	var res quoteResponse
+	body := quoteRequest{
+		Pickup:    point{req.PickupLat, req.PickupLon},
+		Dropoff:   point{req.DropoffLat, req.DropoffLon},
+		WeightKg:  req.WeightKg,
+		ColdChain: req.RequiresColdChain,
+	}
+	if err := p.do(ctx, http.MethodPost, "/v1/quotes", body, &res); err != nil {
+		return nil, err
+	}
+	return &domain.Quote{
+		Provider:   p.cfg.Name,
+		QuoteID:    res.QuoteID,
+		Fee:        res.Price,
+		PickupETA:  time.Duration(res.PickupETASeconds) * time.Second,
+		DropoffETA: time.Duration(res.DeliveryETASeconds) * time.Second,
+		ExpiresAt:  res.ExpiresAt,
+	}, nil
+}
+
+func (p *HTTPProvider) Book(ctx context.Context, req domain.ShipmentRequest, quoteID string) (*domain.Booking, error) {
+	var res bookingResponse
+	body := bookingRequest{
+		QuoteID:         quoteID,
+		MerchantOrderID: req.DeliveryID,
+		Pickup:          point{req.PickupLat, req.PickupLon},
+		Dropoff:         point{req.DropoffLat, req.DropoffLon},
+		WeightKg:        req.WeightKg,
+		ColdChain:       req.RequiresColdChain,
+		CallbackURL:     p.cfg.CallbackURL,
+	}
+	if err := p.do(ctx, http.MethodPost, "/v1/bookings", body, &res); err != nil {
+		return nil, err
+	}
+
+	status, ok := p.cfg.StatusMap[res.Status]
+	if !ok {
+		status = domain.DeliveryAssigned
+	}
+	return &domain.Booking{
+		Provider:    p.cfg.Name,
+		ExternalID:  res.BookingID,
+		Fee:         res.Price,
+		TrackingURL: res.TrackingURL,
+		Status:      status,
+	}, nil
+}
+
+func (p *HTTPProvider) Cancel(ctx context.Context, externalID, reason string) error {
+	body := map[string]string{"reason": reason}
+	return p.do(ctx, http.MethodPost, "/v1/bookings/"+url.PathEscape(externalID)+"/cancel", body, nil)
+}
+
+func (p *HTTPProvider) Track(ctx context.Context, externalID string) (*domain.TrackingUpdate, error) {
+	var res StatusPayload
+	if err := p.do(ctx, http.MethodGet, "/v1/bookings/"+url.PathEscape(externalID), nil, &res); err != nil {
+		return nil, err
+	}
+	return p.normalize(res)
+}
+
+func (p *HTTPProvider) ParseWebhook(body []byte, signature string) (*domain.TrackingUpdate, error) {
+	if !VerifySignature(p.cfg.WebhookSecret, body, signature) {
+		return nil, domain.ErrInvalidWebhookSignature
+	}
+	var payload StatusPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("decode %s webhook: %w", p.cfg.Name, err)
+	}
+	return p.normalize(payload)
+}
+
+func (p *HTTPProvider) normalize(payload StatusPayload) (*domain.TrackingUpdate, error) {
+	status, ok := p.cfg.StatusMap[payload.Status]
+	if !ok {
+		return nil, fmt.Errorf("%s status %q: %w", p.cfg.Name, payload.Status, domain.ErrUnmappedProviderStatus)
+	}
+	u := &domain.TrackingUpdate{
+		Provider:       p.cfg.Name,
+		ExternalID:     payload.BookingID,
+		Status:         status,
+		ProviderStatus: payload.Status,
+		PhotoURL:       payload.PODPhotoURL,
+		Reason:         payload.CancelReason,
+		At:             payload.Timestamp,
+	}
+	if payload.Driver != nil {
+		u.DriverName, u.Lat, u.Lon = payload.Driver.Name, payload.Driver.Lat, payload.Driver.Lng
+	}
+	return u, nil
+}
+
+func (p *HTTPProvider) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.cfg.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.cfg.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", p.cfg.Name, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusUnprocessableEntity:
+		// Partner declined the shipment (out of area, too heavy, no cold chain)
+		return fmt.Errorf("%s %s: %w", p.cfg.Name, path, domain.ErrProviderUnavailable)
+	case resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: status %d: %s", p.cfg.Name, path, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s %s: decode: %w", p.cfg.Name, path, err)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 a partner puts in SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a webhook body against its signature in constant time
+func VerifySignature(secret string, body []byte, signature string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+const testSecret = "whsec-test"
+
+var pinned = time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+// Menteng to Tebet, roughly 6km
+var shipment = domain.ShipmentRequest{
+	DeliveryID: "d1",
+	PickupLat:  -6.1950, PickupLon: 106.8300,
+	DropoffLat: -6.2260, DropoffLon: 106.8560,
+	WeightKg: 8,
+}
+
+type webhookSink struct {
+	mu      sync.Mutex
+	updates []*domain.TrackingUpdate
+	errs    []error
+}
+
+func newFakePartner(t *testing.T, coldChain bool) (*HTTPProvider, *webhookSink) {
+	t.Helper()
+	sink := &webhookSink{}
+	var p *HTTPProvider
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		u, err := p.ParseWebhook(body, r.Header.Get(SignatureHeader))
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		if err != nil {
+			sink.errs = append(sink.errs, err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		sink.updates = append(sink.updates, u)
+	}))
+	t.Cleanup(receiver.Close)
+
+	fake := httptest.NewServer(NewFakeServer(FakeConfig{
+		APIKey:        "key",
+		WebhookSecret: testSecret,
+		ColdChain:     coldChain,
+		Now:           func() time.Time { return pinned },
+	}))
+	t.Cleanup(fake.Close)
+
+	p = NewHTTPProvider(Config{
+		Name:          "fake",
+		BaseURL:       fake.URL,
+		APIKey:        "key",
+		WebhookSecret: testSecret,
+		CallbackURL:   receiver.URL,
+	})
+	return p, sink
+}
+
+func advance(t *testing.T, p *HTTPProvider, id string) {
+	t.Helper()
+	if err := p.do(context.Background(), http.MethodPost, "/v1/bookings/"+id+"/advance", nil, nil); err != nil {
+		t.Fatalf("advance %s: %v", id, err)
+	}
+}
+
+func TestFakePartner_QuoteBookAndWebhookLifecycle(t *testing.T) {
+	ctx := context.Background()
+	p, sink := newFakePartner(t, false)
+
+	q, err := p.Quote(ctx, shipment)
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	km := distanceKm(point{shipment.PickupLat, shipment.PickupLon}, point{shipment.DropoffLat, shipment.DropoffLon})
+	if q.Fee != FakePrice(km) || q.QuoteID != "Q-000001" {
+		t.Errorf("Expected deterministic quote Q-000001 at %.0f, got %+v", FakePrice(km), q)
+	}
+	if q.DropoffETA != fakePickupETA+FakeTravelTime(km) || !q.ExpiresAt.Equal(pinned.Add(fakeQuoteTTL)) {
+		t.Errorf("Unexpected ETA/expiry: %+v", q)
+	}
+
+	b, err := p.Book(ctx, shipment, q.QuoteID)
+	if err != nil {
+		t.Fatalf("Book: %v", err)
+	}
+	if b.ExternalID != "FAKE-000002" || b.Status != domain.DeliveryAssigned || b.Fee != q.Fee {
+		t.Errorf("Unexpected booking: %+v", b)
+	}
+
+	advance(t, p, b.ExternalID)
+	advance(t, p, b.ExternalID)
+
+	if len(sink.errs) != 0 {
+		t.Fatalf("Webhooks rejected: %v", sink.errs)
+	}
+	if len(sink.updates) != 2 {
+		t.Fatalf("Expected 2 webhooks, got %d", len(sink.updates))
+	}
+	if got := sink.updates[0]; got.Status != domain.DeliveryPickedUp || got.ProviderStatus != "PICKED_UP" {
+		t.Errorf("Expected normalised picked_up, got %+v", got)
+	}
+	final := sink.updates[1]
+	if final.Status != domain.DeliveryDelivered || final.PhotoURL == "" || final.Lat != shipment.DropoffLat {
+		t.Errorf("Expected delivered at the dropoff with a POD photo, got %+v", final)
+	}
+
+	tracked, err := p.Track(ctx, b.ExternalID)
+	if err != nil || tracked.Status != domain.DeliveryDelivered {
+		t.Errorf("Expected Track to report delivered, got %+v (%v)", tracked, err)
+	}
+}
+
+func TestFakePartner_DeclinesColdChainWithoutReefer(t *testing.T) {
+	p, _ := newFakePartner(t, false)
+	req := shipment
+	req.RequiresColdChain = true
+
+	if _, err := p.Quote(context.Background(), req); !errors.Is(err, domain.ErrProviderUnavailable) {
+		t.Errorf("Expected ErrProviderUnavailable, got %v", err)
+	}
+}
+
+func TestParseWebhook_RejectsBadSignatureAndUnknownStatus(t *testing.T) {
+	p := NewHTTPProvider(Config{Name: "fake", WebhookSecret: testSecret})
+	body := []byte(`{"booking_id":"FAKE-1","status":"PICKED_UP"}`)
+
+	if _, err := p.ParseWebhook(body, Sign("wrong", body)); !errors.Is(err, domain.ErrInvalidWebhookSignature) {
+		t.Errorf("Expected ErrInvalidWebhookSignature, got %v", err)
+	}
+
+	odd := []byte(`{"booking_id":"FAKE-1","status":"DRIVER_NEARBY"}`)
+	if _, err := p.ParseWebhook(odd, Sign(testSecret, odd)); !errors.Is(err, domain.ErrUnmappedProviderStatus) {
+		t.Errorf("Expected ErrUnmappedProviderStatus, got %v", err)
+	}
+}
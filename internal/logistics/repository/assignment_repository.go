@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+type assignmentRepository struct {
+	db *sql.DB
+}
+
+func NewAssignmentRepository(db *sql.DB) domain.AssignmentRepository {
+	return &assignmentRepository{db: db}
+}
+
+const assignmentColumns = `batch_id, batch, courier_id, status, rejected_by, offer_expires_at, created_at, updated_at`
+
+func (r *assignmentRepository) Create(ctx context.Context, a *domain.Assignment) error {
+	batch, err := json.Marshal(a.Batch)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO courier_assignments (batch_id, batch, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err = r.db.ExecContext(ctx, query, a.BatchID, batch, a.Status, a.CreatedAt, a.UpdatedAt)
+	return err
+}
+
+func (r *assignmentRepository) Get(ctx context.Context, batchID string) (*domain.Assignment, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+assignmentColumns+` FROM courier_assignments WHERE batch_id = $1`, batchID)
+	a, err := scanAssignment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrOfferNotFound
+	}
+	return a, err
+}
+
+func (r *assignmentRepository) ListSearching(ctx context.Context, limit int) ([]domain.Assignment, error) {
+	return r.list(ctx, `
+		SELECT `+assignmentColumns+` FROM courier_assignments
+		WHERE status = 'SEARCHING'
+		ORDER BY created_at ASC
+		LIMIT $1
+	`, limit)
+}
+
+// ListActive returns batches not yet completed, oldest first
+func (r *assignmentRepository) ListActive(ctx context.Context, limit int) ([]domain.Assignment, error) {
+	return r.list(ctx, `
+		SELECT `+assignmentColumns+` FROM courier_assignments
+		WHERE status IN ('SEARCHING', 'OFFERED', 'ACCEPTED')
+		ORDER BY created_at ASC
+		LIMIT $1
+	`, limit)
+}
+
+func (r *assignmentRepository) ListByCourier(ctx context.Context, courierID string) ([]domain.Assignment, error) {
+	return r.list(ctx, `
+		SELECT `+assignmentColumns+` FROM courier_assignments
+		WHERE courier_id = $1 AND status IN ('OFFERED', 'ACCEPTED')
+		ORDER BY created_at ASC
+	`, courierID)
+}
+
+func (r *assignmentRepository) UpdateBatch(ctx context.Context, batchID string, batch domain.Batch) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE courier_assignments SET batch = $2, updated_at = NOW() WHERE batch_id = $1`
+	return execOne(ctx, r.db, domain.ErrOfferNotFound, query, batchID, data)
+}
+
+func (r *assignmentRepository) UpdateSearchingBatch(ctx context.Context, batchID string, batch domain.Batch, seenAt time.Time) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE courier_assignments SET batch = $2, updated_at = NOW()
+		WHERE batch_id = $1 AND status = 'SEARCHING' AND updated_at = $3
+	`
+	return execOne(ctx, r.db, domain.ErrOfferNotFound, query, batchID, data, seenAt)
+}
+
+func (r *assignmentRepository) Offer(ctx context.Context, batchID, courierID string, expiresAt time.Time) error {
+	// A courier holds at most one open offer at a time
+	query := `
+		UPDATE courier_assignments
+		SET status = 'OFFERED', courier_id = $2, offer_expires_at = $3, updated_at = NOW()
+		WHERE batch_id = $1 AND status = 'SEARCHING'
+		  AND NOT EXISTS (
+		      SELECT 1 FROM courier_assignments
+		      WHERE courier_id = $2 AND status = 'OFFERED'
+		  )
+	`
+	return execOne(ctx, r.db, domain.ErrOfferNotFound, query, batchID, courierID, expiresAt)
+}
+
+func (r *assignmentRepository) Respond(ctx context.Context, batchID, courierID string, accept bool, now time.Time) error {
+	query := `
+		UPDATE courier_assignments
+		SET status = 'SEARCHING', courier_id = NULL, offer_expires_at = NULL,
+		    rejected_by = array_append(rejected_by, courier_id), updated_at = NOW()
+		WHERE batch_id = $1 AND courier_id = $2 AND status = 'OFFERED' AND offer_expires_at > $3
+	`
+	if accept {
+		query = `
+			UPDATE courier_assignments
+			SET status = 'ACCEPTED', offer_expires_at = NULL, updated_at = NOW()
+			WHERE batch_id = $1 AND courier_id = $2 AND status = 'OFFERED' AND offer_expires_at > $3
+		`
+	}
+	return execOne(ctx, r.db, domain.ErrOfferNotFound, query, batchID, courierID, now)
+}
+
+// ExpireOffers treats unanswered offers as rejections and puts the batch back in the pool
+func (r *assignmentRepository) ExpireOffers(ctx context.Context, now time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE courier_assignments
+		SET status = 'SEARCHING', courier_id = NULL, offer_expires_at = NULL,
+		    rejected_by = array_append(rejected_by, courier_id), updated_at = NOW()
+		WHERE status = 'OFFERED' AND offer_expires_at <= $1
+	`, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CompleteByCourier closes the courier's accepted batches once their deliveries are done
+func (r *assignmentRepository) CompleteByCourier(ctx context.Context, courierID string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE courier_assignments
+		SET status = 'COMPLETED', updated_at = NOW()
+		WHERE courier_id = $1 AND status = 'ACCEPTED'
+	`, courierID)
+	return err
+}
+
+func (r *assignmentRepository) list(ctx context.Context, query string, args ...interface{}) ([]domain.Assignment, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var assignments []domain.Assignment
+	for rows.Next() {
+		a, err := scanAssignment(rows)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, *a)
+	}
+	return assignments, rows.Err()
+}
+
+func scanAssignment(row rowScanner) (*domain.Assignment, error) {
+	var a domain.Assignment
+	var batch []byte
+	var courierID sql.NullString
+	var expiresAt sql.NullTime
+	err := row.Scan(&a.BatchID, &batch, &courierID, &a.Status, pq.Array(&a.RejectedBy),
+		&expiresAt, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(batch, &a.Batch); err != nil {
+		return nil, err
+	}
+	a.CourierID = courierID.String
+	if expiresAt.Valid {
+		a.OfferExpiresAt = &expiresAt.Time
+	}
+	return &a, nil
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+type courierRepository struct {
+	db *sql.DB
+}
+
+func NewCourierRepository(db *sql.DB) domain.CourierRepository {
+	return &courierRepository{db: db}
+}
+
+const courierColumns = `id, user_id, vehicle_type, capacity_kg, thermal_bag_certified_until, status, shift_started_at, created_at, updated_at`
+
+func (r *courierRepository) Create(ctx context.Context, c *domain.Courier) error {
+	query := `
+		INSERT INTO couriers (id, user_id, vehicle_type, capacity_kg, thermal_bag_certified_until, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		c.ID, c.UserID, c.VehicleType, c.CapacityKg, c.ThermalBagCertifiedUntil, c.Status, c.CreatedAt, c.UpdatedAt)
+	return err
+}
+
+func (r *courierRepository) GetByID(ctx context.Context, id string) (*domain.Courier, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+courierColumns+` FROM couriers WHERE id = $1`, id)
+	c, err := scanCourier(row)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrCourierNotFound
+	}
+	return c, err
+}
+
+func (r *courierRepository) GetByUserID(ctx context.Context, userID string) (*domain.Courier, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+courierColumns+` FROM couriers WHERE user_id = $1`, userID)
+	c, err := scanCourier(row)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrCourierNotFound
+	}
+	return c, err
+}
+
+func (r *courierRepository) ListByIDs(ctx context.Context, ids []string) ([]domain.Courier, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+courierColumns+` FROM couriers WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var couriers []domain.Courier
+	for rows.Next() {
+		c, err := scanCourier(rows)
+		if err != nil {
+			return nil, err
+		}
+		couriers = append(couriers, *c)
+	}
+	return couriers, rows.Err()
+}
+
+func (r *courierRepository) UpdateStatus(ctx context.Context, id string, status domain.CourierStatus) error {
+	// Shift start is stamped when the courier comes online and cleared when they go offline
+	query := `
+		UPDATE couriers
+		SET status = $2,
+		    shift_started_at = CASE
+		        WHEN $2 = 'OFFLINE' THEN NULL
+		        WHEN status = 'OFFLINE' THEN NOW()
+		        ELSE shift_started_at
+		    END,
+		    updated_at = NOW()
+		WHERE id = $1
+	`
+	return execOne(ctx, r.db, domain.ErrCourierNotFound, query, id, status)
+}
+
+func (r *courierRepository) UpdateCertification(ctx context.Context, id string, validUntil *time.Time) error {
+	query := `UPDATE couriers SET thermal_bag_certified_until = $2, updated_at = NOW() WHERE id = $1`
+	return execOne(ctx, r.db, domain.ErrCourierNotFound, query, id, validUntil)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCourier(row rowScanner) (*domain.Courier, error) {
+	var c domain.Courier
+	var certifiedUntil, shiftStarted sql.NullTime
+	err := row.Scan(&c.ID, &c.UserID, &c.VehicleType, &c.CapacityKg, &certifiedUntil,
+		&c.Status, &shiftStarted, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if certifiedUntil.Valid {
+		c.ThermalBagCertifiedUntil = &certifiedUntil.Time
+	}
+	if shiftStarted.Valid {
+		c.ShiftStartedAt = &shiftStarted.Time
+	}
+	return &c, nil
+}
+
+// execOne runs a conditional UPDATE and maps "no row matched" to notFound
+func execOne(ctx context.Context, db *sql.DB, notFound error, query string, args ...interface{}) error {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/outbox"
+)
+
+type deliveryRepository struct {
+	db     *sql.DB
+	outbox outbox.Repository
+}
+
+func NewDeliveryRepository(db *sql.DB, outboxRepo outbox.Repository) domain.DeliveryRepository {
+	return &deliveryRepository{db: db, outbox: outboxRepo}
+}
+
+const deliverySelect = `
+	SELECT d.id, d.surplus_id, s.provider_id, n.id, COALESCE(n.id::TEXT, pay.customer_id, ''), d.courier_id,
+	       COALESCE(d.courier_provider, ''), COALESCE(d.external_tracking_id, ''), d.status, COALESCE(d.sla_tier, ''),
+	       COALESCE(d.requires_cold_chain, false), COALESCE(s.temperature_category, 'ambient'),
+	       COALESCE(d.food_unsafe, false), s.quantity_kgs, COALESCE(s.food_type, ''),
+	       COALESCE(s.is_donation, true), d.fee_breakdown,
+	       ST_Y(p.location::geometry), ST_X(p.location::geometry),
+	       ST_Y(n.location::geometry), ST_X(n.location::geometry),
+	       d.dropoff_otp, d.picked_up_at, d.delivered_at, d.created_at, d.updated_at
+	FROM deliveries d
+	JOIN surplus s ON s.id = d.surplus_id
+	JOIN providers p ON p.id = s.provider_id
+	LEFT JOIN ngos n ON n.id = s.claimed_by_ngo_id
+	LEFT JOIN payments pay ON pay.order_id = d.surplus_id::TEXT
+`
+
+func (r *deliveryRepository) Get(ctx context.Context, id string) (*domain.Delivery, error) {
+	return r.get(ctx, deliverySelect+`WHERE d.id = $1`, id)
+}
+
+func (r *deliveryRepository) GetByExternalID(ctx context.Context, provider, externalID string) (*domain.Delivery, error) {
+	return r.get(ctx, deliverySelect+`WHERE d.courier_provider = $1 AND d.external_tracking_id = $2`, provider, externalID)
+}
+
+func (r *deliveryRepository) get(ctx context.Context, query string, args ...interface{}) (*domain.Delivery, error) {
+	var d domain.Delivery
+	var ngoID, courierID, otp sql.NullString
+	var ngoLat, ngoLon sql.NullFloat64
+	var pickedUpAt, deliveredAt sql.NullTime
+	var fee []byte
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+		&d.ID, &d.SurplusID, &d.ProviderID, &ngoID, &d.RecipientID, &courierID,
+		&d.Provider, &d.ExternalID, &d.Status, &d.SLATier,
+		&d.RequiresColdChain, &d.TempCategory, &d.FoodUnsafe, &d.QuantityKg, &d.FoodType,
+		&d.IsDonation, &fee,
+		&d.ProviderLat, &d.ProviderLon, &ngoLat, &ngoLon,
+		&otp, &pickedUpAt, &deliveredAt, &d.CreatedAt, &d.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.NGOID = ngoID.String
+	d.CourierID = courierID.String
+	d.NGOLat, d.NGOLon = ngoLat.Float64, ngoLon.Float64
+	d.DropoffOTP = otp.String
+	if pickedUpAt.Valid {
+		d.PickedUpAt = &pickedUpAt.Time
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	if len(fee) > 0 {
+		d.Fee = &domain.FeeBreakdown{}
+		if err := json.Unmarshal(fee, d.Fee); err != nil {
+			return nil, fmt.Errorf("delivery %s fee breakdown: %w", d.ID, err)
+		}
+	}
+	return &d, nil
+}
+
+func (r *deliveryRepository) Apply(ctx context.Context, t domain.DeliveryTransition, event outbox.Event) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := applyTransition(ctx, tx, t); err != nil {
+		return err
+	}
+
+	if t.Checkin != nil {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO pickup_checkins (delivery_id, provider_id, courier_id, checked_at, location)
+			VALUES ($1, $2, $3, $4, ST_SetSRID(ST_MakePoint($5, $6), 4326))
+		`, t.Checkin.DeliveryID, t.Checkin.ProviderID, t.Checkin.CourierID, t.Checkin.CheckedAt, t.Checkin.Lon, t.Checkin.Lat)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := r.outbox.Save(ctx, tx, event); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applyTransition only touches the row if it is still in t.From (and, past
+// searching, still held by the same courier or provider booking), so
+// concurrent updates cannot both win
+func applyTransition(ctx context.Context, tx *sql.Tx, t domain.DeliveryTransition) error {
+	holder, holderID := "courier_id = $2", t.CourierID
+	if t.ExternalID != "" {
+		holder, holderID = "external_tracking_id = $2", t.ExternalID
+	}
+
+	var query string
+	args := []interface{}{t.DeliveryID, holderID, t.From, t.At}
+
+	switch t.To {
+	case domain.DeliveryAssigned:
+		if t.Booking != nil {
+			query = `
+				UPDATE deliveries
+				SET status = 'assigned', courier_provider = $5, external_tracking_id = $2, fee = $6, updated_at = $4
+				WHERE id = $1 AND status = $3
+			`
+			args = append(args, t.Booking.Provider, t.Booking.Fee)
+			break
+		}
+		query = `
+			UPDATE deliveries SET status = 'assigned', courier_id = $2, updated_at = $4
+			WHERE id = $1 AND status = $3
+		`
+	case domain.DeliveryPickedUp:
+		query = `
+			UPDATE deliveries SET status = 'picked_up', dropoff_otp = NULLIF($5, ''), picked_up_at = $4, updated_at = $4
+			WHERE id = $1 AND ` + holder + ` AND status = $3
+		`
+		args = append(args, t.DropoffOTP)
+	case domain.DeliveryDelivered:
+		if t.Proof == nil {
+			return fmt.Errorf("delivery %s: proof of delivery required", t.DeliveryID)
+		}
+		query = `
+			UPDATE deliveries
+			SET status = 'delivered', proof_photo_ref = $5,
+			    dropoff_location = ST_SetSRID(ST_MakePoint($6, $7), 4326),
+			    delivered_at = $4, updated_at = $4
+			WHERE id = $1 AND ` + holder + ` AND status = $3
+		`
+		args = append(args, t.Proof.PhotoRef, t.Proof.Lon, t.Proof.Lat)
+	case domain.DeliveryFailed:
+		query = `
+			UPDATE deliveries SET status = 'failed', failure_reason = $5, food_unsafe = $6, updated_at = $4
+			WHERE id = $1 AND ` + holder + ` AND status = $3
+		`
+		args = append(args, t.FailureReason, t.FoodUnsafe)
+	default:
+		return domain.ErrInvalidTransition
+	}
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrInvalidTransition
+	}
+	return nil
+}
+
+func (r *deliveryRepository) CountActiveByCourier(ctx context.Context, courierID string) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM deliveries
+		WHERE courier_id = $1 AND status IN ('assigned', 'picked_up')
+	`, courierID).Scan(&n)
+	return n, err
+}
+
+func (r *deliveryRepository) SetSLATier(ctx context.Context, id string, tier domain.DeliverySLA) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE deliveries SET sla_tier = NULLIF($2, ''), updated_at = NOW() WHERE id = $1
+	`, id, string(tier))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return domain.ErrDeliveryNotFound
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+type earningsRepository struct {
+	db *sql.DB
+}
+
+func NewEarningsRepository(db *sql.DB) domain.EarningsRepository {
+	return &earningsRepository{db: db}
+}
+
+func (r *earningsRepository) SetDeliveryFee(ctx context.Context, deliveryID string, fee domain.FeeBreakdown) error {
+	data, err := json.Marshal(fee)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE deliveries
+		SET fee = $2, fee_subsidy = $3, courier_points = $4, fee_breakdown = $5, updated_at = NOW()
+		WHERE id = $1
+	`
+	return execOne(ctx, r.db, domain.ErrDeliveryNotFound, query, deliveryID, fee.Total, fee.Subsidy, fee.CourierPoints, data)
+}
+
+// ReserveSubsidy locks the month's budget row, so concurrent pricing can never
+// overspend it. A delivery that was already subsidised gets its earlier grant back.
+func (r *earningsRepository) ReserveSubsidy(ctx context.Context, deliveryID string, at time.Time, amount money.Money) (money.Money, error) {
+	none := money.Rupiah(0)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return none, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var granted money.Money
+	err = tx.QueryRowContext(ctx, `SELECT amount FROM delivery_subsidies WHERE delivery_id = $1`, deliveryID).Scan(&granted)
+	if err == nil {
+		return granted, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return none, err
+	}
+
+	month := monthOf(at)
+	var budget, spent money.Money
+	err = tx.QueryRowContext(ctx, `
+		SELECT budget, spent FROM subsidy_budgets WHERE month = $1 FOR UPDATE
+	`, month).Scan(&budget, &spent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return none, nil // No budget configured this month
+	}
+	if err != nil {
+		return none, err
+	}
+
+	granted = money.Min(budget.Sub(spent), amount)
+	if !granted.IsPositive() {
+		return none, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE subsidy_budgets SET spent = spent + $2, updated_at = NOW() WHERE month = $1
+	`, month, granted); err != nil {
+		return none, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO delivery_subsidies (delivery_id, month, amount) VALUES ($1, $2, $3)
+	`, deliveryID, month, granted); err != nil {
+		return none, err
+	}
+	return granted, tx.Commit()
+}
+
+func (r *earningsRepository) SetSubsidyBudget(ctx context.Context, month time.Time, budget money.Money) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO subsidy_budgets (month, budget) VALUES ($1, $2)
+		ON CONFLICT (month) DO UPDATE SET budget = EXCLUDED.budget, updated_at = NOW()
+	`, monthOf(month), budget)
+	return err
+}
+
+func (r *earningsRepository) GetSubsidyBudget(ctx context.Context, month time.Time) (*domain.SubsidyBudget, error) {
+	b := domain.SubsidyBudget{Month: monthOf(month)}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT budget, spent FROM subsidy_budgets WHERE month = $1
+	`, b.Month).Scan(&b.Budget, &b.Spent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *earningsRepository) Append(ctx context.Context, e *domain.EarningEntry) (bool, error) {
+	var deliveryID sql.NullString
+	if e.DeliveryID != "" {
+		deliveryID = sql.NullString{String: e.DeliveryID, Valid: true}
+	}
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO courier_earnings (courier_id, delivery_id, kind, amount, points, available_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (delivery_id, kind) WHERE kind = 'DELIVERY' DO NOTHING
+		RETURNING id, created_at
+	`, e.CourierID, deliveryID, e.Kind, e.Amount, e.Points, e.AvailableAt).Scan(&e.ID, &e.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Summary splits the balance into what can be paid out now and what is still on hold.
+// Payouts and adjustments count immediately; delivery earnings once their hold ends.
+func (r *earningsRepository) Summary(ctx context.Context, courierID string, now time.Time) (*domain.EarningsSummary, error) {
+	s := domain.EarningsSummary{CourierID: courierID, AsOf: now}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE kind = 'DELIVERY'),
+		       COALESCE(SUM(amount) FILTER (WHERE amount > 0), 0),
+		       COALESCE(-SUM(amount) FILTER (WHERE kind = 'PAYOUT'), 0),
+		       COALESCE(SUM(amount), 0),
+		       COALESCE(SUM(amount) FILTER (WHERE kind = 'DELIVERY' AND available_at > $2), 0),
+		       COALESCE(SUM(points), 0)
+		FROM courier_earnings
+		WHERE courier_id = $1
+	`, courierID, now).Scan(&s.Deliveries, &s.Earned, &s.PaidOut, &s.Balance, &s.OnHold, &s.Points)
+	if err != nil {
+		return nil, err
+	}
+	s.PayoutEligible = money.Max(s.Balance.Sub(s.OnHold), money.Rupiah(0))
+	return &s, nil
+}
+
+func (r *earningsRepository) ListByCourier(ctx context.Context, courierID string, limit int) ([]domain.EarningEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, courier_id, COALESCE(delivery_id::text, ''), kind, amount, points, available_at, created_at
+		FROM courier_earnings
+		WHERE courier_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, courierID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var entries []domain.EarningEntry
+	for rows.Next() {
+		var e domain.EarningEntry
+		if err := rows.Scan(&e.ID, &e.CourierID, &e.DeliveryID, &e.Kind, &e.Amount, &e.Points, &e.AvailableAt, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func monthOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
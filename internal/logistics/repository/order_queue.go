@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+const (
+	PendingOrdersKey     = "logistics:pending_orders"     // HASH order_id -> order JSON
+	DispatchDeadlinesKey = "logistics:dispatch_deadlines" // ZSET order_id -> dispatch-by (unix ms)
+	InFlightOrdersKey    = "logistics:inflight_orders"    // HASH order_id -> order JSON, taken but not acked
+	DispatchLeasesKey    = "logistics:dispatch_leases"    // ZSET order_id -> lease end (unix ms)
+
+	// DispatchLease is how long a taken order waits for its ack before it is
+	// dispatched again
+	DispatchLease = time.Minute
+)
+
+// takeScript moves the given orders onto a lease ending at ARGV[1], in one
+// atomic step. An ID only counts as taken if this call was the one that
+// removed it from the deadline ZSET.
+var takeScript = redis.NewScript(`
+local taken = {}
+for i = 2, #ARGV do
+	local id = ARGV[i]
+	if redis.call('ZREM', KEYS[2], id) == 1 then
+		local v = redis.call('HGET', KEYS[1], id)
+		redis.call('HDEL', KEYS[1], id)
+		if v then
+			redis.call('HSET', KEYS[3], id, v)
+			redis.call('ZADD', KEYS[4], ARGV[1], id)
+			table.insert(taken, v)
+		end
+	end
+end
+return taken
+`)
+
+// takeDueScript leases up to ARGV[2] orders whose deadline is <= ARGV[1],
+// until ARGV[3].
+var takeDueScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+local taken = {}
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[2], id)
+	local v = redis.call('HGET', KEYS[1], id)
+	redis.call('HDEL', KEYS[1], id)
+	if v then
+		redis.call('HSET', KEYS[3], id, v)
+		redis.call('ZADD', KEYS[4], ARGV[3], id)
+		table.insert(taken, v)
+	end
+end
+return taken
+`)
+
+// requeueScript puts up to ARGV[2] orders whose lease ended by ARGV[1] back
+// in the queue, due at once.
+var requeueScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[4], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+local requeued = 0
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[4], id)
+	local v = redis.call('HGET', KEYS[3], id)
+	redis.call('HDEL', KEYS[3], id)
+	if v then
+		redis.call('HSET', KEYS[1], id, v)
+		redis.call('ZADD', KEYS[2], ARGV[1], id)
+		requeued = requeued + 1
+	end
+end
+return requeued
+`)
+
+var queueKeys = []string{PendingOrdersKey, DispatchDeadlinesKey, InFlightOrdersKey, DispatchLeasesKey}
+
+// redisOrderQueue keeps pending orders in Redis so they survive restarts
+// and are visible to every dispatch replica.
+type redisOrderQueue struct {
+	redis *redis.Client
+}
+
+func NewRedisOrderQueue(redisClient *redis.Client) domain.OrderQueue {
+	return &redisOrderQueue{redis: redisClient}
+}
+
+func (q *redisOrderQueue) Enqueue(ctx context.Context, order domain.Order, dispatchBy time.Time) error {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("failed to encode order %s: %w", order.ID, err)
+	}
+
+	_, err = q.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, PendingOrdersKey, order.ID, data)
+		pipe.ZAdd(ctx, DispatchDeadlinesKey, redis.Z{
+			Score:  float64(dispatchBy.UnixMilli()),
+			Member: order.ID,
+		})
+		// A requeued order is no longer on its lease
+		pipe.HDel(ctx, InFlightOrdersKey, order.ID)
+		pipe.ZRem(ctx, DispatchLeasesKey, order.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enqueue order %s: %w", order.ID, err)
+	}
+	return nil
+}
+
+func (q *redisOrderQueue) Pending(ctx context.Context) ([]domain.Order, error) {
+	values, err := q.redis.HVals(ctx, PendingOrdersKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending orders: %w", err)
+	}
+	return decodeOrders(values)
+}
+
+func (q *redisOrderQueue) Take(ctx context.Context, orderIDs ...string) ([]domain.Order, error) {
+	if len(orderIDs) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, 0, len(orderIDs)+1)
+	args = append(args, strconv.FormatInt(time.Now().Add(DispatchLease).UnixMilli(), 10))
+	for _, id := range orderIDs {
+		args = append(args, id)
+	}
+
+	values, err := takeScript.Run(ctx, q.redis, queueKeys, args...).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to take orders: %w", err)
+	}
+	return decodeOrders(values)
+}
+
+func (q *redisOrderQueue) TakeDue(ctx context.Context, now time.Time, limit int) ([]domain.Order, error) {
+	values, err := takeDueScript.Run(ctx, q.redis, queueKeys,
+		strconv.FormatInt(now.UnixMilli(), 10), limit,
+		strconv.FormatInt(now.Add(DispatchLease).UnixMilli(), 10),
+	).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to take due orders: %w", err)
+	}
+	return decodeOrders(values)
+}
+
+func (q *redisOrderQueue) Ack(ctx context.Context, orderIDs ...string) error {
+	if len(orderIDs) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(orderIDs))
+	for i, id := range orderIDs {
+		members[i] = id
+	}
+
+	_, err := q.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, InFlightOrdersKey, orderIDs...)
+		pipe.ZRem(ctx, DispatchLeasesKey, members...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to ack orders: %w", err)
+	}
+	return nil
+}
+
+func (q *redisOrderQueue) RequeueExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	n, err := requeueScript.Run(ctx, q.redis, queueKeys,
+		strconv.FormatInt(now.UnixMilli(), 10), limit,
+	).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue expired leases: %w", err)
+	}
+	return n, nil
+}
+
+func decodeOrders(values []string) ([]domain.Order, error) {
+	orders := make([]domain.Order, 0, len(values))
+	for _, v := range values {
+		var o domain.Order
+		if err := json.Unmarshal([]byte(v), &o); err != nil {
+			return nil, fmt.Errorf("corrupt order in queue: %w", err)
+		}
+		orders = append(orders, o)
+	}
+	return orders, nil
+}
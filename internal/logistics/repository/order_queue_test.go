@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+func newTestQueue(t *testing.T) domain.OrderQueue {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRedisOrderQueue(client)
+}
+
+func TestOrderQueue_TakeDueOnlyReturnsExpiredDeadlines(t *testing.T) {
+	ctx := context.Background()
+	q := newTestQueue(t)
+	now := time.Now()
+
+	_ = q.Enqueue(ctx, domain.Order{ID: "due", QuantityKg: 1}, now.Add(-time.Second))
+	_ = q.Enqueue(ctx, domain.Order{ID: "waiting", QuantityKg: 2}, now.Add(time.Minute))
+
+	due, err := q.TakeDue(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("TakeDue failed: %v", err)
+	}
+	if len(due) != 1 || due[0].ID != "due" {
+		t.Fatalf("Expected only 'due' order, got %+v", due)
+	}
+
+	pending, _ := q.Pending(ctx)
+	if len(pending) != 1 || pending[0].ID != "waiting" {
+		t.Fatalf("Expected 'waiting' to stay queued, got %+v", pending)
+	}
+}
+
+func TestOrderQueue_UnackedOrdersComeBackWhenTheirLeaseEnds(t *testing.T) {
+	ctx := context.Background()
+	q := newTestQueue(t)
+	now := time.Now()
+
+	_ = q.Enqueue(ctx, domain.Order{ID: "acked"}, now)
+	_ = q.Enqueue(ctx, domain.Order{ID: "lost"}, now)
+	taken, err := q.TakeDue(ctx, now, 10)
+	if err != nil || len(taken) != 2 {
+		t.Fatalf("Expected both orders taken, got %+v, %v", taken, err)
+	}
+	if err := q.Ack(ctx, "acked"); err != nil {
+		t.Fatalf("Ack failed: %v", err)
+	}
+
+	// Still leased: nothing is handed out twice
+	if n, err := q.RequeueExpired(ctx, now, 10); err != nil || n != 0 {
+		t.Fatalf("Expected no lease expired yet, got %d, %v", n, err)
+	}
+	if again, _ := q.TakeDue(ctx, now, 10); len(again) != 0 {
+		t.Fatalf("Expected leased orders kept out of the queue, got %+v", again)
+	}
+
+	// The taker crashed before submitting "lost"
+	later := now.Add(DispatchLease + time.Second)
+	if n, err := q.RequeueExpired(ctx, later, 10); err != nil || n != 1 {
+		t.Fatalf("Expected one expired lease requeued, got %d, %v", n, err)
+	}
+	due, err := q.TakeDue(ctx, later, 10)
+	if err != nil || len(due) != 1 || due[0].ID != "lost" {
+		t.Fatalf("Expected only 'lost' due again, got %+v, %v", due, err)
+	}
+}
+
+func TestOrderQueue_ConcurrentTakeHandsOutEachOrderOnce(t *testing.T) {
+	ctx := context.Background()
+	q := newTestQueue(t)
+
+	const n = 50
+	ids := make([]string, n)
+	for i := 0; i < n; i++ {
+		ids[i] = fmt.Sprintf("order-%d", i)
+		if err := q.Enqueue(ctx, domain.Order{ID: ids[i]}, time.Now()); err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			taken, err := q.Take(ctx, ids...)
+			if err != nil {
+				t.Errorf("Take failed: %v", err)
+				return
+			}
+			mu.Lock()
+			for _, o := range taken {
+				seen[o.ID]++
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != n {
+		t.Fatalf("Expected %d distinct orders, got %d", n, len(seen))
+	}
+	for id, count := range seen {
+		if count != 1 {
+			t.Errorf("Order %s was taken %d times", id, count)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+type slaRepository struct {
+	db *sql.DB
+}
+
+func NewSLARepository(db *sql.DB) domain.SLARepository {
+	return &slaRepository{db: db}
+}
+
+func (r *slaRepository) Record(ctx context.Context, e domain.SLAEvent) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO sla_events (order_id, kind, batch_id, region, sla_tier, deadline, detected_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (order_id, kind) DO NOTHING
+	`, e.OrderID, e.Kind, e.BatchID, e.Region, e.Tier, e.Deadline, e.DetectedAt)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows == 1, err
+}
+
+func (r *slaRepository) Report(ctx context.Context, from, to time.Time) ([]domain.SLAReportRow, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT region, sla_tier,
+		       COUNT(*) FILTER (WHERE kind = 'ESCALATED'),
+		       COUNT(*) FILTER (WHERE kind = 'LATE_DELIVERY')
+		FROM sla_events
+		WHERE detected_at >= $1 AND detected_at < $2
+		GROUP BY region, sla_tier
+		ORDER BY 4 DESC, 3 DESC, region
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var report []domain.SLAReportRow
+	for rows.Next() {
+		var row domain.SLAReportRow
+		if err := rows.Scan(&row.Region, &row.Tier, &row.Escalations, &row.LateDeliveries); err != nil {
+			return nil, err
+		}
+		report = append(report, row)
+	}
+	return report, rows.Err()
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+type telemetryRepository struct {
+	db *sql.DB
+}
+
+func NewTelemetryRepository(db *sql.DB) domain.TelemetryRepository {
+	return &telemetryRepository{db: db}
+}
+
+// Append stores a batch of readings; retried uploads are ignored
+func (r *telemetryRepository) Append(ctx context.Context, readings []domain.TemperatureReading) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO cold_chain_readings (delivery_id, sensor_id, temp_c, recorded_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (delivery_id, sensor_id, recorded_at) DO NOTHING
+	`)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, rd := range readings {
+		if _, err := stmt.ExecContext(ctx, rd.DeliveryID, rd.SensorID, rd.TempC, rd.RecordedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *telemetryRepository) ListByDelivery(ctx context.Context, deliveryID string) ([]domain.TemperatureReading, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT delivery_id, sensor_id, temp_c, recorded_at
+		FROM cold_chain_readings
+		WHERE delivery_id = $1
+		ORDER BY recorded_at ASC
+	`, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var trace []domain.TemperatureReading
+	for rows.Next() {
+		var rd domain.TemperatureReading
+		if err := rows.Scan(&rd.DeliveryID, &rd.SensorID, &rd.TempC, &rd.RecordedAt); err != nil {
+			return nil, err
+		}
+		trace = append(trace, rd)
+	}
+	return trace, rows.Err()
+}
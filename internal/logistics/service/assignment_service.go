@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/geo"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+const (
+	CourierSearchRadiusMeters = 5000
+	OfferTTL                  = 60 * time.Second // Courier must answer within a minute
+	AssignmentInterval        = 10 * time.Second
+	assignmentBatchLimit      = 50
+)
+
+// CourierLocator finds on-shift couriers around a pickup point
+type CourierLocator interface {
+	FindCouriersNearby(ctx context.Context, lat, lon, radiusMeters float64) ([]geo.CourierLocation, error)
+	GetCourierLocation(ctx context.Context, courierID string) (*geo.CourierLocation, error)
+}
+
+// AssignmentService offers dispatched batches to the best available courier
+type AssignmentService struct {
+	couriers    domain.CourierRepository
+	assignments domain.AssignmentRepository
+	locator     CourierLocator
+	optimizer   *RouteOptimizer
+	deliveries  *DeliveryService
+	earnings    *EarningsService
+	logger      *zap.Logger
+}
+
+func NewAssignmentService(couriers domain.CourierRepository, assignments domain.AssignmentRepository, locator CourierLocator, optimizer *RouteOptimizer, deliveries *DeliveryService, earnings *EarningsService, logger *zap.Logger) *AssignmentService {
+	return &AssignmentService{
+		couriers:    couriers,
+		assignments: assignments,
+		locator:     locator,
+		optimizer:   optimizer,
+		deliveries:  deliveries,
+		earnings:    earnings,
+		logger:      logger,
+	}
+}
+
+// Submit registers a batch for assignment and makes a first offer right away.
+// If nobody is available the batch stays SEARCHING and the loop retries.
+func (s *AssignmentService) Submit(ctx context.Context, batch domain.Batch) error {
+	now := time.Now()
+	a := &domain.Assignment{
+		BatchID:   batch.ID,
+		Batch:     batch,
+		Status:    domain.AssignmentSearching,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.assignments.Create(ctx, a); err != nil {
+		return err
+	}
+
+	if err := s.offer(ctx, a); err != nil {
+		s.logger.Warn("Initial courier offer failed", zap.String("batch_id", batch.ID), zap.Error(err))
+	}
+	return nil
+}
+
+// Respond records a courier's answer; a rejection immediately re-offers the batch
+func (s *AssignmentService) Respond(ctx context.Context, courierID, batchID string, accept bool) error {
+	if err := s.assignments.Respond(ctx, batchID, courierID, accept, time.Now()); err != nil {
+		return err
+	}
+
+	if accept {
+		if err := s.couriers.UpdateStatus(ctx, courierID, domain.CourierBusy); err != nil {
+			return err
+		}
+		if s.assignDeliveries(ctx, courierID, batchID) == 0 {
+			// Nothing on board to finish the batch later: hand the courier straight back
+			s.logger.Warn("Accepted batch has no delivery to carry", zap.String("batch_id", batchID), zap.String("courier_id", courierID))
+			s.deliveries.release(ctx, courierID)
+			return nil
+		}
+		// Route is a convenience for the courier; the itinerary endpoint replans if this fails
+		if _, err := s.planRoute(ctx, courierID, batchID); err != nil {
+			s.logger.Warn("Route planning failed", zap.String("batch_id", batchID), zap.Error(err))
+		}
+		return nil
+	}
+
+	a, err := s.assignments.Get(ctx, batchID)
+	if err != nil {
+		return err
+	}
+	if err := s.offer(ctx, a); err != nil {
+		s.logger.Warn("Re-offer after rejection failed", zap.String("batch_id", batchID), zap.Error(err))
+	}
+	return nil
+}
+
+// Offers lists the open offers and accepted batches of a courier
+func (s *AssignmentService) Offers(ctx context.Context, courierID string) ([]domain.Assignment, error) {
+	return s.assignments.ListByCourier(ctx, courierID)
+}
+
+// Itinerary returns the routed batches a courier has accepted
+func (s *AssignmentService) Itinerary(ctx context.Context, courierID string) ([]domain.Batch, error) {
+	assignments, err := s.assignments.ListByCourier(ctx, courierID)
+	if err != nil {
+		return nil, err
+	}
+
+	var batches []domain.Batch
+	for _, a := range assignments {
+		if a.Status != domain.AssignmentAccepted {
+			continue
+		}
+		if len(a.Batch.Route) == 0 {
+			route, err := s.planRoute(ctx, courierID, a.BatchID)
+			if err != nil {
+				return nil, err
+			}
+			a.Batch.Route = route
+		}
+		batches = append(batches, a.Batch)
+	}
+	return batches, nil
+}
+
+// assignDeliveries moves the claimed deliveries riding in the batch to the
+// courier and fixes their fees at the conditions of the moment of acceptance.
+// It returns how many the courier now holds.
+func (s *AssignmentService) assignDeliveries(ctx context.Context, courierID, batchID string) int {
+	a, err := s.assignments.Get(ctx, batchID)
+	if err != nil {
+		s.logger.Warn("Failed to load accepted batch", zap.String("batch_id", batchID), zap.Error(err))
+		return 0
+	}
+	var assigned []domain.Order
+	for _, o := range a.Batch.Orders {
+		if o.DeliveryID == "" {
+			continue
+		}
+		if err := s.deliveries.Assign(ctx, o.DeliveryID, courierID); err != nil {
+			s.logger.Warn("Failed to assign delivery",
+				zap.String("batch_id", batchID),
+				zap.String("delivery_id", o.DeliveryID),
+				zap.Error(err))
+			continue
+		}
+		assigned = append(assigned, o)
+	}
+	s.earnings.PriceDeliveries(ctx, assigned, len(a.Batch.Orders))
+	return len(assigned)
+}
+
+// planRoute sequences the batch from the courier's live position and stores it
+func (s *AssignmentService) planRoute(ctx context.Context, courierID, batchID string) ([]domain.RoutePoint, error) {
+	a, err := s.assignments.Get(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.Batch.Orders) == 0 {
+		return nil, nil
+	}
+
+	// Without a GPS fix, plan as if the courier starts at the first pickup
+	startLat, startLon := a.Batch.Orders[0].PickupLat, a.Batch.Orders[0].PickupLon
+	if loc, err := s.locator.GetCourierLocation(ctx, courierID); err == nil {
+		startLat, startLon = loc.Lat, loc.Lon
+	}
+
+	a.Batch.Route = s.optimizer.Optimize(ctx, a.Batch, startLat, startLon, time.Now())
+	if err := s.assignments.UpdateBatch(ctx, batchID, a.Batch); err != nil {
+		return nil, err
+	}
+	return a.Batch.Route, nil
+}
+
+// RunAssignmentLoop expires unanswered offers and retries batches still waiting for a courier
+func (s *AssignmentService) RunAssignmentLoop(ctx context.Context) {
+	ticker := time.NewTicker(AssignmentInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := s.assignments.ExpireOffers(ctx, now); err != nil {
+				s.logger.Error("Failed to expire courier offers", zap.Error(err))
+			}
+
+			searching, err := s.assignments.ListSearching(ctx, assignmentBatchLimit)
+			if err != nil {
+				s.logger.Error("Failed to list unassigned batches", zap.Error(err))
+				continue
+			}
+			for i := range searching {
+				if err := s.offer(ctx, &searching[i]); err != nil {
+					s.logger.Warn("Courier offer failed", zap.String("batch_id", searching[i].BatchID), zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// offer tries eligible couriers closest-first until one offer sticks
+func (s *AssignmentService) offer(ctx context.Context, a *domain.Assignment) error {
+	if len(a.Batch.Orders) == 0 {
+		return nil
+	}
+	first := a.Batch.Orders[0]
+
+	nearby, err := s.locator.FindCouriersNearby(ctx, first.PickupLat, first.PickupLon, CourierSearchRadiusMeters)
+	if err != nil {
+		return err
+	}
+	if len(nearby) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(nearby))
+	for i, loc := range nearby {
+		ids[i] = loc.CourierID
+	}
+	couriers, err := s.couriers.ListByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, c := range RankCouriers(a, nearby, couriers, now) {
+		err := s.assignments.Offer(ctx, a.BatchID, c.ID, now.Add(OfferTTL))
+		if err == nil {
+			s.logger.Info("Batch offered to courier",
+				zap.String("batch_id", a.BatchID),
+				zap.String("courier_id", c.ID))
+			return nil
+		}
+		if !errors.Is(err, domain.ErrOfferNotFound) {
+			return err
+		}
+		// Courier already holds another offer (or batch was taken); try the next one
+	}
+	return nil
+}
+
+// RankCouriers filters couriers that can carry the batch and orders them by
+// distance to the first pickup, preferring the tightest capacity fit on ties.
+func RankCouriers(a *domain.Assignment, nearby []geo.CourierLocation, couriers []domain.Courier, now time.Time) []domain.Courier {
+	distance := make(map[string]float64, len(nearby))
+	for _, loc := range nearby {
+		distance[loc.CourierID] = loc.DistanceMeters
+	}
+
+	load := a.Batch.TotalKg()
+	coldChain := a.Batch.RequiresColdChain()
+
+	eligible := make([]domain.Courier, 0, len(couriers))
+	for _, c := range couriers {
+		if _, ok := distance[c.ID]; !ok {
+			continue
+		}
+		if c.Status != domain.CourierOnline || c.CapacityKg < load || a.HasRejected(c.ID) {
+			continue
+		}
+		if coldChain && !c.CanCarryColdChain(now) {
+			continue
+		}
+		eligible = append(eligible, c)
+	}
+
+	sort.SliceStable(eligible, func(i, j int) bool {
+		di, dj := distance[eligible[i].ID], distance[eligible[j].ID]
+		if di != dj {
+			return di < dj
+		}
+		return eligible[i].CapacityKg < eligible[j].CapacityKg
+	})
+	return eligible
+}
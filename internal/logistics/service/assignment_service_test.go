@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/geo"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+func TestRankCouriers_FiltersAndOrdersByDistance(t *testing.T) {
+	now := time.Now()
+	certified := now.Add(24 * time.Hour)
+
+	assignment := &domain.Assignment{
+		Batch: domain.Batch{Orders: []domain.Order{
+			{ID: "o1", QuantityKg: 10, TempCategory: "chilled"},
+			{ID: "o2", QuantityKg: 5},
+		}},
+		RejectedBy: []string{"rejected"},
+	}
+
+	nearby := []geo.CourierLocation{
+		{CourierID: "far-van", DistanceMeters: 3000},
+		{CourierID: "near-car", DistanceMeters: 500},
+		{CourierID: "near-bike", DistanceMeters: 400},   // too small
+		{CourierID: "uncertified", DistanceMeters: 100}, // no thermal bag
+		{CourierID: "rejected", DistanceMeters: 50},
+		{CourierID: "busy", DistanceMeters: 10},
+	}
+	couriers := []domain.Courier{
+		{ID: "far-van", Status: domain.CourierOnline, CapacityKg: 300, ThermalBagCertifiedUntil: &certified},
+		{ID: "near-car", Status: domain.CourierOnline, CapacityKg: 80, ThermalBagCertifiedUntil: &certified},
+		{ID: "near-bike", Status: domain.CourierOnline, CapacityKg: 10, ThermalBagCertifiedUntil: &certified},
+		{ID: "uncertified", Status: domain.CourierOnline, CapacityKg: 80},
+		{ID: "rejected", Status: domain.CourierOnline, CapacityKg: 80, ThermalBagCertifiedUntil: &certified},
+		{ID: "busy", Status: domain.CourierBusy, CapacityKg: 80, ThermalBagCertifiedUntil: &certified},
+	}
+
+	ranked := RankCouriers(assignment, nearby, couriers, now)
+
+	if len(ranked) != 2 {
+		t.Fatalf("Expected 2 eligible couriers, got %d: %+v", len(ranked), ranked)
+	}
+	if ranked[0].ID != "near-car" || ranked[1].ID != "far-van" {
+		t.Errorf("Expected [near-car far-van], got [%s %s]", ranked[0].ID, ranked[1].ID)
+	}
+}
+
+func TestRankCouriers_ExpiredCertificationExcluded(t *testing.T) {
+	now := time.Now()
+	expired := now.Add(-time.Hour)
+
+	assignment := &domain.Assignment{
+		Batch: domain.Batch{Orders: []domain.Order{{ID: "o1", QuantityKg: 1, TempCategory: "frozen"}}},
+	}
+	nearby := []geo.CourierLocation{{CourierID: "c1", DistanceMeters: 100}}
+	couriers := []domain.Courier{{ID: "c1", Status: domain.CourierOnline, CapacityKg: 20, ThermalBagCertifiedUntil: &expired}}
+
+	if ranked := RankCouriers(assignment, nearby, couriers, now); len(ranked) != 0 {
+		t.Errorf("Expected no eligible couriers, got %+v", ranked)
+	}
+}
+
+func TestDeliverylessBatches_RefusedOrCourierReleased(t *testing.T) {
+	ctx := context.Background()
+
+	// Orders no deliveries row tracks never reach a courier
+	dispatch := NewDispatchService(NewBatchingEngine(), nil, nil, zap.NewNop())
+	if _, err := dispatch.CreateOrder(ctx, domain.Order{QuantityKg: 3}); !errors.Is(err, ErrOrderWithoutDelivery) {
+		t.Fatalf("Expected ErrOrderWithoutDelivery, got %v", err)
+	}
+
+	// A batch whose delivery went elsewhere before the courier accepted
+	deliveries, _, couriers, assignments := newDeliveryFixture()
+	assignments.batches = map[string]*domain.Assignment{"b1": {
+		BatchID: "b1", CourierID: "c1", Status: domain.AssignmentOffered,
+		Batch: domain.Batch{ID: "b1", Orders: []domain.Order{{ID: "o1", DeliveryID: "gone", QuantityKg: 3}}},
+	}}
+	svc := NewAssignmentService(couriers, assignments, nil, nil, deliveries, nil, zap.NewNop())
+	if err := svc.Respond(ctx, "c1", "b1", true); err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+	if couriers.couriers["c1"].Status != domain.CourierOnline {
+		t.Errorf("Expected the courier back online, got %s", couriers.couriers["c1"].Status)
+	}
+	if len(assignments.completed) != 1 || assignments.completed[0] != "c1" {
+		t.Errorf("Expected the empty batch completed, got %v", assignments.completed)
+	}
+}
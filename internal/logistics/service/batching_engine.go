@@ -7,17 +7,23 @@ import (
 	"time"
 
 	"github.com/golang/geo/s2"
+	"github.com/google/uuid"
 
+	"github.com/albnnaardy11/pahlawan-pangan/internal/geo"
 	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
 )
 
 // BatchingEngine handles the complex clustering logic
 type BatchingEngine struct {
-	// In production: Connect to Redis Geospatial
+	// MaxBatchKg caps the combined load of a batch so any on-shift courier can carry it.
+	// A single order heavier than this still gets its own batch (vans pick those up).
+	MaxBatchKg float64
 }
 
 func NewBatchingEngine() *BatchingEngine {
-	return &BatchingEngine{}
+	return &BatchingEngine{
+		MaxBatchKg: domain.VehicleBike.DefaultCapacityKg(),
+	}
 }
 
 // Haversine calculates distance between two points on Earth (in km)
@@ -32,54 +38,49 @@ func Haversine(lat1, lon1, lat2, lon2 float64) float64 {
 	return R * c
 }
 
-// CalculateOptimalBatch groups orders based on S2 Cell and SLA constraints
+// CalculateOptimalBatch groups orders based on S2 Cell and SLA constraints.
+// Every input order ends up in exactly one batch: when the home cell is full the
+// order overflows into an adjacent cell's batch, or opens a new one.
 func (e *BatchingEngine) CalculateOptimalBatch(ctx context.Context, pendingOrders []domain.Order, courierLoc s2.LatLng) ([]domain.Batch, error) {
-	batches := make(map[s2.CellID]*domain.Batch)
+	var batches []*domain.Batch
+	openByCell := make(map[s2.CellID][]*domain.Batch)
+
+	// Most perishable first, so they get first pick of the open batches
+	orders := append([]domain.Order(nil), pendingOrders...)
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].ExpiryTime.Before(orders[j].ExpiryTime)
+	})
 
-	for _, order := range pendingOrders {
+	for _, order := range orders {
 		// 1. HARD CONSTRAINT: EXPRESS or CRITICAL orders are never batched
 		if order.CurrentSLA == domain.SLA_EXPRESS || order.CurrentSLA == domain.SLA_CRITICAL {
 			// Direct Dispatch (Single batch)
-			singleBatch := domain.Batch{
+			batches = append(batches, &domain.Batch{
 				ID:     "batch-" + order.ID,
 				Orders: []domain.Order{order},
-				Score:  999.0, // Highest priority
-			}
-			// #nosec G115
-			batches[s2.CellID(randInt())] = &singleBatch // Unique key
+			})
 			continue
 		}
 
-		// 2. Clustering (S2 Level 13 ~1km radius)
-		regionID := order.S2CellID()
-
-		// 3. Batch Construction Logic
-		if batch, exists := batches[regionID]; exists {
-			// Check capacity (HEMAT max 4, STANDARD max 2)
-			maxSize := 4
-			if order.CurrentSLA == domain.SLA_STANDARD {
-				maxSize = 2
-			}
+		// 2. Clustering (S2 Level 13 ~1km radius), home cell first then edge neighbours
+		if batch := e.findOpenBatch(openByCell, order); batch != nil {
+			batch.Orders = append(batch.Orders, order)
+			continue
+		}
 
-			if len(batch.Orders) < maxSize {
-				batch.Orders = append(batch.Orders, order)
-			}
-			// Current batch full, create new one (simplified logic)
-			// In production: check neighboring cells or create overflow batch
-		} else {
-			batches[regionID] = &domain.Batch{
-				ID:     "batch-" + regionID.ToToken(),
-				Orders: []domain.Order{order},
-			}
+		// 3. Overflow: nothing nearby has room, open a new batch in the home cell
+		regionID := order.S2CellID()
+		batch := &domain.Batch{
+			ID:     "batch-" + regionID.ToToken() + "-" + uuid.New().String(),
+			Orders: []domain.Order{order},
 		}
+		batches = append(batches, batch)
+		openByCell[regionID] = append(openByCell[regionID], batch)
 	}
 
 	// 4. Scoring Algorithm
 	var prioritizedBatches []domain.Batch
 	for _, b := range batches {
-		if b == nil {
-			continue
-		}
 		score := e.calculateBatchScore(*b, courierLoc)
 		b.Score = score
 		prioritizedBatches = append(prioritizedBatches, *b)
@@ -137,6 +138,43 @@ func (e *BatchingEngine) calculateBatchScore(batch domain.Batch, courierLoc s2.L
 	return finalScore
 }
 
-func randInt() int64 {
-	return time.Now().UnixNano() // Simple unique ID generator for demo
+// findOpenBatch returns the first batch around the order's pickup that can
+// still take it without breaking the SLA stop limit or the weight limit
+func (e *BatchingEngine) findOpenBatch(openByCell map[s2.CellID][]*domain.Batch, order domain.Order) *domain.Batch {
+	for _, cell := range geo.GetNearbyShards(order.PickupLat, order.PickupLon) {
+		for _, batch := range openByCell[s2.CellID(cell)] {
+			if e.canJoin(batch, order) {
+				return batch
+			}
+		}
+	}
+	return nil
+}
+
+func (e *BatchingEngine) canJoin(batch *domain.Batch, order domain.Order) bool {
+	size := order.CurrentSLA.MaxBatchSize()
+	if c := batchCapacity(*batch); c < size {
+		size = c
+	}
+	if len(batch.Orders) >= size {
+		return false
+	}
+	return batch.TotalKg()+order.QuantityKg <= e.MaxBatchKg
+}
+
+// IsFull reports whether a batch has reached its stop limit or weight limit
+// and is ready to dispatch without waiting for more orders
+func (e *BatchingEngine) IsFull(batch domain.Batch) bool {
+	return len(batch.Orders) >= batchCapacity(batch) || batch.TotalKg() >= e.MaxBatchKg
+}
+
+// batchCapacity is bounded by the strictest SLA on board (HEMAT max 4, STANDARD max 2)
+func batchCapacity(batch domain.Batch) int {
+	size := domain.SLA_HEMAT.MaxBatchSize()
+	for _, o := range batch.Orders {
+		if s := o.CurrentSLA.MaxBatchSize(); s < size {
+			size = s
+		}
+	}
+	return size
 }
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/golang/geo/s2"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+// orderSet is a random batch of pending orders clustered around a few Jakarta hotspots
+type orderSet []domain.Order
+
+func (orderSet) Generate(r *rand.Rand, size int) reflect.Value {
+	slas := []domain.DeliverySLA{domain.SLA_HEMAT, domain.SLA_STANDARD, domain.SLA_EXPRESS, domain.SLA_CRITICAL}
+	hotspots := [][2]float64{{-6.2088, 106.8456}, {-6.1754, 106.8272}, {-6.2615, 106.7810}}
+
+	n := r.Intn(4 * size)
+	orders := make(orderSet, n)
+	for i := range orders {
+		h := hotspots[r.Intn(len(hotspots))]
+		orders[i] = domain.Order{
+			ID:         fmt.Sprintf("order-%d", i),
+			PickupLat:  h[0] + (r.Float64()-0.5)*0.03, // Spans neighbouring level-13 cells
+			PickupLon:  h[1] + (r.Float64()-0.5)*0.03,
+			QuantityKg: r.Float64() * 30, // Some orders alone exceed a bike's load
+			CurrentSLA: slas[r.Intn(len(slas))],
+			ExpiryTime: time.Now().Add(time.Duration(r.Intn(240)) * time.Minute),
+		}
+	}
+	return reflect.ValueOf(orders)
+}
+
+func TestCalculateOptimalBatch_EveryOrderInExactlyOneBatch(t *testing.T) {
+	engine := NewBatchingEngine()
+	courierLoc := s2.LatLngFromDegrees(-6.2, 106.8)
+
+	property := func(orders orderSet) bool {
+		batches, err := engine.CalculateOptimalBatch(context.Background(), orders, courierLoc)
+		if err != nil {
+			t.Logf("unexpected error: %v", err)
+			return false
+		}
+
+		seen := make(map[string]int, len(orders))
+		batchIDs := make(map[string]bool, len(batches))
+		for _, b := range batches {
+			if batchIDs[b.ID] {
+				t.Logf("duplicate batch id %s", b.ID)
+				return false
+			}
+			batchIDs[b.ID] = true
+
+			for _, o := range b.Orders {
+				seen[o.ID]++
+			}
+		}
+
+		if len(seen) != len(orders) {
+			t.Logf("expected %d orders in batches, got %d", len(orders), len(seen))
+			return false
+		}
+		for id, n := range seen {
+			if n != 1 {
+				t.Logf("order %s appears in %d batches", id, n)
+				return false
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCalculateOptimalBatch_RespectsCapacity(t *testing.T) {
+	engine := NewBatchingEngine()
+	courierLoc := s2.LatLngFromDegrees(-6.2, 106.8)
+
+	property := func(orders orderSet) bool {
+		batches, err := engine.CalculateOptimalBatch(context.Background(), orders, courierLoc)
+		if err != nil {
+			return false
+		}
+
+		for _, b := range batches {
+			if len(b.Orders) > batchCapacity(b) {
+				t.Logf("batch %s has %d orders, capacity %d", b.ID, len(b.Orders), batchCapacity(b))
+				return false
+			}
+			// An oversized order may ride alone, but never drags others over the limit
+			if len(b.Orders) > 1 && b.TotalKg() > engine.MaxBatchKg {
+				t.Logf("batch %s carries %.1fkg, limit %.1fkg", b.ID, b.TotalKg(), engine.MaxBatchKg)
+				return false
+			}
+			for _, o := range b.Orders {
+				if len(b.Orders) > 1 && (o.CurrentSLA == domain.SLA_EXPRESS || o.CurrentSLA == domain.SLA_CRITICAL) {
+					t.Logf("urgent order %s was batched", o.ID)
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCalculateOptimalBatch_OverflowsIntoNeighbourCell(t *testing.T) {
+	engine := NewBatchingEngine()
+	expiry := time.Now().Add(2 * time.Hour)
+
+	// Two pickups on either side of a level-13 cell edge
+	home := s2.CellIDFromLatLng(s2.LatLngFromDegrees(-6.2088, 106.8456)).Parent(13)
+	neighbour := home.EdgeNeighbors()[0]
+	a, b := home.LatLng(), neighbour.LatLng()
+
+	orders := []domain.Order{
+		{ID: "o1", PickupLat: a.Lat.Degrees(), PickupLon: a.Lng.Degrees(), QuantityKg: 2, CurrentSLA: domain.SLA_HEMAT, ExpiryTime: expiry},
+		{ID: "o2", PickupLat: b.Lat.Degrees(), PickupLon: b.Lng.Degrees(), QuantityKg: 2, CurrentSLA: domain.SLA_HEMAT, ExpiryTime: expiry.Add(time.Minute)},
+	}
+
+	batches, err := engine.CalculateOptimalBatch(context.Background(), orders, a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(batches) != 1 || len(batches[0].Orders) != 2 {
+		t.Errorf("Expected neighbouring orders in one batch, got %+v", batches)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	authDomain "github.com/albnnaardy11/pahlawan-pangan/internal/auth/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+var (
+	ErrNotCourierRole = errors.New("user is not registered with the COURIER role")
+	ErrCourierOnDuty  = errors.New("courier still has an accepted batch")
+	ErrCourierOffline = errors.New("courier is not on shift")
+)
+
+// UserLookup is the slice of the auth repository needed to link couriers to users
+type UserLookup interface {
+	GetByID(ctx context.Context, id string) (*authDomain.User, error)
+}
+
+// CourierTracker is the live location index for on-shift couriers
+type CourierTracker interface {
+	UpdateCourierLocation(ctx context.Context, courierID string, lat, lon float64) error
+	RemoveCourierLocation(ctx context.Context, courierID string) error
+}
+
+// CourierService manages the fleet: registration, shifts, location and certification
+type CourierService struct {
+	repo    domain.CourierRepository
+	users   UserLookup
+	tracker CourierTracker
+}
+
+func NewCourierService(repo domain.CourierRepository, users UserLookup, tracker CourierTracker) *CourierService {
+	return &CourierService{repo: repo, users: users, tracker: tracker}
+}
+
+// Register onboards an existing COURIER user into the fleet
+func (s *CourierService) Register(ctx context.Context, userID string, vehicle domain.VehicleType, capacityKg float64) (*domain.Courier, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("lookup user %s: %w", userID, err)
+	}
+	if user.Role != authDomain.RoleCourier {
+		return nil, ErrNotCourierRole
+	}
+
+	switch vehicle {
+	case domain.VehicleBike, domain.VehicleCar, domain.VehicleVan:
+	default:
+		return nil, fmt.Errorf("unsupported vehicle type %q", vehicle)
+	}
+	if capacityKg <= 0 {
+		capacityKg = vehicle.DefaultCapacityKg()
+	}
+
+	now := time.Now()
+	courier := &domain.Courier{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		VehicleType: vehicle,
+		CapacityKg:  capacityKg,
+		Status:      domain.CourierOffline,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.repo.Create(ctx, courier); err != nil {
+		return nil, err
+	}
+	return courier, nil
+}
+
+// ByUser is the fleet record of a signed-in courier
+func (s *CourierService) ByUser(ctx context.Context, userID string) (*domain.Courier, error) {
+	return s.repo.GetByUserID(ctx, userID)
+}
+
+// StartShift puts the courier in the dispatch pool at their current position
+func (s *CourierService) StartShift(ctx context.Context, courierID string, lat, lon float64) error {
+	courier, err := s.repo.GetByID(ctx, courierID)
+	if err != nil {
+		return err
+	}
+	if courier.Status != domain.CourierOffline {
+		return nil // Already on shift
+	}
+	if err := s.repo.UpdateStatus(ctx, courierID, domain.CourierOnline); err != nil {
+		return err
+	}
+	return s.tracker.UpdateCourierLocation(ctx, courierID, lat, lon)
+}
+
+// EndShift removes the courier from dispatch; not allowed mid-delivery
+func (s *CourierService) EndShift(ctx context.Context, courierID string) error {
+	courier, err := s.repo.GetByID(ctx, courierID)
+	if err != nil {
+		return err
+	}
+	if courier.Status == domain.CourierBusy {
+		return ErrCourierOnDuty
+	}
+	if err := s.repo.UpdateStatus(ctx, courierID, domain.CourierOffline); err != nil {
+		return err
+	}
+	return s.tracker.RemoveCourierLocation(ctx, courierID)
+}
+
+// UpdateLocation ingests a GPS ping from an on-shift courier
+func (s *CourierService) UpdateLocation(ctx context.Context, courierID string, lat, lon float64) error {
+	courier, err := s.repo.GetByID(ctx, courierID)
+	if err != nil {
+		return err
+	}
+	if courier.Status == domain.CourierOffline {
+		return ErrCourierOffline
+	}
+	return s.tracker.UpdateCourierLocation(ctx, courierID, lat, lon)
+}
+
+// CertifyThermalBag records (or revokes, with nil) the cold-chain certification
+func (s *CourierService) CertifyThermalBag(ctx context.Context, courierID string, validUntil *time.Time) error {
+	return s.repo.UpdateCertification(ctx, courierID, validUntil)
+}
@@ -0,0 +1,408 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/outbox"
+)
+
+var (
+	ErrNotDeliveryCourier     = errors.New("delivery is held by another courier")
+	ErrOutsidePickupGeofence  = errors.New("courier is too far from the provider to check in")
+	ErrOutsideDropoffGeofence = errors.New("courier is too far from the recipient to hand over")
+	ErrInvalidDeliveryOTP     = errors.New("recipient OTP does not match")
+	ErrMissingDeliveryProof   = errors.New("handover photo is required as proof of delivery")
+)
+
+const (
+	PickupGeofenceMeters  = 150.0
+	DropoffGeofenceMeters = 300.0 // NGO halls and RT/RW drop points are bigger than a storefront
+	dropoffOTPDigits      = 6
+)
+
+// DeliveryService drives a delivery through searching → assigned → picked_up → delivered/failed.
+// Every transition is published through the outbox for the carbon and escrow workers.
+type DeliveryService struct {
+	deliveries  domain.DeliveryRepository
+	couriers    domain.CourierRepository
+	assignments domain.AssignmentRepository
+	notifier    Notifier // Sends the dropoff OTP to the recipient alone
+	logger      *zap.Logger
+}
+
+func NewDeliveryService(deliveries domain.DeliveryRepository, couriers domain.CourierRepository, assignments domain.AssignmentRepository, notifier Notifier, logger *zap.Logger) *DeliveryService {
+	return &DeliveryService{
+		deliveries:  deliveries,
+		couriers:    couriers,
+		assignments: assignments,
+		notifier:    notifier,
+		logger:      logger,
+	}
+}
+
+// Get returns the tracking view of a delivery
+func (s *DeliveryService) Get(ctx context.Context, id string) (*domain.Delivery, error) {
+	return s.deliveries.Get(ctx, id)
+}
+
+// SetSLATier records the tier a delivery was dispatched on; stale claims are
+// timed by it
+func (s *DeliveryService) SetSLATier(ctx context.Context, deliveryID string, tier domain.DeliverySLA) error {
+	return s.deliveries.SetSLATier(ctx, deliveryID, tier)
+}
+
+// Assign hands a searching delivery to an on-shift courier
+func (s *DeliveryService) Assign(ctx context.Context, deliveryID, courierID string) error {
+	courier, err := s.couriers.GetByID(ctx, courierID)
+	if err != nil {
+		return err
+	}
+	if courier.Status == domain.CourierOffline {
+		return ErrCourierOffline
+	}
+
+	d, err := s.deliveries.Get(ctx, deliveryID)
+	if err != nil {
+		return err
+	}
+	if !d.Status.CanTransitionTo(domain.DeliveryAssigned) {
+		return domain.ErrInvalidTransition
+	}
+
+	now := time.Now()
+	d.CourierID = courierID
+	t := domain.DeliveryTransition{
+		DeliveryID: d.ID,
+		CourierID:  courierID,
+		From:       d.Status,
+		To:         domain.DeliveryAssigned,
+		At:         now,
+	}
+	if err := s.apply(ctx, d, t, outbox.DeliveryAssigned, nil); err != nil {
+		return err
+	}
+
+	if courier.Status == domain.CourierOnline {
+		return s.couriers.UpdateStatus(ctx, courierID, domain.CourierBusy)
+	}
+	return nil
+}
+
+// AssignExternal hands a searching delivery to a third-party provider booking.
+// Progress then arrives through ApplyProviderUpdate instead of the courier app.
+func (s *DeliveryService) AssignExternal(ctx context.Context, deliveryID string, booking *domain.Booking) error {
+	d, err := s.deliveries.Get(ctx, deliveryID)
+	if err != nil {
+		return err
+	}
+	if !d.Status.CanTransitionTo(domain.DeliveryAssigned) {
+		return domain.ErrInvalidTransition
+	}
+
+	d.Provider, d.ExternalID = booking.Provider, booking.ExternalID
+	t := domain.DeliveryTransition{
+		DeliveryID: d.ID,
+		ExternalID: booking.ExternalID,
+		From:       d.Status,
+		To:         domain.DeliveryAssigned,
+		Booking:    booking,
+		At:         time.Now(),
+	}
+	return s.apply(ctx, d, t, outbox.DeliveryAssigned, map[string]interface{}{"fee": booking.Fee})
+}
+
+// ApplyProviderUpdate moves an externally booked delivery to the status the
+// provider reported. Webhooks arrive late, twice or out of order: stale and
+// repeated updates are ignored, and a jump from assigned straight to delivered
+// records the implied pickup first so escrow sees every step.
+func (s *DeliveryService) ApplyProviderUpdate(ctx context.Context, u *domain.TrackingUpdate) error {
+	d, err := s.deliveries.GetByExternalID(ctx, u.Provider, u.ExternalID)
+	if err != nil {
+		return err
+	}
+	at := u.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	for _, step := range providerSteps(d.Status, u.Status) {
+		t := domain.DeliveryTransition{
+			DeliveryID: d.ID,
+			ExternalID: d.ExternalID,
+			From:       d.Status,
+			To:         step,
+			At:         at,
+		}
+		var eventType outbox.EventType
+		extra := map[string]interface{}{"provider_status": u.ProviderStatus}
+		switch step {
+		case domain.DeliveryPickedUp:
+			eventType = outbox.FoodPickedUp
+		case domain.DeliveryDelivered:
+			t.Proof = &domain.DeliveryProof{PhotoRef: u.PhotoURL, Lat: u.Lat, Lon: u.Lon}
+			eventType = outbox.FoodDelivered
+			extra["photo_ref"] = u.PhotoURL
+		case domain.DeliveryFailed:
+			t.FailureReason = u.Reason
+			if t.FailureReason == "" {
+				t.FailureReason = fmt.Sprintf("%s reported %s", u.Provider, u.ProviderStatus)
+			}
+			eventType = outbox.DeliveryFailed
+			extra["reason"] = t.FailureReason
+			extra["food_unsafe"] = false
+		}
+
+		err := s.apply(ctx, d, t, eventType, extra)
+		if errors.Is(err, domain.ErrInvalidTransition) {
+			return nil // A concurrent callback for the same booking got there first
+		}
+		if err != nil {
+			return err
+		}
+		d.Status = step
+	}
+	return nil
+}
+
+// providerSteps lists the transitions between current and reported, or nothing
+// if the report is stale, repeated or not something we track
+func providerSteps(current, reported domain.DeliveryStatus) []domain.DeliveryStatus {
+	if current.IsTerminal() || current == reported {
+		return nil
+	}
+	if reported == domain.DeliveryFailed {
+		return []domain.DeliveryStatus{domain.DeliveryFailed}
+	}
+
+	path := []domain.DeliveryStatus{domain.DeliveryAssigned, domain.DeliveryPickedUp, domain.DeliveryDelivered}
+	from, to := -1, -1
+	for i, status := range path {
+		if status == current {
+			from = i
+		}
+		if status == reported {
+			to = i
+		}
+	}
+	if from < 0 || to <= from {
+		return nil
+	}
+	return path[from+1 : to+1]
+}
+
+// ConfirmPickup records the geotagged check-in at the provider and issues the
+// one-time code the NGO will read out at handover
+func (s *DeliveryService) ConfirmPickup(ctx context.Context, deliveryID, courierID string, lat, lon float64) error {
+	d, err := s.heldBy(ctx, deliveryID, courierID, domain.DeliveryPickedUp)
+	if err != nil {
+		return err
+	}
+	if Haversine(lat, lon, d.ProviderLat, d.ProviderLon)*1000 > PickupGeofenceMeters {
+		return ErrOutsidePickupGeofence
+	}
+
+	otp, err := generateOTP(dropoffOTPDigits)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	t := domain.DeliveryTransition{
+		DeliveryID: d.ID,
+		CourierID:  courierID,
+		From:       d.Status,
+		To:         domain.DeliveryPickedUp,
+		Checkin: &domain.PickupCheckin{
+			DeliveryID: d.ID,
+			ProviderID: d.ProviderID,
+			CourierID:  courierID,
+			Lat:        lat,
+			Lon:        lon,
+			CheckedAt:  now,
+		},
+		DropoffOTP: otp,
+		At:         now,
+	}
+	if err := s.apply(ctx, d, t, outbox.FoodPickedUp, nil); err != nil {
+		return err
+	}
+
+	// Straight to the recipient: every consumer of the outbox sees the event
+	if d.RecipientID == "" {
+		s.logger.Warn("Delivery has no recipient to send the dropoff OTP to", zap.String("delivery_id", d.ID))
+		return nil
+	}
+	msg := fmt.Sprintf("Your food is on its way. Give the courier code %s at handover.", otp)
+	if err := s.notifier.NotifyBatch(ctx, []string{d.RecipientID}, "Handover code", msg); err != nil {
+		s.logger.Error("Failed to send the dropoff OTP", zap.String("delivery_id", d.ID), zap.Error(err))
+	}
+	return nil
+}
+
+// ConfirmDelivery closes the delivery with the recipient's OTP, a handover photo and GPS
+func (s *DeliveryService) ConfirmDelivery(ctx context.Context, deliveryID, courierID string, proof domain.DeliveryProof) error {
+	if proof.PhotoRef == "" {
+		return ErrMissingDeliveryProof
+	}
+
+	d, err := s.heldBy(ctx, deliveryID, courierID, domain.DeliveryDelivered)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(proof.OTP), []byte(d.DropoffOTP)) != 1 {
+		return ErrInvalidDeliveryOTP
+	}
+	// Claims made without an NGO (B2C) have no registered dropoff to fence against
+	if d.NGOID != "" && Haversine(proof.Lat, proof.Lon, d.NGOLat, d.NGOLon)*1000 > DropoffGeofenceMeters {
+		return ErrOutsideDropoffGeofence
+	}
+
+	t := domain.DeliveryTransition{
+		DeliveryID: d.ID,
+		CourierID:  courierID,
+		From:       d.Status,
+		To:         domain.DeliveryDelivered,
+		Proof:      &proof,
+		At:         time.Now(),
+	}
+	if err := s.apply(ctx, d, t, outbox.FoodDelivered, map[string]interface{}{"photo_ref": proof.PhotoRef}); err != nil {
+		return err
+	}
+	s.release(ctx, courierID)
+	return nil
+}
+
+// Fail aborts a delivery the courier can no longer complete
+func (s *DeliveryService) Fail(ctx context.Context, deliveryID, courierID, reason string) error {
+	d, err := s.heldBy(ctx, deliveryID, courierID, domain.DeliveryFailed)
+	if err != nil {
+		return err
+	}
+	return s.fail(ctx, d, reason, false, nil)
+}
+
+// Abort stops an in-transit delivery on the platform's behalf, whoever holds it.
+// foodUnsafe marks the load as condemned so it is neither handed over nor relisted.
+func (s *DeliveryService) Abort(ctx context.Context, d *domain.Delivery, reason string, foodUnsafe bool, extra map[string]interface{}) error {
+	if !d.Status.CanTransitionTo(domain.DeliveryFailed) || (d.CourierID == "" && d.ExternalID == "") {
+		return domain.ErrInvalidTransition
+	}
+	return s.fail(ctx, d, reason, foodUnsafe, extra)
+}
+
+func (s *DeliveryService) fail(ctx context.Context, d *domain.Delivery, reason string, foodUnsafe bool, extra map[string]interface{}) error {
+	t := domain.DeliveryTransition{
+		DeliveryID:    d.ID,
+		CourierID:     d.CourierID,
+		ExternalID:    d.ExternalID,
+		From:          d.Status,
+		To:            domain.DeliveryFailed,
+		FailureReason: reason,
+		FoodUnsafe:    foodUnsafe,
+		At:            time.Now(),
+	}
+	payload := map[string]interface{}{"reason": reason, "food_unsafe": foodUnsafe}
+	for k, v := range extra {
+		payload[k] = v
+	}
+	if err := s.apply(ctx, d, t, outbox.DeliveryFailed, payload); err != nil {
+		return err
+	}
+	if d.CourierID != "" {
+		s.release(ctx, d.CourierID)
+	}
+	return nil
+}
+
+// heldBy loads a delivery the courier owns and checks the next step is legal
+func (s *DeliveryService) heldBy(ctx context.Context, deliveryID, courierID string, next domain.DeliveryStatus) (*domain.Delivery, error) {
+	d, err := s.deliveries.Get(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if d.CourierID != courierID {
+		return nil, ErrNotDeliveryCourier
+	}
+	if !d.Status.CanTransitionTo(next) {
+		return nil, domain.ErrInvalidTransition
+	}
+	return d, nil
+}
+
+func (s *DeliveryService) apply(ctx context.Context, d *domain.Delivery, t domain.DeliveryTransition, eventType outbox.EventType, extra map[string]interface{}) error {
+	payload := map[string]interface{}{
+		"delivery_id": d.ID,
+		"surplus_id":  d.SurplusID,
+		"vendor_id":   d.ProviderID,
+		"ngo_id":      d.NGOID,
+		"courier_id":  t.CourierID,
+		"status":      t.To,
+		"category":    strings.ToUpper(d.FoodType),
+		"weight_kg":   d.QuantityKg,
+		"occurred_at": t.At,
+	}
+	if d.Provider != "" {
+		payload["courier_provider"] = d.Provider
+		payload["external_tracking_id"] = d.ExternalID
+	}
+	for k, v := range extra {
+		payload[k] = v
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	event := outbox.Event{
+		ID:          uuid.New().String(),
+		AggregateID: d.SurplusID, // Escrow and carbon are keyed by the claimed surplus
+		EventType:   eventType,
+		Payload:     data,
+		CreatedAt:   t.At,
+	}
+	if err := s.deliveries.Apply(ctx, t, event); err != nil {
+		return fmt.Errorf("delivery %s %s -> %s: %w", d.ID, t.From, t.To, err)
+	}
+	return nil
+}
+
+// release puts the courier back in the pool once nothing is left on board
+func (s *DeliveryService) release(ctx context.Context, courierID string) {
+	active, err := s.deliveries.CountActiveByCourier(ctx, courierID)
+	if err != nil {
+		s.logger.Warn("Failed to count active deliveries", zap.String("courier_id", courierID), zap.Error(err))
+		return
+	}
+	if active > 0 {
+		return
+	}
+
+	if err := s.assignments.CompleteByCourier(ctx, courierID); err != nil {
+		s.logger.Warn("Failed to complete courier batches", zap.String("courier_id", courierID), zap.Error(err))
+	}
+	if err := s.couriers.UpdateStatus(ctx, courierID, domain.CourierOnline); err != nil {
+		s.logger.Warn("Failed to release courier", zap.String("courier_id", courierID), zap.Error(err))
+	}
+}
+
+// generateOTP returns a zero-padded numeric code from crypto/rand
+func generateOTP(digits int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
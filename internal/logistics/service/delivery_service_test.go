@@ -0,0 +1,267 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/outbox"
+)
+
+type fakeDeliveryRepo struct {
+	deliveries map[string]*domain.Delivery
+	checkins   []domain.PickupCheckin
+	events     []outbox.Event
+}
+
+func (r *fakeDeliveryRepo) Get(ctx context.Context, id string) (*domain.Delivery, error) {
+	d, ok := r.deliveries[id]
+	if !ok {
+		return nil, domain.ErrDeliveryNotFound
+	}
+	copied := *d
+	return &copied, nil
+}
+
+func (r *fakeDeliveryRepo) GetByExternalID(ctx context.Context, provider, externalID string) (*domain.Delivery, error) {
+	for id, d := range r.deliveries {
+		if d.Provider == provider && d.ExternalID == externalID {
+			return r.Get(ctx, id)
+		}
+	}
+	return nil, domain.ErrDeliveryNotFound
+}
+
+func (r *fakeDeliveryRepo) Apply(ctx context.Context, t domain.DeliveryTransition, event outbox.Event) error {
+	d, ok := r.deliveries[t.DeliveryID]
+	if !ok || d.Status != t.From {
+		return domain.ErrInvalidTransition
+	}
+	d.Status = t.To
+	d.CourierID = t.CourierID
+	if t.Booking != nil {
+		d.Provider, d.ExternalID = t.Booking.Provider, t.Booking.ExternalID
+	}
+	d.FoodUnsafe = d.FoodUnsafe || t.FoodUnsafe
+	if t.DropoffOTP != "" {
+		d.DropoffOTP = t.DropoffOTP
+	}
+	if t.Checkin != nil {
+		r.checkins = append(r.checkins, *t.Checkin)
+	}
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *fakeDeliveryRepo) CountActiveByCourier(ctx context.Context, courierID string) (int, error) {
+	n := 0
+	for _, d := range r.deliveries {
+		if d.CourierID == courierID && !d.Status.IsTerminal() {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *fakeDeliveryRepo) SetSLATier(ctx context.Context, id string, tier domain.DeliverySLA) error {
+	d, ok := r.deliveries[id]
+	if !ok {
+		return domain.ErrDeliveryNotFound
+	}
+	d.SLATier = tier
+	return nil
+}
+
+type fakeCourierRepo struct {
+	domain.CourierRepository
+	couriers map[string]*domain.Courier
+}
+
+func (r *fakeCourierRepo) GetByID(ctx context.Context, id string) (*domain.Courier, error) {
+	c, ok := r.couriers[id]
+	if !ok {
+		return nil, domain.ErrCourierNotFound
+	}
+	return c, nil
+}
+
+func (r *fakeCourierRepo) UpdateStatus(ctx context.Context, id string, status domain.CourierStatus) error {
+	r.couriers[id].Status = status
+	return nil
+}
+
+type fakeAssignmentRepo struct {
+	domain.AssignmentRepository
+	batches   map[string]*domain.Assignment
+	completed []string
+}
+
+func (r *fakeAssignmentRepo) Get(ctx context.Context, batchID string) (*domain.Assignment, error) {
+	a, ok := r.batches[batchID]
+	if !ok {
+		return nil, domain.ErrOfferNotFound
+	}
+	copied := *a
+	return &copied, nil
+}
+
+func (r *fakeAssignmentRepo) Respond(ctx context.Context, batchID, courierID string, accept bool, now time.Time) error {
+	a, ok := r.batches[batchID]
+	if !ok || a.CourierID != courierID || a.Status != domain.AssignmentOffered {
+		return domain.ErrOfferNotFound
+	}
+	a.Status = domain.AssignmentAccepted
+	return nil
+}
+
+func (r *fakeAssignmentRepo) CompleteByCourier(ctx context.Context, courierID string) error {
+	r.completed = append(r.completed, courierID)
+	return nil
+}
+
+// Provider in Menteng, NGO ~2km away
+func newDeliveryFixture() (*DeliveryService, *fakeDeliveryRepo, *fakeCourierRepo, *fakeAssignmentRepo) {
+	deliveries := &fakeDeliveryRepo{deliveries: map[string]*domain.Delivery{
+		"d1": {
+			ID: "d1", SurplusID: "s1", ProviderID: "p1", NGOID: "n1", RecipientID: "n1",
+			Status: domain.DeliverySearching, QuantityKg: 12, FoodType: "produce",
+			ProviderLat: -6.1950, ProviderLon: 106.8300,
+			NGOLat: -6.2120, NGOLon: 106.8350,
+		},
+	}}
+	couriers := &fakeCourierRepo{couriers: map[string]*domain.Courier{
+		"c1": {ID: "c1", Status: domain.CourierOnline},
+		"c2": {ID: "c2", Status: domain.CourierOnline},
+	}}
+	assignments := &fakeAssignmentRepo{}
+	return NewDeliveryService(deliveries, couriers, assignments, &fakeNotifier{}, zap.NewNop()), deliveries, couriers, assignments
+}
+
+func TestDeliveryLifecycle_EmitsEventsAndReleasesCourier(t *testing.T) {
+	ctx := context.Background()
+	svc, deliveries, couriers, assignments := newDeliveryFixture()
+
+	if err := svc.Assign(ctx, "d1", "c1"); err != nil {
+		t.Fatalf("Assign: %v", err)
+	}
+	if couriers.couriers["c1"].Status != domain.CourierBusy {
+		t.Errorf("Expected courier BUSY after assignment, got %s", couriers.couriers["c1"].Status)
+	}
+
+	if err := svc.ConfirmPickup(ctx, "d1", "c1", -6.1951, 106.8301); err != nil {
+		t.Fatalf("ConfirmPickup: %v", err)
+	}
+	if len(deliveries.checkins) != 1 || deliveries.checkins[0].ProviderID != "p1" {
+		t.Errorf("Expected one geotagged check-in at p1, got %+v", deliveries.checkins)
+	}
+	otp := deliveries.deliveries["d1"].DropoffOTP
+	if len(otp) != dropoffOTPDigits {
+		t.Fatalf("Expected a %d digit OTP, got %q", dropoffOTPDigits, otp)
+	}
+	// The code goes to the NGO alone, never into the event every consumer reads
+	sent := svc.notifier.(*fakeNotifier)
+	if len(sent.recipients) != 1 || sent.recipients[0] != "n1" || !strings.Contains(sent.messages[0], otp) {
+		t.Errorf("Expected the OTP sent to n1 only, got %v %v", sent.recipients, sent.messages)
+	}
+	if last := deliveries.events[len(deliveries.events)-1]; bytes.Contains(last.Payload, []byte(otp)) {
+		t.Errorf("Expected no OTP in the %s payload, got %s", last.EventType, last.Payload)
+	}
+
+	proof := domain.DeliveryProof{OTP: otp, PhotoRef: "proofs/d1.jpg", Lat: -6.2121, Lon: 106.8351}
+	if err := svc.ConfirmDelivery(ctx, "d1", "c1", proof); err != nil {
+		t.Fatalf("ConfirmDelivery: %v", err)
+	}
+
+	wantEvents := []outbox.EventType{outbox.DeliveryAssigned, outbox.FoodPickedUp, outbox.FoodDelivered}
+	if len(deliveries.events) != len(wantEvents) {
+		t.Fatalf("Expected %d events, got %d", len(wantEvents), len(deliveries.events))
+	}
+	for i, want := range wantEvents {
+		if got := deliveries.events[i]; got.EventType != want || got.AggregateID != "s1" {
+			t.Errorf("Event %d: expected %s on s1, got %s on %s", i, want, got.EventType, got.AggregateID)
+		}
+	}
+
+	// The carbon worker reads vendor, category and weight from the completion payload
+	var payload struct {
+		VendorID string  `json:"vendor_id"`
+		Category string  `json:"category"`
+		WeightKg float64 `json:"weight_kg"`
+	}
+	if err := json.Unmarshal(deliveries.events[2].Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.VendorID != "p1" || payload.Category != "PRODUCE" || payload.WeightKg != 12 {
+		t.Errorf("Unexpected delivered payload: %+v", payload)
+	}
+
+	if couriers.couriers["c1"].Status != domain.CourierOnline {
+		t.Errorf("Expected courier ONLINE after completion, got %s", couriers.couriers["c1"].Status)
+	}
+	if len(assignments.completed) != 1 {
+		t.Errorf("Expected the courier's batches to be completed, got %v", assignments.completed)
+	}
+}
+
+func TestConfirmPickup_RejectsOutsideGeofence(t *testing.T) {
+	ctx := context.Background()
+	svc, deliveries, _, _ := newDeliveryFixture()
+	if err := svc.Assign(ctx, "d1", "c1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// ~1km north of the store
+	err := svc.ConfirmPickup(ctx, "d1", "c1", -6.1860, 106.8300)
+	if !errors.Is(err, ErrOutsidePickupGeofence) {
+		t.Errorf("Expected ErrOutsidePickupGeofence, got %v", err)
+	}
+	if deliveries.deliveries["d1"].Status != domain.DeliveryAssigned {
+		t.Errorf("Expected delivery to stay assigned, got %s", deliveries.deliveries["d1"].Status)
+	}
+}
+
+func TestConfirmDelivery_RequiresMatchingOTP(t *testing.T) {
+	ctx := context.Background()
+	svc, deliveries, _, _ := newDeliveryFixture()
+	if err := svc.Assign(ctx, "d1", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ConfirmPickup(ctx, "d1", "c1", -6.1950, 106.8300); err != nil {
+		t.Fatal(err)
+	}
+
+	proof := domain.DeliveryProof{OTP: "not-it", PhotoRef: "proofs/d1.jpg", Lat: -6.2120, Lon: 106.8350}
+	if err := svc.ConfirmDelivery(ctx, "d1", "c1", proof); !errors.Is(err, ErrInvalidDeliveryOTP) {
+		t.Errorf("Expected ErrInvalidDeliveryOTP, got %v", err)
+	}
+	if deliveries.deliveries["d1"].Status != domain.DeliveryPickedUp {
+		t.Errorf("Expected delivery to stay picked_up, got %s", deliveries.deliveries["d1"].Status)
+	}
+}
+
+func TestDeliveryTransitions_OnlyHolderMayAdvance(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _, _ := newDeliveryFixture()
+
+	// Pickup before assignment is not a legal step
+	if err := svc.ConfirmPickup(ctx, "d1", "", -6.1950, 106.8300); !errors.Is(err, domain.ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition, got %v", err)
+	}
+
+	if err := svc.Assign(ctx, "d1", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Assign(ctx, "d1", "c2"); !errors.Is(err, domain.ErrInvalidTransition) {
+		t.Errorf("Expected second assignment to be refused, got %v", err)
+	}
+	if err := svc.Fail(ctx, "d1", "c2", "flat tyre"); !errors.Is(err, ErrNotDeliveryCourier) {
+		t.Errorf("Expected ErrNotDeliveryCourier, got %v", err)
+	}
+}
@@ -2,24 +2,45 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/golang/geo/s2"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 
 	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
 )
 
+const (
+	// MaxBatchWait is how long a batchable order may wait for companions
+	// before the deadline scanner forces it out (The "HEMAT" Guarantee)
+	MaxBatchWait = 5 * time.Minute
+
+	BatchInterval        = 30 * time.Second
+	DeadlineScanInterval = 5 * time.Second
+	deadlineScanLimit    = 100
+)
+
+// ErrOrderWithoutDelivery refuses orders no deliveries row tracks: nothing
+// would ever finish them, so the courier who took the batch would stay BUSY
+var ErrOrderWithoutDelivery = errors.New("order must carry the delivery_id of a claimed delivery")
+
 type DispatchService struct {
 	batchEngine *BatchingEngine
 	// escrow logic is separated
-	pendingOrders []domain.Order // Queue
+	queue    domain.OrderQueue // Shared across replicas, survives restarts
+	assigner *AssignmentService
+	logger   *zap.Logger
 }
 
-func NewDispatchService(engine *BatchingEngine) *DispatchService {
+func NewDispatchService(engine *BatchingEngine, queue domain.OrderQueue, assigner *AssignmentService, logger *zap.Logger) *DispatchService {
 	return &DispatchService{
-		batchEngine:   engine,
-		pendingOrders: make([]domain.Order, 0),
+		batchEngine: engine,
+		queue:       queue,
+		assigner:    assigner,
+		logger:      logger,
 	}
 }
 
@@ -32,49 +53,182 @@ func (s *DispatchService) CreateOrder(ctx context.Context, order domain.Order) (
 	if order.QuantityKg <= 0 {
 		return nil, fmt.Errorf("invalid quantity")
 	}
+	if order.DeliveryID == "" {
+		return nil, ErrOrderWithoutDelivery
+	}
 
 	order.ID = uuid.New().String()
 	order.Status = "PENDING_MATCHING"
 	order.CreatedAt = time.Now()
 
 	// 3. Queue for Batching
-	s.pendingOrders = append(s.pendingOrders, order)
+	// EXPRESS/CRITICAL are due immediately; everything else gets the anti-stuck deadline
+	dispatchBy := order.CreatedAt.Add(MaxBatchWait)
+	urgent := order.CurrentSLA == domain.SLA_EXPRESS || order.CurrentSLA == domain.SLA_CRITICAL
+	if urgent {
+		dispatchBy = order.CreatedAt
+	}
+
+	if err := s.queue.Enqueue(ctx, order, dispatchBy); err != nil {
+		return nil, err
+	}
 
 	// 4. Trigger Instant Dispatch for EXPRESS/CRITICAL
-	if order.CurrentSLA == domain.SLA_EXPRESS || order.CurrentSLA == domain.SLA_CRITICAL {
-		go s.ForceDispatch(order.ID)
-	} else {
-		// 5. Anti-Stuck Timer (The "HEMAT" Guarantee)
-		go func(oid string) {
-			time.Sleep(5 * time.Minute)
-			s.ForceDispatch(oid) // If still pending after 5m, force assign
-		}(order.ID)
+	// If this fails the deadline scanner will pick the order up on its next pass
+	if urgent {
+		if err := s.ForceDispatch(ctx, order.ID); err != nil {
+			s.logger.Warn("Instant dispatch failed, deferring to deadline scanner",
+				zap.String("order_id", order.ID), zap.Error(err))
+		}
 	}
 
 	return &order, nil
 }
 
 // ForceDispatch bypasses batching wait time
-func (s *DispatchService) ForceDispatch(orderID string) {
-	// Logic to convert Pending Order -> Active Batch (Size 1)
-	// In production: Remove from Redis Queue, Create Batch, assign to Courier
-	fmt.Printf("[Dispatch] Forcing order %s to dispatch immediately (SLA Enforcement)\n", orderID)
+func (s *DispatchService) ForceDispatch(ctx context.Context, orderID string) error {
+	orders, err := s.queue.Take(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if len(orders) == 0 {
+		return nil // Already dispatched by another replica or batch
+	}
+
+	s.dispatchSingles(ctx, orders)
+	return nil
 }
 
-// ProcessBatch runs periodically (e.g., every 30s)
+// RunBatchProcessor runs periodically (e.g., every 30s)
 func (s *DispatchService) RunBatchProcessor(ctx context.Context) {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(BatchInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			// Calculate Optimal Batches
-			// Mock courier location for simplicity
-			// courierLoc := s2.LatLngFromDegrees(-6.2, 106.8)
+			if err := s.processBatches(ctx); err != nil {
+				s.logger.Error("Batch processing failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// RunDeadlineScanner forces out every order whose dispatch deadline has passed.
+// It replaces the per-order sleep goroutine, so deadlines survive restarts.
+func (s *DispatchService) RunDeadlineScanner(ctx context.Context) {
+	ticker := time.NewTicker(DeadlineScanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.dispatchDue(ctx, now); err != nil {
+				s.logger.Error("Deadline scan failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *DispatchService) dispatchDue(ctx context.Context, now time.Time) error {
+	// Orders a replica took but never handed on are due again
+	requeued, err := s.queue.RequeueExpired(ctx, now, deadlineScanLimit)
+	if err != nil {
+		return err
+	}
+	if requeued > 0 {
+		s.logger.Warn("Requeued orders whose dispatch lease expired", zap.Int("count", requeued))
+	}
+
+	for {
+		orders, err := s.queue.TakeDue(ctx, now, deadlineScanLimit)
+		if err != nil {
+			return err
+		}
+		s.dispatchSingles(ctx, orders)
+		if len(orders) < deadlineScanLimit {
+			return nil
+		}
+	}
+}
+
+// processBatches dispatches every batch that has reached its SLA or weight capacity.
+// Partial batches stay queued until they fill up or their deadline expires.
+func (s *DispatchService) processBatches(ctx context.Context) error {
+	pending, err := s.queue.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// Mock courier location for simplicity
+	courierLoc := s2.LatLngFromDegrees(-6.2, 106.8)
+
+	batches, err := s.batchEngine.CalculateOptimalBatch(ctx, pending, courierLoc)
+	if err != nil {
+		return err
+	}
+
+	for _, batch := range batches {
+		if !s.batchEngine.IsFull(batch) {
+			continue
+		}
+
+		ids := make([]string, len(batch.Orders))
+		for i, o := range batch.Orders {
+			ids[i] = o.ID
+		}
+
+		// Another replica may have taken some of these already; only dispatch what we own
+		taken, err := s.queue.Take(ctx, ids...)
+		if err != nil {
+			return err
+		}
+		if len(taken) == 0 {
+			continue
+		}
+		batch.Orders = taken
+		s.dispatchBatch(ctx, batch)
+	}
+	return nil
+}
+
+func (s *DispatchService) dispatchSingles(ctx context.Context, orders []domain.Order) {
+	for _, o := range orders {
+		s.dispatchBatch(ctx, domain.Batch{
+			ID:     "batch-" + o.ID,
+			Orders: []domain.Order{o},
+			Score:  999.0, // Highest priority
+		})
+	}
+}
+
+// dispatchBatch hands a batch over for courier assignment.
+// Orders are on a lease until then: acked once submitted, back in as due on
+// failure, and requeued by the deadline scanner if this replica dies first.
+func (s *DispatchService) dispatchBatch(ctx context.Context, batch domain.Batch) {
+	err := s.assigner.Submit(ctx, batch)
+	if err == nil {
+		ids := make([]string, len(batch.Orders))
+		for i, o := range batch.Orders {
+			ids[i] = o.ID
+		}
+		if err := s.queue.Ack(ctx, ids...); err != nil {
+			s.logger.Error("Failed to ack dispatched orders", zap.String("batch_id", batch.ID), zap.Error(err))
+		}
+		return
+	}
 
-			// result, _ := s.batchEngine.CalculateOptimalBatch(ctx, s.pendingOrders, courierLoc)
-			// Assign batches...
+	s.logger.Error("Failed to submit batch for assignment, requeueing",
+		zap.String("batch_id", batch.ID), zap.Error(err))
+	now := time.Now()
+	for _, o := range batch.Orders {
+		if err := s.queue.Enqueue(ctx, o, now); err != nil {
+			s.logger.Error("Failed to requeue order", zap.String("order_id", o.ID), zap.Error(err))
 		}
 	}
 }
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/ledger"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+const (
+	// PayoutHold keeps fresh earnings out of payouts until the dispute window closes
+	PayoutHold           = 24 * time.Hour
+	earningsHistoryLimit = 50
+)
+
+// EarningsService prices deliveries when a courier takes them and credits the
+// courier ledger when they are completed
+type EarningsService struct {
+	engine      *FeeEngine
+	earnings    domain.EarningsRepository
+	journal     *ledger.Service
+	deliveries  *DeliveryService
+	couriers    domain.CourierRepository
+	assignments domain.AssignmentRepository
+	locator     CourierLocator
+	logger      *zap.Logger
+}
+
+func NewEarningsService(engine *FeeEngine, earnings domain.EarningsRepository, journal *ledger.Service, deliveries *DeliveryService, couriers domain.CourierRepository, assignments domain.AssignmentRepository, locator CourierLocator, logger *zap.Logger) *EarningsService {
+	return &EarningsService{
+		engine:      engine,
+		earnings:    earnings,
+		journal:     journal,
+		deliveries:  deliveries,
+		couriers:    couriers,
+		assignments: assignments,
+		locator:     locator,
+		logger:      logger,
+	}
+}
+
+// PriceDeliveries fixes the fee of every delivery a courier just accepted.
+// batchSize is the whole batch, so shared rides get their discount.
+func (s *EarningsService) PriceDeliveries(ctx context.Context, orders []domain.Order, batchSize int) {
+	for _, o := range orders {
+		if _, err := s.PriceDelivery(ctx, o, batchSize); err != nil {
+			s.logger.Warn("Failed to price delivery", zap.String("delivery_id", o.DeliveryID), zap.Error(err))
+		}
+	}
+}
+
+// PriceDelivery prices one delivery and, for donations to an NGO, draws the
+// fee from this month's subsidy budget as far as it reaches
+func (s *EarningsService) PriceDelivery(ctx context.Context, o domain.Order, batchSize int) (*domain.FeeBreakdown, error) {
+	d, err := s.deliveries.Get(ctx, o.DeliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	fee := s.engine.Calculate(ctx, FeeInput{
+		PickupLat:  o.PickupLat,
+		PickupLon:  o.PickupLon,
+		DropoffLat: o.DropoffLat,
+		DropoffLon: o.DropoffLon,
+		SLA:        o.CurrentSLA,
+		ColdChain:  o.RequiresColdChain() || d.RequiresColdChain,
+		BatchSize:  batchSize,
+		Surge:      s.surgeAt(ctx, o.PickupLat, o.PickupLon),
+		IsDonation: d.IsDonation,
+	})
+
+	if d.IsDonation && d.NGOID != "" {
+		granted, err := s.earnings.ReserveSubsidy(ctx, d.ID, time.Now(), fee.Total)
+		if err != nil {
+			// Unsubsidised is still deliverable; the NGO is billed the difference
+			s.logger.Warn("Subsidy reservation failed", zap.String("delivery_id", d.ID), zap.Error(err))
+		}
+		s.engine.ApplySubsidy(&fee, granted)
+	}
+
+	if err := s.earnings.SetDeliveryFee(ctx, d.ID, fee); err != nil {
+		return nil, err
+	}
+	return &fee, nil
+}
+
+// RecordDelivery credits the courier for a completed delivery. Safe to call
+// more than once: the ledger keeps one DELIVERY entry per delivery.
+func (s *EarningsService) RecordDelivery(ctx context.Context, deliveryID string) error {
+	d, err := s.deliveries.Get(ctx, deliveryID)
+	if err != nil {
+		return err
+	}
+	// Self-pickups earn nobody anything; partner fleets invoice the platform
+	if d.Status != domain.DeliveryDelivered || d.CourierID == "" {
+		return nil
+	}
+
+	fee := d.Fee
+	if fee == nil {
+		// Taken outside a batch offer (direct accept): price it as a standard solo trip
+		fee, err = s.PriceDelivery(ctx, domain.Order{
+			DeliveryID:   d.ID,
+			PickupLat:    d.ProviderLat,
+			PickupLon:    d.ProviderLon,
+			DropoffLat:   d.NGOLat,
+			DropoffLon:   d.NGOLon,
+			TempCategory: d.TempCategory,
+			CurrentSLA:   domain.SLA_STANDARD,
+		}, 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	deliveredAt := time.Now()
+	if d.DeliveredAt != nil {
+		deliveredAt = *d.DeliveredAt
+	}
+	entry := &domain.EarningEntry{
+		CourierID:   d.CourierID,
+		DeliveryID:  d.ID,
+		Kind:        domain.EarningDelivery,
+		Amount:      fee.CourierEarning,
+		Points:      fee.CourierPoints,
+		AvailableAt: deliveredAt.Add(PayoutHold),
+	}
+	created, err := s.earnings.Append(ctx, entry)
+	if err != nil {
+		return err
+	}
+	if created {
+		s.logger.Info("Courier credited",
+			zap.String("courier_id", d.CourierID),
+			zap.String("delivery_id", d.ID),
+			zap.Int64("amount", entry.Amount.Units()),
+			zap.Int("points", entry.Points))
+	}
+
+	// Booked on every call so a crash between the two writes heals on redelivery
+	return s.journal.RecordDeliveryFee(ctx, ledger.DeliveryFee{
+		DeliveryID:     d.ID,
+		CourierID:      d.CourierID,
+		RecipientID:    d.NGOID,
+		RecipientPays:  fee.RecipientPays.Units(),
+		Subsidy:        fee.Subsidy.Units(),
+		CourierEarning: fee.CourierEarning.Units(),
+	})
+}
+
+// Summary returns the courier's balance split into payout-eligible and on hold,
+// with the most recent ledger entries
+func (s *EarningsService) Summary(ctx context.Context, courierID string) (*domain.EarningsSummary, []domain.EarningEntry, error) {
+	if _, err := s.couriers.GetByID(ctx, courierID); err != nil {
+		return nil, nil, err
+	}
+	summary, err := s.earnings.Summary(ctx, courierID, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := s.earnings.ListByCourier(ctx, courierID, earningsHistoryLimit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return summary, entries, nil
+}
+
+// SetSubsidyBudget sets the platform money available for donation deliveries in a month
+func (s *EarningsService) SetSubsidyBudget(ctx context.Context, month time.Time, budget money.Money) error {
+	return s.earnings.SetSubsidyBudget(ctx, month, budget)
+}
+
+// SubsidyBudget reports how much of a month's subsidy budget is spent
+func (s *EarningsService) SubsidyBudget(ctx context.Context, month time.Time) (*domain.SubsidyBudget, error) {
+	return s.earnings.GetSubsidyBudget(ctx, month)
+}
+
+// surgeAt counts open batches and idle riders around a pickup; on any lookup
+// failure there is no surge rather than a guessed one
+func (s *EarningsService) surgeAt(ctx context.Context, lat, lon float64) float64 {
+	nearby, err := s.locator.FindCouriersNearby(ctx, lat, lon, CourierSearchRadiusMeters)
+	if err != nil {
+		return 1
+	}
+	idle := 0
+	if len(nearby) > 0 {
+		ids := make([]string, len(nearby))
+		for i, loc := range nearby {
+			ids[i] = loc.CourierID
+		}
+		couriers, err := s.couriers.ListByIDs(ctx, ids)
+		if err != nil {
+			return 1
+		}
+		for _, c := range couriers {
+			if c.Status == domain.CourierOnline {
+				idle++
+			}
+		}
+	}
+
+	searching, err := s.assignments.ListSearching(ctx, assignmentBatchLimit)
+	if err != nil {
+		return 1
+	}
+	open := 0
+	for _, a := range searching {
+		if len(a.Batch.Orders) == 0 {
+			continue
+		}
+		first := a.Batch.Orders[0]
+		if Haversine(lat, lon, first.PickupLat, first.PickupLon)*1000 <= CourierSearchRadiusMeters {
+			open++
+		}
+	}
+	return s.engine.SurgeFactor(open, idle)
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/ledger"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+type fakeEarningsRepo struct {
+	deliveries *fakeDeliveryRepo
+	budget     money.Money
+	spent      money.Money
+	subsidies  map[string]money.Money
+	entries    []domain.EarningEntry
+}
+
+func (r *fakeEarningsRepo) SetDeliveryFee(ctx context.Context, deliveryID string, fee domain.FeeBreakdown) error {
+	d, ok := r.deliveries.deliveries[deliveryID]
+	if !ok {
+		return domain.ErrDeliveryNotFound
+	}
+	d.Fee = &fee
+	return nil
+}
+
+func (r *fakeEarningsRepo) ReserveSubsidy(ctx context.Context, deliveryID string, at time.Time, amount money.Money) (money.Money, error) {
+	if granted, ok := r.subsidies[deliveryID]; ok {
+		return granted, nil
+	}
+	granted := money.Min(r.budget.Sub(r.spent), amount)
+	r.spent = r.spent.Add(granted)
+	r.subsidies[deliveryID] = granted
+	return granted, nil
+}
+
+func (r *fakeEarningsRepo) SetSubsidyBudget(ctx context.Context, month time.Time, budget money.Money) error {
+	r.budget = budget
+	return nil
+}
+
+func (r *fakeEarningsRepo) GetSubsidyBudget(ctx context.Context, month time.Time) (*domain.SubsidyBudget, error) {
+	return &domain.SubsidyBudget{Month: month, Budget: r.budget, Spent: r.spent}, nil
+}
+
+func (r *fakeEarningsRepo) Append(ctx context.Context, e *domain.EarningEntry) (bool, error) {
+	for _, existing := range r.entries {
+		if e.Kind == domain.EarningDelivery && existing.Kind == e.Kind && existing.DeliveryID == e.DeliveryID {
+			return false, nil
+		}
+	}
+	r.entries = append(r.entries, *e)
+	return true, nil
+}
+
+func (r *fakeEarningsRepo) Summary(ctx context.Context, courierID string, now time.Time) (*domain.EarningsSummary, error) {
+	s := domain.EarningsSummary{CourierID: courierID, AsOf: now}
+	for _, e := range r.entries {
+		if e.CourierID != courierID {
+			continue
+		}
+		s.Balance = s.Balance.Add(e.Amount)
+		s.Points += e.Points
+		if e.Kind == domain.EarningDelivery {
+			s.Deliveries++
+			s.Earned = s.Earned.Add(e.Amount)
+			if e.AvailableAt.After(now) {
+				s.OnHold = s.OnHold.Add(e.Amount)
+			}
+		}
+	}
+	s.PayoutEligible = s.Balance.Sub(s.OnHold)
+	return &s, nil
+}
+
+func (r *fakeEarningsRepo) ListByCourier(ctx context.Context, courierID string, limit int) ([]domain.EarningEntry, error) {
+	return r.entries, nil
+}
+
+type noSearchingBatches struct{ domain.AssignmentRepository }
+
+func (noSearchingBatches) ListSearching(ctx context.Context, limit int) ([]domain.Assignment, error) {
+	return nil, nil
+}
+
+func TestFeeEngine_Calculate(t *testing.T) {
+	ctx := context.Background()
+	engine := NewFeeEngine(nil, DefaultFeeSchedule())
+	trip := FeeInput{
+		PickupLat: -6.1950, PickupLon: 106.8300,
+		DropoffLat: -6.2500, DropoffLon: 106.8450,
+		SLA: domain.SLA_STANDARD, BatchSize: 1, Surge: 1,
+	}
+
+	standard := engine.Calculate(ctx, trip)
+	if !standard.CourierEarning.Add(standard.PlatformFee).Equal(standard.Total) {
+		t.Errorf("Courier and platform shares must add up to the total, got %+v", standard)
+	}
+	if !standard.Total.Equal(standard.RecipientPays) || standard.Total.Units()%100 != 0 {
+		t.Errorf("Expected an unsubsidised fee rounded to 100 IDR, got %+v", standard)
+	}
+
+	critical, hemat := trip, trip
+	critical.SLA, hemat.SLA = domain.SLA_CRITICAL, domain.SLA_HEMAT
+	if c, h := engine.Calculate(ctx, critical), engine.Calculate(ctx, hemat); !(c.Total.GreaterThan(standard.Total) && standard.Total.GreaterThan(h.Total)) {
+		t.Errorf("Expected CRITICAL > STANDARD > HEMAT, got %v / %v / %v", c.Total, standard.Total, h.Total)
+	}
+
+	cold := trip
+	cold.ColdChain = true
+	if f := engine.Calculate(ctx, cold); f.ColdChainSurcharge.IsZero() || !f.Total.GreaterThan(standard.Total) || f.CourierPoints <= standard.CourierPoints {
+		t.Errorf("Expected the cold-chain surcharge and bonus points, got %+v", f)
+	}
+
+	shared := trip
+	shared.BatchSize = 6
+	if f := engine.Calculate(ctx, shared); f.BatchDiscount != DefaultFeeSchedule().MaxBatchDiscount {
+		t.Errorf("Expected the batch discount capped at %v, got %v", DefaultFeeSchedule().MaxBatchDiscount, f.BatchDiscount)
+	}
+
+	surged := trip
+	surged.Surge = 5
+	if f := engine.Calculate(ctx, surged); f.SurgeFactor != DefaultFeeSchedule().MaxSurge {
+		t.Errorf("Expected surge capped at %v, got %v", DefaultFeeSchedule().MaxSurge, f.SurgeFactor)
+	}
+
+	around := trip
+	around.DropoffLat, around.DropoffLon = trip.PickupLat, trip.PickupLon
+	if f := engine.Calculate(ctx, around); !f.Total.Equal(DefaultFeeSchedule().MinimumFee) {
+		t.Errorf("Expected the minimum fee for a zero-length trip, got %v", f.Total)
+	}
+}
+
+func TestFeeEngine_SurgeFactor(t *testing.T) {
+	engine := NewFeeEngine(nil, DefaultFeeSchedule())
+	cases := []struct {
+		open, idle int
+		want       float64
+	}{
+		{0, 0, 1},
+		{2, 4, 1},
+		{4, 2, 1.25},
+		{3, 0, 2},
+		{20, 1, 2},
+	}
+	for _, tc := range cases {
+		if got := engine.SurgeFactor(tc.open, tc.idle); got != tc.want {
+			t.Errorf("SurgeFactor(%d open, %d idle) = %v, want %v", tc.open, tc.idle, got, tc.want)
+		}
+	}
+}
+
+func TestEarnings_SubsidisesDonationAndCreditsCourierOnce(t *testing.T) {
+	ctx := context.Background()
+	deliveries, deliveryRepo, couriers, _ := newDeliveryFixture()
+	deliveryRepo.deliveries["d1"].IsDonation = true
+	deliveryRepo.deliveries["d1"].NGOID = "ngo-1"
+	earningsRepo := &fakeEarningsRepo{deliveries: deliveryRepo, budget: money.Rupiah(5000), subsidies: map[string]money.Money{}}
+	journal := ledger.NewService(ledger.NewMemoryRepository(), zap.NewNop())
+	svc := NewEarningsService(NewFeeEngine(nil, DefaultFeeSchedule()), earningsRepo, journal, deliveries, couriers, noSearchingBatches{}, noCouriersNearby{}, zap.NewNop())
+
+	d := deliveryRepo.deliveries["d1"]
+	order := domain.Order{
+		DeliveryID: "d1", PickupLat: d.ProviderLat, PickupLon: d.ProviderLon,
+		DropoffLat: d.NGOLat, DropoffLon: d.NGOLon, CurrentSLA: domain.SLA_STANDARD,
+	}
+	fee, err := svc.PriceDelivery(ctx, order, 1)
+	if err != nil {
+		t.Fatalf("PriceDelivery: %v", err)
+	}
+	if !fee.Subsidy.Equal(money.Rupiah(5000)) || !fee.RecipientPays.Equal(fee.Total.Sub(money.Rupiah(5000))) {
+		t.Errorf("Expected the remaining 5000 IDR budget to be drawn, got %+v", fee)
+	}
+	if again, _ := svc.PriceDelivery(ctx, order, 1); !again.Subsidy.Equal(money.Rupiah(5000)) || !earningsRepo.spent.Equal(money.Rupiah(5000)) {
+		t.Errorf("Repricing must reuse the grant, got subsidy %v with %v spent", again.Subsidy, earningsRepo.spent)
+	}
+
+	// Not delivered yet: nothing to credit
+	if err := svc.RecordDelivery(ctx, "d1"); err != nil || len(earningsRepo.entries) != 0 {
+		t.Fatalf("Expected no credit before delivery, got %v / %+v", err, earningsRepo.entries)
+	}
+
+	deliveredAt := time.Now()
+	d.Status, d.CourierID, d.DeliveredAt = domain.DeliveryDelivered, "c1", &deliveredAt
+	for i := 0; i < 2; i++ {
+		if err := svc.RecordDelivery(ctx, "d1"); err != nil {
+			t.Fatalf("RecordDelivery: %v", err)
+		}
+	}
+	if len(earningsRepo.entries) != 1 || !earningsRepo.entries[0].Amount.Equal(fee.CourierEarning) {
+		t.Fatalf("Expected one credit of %v, got %+v", fee.CourierEarning, earningsRepo.entries)
+	}
+	// The fee is booked once: courier and platform share what the NGO and the subsidy paid
+	owed, _ := journal.Balance(ctx, ledger.CourierPayable("c1"))
+	subsidy, _ := journal.Balance(ctx, ledger.PromoBudget)
+	if owed.Net != fee.CourierEarning.Units() || subsidy.Net != 5000 {
+		t.Errorf("Expected the courier owed %v from a 5000 subsidy, got %+v / %+v", fee.CourierEarning, owed, subsidy)
+	}
+	if _, err := journal.CheckInvariant(ctx); err != nil {
+		t.Errorf("Journal out of balance: %v", err)
+	}
+
+	summary, _, err := svc.Summary(ctx, "c1")
+	if err != nil {
+		t.Fatalf("Summary: %v", err)
+	}
+	if !summary.OnHold.Equal(fee.CourierEarning) || !summary.PayoutEligible.IsZero() {
+		t.Errorf("Expected fresh earnings on hold, got %+v", summary)
+	}
+}
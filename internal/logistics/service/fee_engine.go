@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"math"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
+)
+
+// roadDetourFactor turns straight-line distance into a road estimate when the router is down
+const roadDetourFactor = 1.3
+
+// FeeSchedule is the tariff
+type FeeSchedule struct {
+	FlagFall           money.Money
+	PerKm              money.Money
+	MinimumFee         money.Money
+	SLAMultipliers     map[domain.DeliverySLA]float64
+	ColdChainSurcharge money.Money
+	BatchDiscountStep  float64 // Off per extra order sharing the ride
+	MaxBatchDiscount   float64
+	MaxSurge           float64
+	CourierShare       float64     // Fraction of the fee paid to the courier
+	RoundTo            money.Money // Fees are quoted in whole hundreds of rupiah
+	PointsPerKm        float64
+	ColdChainPoints    int
+	CriticalPoints     int
+}
+
+// DefaultFeeSchedule mirrors the rates riders see on the big ride-hailing apps
+func DefaultFeeSchedule() FeeSchedule {
+	return FeeSchedule{
+		FlagFall:   money.Rupiah(5000),
+		PerKm:      money.Rupiah(2500),
+		MinimumFee: money.Rupiah(8000),
+		SLAMultipliers: map[domain.DeliverySLA]float64{
+			domain.SLA_CRITICAL: 1.5,
+			domain.SLA_EXPRESS:  1.3,
+			domain.SLA_STANDARD: 1.0,
+			domain.SLA_HEMAT:    0.85,
+		},
+		ColdChainSurcharge: money.Rupiah(5000),
+		BatchDiscountStep:  0.10,
+		MaxBatchDiscount:   0.30,
+		MaxSurge:           2.0,
+		CourierShare:       0.80,
+		RoundTo:            money.Rupiah(100),
+		PointsPerKm:        10,
+		ColdChainPoints:    20,
+		CriticalPoints:     30,
+	}
+}
+
+// FeeInput is one delivery to price
+type FeeInput struct {
+	PickupLat  float64
+	PickupLon  float64
+	DropoffLat float64
+	DropoffLon float64
+	SLA        domain.DeliverySLA
+	ColdChain  bool
+	BatchSize  int     // Orders sharing the courier's trip
+	Surge      float64 // Demand/supply multiplier, see SurgeFactor
+	IsDonation bool
+}
+
+// FeeEngine prices deliveries
+type FeeEngine struct {
+	router   TravelTimer
+	schedule FeeSchedule
+}
+
+func NewFeeEngine(router TravelTimer, schedule FeeSchedule) *FeeEngine {
+	return &FeeEngine{router: router, schedule: schedule}
+}
+
+// Calculate prices a delivery: (flag fall + per-km) × SLA, plus cold chain,
+// less the shared-ride discount, times surge. Subsidy is left to the caller,
+// who has to draw it from the budget.
+func (e *FeeEngine) Calculate(ctx context.Context, in FeeInput) domain.FeeBreakdown {
+	sch := e.schedule
+	km := e.distanceKm(ctx, in)
+
+	slaMultiplier, ok := sch.SLAMultipliers[in.SLA]
+	if !ok {
+		slaMultiplier = 1
+	}
+	batchSize := in.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	discount := math.Min(float64(batchSize-1)*sch.BatchDiscountStep, sch.MaxBatchDiscount)
+	surge := math.Max(1, math.Min(in.Surge, sch.MaxSurge))
+
+	// Multipliers work on the exact per-km amount; only quoted amounts are rounded
+	base := sch.FlagFall.Float64() + sch.PerKm.Float64()*km
+	f := domain.FeeBreakdown{
+		DistanceKm:    math.Round(km*100) / 100,
+		SLA:           in.SLA,
+		BaseFee:       money.FromFloat(base, money.HalfUp),
+		SLAMultiplier: slaMultiplier,
+		BatchSize:     batchSize,
+		BatchDiscount: discount,
+		SurgeFactor:   surge,
+	}
+	if in.ColdChain {
+		f.ColdChainSurcharge = sch.ColdChainSurcharge
+	}
+
+	total := (base*slaMultiplier + f.ColdChainSurcharge.Float64()) * (1 - discount) * surge
+	f.Total = e.round(math.Max(total, sch.MinimumFee.Float64()))
+	f.CourierEarning = e.round(f.Total.Float64() * sch.CourierShare)
+	f.PlatformFee = f.Total.Sub(f.CourierEarning)
+	f.RecipientPays = f.Total
+
+	points := km * sch.PointsPerKm
+	if in.ColdChain {
+		points += float64(sch.ColdChainPoints)
+	}
+	if in.SLA == domain.SLA_CRITICAL {
+		points += float64(sch.CriticalPoints)
+	}
+	f.CourierPoints = int(math.Round(points))
+	return f
+}
+
+// ApplySubsidy moves granted platform money from the recipient's share of the fee.
+// The courier is paid the same either way.
+func (e *FeeEngine) ApplySubsidy(f *domain.FeeBreakdown, granted money.Money) {
+	f.Subsidy = money.Min(granted, f.Total)
+	f.RecipientPays = f.Total.Sub(f.Subsidy)
+}
+
+// SurgeFactor compares open work around a pickup with idle riders there:
+// +25% for every extra open batch per idle rider, capped by the schedule
+func (e *FeeEngine) SurgeFactor(openBatches, idleCouriers int) float64 {
+	if openBatches <= idleCouriers {
+		return 1
+	}
+	if idleCouriers == 0 {
+		return e.schedule.MaxSurge
+	}
+	ratio := float64(openBatches) / float64(idleCouriers)
+	return math.Min(1+0.25*(ratio-1), e.schedule.MaxSurge)
+}
+
+// distanceKm is the road distance: drive time from the router at city average
+// speed, never less than the straight line. Without a router, a detour factor.
+func (e *FeeEngine) distanceKm(ctx context.Context, in FeeInput) float64 {
+	straight := Haversine(in.PickupLat, in.PickupLon, in.DropoffLat, in.DropoffLon)
+	if e.router == nil {
+		return straight * roadDetourFactor
+	}
+	d, err := e.router.GetTravelTime(ctx, in.PickupLat, in.PickupLon, in.DropoffLat, in.DropoffLon)
+	if err != nil || d <= 0 {
+		return straight * roadDetourFactor
+	}
+	return math.Max(d.Hours()*fallbackSpeedKmh, straight)
+}
+
+// round quotes an amount in the schedule's step, half up
+func (e *FeeEngine) round(v float64) money.Money {
+	step := e.schedule.RoundTo.Units()
+	if step <= 0 {
+		return money.FromFloat(v, money.HalfUp)
+	}
+	return money.FromFloat(v/float64(step), money.HalfUp).Mul(step)
+}
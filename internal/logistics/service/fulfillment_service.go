@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+// In-house tariff, used to compare our riders against partner quotes
+const (
+	InHouseBaseFare = 7000.0 // IDR
+	InHousePerKm    = 2000.0 // IDR per started km
+)
+
+// FulfillmentDecision records which fleet got an order and what it was weighed against
+type FulfillmentDecision struct {
+	Provider   string          `json:"provider"`
+	Quote      *domain.Quote   `json:"quote,omitempty"`
+	Considered []domain.Quote  `json:"considered"`
+	Order      *domain.Order   `json:"order,omitempty"`   // In-house: queued for batching
+	Booking    *domain.Booking `json:"booking,omitempty"` // External: partner booking
+}
+
+// FulfillmentService decides per order whether our riders or a partner fleet
+// carries it, books the partner and folds its status callbacks back into the
+// delivery lifecycle.
+type FulfillmentService struct {
+	dispatch   *DispatchService
+	deliveries *DeliveryService
+	couriers   domain.CourierRepository
+	locator    CourierLocator
+	providers  map[string]domain.CourierProvider
+	logger     *zap.Logger
+}
+
+func NewFulfillmentService(dispatch *DispatchService, deliveries *DeliveryService, couriers domain.CourierRepository, locator CourierLocator, providers []domain.CourierProvider, logger *zap.Logger) *FulfillmentService {
+	byName := make(map[string]domain.CourierProvider, len(providers))
+	for _, p := range providers {
+		byName[p.Name()] = p
+	}
+	return &FulfillmentService{
+		dispatch:   dispatch,
+		deliveries: deliveries,
+		couriers:   couriers,
+		locator:    locator,
+		providers:  byName,
+		logger:     logger,
+	}
+}
+
+// Dispatch sends an order to the best fleet. Only orders backed by a deliveries
+// row can go external, since that row is what partner callbacks update. If the
+// chosen partner fails to book, the order falls back to our own riders.
+func (s *FulfillmentService) Dispatch(ctx context.Context, order domain.Order) (*FulfillmentDecision, error) {
+	decision := &FulfillmentDecision{Provider: domain.InHouseProvider}
+	if order.DeliveryID != "" {
+		// Whoever carries it, a claim that stalls is refunded on this tier's SLA
+		if err := s.deliveries.SetSLATier(ctx, order.DeliveryID, order.PromisedSLA()); err != nil {
+			return nil, err
+		}
+	}
+	if order.DeliveryID != "" && len(s.providers) > 0 {
+		now := time.Now()
+		decision.Considered = s.Quotes(ctx, order)
+		promised := order
+		promised.CreatedAt = now
+		decision.Quote = SelectQuote(decision.Considered, now, promised.Deadline())
+
+		if decision.Quote != nil && decision.Quote.Provider != domain.InHouseProvider {
+			booking, err := s.book(ctx, order, decision.Quote)
+			if err == nil {
+				decision.Provider = booking.Provider
+				decision.Booking = booking
+				return decision, nil
+			}
+			s.logger.Warn("External booking failed, falling back to in-house riders",
+				zap.String("delivery_id", order.DeliveryID),
+				zap.String("provider", decision.Quote.Provider),
+				zap.Error(err))
+		}
+	}
+
+	created, err := s.dispatch.CreateOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	decision.Provider = domain.InHouseProvider
+	decision.Order = created
+	return decision, nil
+}
+
+// Quotes collects an in-house estimate and every partner quote in parallel.
+// Partners that decline or time out are left out.
+func (s *FulfillmentService) Quotes(ctx context.Context, order domain.Order) []domain.Quote {
+	req := shipmentFor(order)
+	results := make([]*domain.Quote, len(s.providers)+1)
+
+	// Fixed order keeps the selection deterministic when partners tie
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, p domain.CourierProvider) {
+			defer wg.Done()
+			q, err := p.Quote(ctx, req)
+			if err != nil {
+				s.logger.Info("Provider did not quote", zap.String("provider", p.Name()), zap.Error(err))
+				return
+			}
+			results[i] = q
+		}(i, s.providers[name])
+	}
+
+	inHouse, err := s.inHouseQuote(ctx, order)
+	if err == nil {
+		results[len(results)-1] = inHouse
+	}
+	wg.Wait()
+
+	var quotes []domain.Quote
+	for _, q := range results {
+		if q != nil {
+			quotes = append(quotes, *q)
+		}
+	}
+	return quotes
+}
+
+// SelectQuote picks the cheapest option that still makes the deadline, then the
+// fastest on equal price (in-house wins exact ties). If nothing is on time it
+// takes the fastest, because late food beats spoiled food.
+func SelectQuote(quotes []domain.Quote, now, deadline time.Time) *domain.Quote {
+	if len(quotes) == 0 {
+		return nil
+	}
+	ranked := make([]domain.Quote, len(quotes))
+	copy(ranked, quotes)
+	sort.SliceStable(ranked, func(a, b int) bool {
+		if ranked[a].Fee != ranked[b].Fee {
+			return ranked[a].Fee < ranked[b].Fee
+		}
+		if ranked[a].DropoffETA != ranked[b].DropoffETA {
+			return ranked[a].DropoffETA < ranked[b].DropoffETA
+		}
+		return ranked[a].Provider == domain.InHouseProvider && ranked[b].Provider != domain.InHouseProvider
+	})
+
+	for i := range ranked {
+		if deadline.IsZero() || !now.Add(ranked[i].DropoffETA).After(deadline) {
+			return &ranked[i]
+		}
+	}
+
+	fastest := &ranked[0]
+	for i := range ranked {
+		if ranked[i].DropoffETA < fastest.DropoffETA {
+			fastest = &ranked[i]
+		}
+	}
+	return fastest
+}
+
+// HandleWebhook authenticates a partner status callback and applies it
+func (s *FulfillmentService) HandleWebhook(ctx context.Context, providerName string, body []byte, signature string) error {
+	p, ok := s.providers[providerName]
+	if !ok {
+		return domain.ErrUnknownProvider
+	}
+	update, err := p.ParseWebhook(body, signature)
+	if err != nil {
+		return err
+	}
+	return s.deliveries.ApplyProviderUpdate(ctx, update)
+}
+
+// Track asks the partner for the live status of an external delivery and
+// applies it, covering callbacks that never arrived
+func (s *FulfillmentService) Track(ctx context.Context, deliveryID string) (*domain.TrackingUpdate, error) {
+	d, p, err := s.external(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	update, err := p.Track(ctx, d.ExternalID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.deliveries.ApplyProviderUpdate(ctx, update); err != nil {
+		return nil, err
+	}
+	return update, nil
+}
+
+// Cancel withdraws a partner booking and fails the delivery. The partner's own
+// CANCELLED callback then finds it terminal and is ignored.
+func (s *FulfillmentService) Cancel(ctx context.Context, deliveryID, reason string) error {
+	d, p, err := s.external(ctx, deliveryID)
+	if err != nil {
+		return err
+	}
+	if d.Status.IsTerminal() {
+		return domain.ErrInvalidTransition
+	}
+	if err := p.Cancel(ctx, d.ExternalID, reason); err != nil {
+		return err
+	}
+	return s.deliveries.Abort(ctx, d, reason, false, map[string]interface{}{"cancelled_by": "platform"})
+}
+
+func (s *FulfillmentService) external(ctx context.Context, deliveryID string) (*domain.Delivery, domain.CourierProvider, error) {
+	d, err := s.deliveries.Get(ctx, deliveryID)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, ok := s.providers[d.Provider]
+	if !ok {
+		return nil, nil, domain.ErrUnknownProvider
+	}
+	return d, p, nil
+}
+
+// book confirms the partner booking and records it on the delivery; if the
+// delivery moved on meanwhile the booking is cancelled again
+func (s *FulfillmentService) book(ctx context.Context, order domain.Order, quote *domain.Quote) (*domain.Booking, error) {
+	p := s.providers[quote.Provider]
+	booking, err := p.Book(ctx, shipmentFor(order), quote.QuoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.deliveries.AssignExternal(ctx, order.DeliveryID, booking); err != nil {
+		if cerr := p.Cancel(ctx, booking.ExternalID, "delivery no longer searching"); cerr != nil {
+			s.logger.Error("Failed to cancel orphaned booking",
+				zap.String("provider", booking.Provider),
+				zap.String("external_id", booking.ExternalID),
+				zap.Error(cerr))
+		}
+		return nil, err
+	}
+
+	s.logger.Info("Delivery booked with external provider",
+		zap.String("delivery_id", order.DeliveryID),
+		zap.String("provider", booking.Provider),
+		zap.String("external_id", booking.ExternalID),
+		zap.Float64("fee", booking.Fee))
+	return booking, nil
+}
+
+// inHouseQuote estimates our own cost and ETA from the best available rider
+func (s *FulfillmentService) inHouseQuote(ctx context.Context, order domain.Order) (*domain.Quote, error) {
+	nearby, err := s.locator.FindCouriersNearby(ctx, order.PickupLat, order.PickupLon, CourierSearchRadiusMeters)
+	if err != nil {
+		return nil, err
+	}
+	if len(nearby) == 0 {
+		return nil, domain.ErrProviderUnavailable
+	}
+
+	ids := make([]string, len(nearby))
+	for i, loc := range nearby {
+		ids[i] = loc.CourierID
+	}
+	couriers, err := s.couriers.ListByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	candidate := &domain.Assignment{Batch: domain.Batch{Orders: []domain.Order{order}}}
+	ranked := RankCouriers(candidate, nearby, couriers, time.Now())
+	if len(ranked) == 0 {
+		return nil, domain.ErrProviderUnavailable
+	}
+
+	var approachKm float64
+	for _, loc := range nearby {
+		if loc.CourierID == ranked[0].ID {
+			approachKm = loc.DistanceMeters / 1000
+		}
+	}
+	tripKm := Haversine(order.PickupLat, order.PickupLon, order.DropoffLat, order.DropoffLon)
+	pickupETA := travelTime(approachKm)
+
+	return &domain.Quote{
+		Provider:   domain.InHouseProvider,
+		Fee:        InHouseBaseFare + InHousePerKm*math.Ceil(tripKm),
+		PickupETA:  pickupETA,
+		DropoffETA: pickupETA + travelTime(tripKm),
+	}, nil
+}
+
+func travelTime(km float64) time.Duration {
+	return time.Duration(km / fallbackSpeedKmh * float64(time.Hour)).Round(time.Second)
+}
+
+func shipmentFor(order domain.Order) domain.ShipmentRequest {
+	return domain.ShipmentRequest{
+		DeliveryID:        order.DeliveryID,
+		PickupLat:         order.PickupLat,
+		PickupLon:         order.PickupLon,
+		DropoffLat:        order.DropoffLat,
+		DropoffLon:        order.DropoffLon,
+		WeightKg:          order.QuantityKg,
+		RequiresColdChain: order.RequiresColdChain(),
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/provider"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/outbox"
+)
+
+func TestSelectQuote_CheapestOnTimeThenFastest(t *testing.T) {
+	now := time.Now()
+	deadline := now.Add(45 * time.Minute)
+	quotes := []domain.Quote{
+		{Provider: domain.InHouseProvider, Fee: 15000, DropoffETA: 40 * time.Minute},
+		{Provider: "grab", Fee: 12000, DropoffETA: 60 * time.Minute}, // cheaper but late
+		{Provider: "gojek", Fee: 15000, DropoffETA: 30 * time.Minute},
+	}
+
+	if got := SelectQuote(quotes, now, deadline); got.Provider != "gojek" {
+		t.Errorf("Expected gojek (same price, faster, on time), got %s", got.Provider)
+	}
+
+	quotes[2].DropoffETA = 40 * time.Minute
+	if got := SelectQuote(quotes, now, deadline); got.Provider != domain.InHouseProvider {
+		t.Errorf("Expected in-house to win an exact tie, got %s", got.Provider)
+	}
+
+	if got := SelectQuote(quotes, now, now.Add(10*time.Minute)); got.DropoffETA != 40*time.Minute {
+		t.Errorf("Expected the fastest option when nobody is on time, got %+v", got)
+	}
+	if SelectQuote(nil, now, deadline) != nil {
+		t.Error("Expected no choice without quotes")
+	}
+}
+
+func TestFulfillment_BooksPartnerAndFollowsWebhooks(t *testing.T) {
+	ctx := context.Background()
+	deliveries, deliveryRepo, _, _ := newDeliveryFixture()
+
+	var fulfillment *FulfillmentService
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := fulfillment.HandleWebhook(r.Context(), "fake", body, r.Header.Get(provider.SignatureHeader)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer receiver.Close()
+	partner := httptest.NewServer(provider.NewFakeServer(provider.FakeConfig{WebhookSecret: "s3cret"}))
+	defer partner.Close()
+
+	fake := provider.NewHTTPProvider(provider.Config{
+		Name: "fake", BaseURL: partner.URL, WebhookSecret: "s3cret", CallbackURL: receiver.URL,
+	})
+	// No in-house rider is nearby, so the partner is the only quote
+	fulfillment = NewFulfillmentService(nil, deliveries, nil, noCouriersNearby{}, []domain.CourierProvider{fake}, zap.NewNop())
+
+	d := deliveryRepo.deliveries["d1"]
+	decision, err := fulfillment.Dispatch(ctx, domain.Order{
+		DeliveryID: "d1",
+		PickupLat:  d.ProviderLat, PickupLon: d.ProviderLon,
+		DropoffLat: d.NGOLat, DropoffLon: d.NGOLon,
+		QuantityKg: d.QuantityKg, SelectedSLA: domain.SLA_STANDARD,
+		ExpiryTime: time.Now().Add(3 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if decision.Provider != "fake" || decision.Booking == nil {
+		t.Fatalf("Expected a fake partner booking, got %+v", decision)
+	}
+	if d.Status != domain.DeliveryAssigned || d.ExternalID != decision.Booking.ExternalID {
+		t.Fatalf("Expected delivery assigned to %s, got %s/%s", decision.Booking.ExternalID, d.Status, d.ExternalID)
+	}
+	if d.SLATier != domain.SLA_STANDARD {
+		t.Errorf("Expected the STANDARD tier recorded for stale-claim timing, got %q", d.SLATier)
+	}
+
+	// The partner skips straight to DELIVERED: the pickup is implied
+	for i := 0; i < 2; i++ {
+		res, err := http.Post(partner.URL+"/v1/bookings/"+d.ExternalID+"/advance", "application/json", bytes.NewReader(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("advance: status %d", res.StatusCode)
+		}
+	}
+
+	if d.Status != domain.DeliveryDelivered {
+		t.Fatalf("Expected delivered after partner callbacks, got %s", d.Status)
+	}
+	want := []outbox.EventType{outbox.DeliveryAssigned, outbox.FoodPickedUp, outbox.FoodDelivered}
+	if len(deliveryRepo.events) != len(want) {
+		t.Fatalf("Expected %d events, got %d", len(want), len(deliveryRepo.events))
+	}
+	for i, e := range want {
+		if deliveryRepo.events[i].EventType != e {
+			t.Errorf("Event %d: expected %s, got %s", i, e, deliveryRepo.events[i].EventType)
+		}
+	}
+
+	// A replayed callback is ignored
+	if err := deliveries.ApplyProviderUpdate(ctx, &domain.TrackingUpdate{
+		Provider: "fake", ExternalID: d.ExternalID, Status: domain.DeliveryPickedUp,
+	}); err != nil || len(deliveryRepo.events) != len(want) {
+		t.Errorf("Expected stale update to be a no-op, got err=%v events=%d", err, len(deliveryRepo.events))
+	}
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+const (
+	// ExactSolverMaxOrders is the largest batch solved by full enumeration
+	// (4 orders = 2520 precedence-valid sequences, well under a millisecond)
+	ExactSolverMaxOrders = 4
+
+	StopServiceTime  = 3 * time.Minute // Parking + handover at each stop
+	fallbackSpeedKmh = 20.0            // Jakarta traffic average when the router is down
+
+	// One minute past a deadline costs as much as this many minutes of driving,
+	// so the optimizer only accepts lateness when no on-time sequence exists
+	latenessWeight = 100.0
+)
+
+// TravelTimer is the routing backend (satisfied by matching.Router)
+type TravelTimer interface {
+	GetTravelTime(ctx context.Context, startLat, startLon, endLat, endLon float64) (time.Duration, error)
+}
+
+// RouteOptimizer sequences pickups and dropoffs of a batch so that every order
+// is picked up before it is dropped off and delivered before its deadline.
+type RouteOptimizer struct {
+	router TravelTimer
+}
+
+func NewRouteOptimizer(router TravelTimer) *RouteOptimizer {
+	return &RouteOptimizer{router: router}
+}
+
+// Optimize returns the batch's stops in visiting order with ETAs, starting
+// from the courier's position at departAt.
+func (o *RouteOptimizer) Optimize(ctx context.Context, batch domain.Batch, startLat, startLon float64, departAt time.Time) []domain.RoutePoint {
+	if len(batch.Orders) == 0 {
+		return nil
+	}
+
+	p := newRouteProblem(batch.Orders, departAt)
+	p.travel = o.travelMatrix(ctx, startLat, startLon, p.stops)
+
+	var seq []int
+	if len(batch.Orders) <= ExactSolverMaxOrders {
+		seq = p.solveExact()
+	} else {
+		seq = p.twoOpt(p.cheapestInsertion())
+	}
+	return p.points(seq)
+}
+
+// travelMatrix holds durations between the start (index 0) and every stop (index k+1)
+func (o *RouteOptimizer) travelMatrix(ctx context.Context, startLat, startLon float64, stops []routeStop) [][]time.Duration {
+	type point struct{ lat, lon float64 }
+	points := make([]point, 0, len(stops)+1)
+	points = append(points, point{startLat, startLon})
+	for _, s := range stops {
+		points = append(points, point{s.lat, s.lon})
+	}
+
+	matrix := make([][]time.Duration, len(points))
+	for i := range points {
+		matrix[i] = make([]time.Duration, len(points))
+		for j := range points {
+			if i == j {
+				continue
+			}
+			d, err := o.router.GetTravelTime(ctx, points[i].lat, points[i].lon, points[j].lat, points[j].lon)
+			if err != nil {
+				// Graceful degradation: straight-line estimate instead of failing the whole route
+				km := Haversine(points[i].lat, points[i].lon, points[j].lat, points[j].lon)
+				d = time.Duration(km / fallbackSpeedKmh * float64(time.Hour))
+			}
+			matrix[i][j] = d
+		}
+	}
+	return matrix
+}
+
+// routeStop k belongs to order k/2; even k is its pickup, odd k its dropoff
+type routeStop struct {
+	order  int
+	pickup bool
+	lat    float64
+	lon    float64
+}
+
+type routeProblem struct {
+	orders   []domain.Order
+	stops    []routeStop
+	travel   [][]time.Duration
+	departAt time.Time
+}
+
+func newRouteProblem(orders []domain.Order, departAt time.Time) *routeProblem {
+	stops := make([]routeStop, 0, 2*len(orders))
+	for i, o := range orders {
+		stops = append(stops,
+			routeStop{order: i, pickup: true, lat: o.PickupLat, lon: o.PickupLon},
+			routeStop{order: i, pickup: false, lat: o.DropoffLat, lon: o.DropoffLon},
+		)
+	}
+	return &routeProblem{orders: orders, stops: stops, departAt: departAt}
+}
+
+// walk visits seq and reports the arrival time at each stop
+func (p *routeProblem) walk(seq []int, visit func(stop int, arrival time.Time)) time.Time {
+	t := p.departAt
+	prev := 0
+	for _, k := range seq {
+		t = t.Add(p.travel[prev][k+1])
+		visit(k, t)
+		t = t.Add(StopServiceTime)
+		prev = k + 1
+	}
+	return t
+}
+
+// cost is total route minutes plus weighted minutes of lateness.
+// Pickups are late past food expiry; dropoffs past the order deadline.
+func (p *routeProblem) cost(seq []int) float64 {
+	var late time.Duration
+	end := p.walk(seq, func(k int, arrival time.Time) {
+		o := &p.orders[p.stops[k].order]
+		deadline := o.Deadline()
+		if p.stops[k].pickup {
+			deadline = o.ExpiryTime
+		}
+		if !deadline.IsZero() && arrival.After(deadline) {
+			late += arrival.Sub(deadline)
+		}
+	})
+	return end.Sub(p.departAt).Minutes() + latenessWeight*late.Minutes()
+}
+
+// valid checks the pickup-before-dropoff precedence for every order
+func (p *routeProblem) valid(seq []int) bool {
+	pickedUp := make([]bool, len(p.orders))
+	for _, k := range seq {
+		if p.stops[k].pickup {
+			pickedUp[p.stops[k].order] = true
+		} else if !pickedUp[p.stops[k].order] {
+			return false
+		}
+	}
+	return true
+}
+
+// solveExact enumerates every precedence-valid sequence
+func (p *routeProblem) solveExact() []int {
+	m := len(p.stops)
+	best := math.Inf(1)
+	var bestSeq []int
+
+	seq := make([]int, 0, m)
+	used := make([]bool, m)
+	var dfs func()
+	dfs = func() {
+		if len(seq) == m {
+			if c := p.cost(seq); c < best {
+				best = c
+				bestSeq = append(bestSeq[:0], seq...)
+			}
+			return
+		}
+		for k := 0; k < m; k++ {
+			// A dropoff (odd k) is only reachable once its pickup (k-1) is on the route
+			if used[k] || (k%2 == 1 && !used[k-1]) {
+				continue
+			}
+			used[k] = true
+			seq = append(seq, k)
+			dfs()
+			seq = seq[:len(seq)-1]
+			used[k] = false
+		}
+	}
+	dfs()
+	return bestSeq
+}
+
+// cheapestInsertion adds orders tightest-deadline first, placing each
+// pickup/dropoff pair at the positions that raise the cost the least
+func (p *routeProblem) cheapestInsertion() []int {
+	idx := make([]int, len(p.orders))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		return p.orders[idx[a]].Deadline().Before(p.orders[idx[b]].Deadline())
+	})
+
+	var seq []int
+	for _, i := range idx {
+		best := math.Inf(1)
+		var bestSeq []int
+		for a := 0; a <= len(seq); a++ {
+			for b := a; b <= len(seq); b++ {
+				cand := make([]int, 0, len(seq)+2)
+				cand = append(cand, seq[:a]...)
+				cand = append(cand, 2*i)
+				cand = append(cand, seq[a:b]...)
+				cand = append(cand, 2*i+1)
+				cand = append(cand, seq[b:]...)
+				if c := p.cost(cand); c < best {
+					best = c
+					bestSeq = cand
+				}
+			}
+		}
+		seq = bestSeq
+	}
+	return seq
+}
+
+// twoOpt reverses segments while that lowers the cost without breaking precedence
+func (p *routeProblem) twoOpt(seq []int) []int {
+	best := p.cost(seq)
+	for improved := true; improved; {
+		improved = false
+		for i := 0; i < len(seq)-1; i++ {
+			for j := i + 1; j < len(seq); j++ {
+				cand := append([]int(nil), seq...)
+				for l, r := i, j; l < r; l, r = l+1, r-1 {
+					cand[l], cand[r] = cand[r], cand[l]
+				}
+				if !p.valid(cand) {
+					continue
+				}
+				if c := p.cost(cand); c < best {
+					best = c
+					seq = cand
+					improved = true
+				}
+			}
+		}
+	}
+	return seq
+}
+
+func (p *routeProblem) points(seq []int) []domain.RoutePoint {
+	route := make([]domain.RoutePoint, 0, len(seq))
+	p.walk(seq, func(k int, arrival time.Time) {
+		s := p.stops[k]
+		stopType := domain.StopDropoff
+		if s.pickup {
+			stopType = domain.StopPickup
+		}
+		route = append(route, domain.RoutePoint{
+			OrderID: p.orders[s.order].ID,
+			Type:    stopType,
+			Lat:     s.lat,
+			Lon:     s.lon,
+			ETA:     arrival,
+		})
+	})
+	return route
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+// haversineRouter drives at a constant 30 km/h
+type haversineRouter struct{}
+
+func (r *haversineRouter) GetTravelTime(ctx context.Context, startLat, startLon, endLat, endLon float64) (time.Duration, error) {
+	km := Haversine(startLat, startLon, endLat, endLon)
+	return time.Duration(km / 30.0 * float64(time.Hour)), nil
+}
+
+func assertPrecedence(t *testing.T, orders []domain.Order, route []domain.RoutePoint) {
+	t.Helper()
+	if len(route) != 2*len(orders) {
+		t.Fatalf("Expected %d stops, got %d", 2*len(orders), len(route))
+	}
+	picked := map[string]bool{}
+	for i, p := range route {
+		switch p.Type {
+		case domain.StopPickup:
+			picked[p.OrderID] = true
+		case domain.StopDropoff:
+			if !picked[p.OrderID] {
+				t.Fatalf("Order %s dropped off before pickup", p.OrderID)
+			}
+		}
+		if i > 0 && p.ETA.Before(route[i-1].ETA) {
+			t.Fatalf("ETAs must be non-decreasing at stop %d", i)
+		}
+	}
+}
+
+func TestRouteOptimizer_ExactSolverRespectsPrecedenceAndDeadlines(t *testing.T) {
+	now := time.Now()
+	// Order "urgent" expires soon, so its dropoff must come first even though it is further away
+	orders := []domain.Order{
+		{ID: "relaxed", PickupLat: -6.200, PickupLon: 106.800, DropoffLat: -6.210, DropoffLon: 106.810, CreatedAt: now, CurrentSLA: domain.SLA_HEMAT, ExpiryTime: now.Add(4 * time.Hour)},
+		{ID: "urgent", PickupLat: -6.201, PickupLon: 106.801, DropoffLat: -6.240, DropoffLon: 106.840, CreatedAt: now, CurrentSLA: domain.SLA_HEMAT, ExpiryTime: now.Add(20 * time.Minute)},
+	}
+
+	route := NewRouteOptimizer(&haversineRouter{}).Optimize(context.Background(), domain.Batch{Orders: orders}, -6.199, 106.799, now)
+	assertPrecedence(t, orders, route)
+
+	for _, p := range route {
+		if p.Type == domain.StopDropoff {
+			if p.OrderID != "urgent" {
+				t.Errorf("Expected urgent order to be dropped off first, got %s", p.OrderID)
+			}
+			break
+		}
+	}
+}
+
+func TestRouteOptimizer_HeuristicForLargeBatches(t *testing.T) {
+	now := time.Now()
+	var orders []domain.Order
+	for i := 0; i < 7; i++ {
+		d := float64(i) * 0.005
+		orders = append(orders, domain.Order{
+			ID:        string(rune('a' + i)),
+			PickupLat: -6.2 + d, PickupLon: 106.8 - d,
+			DropoffLat: -6.22 - d, DropoffLon: 106.82 + d,
+			CreatedAt: now, CurrentSLA: domain.SLA_HEMAT, ExpiryTime: now.Add(3 * time.Hour),
+		})
+	}
+
+	route := NewRouteOptimizer(&haversineRouter{}).Optimize(context.Background(), domain.Batch{Orders: orders}, -6.2, 106.8, now)
+	assertPrecedence(t, orders, route)
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+const (
+	SLAMonitorInterval = 30 * time.Second
+	slaScanLimit       = 200
+)
+
+var (
+	slaEscalations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "logistics_sla_escalations_total",
+		Help: "Orders upgraded to CRITICAL because expiry got close, by pickup region and original SLA tier.",
+	}, []string{"region", "sla_tier"})
+
+	slaBreaches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "logistics_sla_breaches_total",
+		Help: "Orders still undelivered past their promised deadline, by pickup region and SLA tier.",
+	}, []string{"region", "sla_tier"})
+)
+
+// SLAMonitor keeps re-evaluating queued and in-flight orders. Urgency is only
+// computed once at CreateOrder, so without it an order that sits in a HEMAT
+// batch can run out of shelf life without anyone noticing.
+type SLAMonitor struct {
+	dispatch    *DispatchService
+	assignments domain.AssignmentRepository
+	deliveries  *DeliveryService
+	events      domain.SLARepository
+	logger      *zap.Logger
+}
+
+func NewSLAMonitor(dispatch *DispatchService, assignments domain.AssignmentRepository, deliveries *DeliveryService, events domain.SLARepository, logger *zap.Logger) *SLAMonitor {
+	return &SLAMonitor{
+		dispatch:    dispatch,
+		assignments: assignments,
+		deliveries:  deliveries,
+		events:      events,
+		logger:      logger,
+	}
+}
+
+// RunSLAMonitor escalates orders entering the critical window and flags late deliveries
+func (m *SLAMonitor) RunSLAMonitor(ctx context.Context) {
+	ticker := time.NewTicker(SLAMonitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := m.Scan(ctx, now); err != nil {
+				m.logger.Error("SLA scan failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Scan runs one pass over the dispatch queue and every batch not yet completed
+func (m *SLAMonitor) Scan(ctx context.Context, now time.Time) error {
+	if err := m.scanQueue(ctx, now); err != nil {
+		return err
+	}
+
+	active, err := m.assignments.ListActive(ctx, slaScanLimit)
+	if err != nil {
+		return err
+	}
+	for i := range active {
+		a := &active[i]
+		if a.Status == domain.AssignmentSearching && len(a.Batch.Orders) > 1 {
+			m.splitCritical(ctx, a, now)
+		}
+		for _, o := range a.Batch.Orders {
+			m.checkLate(ctx, o, a.BatchID, now)
+		}
+	}
+	return nil
+}
+
+// Report aggregates escalations and late deliveries per region and tier
+func (m *SLAMonitor) Report(ctx context.Context, from, to time.Time) ([]domain.SLAReportRow, error) {
+	return m.events.Report(ctx, from, to)
+}
+
+// scanQueue pulls orders that turned critical while waiting for companions and dispatches them alone
+func (m *SLAMonitor) scanQueue(ctx context.Context, now time.Time) error {
+	pending, err := m.dispatch.queue.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	tiers := make(map[string]domain.DeliverySLA)
+	var ids []string
+	for i := range pending {
+		o := &pending[i]
+		m.checkLate(ctx, *o, "", now)
+		if o.NeedsEscalation(now) {
+			tiers[o.ID] = o.CurrentSLA
+			ids = append(ids, o.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// Take is atomic, so a batch processor on another replica cannot grab them as well
+	taken, err := m.dispatch.queue.Take(ctx, ids...)
+	if err != nil {
+		return err
+	}
+	for i := range taken {
+		o := &taken[i]
+		m.record(ctx, *o, "batch-"+o.ID, domain.SLAEscalated, tiers[o.ID], now)
+		o.CurrentSLA = domain.SLA_CRITICAL
+	}
+	m.dispatch.dispatchSingles(ctx, taken)
+	return nil
+}
+
+// splitCritical takes critical orders out of a batch nobody has been offered yet
+// and submits each one as its own CRITICAL batch. The rest stay together.
+func (m *SLAMonitor) splitCritical(ctx context.Context, a *domain.Assignment, now time.Time) {
+	var keep, urgent []domain.Order
+	for _, o := range a.Batch.Orders {
+		if o.NeedsEscalation(now) {
+			urgent = append(urgent, o)
+		} else {
+			keep = append(keep, o)
+		}
+	}
+	if len(urgent) == 0 {
+		return
+	}
+	if len(keep) == 0 {
+		// Everything is critical: the original batch carries the first order
+		keep, urgent = urgent[:1], urgent[1:]
+	}
+	for i := range keep {
+		if keep[i].NeedsEscalation(now) {
+			m.record(ctx, keep[i], a.BatchID, domain.SLAEscalated, keep[i].CurrentSLA, now)
+			keep[i].CurrentSLA = domain.SLA_CRITICAL
+		}
+	}
+
+	batch := a.Batch
+	batch.Orders = keep
+	batch.Route = nil // Re-planned on acceptance
+	if err := m.assignments.UpdateSearchingBatch(ctx, a.BatchID, batch, a.UpdatedAt); err != nil {
+		if !errors.Is(err, domain.ErrOfferNotFound) {
+			m.logger.Error("Failed to split critical orders out of batch", zap.String("batch_id", a.BatchID), zap.Error(err))
+		}
+		// Offered or changed since we read it; the next pass sees the new state
+		return
+	}
+
+	for i := range urgent {
+		o := &urgent[i]
+		m.record(ctx, *o, a.BatchID, domain.SLAEscalated, o.CurrentSLA, now)
+		o.CurrentSLA = domain.SLA_CRITICAL
+		m.logger.Warn("Order escalated out of batch",
+			zap.String("order_id", o.ID),
+			zap.String("from_batch", a.BatchID),
+			zap.Time("expiry", o.ExpiryTime))
+	}
+	m.dispatch.dispatchSingles(ctx, urgent)
+}
+
+// checkLate flags an order still on its way after the promised deadline
+func (m *SLAMonitor) checkLate(ctx context.Context, o domain.Order, batchID string, now time.Time) {
+	if !now.After(o.Deadline()) {
+		return
+	}
+	if o.DeliveryID != "" {
+		d, err := m.deliveries.Get(ctx, o.DeliveryID)
+		if err != nil {
+			m.logger.Warn("Failed to load delivery for SLA check", zap.String("delivery_id", o.DeliveryID), zap.Error(err))
+			return
+		}
+		if d.Status.IsTerminal() {
+			return
+		}
+	}
+	m.record(ctx, o, batchID, domain.SLALateDelivery, o.CurrentSLA, now)
+}
+
+// record stores the event once per order and kind; only the first sighting
+// across all replicas bumps the Prometheus counter
+func (m *SLAMonitor) record(ctx context.Context, o domain.Order, batchID string, kind domain.SLAEventKind, tier domain.DeliverySLA, now time.Time) {
+	event := domain.SLAEvent{
+		OrderID:    o.ID,
+		BatchID:    batchID,
+		Kind:       kind,
+		Region:     o.Region(),
+		Tier:       tier,
+		Deadline:   o.Deadline(),
+		DetectedAt: now,
+	}
+	created, err := m.events.Record(ctx, event)
+	if err != nil {
+		m.logger.Error("Failed to record SLA event", zap.String("order_id", o.ID), zap.String("kind", string(kind)), zap.Error(err))
+		return
+	}
+	if !created {
+		return
+	}
+
+	switch kind {
+	case domain.SLAEscalated:
+		slaEscalations.WithLabelValues(event.Region, string(tier)).Inc()
+	case domain.SLALateDelivery:
+		slaBreaches.WithLabelValues(event.Region, string(tier)).Inc()
+		m.logger.Warn("SLA breached",
+			zap.String("order_id", o.ID),
+			zap.String("region", event.Region),
+			zap.String("sla_tier", string(tier)),
+			zap.Time("deadline", event.Deadline))
+	}
+}
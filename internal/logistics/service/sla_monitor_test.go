@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/geo"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+type fakeOrderQueue struct {
+	orders map[string]domain.Order
+}
+
+func (q *fakeOrderQueue) Enqueue(ctx context.Context, order domain.Order, dispatchBy time.Time) error {
+	q.orders[order.ID] = order
+	return nil
+}
+
+func (q *fakeOrderQueue) Pending(ctx context.Context) ([]domain.Order, error) {
+	var out []domain.Order
+	for _, o := range q.orders {
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+func (q *fakeOrderQueue) Take(ctx context.Context, ids ...string) ([]domain.Order, error) {
+	var out []domain.Order
+	for _, id := range ids {
+		if o, ok := q.orders[id]; ok {
+			out = append(out, o)
+			delete(q.orders, id)
+		}
+	}
+	return out, nil
+}
+
+func (q *fakeOrderQueue) TakeDue(ctx context.Context, now time.Time, limit int) ([]domain.Order, error) {
+	return nil, nil
+}
+
+func (q *fakeOrderQueue) Ack(ctx context.Context, ids ...string) error {
+	return nil
+}
+
+func (q *fakeOrderQueue) RequeueExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	return 0, nil
+}
+
+type fakeSLAAssignmentRepo struct {
+	domain.AssignmentRepository
+	batches map[string]*domain.Assignment
+}
+
+func (r *fakeSLAAssignmentRepo) Create(ctx context.Context, a *domain.Assignment) error {
+	r.batches[a.BatchID] = a
+	return nil
+}
+
+func (r *fakeSLAAssignmentRepo) ListActive(ctx context.Context, limit int) ([]domain.Assignment, error) {
+	var out []domain.Assignment
+	for _, a := range r.batches {
+		out = append(out, *a)
+	}
+	return out, nil
+}
+
+func (r *fakeSLAAssignmentRepo) UpdateSearchingBatch(ctx context.Context, batchID string, batch domain.Batch, seenAt time.Time) error {
+	a, ok := r.batches[batchID]
+	if !ok || a.Status != domain.AssignmentSearching || !a.UpdatedAt.Equal(seenAt) {
+		return domain.ErrOfferNotFound
+	}
+	a.Batch = batch
+	a.UpdatedAt = a.UpdatedAt.Add(time.Second)
+	return nil
+}
+
+type fakeSLARepo struct {
+	events map[string]domain.SLAEvent
+}
+
+func (r *fakeSLARepo) Record(ctx context.Context, e domain.SLAEvent) (bool, error) {
+	key := e.OrderID + "/" + string(e.Kind)
+	if _, ok := r.events[key]; ok {
+		return false, nil
+	}
+	r.events[key] = e
+	return true, nil
+}
+
+func (r *fakeSLARepo) Report(ctx context.Context, from, to time.Time) ([]domain.SLAReportRow, error) {
+	return nil, nil
+}
+
+type noCouriersNearby struct{ CourierLocator }
+
+func (noCouriersNearby) FindCouriersNearby(ctx context.Context, lat, lon, radiusMeters float64) ([]geo.CourierLocation, error) {
+	return nil, nil
+}
+
+func newSLAFixture() (*SLAMonitor, *fakeOrderQueue, *fakeSLAAssignmentRepo, *fakeSLARepo) {
+	queue := &fakeOrderQueue{orders: map[string]domain.Order{}}
+	assignments := &fakeSLAAssignmentRepo{batches: map[string]*domain.Assignment{}}
+	events := &fakeSLARepo{events: map[string]domain.SLAEvent{}}
+	deliveries, _, _, _ := newDeliveryFixture()
+	assigner := NewAssignmentService(nil, assignments, noCouriersNearby{}, nil, deliveries, nil, zap.NewNop())
+	dispatch := NewDispatchService(NewBatchingEngine(), queue, assigner, zap.NewNop())
+	return NewSLAMonitor(dispatch, assignments, deliveries, events, zap.NewNop()), queue, assignments, events
+}
+
+func TestSLAMonitor_SplitsCriticalOrdersOutOfSearchingBatch(t *testing.T) {
+	ctx := context.Background()
+	m, _, assignments, events := newSLAFixture()
+	now := time.Now()
+
+	hemat := func(id string, expiry time.Duration) domain.Order {
+		return domain.Order{
+			ID: id, PickupLat: -6.2, PickupLon: 106.8, QuantityKg: 2,
+			SelectedSLA: domain.SLA_HEMAT, CurrentSLA: domain.SLA_HEMAT,
+			CreatedAt: now.Add(-10 * time.Minute), ExpiryTime: now.Add(expiry),
+		}
+	}
+	assignments.batches["b1"] = &domain.Assignment{
+		BatchID:   "b1",
+		Status:    domain.AssignmentSearching,
+		UpdatedAt: now.Add(-time.Minute),
+		Batch: domain.Batch{ID: "b1", Orders: []domain.Order{
+			hemat("fresh", 3*time.Hour),
+			hemat("wilting", 10*time.Minute),
+			hemat("also-fresh", 2*time.Hour),
+		}},
+	}
+	region := assignments.batches["b1"].Batch.Orders[0].Region()
+	before := testutil.ToFloat64(slaEscalations.WithLabelValues(region, string(domain.SLA_HEMAT)))
+
+	if err := m.Scan(ctx, now); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	kept := assignments.batches["b1"].Batch.Orders
+	if len(kept) != 2 || kept[0].ID != "fresh" || kept[1].ID != "also-fresh" {
+		t.Errorf("Expected the fresh orders to stay batched, got %+v", kept)
+	}
+	single, ok := assignments.batches["batch-wilting"]
+	if !ok {
+		t.Fatal("Expected the wilting order to be dispatched on its own")
+	}
+	if o := single.Batch.Orders[0]; len(single.Batch.Orders) != 1 || o.CurrentSLA != domain.SLA_CRITICAL {
+		t.Errorf("Expected one CRITICAL order in the direct batch, got %+v", single.Batch.Orders)
+	}
+
+	e, ok := events.events["wilting/"+string(domain.SLAEscalated)]
+	if !ok || e.Tier != domain.SLA_HEMAT || e.BatchID != "b1" {
+		t.Errorf("Expected an escalation from HEMAT in b1, got %+v", e)
+	}
+	after := testutil.ToFloat64(slaEscalations.WithLabelValues(region, string(domain.SLA_HEMAT)))
+	if after-before != 1 {
+		t.Errorf("Expected the escalation counter to move by 1, moved by %v", after-before)
+	}
+}
+
+func TestSLAMonitor_EscalatesQueuedOrders(t *testing.T) {
+	ctx := context.Background()
+	m, queue, assignments, _ := newSLAFixture()
+	now := time.Now()
+
+	queue.orders["waiting"] = domain.Order{
+		ID: "waiting", PickupLat: -6.2, PickupLon: 106.8, QuantityKg: 1,
+		SelectedSLA: domain.SLA_STANDARD, CurrentSLA: domain.SLA_STANDARD,
+		CreatedAt: now, ExpiryTime: now.Add(12 * time.Minute),
+	}
+
+	if err := m.Scan(ctx, now); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if _, still := queue.orders["waiting"]; still {
+		t.Error("Expected the order to leave the batching queue")
+	}
+	a, ok := assignments.batches["batch-waiting"]
+	if !ok || a.Batch.Orders[0].CurrentSLA != domain.SLA_CRITICAL {
+		t.Errorf("Expected a CRITICAL direct batch, got %+v", a)
+	}
+}
+
+func TestSLAMonitor_FlagsLateDeliveryOnce(t *testing.T) {
+	ctx := context.Background()
+	m, _, assignments, events := newSLAFixture()
+	now := time.Now()
+
+	late := domain.Order{
+		ID: "late", PickupLat: -6.2, PickupLon: 106.8, QuantityKg: 1,
+		SelectedSLA: domain.SLA_EXPRESS, CurrentSLA: domain.SLA_CRITICAL,
+		CreatedAt: now.Add(-time.Hour), ExpiryTime: now.Add(time.Hour),
+	}
+	done := late
+	done.ID, done.DeliveryID = "done", "d1"
+	assignments.batches["b1"] = &domain.Assignment{
+		BatchID: "b1", Status: domain.AssignmentAccepted,
+		Batch: domain.Batch{ID: "b1", Orders: []domain.Order{late}},
+	}
+	assignments.batches["b2"] = &domain.Assignment{
+		BatchID: "b2", Status: domain.AssignmentAccepted,
+		Batch: domain.Batch{ID: "b2", Orders: []domain.Order{done}},
+	}
+	m.deliveries.deliveries.(*fakeDeliveryRepo).deliveries["d1"].Status = domain.DeliveryDelivered
+
+	before := testutil.ToFloat64(slaBreaches.WithLabelValues(late.Region(), string(domain.SLA_CRITICAL)))
+	for i := 0; i < 3; i++ {
+		if err := m.Scan(ctx, now.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+	}
+
+	if _, ok := events.events["late/"+string(domain.SLALateDelivery)]; !ok {
+		t.Error("Expected the undelivered order to be flagged late")
+	}
+	if _, ok := events.events["done/"+string(domain.SLALateDelivery)]; ok {
+		t.Error("Delivered order must not be flagged late")
+	}
+	after := testutil.ToFloat64(slaBreaches.WithLabelValues(late.Region(), string(domain.SLA_CRITICAL)))
+	if after-before != 1 {
+		t.Errorf("Expected one breach across repeated scans, got %v", after-before)
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+
+	coreDomain "github.com/albnnaardy11/pahlawan-pangan/internal/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+)
+
+var ErrDeliveryNotInTransit = errors.New("telemetry is only accepted for assigned or picked up deliveries")
+
+// TelemetryEvidencePath is where the stored sensor trace is served; disputes link to it
+const TelemetryEvidencePath = "/api/v1/logistics/deliveries/%s/telemetry"
+
+// Notifier pushes alerts to provider and NGO devices (satisfied by notifications.NotificationService)
+type Notifier interface {
+	NotifyBatch(ctx context.Context, userIDs []string, title, message string) error
+}
+
+// DisputeOpener files a dispute on behalf of the platform (satisfied by domain.DisputeUsecase)
+type DisputeOpener interface {
+	RaiseDispute(ctx context.Context, dispute *coreDomain.Dispute) error
+}
+
+// TelemetryService ingests thermal-bag readings and condemns the load on a sustained excursion
+type TelemetryService struct {
+	telemetry  domain.TelemetryRepository
+	deliveries *DeliveryService
+	notifier   Notifier
+	disputes   DisputeOpener
+	logger     *zap.Logger
+}
+
+func NewTelemetryService(telemetry domain.TelemetryRepository, deliveries *DeliveryService, notifier Notifier, disputes DisputeOpener, logger *zap.Logger) *TelemetryService {
+	return &TelemetryService{
+		telemetry:  telemetry,
+		deliveries: deliveries,
+		notifier:   notifier,
+		disputes:   disputes,
+		logger:     logger,
+	}
+}
+
+// Ingest stores readings for a delivery and checks the full trace against the
+// category limits. It returns the excursion if this batch tipped the food over.
+func (s *TelemetryService) Ingest(ctx context.Context, deliveryID string, readings []domain.TemperatureReading) (*domain.Excursion, error) {
+	d, err := s.deliveries.Get(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status != domain.DeliveryAssigned && d.Status != domain.DeliveryPickedUp {
+		return nil, ErrDeliveryNotInTransit
+	}
+
+	for i := range readings {
+		readings[i].DeliveryID = deliveryID
+	}
+	if err := s.telemetry.Append(ctx, readings); err != nil {
+		return nil, err
+	}
+
+	limits, monitored := domain.TempLimitsFor(d.TempCategory)
+	if !monitored {
+		return nil, nil
+	}
+
+	// Evaluate the whole trace: an excursion can span several uploads
+	trace, err := s.telemetry.ListByDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	excursion := domain.DetectExcursion(limits, trace)
+	if excursion == nil {
+		return nil, nil
+	}
+
+	if err := s.handleExcursion(ctx, d, limits, excursion); err != nil {
+		return excursion, err
+	}
+	return excursion, nil
+}
+
+// Trace returns the stored readings of a delivery in time order
+func (s *TelemetryService) Trace(ctx context.Context, deliveryID string) ([]domain.TemperatureReading, error) {
+	return s.telemetry.ListByDelivery(ctx, deliveryID)
+}
+
+func (s *TelemetryService) handleExcursion(ctx context.Context, d *domain.Delivery, limits domain.TempLimits, e *domain.Excursion) error {
+	reason := fmt.Sprintf("cold-chain excursion: %s load at %.1f°C for %s (safe %s)",
+		d.TempCategory, e.PeakC, e.Duration().Round(time.Second), formatBand(limits))
+	evidence := fmt.Sprintf(TelemetryEvidencePath, d.ID)
+
+	// 1. Open a dispute with the sensor trace as evidence. It goes first so a
+	// failure leaves the delivery in transit: the next upload sees the same
+	// excursion and retries both steps. The escrow freeze is idempotent and an
+	// already open dispute means an earlier attempt got this far.
+	raisedBy := d.NGOID
+	if raisedBy == "" {
+		raisedBy = coreDomain.PlatformActor // B2C: the provider cannot dispute its own listing
+	}
+	dispute := &coreDomain.Dispute{
+		ClaimID:  d.SurplusID,
+		UserID:   raisedBy,
+		Reason:   reason,
+		Evidence: evidence,
+	}
+	if err := s.disputes.RaiseDispute(ctx, dispute); err != nil && !errors.Is(err, coreDomain.ErrDisputeAlreadyOpen) {
+		return fmt.Errorf("open cold-chain dispute for %s: %w", d.ID, err)
+	}
+
+	// 2. Stop the delivery. A concurrent upload may have done it already; then
+	// the provider and NGO have been told by that call.
+	err := s.deliveries.Abort(ctx, d, reason, true, map[string]interface{}{
+		"excursion":    e,
+		"evidence_url": evidence,
+	})
+	if errors.Is(err, domain.ErrInvalidTransition) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.logger.Warn("Cold-chain excursion, delivery stopped",
+		zap.String("delivery_id", d.ID),
+		zap.String("category", d.TempCategory),
+		zap.Float64("peak_c", e.PeakC),
+		zap.Duration("duration", e.Duration()))
+
+	// 3. Tell both ends the food is not coming
+	recipients := []string{d.ProviderID}
+	if d.NGOID != "" {
+		recipients = append(recipients, d.NGOID)
+	}
+	if err := s.notifier.NotifyBatch(ctx, recipients, "Food safety alert ⚠️", reason); err != nil {
+		s.logger.Error("Failed to notify cold-chain breach", zap.String("delivery_id", d.ID), zap.Error(err))
+	}
+	return nil
+}
+
+func formatBand(l domain.TempLimits) string {
+	switch {
+	case math.IsInf(l.MinC, -1):
+		return fmt.Sprintf("≤ %.0f°C", l.MaxC)
+	case math.IsInf(l.MaxC, 1):
+		return fmt.Sprintf("≥ %.0f°C", l.MinC)
+	default:
+		return fmt.Sprintf("%.0f–%.0f°C", l.MinC, l.MaxC)
+	}
+}
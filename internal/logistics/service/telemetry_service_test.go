@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	coreDomain "github.com/albnnaardy11/pahlawan-pangan/internal/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/outbox"
+)
+
+type fakeTelemetryRepo struct {
+	readings []domain.TemperatureReading
+}
+
+func (r *fakeTelemetryRepo) Append(ctx context.Context, readings []domain.TemperatureReading) error {
+	r.readings = append(r.readings, readings...)
+	return nil
+}
+
+func (r *fakeTelemetryRepo) ListByDelivery(ctx context.Context, deliveryID string) ([]domain.TemperatureReading, error) {
+	var trace []domain.TemperatureReading
+	for _, rd := range r.readings {
+		if rd.DeliveryID == deliveryID {
+			trace = append(trace, rd)
+		}
+	}
+	return trace, nil
+}
+
+type fakeNotifier struct {
+	recipients []string
+	messages   []string
+}
+
+func (n *fakeNotifier) NotifyBatch(ctx context.Context, userIDs []string, title, message string) error {
+	n.recipients = append(n.recipients, userIDs...)
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+type fakeDisputes struct {
+	raised []coreDomain.Dispute
+	fail   error // Returned instead of opening while set
+}
+
+func (d *fakeDisputes) RaiseDispute(ctx context.Context, dispute *coreDomain.Dispute) error {
+	if d.fail != nil {
+		return d.fail
+	}
+	for _, open := range d.raised {
+		if open.ClaimID == dispute.ClaimID {
+			return coreDomain.ErrDisputeAlreadyOpen
+		}
+	}
+	d.raised = append(d.raised, *dispute)
+	return nil
+}
+
+// samples builds one reading per minute starting at start
+func samples(start time.Time, temps ...float64) []domain.TemperatureReading {
+	readings := make([]domain.TemperatureReading, len(temps))
+	for i, t := range temps {
+		readings[i] = domain.TemperatureReading{SensorID: "bag-1", TempC: t, RecordedAt: start.Add(time.Duration(i) * time.Minute)}
+	}
+	return readings
+}
+
+func TestDetectExcursion_BriefSpikeTolerated(t *testing.T) {
+	limits, _ := domain.TempLimitsFor("chilled")
+	start := time.Now()
+
+	// Bag opened at a stop: 4 minutes warm, then back in range
+	trace := samples(start, 3, 4, 7, 8, 7, 6, 4, 3, 3, 3, 3, 3, 3, 3)
+	if e := domain.DetectExcursion(limits, trace); e != nil {
+		t.Errorf("Expected no excursion for a short spike, got %+v", e)
+	}
+}
+
+func TestDetectExcursion_SustainedBreach(t *testing.T) {
+	start := time.Now()
+
+	cases := []struct {
+		category string
+		temps    []float64
+		peak     float64
+	}{
+		{"chilled", []float64{4, 6, 7, 9, 8, 8, 8, 8, 8, 8, 8, 8, 8}, 9},
+		{"frozen", []float64{-18, -14, -12, -10, -10, -10, -10, -10, -10, -10, -10, -10, -10}, -10},
+		{"hot", []float64{65, 58, 55, 52, 50, 50, 50, 50}, 50},
+	}
+	for _, tc := range cases {
+		limits, ok := domain.TempLimitsFor(tc.category)
+		if !ok {
+			t.Fatalf("No limits for %s", tc.category)
+		}
+		// Readings may arrive out of order from several uploads
+		trace := samples(start, tc.temps...)
+		for i, j := 0, len(trace)-1; i < j; i, j = i+1, j-1 {
+			trace[i], trace[j] = trace[j], trace[i]
+		}
+
+		e := domain.DetectExcursion(limits, trace)
+		if e == nil {
+			t.Errorf("%s: expected an excursion", tc.category)
+			continue
+		}
+		if e.Duration() <= limits.Grace {
+			t.Errorf("%s: excursion of %s should exceed grace %s", tc.category, e.Duration(), limits.Grace)
+		}
+		if e.PeakC != tc.peak {
+			t.Errorf("%s: expected peak %.1f, got %.1f", tc.category, tc.peak, e.PeakC)
+		}
+	}
+}
+
+func TestIngest_ExcursionStopsDeliveryAndOpensDispute(t *testing.T) {
+	ctx := context.Background()
+	deliveries, deliveryRepo, couriers, _ := newDeliveryFixture()
+	deliveryRepo.deliveries["d1"].TempCategory = "chilled"
+	if err := deliveries.Assign(ctx, "d1", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := deliveries.ConfirmPickup(ctx, "d1", "c1", -6.1950, 106.8300); err != nil {
+		t.Fatal(err)
+	}
+
+	telemetry := &fakeTelemetryRepo{}
+	notifier := &fakeNotifier{}
+	disputes := &fakeDisputes{}
+	svc := NewTelemetryService(telemetry, deliveries, notifier, disputes, zap.NewNop())
+
+	start := time.Now().Add(-20 * time.Minute)
+	// First upload is fine
+	if e, err := svc.Ingest(ctx, "d1", samples(start, 3, 3, 4, 4)); err != nil || e != nil {
+		t.Fatalf("Expected a clean first upload, got excursion=%v err=%v", e, err)
+	}
+	// Second upload: the bag warms up and stays warm past the grace period
+	excursion, err := svc.Ingest(ctx, "d1", samples(start.Add(4*time.Minute), 7, 8, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9))
+	if err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if excursion == nil {
+		t.Fatal("Expected an excursion")
+	}
+
+	d := deliveryRepo.deliveries["d1"]
+	if d.Status != domain.DeliveryFailed || !d.FoodUnsafe {
+		t.Errorf("Expected failed and unsafe delivery, got status=%s unsafe=%v", d.Status, d.FoodUnsafe)
+	}
+	if last := deliveryRepo.events[len(deliveryRepo.events)-1]; last.EventType != outbox.DeliveryFailed {
+		t.Errorf("Expected a %s event, got %s", outbox.DeliveryFailed, last.EventType)
+	}
+	if couriers.couriers["c1"].Status != domain.CourierOnline {
+		t.Errorf("Expected courier released, got %s", couriers.couriers["c1"].Status)
+	}
+	if len(notifier.recipients) != 2 || notifier.recipients[0] != "p1" || notifier.recipients[1] != "n1" {
+		t.Errorf("Expected provider and NGO notified, got %v", notifier.recipients)
+	}
+	if len(disputes.raised) != 1 {
+		t.Fatalf("Expected one dispute, got %d", len(disputes.raised))
+	}
+	if want := fmt.Sprintf(TelemetryEvidencePath, "d1"); disputes.raised[0].Evidence != want {
+		t.Errorf("Expected evidence %s, got %s", want, disputes.raised[0].Evidence)
+	}
+
+	// Late readings after the stop are refused, and no second dispute is filed
+	if _, err := svc.Ingest(ctx, "d1", samples(time.Now(), 9)); !errors.Is(err, ErrDeliveryNotInTransit) {
+		t.Errorf("Expected ErrDeliveryNotInTransit, got %v", err)
+	}
+	if len(disputes.raised) != 1 {
+		t.Errorf("Expected still one dispute, got %d", len(disputes.raised))
+	}
+}
+
+func TestIngest_B2CExcursionRetriesDisputeAndStopTogether(t *testing.T) {
+	ctx := context.Background()
+	deliveries, deliveryRepo, _, _ := newDeliveryFixture()
+	deliveryRepo.deliveries["d1"].TempCategory = "chilled"
+	deliveryRepo.deliveries["d1"].NGOID = "" // Bought by a consumer: no NGO to raise it
+	if err := deliveries.Assign(ctx, "d1", "c1"); err != nil {
+		t.Fatal(err)
+	}
+
+	telemetry := &fakeTelemetryRepo{}
+	disputes := &fakeDisputes{fail: errors.New("escrow unavailable")}
+	svc := NewTelemetryService(telemetry, deliveries, &fakeNotifier{}, disputes, zap.NewNop())
+
+	start := time.Now().Add(-20 * time.Minute)
+	if _, err := svc.Ingest(ctx, "d1", samples(start, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9)); err == nil {
+		t.Fatal("Expected the dispute failure to be returned")
+	}
+	if d := deliveryRepo.deliveries["d1"]; d.Status != domain.DeliveryAssigned {
+		t.Fatalf("Expected the delivery left in transit for a retry, got %s", d.Status)
+	}
+
+	// The next upload still shows the excursion and finishes both steps
+	disputes.fail = nil
+	if e, err := svc.Ingest(ctx, "d1", samples(start.Add(12*time.Minute), 9)); err != nil || e == nil {
+		t.Fatalf("Expected the retry to handle the excursion, got excursion=%v err=%v", e, err)
+	}
+	if d := deliveryRepo.deliveries["d1"]; d.Status != domain.DeliveryFailed || !d.FoodUnsafe {
+		t.Errorf("Expected failed and unsafe delivery, got status=%s unsafe=%v", d.Status, d.FoodUnsafe)
+	}
+	if len(disputes.raised) != 1 || disputes.raised[0].UserID != coreDomain.PlatformActor {
+		t.Fatalf("Expected one dispute raised by the platform, got %+v", disputes.raised)
+	}
+}
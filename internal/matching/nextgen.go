@@ -5,15 +5,27 @@ import (
 	"fmt"
 	"math"
 	"time"
+
+	carbonDomain "github.com/albnnaardy11/pahlawan-pangan/internal/carbon/domain"
 )
 
+// EmissionFactors resolves the emission factor version in force at a time;
+// the carbon ledger prices savings from the same table
+type EmissionFactors interface {
+	Effective(ctx context.Context, at time.Time) (*carbonDomain.FactorVersion, error)
+}
+
 // PahlawanNextGen encapsulates the unicorn-level features
 type PahlawanNextGen struct {
 	// dependencies like db, nats etc would go here
+	factors EmissionFactors
+	credits carbonDomain.CreditPolicy
 }
 
-func NewPahlawanNextGen() *PahlawanNextGen {
-	return &PahlawanNextGen{}
+// NewPahlawanNextGen estimates with the same factors and credit policy the
+// carbon ledger and credit issuance use
+func NewPahlawanNextGen(factors EmissionFactors, credits carbonDomain.CreditPolicy) *PahlawanNextGen {
+	return &PahlawanNextGen{factors: factors, credits: credits}
 }
 
 // --- Pahlawan-Express (Logistics) ---
@@ -38,28 +50,39 @@ func (s *PahlawanNextGen) RequestPahlawanExpress(ctx context.Context, surplusID
 // --- Pahlawan-Carbon (ESG) ---
 
 type CarbonReport struct {
-	CO2SavedKg   float64 `json:"co2_saved_kg"`
-	TokensIssued int64   `json:"tokens_issued"`
-	ImpactLevel  string  `json:"impact_level"` // Gold, Silver, Bronze
+	CO2SavedKg      float64 `json:"co2_saved_kg"`
+	EstimatedTokens int64   `json:"estimated_credit_tokens"` // Issued only once the savings are checkpointed
+	ImpactLevel     string  `json:"impact_level"`            // Gold, Silver, Bronze
+	FactorVersion   string  `json:"factor_version"`
 }
 
-func (s *PahlawanNextGen) CalculateCarbonImpact(kgs float64) CarbonReport {
-	// 1kg food waste = ~2.5 kg CO2 emission (Average)
-	co2 := kgs * 2.5
-	tokens := int64(co2 / 10.0) // 1 token per 10kg saved
+// CalculateCarbonImpact estimates the CO2e avoided by rescuing kgs of food in
+// a category and region, with the emission factors in force now, and the
+// credit tokens it would be worth on its own
+func (s *PahlawanNextGen) CalculateCarbonImpact(ctx context.Context, kgs float64, category, region string) (CarbonReport, error) {
+	version, err := s.factors.Effective(ctx, time.Now())
+	if err != nil {
+		return CarbonReport{}, err
+	}
+	factor, err := version.Factor(category, region)
+	if err != nil {
+		return CarbonReport{}, err
+	}
+	co2 := kgs * factor.KgCO2ePerKg
 
 	level := "Bronze"
-	if tokens > 100 {
+	if co2 > 1000 {
 		level = "Gold"
-	} else if tokens > 50 {
+	} else if co2 > 500 {
 		level = "Silver"
 	}
 
 	return CarbonReport{
-		CO2SavedKg:   math.Round(co2*100) / 100,
-		TokensIssued: tokens,
-		ImpactLevel:  level,
-	}
+		CO2SavedKg:      math.Round(co2*100) / 100,
+		EstimatedTokens: s.credits.Tokens(co2),
+		ImpactLevel:     level,
+		FactorVersion:   version.Version,
+	}, nil
 }
 
 // --- Pahlawan-Comm (Group Buy) ---
@@ -3,6 +3,8 @@ package matching
 import (
 	"math"
 	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
 )
 
 // PricingEngine handles unicorn-level dynamic pricing for B2C market
@@ -18,11 +20,12 @@ func NewPricingEngine() *PricingEngine {
 
 // CalculatePrice implements Exponential Decay Pricing
 // Formula: Price = Original * e^(-k * t)
-// where t is the percentage of time elapsed toward expiry
-func (p *PricingEngine) CalculatePrice(originalPrice float64, postedAt, expiryAt time.Time) float64 {
+// where t is the percentage of time elapsed toward expiry. Prices are whole
+// rupiah, rounded half up; the floor is rounded up so it is never undercut.
+func (p *PricingEngine) CalculatePrice(originalPrice money.Money, postedAt, expiryAt time.Time) money.Money {
 	now := time.Now()
 	if now.After(expiryAt) {
-		return 0
+		return money.Rupiah(0)
 	}
 
 	totalDuration := expiryAt.Sub(postedAt).Seconds()
@@ -39,15 +42,11 @@ func (p *PricingEngine) CalculatePrice(originalPrice float64, postedAt, expiryAt
 	// At progress = 1.0, multiplier will be around 0.13
 	multiplier := math.Exp(-2.0 * progress)
 
-	finalPrice := originalPrice * multiplier
+	finalPrice := originalPrice.MulRatio(multiplier, money.HalfUp)
 
 	// Ensure it doesn't go below floor
-	floor := originalPrice * p.MinPriceRatio
-	if finalPrice < floor {
-		return floor
-	}
-
-	return math.Round(finalPrice*100) / 100
+	floor := originalPrice.MulRatio(p.MinPriceRatio, money.Up)
+	return money.Max(finalPrice, floor)
 }
 
 // CalculateImpactPoints rewards providers based on quantity and speed of rescue
@@ -3,11 +3,13 @@ package matching
 import (
 	"testing"
 	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
 )
 
 func TestCalculatePrice(t *testing.T) {
 	engine := NewPricingEngine()
-	originalPrice := 100.0
+	originalPrice := money.Rupiah(100)
 	postedAt := time.Now().Add(-1 * time.Hour)
 	expiryAt := time.Now().Add(1 * time.Hour)
 
@@ -16,12 +18,12 @@ func TestCalculatePrice(t *testing.T) {
 	// Multiplier = e^(-2 * 0.5) = e^-1 approx 0.36
 	price := engine.CalculatePrice(originalPrice, postedAt, expiryAt)
 
-	if price <= 0 || price >= originalPrice {
-		t.Errorf("Price should be between 0 and original price, got %f", price)
+	if !price.IsPositive() || !price.LessThan(originalPrice) {
+		t.Errorf("Price should be between 0 and original price, got %s", price)
 	}
 
-	if price > 40 || price < 30 {
-		t.Errorf("Price at midpoint should be around 36, got %f", price)
+	if price.GreaterThan(money.Rupiah(40)) || price.LessThan(money.Rupiah(30)) {
+		t.Errorf("Price at midpoint should be around 36, got %s", price)
 	}
 }
 
@@ -34,3 +36,23 @@ func TestImpactPoints(t *testing.T) {
 		t.Errorf("Expected %d points, got %d", expected, points)
 	}
 }
+
+func TestPriceFloorAndVouchersAreWholeRupiah(t *testing.T) {
+	engine := &PricingEngine{MinPriceRatio: 0.15}
+	// Just before expiry the decay (about 13.5%) would undercut the 15% floor of 12,345 (1,851.75)
+	price := engine.CalculatePrice(money.Rupiah(12345), time.Now().Add(-99*time.Hour), time.Now().Add(time.Minute))
+	if !price.Equal(money.Rupiah(1852)) {
+		t.Errorf("expected the floor rounded up to 1852, got %s", price)
+	}
+
+	vouchers := &VoucherService{}
+	if d, ok := vouchers.ValidateVoucher("ZEROWASTE", money.Rupiah(33333)); !ok || !d.Equal(money.Rupiah(6666)) {
+		t.Errorf("expected 20%% of 33333 rounded down to 6666, got %s", d)
+	}
+	if _, ok := vouchers.ValidateVoucher("PAHLAWANBARU", money.Rupiah(50000)); ok {
+		t.Error("PAHLAWANBARU needs an order above 50000")
+	}
+	if d, ok := vouchers.ValidateVoucher("PAHLAWANBARU", money.Rupiah(50001)); !ok || !d.Equal(money.Rupiah(15000)) {
+		t.Errorf("expected a fixed 15000 discount, got %s", d)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"time"
+
+	"github.com/albnnaardy11/pahlawan-pangan/pkg/money"
 )
 
 // RecommendationEngine implements weighted scoring for Super-App ranking
@@ -47,15 +50,18 @@ func (e *RecommendationEngine) RankSurplus(candidates []SurplusCandidate) []Surp
 // VoucherService handles the promo activation logic
 type VoucherService struct{}
 
-func (s *VoucherService) ValidateVoucher(code string, orderValue float64) (float64, bool) {
+// ValidateVoucher returns the discount a code gives on the order value.
+// Percentage discounts round down so the platform never pays a rupiah more
+// than promised.
+func (s *VoucherService) ValidateVoucher(code string, orderValue money.Money) (money.Money, bool) {
 	// Standard Tokopedia logic: min-order check
-	if code == "PAHLAWANBARU" && orderValue > 50000 {
-		return 15000, true // Fixed 15k discount
+	if code == "PAHLAWANBARU" && orderValue.GreaterThan(money.Rupiah(50000)) {
+		return money.Rupiah(15000), true // Fixed 15k discount
 	}
 	if code == "ZEROWASTE" {
-		return orderValue * 0.2, true // 20% off
+		return orderValue.Percent(20, money.Down), true // 20% off
 	}
-	return 0, false
+	return money.Rupiah(0), false
 }
 
 // FlashSaleMonitor identifies deep-discount items for push notifications
@@ -82,6 +88,8 @@ type FulfillmentStatus struct {
 	Method           FulfillmentOption `json:"method"`
 	TrackingID       string            `json:"tracking_id,omitempty"`
 	VerificationCode string            `json:"verification_code,omitempty"`
+	QRPayload        string            `json:"qr_payload,omitempty"` // Signed claim the merchant app scans
+	CodeExpiresAt    *time.Time        `json:"code_expires_at,omitempty"`
 	DistanceToStore  float64           `json:"distance_to_store_meters"`
 }
 
@@ -97,17 +105,19 @@ func OrchestrateFulfillment(method FulfillmentOption, userLat, userLon, storeLat
 			return FulfillmentStatus{}, fmt.Errorf("distance too far for self-pickup: %.2f km", dist)
 		}
 
+		// The verification code is issued per claim once the claim is stored
 		return FulfillmentStatus{
-			Method:           FulfillmentSelfPickup,
-			VerificationCode: "PAH-PICK-77", // Would be generated in real DB
-			DistanceToStore:  dist * 1000,
+			Method:          FulfillmentSelfPickup,
+			DistanceToStore: dist * 1000,
 		}, nil
 	}
 
-	// Logistics Method: Hook into Gojek/Grab Mock API
+	// Logistics Method: the delivery starts out searching; the logistics
+	// fulfillment service then picks our riders or a partner fleet (Gojek/Grab),
+	// and a partner's booking ID becomes the tracking ID.
 	return FulfillmentStatus{
-		Method:     FulfillmentCourier,
-		TrackingID: "GK-123-RESCUE",
+		Method:          FulfillmentCourier,
+		DistanceToStore: dist * 1000,
 	}, nil
 }
 
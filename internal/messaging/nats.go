@@ -26,7 +26,7 @@ func NewNATSPublisher(nc *nats.Conn) (*NATSPublisher, error) {
 	}
 
 	// Create streams if they don't exist
-	streams := []string{"SURPLUS", "MATCHING", "NOTIFICATIONS"}
+	streams := []string{"SURPLUS", "MATCHING", "NOTIFICATIONS", "DELIVERY"}
 	for _, stream := range streams {
 		_, err := js.StreamInfo(stream)
 		if err != nil {
@@ -88,6 +88,14 @@ func (p *NATSPublisher) getSubject(eventType outbox.EventType) string {
 		return "SURPLUS.expired"
 	case outbox.RematchRequired:
 		return "MATCHING.rematch"
+	case outbox.DeliveryAssigned:
+		return "DELIVERY.assigned"
+	case outbox.FoodPickedUp:
+		return "DELIVERY.picked_up"
+	case outbox.FoodDelivered:
+		return "DELIVERY.completed"
+	case outbox.DeliveryFailed:
+		return "DELIVERY.failed"
 	default:
 		return "SURPLUS.unknown"
 	}
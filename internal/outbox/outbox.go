@@ -17,12 +17,15 @@ var tracer = otel.Tracer("outbox-service")
 type EventType string
 
 const (
-	SurplusPosted   EventType = "surplus.posted"
-	SurplusClaimed  EventType = "surplus.claimed"
-	SurplusExpired  EventType = "surplus.expired"
-	RematchRequired EventType = "surplus.rematch_required"
-	FoodDelivered   EventType = "delivery.completed"
-	FundsReleased   EventType = "escrow.funds_released"
+	SurplusPosted    EventType = "surplus.posted"
+	SurplusClaimed   EventType = "surplus.claimed"
+	SurplusExpired   EventType = "surplus.expired"
+	RematchRequired  EventType = "surplus.rematch_required"
+	DeliveryAssigned EventType = "delivery.assigned"
+	FoodPickedUp     EventType = "delivery.picked_up"
+	FoodDelivered    EventType = "delivery.completed"
+	DeliveryFailed   EventType = "delivery.failed"
+	FundsReleased    EventType = "escrow.funds_released"
 )
 
 // Event represents an event to be published
@@ -0,0 +1,138 @@
+package pickup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/outbox"
+)
+
+type postgresRepository struct {
+	db     *sql.DB
+	outbox outbox.Repository
+}
+
+func NewPostgresRepository(db *sql.DB, outboxRepo outbox.Repository) Repository {
+	return &postgresRepository{db: db, outbox: outboxRepo}
+}
+
+func (r *postgresRepository) CountFailures(ctx context.Context, providerID string, since time.Time) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM pickup_checkins
+		WHERE provider_id = $1 AND checked_at >= $2 AND result NOT IN ('verified', 'rate_limited')
+	`, providerID, since).Scan(&n)
+	return n, err
+}
+
+func (r *postgresRepository) RecordCheckin(ctx context.Context, c Checkin) error {
+	return insertCheckin(ctx, r.db, c)
+}
+
+func (r *postgresRepository) Redeem(ctx context.Context, deliveryID string, code string, c Checkin) (*Redemption, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Row lock: two counters scanning the same QR cannot both hand the food over
+	var red Redemption
+	var used bool
+	var status string
+	var expiresAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT d.id, d.surplus_id, COALESCE(s.claimed_by_ngo_id::text, ''), COALESCE(s.food_type, ''),
+		       COALESCE(s.quantity_kgs, 0), d.is_verified_pickup, COALESCE(d.status, ''), d.pickup_code_expires_at
+		FROM deliveries d
+		JOIN surplus s ON s.id = d.surplus_id
+		WHERE s.provider_id = $1
+		  AND d.fulfillment_method = 'self_pickup'
+		  AND d.pickup_verification_code = $2
+		  AND ($3 = '' OR d.id::text = $3)
+		ORDER BY d.is_verified_pickup, d.created_at DESC
+		LIMIT 1
+		FOR UPDATE OF d
+	`, c.ProviderID, code, deliveryID).Scan(&red.DeliveryID, &red.SurplusID, &red.NGOID, &red.FoodType, &red.QuantityKg, &used, &status, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidPickupCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.DeliveryID = red.DeliveryID
+	if used {
+		return nil, ErrPickupCodeUsed
+	}
+	// Codes issued before expiry existed were a shared constant: never honour them.
+	// A claim closed as stale has its delivery failed and the food relisted, so its
+	// code is dead even inside the TTL.
+	if !expiresAt.Valid || !c.CheckedAt.Before(expiresAt.Time) || status != "ready_for_pickup" {
+		return nil, ErrPickupCodeExpired
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE deliveries
+		SET is_verified_pickup = true, status = 'delivered', delivered_at = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'ready_for_pickup'
+	`, red.DeliveryID, c.CheckedAt)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrPickupCodeExpired
+	}
+	if err := insertCheckin(ctx, tx, c); err != nil {
+		return nil, err
+	}
+
+	// Self-pickup completes the delivery too: carbon and escrow workers need to hear about it
+	payload, err := json.Marshal(map[string]interface{}{
+		"delivery_id": red.DeliveryID,
+		"surplus_id":  red.SurplusID,
+		"vendor_id":   c.ProviderID,
+		"ngo_id":      red.NGOID,
+		"status":      "delivered",
+		"category":    strings.ToUpper(red.FoodType),
+		"weight_kg":   red.QuantityKg,
+		"occurred_at": c.CheckedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	event := outbox.Event{
+		ID:          uuid.New().String(),
+		AggregateID: red.SurplusID,
+		EventType:   outbox.FoodDelivered,
+		Payload:     payload,
+		CreatedAt:   c.CheckedAt,
+	}
+	if err := r.outbox.Save(ctx, tx, event); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &red, nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertCheckin(ctx context.Context, db execer, c Checkin) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO pickup_checkins (delivery_id, provider_id, checked_at, method, result, location)
+		VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5,
+		        CASE WHEN $6 = 0 AND $7 = 0 THEN NULL ELSE ST_SetSRID(ST_MakePoint($6, $7), 4326) END)
+	`, c.DeliveryID, c.ProviderID, c.CheckedAt, c.Method, c.Result, c.Lon, c.Lat)
+	return err
+}
@@ -0,0 +1,184 @@
+package pickup
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultCodeTTL covers a same-day collection; surplus food does not wait longer
+	DefaultCodeTTL = 4 * time.Hour
+	// MaxFailedAttempts wrong codes per provider inside FailureWindow lock verification
+	MaxFailedAttempts = 5
+	FailureWindow     = 15 * time.Minute
+)
+
+// CheckinResult is the outcome recorded for every verification attempt
+type CheckinResult string
+
+const (
+	ResultVerified      CheckinResult = "verified"
+	ResultInvalidCode   CheckinResult = "invalid_code"
+	ResultBadSignature  CheckinResult = "bad_signature"
+	ResultWrongProvider CheckinResult = "wrong_provider"
+	ResultExpired       CheckinResult = "expired"
+	ResultAlreadyUsed   CheckinResult = "already_used"
+	ResultRateLimited   CheckinResult = "rate_limited"
+)
+
+// Method is how the merchant presented the code
+type Method string
+
+const (
+	MethodQR     Method = "qr"
+	MethodManual Method = "manual"
+)
+
+// Attempt is one merchant scan (or typed code) at the counter
+type Attempt struct {
+	ProviderID string
+	QRPayload  string
+	Code       string
+	Lat        float64
+	Lon        float64
+}
+
+func (a Attempt) method() Method {
+	if a.QRPayload != "" {
+		return MethodQR
+	}
+	return MethodManual
+}
+
+// Checkin is a pickup_checkins row
+type Checkin struct {
+	DeliveryID string
+	ProviderID string
+	Method     Method
+	Result     CheckinResult
+	Lat        float64
+	Lon        float64
+	CheckedAt  time.Time
+}
+
+// Redemption is the delivery a verified code handed over
+type Redemption struct {
+	DeliveryID string  `json:"delivery_id"`
+	SurplusID  string  `json:"surplus_id"`
+	NGOID      string  `json:"ngo_id,omitempty"`
+	FoodType   string  `json:"food_type"`
+	QuantityKg float64 `json:"quantity_kg"`
+}
+
+type Repository interface {
+	// CountFailures counts the provider's rejected attempts since the given time
+	CountFailures(ctx context.Context, providerID string, since time.Time) (int, error)
+	// RecordCheckin stores an attempt that did not hand anything over
+	RecordCheckin(ctx context.Context, c Checkin) error
+	// Redeem marks the claim collected, records the check-in and emits the completion
+	// event in one transaction. deliveryID is empty for a typed code. A delivery no
+	// longer ready for pickup, such as a stale claim closed and refunded, is
+	// ErrPickupCodeExpired.
+	Redeem(ctx context.Context, deliveryID string, code string, c Checkin) (*Redemption, error)
+}
+
+// Service issues self-pickup codes at claim time and verifies them at the counter
+type Service struct {
+	repo   Repository
+	signer *Signer
+	ttl    time.Duration
+	logger *zap.Logger
+}
+
+func NewService(repo Repository, signer *Signer, ttl time.Duration, logger *zap.Logger) *Service {
+	return &Service{repo: repo, signer: signer, ttl: ttl, logger: logger}
+}
+
+// NewClaim draws a fresh code for a claim that is about to be stored
+func (s *Service) NewClaim(surplusID, providerID, ngoID string, now time.Time) (Claim, error) {
+	code, err := NewCode()
+	if err != nil {
+		return Claim{}, err
+	}
+	return Claim{
+		SurplusID:  surplusID,
+		ProviderID: providerID,
+		NGOID:      ngoID,
+		Code:       code,
+		ExpiresAt:  now.Add(s.ttl),
+	}, nil
+}
+
+// QRPayload signs a stored claim for the claimant's app to display
+func (s *Service) QRPayload(c Claim) (string, error) {
+	return s.signer.QRPayload(c)
+}
+
+// Verify checks a scanned QR payload or typed code for the provider at the counter.
+// Every attempt lands in pickup_checkins; too many failures lock the provider out
+// for the rest of the window, which stops codes being guessed.
+func (s *Service) Verify(ctx context.Context, a Attempt, now time.Time) (*Redemption, error) {
+	checkin := Checkin{
+		ProviderID: a.ProviderID,
+		Method:     a.method(),
+		Lat:        a.Lat,
+		Lon:        a.Lon,
+		CheckedAt:  now,
+	}
+
+	failures, err := s.repo.CountFailures(ctx, a.ProviderID, now.Add(-FailureWindow))
+	if err != nil {
+		return nil, err
+	}
+	if failures >= MaxFailedAttempts {
+		return nil, s.reject(ctx, checkin, ResultRateLimited, ErrTooManyAttempts)
+	}
+
+	code, deliveryID := NormalizeCode(a.Code), ""
+	if a.QRPayload != "" {
+		claim, err := s.signer.Parse(a.QRPayload)
+		if err != nil {
+			return nil, s.reject(ctx, checkin, ResultBadSignature, ErrInvalidPickupCode)
+		}
+		checkin.DeliveryID = claim.DeliveryID
+		if claim.ProviderID != a.ProviderID {
+			return nil, s.reject(ctx, checkin, ResultWrongProvider, ErrInvalidPickupCode)
+		}
+		if !now.Before(claim.ExpiresAt) {
+			return nil, s.reject(ctx, checkin, ResultExpired, ErrPickupCodeExpired)
+		}
+		code, deliveryID = claim.Code, claim.DeliveryID
+	}
+	if code == "" {
+		return nil, s.reject(ctx, checkin, ResultInvalidCode, ErrInvalidPickupCode)
+	}
+
+	checkin.Result = ResultVerified
+	redemption, err := s.repo.Redeem(ctx, deliveryID, code, checkin)
+	switch {
+	case errors.Is(err, ErrInvalidPickupCode):
+		return nil, s.reject(ctx, checkin, ResultInvalidCode, err)
+	case errors.Is(err, ErrPickupCodeExpired):
+		return nil, s.reject(ctx, checkin, ResultExpired, err)
+	case errors.Is(err, ErrPickupCodeUsed):
+		return nil, s.reject(ctx, checkin, ResultAlreadyUsed, err)
+	case err != nil:
+		return nil, err
+	}
+	return redemption, nil
+}
+
+// reject records the failed attempt and returns the error for the caller
+func (s *Service) reject(ctx context.Context, c Checkin, result CheckinResult, cause error) error {
+	c.Result = result
+	if err := s.repo.RecordCheckin(ctx, c); err != nil {
+		s.logger.Warn("Failed to record pickup check-in",
+			zap.String("provider_id", c.ProviderID),
+			zap.String("result", string(result)),
+			zap.Error(err))
+	}
+	return cause
+}
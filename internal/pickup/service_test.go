@@ -0,0 +1,191 @@
+package pickup
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type fakeRepo struct {
+	claims   map[string]Claim // By code
+	used     map[string]bool
+	closed   map[string]bool // Deliveries failed by the stale claim sweep
+	checkins []Checkin
+}
+
+func (r *fakeRepo) CountFailures(ctx context.Context, providerID string, since time.Time) (int, error) {
+	n := 0
+	for _, c := range r.checkins {
+		if c.ProviderID == providerID && !c.CheckedAt.Before(since) && c.Result != ResultVerified && c.Result != ResultRateLimited {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *fakeRepo) RecordCheckin(ctx context.Context, c Checkin) error {
+	r.checkins = append(r.checkins, c)
+	return nil
+}
+
+func (r *fakeRepo) Redeem(ctx context.Context, deliveryID string, code string, c Checkin) (*Redemption, error) {
+	claim, ok := r.claims[code]
+	if !ok || claim.ProviderID != c.ProviderID || (deliveryID != "" && claim.DeliveryID != deliveryID) {
+		return nil, ErrInvalidPickupCode
+	}
+	if r.used[code] {
+		return nil, ErrPickupCodeUsed
+	}
+	if !c.CheckedAt.Before(claim.ExpiresAt) || r.closed[claim.DeliveryID] {
+		return nil, ErrPickupCodeExpired
+	}
+	r.used[code] = true
+	c.DeliveryID = claim.DeliveryID
+	r.checkins = append(r.checkins, c)
+	return &Redemption{DeliveryID: claim.DeliveryID, SurplusID: claim.SurplusID}, nil
+}
+
+func newFixture(t *testing.T, now time.Time) (*Service, *fakeRepo, Claim) {
+	t.Helper()
+	repo := &fakeRepo{claims: map[string]Claim{}, used: map[string]bool{}, closed: map[string]bool{}}
+	svc := NewService(repo, NewSigner([]byte("test-secret")), DefaultCodeTTL, zap.NewNop())
+	claim, err := svc.NewClaim("s1", "p1", "n1", now)
+	if err != nil {
+		t.Fatalf("NewClaim: %v", err)
+	}
+	claim.DeliveryID = "d1"
+	repo.claims[claim.Code] = claim
+	return svc, repo, claim
+}
+
+func TestNewCode_RandomAndReadable(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		code, err := NewCode()
+		if err != nil {
+			t.Fatalf("NewCode: %v", err)
+		}
+		if len(code) != CodeLength || strings.Trim(code, codeAlphabet) != "" {
+			t.Fatalf("Unexpected code %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("Duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestSigner_RejectsTamperedPayload(t *testing.T) {
+	signer := NewSigner([]byte("test-secret"))
+	qr, err := signer.QRPayload(Claim{DeliveryID: "d1", ProviderID: "p1", Code: "ABCD2345", ExpiresAt: time.Now()})
+	if err != nil {
+		t.Fatalf("QRPayload: %v", err)
+	}
+	if c, err := signer.Parse(qr); err != nil || c.DeliveryID != "d1" || c.Code != "ABCD2345" {
+		t.Fatalf("Expected the claim back, got %+v / %v", c, err)
+	}
+
+	forged, _ := NewSigner([]byte("other-secret")).QRPayload(Claim{DeliveryID: "d1", ProviderID: "p1", Code: "ABCD2345"})
+	parts := strings.Split(qr, ".")
+	for _, bad := range []string{forged, parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2], "PAH-PICK-77", ""} {
+		if _, err := signer.Parse(bad); !errors.Is(err, ErrInvalidPickupCode) {
+			t.Errorf("Expected %q to be rejected, got %v", bad, err)
+		}
+	}
+}
+
+func TestVerify_QRBoundToProviderAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	svc, repo, claim := newFixture(t, now)
+	qr, _ := svc.QRPayload(claim)
+
+	if _, err := svc.Verify(ctx, Attempt{ProviderID: "p2", QRPayload: qr}, now); !errors.Is(err, ErrInvalidPickupCode) {
+		t.Errorf("Another provider must not redeem the code, got %v", err)
+	}
+	if _, err := svc.Verify(ctx, Attempt{ProviderID: "p1", QRPayload: qr}, claim.ExpiresAt); !errors.Is(err, ErrPickupCodeExpired) {
+		t.Errorf("Expected an expired code, got %v", err)
+	}
+
+	red, err := svc.Verify(ctx, Attempt{ProviderID: "p1", QRPayload: qr, Lat: -6.2, Lon: 106.8}, now.Add(time.Hour))
+	if err != nil || red.DeliveryID != "d1" {
+		t.Fatalf("Expected d1 handed over, got %+v / %v", red, err)
+	}
+	if _, err := svc.Verify(ctx, Attempt{ProviderID: "p1", QRPayload: qr}, now.Add(time.Hour)); !errors.Is(err, ErrPickupCodeUsed) {
+		t.Errorf("Expected the code to be single-use, got %v", err)
+	}
+
+	results := []CheckinResult{}
+	for _, c := range repo.checkins {
+		results = append(results, c.Result)
+	}
+	want := []CheckinResult{ResultWrongProvider, ResultExpired, ResultVerified, ResultAlreadyUsed}
+	if strings.Join(toStrings(results), ",") != strings.Join(toStrings(want), ",") {
+		t.Errorf("Expected check-ins %v, got %v", want, results)
+	}
+	if repo.checkins[2].Method != MethodQR || repo.checkins[2].DeliveryID != "d1" {
+		t.Errorf("Expected a QR check-in on d1, got %+v", repo.checkins[2])
+	}
+}
+
+func TestVerify_RefusesCodeOfStaleClosedClaim(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	svc, repo, claim := newFixture(t, now)
+	qr, _ := svc.QRPayload(claim)
+
+	// The sweep refunded the claimant and relisted the food; the code is inside its TTL
+	repo.closed[claim.DeliveryID] = true
+	if _, err := svc.Verify(ctx, Attempt{ProviderID: "p1", QRPayload: qr}, now.Add(time.Hour)); !errors.Is(err, ErrPickupCodeExpired) {
+		t.Fatalf("Expected the closed claim's QR refused, got %v", err)
+	}
+	if _, err := svc.Verify(ctx, Attempt{ProviderID: "p1", Code: claim.Code}, now.Add(time.Hour)); !errors.Is(err, ErrPickupCodeExpired) {
+		t.Fatalf("Expected the closed claim's typed code refused, got %v", err)
+	}
+	if repo.used[claim.Code] {
+		t.Fatal("Expected nothing handed over after the claim was closed")
+	}
+	for _, c := range repo.checkins {
+		if c.Result != ResultExpired {
+			t.Errorf("Expected expired check-ins only, got %+v", c)
+		}
+	}
+}
+
+func TestVerify_RateLimitsFailedAttemptsPerProvider(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	svc, _, claim := newFixture(t, now)
+
+	for i := 0; i < MaxFailedAttempts; i++ {
+		if _, err := svc.Verify(ctx, Attempt{ProviderID: "p1", Code: "WRONG234"}, now); !errors.Is(err, ErrInvalidPickupCode) {
+			t.Fatalf("Attempt %d: expected an invalid code, got %v", i, err)
+		}
+	}
+	// Even the right code is refused while locked out
+	if _, err := svc.Verify(ctx, Attempt{ProviderID: "p1", Code: claim.Code}, now); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("Expected the provider to be locked out, got %v", err)
+	}
+	// Other providers are unaffected
+	if _, err := svc.Verify(ctx, Attempt{ProviderID: "p2", Code: "WRONG234"}, now); !errors.Is(err, ErrInvalidPickupCode) {
+		t.Errorf("Expected p2 to still be checked, got %v", err)
+	}
+
+	// Typed codes are forgiving about case and dashes
+	typed := strings.ToLower(claim.Code[:4]) + "-" + claim.Code[4:]
+	if red, err := svc.Verify(ctx, Attempt{ProviderID: "p1", Code: typed}, now.Add(FailureWindow+time.Second)); err != nil || red.DeliveryID != "d1" {
+		t.Errorf("Expected the lockout to lapse after the window, got %+v / %v", red, err)
+	}
+}
+
+func toStrings(results []CheckinResult) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = string(r)
+	}
+	return out
+}
@@ -0,0 +1,45 @@
+package trust
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type postgresAccountRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresAccountRepository reads account age and KYC from users and
+// counts the user's claims that reached them, paid or donated
+func NewPostgresAccountRepository(db *sql.DB) AccountHistory {
+	return &postgresAccountRepository{db: db}
+}
+
+func (r *postgresAccountRepository) Account(ctx context.Context, userID string) (AccountRecord, error) {
+	var (
+		a         AccountRecord
+		createdAt sql.NullTime
+	)
+	err := r.db.QueryRowContext(ctx, `
+		SELECT u.created_at, u.kyc_verified_at IS NOT NULL,
+		       (SELECT COUNT(*)
+		        FROM deliveries d
+		        JOIN surplus s ON s.id = d.surplus_id
+		        LEFT JOIN payments p ON p.order_id = s.id::TEXT
+		        WHERE d.status = 'delivered'
+		          AND COALESCE(p.customer_id, s.claimed_by_ngo_id::TEXT) = $1)
+		FROM users u
+		WHERE u.id::TEXT = $1
+	`, userID).Scan(&createdAt, &a.KYCVerified, &a.CompletedPickups)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AccountRecord{}, ErrAccountNotFound
+	}
+	if err != nil {
+		return AccountRecord{}, err
+	}
+	if createdAt.Valid {
+		a.CreatedAt = createdAt.Time
+	}
+	return a, nil
+}
@@ -2,16 +2,97 @@ package trust
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math"
+	"time"
 )
 
+// LowestTrustLevel is the badge of a user the platform knows nothing good about yet
+const LowestTrustLevel = "PELUANG_KEDUA"
+
+// ErrAccountNotFound means there is no account to read the history of
+var ErrAccountNotFound = errors.New("user account not found")
+
+// DisputeHistory counts the disputes decided against a user
+type DisputeHistory interface {
+	LostDisputes(ctx context.Context, userID string) (int, error)
+}
+
+// GhostingHistory counts the claims a user let lapse by not showing up
+type GhostingHistory interface {
+	GhostingIncidents(ctx context.Context, userID string) (int, error)
+}
+
+// AccountRecord is what the platform knows about a user's account
+type AccountRecord struct {
+	CompletedPickups int
+	CreatedAt        time.Time // Zero when not recorded
+	KYCVerified      bool
+}
+
+// AccountHistory reads a user's account; ErrAccountNotFound for an unknown user
+type AccountHistory interface {
+	Account(ctx context.Context, userID string) (AccountRecord, error)
+}
+
 // TrustService calculates the comprehensive Pahlawan Score
 type TrustService struct {
-	// In real setup, dependencies: DB, TransactionHistoryRepo
+	disputes DisputeHistory
+	ghosting GhostingHistory
+	accounts AccountHistory
+}
+
+func NewTrustService(disputes DisputeHistory, ghosting GhostingHistory, accounts AccountHistory) *TrustService {
+	return &TrustService{disputes: disputes, ghosting: ghosting, accounts: accounts}
 }
 
-func NewTrustService() *TrustService {
-	return &TrustService{}
+// GhostingIncidents is the ScoreFactors.GhostingIncidents for a user
+func (s *TrustService) GhostingIncidents(ctx context.Context, userID string) (int, error) {
+	return s.ghosting.GhostingIncidents(ctx, userID)
+}
+
+// DisputeCount is the ScoreFactors.DisputeCount for a user: only disputes
+// they lost count, so being on the receiving end of a baseless one costs nothing
+func (s *TrustService) DisputeCount(ctx context.Context, userID string) (int, error) {
+	return s.disputes.LostDisputes(ctx, userID)
+}
+
+// Factors gathers a user's ScoreFactors. Whatever is not on record counts as
+// nothing: no pickups, a new account, no KYC.
+func (s *TrustService) Factors(ctx context.Context, userID string) (ScoreFactors, error) {
+	disputes, err := s.DisputeCount(ctx, userID)
+	if err != nil {
+		return ScoreFactors{}, fmt.Errorf("dispute history: %w", err)
+	}
+	ghosting, err := s.GhostingIncidents(ctx, userID)
+	if err != nil {
+		return ScoreFactors{}, fmt.Errorf("pickup history: %w", err)
+	}
+	account, err := s.accounts.Account(ctx, userID)
+	if err != nil && !errors.Is(err, ErrAccountNotFound) {
+		return ScoreFactors{}, fmt.Errorf("account history: %w", err)
+	}
+	factors := ScoreFactors{
+		TotalPickups:      account.CompletedPickups,
+		GhostingIncidents: ghosting,
+		DisputeCount:      disputes,
+		VerifiedIdentity:  account.KYCVerified,
+	}
+	if !account.CreatedAt.IsZero() {
+		factors.AccountAgeDays = int(time.Since(account.CreatedAt).Hours() / 24)
+	}
+	return factors, nil
+}
+
+// TrustLevel is the user's current badge, as GetTrustLevel gives it. With
+// nothing on record the score stays at its base, the lowest badge.
+func (s *TrustService) TrustLevel(ctx context.Context, userID string) (string, error) {
+	factors, err := s.Factors(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return s.GetTrustLevel(s.CalculateScore(ctx, factors)), nil
 }
 
 // ScoreFactors for calculating trust
@@ -62,6 +143,6 @@ func (s *TrustService) GetTrustLevel(score int) string {
 	case score >= 400:
 		return "WARGA_BAIK"
 	default:
-		return "PELUANG_KEDUA" // Needs improvement
+		return LowestTrustLevel // Needs improvement
 	}
 }
@@ -0,0 +1,52 @@
+package trust
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fixedHistory struct {
+	lost, ghosted int
+	accounts      map[string]AccountRecord
+}
+
+func (h fixedHistory) LostDisputes(context.Context, string) (int, error)      { return h.lost, nil }
+func (h fixedHistory) GhostingIncidents(context.Context, string) (int, error) { return h.ghosted, nil }
+
+func (h fixedHistory) Account(_ context.Context, userID string) (AccountRecord, error) {
+	a, ok := h.accounts[userID]
+	if !ok {
+		return AccountRecord{}, ErrAccountNotFound
+	}
+	return a, nil
+}
+
+func TestTrustLevel_FromAccountHistory(t *testing.T) {
+	ctx := context.Background()
+	h := fixedHistory{accounts: map[string]AccountRecord{
+		"veteran":  {CompletedPickups: 80, CreatedAt: time.Now().AddDate(-1, 0, 0), KYCVerified: true},
+		"newcomer": {CreatedAt: time.Now()},
+		"no-date":  {CompletedPickups: 2},
+	}}
+	svc := NewTrustService(h, h, h)
+
+	factors, err := svc.Factors(ctx, "veteran")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if factors.TotalPickups != 80 || factors.AccountAgeDays < 365 || !factors.VerifiedIdentity {
+		t.Fatalf("expected the recorded history, got %+v", factors)
+	}
+
+	for user, want := range map[string]string{
+		"veteran":  "UNICORN_SAVIOR",
+		"newcomer": LowestTrustLevel,
+		"no-date":  LowestTrustLevel,
+		"unknown":  LowestTrustLevel, // No account: nothing to vouch for them
+	} {
+		if got, err := svc.TrustLevel(ctx, user); err != nil || got != want {
+			t.Errorf("%s: expected %s, got %s (%v)", user, want, got, err)
+		}
+	}
+}
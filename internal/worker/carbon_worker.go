@@ -30,7 +30,7 @@ func (w *CarbonWorker) Start(ctx context.Context) error {
 	w.logger.Info("Starting Carbon Ledger Worker")
 
 	// Subscribe to delivery completed events
-	_, err := w.nc.Subscribe("delivery.completed", func(m *nats.Msg) {
+	_, err := w.nc.Subscribe("DELIVERY.completed", func(m *nats.Msg) {
 		var event outbox.Event
 		if err := json.Unmarshal(m.Data, &event); err != nil {
 			w.logger.Error("Failed to unmarshal carbon event", zap.Error(err))
@@ -42,6 +42,7 @@ func (w *CarbonWorker) Start(ctx context.Context) error {
 		var payload struct {
 			VendorID string  `json:"vendor_id"`
 			Category string  `json:"category"`
+			Region   string  `json:"region"`
 			WeightKg float64 `json:"weight_kg"`
 		}
 		_ = json.Unmarshal(event.Payload, &payload)
@@ -52,7 +53,7 @@ func (w *CarbonWorker) Start(ctx context.Context) error {
 			payload.Category = "PRODUCE"
 		}
 
-		hash, err := w.carbonSvc.RecordSavings(ctx, payload.VendorID, event.AggregateID, payload.Category, payload.WeightKg)
+		entry, err := w.carbonSvc.RecordSavings(ctx, payload.VendorID, event.AggregateID, payload.Category, payload.Region, payload.WeightKg)
 		if err != nil {
 			w.logger.Error("Failed to record carbon savings", zap.Error(err))
 			return
@@ -60,8 +61,9 @@ func (w *CarbonWorker) Start(ctx context.Context) error {
 
 		w.logger.Info("✅ Carbon Footprint Recorded",
 			zap.String("order_id", event.AggregateID),
-			zap.String("hash", hash),
-			zap.Float64("savings_kg", payload.WeightKg*2.5),
+			zap.String("hash", entry.Hash),
+			zap.Float64("savings_kg", entry.CarbonSavedKg),
+			zap.String("factor_version", entry.FactorVersion),
 		)
 	})
 
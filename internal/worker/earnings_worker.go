@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/service"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/outbox"
+)
+
+// EarningsWorker credits the courier ledger when a delivery is completed
+type EarningsWorker struct {
+	earningsSvc *service.EarningsService
+	nc          *nats.Conn
+	logger      *zap.Logger
+}
+
+func NewEarningsWorker(earningsSvc *service.EarningsService, nc *nats.Conn, logger *zap.Logger) *EarningsWorker {
+	return &EarningsWorker{
+		earningsSvc: earningsSvc,
+		nc:          nc,
+		logger:      logger,
+	}
+}
+
+func (w *EarningsWorker) Start(ctx context.Context) error {
+	w.logger.Info("Starting Courier Earnings Worker")
+
+	// Queue group: one replica per event; the ledger ignores redeliveries anyway
+	_, err := w.nc.QueueSubscribe("DELIVERY.completed", "courier-earnings", func(m *nats.Msg) {
+		var event outbox.Event
+		if err := json.Unmarshal(m.Data, &event); err != nil {
+			w.logger.Error("Failed to unmarshal earnings event", zap.Error(err))
+			return
+		}
+		var payload struct {
+			DeliveryID string `json:"delivery_id"`
+		}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil || payload.DeliveryID == "" {
+			return // Completion not driven by the delivery tracker (legacy claims)
+		}
+
+		if err := w.earningsSvc.RecordDelivery(ctx, payload.DeliveryID); err != nil {
+			w.logger.Error("Failed to credit courier", zap.String("delivery_id", payload.DeliveryID), zap.Error(err))
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/escrow/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/escrow/service"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/outbox"
+)
+
+// EscrowWorker mirrors delivery progress into the escrow event log
+type EscrowWorker struct {
+	escrowSvc *service.EscrowService
+	nc        *nats.Conn
+	logger    *zap.Logger
+}
+
+func NewEscrowWorker(escrowSvc *service.EscrowService, nc *nats.Conn, logger *zap.Logger) *EscrowWorker {
+	return &EscrowWorker{
+		escrowSvc: escrowSvc,
+		nc:        nc,
+		logger:    logger,
+	}
+}
+
+func (w *EscrowWorker) Start(ctx context.Context) error {
+	w.logger.Info("Starting Escrow Delivery Worker")
+
+	// Queue group: one replica per event; the stream version check catches the rest
+	_, err := w.nc.QueueSubscribe("DELIVERY.*", "escrow-ledger", func(m *nats.Msg) {
+		var event outbox.Event
+		if err := json.Unmarshal(m.Data, &event); err != nil {
+			w.logger.Error("Failed to unmarshal delivery event", zap.Error(err))
+			return
+		}
+
+		// Escrow is keyed by the claimed surplus (the event aggregate)
+		var err error
+		switch event.EventType {
+		case outbox.DeliveryAssigned:
+			err = w.escrowSvc.CourierAssigned(ctx, event.AggregateID)
+		case outbox.FoodPickedUp:
+			err = w.escrowSvc.FoodPickedUp(ctx, event.AggregateID)
+		case outbox.FoodDelivered:
+			err = w.escrowSvc.FoodDelivered(ctx, event.AggregateID)
+		default:
+			// Failed deliveries keep the funds locked until the dispute/refund flow decides
+			return
+		}
+		if errors.Is(err, domain.ErrEscrowNotFound) {
+			return // Nothing was paid for this order (donations)
+		}
+		if err != nil {
+			w.logger.Warn("Escrow not updated from delivery",
+				zap.String("order_id", event.AggregateID),
+				zap.String("event_type", string(event.EventType)),
+				zap.Error(err))
+			return
+		}
+
+		w.logger.Info("Escrow updated from delivery",
+			zap.String("order_id", event.AggregateID),
+			zap.String("event_type", string(event.EventType)))
+	})
+
+	return err
+}
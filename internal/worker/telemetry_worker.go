@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/domain"
+	"github.com/albnnaardy11/pahlawan-pangan/internal/logistics/service"
+)
+
+// ColdChainTelemetrySubject is where thermal-bag gateways publish sensor batches
+const ColdChainTelemetrySubject = "telemetry.cold_chain"
+
+// TelemetryWorker feeds sensor readings published on NATS into the cold-chain monitor
+type TelemetryWorker struct {
+	telemetrySvc *service.TelemetryService
+	nc           *nats.Conn
+	logger       *zap.Logger
+}
+
+func NewTelemetryWorker(telemetrySvc *service.TelemetryService, nc *nats.Conn, logger *zap.Logger) *TelemetryWorker {
+	return &TelemetryWorker{
+		telemetrySvc: telemetrySvc,
+		nc:           nc,
+		logger:       logger,
+	}
+}
+
+func (w *TelemetryWorker) Start(ctx context.Context) error {
+	w.logger.Info("Starting Cold-Chain Telemetry Worker")
+
+	// Queue group: each batch is evaluated by exactly one replica
+	_, err := w.nc.QueueSubscribe(ColdChainTelemetrySubject, "cold-chain-monitor", func(m *nats.Msg) {
+		var msg struct {
+			DeliveryID string `json:"delivery_id"`
+			SensorID   string `json:"sensor_id"`
+			Readings   []struct {
+				TempC      float64   `json:"temp_c"`
+				RecordedAt time.Time `json:"recorded_at"`
+			} `json:"readings"`
+		}
+		if err := json.Unmarshal(m.Data, &msg); err != nil {
+			w.logger.Error("Failed to unmarshal telemetry", zap.Error(err))
+			return
+		}
+
+		readings := make([]domain.TemperatureReading, len(msg.Readings))
+		for i, rd := range msg.Readings {
+			readings[i] = domain.TemperatureReading{SensorID: msg.SensorID, TempC: rd.TempC, RecordedAt: rd.RecordedAt}
+		}
+
+		excursion, err := w.telemetrySvc.Ingest(ctx, msg.DeliveryID, readings)
+		if err != nil {
+			w.logger.Warn("Telemetry rejected", zap.String("delivery_id", msg.DeliveryID), zap.Error(err))
+			return
+		}
+		if excursion != nil {
+			w.logger.Warn("🌡️ Cold-chain excursion detected",
+				zap.String("delivery_id", msg.DeliveryID),
+				zap.Float64("peak_c", excursion.PeakC))
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,122 @@
+// Package merkle builds Merkle trees and inclusion proofs as RFC 6962
+// (Certificate Transparency) defines them, so a proof can be checked with any
+// CT-compatible tool as well as with this package:
+//
+//	leaf hash = SHA-256(0x00 || leaf)
+//	node hash = SHA-256(0x01 || left || right)
+//
+// A tree of n leaves splits at the largest power of two below n; the tree of
+// zero leaves hashes to SHA-256 of the empty string.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+)
+
+var ErrIndexOutOfRange = errors.New("merkle leaf index out of range")
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// LeafHash is the hash of one leaf's data
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// NodeHash joins two subtree hashes
+func NodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Root is the tree head over the leaves, in order
+func Root(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	}
+	hashes := make([][]byte, len(leaves))
+	for i, l := range leaves {
+		hashes[i] = LeafHash(l)
+	}
+	return root(hashes)
+}
+
+func root(hashes [][]byte) []byte {
+	if len(hashes) == 1 {
+		return hashes[0]
+	}
+	k := split(len(hashes))
+	return NodeHash(root(hashes[:k]), root(hashes[k:]))
+}
+
+// Proof is the audit path for leaves[index]: the sibling hashes from the
+// leaf up to the root
+func Proof(leaves [][]byte, index int) ([][]byte, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, ErrIndexOutOfRange
+	}
+	hashes := make([][]byte, len(leaves))
+	for i, l := range leaves {
+		hashes[i] = LeafHash(l)
+	}
+	return path(hashes, index), nil
+}
+
+func path(hashes [][]byte, index int) [][]byte {
+	if len(hashes) == 1 {
+		return nil
+	}
+	k := split(len(hashes))
+	if index < k {
+		return append(path(hashes[:k], index), root(hashes[k:]))
+	}
+	return append(path(hashes[k:], index-k), root(hashes[:k]))
+}
+
+// Verify checks that leaf sits at index in a tree of size leaves with the
+// given root, using its audit path
+func Verify(leaf []byte, index, size int, proof [][]byte, want []byte) bool {
+	if index < 0 || index >= size {
+		return false
+	}
+	got, ok := fold(LeafHash(leaf), index, size, proof)
+	return ok && bytes.Equal(got, want)
+}
+
+// fold recomputes the root from the bottom up, the inverse of path
+func fold(hash []byte, index, size int, proof [][]byte) ([]byte, bool) {
+	if size == 1 {
+		return hash, len(proof) == 0
+	}
+	if len(proof) == 0 {
+		return nil, false
+	}
+	sibling, rest := proof[len(proof)-1], proof[:len(proof)-1]
+	k := split(size)
+	if index < k {
+		sub, ok := fold(hash, index, k, rest)
+		return NodeHash(sub, sibling), ok
+	}
+	sub, ok := fold(hash, index-k, size-k, rest)
+	return NodeHash(sibling, sub), ok
+}
+
+// split is the largest power of two strictly below n (n > 1)
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
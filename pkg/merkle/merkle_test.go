@@ -0,0 +1,56 @@
+package merkle
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func leaves(n int) [][]byte {
+	out := make([][]byte, n)
+	for i := range out {
+		out[i] = []byte(fmt.Sprintf("entry-%d", i))
+	}
+	return out
+}
+
+func TestRoot_MatchesRFC6962(t *testing.T) {
+	// Leaves and root from the RFC 6962 reference tests (certificate-transparency-go)
+	var data [][]byte
+	for _, h := range []string{"", "00", "10", "2021", "3031", "40414243", "5051525354555657", "606162636465666768696a6b6c6d6e6f"} {
+		b, _ := hex.DecodeString(h)
+		data = append(data, b)
+	}
+	want := "5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328"
+	if got := hex.EncodeToString(Root(data)); got != want {
+		t.Fatalf("root of 8 leaves: got %s, want %s", got, want)
+	}
+	if got := hex.EncodeToString(Root(nil)); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Fatalf("empty root: got %s", got)
+	}
+}
+
+func TestProof_EveryLeafOfEverySizeVerifies(t *testing.T) {
+	for size := 1; size <= 33; size++ {
+		data := leaves(size)
+		root := Root(data)
+		for i := 0; i < size; i++ {
+			proof, err := Proof(data, i)
+			if err != nil {
+				t.Fatalf("size %d leaf %d: %v", size, i, err)
+			}
+			if !Verify(data[i], i, size, proof, root) {
+				t.Fatalf("size %d leaf %d: proof does not verify", size, i)
+			}
+			if size > 1 && Verify(data[(i+1)%size], i, size, proof, root) {
+				t.Fatalf("size %d leaf %d: a different leaf verified", size, i)
+			}
+			if Verify(data[i], i+size, size, proof, root) {
+				t.Fatalf("size %d leaf %d: verified past the end of the tree", size, i)
+			}
+		}
+	}
+	if _, err := Proof(leaves(3), 3); err != ErrIndexOutOfRange {
+		t.Fatalf("expected out of range, got %v", err)
+	}
+}
@@ -0,0 +1,347 @@
+// Package money is exact currency arithmetic. Rupiah has no minor unit in
+// circulation, so an amount is a whole number of rupiah held in an int64;
+// floats and decimal strings only appear at the edges (legacy JSON, DECIMAL
+// columns, gateway reports) and are rounded on the way in by an explicit rule.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch    = errors.New("currency mismatch")
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrInvalidAmount       = errors.New("invalid money amount")
+)
+
+// Currency is an ISO 4217 code
+type Currency string
+
+// IDR is the platform's currency; it is the currency of every zero value
+const IDR Currency = "IDR"
+
+var supported = map[Currency]bool{IDR: true}
+
+// Rounding decides what happens to a fraction of a unit
+type Rounding int
+
+const (
+	HalfUp   Rounding = iota // Half a unit or more rounds away from zero; prices and conversions
+	HalfEven                 // Half a unit rounds to the even neighbour; bulk statistics
+	Down                     // Toward zero; discounts and shares the platform gives away
+	Up                       // Away from zero; fees the platform charges
+)
+
+// Money is a whole number of currency units. The zero value is zero rupiah.
+type Money struct {
+	units    int64
+	currency Currency
+}
+
+// Rupiah is n whole rupiah
+func Rupiah(n int64) Money {
+	return Money{units: n, currency: IDR}
+}
+
+// New is n whole units of the currency
+func New(n int64, c Currency) (Money, error) {
+	if !supported[c] {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, c)
+	}
+	return Money{units: n, currency: c}, nil
+}
+
+// FromFloat converts a legacy float amount, rounding the fraction by r. The
+// float's shortest decimal form is what gets rounded, so 0.5 is exactly half.
+func FromFloat(v float64, r Rounding) Money {
+	m, err := Parse(strconv.FormatFloat(v, 'f', -1, 64), r)
+	if err != nil {
+		// NaN has no decimal form, and ±Inf or anything past int64 does not
+		// fit; saturate by sign like a float-to-int conversion would
+		switch {
+		case math.IsNaN(v):
+			return Rupiah(0)
+		case v > 0:
+			return Rupiah(math.MaxInt64)
+		}
+		return Rupiah(math.MinInt64)
+	}
+	return m
+}
+
+// Parse reads a decimal rupiah amount such as "25000" or "-1500.50" (one
+// optional sign, a decimal point, no thousands separators), rounding any
+// fraction by r. Amounts past int64 are refused.
+func Parse(s string, r Rounding) (Money, error) {
+	in := strings.TrimSpace(s)
+	digits, neg := strings.CutPrefix(in, "-")
+	if !neg {
+		digits = strings.TrimPrefix(digits, "+")
+	}
+	whole, frac, _ := strings.Cut(digits, ".")
+	if (whole == "" && frac == "") || !isDigits(whole) || !isDigits(frac) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, in)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	// The magnitude may reach 2^63 when negative, one past MaxInt64
+	limit := uint64(math.MaxInt64)
+	if neg {
+		limit++
+	}
+	magnitude, err := strconv.ParseUint(whole, 10, 64)
+	if err != nil || magnitude > limit {
+		return Money{}, fmt.Errorf("%w: %q out of range", ErrInvalidAmount, in)
+	}
+	if roundsAway(magnitude, frac, r) {
+		if magnitude == limit {
+			return Money{}, fmt.Errorf("%w: %q out of range", ErrInvalidAmount, in)
+		}
+		magnitude++
+	}
+	units := int64(magnitude) // 2^63 wraps to MinInt64, which negating leaves as is
+	if neg {
+		units = -units
+	}
+	return Rupiah(units), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// roundsAway reports whether the fraction digits take the magnitude up a unit
+func roundsAway(units uint64, frac string, r Rounding) bool {
+	frac = strings.TrimRight(frac, "0")
+	if frac == "" {
+		return false
+	}
+	switch r {
+	case Down:
+		return false
+	case Up:
+		return true
+	}
+	switch {
+	case frac[0] > '5', frac[0] == '5' && len(frac) > 1:
+		return true
+	case frac[0] < '5':
+		return false
+	}
+	// Exactly half
+	return r == HalfUp || units%2 == 1
+}
+
+// divRound divides n by d (d > 0) rounding the remainder by r
+func divRound(n, d int64, r Rounding) int64 {
+	q, rem := n/d, n%d
+	if rem == 0 {
+		return q
+	}
+	away := int64(1)
+	if n < 0 {
+		away, rem = -1, -rem
+	}
+	switch r {
+	case Down:
+		return q
+	case Up:
+		return q + away
+	}
+	switch twice := 2 * rem; {
+	case twice > d:
+		return q + away
+	case twice < d:
+		return q
+	}
+	if r == HalfUp || q%2 != 0 {
+		return q + away
+	}
+	return q
+}
+
+// Units is the amount in whole currency units
+func (m Money) Units() int64 { return m.units }
+
+// Currency is the amount's currency; IDR for the zero value
+func (m Money) Currency() Currency {
+	if m.currency == "" {
+		return IDR
+	}
+	return m.currency
+}
+
+// Float64 is the amount for legacy float APIs and metrics only; never
+// compute with it
+func (m Money) Float64() float64 { return float64(m.units) }
+
+func (m Money) IsZero() bool     { return m.units == 0 }
+func (m Money) IsPositive() bool { return m.units > 0 }
+func (m Money) IsNegative() bool { return m.units < 0 }
+
+func (m Money) mustMatch(o Money) Currency {
+	if m.Currency() != o.Currency() {
+		// Mixing currencies is a programming error, not a runtime condition
+		panic(fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency(), o.Currency()))
+	}
+	return m.Currency()
+}
+
+func (m Money) Add(o Money) Money {
+	return Money{units: m.units + o.units, currency: m.mustMatch(o)}
+}
+
+func (m Money) Sub(o Money) Money {
+	return Money{units: m.units - o.units, currency: m.mustMatch(o)}
+}
+
+func (m Money) Neg() Money {
+	return Money{units: -m.units, currency: m.Currency()}
+}
+
+// Mul is the amount times a whole quantity
+func (m Money) Mul(n int64) Money {
+	return Money{units: m.units * n, currency: m.Currency()}
+}
+
+// Percent is p percent of the amount, rounded by r
+func (m Money) Percent(p int64, r Rounding) Money {
+	return Money{units: divRound(m.units*p, 100, r), currency: m.Currency()}
+}
+
+// Bps is bps basis points of the amount, rounded by r
+func (m Money) Bps(bps int64, r Rounding) Money {
+	return Money{units: divRound(m.units*bps, 10000, r), currency: m.Currency()}
+}
+
+// MulRatio scales the amount by a real factor such as a price decay
+// multiplier, rounding the result by r
+func (m Money) MulRatio(ratio float64, r Rounding) Money {
+	scaled := FromFloat(float64(m.units)*ratio, r)
+	scaled.currency = m.Currency()
+	return scaled
+}
+
+// Cmp is -1, 0 or +1 as m is less than, equal to or greater than o
+func (m Money) Cmp(o Money) int {
+	m.mustMatch(o)
+	switch {
+	case m.units < o.units:
+		return -1
+	case m.units > o.units:
+		return 1
+	}
+	return 0
+}
+
+// Equal compares amount and currency; the zero value equals zero rupiah
+func (m Money) Equal(o Money) bool {
+	return m.units == o.units && m.Currency() == o.Currency()
+}
+
+func (m Money) LessThan(o Money) bool    { return m.Cmp(o) < 0 }
+func (m Money) GreaterThan(o Money) bool { return m.Cmp(o) > 0 }
+
+// Min is the smaller of the two amounts
+func Min(a, b Money) Money {
+	if a.LessThan(b) {
+		return a
+	}
+	return b
+}
+
+// Max is the larger of the two amounts
+func Max(a, b Money) Money {
+	if a.GreaterThan(b) {
+		return a
+	}
+	return b
+}
+
+// String is the amount with its code, e.g. "IDR 25000"
+func (m Money) String() string {
+	return string(m.Currency()) + " " + strconv.FormatInt(m.units, 10)
+}
+
+// MarshalJSON writes a plain number of rupiah, as the API always has
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatInt(m.units, 10)), nil
+}
+
+// UnmarshalJSON takes a number (a fraction is rounded half up) or
+// {"amount": 25000, "currency": "IDR"}
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.TrimSpace(string(data))
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, "{") {
+		var obj struct {
+			Amount   json.Number `json:"amount"`
+			Currency Currency    `json:"currency"`
+		}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+		if obj.Currency == "" {
+			obj.Currency = IDR
+		}
+		if !supported[obj.Currency] {
+			return fmt.Errorf("%w: %q", ErrUnsupportedCurrency, obj.Currency)
+		}
+		s = obj.Amount.String()
+	}
+	parsed, err := Parse(s, HalfUp)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores whole units; DECIMAL and BIGINT columns both take it
+func (m Money) Value() (driver.Value, error) {
+	return m.units, nil
+}
+
+// Scan reads BIGINT, DECIMAL (as text) or float columns, rounding any
+// fraction half up; NULL is zero
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = Rupiah(0)
+	case int64:
+		*m = Rupiah(v)
+	case float64:
+		*m = FromFloat(v, HalfUp)
+	case []byte:
+		return m.scanText(string(v))
+	case string:
+		return m.scanText(v)
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidAmount, src)
+	}
+	return nil
+}
+
+func (m *Money) scanText(s string) error {
+	parsed, err := Parse(s, HalfUp)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,145 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseRounding(t *testing.T) {
+	cases := []struct {
+		in   string
+		r    Rounding
+		want int64
+	}{
+		{"25000", HalfUp, 25000},
+		{"25000.00", HalfUp, 25000},
+		{"1500.5", HalfUp, 1501},
+		{"1500.5", HalfEven, 1500},
+		{"1501.5", HalfEven, 1502},
+		{"1500.49", HalfUp, 1500},
+		{"1500.51", HalfEven, 1501},
+		{"1500.01", Up, 1501},
+		{"1500.99", Down, 1500},
+		{"-1500.5", HalfUp, -1501},
+		{"-1500.5", Down, -1500},
+		{".5", HalfUp, 1},
+		{"+1500", HalfUp, 1500},
+		{"9223372036854775807", HalfUp, math.MaxInt64},
+		{"-9223372036854775808", HalfUp, math.MinInt64},
+		{"9223372036854775806.5", HalfUp, math.MaxInt64},
+	}
+	for _, c := range cases {
+		got, err := Parse(c.in, c.r)
+		if err != nil || got.Units() != c.want {
+			t.Errorf("Parse(%q, %d) = %d, %v; want %d", c.in, c.r, got.Units(), err, c.want)
+		}
+	}
+	for _, bad := range []string{
+		"", "abc", "1.2.3", "1,5", "12e3",
+		"-+5", "+-5", "--5", "++5", "-", "+", "5.-1", "5.+1", // One sign, in front only
+		"9223372036854775808", "-9223372036854775809", "9223372036854775807.5", "100000000000000000000", // Past int64
+	} {
+		if _, err := Parse(bad, HalfUp); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Parse(%q): expected ErrInvalidAmount, got %v", bad, err)
+		}
+	}
+}
+
+func TestFromFloatSaturates(t *testing.T) {
+	cases := []struct {
+		in   float64
+		want int64
+	}{
+		{1500.5, 1501},
+		{-1500.5, -1501},
+		{1e20, math.MaxInt64},
+		{-1e20, math.MinInt64},
+		{math.MaxFloat64, math.MaxInt64},
+		{-math.MaxFloat64, math.MinInt64},
+		{math.Inf(1), math.MaxInt64},
+		{math.Inf(-1), math.MinInt64},
+		{math.NaN(), 0},
+	}
+	for _, c := range cases {
+		if got := FromFloat(c.in, HalfUp); got.Units() != c.want {
+			t.Errorf("FromFloat(%g) = %d; want %d", c.in, got.Units(), c.want)
+		}
+	}
+}
+
+func TestArithmeticIsExact(t *testing.T) {
+	// A float sum of ten 0.1 rupiah items drifts; whole rupiah do not
+	total := Money{}
+	for i := 0; i < 10; i++ {
+		total = total.Add(Rupiah(3333))
+	}
+	if !total.Equal(Rupiah(33330)) {
+		t.Fatalf("expected 33330, got %s", total)
+	}
+	if got := Rupiah(33333).Percent(20, Down); got.Units() != 6666 {
+		t.Errorf("20%% of 33333 rounded down: got %d", got.Units())
+	}
+	if got := Rupiah(33335).Bps(1000, HalfUp); got.Units() != 3334 {
+		t.Errorf("10%% of 33335 half up: got %d", got.Units())
+	}
+	if got := Rupiah(-33335).Bps(1000, HalfEven); got.Units() != -3334 {
+		t.Errorf("10%% of -33335 half even: got %d", got.Units())
+	}
+	if got := Rupiah(100).MulRatio(0.125, HalfUp); got.Units() != 13 {
+		t.Errorf("100 * 0.125 half up: got %d", got.Units())
+	}
+	if got := FromFloat(0.1+0.2, HalfUp); got.Units() != 0 {
+		t.Errorf("0.30000000000000004 rounds to 0, got %d", got.Units())
+	}
+	if !Min(Rupiah(5), Rupiah(7)).Equal(Rupiah(5)) || !Max(Rupiah(5), Rupiah(7)).Equal(Rupiah(7)) {
+		t.Error("min/max")
+	}
+}
+
+func TestJSONAndSQLCodecs(t *testing.T) {
+	var v struct {
+		Amount Money `json:"amount"`
+	}
+	for in, want := range map[string]int64{
+		`{"amount": 25000}`:   25000,
+		`{"amount": 24999.5}`: 25000,
+		`{"amount": {"amount": 15000, "currency": "IDR"}}`: 15000,
+	} {
+		if err := json.Unmarshal([]byte(in), &v); err != nil || v.Amount.Units() != want {
+			t.Errorf("unmarshal %s: got %d, %v", in, v.Amount.Units(), err)
+		}
+	}
+	if err := json.Unmarshal([]byte(`{"amount": {"amount": 1, "currency": "USD"}}`), &v); !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Errorf("expected USD to be refused, got %v", err)
+	}
+	out, _ := json.Marshal(struct {
+		Amount Money `json:"amount"`
+	}{Rupiah(35000)})
+	if string(out) != `{"amount":35000}` {
+		t.Errorf("marshal: got %s", out)
+	}
+
+	var m Money
+	for src, want := range map[interface{}]int64{int64(42): 42, "25000.50": 25001, 19999.49: 19999} {
+		if err := m.Scan(src); err != nil || m.Units() != want {
+			t.Errorf("scan %v: got %d, %v", src, m.Units(), err)
+		}
+	}
+	if err := m.Scan([]byte("12000.00")); err != nil || m.Units() != 12000 {
+		t.Errorf("scan DECIMAL text: got %d, %v", m.Units(), err)
+	}
+	if v, _ := Rupiah(7).Value(); v != int64(7) {
+		t.Errorf("value: got %v", v)
+	}
+}
+
+func TestMixingCurrenciesPanics(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	Rupiah(1).Add(Money{units: 1, currency: "USD"})
+}